@@ -0,0 +1,287 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// Handler is the http handler of runtime admin api, it must be served on a trusted address,
+// or require a token by SetToken
+type Handler struct {
+	client  *doh.DoH
+	clients []*doh.DoH
+	flushes []func(...dns.Domain)
+	reload  func() error
+	token   string
+	mux     *http.ServeMux
+	sync.RWMutex
+}
+
+// Provider is a provider and whether it is enabled
+type Provider struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// Stats is the live statistics of a provider
+type Stats struct {
+	Provider    string           `json:"provider"`
+	Enabled     bool             `json:"enabled"`
+	Queries     int64            `json:"queries"`
+	Successes   int64            `json:"successes"`
+	Errors      map[string]int64 `json:"errors"`
+	CacheHits   int64            `json:"cache_hits"`
+	SuccessRate float64          `json:"success_rate"`
+	P50         string           `json:"p50"`
+	P90         string           `json:"p90"`
+	P99         string           `json:"p99"`
+}
+
+// Version returns package version
+func Version() string {
+	return "0.1.0"
+}
+
+// Author returns package author
+func Author() string {
+	return "[Li Kexian](https://www.likexian.com/)"
+}
+
+// License returns package license
+func License() string {
+	return "Licensed under the Apache License 2.0"
+}
+
+// New returns a new admin api handler of client, the endpoints are:
+//
+//	GET  /providers                  list providers of client
+//	POST /providers/{name}/enable    enable the provider of client and the added clients
+//	POST /providers/{name}/disable   disable the provider of client and the added clients
+//	POST /cache/flush?name=...       flush the cache of names of all clients and flushes, all if no names
+//	GET  /stats                      view the live statistics of client
+//	POST /reload                     reload the config if the reload func is set
+//	GET  /healthz                    view the readiness as Healthz
+func New(c *doh.DoH) *Handler {
+	h := &Handler{client: c, mux: http.NewServeMux()}
+
+	h.mux.HandleFunc("GET /providers", h.providers)
+	h.mux.HandleFunc("POST /providers/{name}/enable", h.toggle(true))
+	h.mux.HandleFunc("POST /providers/{name}/disable", h.toggle(false))
+	h.mux.HandleFunc("POST /cache/flush", h.flush)
+	h.mux.HandleFunc("GET /stats", h.stats)
+	h.mux.HandleFunc("POST /reload", h.doReload)
+	h.mux.Handle("GET /healthz", Healthz(c))
+
+	return h
+}
+
+// AddClient adds the clients toggled and flushed with the client, for example the policy clients of proxy
+func (h *Handler) AddClient(cs ...*doh.DoH) *Handler {
+	h.Lock()
+	h.clients = append(h.clients, cs...)
+	h.Unlock()
+
+	return h
+}
+
+// AddFlush adds the func flushing a cache of names by POST /cache/flush, for example the forward cache of proxy
+func (h *Handler) AddFlush(fn func(names ...dns.Domain)) *Handler {
+	h.Lock()
+	h.flushes = append(h.flushes, fn)
+	h.Unlock()
+
+	return h
+}
+
+// SetToken set the bearer token required by the POST endpoints, empty to not require
+func (h *Handler) SetToken(token string) *Handler {
+	h.Lock()
+	h.token = token
+	h.Unlock()
+
+	return h
+}
+
+// SetReload set the func reloading the config by POST /reload, nil to disable
+func (h *Handler) SetReload(fn func() error) *Handler {
+	h.Lock()
+	h.reload = fn
+	h.Unlock()
+
+	return h
+}
+
+// ServeHTTP serves an admin api request, the POST ones are unauthorized without the token if it is set
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.RLock()
+	token := h.token
+	h.RUnlock()
+
+	if token != "" && r.Method == http.MethodPost {
+		v, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(v), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+	}
+
+	h.mux.ServeHTTP(w, r)
+}
+
+// providers lists the providers of client
+func (h *Handler) providers(w http.ResponseWriter, r *http.Request) {
+	ps := []Provider{}
+	for _, v := range h.client.Stats() {
+		ps = append(ps, Provider{Name: v.Provider, Enabled: h.enabled(v.Provider)})
+	}
+
+	writeJSON(w, http.StatusOK, ps)
+}
+
+// toggle returns the handler enabling or disabling the provider
+func (h *Handler) toggle(enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.ToLower(r.PathValue("name"))
+		p, err := doh.ParseProvider(name)
+		if err != nil || !h.used(name) {
+			writeError(w, http.StatusNotFound, "provider not found: "+name)
+			return
+		}
+
+		for _, v := range h.all() {
+			v.SetProviderEnabled(p, enabled)
+		}
+		writeJSON(w, http.StatusOK, Provider{Name: name, Enabled: enabled})
+	}
+}
+
+// flush flushes the cache of names
+func (h *Handler) flush(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	names := []dns.Domain{}
+	for _, v := range r.Form["name"] {
+		names = append(names, dns.Domain(v))
+	}
+
+	for _, v := range h.all() {
+		v.FlushCache(names...)
+	}
+
+	h.RLock()
+	flushes := h.flushes
+	h.RUnlock()
+	for _, fn := range flushes {
+		fn(names...)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"flushed": len(names)})
+}
+
+// stats views the live statistics of providers
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
+	ss := []Stats{}
+	for _, v := range h.client.Stats() {
+		ss = append(ss, Stats{
+			Provider:    v.Provider,
+			Enabled:     h.enabled(v.Provider),
+			Queries:     v.Queries,
+			Successes:   v.Successes,
+			Errors:      v.Errors,
+			CacheHits:   v.CacheHits,
+			SuccessRate: v.SuccessRate,
+			P50:         v.P50.String(),
+			P90:         v.P90.String(),
+			P99:         v.P99.String(),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, ss)
+}
+
+// doReload reloads the config by the reload func
+func (h *Handler) doReload(w http.ResponseWriter, r *http.Request) {
+	h.RLock()
+	fn := h.reload
+	h.RUnlock()
+
+	if fn == nil {
+		writeError(w, http.StatusNotImplemented, "reload is not supported")
+		return
+	}
+
+	if err := fn(); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"reloaded": true})
+}
+
+// all returns the client and the added clients
+func (h *Handler) all() []*doh.DoH {
+	h.RLock()
+	defer h.RUnlock()
+
+	return append([]*doh.DoH{h.client}, h.clients...)
+}
+
+// enabled returns whether the provider of name is enabled
+func (h *Handler) enabled(name string) bool {
+	p, err := doh.ParseProvider(name)
+	return err == nil && h.client.ProviderEnabled(p)
+}
+
+// used returns whether the provider of name is used by any client
+func (h *Handler) used(name string) bool {
+	for _, c := range h.all() {
+		for _, v := range c.Stats() {
+			if v.Provider == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// writeJSON writes the json body with status code
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes the json error with status code
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
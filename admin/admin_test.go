@@ -0,0 +1,217 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestVersion(t *testing.T) {
+	assert.Contains(t, Version(), ".")
+	assert.Contains(t, Author(), "likexian")
+	assert.Contains(t, License(), "Apache License")
+}
+
+func TestHandler(t *testing.T) {
+	queried := 0
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		queried++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body: ioutil.NopCloser(strings.NewReader(
+				`{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`)),
+			Request: r,
+		}, nil
+	})
+
+	c := doh.Use(doh.GoogleProvider, doh.CloudflareProvider).SetRoundTripper(rt).SetFormat(dns.FormatJSON).
+		EnableCache(true)
+	defer c.Close()
+
+	h := New(c)
+	do := func(method, target string, v interface{}) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		if v != nil {
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), v))
+		}
+		return w.Code
+	}
+
+	ps := []Provider{}
+	assert.Equal(t, do(http.MethodGet, "/providers", &ps), http.StatusOK)
+	assert.Equal(t, ps, []Provider{{Name: "google", Enabled: true}, {Name: "cloudflare", Enabled: true}})
+
+	p := Provider{}
+	assert.Equal(t, do(http.MethodPost, "/providers/Cloudflare/disable", &p), http.StatusOK)
+	assert.Equal(t, p, Provider{Name: "cloudflare", Enabled: false})
+	assert.False(t, c.ProviderEnabled(doh.CloudflareProvider))
+
+	assert.Equal(t, do(http.MethodPost, "/providers/quad9/disable", nil), http.StatusNotFound)
+	assert.Equal(t, do(http.MethodPost, "/providers/xx/enable", nil), http.StatusNotFound)
+	assert.Equal(t, do(http.MethodGet, "/providers/google/enable", nil), http.StatusMethodNotAllowed)
+
+	ctx := context.Background()
+	_, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, queried, 1)
+
+	ss := []Stats{}
+	assert.Equal(t, do(http.MethodGet, "/stats", &ss), http.StatusOK)
+	assert.Equal(t, ss[0].Provider, "google")
+	assert.Equal(t, ss[0].Queries, int64(1))
+	assert.Equal(t, ss[0].CacheHits, int64(1))
+	assert.True(t, ss[0].Enabled)
+	assert.False(t, ss[1].Enabled)
+
+	assert.Equal(t, do(http.MethodPost, "/cache/flush?name=example.com", nil), http.StatusOK)
+	_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, queried, 1)
+
+	assert.Equal(t, do(http.MethodPost, "/cache/flush?name=likexian.com", nil), http.StatusOK)
+	_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, queried, 2)
+
+	assert.Equal(t, do(http.MethodPost, "/cache/flush", nil), http.StatusOK)
+	_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, queried, 3)
+
+	assert.Equal(t, do(http.MethodPost, "/providers/cloudflare/enable", &p), http.StatusOK)
+	assert.True(t, c.ProviderEnabled(doh.CloudflareProvider))
+
+	e := map[string]string{}
+	assert.Equal(t, do(http.MethodPost, "/reload", &e), http.StatusNotImplemented)
+	assert.Contains(t, e["error"], "not supported")
+
+	reloaded := 0
+	h.SetReload(func() error {
+		reloaded++
+		if reloaded > 1 {
+			return fmt.Errorf("invalid config")
+		}
+		return nil
+	})
+	assert.Equal(t, do(http.MethodPost, "/reload", nil), http.StatusOK)
+	assert.Equal(t, do(http.MethodPost, "/reload", &e), http.StatusInternalServerError)
+	assert.Equal(t, e["error"], "invalid config")
+	assert.Equal(t, reloaded, 2)
+}
+
+func TestToken(t *testing.T) {
+	c := doh.Use(doh.GoogleProvider)
+	defer c.Close()
+
+	h := New(c).SetToken("secret")
+	do := func(method, target, token string) int {
+		r := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, do(http.MethodGet, "/providers", ""), http.StatusOK)
+	assert.Equal(t, do(http.MethodPost, "/providers/google/disable", ""), http.StatusUnauthorized)
+	assert.Equal(t, do(http.MethodPost, "/providers/google/disable", "xx"), http.StatusUnauthorized)
+	assert.Equal(t, do(http.MethodPost, "/cache/flush", ""), http.StatusUnauthorized)
+	assert.Equal(t, do(http.MethodPost, "/reload", ""), http.StatusUnauthorized)
+	assert.True(t, c.ProviderEnabled(doh.GoogleProvider))
+
+	assert.Equal(t, do(http.MethodPost, "/providers/google/disable", "secret"), http.StatusOK)
+	assert.False(t, c.ProviderEnabled(doh.GoogleProvider))
+
+	h.SetToken("")
+	assert.Equal(t, do(http.MethodPost, "/providers/google/enable", ""), http.StatusOK)
+	assert.True(t, c.ProviderEnabled(doh.GoogleProvider))
+}
+
+func TestAddClient(t *testing.T) {
+	c := doh.Use(doh.GoogleProvider).EnableCache(true)
+	defer c.Close()
+
+	queried := 0
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		queried++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body: ioutil.NopCloser(strings.NewReader(
+				`{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`)),
+			Request: r,
+		}, nil
+	})
+	pc := doh.Use(doh.GoogleProvider, doh.Quad9Provider).SetRoundTripper(rt).SetFormat(dns.FormatJSON).
+		EnableCache(true)
+	defer pc.Close()
+
+	flushed := [][]dns.Domain{}
+	h := New(c).AddClient(pc).AddFlush(func(names ...dns.Domain) {
+		flushed = append(flushed, names)
+	})
+	do := func(target string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, nil))
+		return w.Code
+	}
+
+	assert.Equal(t, do("/providers/quad9/disable"), http.StatusOK)
+	assert.False(t, pc.ProviderEnabled(doh.Quad9Provider))
+	assert.Equal(t, do("/providers/google/disable"), http.StatusOK)
+	assert.False(t, c.ProviderEnabled(doh.GoogleProvider))
+	assert.False(t, pc.ProviderEnabled(doh.GoogleProvider))
+	assert.Equal(t, do("/providers/google/enable"), http.StatusOK)
+	assert.True(t, pc.ProviderEnabled(doh.GoogleProvider))
+
+	ctx := context.Background()
+	_, err := pc.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, queried, 1)
+
+	assert.Equal(t, do("/cache/flush?name=likexian.com"), http.StatusOK)
+	_, err = pc.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, queried, 2)
+
+	assert.Equal(t, do("/cache/flush"), http.StatusOK)
+	assert.Equal(t, flushed, [][]dns.Domain{{"likexian.com"}, {}})
+}
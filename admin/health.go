@@ -0,0 +1,69 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package admin
+
+import (
+	"net/http"
+
+	"github.com/ideatocode/doh-go"
+)
+
+// Health is the health of a provider
+type Health struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Healthy bool   `json:"healthy"`
+}
+
+// Readiness is the readiness of client
+type Readiness struct {
+	Ready     bool     `json:"ready"`
+	Providers []Health `json:"providers"`
+}
+
+// Healthz returns the http handler of client readiness, it answers 200 if at least one provider is healthy,
+// else 503, and it is safe to be served on a public address
+func Healthz(c *doh.DoH) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		rs := Readiness{Providers: []Health{}}
+		for _, v := range c.Stats() {
+			p, err := doh.ParseProvider(v.Provider)
+			if err != nil {
+				continue
+			}
+			h := Health{Name: v.Provider, Enabled: c.ProviderEnabled(p), Healthy: c.Healthy(p)}
+			rs.Ready = rs.Ready || h.Healthy
+			rs.Providers = append(rs.Providers, h)
+		}
+
+		code := http.StatusOK
+		if !rs.Ready {
+			code = http.StatusServiceUnavailable
+		}
+
+		writeJSON(w, code, rs)
+	})
+}
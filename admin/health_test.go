@@ -0,0 +1,65 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestHealthz(t *testing.T) {
+	c := doh.Use(doh.GoogleProvider, doh.CloudflareProvider)
+	defer c.Close()
+
+	do := func(h http.Handler, method string) (int, Readiness) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, "/healthz", nil))
+		rs := Readiness{}
+		if w.Code != http.StatusMethodNotAllowed {
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &rs))
+		}
+		return w.Code, rs
+	}
+
+	code, rs := do(Healthz(c), http.MethodGet)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, rs, Readiness{Ready: true, Providers: []Health{
+		{Name: "google", Enabled: true, Healthy: true},
+		{Name: "cloudflare", Enabled: true, Healthy: true},
+	}})
+
+	c.SetProviderEnabled(doh.GoogleProvider, false)
+	code, rs = do(New(c), http.MethodGet)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, rs.Providers[0], Health{Name: "google"})
+
+	c.SetProviderEnabled(doh.CloudflareProvider, false)
+	code, rs = do(Healthz(c), http.MethodGet)
+	assert.Equal(t, code, http.StatusServiceUnavailable)
+	assert.False(t, rs.Ready)
+
+	code, _ = do(Healthz(c), http.MethodPost)
+	assert.Equal(t, code, http.StatusMethodNotAllowed)
+}
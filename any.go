@@ -0,0 +1,137 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// DefaultANYTypes is the types queried and merged in place of the ANY queries refused by providers
+var DefaultANYTypes = []dns.Type{dns.TypeA, dns.TypeAAAA, dns.TypeCNAME, dns.TypeMX, dns.TypeNS, dns.TypeTXT,
+	dns.TypeSOA}
+
+// anyResult is the result of a type queried in place of ANY
+type anyResult struct {
+	rsp    *dns.Response
+	cached bool
+	err    error
+}
+
+// SetANYFallback set the types queried and merged in place of the ANY queries refused by providers as RFC 8482,
+// DefaultANYTypes by default, and no types to disable the fallback
+func (c *DoH) SetANYFallback(types ...dns.Type) *DoH {
+	c.Lock()
+	c.anyTypes = slices.Clone(types)
+	c.Unlock()
+
+	return c
+}
+
+// anyQuery do ANY query, and fans out to the fallback types if it is refused, the answers are merged
+func (c *DoH) anyQuery(ctx context.Context, d dns.Domain, s dns.ECS) (*dns.Response, bool, error) {
+	rsp, cached, err := c.query(ctx, d, dns.TypeANY, s)
+
+	c.RLock()
+	types := c.anyTypes
+	c.RUnlock()
+
+	if len(types) == 0 || !refusedANY(rsp) {
+		return rsp, cached, err
+	}
+
+	results := make([]anyResult, len(types))
+
+	var wg sync.WaitGroup
+	for k, t := range types {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, cached, err := c.query(ctx, d, t, s)
+			results[k] = anyResult{r, cached, err}
+		}()
+	}
+	wg.Wait()
+
+	var rr *dns.Response
+	seen := map[dns.Answer]bool{}
+	cached = true
+	for _, v := range results {
+		if v.err != nil || v.rsp == nil {
+			continue
+		}
+		if rr == nil {
+			r := *v.rsp
+			r.Question, r.Answer = []dns.Question{}, []dns.Answer{}
+			for _, q := range v.rsp.Question {
+				q.Type = 255
+				r.Question = append(r.Question, q)
+			}
+			rr = &r
+		}
+		rr.AD = rr.AD && v.rsp.AD
+		rr.TC = rr.TC || v.rsp.TC
+		cached = cached && v.cached
+		for _, a := range v.rsp.Answer {
+			if !seen[a] {
+				seen[a] = true
+				rr.Answer = append(rr.Answer, a)
+			}
+		}
+	}
+
+	if rr == nil {
+		return results[0].rsp, results[0].cached, results[0].err
+	}
+
+	return rr, cached, nil
+}
+
+// refusedANY returns whether the ANY response is refused as RFC 8482, by NOTIMP, REFUSED, no answers,
+// or the synthesized HINFO record
+func refusedANY(rsp *dns.Response) bool {
+	if rsp == nil {
+		return false
+	}
+
+	switch rsp.Status {
+	case 4, 5:
+		return true
+	case 0:
+	default:
+		return false
+	}
+
+	if len(rsp.Answer) == 0 {
+		return true
+	}
+
+	for _, v := range rsp.Answer {
+		if v.Type == 13 && strings.Contains(strings.ToUpper(v.Data), "RFC8482") {
+			return true
+		}
+	}
+
+	return false
+}
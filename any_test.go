@@ -0,0 +1,137 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+// anyRecorder returns a round tripper answering the ANY queries with any, and the queried types
+func anyRecorder(any string) (http.RoundTripper, func() []string) {
+	var mu sync.Mutex
+	types := []string{}
+
+	answers := map[string]string{
+		"A": `{"name":"likexian.com.","type":5,"TTL":300,"data":"www.likexian.com."},` +
+			`{"name":"www.likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}`,
+		"AAAA": `{"name":"likexian.com.","type":5,"TTL":300,"data":"www.likexian.com."},` +
+			`{"name":"www.likexian.com.","type":28,"TTL":300,"data":"2001::1"}`,
+		"MX":  `{"name":"likexian.com.","type":15,"TTL":300,"data":"10 mx.likexian.com."}`,
+		"ANY": any,
+	}
+
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		t := r.URL.Query().Get("type")
+		mu.Lock()
+		types = append(types, t)
+		mu.Unlock()
+
+		status, answer := 0, answers[t]
+		switch {
+		case t == "ANY" && !strings.HasPrefix(any, "{"):
+			fmt.Sscan(any, &status)
+			answer = ""
+		case t == "SPF":
+			status = 2
+		}
+
+		body := fmt.Sprintf(`{"Status":%d,"AD":true,"Question":[{"name":"likexian.com.","type":1}],"Answer":[%s]}`,
+			status, answer)
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {dns.ContentTypeJSON}},
+			Body: ioutil.NopCloser(strings.NewReader(body)), Request: r}, nil
+	})
+
+	return rt, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		v := types
+		types = []string{}
+		return v
+	}
+}
+
+func TestANYQuery(t *testing.T) {
+	ctx := context.Background()
+
+	for _, v := range []string{"4", "5", "", `{"name":"likexian.com.","type":13,"TTL":3789,"data":"\"RFC8482\" \"\""}`} {
+		rt, types := anyRecorder(v)
+		c := Use(GoogleProvider).SetRoundTripper(rt).SetFormat(dns.FormatJSON)
+
+		rsp, err := c.Query(ctx, "likexian.com", dns.TypeANY)
+		assert.Nil(t, err, v)
+		assert.Equal(t, len(types()), 1+len(DefaultANYTypes))
+		assert.Equal(t, rsp.Question, []dns.Question{{Name: "likexian.com.", Type: 255}})
+		assert.True(t, rsp.AD)
+
+		data := []string{}
+		for a := range rsp.Answers() {
+			data = append(data, a.Data)
+		}
+		assert.Equal(t, data, []string{"www.likexian.com.", "1.1.1.1", "2001::1", "10 mx.likexian.com."})
+		c.Close()
+	}
+
+	rt, types := anyRecorder(`{"name":"likexian.com.","type":1,"TTL":300,"data":"1.2.3.4"}`)
+	c := Use(GoogleProvider).SetRoundTripper(rt).SetFormat(dns.FormatJSON)
+	defer c.Close()
+
+	rsp, err := c.Query(ctx, "likexian.com", dns.TypeANY)
+	assert.Nil(t, err)
+	assert.Equal(t, types(), []string{"ANY"})
+	assert.Equal(t, rsp.Answer[0].Data, "1.2.3.4")
+
+	rt, types = anyRecorder("4")
+	c = Use(GoogleProvider).SetRoundTripper(rt).SetFormat(dns.FormatJSON).SetANYFallback(dns.TypeMX, dns.TypeTXT)
+	defer c.Close()
+
+	rsp, err = c.Query(ctx, "likexian.com", dns.TypeANY)
+	assert.Nil(t, err)
+	assert.Equal(t, len(types()), 3)
+	assert.Equal(t, len(rsp.Answer), 1)
+
+	rt, _ = anyRecorder("4")
+	c = Use(GoogleProvider).SetRoundTripper(rt).SetFormat(dns.FormatJSON).SetANYFallback(dns.TypeSPF)
+	defer c.Close()
+
+	rsp, err = c.Query(ctx, "likexian.com", "any")
+	assert.NotNil(t, err)
+	assert.Equal(t, rsp.Status, 2)
+
+	rt, types = anyRecorder("4")
+	c = Use(GoogleProvider).SetRoundTripper(rt).SetFormat(dns.FormatJSON).SetANYFallback()
+	defer c.Close()
+
+	rsp, err = c.Query(ctx, "likexian.com", dns.TypeANY)
+	assert.NotNil(t, err)
+	assert.Equal(t, rsp.Status, 4)
+	assert.Equal(t, types(), []string{"ANY"})
+
+	assert.False(t, refusedANY(nil))
+	assert.False(t, refusedANY(&dns.Response{Status: 3}))
+}
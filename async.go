@@ -0,0 +1,137 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// Default async pool of QueryAsync
+const (
+	// DefaultAsyncWorkers is the number of workers querying the async queries
+	DefaultAsyncWorkers = 16
+	// DefaultAsyncQueue is the max number of async queries waiting for a worker
+	DefaultAsyncQueue = 1024
+)
+
+// ErrClientClosed is returned by the async queries after the client is closed
+var ErrClientClosed = errors.New("doh: client closed")
+
+// asyncJob is a query of QueryAsync
+type asyncJob struct {
+	ctx      context.Context
+	question Question
+	callback func(*dns.Response, error)
+}
+
+// asyncPool is the workers of async queries, they are started by the first query
+type asyncPool struct {
+	jobs   chan asyncJob
+	start  sync.Once
+	closed atomic.Bool
+	sync.RWMutex
+}
+
+// QueryAsync do DoH query on the internal worker pool, and calls back with the response,
+// see ECSQueryAsync
+func (c *DoH) QueryAsync(ctx context.Context, d dns.Domain, t dns.Type, callback func(*dns.Response, error)) {
+	c.ECSQueryAsync(ctx, d, t, "", callback)
+}
+
+// ECSQueryAsync do DoH query with the edns0-client-subnet option on the internal worker pool without
+// spawning a goroutine per query, the callback is called on a worker, or before return with ErrOverloaded if
+// DefaultAsyncQueue queries are waiting, or ErrClientClosed after the client is closed
+func (c *DoH) ECSQueryAsync(ctx context.Context, d dns.Domain, t dns.Type, s dns.ECS,
+	callback func(*dns.Response, error)) {
+	if err := c.async.submit(c, asyncJob{ctx, Question{Name: d, Type: t, ECS: s}, callback}); err != nil {
+		callback(nil, err)
+	}
+}
+
+// QueryChan do DoH query on the internal worker pool, and returns a channel receiving its result,
+// see ECSQueryChan
+func (c *DoH) QueryChan(ctx context.Context, d dns.Domain, t dns.Type) <-chan Result {
+	return c.ECSQueryChan(ctx, d, t, "")
+}
+
+// ECSQueryChan do DoH query with the edns0-client-subnet option on the internal worker pool, and returns
+// a channel receiving its result once and then closed, so that the outstanding queries can be selected on
+func (c *DoH) ECSQueryChan(ctx context.Context, d dns.Domain, t dns.Type, s dns.ECS) <-chan Result {
+	r := make(chan Result, 1)
+	q := Question{Name: d, Type: t, ECS: s}
+	c.ECSQueryAsync(ctx, d, t, s, func(rsp *dns.Response, err error) {
+		r <- Result{Question: q, Response: rsp, Err: err}
+		close(r)
+	})
+
+	return r
+}
+
+// submit queues the job, the workers are started by the first job
+func (a *asyncPool) submit(c *DoH, job asyncJob) error {
+	a.RLock()
+	defer a.RUnlock()
+
+	if a.closed.Load() {
+		return ErrClientClosed
+	}
+
+	a.start.Do(func() {
+		for i := 0; i < DefaultAsyncWorkers; i++ {
+			go a.work(c)
+		}
+	})
+
+	select {
+	case a.jobs <- job:
+		return nil
+	default:
+		return ErrOverloaded
+	}
+}
+
+// work queries the jobs until the pool is closed, the jobs queued then are called back with ErrClientClosed
+func (a *asyncPool) work(c *DoH) {
+	for job := range a.jobs {
+		if a.closed.Load() {
+			job.callback(nil, ErrClientClosed)
+			continue
+		}
+		q := job.question
+		job.callback(c.ECSQuery(job.ctx, q.Name, q.Type, q.ECS))
+	}
+}
+
+// close stops the workers once the queries in process are done
+func (a *asyncPool) close() {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.closed.Swap(true) {
+		return
+	}
+
+	close(a.jobs)
+}
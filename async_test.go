@@ -0,0 +1,113 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestQueryAsync(t *testing.T) {
+	rt, hosts := hostRecorder()
+	c := Use(GoogleProvider).SetRoundTripper(rt)
+
+	var mu sync.Mutex
+	answers := []string{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		c.QueryAsync(context.Background(), "likexian.com", dns.TypeA, func(rsp *dns.Response, err error) {
+			defer wg.Done()
+			assert.Nil(t, err)
+			mu.Lock()
+			answers = append(answers, rsp.Answer[0].Data)
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	assert.Equal(t, len(answers), 10)
+	assert.Equal(t, len(hosts()), 10)
+
+	errc := make(chan error, 1)
+	c.ECSQueryAsync(context.Background(), "likexian.com", dns.TypeA, "1.2.3.4", func(rsp *dns.Response, err error) {
+		errc <- err
+	})
+	assert.Nil(t, <-errc)
+
+	c.Close()
+	c.QueryAsync(context.Background(), "likexian.com", dns.TypeA, func(rsp *dns.Response, err error) {
+		errc <- err
+	})
+	assert.Equal(t, <-errc, ErrClientClosed)
+}
+
+func TestAsyncPoolOverloaded(t *testing.T) {
+	errc := make(chan error, 2)
+	job := asyncJob{callback: func(rsp *dns.Response, err error) {
+		errc <- err
+	}}
+
+	a := &asyncPool{jobs: make(chan asyncJob, 1)}
+	a.start.Do(func() {})
+
+	assert.Nil(t, a.submit(nil, job))
+	assert.Equal(t, a.submit(nil, job), ErrOverloaded)
+
+	a.close()
+	a.close()
+	assert.Equal(t, a.submit(nil, job), ErrClientClosed)
+
+	a.work(nil)
+	assert.Equal(t, <-errc, ErrClientClosed)
+}
+
+func TestQueryChan(t *testing.T) {
+	rt, _ := hostRecorder()
+	c := Use(GoogleProvider).SetRoundTripper(rt).SetBlocklist("ads.example")
+
+	ctx := context.Background()
+	a := c.QueryChan(ctx, "likexian.com", dns.TypeA)
+	b := c.ECSQueryChan(ctx, "ads.example", dns.TypeA, "1.2.3.4")
+
+	for i := 0; i < 2; i++ {
+		select {
+		case v := <-a:
+			assert.Nil(t, v.Err)
+			assert.Equal(t, v.Question.Name, dns.Domain("likexian.com"))
+			assert.Equal(t, v.Response.Answer[0].Data, "1.1.1.1")
+			a = nil
+		case v := <-b:
+			assert.NotNil(t, v.Err)
+			assert.Equal(t, v.Question.ECS, dns.ECS("1.2.3.4"))
+			assert.Equal(t, v.Response.Status, 3)
+			_, ok := <-b
+			assert.False(t, ok)
+			b = nil
+		}
+	}
+
+	c.Close()
+	v := <-c.QueryChan(ctx, "likexian.com", dns.TypeA)
+	assert.Equal(t, v.Err, ErrClientClosed)
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// BenchmarkOptions is the options of benchmark, 0 to use the default
+type BenchmarkOptions struct {
+	// Types is the query types of each domain, default is A
+	Types []dns.Type
+	// Rounds is the times to query the workload, default is 1
+	Rounds int
+	// Concurrency is the max concurrent queries per provider, default is 1
+	Concurrency int
+	// Timeout is the timeout of each query, default is 5s
+	Timeout time.Duration
+}
+
+// BenchmarkResult is the benchmark result of a provider, latencies are of the successful queries
+type BenchmarkResult struct {
+	Provider    string
+	Queries     int
+	Successes   int
+	Errors      map[string]int
+	SuccessRate float64
+	Min         time.Duration
+	Max         time.Duration
+	Mean        time.Duration
+	P50         time.Duration
+	P90         time.Duration
+	P99         time.Duration
+}
+
+// Benchmark queries each domain with each provider directly, bypassing the cache and failover,
+// returns the results in the order of providers
+func (c *DoH) Benchmark(ctx context.Context, domains []dns.Domain, opts BenchmarkOptions) []BenchmarkResult {
+	if len(opts.Types) == 0 {
+		opts.Types = []dns.Type{dns.TypeA}
+	}
+
+	if opts.Rounds <= 0 {
+		opts.Rounds = 1
+	}
+
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+
+	ps, _ := c.list()
+	results := make([]BenchmarkResult, len(ps))
+
+	var wg sync.WaitGroup
+	for k, p := range ps {
+		wg.Add(1)
+		go func(k int, p Provider) {
+			defer wg.Done()
+			results[k] = benchmark(ctx, p, domains, opts)
+		}(k, p)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// benchmark returns the benchmark result of provider
+func benchmark(ctx context.Context, p Provider, domains []dns.Domain, opts BenchmarkOptions) BenchmarkResult {
+	type query struct {
+		d dns.Domain
+		t dns.Type
+	}
+
+	queries := make(chan query)
+	go func() {
+		defer close(queries)
+		for i := 0; i < opts.Rounds; i++ {
+			for _, d := range domains {
+				for _, t := range opts.Types {
+					if ctx.Err() != nil {
+						return
+					}
+					select {
+					case queries <- query{d, t}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	result := BenchmarkResult{Provider: p.String(), Errors: map[string]int{}}
+	latency := []time.Duration{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for q := range queries {
+				qctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+				e := &Event{Provider: p.String(), Domain: q.d, Type: q.t, Start: time.Now()}
+				e.Response, e.Err = p.Query(qctx, q.d, q.t)
+				e.Duration = time.Since(e.Start)
+				cancel()
+				mu.Lock()
+				result.Queries++
+				if class := e.ErrorClass(); class != "" {
+					result.Errors[class]++
+				} else {
+					result.Successes++
+					latency = append(latency, e.Duration)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if result.Queries > 0 {
+		result.SuccessRate = float64(result.Successes) / float64(result.Queries)
+	}
+
+	if len(latency) == 0 {
+		return result
+	}
+
+	sort.Slice(latency, func(i, j int) bool {
+		return latency[i] < latency[j]
+	})
+
+	total := time.Duration(0)
+	for _, v := range latency {
+		total += v
+	}
+
+	result.Min = latency[0]
+	result.Max = latency[len(latency)-1]
+	result.Mean = total / time.Duration(len(latency))
+	result.P50 = percentile(latency, 0.5)
+	result.P90 = percentile(latency, 0.9)
+	result.P99 = percentile(latency, 0.99)
+
+	return result
+}
+
+// percentile returns the nearest rank percentile of sorted latencies
+func percentile(latency []time.Duration, q float64) time.Duration {
+	rank := int(math.Ceil(float64(len(latency))*q)) - 1
+	if rank < 0 {
+		rank = 0
+	}
+
+	if rank >= len(latency) {
+		rank = len(latency) - 1
+	}
+
+	return latency[rank]
+}
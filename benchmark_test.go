@@ -0,0 +1,102 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestBenchmark(t *testing.T) {
+	var queried int32
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&queried, 1)
+		body := `{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`
+		if r.URL.Query().Get("name") == "nx.likexian.com" {
+			body = `{"Status":3}`
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})
+
+	c := Use(GoogleProvider, Quad9Provider).SetRoundTripper(rt).SetFormat(dns.FormatJSON).EnableCache(true)
+	defer c.Close()
+
+	ctx := context.Background()
+	results := c.Benchmark(ctx, []dns.Domain{"likexian.com", "nx.likexian.com"}, BenchmarkOptions{
+		Types:       []dns.Type{dns.TypeA, dns.TypeAAAA},
+		Rounds:      3,
+		Concurrency: 2,
+	})
+
+	assert.Equal(t, atomic.LoadInt32(&queried), int32(24))
+	assert.Equal(t, len(results), 2)
+	for k, v := range []string{"google", "quad9"} {
+		r := results[k]
+		assert.Equal(t, r.Provider, v)
+		assert.Equal(t, r.Queries, 12)
+		assert.Equal(t, r.Successes, 6)
+		assert.Equal(t, r.Errors, map[string]int{ErrorClassRcode: 6})
+		assert.Equal(t, r.SuccessRate, 0.5)
+		assert.True(t, r.Min <= r.P50 && r.P50 <= r.P90 && r.P90 <= r.P99 && r.P99 <= r.Max)
+		assert.True(t, r.Min <= r.Mean && r.Mean <= r.Max)
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	results = c.Benchmark(cctx, []dns.Domain{"likexian.com"}, BenchmarkOptions{})
+	assert.Equal(t, results[0].Successes, 0)
+	assert.Equal(t, results[0].P50, time.Duration(0))
+}
+
+func TestPercentile(t *testing.T) {
+	latency := []time.Duration{}
+	for i := 1; i <= 10; i++ {
+		latency = append(latency, time.Duration(i))
+	}
+
+	assert.Equal(t, percentile(latency, 0), time.Duration(1))
+	assert.Equal(t, percentile(latency, 0.5), time.Duration(5))
+	assert.Equal(t, percentile(latency, 0.9), time.Duration(9))
+	assert.Equal(t, percentile(latency, 0.99), time.Duration(10))
+	assert.Equal(t, percentile(latency[:1], 0.99), time.Duration(1))
+}
+
+func TestParseProvider(t *testing.T) {
+	for k, v := range []string{"cloudflare", "dnspod", "Google", " quad9 "} {
+		p, err := ParseProvider(v)
+		assert.Nil(t, err)
+		assert.Equal(t, p, Providers[k])
+	}
+
+	_, err := ParseProvider("xx")
+	assert.NotNil(t, err)
+}
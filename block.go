@@ -0,0 +1,61 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// Block returns a middleware answering NXDOMAIN to the names and their subdomains without querying,
+// the blocked response is returned with an error as a failed response code
+func Block(names ...string) Middleware {
+	zones := newZones(names)
+
+	return func(next QueryFunc) QueryFunc {
+		return func(ctx context.Context, d dns.Domain, t dns.Type, s dns.ECS) (*dns.Response, error) {
+			if _, ok := matchZone(string(d), zones); !ok {
+				return next(ctx, d, t, s)
+			}
+			return blocked(d, t), fmt.Errorf("doh: blocked: %s", d)
+		}
+	}
+}
+
+// blocked returns the NXDOMAIN response of blocked name
+func blocked(d dns.Domain, t dns.Type) *dns.Response {
+	code, _ := t.Code()
+	name, err := d.Punycode()
+	if err != nil {
+		name = string(d)
+	}
+	name = dns.Canonical(name)
+
+	return &dns.Response{
+		Status:   3,
+		RD:       true,
+		RA:       true,
+		Question: []dns.Question{{Name: name, Type: int(code)}},
+		Answer:   []dns.Answer{},
+		Provider: "blocklist",
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestBlock(t *testing.T) {
+	rt, hosts := hostRecorder()
+	c := Use(GoogleProvider).SetRoundTripper(rt).AddMiddleware(Block("ads.example", "", "Tracker.Example."))
+	defer c.Close()
+
+	ctx := context.Background()
+	for _, v := range []dns.Domain{"ads.example", "x.ads.example", "tracker.example"} {
+		rsp, err := c.Query(ctx, v, dns.TypeAAAA)
+		assert.NotNil(t, err)
+		assert.Equal(t, rsp.Status, 3)
+		assert.Equal(t, rsp.Provider, "blocklist")
+		assert.Equal(t, rsp.Question[0].Type, 28)
+	}
+	assert.Equal(t, len(hosts()), 0)
+
+	rsp, err := c.Query(ctx, "xads.example", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Status, 0)
+	assert.Equal(t, len(hosts()), 1)
+}
+
+func TestSetBlocklist(t *testing.T) {
+	rt, hosts := hostRecorder()
+	c := Use(GoogleProvider).SetRoundTripper(rt).SetBlocklist("ads.example")
+	defer c.Close()
+
+	ctx := context.Background()
+	rsp, err := c.Query(ctx, "x.ads.example", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Equal(t, rsp.Status, 3)
+	assert.Equal(t, len(hosts()), 0)
+
+	c.SetBlocklist()
+	_, err = c.Query(ctx, "x.ads.example", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, len(hosts()), 1)
+}
@@ -0,0 +1,358 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// BlockMode is the answer of blocked names
+type BlockMode int
+
+// Supported block modes
+const (
+	// BlockNXDOMAIN answers NXDOMAIN, it is returned with an error as a failed response code
+	BlockNXDOMAIN BlockMode = iota
+	// BlockNullIP answers 0.0.0.0 to A and :: to AAAA queries, and no answers to the others
+	BlockNullIP
+)
+
+// DefaultBlocklistTimeout is the default timeout of loading a blocklist url
+const DefaultBlocklistTimeout = 30 * time.Second
+
+// Blocklist is the blocked names loaded from hosts files and adblock lists of files or urls,
+// the hosts and plain domain entries block the name only, the adblock ||name^ rules block the subdomains too,
+// and the adblock @@||name^ exceptions of any source unblock the name and its subdomains
+type Blocklist struct {
+	sources []string
+	mode    BlockMode
+	client  *http.Client
+	entries map[string]*blockEntries
+	refresh time.Duration
+	stopc   chan struct{}
+	sync.RWMutex
+}
+
+// blockEntries is the entries of a blocklist source
+type blockEntries struct {
+	names  map[string]struct{}
+	zones  map[string]struct{}
+	allows map[string]struct{}
+}
+
+// hostsIgnored is the names of hosts files not blocked
+var hostsIgnored = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"ip6-localnet":          true,
+	"ip6-mcastprefix":       true,
+	"ip6-allnodes":          true,
+	"ip6-allrouters":        true,
+	"ip6-allhosts":          true,
+	"0.0.0.0":               true,
+}
+
+// NewBlocklist returns a new blocklist of sources, a source is a file path or http(s) url,
+// Load must be called before it blocks any name
+func NewBlocklist(sources ...string) *Blocklist {
+	return &Blocklist{
+		sources: sources,
+		mode:    BlockNXDOMAIN,
+		client:  &http.Client{Timeout: DefaultBlocklistTimeout},
+		entries: map[string]*blockEntries{},
+	}
+}
+
+// SetBlocklists set the blocklists answering the blocked names without querying, they are closed by Close
+func (c *DoH) SetBlocklists(lists ...*Blocklist) *DoH {
+	c.Lock()
+	c.blocklists = lists
+	c.Unlock()
+
+	return c
+}
+
+// SetMode set the answer of blocked names, default is BlockNXDOMAIN
+func (b *Blocklist) SetMode(mode BlockMode) *Blocklist {
+	b.Lock()
+	b.mode = mode
+	b.Unlock()
+
+	return b
+}
+
+// SetHTTPClient set the http client of loading urls, nil to use the default
+func (b *Blocklist) SetHTTPClient(client *http.Client) *Blocklist {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultBlocklistTimeout}
+	}
+
+	b.Lock()
+	b.client = client
+	b.Unlock()
+
+	return b
+}
+
+// SetRefresh set the interval of loading the sources again in background, 0 to disable
+func (b *Blocklist) SetRefresh(interval time.Duration) *Blocklist {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.stopc != nil {
+		close(b.stopc)
+		b.stopc = nil
+	}
+
+	b.refresh = interval
+	if interval <= 0 {
+		return b
+	}
+
+	stopc := make(chan struct{})
+	b.stopc = stopc
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stopc:
+				return
+			case <-t.C:
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				_ = b.Load(ctx)
+				cancel()
+			}
+		}
+	}()
+
+	return b
+}
+
+// Close stops the background refresh
+func (b *Blocklist) Close() {
+	b.SetRefresh(0)
+}
+
+// Load loads all sources, the previous entries of a source failed to load are kept,
+// it returns the last error if any source failed
+func (b *Blocklist) Load(ctx context.Context) error {
+	var err error
+
+	for _, v := range b.sources {
+		e, ee := b.load(ctx, v)
+		if ee != nil {
+			err = fmt.Errorf("doh: blocklist: %s: %w", v, ee)
+			continue
+		}
+		b.Lock()
+		b.entries[v] = e
+		b.Unlock()
+	}
+
+	return err
+}
+
+// Len returns the number of entries
+func (b *Blocklist) Len() int {
+	b.RLock()
+	defer b.RUnlock()
+
+	n := 0
+	for _, v := range b.entries {
+		n += len(v.names) + len(v.zones) + len(v.allows)
+	}
+
+	return n
+}
+
+// Blocked returns whether the domain is blocked
+func (b *Blocklist) Blocked(d dns.Domain) bool {
+	name := normalizeZone(string(d))
+
+	b.RLock()
+	defer b.RUnlock()
+
+	for _, v := range b.entries {
+		if _, ok := matchZone(name, v.allows); ok {
+			return false
+		}
+	}
+
+	for _, v := range b.entries {
+		if _, ok := v.names[name]; ok {
+			return true
+		}
+		if _, ok := matchZone(name, v.zones); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// response returns the response of blocked domain, and the error of a failed response code
+func (b *Blocklist) response(d dns.Domain, t dns.Type) (*dns.Response, error) {
+	b.RLock()
+	mode := b.mode
+	b.RUnlock()
+
+	rsp := blocked(d, t)
+	if mode != BlockNullIP {
+		return rsp, fmt.Errorf("doh: blocked: %s", d)
+	}
+
+	rsp.Status = 0
+	name := rsp.Question[0].Name
+	switch strings.ToUpper(string(t)) {
+	case string(dns.TypeA):
+		rsp.Answer = []dns.Answer{{Name: name, Type: 1, TTL: 60, Data: "0.0.0.0"}}
+	case string(dns.TypeAAAA):
+		rsp.Answer = []dns.Answer{{Name: name, Type: 28, TTL: 60, Data: "::"}}
+	}
+
+	return rsp, nil
+}
+
+// load returns the entries of source
+func (b *Blocklist) load(ctx context.Context, source string) (*blockEntries, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return parseBlocklist(f)
+	}
+
+	b.RLock()
+	client := b.client
+	b.RUnlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status code: %d", rsp.StatusCode)
+	}
+
+	return parseBlocklist(rsp.Body)
+}
+
+// parseBlocklist returns the entries of hosts file, domain list or adblock list,
+// the adblock rules with modifiers, wildcards, regexps and cosmetic rules are skipped
+func parseBlocklist(r io.Reader) (*blockEntries, error) {
+	e := &blockEntries{names: map[string]struct{}{}, zones: map[string]struct{}{}, allows: map[string]struct{}{}}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if i := strings.Index(line, "#"); i >= 0 {
+			// the adblock cosmetic rules such as example.com##.ad are not comments
+			if i > 0 && line[i-1] != ' ' && line[i-1] != '\t' {
+				continue
+			}
+			line = strings.TrimSpace(line[:i])
+		}
+
+		if line == "" || strings.HasPrefix(line, "!") || strings.HasPrefix(line, "[") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "||") || strings.HasPrefix(line, "@@||") {
+			zones := e.zones
+			if strings.HasPrefix(line, "@@") {
+				zones, line = e.allows, strings.TrimPrefix(line, "@@")
+			}
+			rule := strings.TrimPrefix(line, "||")
+			if !strings.HasSuffix(rule, "^") {
+				continue
+			}
+			rule = strings.TrimSuffix(rule, "^")
+			if isBlockName(rule) {
+				zones[normalizeZone(rule)] = struct{}{}
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) > 1 && net.ParseIP(fields[0]) != nil {
+			for _, v := range fields[1:] {
+				if v = normalizeZone(v); isBlockName(v) && !hostsIgnored[v] {
+					e.names[v] = struct{}{}
+				}
+			}
+			continue
+		}
+
+		if len(fields) == 1 && isBlockName(fields[0]) {
+			e.names[normalizeZone(fields[0])] = struct{}{}
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// isBlockName returns whether s is a valid name of blocklist entry
+func isBlockName(s string) bool {
+	s = normalizeZone(s)
+	if s == "" || net.ParseIP(s) != nil {
+		return false
+	}
+
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '.', c == '_':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
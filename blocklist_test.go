@@ -0,0 +1,194 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestParseBlocklist(t *testing.T) {
+	data := `# hosts file
+127.0.0.1 localhost
+::1 localhost ip6-localhost
+0.0.0.0 ads.example tracker.example # trailing comment
+0.0.0.0 0.0.0.0
+Plain.Example.
+
+! adblock list
+[Adblock Plus 2.0]
+||adblock.example^
+||third.example^$third-party
+||*.wild.example^
+@@||allowed.example^
+/regexp\.example/
+example.com##.ad
+bad_name!.example
+`
+
+	e, err := parseBlocklist(strings.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, e.names, map[string]struct{}{
+		"ads.example":     {},
+		"tracker.example": {},
+		"plain.example":   {},
+	})
+	assert.Equal(t, e.zones, map[string]struct{}{"adblock.example": {}})
+	assert.Equal(t, e.allows, map[string]struct{}{"allowed.example": {}})
+}
+
+func TestBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.txt")
+	assert.Nil(t, os.WriteFile(path, []byte("0.0.0.0 ads.example\n"), 0644))
+
+	body := "||adblock.example^\n@@||good.adblock.example^\n"
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	defer ts.Close()
+
+	b := NewBlocklist(path, ts.URL)
+	assert.False(t, b.Blocked("ads.example"))
+
+	ctx := context.Background()
+	assert.Nil(t, b.Load(ctx))
+	assert.Equal(t, b.Len(), 3)
+
+	assert.True(t, b.Blocked("ads.example"))
+	assert.True(t, b.Blocked("ADS.example."))
+	assert.False(t, b.Blocked("x.ads.example"))
+	assert.True(t, b.Blocked("adblock.example"))
+	assert.True(t, b.Blocked("x.adblock.example"))
+	assert.False(t, b.Blocked("x.good.adblock.example"))
+	assert.False(t, b.Blocked("likexian.com"))
+
+	status = http.StatusInternalServerError
+	err := b.Load(ctx)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), ts.URL)
+	assert.True(t, b.Blocked("adblock.example"))
+
+	assert.Nil(t, os.Remove(path))
+	assert.NotNil(t, b.Load(ctx))
+	assert.True(t, b.Blocked("ads.example"))
+
+	b = NewBlocklist("http://127.0.0.1:1/").SetHTTPClient(nil)
+	assert.NotNil(t, b.Load(ctx))
+	assert.Equal(t, b.Len(), 0)
+}
+
+func TestBlocklistMode(t *testing.T) {
+	b := NewBlocklist()
+
+	rsp, err := b.response("ads.example", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Equal(t, rsp.Status, 3)
+	assert.Equal(t, rsp.Provider, "blocklist")
+
+	b.SetMode(BlockNullIP)
+	rsp, err = b.response("ads.example", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Status, 0)
+	assert.Equal(t, rsp.Answer, []dns.Answer{{Name: "ads.example.", Type: 1, TTL: 60, Data: "0.0.0.0"}})
+
+	rsp, err = b.response("ads.example", dns.TypeAAAA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "::")
+
+	rsp, err = b.response("ads.example", dns.TypeMX)
+	assert.Nil(t, err)
+	assert.Equal(t, len(rsp.Answer), 0)
+}
+
+func TestBlocklistRefresh(t *testing.T) {
+	var loads int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&loads, 1) > 1 {
+			fmt.Fprint(w, "tracker.example\n")
+		} else {
+			fmt.Fprint(w, "ads.example\n")
+		}
+	}))
+	defer ts.Close()
+
+	b := NewBlocklist(ts.URL)
+	assert.Nil(t, b.Load(context.Background()))
+	assert.True(t, b.Blocked("ads.example"))
+
+	b.SetRefresh(10 * time.Millisecond)
+	defer b.Close()
+
+	for i := 0; i < 100 && !b.Blocked("tracker.example"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, b.Blocked("tracker.example"))
+	assert.False(t, b.Blocked("ads.example"))
+
+	b.Close()
+	n := atomic.LoadInt32(&loads)
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, atomic.LoadInt32(&loads) <= n+1)
+}
+
+func TestSetBlocklists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.txt")
+	assert.Nil(t, os.WriteFile(path, []byte("0.0.0.0 ads.example\n||adblock.example^\n"), 0644))
+
+	b := NewBlocklist(path)
+	assert.Nil(t, b.Load(context.Background()))
+
+	rt, hosts := hostRecorder()
+	c := Use(GoogleProvider).SetRoundTripper(rt).SetBlocklists(b)
+	defer c.Close()
+
+	ctx := context.Background()
+	rsp, err := c.Query(ctx, "x.adblock.example", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Equal(t, rsp.Status, 3)
+	assert.Equal(t, len(hosts()), 0)
+
+	b.SetMode(BlockNullIP)
+	rsp, err = c.Query(ctx, "ads.example", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "0.0.0.0")
+	assert.Equal(t, len(hosts()), 0)
+
+	_, err = c.Query(ctx, "x.ads.example", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, len(hosts()), 1)
+
+	c.SetBlocklists()
+	_, err = c.Query(ctx, "adblock.example", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, len(hosts()), 1)
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/transport"
+)
+
+// NewBootstrapResolver returns a bootstrap resolver querying A and AAAA records via the DoH provider,
+// the provider should be addressed by ip, for example: cloudflare or the default quad9
+func NewBootstrapResolver(p Provider) transport.Resolver {
+	return transport.ResolverFunc(func(ctx context.Context, host string) ([]net.IP, error) {
+		return lookupIP(ctx, host, p.Query)
+	})
+}
+
+// lookupIP returns the IPv4 and IPv6 addresses of host queried by query
+func lookupIP(ctx context.Context, host string,
+	query func(context.Context, dns.Domain, dns.Type) (*dns.Response, error)) ([]net.IP, error) {
+	ips := []net.IP{}
+
+	var err error
+	for _, t := range []dns.Type{dns.TypeA, dns.TypeAAAA} {
+		rsp, e := query(ctx, dns.Domain(host), t)
+		if e != nil {
+			err = e
+			continue
+		}
+		for _, v := range rsp.Answer {
+			if ip := net.ParseIP(v.Data); ip != nil {
+				ips = append(ips, ip)
+			}
+		}
+	}
+
+	if len(ips) == 0 {
+		if err == nil {
+			err = fmt.Errorf("doh: no address found for %s", host)
+		}
+		return nil, err
+	}
+
+	return ips, nil
+}
+
+// SetBootstrap set the resolver used to resolve hostname of all providers upstream, nil to use the system resolver
+func (c *DoH) SetBootstrap(r transport.Resolver) *DoH {
+	c.eachTransport(func(t *transport.Transport) {
+		t.SetBootstrap(r)
+	})
+
+	return c
+}
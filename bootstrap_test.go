@@ -0,0 +1,68 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/provider/cloudflare"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestNewBootstrapResolver(t *testing.T) {
+	p := cloudflare.New()
+	assert.Nil(t, p.SetFormat(dns.FormatJSON))
+	p.Transport().SetRoundTripper(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		body := `{"Status":0,"Answer":[{"name":"dns.google.","type":1,"TTL":300,"data":"8.8.8.8"}]}`
+		if r.URL.Query().Get("type") == "AAAA" {
+			body = `{"Status":0,"Answer":[{"name":"dns.google.","type":28,"TTL":300,"data":"2001:4860:4860::8888"}]}`
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	}))
+
+	r := NewBootstrapResolver(p)
+	ips, err := r.LookupIP(context.Background(), "dns.google")
+	assert.Nil(t, err)
+	assert.Equal(t, len(ips), 2)
+	assert.Equal(t, ips[0].String(), "8.8.8.8")
+	assert.Equal(t, ips[1].String(), "2001:4860:4860::8888")
+
+	p.Transport().SetRoundTripper(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"Status":0}`)),
+			Request:    r,
+		}, nil
+	}))
+	_, err = r.LookupIP(context.Background(), "dns.google")
+	assert.NotNil(t, err)
+
+	c := Use().SetBootstrap(r)
+	defer c.Close()
+}
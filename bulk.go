@@ -0,0 +1,199 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"sync"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// DefaultConcurrency is the default max concurrent queries of QueryAll
+const DefaultConcurrency = 8
+
+// Question is a query of QueryAll
+type Question struct {
+	// Name is the query name
+	Name dns.Domain
+	// Type is the query type
+	Type dns.Type
+	// ECS is the edns0-client-subnet option, default none
+	ECS dns.ECS
+}
+
+// Result is the result of a question of QueryAll
+type Result struct {
+	Question Question
+	Response *dns.Response
+	Err      error
+}
+
+// QueryAll queries the questions with at most concurrency queries in parallel, 0 for DefaultConcurrency,
+// returns the results in the order of questions, the questions not queried once ctx is done fail with its error
+func (c *DoH) QueryAll(ctx context.Context, questions []Question, concurrency int) []Result {
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	results := make([]Result, len(questions))
+	for k, v := range questions {
+		results[k].Question = v
+	}
+
+	indexes := make(chan int)
+	go func() {
+		defer close(indexes)
+		for k := range questions {
+			select {
+			case indexes <- k:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < min(concurrency, len(questions)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range indexes {
+				if ctx.Err() != nil {
+					results[k].Err = ctx.Err()
+					continue
+				}
+				q := questions[k]
+				results[k].Response, results[k].Err = c.ECSQuery(ctx, q.Name, q.Type, q.ECS)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	for k, v := range results {
+		if v.Response == nil && v.Err == nil {
+			results[k].Err = ctx.Err()
+		}
+	}
+
+	return results
+}
+
+// ResolveAll queries the names of type t concurrently with DefaultConcurrency queries in parallel,
+// returns the responses keyed by name, the failed names are not in it and their errors are joined,
+// the names not queried once ctx is done fail with its error
+func (c *DoH) ResolveAll(ctx context.Context, names []dns.Domain, t dns.Type) (map[dns.Domain]*dns.Response, error) {
+	questions := []Question{}
+	seen := map[dns.Domain]bool{}
+	for _, v := range names {
+		if !seen[v] {
+			seen[v] = true
+			questions = append(questions, Question{Name: v, Type: t})
+		}
+	}
+
+	result := map[dns.Domain]*dns.Response{}
+	errs := []error{}
+	for _, v := range c.QueryAll(ctx, questions, DefaultConcurrency) {
+		if v.Err != nil {
+			errs = append(errs, fmt.Errorf("doh: %s: %w", v.Question.Name, v.Err))
+			continue
+		}
+		result[v.Question.Name] = v.Response
+	}
+
+	return result, errors.Join(errs...)
+}
+
+// QueryStream queries the questions received from in with workers in parallel, 0 for DefaultConcurrency,
+// and sends the results in completion order, the returned channel is closed after in is closed and the queries
+// in process are drained, or ctx is done, in which case the pending questions and results are dropped
+func (c *DoH) QueryStream(ctx context.Context, in <-chan Question, workers int) <-chan Result {
+	if workers <= 0 {
+		workers = DefaultConcurrency
+	}
+
+	out := make(chan Result)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				var q Question
+				var ok bool
+				select {
+				case q, ok = <-in:
+					if !ok {
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+				rsp, err := c.ECSQuery(ctx, q.Name, q.Type, q.ECS)
+				select {
+				case out <- Result{Question: q, Response: rsp, Err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// Iterate returns an iterator of the results of questions, for example of slices.Values, they are queried
+// with DefaultConcurrency queries in parallel and yielded in completion order, the queries in process are
+// canceled if the loop breaks
+func (c *DoH) Iterate(ctx context.Context, questions iter.Seq[Question]) iter.Seq[Result] {
+	return func(yield func(Result) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		in := make(chan Question)
+		go func() {
+			defer close(in)
+			for q := range questions {
+				select {
+				case in <- q:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		for v := range c.QueryStream(ctx, in, DefaultConcurrency) {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
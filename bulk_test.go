@@ -0,0 +1,181 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestQueryAll(t *testing.T) {
+	rt, hosts := hostRecorder()
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	c := Use(GoogleProvider).SetRoundTripper(rt).SetBlocklist("ads.example").
+		AddMiddleware(func(next QueryFunc) QueryFunc {
+			return func(ctx context.Context, d dns.Domain, t dns.Type, s dns.ECS) (*dns.Response, error) {
+				mu.Lock()
+				running++
+				peak = max(peak, running)
+				mu.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				defer func() {
+					mu.Lock()
+					running--
+					mu.Unlock()
+				}()
+				return next(ctx, d, t, s)
+			}
+		})
+	defer c.Close()
+
+	questions := []Question{}
+	for i := 0; i < 20; i++ {
+		questions = append(questions, Question{Name: dns.Domain(fmt.Sprintf("%d.likexian.com", i)), Type: dns.TypeA})
+	}
+	questions = append(questions, Question{Name: "ads.example", Type: dns.TypeA})
+
+	results := c.QueryAll(context.Background(), questions, 3)
+	assert.Equal(t, len(results), 21)
+	for k, v := range results[:20] {
+		assert.Equal(t, v.Question, questions[k])
+		assert.Nil(t, v.Err)
+		assert.Equal(t, v.Response.Answer[0].Data, "1.1.1.1")
+	}
+	assert.NotNil(t, results[20].Err)
+	assert.Equal(t, results[20].Response.Status, 3)
+	assert.Equal(t, len(hosts()), 20)
+	assert.Equal(t, peak, 3)
+
+	assert.Equal(t, len(c.QueryAll(context.Background(), nil, 0)), 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results = c.QueryAll(ctx, questions, 0)
+	assert.Equal(t, len(results), 21)
+	for _, v := range results {
+		assert.NotNil(t, v.Err)
+	}
+}
+
+func TestQueryStream(t *testing.T) {
+	rt, hosts := hostRecorder()
+	c := Use(GoogleProvider).SetRoundTripper(rt)
+	defer c.Close()
+
+	in := make(chan Question)
+	go func() {
+		defer close(in)
+		for i := 0; i < 50; i++ {
+			in <- Question{Name: dns.Domain(fmt.Sprintf("%d.likexian.com", i)), Type: dns.TypeA}
+		}
+	}()
+
+	names := map[dns.Domain]bool{}
+	for v := range c.QueryStream(context.Background(), in, 4) {
+		assert.Nil(t, v.Err)
+		assert.Equal(t, v.Response.Answer[0].Data, "1.1.1.1")
+		names[v.Question.Name] = true
+	}
+	assert.Equal(t, len(names), 50)
+	assert.Equal(t, len(hosts()), 50)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in = make(chan Question)
+	out := c.QueryStream(ctx, in, 0)
+	in <- Question{Name: "likexian.com", Type: dns.TypeA}
+	v := <-out
+	assert.Nil(t, v.Err)
+
+	cancel()
+	select {
+	case _, ok := <-out:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("stream is not closed after ctx is done")
+	}
+}
+
+func TestResolveAll(t *testing.T) {
+	rt, hosts := hostRecorder()
+	c := Use(GoogleProvider).SetRoundTripper(rt).SetBlocklist("ads.example", "tracker.example")
+	defer c.Close()
+
+	ctx := context.Background()
+	rs, err := c.ResolveAll(ctx, []dns.Domain{"a.likexian.com", "b.likexian.com", "a.likexian.com"}, dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, len(rs), 2)
+	assert.Equal(t, rs["b.likexian.com"].Answer[0].Data, "1.1.1.1")
+	assert.Equal(t, len(hosts()), 2)
+
+	rs, err = c.ResolveAll(ctx, []dns.Domain{"a.likexian.com", "ads.example", "tracker.example"}, dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "doh: ads.example:")
+	assert.Contains(t, err.Error(), "doh: tracker.example:")
+	assert.Equal(t, len(rs), 1)
+	assert.NotNil(t, rs["a.likexian.com"])
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	rs, err = c.ResolveAll(cctx, []dns.Domain{"c.likexian.com"}, dns.TypeA)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, len(rs), 0)
+
+	rs, err = c.ResolveAll(ctx, nil, dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, len(rs), 0)
+}
+
+func TestIterate(t *testing.T) {
+	rt, _ := hostRecorder()
+	c := Use(GoogleProvider).SetRoundTripper(rt)
+	defer c.Close()
+
+	questions := []Question{}
+	for i := 0; i < 20; i++ {
+		questions = append(questions, Question{Name: dns.Domain(fmt.Sprintf("%d.likexian.com", i)), Type: dns.TypeA})
+	}
+
+	names := map[dns.Domain]bool{}
+	for v := range c.Iterate(context.Background(), slices.Values(questions)) {
+		assert.Nil(t, v.Err)
+		assert.Equal(t, v.Response.Answer[0].Data, "1.1.1.1")
+		names[v.Question.Name] = true
+	}
+	assert.Equal(t, len(names), 20)
+
+	n := 0
+	for range c.Iterate(context.Background(), slices.Values(questions)) {
+		n++
+		if n == 3 {
+			break
+		}
+	}
+	assert.Equal(t, n, 3)
+}
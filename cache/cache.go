@@ -0,0 +1,90 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package cache
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// Cache is a response cache shared by the DoH client and proxy, it may be an in-memory, disk or external store
+type Cache interface {
+	// Get returns the response of key and its remaining ttl, false if it is not cached or expired
+	Get(ctx context.Context, key string) (*dns.Response, time.Duration, bool)
+	// Set caches the response of key for the ttl, it is not cached if the ttl is not positive
+	Set(ctx context.Context, key string, rsp *dns.Response, ttl time.Duration) error
+	// Delete removes the response of key
+	Delete(ctx context.Context, key string) error
+	// Flush removes all responses
+	Flush(ctx context.Context) error
+	// Close releases the resources of cache
+	Close() error
+}
+
+// FlushTypes is the query types of which the keys are deleted when flushing the cache of a name
+var FlushTypes = []dns.Type{
+	dns.TypeA, dns.TypeAAAA, dns.TypeCNAME, dns.TypeMX, dns.TypeTXT,
+	dns.TypeSPF, dns.TypeNS, dns.TypeSOA, dns.TypePTR, dns.TypeSRV, dns.TypeANY,
+}
+
+// Version returns package version
+func Version() string {
+	return "0.1.0"
+}
+
+// Author returns package author
+func Author() string {
+	return "[Li Kexian](https://www.likexian.com/)"
+}
+
+// License returns package license
+func License() string {
+	return "Licensed under the Apache License 2.0"
+}
+
+// Key returns the cache key of query, the flags are part of key if any is set, the domain and type are in the
+// canonical form, so that Likexian.COM. and likexian.com share the key
+func Key(d dns.Domain, t dns.Type, s dns.ECS, f dns.Flags) string {
+	var buf [256]byte
+	b := append(append(append(buf[:0], dns.Canonical(string(d))...), t.Normalize()...), s...)
+	key := hexSum(b)
+
+	if f != (dns.Flags{}) {
+		b = append(append(buf[:0], key...), fmt.Sprintf("%+v", f)...)
+		key = hexSum(b)
+	}
+
+	return key
+}
+
+// hexSum returns the hex encoded sha1 sum of b
+func hexSum(b []byte) string {
+	sum := sha1.Sum(b)
+
+	var hx [2 * sha1.Size]byte
+	hex.Encode(hx[:], sum[:])
+
+	return string(hx[:])
+}
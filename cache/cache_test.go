@@ -0,0 +1,49 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+	"github.com/likexian/gokit/xhash"
+)
+
+func TestVersion(t *testing.T) {
+	assert.Contains(t, Version(), ".")
+	assert.Contains(t, Author(), "likexian")
+	assert.Contains(t, License(), "Apache License")
+}
+
+func TestKey(t *testing.T) {
+	assert.Equal(t, Key("likexian.com", dns.TypeA, "", dns.Flags{}), xhash.Sha1("likexian.com.", "A", "").Hex())
+	assert.Equal(t, Key("Likexian.COM.", "a", "", dns.Flags{}), Key("likexian.com", dns.TypeA, "", dns.Flags{}))
+	assert.NotEqual(t, Key("likexian.com", dns.TypeA, "", dns.Flags{}), Key("likexian.com", dns.TypeAAAA, "", dns.Flags{}))
+	assert.NotEqual(t, Key("likexian.com", dns.TypeA, "", dns.Flags{}), Key("likexian.com", dns.TypeA, "1.2.3.4", dns.Flags{}))
+	assert.NotEqual(t, Key("likexian.com", dns.TypeA, "", dns.Flags{}), Key("likexian.com", dns.TypeA, "", dns.Flags{DO: true}))
+}
+
+func BenchmarkKey(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = Key("likexian.com", dns.TypeA, "1.2.3.4/24", dns.Flags{})
+	}
+}
@@ -0,0 +1,254 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ideatocode/doh-go/clock"
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// DefaultSweepInterval is the default interval of removing the expired responses of memory cache
+const DefaultSweepInterval = time.Minute
+
+// Memory is an in-memory cache, the expired responses are removed periodically
+type Memory struct {
+	shard *shard
+	stopc chan struct{}
+	once  sync.Once
+}
+
+// shard is a map of cached responses guarded by its own lock
+type shard struct {
+	entries    map[string]entry
+	maxEntries int
+	clock      clock.Clock
+	sync.RWMutex
+}
+
+// entry is a cached response
+type entry struct {
+	rsp     *dns.Response
+	expires time.Time
+}
+
+// NewMemory returns a new in-memory cache, it must be closed after use
+func NewMemory() *Memory {
+	m := &Memory{
+		shard: newShard(),
+		stopc: make(chan struct{}),
+	}
+
+	go sweeper(m.stopc, func() { m.sweep(m.shard.now()) })
+
+	return m
+}
+
+// SetClock set the clock of the ttl expiry, for example a fake clock to test the expiry deterministically,
+// nil to use the system clock
+func (m *Memory) SetClock(c clock.Clock) *Memory {
+	m.shard.setClock(c)
+	return m
+}
+
+// SetMaxEntries set the max number of responses, the expired or else any responses are evicted if it is full,
+// 0 for no limit
+func (m *Memory) SetMaxEntries(n int) *Memory {
+	m.shard.setMaxEntries(n)
+	return m
+}
+
+// Len returns the number of responses, including the expired ones not removed yet
+func (m *Memory) Len() int {
+	return m.shard.len()
+}
+
+// Get returns the response of key and its remaining ttl
+func (m *Memory) Get(_ context.Context, key string) (*dns.Response, time.Duration, bool) {
+	return m.shard.get(key)
+}
+
+// Set caches the response of key for the ttl
+func (m *Memory) Set(_ context.Context, key string, rsp *dns.Response, ttl time.Duration) error {
+	m.shard.set(key, rsp, ttl)
+	return nil
+}
+
+// Delete removes the response of key
+func (m *Memory) Delete(_ context.Context, key string) error {
+	m.shard.delete(key)
+	return nil
+}
+
+// Flush removes all responses
+func (m *Memory) Flush(_ context.Context) error {
+	m.shard.flush()
+	return nil
+}
+
+// Close stops removing the expired responses
+func (m *Memory) Close() error {
+	m.once.Do(func() { close(m.stopc) })
+	return nil
+}
+
+// sweep removes the expired responses
+func (m *Memory) sweep(now time.Time) {
+	m.shard.sweep(now)
+}
+
+// sweeper calls sweep every DefaultSweepInterval until stopc is closed
+func sweeper(stopc chan struct{}, sweep func()) {
+	t := time.NewTicker(DefaultSweepInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stopc:
+			return
+		case <-t.C:
+			sweep()
+		}
+	}
+}
+
+// newShard returns a new empty shard
+func newShard() *shard {
+	return &shard{entries: map[string]entry{}, clock: clock.System}
+}
+
+// setClock set the clock of shard, nil for the system clock
+func (s *shard) setClock(c clock.Clock) {
+	if c == nil {
+		c = clock.System
+	}
+
+	s.Lock()
+	s.clock = c
+	s.Unlock()
+}
+
+// now returns the current time of the shard clock
+func (s *shard) now() time.Time {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.clock.Now()
+}
+
+// setMaxEntries set the max number of responses of shard, 0 for no limit
+func (s *shard) setMaxEntries(n int) {
+	s.Lock()
+	s.maxEntries = max(0, n)
+	s.Unlock()
+}
+
+// len returns the number of responses of shard
+func (s *shard) len() int {
+	s.RLock()
+	defer s.RUnlock()
+
+	return len(s.entries)
+}
+
+// get returns the response of key and its remaining ttl
+func (s *shard) get(key string) (*dns.Response, time.Duration, bool) {
+	s.RLock()
+	e, ok := s.entries[key]
+	now := s.clock.Now()
+	s.RUnlock()
+
+	if !ok {
+		return nil, 0, false
+	}
+
+	remaining := e.expires.Sub(now)
+	if remaining <= 0 {
+		return nil, 0, false
+	}
+
+	return e.rsp, remaining, true
+}
+
+// set caches the response of key for the ttl, it is not cached if the ttl is not positive
+func (s *shard) set(key string, rsp *dns.Response, ttl time.Duration) {
+	if ttl <= 0 || rsp == nil {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	now := s.clock.Now()
+
+	if _, ok := s.entries[key]; !ok && s.maxEntries > 0 && len(s.entries) >= s.maxEntries {
+		s.evict(now)
+	}
+
+	s.entries[key] = entry{rsp: rsp, expires: now.Add(ttl)}
+}
+
+// delete removes the response of key
+func (s *shard) delete(key string) {
+	s.Lock()
+	delete(s.entries, key)
+	s.Unlock()
+}
+
+// flush removes all responses of shard
+func (s *shard) flush() {
+	s.Lock()
+	s.entries = map[string]entry{}
+	s.Unlock()
+}
+
+// sweep removes the expired responses
+func (s *shard) sweep(now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	for k, v := range s.entries {
+		if !now.Before(v.expires) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+// evict removes the expired responses, or any one if there is none, the lock must be held
+func (s *shard) evict(now time.Time) {
+	n := len(s.entries)
+	for k, v := range s.entries {
+		if !now.Before(v.expires) {
+			delete(s.entries, k)
+		}
+	}
+
+	if len(s.entries) < n {
+		return
+	}
+
+	for k := range s.entries {
+		delete(s.entries, k)
+		return
+	}
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go/clock"
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	defer m.Close()
+
+	var _ Cache = m
+	ctx := context.Background()
+	rsp := &dns.Response{Answer: []dns.Answer{{Name: "likexian.com.", Type: 1, TTL: 300, Data: "1.1.1.1"}}}
+
+	_, _, ok := m.Get(ctx, "a")
+	assert.False(t, ok)
+
+	assert.Nil(t, m.Set(ctx, "a", rsp, time.Minute))
+	assert.Nil(t, m.Set(ctx, "b", rsp, 0))
+	assert.Nil(t, m.Set(ctx, "c", nil, time.Minute))
+	assert.Equal(t, m.Len(), 1)
+
+	r, remaining, ok := m.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, r, rsp)
+	assert.True(t, remaining > 59*time.Second && remaining <= time.Minute)
+
+	assert.Nil(t, m.Set(ctx, "b", rsp, time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	_, _, ok = m.Get(ctx, "b")
+	assert.False(t, ok)
+	assert.Equal(t, m.Len(), 2)
+	m.sweep(time.Now())
+	assert.Equal(t, m.Len(), 1)
+
+	assert.Nil(t, m.Delete(ctx, "a"))
+	_, _, ok = m.Get(ctx, "a")
+	assert.False(t, ok)
+
+	assert.Nil(t, m.Set(ctx, "a", rsp, time.Minute))
+	assert.Nil(t, m.Flush(ctx))
+	assert.Equal(t, m.Len(), 0)
+
+	assert.Nil(t, m.Close())
+	assert.Nil(t, m.Close())
+}
+
+func TestMemoryMaxEntries(t *testing.T) {
+	m := NewMemory().SetMaxEntries(2)
+	defer m.Close()
+
+	ctx := context.Background()
+	rsp := &dns.Response{}
+
+	assert.Nil(t, m.Set(ctx, "a", rsp, time.Minute))
+	assert.Nil(t, m.Set(ctx, "b", rsp, time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	assert.Nil(t, m.Set(ctx, "c", rsp, time.Minute))
+	assert.Equal(t, m.Len(), 2)
+	_, _, ok := m.Get(ctx, "a")
+	assert.True(t, ok)
+
+	assert.Nil(t, m.Set(ctx, "a", rsp, time.Minute))
+	assert.Equal(t, m.Len(), 2)
+	assert.Nil(t, m.Set(ctx, "d", rsp, time.Minute))
+	assert.Equal(t, m.Len(), 2)
+	_, _, ok = m.Get(ctx, "d")
+	assert.True(t, ok)
+
+	m.SetMaxEntries(0)
+	assert.Nil(t, m.Set(ctx, "e", rsp, time.Minute))
+	assert.Equal(t, m.Len(), 3)
+}
+
+func TestMemoryClock(t *testing.T) {
+	c := clock.NewFake(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	m := NewMemory().SetClock(c)
+	defer m.Close()
+
+	ctx := context.Background()
+	rsp := &dns.Response{}
+
+	assert.Nil(t, m.Set(ctx, "a", rsp, time.Minute))
+	c.Advance(20 * time.Second)
+	_, remaining, ok := m.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, remaining, 40*time.Second)
+
+	c.Advance(40 * time.Second)
+	_, _, ok = m.Get(ctx, "a")
+	assert.False(t, ok)
+	assert.Equal(t, m.Len(), 1)
+
+	m.sweep(m.shard.now())
+	assert.Equal(t, m.Len(), 0)
+
+	m.SetClock(nil)
+	assert.Nil(t, m.Set(ctx, "a", rsp, time.Minute))
+	_, remaining, ok = m.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.True(t, remaining > 59*time.Second)
+}
+
+func BenchmarkMemory(b *testing.B) {
+	m := NewMemory()
+	defer m.Close()
+
+	benchmarkCache(b, m)
+}
+
+// benchmarkCache runs parallel gets of mostly cached keys, one in ten queries sets a response
+func benchmarkCache(b *testing.B, c Cache) {
+	ctx := context.Background()
+	rsp := &dns.Response{}
+
+	keys := make([]string, 1024)
+	for k := range keys {
+		keys[k] = Key(dns.Domain(fmt.Sprintf("%d.likexian.com", k)), dns.TypeA, "", dns.Flags{})
+		_ = c.Set(ctx, keys[k], rsp, time.Hour)
+	}
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := keys[i%len(keys)]
+			if i%10 == 0 {
+				_ = c.Set(ctx, key, rsp, time.Hour)
+			} else {
+				_, _, _ = c.Get(ctx, key)
+			}
+			i++
+		}
+	})
+}
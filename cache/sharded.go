@@ -0,0 +1,160 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package cache
+
+import (
+	"context"
+	"hash/maphash"
+	"sync"
+	"time"
+
+	"github.com/ideatocode/doh-go/clock"
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// DefaultShards is the default number of shards of sharded cache
+const DefaultShards = 64
+
+// Sharded is an in-memory cache of striped locks for high concurrency, the keys are spread over the shards
+// so that the queries of different names rarely contend, the expired responses are removed periodically
+type Sharded struct {
+	shards []*shard
+	mask   uint64
+	seed   maphash.Seed
+	stopc  chan struct{}
+	once   sync.Once
+}
+
+// NewSharded returns a new sharded cache of n shards rounded up to a power of two, 0 for DefaultShards,
+// it must be closed after use
+func NewSharded(n int) *Sharded {
+	size := RoundShards(n)
+	s := &Sharded{
+		shards: make([]*shard, size),
+		mask:   uint64(size - 1),
+		seed:   maphash.MakeSeed(),
+		stopc:  make(chan struct{}),
+	}
+
+	for k := range s.shards {
+		s.shards[k] = newShard()
+	}
+
+	go sweeper(s.stopc, func() { s.sweep(s.shards[0].now()) })
+
+	return s
+}
+
+// SetClock set the clock of the ttl expiry of all shards, nil to use the system clock
+func (s *Sharded) SetClock(c clock.Clock) *Sharded {
+	for _, v := range s.shards {
+		v.setClock(c)
+	}
+
+	return s
+}
+
+// RoundShards returns the number of shards of n, which is rounded up to a power of two, 0 for DefaultShards
+func RoundShards(n int) int {
+	if n <= 0 {
+		n = DefaultShards
+	}
+
+	size := 1
+	for size < n {
+		size <<= 1
+	}
+
+	return size
+}
+
+// Shards returns the number of shards
+func (s *Sharded) Shards() int {
+	return len(s.shards)
+}
+
+// SetMaxEntries set the max number of responses, which is divided evenly between the shards,
+// the expired or else any responses of a full shard are evicted, 0 for no limit
+func (s *Sharded) SetMaxEntries(n int) *Sharded {
+	per := 0
+	if n > 0 {
+		per = (n + len(s.shards) - 1) / len(s.shards)
+	}
+
+	for _, v := range s.shards {
+		v.setMaxEntries(per)
+	}
+
+	return s
+}
+
+// Len returns the number of responses, including the expired ones not removed yet
+func (s *Sharded) Len() int {
+	n := 0
+	for _, v := range s.shards {
+		n += v.len()
+	}
+
+	return n
+}
+
+// Get returns the response of key and its remaining ttl
+func (s *Sharded) Get(_ context.Context, key string) (*dns.Response, time.Duration, bool) {
+	return s.shardOf(key).get(key)
+}
+
+// Set caches the response of key for the ttl
+func (s *Sharded) Set(_ context.Context, key string, rsp *dns.Response, ttl time.Duration) error {
+	s.shardOf(key).set(key, rsp, ttl)
+	return nil
+}
+
+// Delete removes the response of key
+func (s *Sharded) Delete(_ context.Context, key string) error {
+	s.shardOf(key).delete(key)
+	return nil
+}
+
+// Flush removes all responses
+func (s *Sharded) Flush(_ context.Context) error {
+	for _, v := range s.shards {
+		v.flush()
+	}
+
+	return nil
+}
+
+// Close stops removing the expired responses
+func (s *Sharded) Close() error {
+	s.once.Do(func() { close(s.stopc) })
+	return nil
+}
+
+// shardOf returns the shard of key
+func (s *Sharded) shardOf(key string) *shard {
+	return s.shards[maphash.String(s.seed, key)&s.mask]
+}
+
+// sweep removes the expired responses shard by shard
+func (s *Sharded) sweep(now time.Time) {
+	for _, v := range s.shards {
+		v.sweep(now)
+	}
+}
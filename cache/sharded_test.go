@@ -0,0 +1,145 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go/clock"
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestRoundShards(t *testing.T) {
+	assert.Equal(t, RoundShards(0), DefaultShards)
+	assert.Equal(t, RoundShards(-1), DefaultShards)
+	assert.Equal(t, RoundShards(1), 1)
+	assert.Equal(t, RoundShards(3), 4)
+	assert.Equal(t, RoundShards(16), 16)
+}
+
+func TestSharded(t *testing.T) {
+	s := NewSharded(4)
+	defer s.Close()
+
+	var _ Cache = s
+	assert.Equal(t, s.Shards(), 4)
+
+	ctx := context.Background()
+	rsp := &dns.Response{Answer: []dns.Answer{{Name: "likexian.com.", Type: 1, TTL: 300, Data: "1.1.1.1"}}}
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, s.Set(ctx, fmt.Sprint(i), rsp, time.Minute))
+	}
+	assert.Nil(t, s.Set(ctx, "x", rsp, 0))
+	assert.Equal(t, s.Len(), 100)
+
+	used := 0
+	for _, v := range s.shards {
+		if v.len() > 0 {
+			used++
+		}
+	}
+	assert.Equal(t, used, 4)
+
+	r, remaining, ok := s.Get(ctx, "42")
+	assert.True(t, ok)
+	assert.Equal(t, r, rsp)
+	assert.True(t, remaining > 59*time.Second)
+
+	assert.Nil(t, s.Delete(ctx, "42"))
+	_, _, ok = s.Get(ctx, "42")
+	assert.False(t, ok)
+
+	assert.Nil(t, s.Set(ctx, "b", rsp, time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	_, _, ok = s.Get(ctx, "b")
+	assert.False(t, ok)
+	s.sweep(time.Now())
+	assert.Equal(t, s.Len(), 99)
+
+	assert.Nil(t, s.Flush(ctx))
+	assert.Equal(t, s.Len(), 0)
+
+	s.SetMaxEntries(8)
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, s.Set(ctx, fmt.Sprint(i), rsp, time.Minute))
+	}
+	assert.True(t, s.Len() <= 8)
+
+	assert.Nil(t, s.Close())
+	assert.Nil(t, s.Close())
+}
+
+func TestShardedClock(t *testing.T) {
+	c := clock.NewFake(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := NewSharded(4).SetClock(c)
+	defer s.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 8; i++ {
+		assert.Nil(t, s.Set(ctx, fmt.Sprint(i), &dns.Response{}, time.Duration(i+1)*time.Minute))
+	}
+
+	c.Advance(4 * time.Minute)
+	for i := 0; i < 8; i++ {
+		_, _, ok := s.Get(ctx, fmt.Sprint(i))
+		assert.Equal(t, ok, i >= 4)
+	}
+
+	s.sweep(c.Now())
+	assert.Equal(t, s.Len(), 4)
+}
+
+func TestShardedConcurrent(t *testing.T) {
+	s := NewSharded(0)
+	defer s.Close()
+
+	ctx := context.Background()
+	rsp := &dns.Response{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprint(i, "-", j)
+				_ = s.Set(ctx, key, rsp, time.Minute)
+				_, _, ok := s.Get(ctx, key)
+				assert.True(t, ok)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, s.Len(), 800)
+}
+
+func BenchmarkSharded(b *testing.B) {
+	s := NewSharded(0)
+	defer s.Close()
+
+	benchmarkCache(b, s)
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// ErrInjected is returned by the queries failed by the fault injection
+var ErrInjected = errors.New("doh: injected fault")
+
+// Faults is the fault injection of queries, for verifying in staging that the failures are handled gracefully,
+// the rates are the probabilities of each query in [0, 1], it is disabled if all rates are zero
+type Faults struct {
+	// ErrorRate is the rate of queries failed with ErrInjected
+	ErrorRate float64 `yaml:"error_rate" toml:"error_rate"`
+	// LatencyRate is the rate of queries delayed by the latency
+	LatencyRate float64 `yaml:"latency_rate" toml:"latency_rate"`
+	// Latency is the latency added, the query fails with the context error if done while waiting
+	Latency time.Duration `yaml:"latency" toml:"latency"`
+	// CorruptRate is the rate of responses corrupted, which are truncated, of a foreign question, or garbled
+	CorruptRate float64 `yaml:"corrupt_rate" toml:"corrupt_rate"`
+	// Seed is the seed of the random faults for reproducible runs, default random
+	Seed uint64 `yaml:"seed" toml:"seed"`
+}
+
+// chaos is the random source of faults, it is safe for concurrent use
+type chaos struct {
+	faults Faults
+	rand   *rand.Rand
+	sync.Mutex
+}
+
+// Validate returns an error if the faults are invalid
+func (f Faults) Validate() error {
+	for _, v := range []float64{f.ErrorRate, f.LatencyRate, f.CorruptRate} {
+		if v < 0 || v > 1 {
+			return fmt.Errorf("doh: invalid fault rate: %v", v)
+		}
+	}
+
+	if f.Latency < 0 {
+		return fmt.Errorf("doh: negative fault latency: %s", f.Latency)
+	}
+
+	return nil
+}
+
+// enabled returns whether any fault is injected
+func (f Faults) enabled() bool {
+	return f.ErrorRate > 0 || f.LatencyRate > 0 && f.Latency > 0 || f.CorruptRate > 0
+}
+
+// Chaos returns a middleware injecting the faults into the queries, the invalid rates are clamped to [0, 1]
+func Chaos(f Faults) Middleware {
+	if !f.enabled() {
+		return func(next QueryFunc) QueryFunc {
+			return next
+		}
+	}
+
+	seed := f.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	x := &chaos{faults: f, rand: rand.New(rand.NewPCG(seed, seed))}
+
+	return func(next QueryFunc) QueryFunc {
+		return func(ctx context.Context, d dns.Domain, t dns.Type, s dns.ECS) (*dns.Response, error) {
+			if x.hit(f.LatencyRate) && f.Latency > 0 {
+				timer := time.NewTimer(f.Latency)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return nil, ctx.Err()
+				}
+			}
+
+			if x.hit(f.ErrorRate) {
+				return nil, fmt.Errorf("%w: %s", ErrInjected, d)
+			}
+
+			rsp, err := next(ctx, d, t, s)
+			if rsp != nil && x.hit(f.CorruptRate) {
+				rsp = x.corrupt(rsp)
+			}
+
+			return rsp, err
+		}
+	}
+}
+
+// SetFaults set the faults injected into the client queries outside the middlewares, the zero value disables it
+func (c *DoH) SetFaults(f Faults) *DoH {
+	var m Middleware
+	if f.enabled() {
+		m = Chaos(f)
+	}
+
+	c.Lock()
+	c.faults = m
+	c.Unlock()
+
+	return c
+}
+
+// hit returns whether a fault of rate happens
+func (x *chaos) hit(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+
+	x.Lock()
+	defer x.Unlock()
+
+	return x.rand.Float64() < rate
+}
+
+// corrupt returns a corrupted copy of rsp, which is not changed since it may be cached
+func (x *chaos) corrupt(rsp *dns.Response) *dns.Response {
+	x.Lock()
+	n := x.rand.IntN(3)
+	x.Unlock()
+
+	r := *rsp
+	r.Question = append([]dns.Question(nil), rsp.Question...)
+	r.Answer = append([]dns.Answer(nil), rsp.Answer...)
+
+	switch {
+	case n == 0:
+		r.TC = true
+		r.Answer = r.Answer[:len(r.Answer)/2]
+	case n == 1 && len(r.Question) > 0:
+		r.Question[0].Name = "corrupted.invalid."
+		r.Question[0].Unicode = ""
+	default:
+		for k := range r.Answer {
+			r.Answer[k].Data = "\x00corrupted"
+		}
+	}
+
+	return &r
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/dohtest"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestFaults(t *testing.T) {
+	assert.Nil(t, Faults{}.Validate())
+	assert.Nil(t, Faults{ErrorRate: 1, CorruptRate: 0.5, Latency: time.Second}.Validate())
+	assert.NotNil(t, Faults{ErrorRate: 1.1}.Validate())
+	assert.NotNil(t, Faults{CorruptRate: -0.1}.Validate())
+	assert.NotNil(t, Faults{Latency: -time.Second}.Validate())
+
+	assert.False(t, Faults{Latency: time.Second}.enabled())
+	assert.False(t, Faults{LatencyRate: 1}.enabled())
+	assert.True(t, Faults{LatencyRate: 1, Latency: time.Second}.enabled())
+}
+
+func TestChaos(t *testing.T) {
+	ctx := context.Background()
+	c := UseProviders(&staticProvider{name: "static", data: "1.2.3.4"}).EnableCache(true)
+	defer c.Close()
+
+	c.AddMiddleware(Chaos(Faults{}))
+	rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "1.2.3.4")
+
+	c.SetFaults(Faults{ErrorRate: 1})
+	_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.True(t, errors.Is(err, ErrInjected))
+	assert.Contains(t, err.Error(), "likexian.com")
+
+	c.SetFaults(Faults{LatencyRate: 1, Latency: 50 * time.Millisecond})
+	start := time.Now()
+	_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	c.SetFaults(Faults{LatencyRate: 1, Latency: time.Minute})
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = c.Query(tctx, "likexian.com", dns.TypeA)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	c.SetFaults(Faults{})
+	rsp, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "1.2.3.4")
+}
+
+func TestChaosCorrupt(t *testing.T) {
+	p := dohtest.New("fake")
+	p.Answer("likexian.com", dns.TypeA, "1.2.3.4")
+
+	ctx := context.Background()
+	c := UseProviders(p).EnableCache(true)
+	defer c.Close()
+
+	c.SetFaults(Faults{CorruptRate: 1, Seed: 1})
+	kinds := map[string]bool{}
+	for range 100 {
+		rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+		assert.Nil(t, err)
+		switch {
+		case rsp.TC:
+			assert.Equal(t, len(rsp.Answer), 0)
+			kinds["truncated"] = true
+		case len(rsp.Question) > 0 && rsp.Question[0].Name == "corrupted.invalid.":
+			kinds["question"] = true
+		case rsp.Answer[0].Data != "1.2.3.4":
+			kinds["garbled"] = true
+		default:
+			t.Fatalf("not corrupted: %+v", rsp)
+		}
+	}
+	assert.Equal(t, len(kinds), 3)
+
+	// the cached response is not corrupted
+	c.SetFaults(Faults{})
+	rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.False(t, rsp.TC)
+	assert.Equal(t, rsp.Question[0].Name, "likexian.com.")
+	assert.Equal(t, rsp.Answer[0].Data, "1.2.3.4")
+
+	// the corruptions of the same seed are reproducible
+	answers := func() []string {
+		c.SetFaults(Faults{CorruptRate: 0.5, Seed: 42})
+		vs := []string{}
+		for range 20 {
+			rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+			assert.Nil(t, err)
+			vs = append(vs, fmt.Sprint(rsp.TC, rsp.Question, rsp.Answer))
+		}
+		return vs
+	}
+	assert.Equal(t, answers(), answers())
+}
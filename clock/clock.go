@@ -0,0 +1,99 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of the current time of the ttl expiry and schedules, it must be safe for concurrent use
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+}
+
+// Fake is a clock of simulated time, which is only changed by Set and Advance, for the deterministic tests of
+// ttl expiry, it is safe for concurrent use
+type Fake struct {
+	now time.Time
+	sync.RWMutex
+}
+
+// system is the clock of system time
+type system struct{}
+
+// System is the clock of system time, it is the default clock
+var System Clock = system{}
+
+var _ Clock = (*Fake)(nil)
+
+// Version returns package version
+func Version() string {
+	return "0.1.0"
+}
+
+// Author returns package author
+func Author() string {
+	return "[Li Kexian](https://www.likexian.com/)"
+}
+
+// License returns package license
+func License() string {
+	return "Licensed under the Apache License 2.0"
+}
+
+// Now returns the system time
+func (system) Now() time.Time {
+	return time.Now()
+}
+
+// NewFake returns a new fake clock starting at now
+func NewFake(now time.Time) *Fake {
+	return &Fake{
+		now: now,
+	}
+}
+
+// Now returns the simulated time
+func (f *Fake) Now() time.Time {
+	f.RLock()
+	defer f.RUnlock()
+
+	return f.now
+}
+
+// Set set the simulated time, it can go backwards
+func (f *Fake) Set(now time.Time) *Fake {
+	f.Lock()
+	f.now = now
+	f.Unlock()
+
+	return f
+}
+
+// Advance moves the simulated time forward by d
+func (f *Fake) Advance(d time.Duration) *Fake {
+	f.Lock()
+	f.now = f.now.Add(d)
+	f.Unlock()
+
+	return f
+}
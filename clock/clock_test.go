@@ -0,0 +1,50 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestVersion(t *testing.T) {
+	assert.Contains(t, Version(), ".")
+	assert.Contains(t, Author(), "likexian")
+	assert.Contains(t, License(), "Apache License")
+}
+
+func TestSystem(t *testing.T) {
+	now := System.Now()
+	assert.True(t, time.Since(now) < time.Second)
+}
+
+func TestFake(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+	assert.Equal(t, f.Now(), start)
+
+	f.Advance(time.Minute)
+	assert.Equal(t, f.Now(), start.Add(time.Minute))
+
+	f.Set(start.Add(-time.Hour)).Advance(time.Second)
+	assert.Equal(t, f.Now(), start.Add(-time.Hour+time.Second))
+}
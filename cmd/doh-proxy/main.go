@@ -0,0 +1,650 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/ideatocode/doh-go/admin"
+	"github.com/ideatocode/doh-go/config"
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/metrics"
+	"github.com/ideatocode/doh-go/proxy"
+	"github.com/ideatocode/doh-go/server"
+	_ "github.com/ideatocode/doh-go/transport/brotli"
+)
+
+// options is the command line options of proxy
+type options struct {
+	path    string
+	config  *doh.Config
+	timeout time.Duration
+	drain   time.Duration
+	verbose bool
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+// run runs the proxy with args until it is interrupted, returns the exit code
+func run(args []string, stderr io.Writer) int {
+	if len(args) > 0 && args[0] == "service" {
+		return serviceCommand(args[1:], os.Stdout, stderr)
+	}
+
+	return runForeground(args, stderr)
+}
+
+// runForeground runs the proxy with args until SIGINT or SIGTERM is received, SIGHUP reloads the config
+func runForeground(args []string, stderr io.Writer) int {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigc)
+
+	return serve(args, stderr, sigc)
+}
+
+// serve runs the proxy with args until SIGINT or SIGTERM is received from sigc, SIGHUP reloads the config,
+// returns the exit code
+func serve(args []string, stderr io.Writer, sigc <-chan os.Signal) int {
+	o, err := parseOptions(args, stderr)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	level := slog.LevelInfo
+	if o.verbose {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level}))
+
+	c, err := o.config.Client()
+	if err != nil {
+		logger.Error("doh: proxy: create client failed", slog.String("error", err.Error()))
+		return 1
+	}
+	defer c.Close()
+
+	policies, err := newPolicies(o.config)
+	if err != nil {
+		logger.Error("doh: proxy: create policy client failed", slog.String("error", err.Error()))
+		return 1
+	}
+	defer func() {
+		for _, v := range policies {
+			v.client.Close()
+		}
+	}()
+
+	clients := []*doh.DoH{c}
+	for _, v := range policies {
+		clients = append(clients, v.client)
+	}
+
+	ql, closer, err := o.config.QueryLog.Open()
+	if err != nil {
+		logger.Error("doh: proxy: open query log failed", slog.String("error", err.Error()))
+		return 1
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+
+	for _, v := range clients {
+		v.SetLogger(logger)
+		if ql != nil {
+			v.SetQueryLogger(ql)
+		}
+	}
+
+	sockets, err := activatedSockets()
+	if err != nil {
+		logger.Error("doh: proxy: socket activation failed", slog.String("error", err.Error()))
+		return 1
+	}
+
+	listen := o.config.Listen
+	if err = checkAdminSockets(sockets["admin"], listen.AdminToken); err != nil {
+		for _, vs := range sockets {
+			for _, v := range vs {
+				v.Close()
+			}
+		}
+		logger.Error("doh: proxy: socket activation failed", slog.String("error", err.Error()))
+		return 1
+	}
+	acl, _ := doh.ParseNetworks(o.config.ACL)
+	s := proxy.New(c).SetTimeout(o.timeout).SetLogger(logger).SetACL(acl...).SetForwards(newForwards(o.config)).
+		SetRateLimit(o.config.RateLimit.Rate, o.config.RateLimit.Burst)
+	for _, v := range policies {
+		s.SetPolicy(v.client, v.networks...)
+	}
+	if fc := o.config.Cache.New(); fc != nil {
+		defer fc.Close()
+		s.SetCache(fc)
+	}
+	errc := make(chan error, 4+len(sockets))
+	servers := []*http.Server{}
+
+	if vs := sockets["dns"]; len(vs) > 0 {
+		for _, v := range vs {
+			if v.PacketConn != nil {
+				go func() { errc <- s.ServeUDP(v.PacketConn) }()
+			} else {
+				go func() { errc <- s.ServeTCP(v.Listener) }()
+			}
+			logger.Info("doh: proxy: listening", slog.String("addr", socketAddr(v)), slog.String("activation", "systemd"))
+		}
+	} else if listen.DNS != "" {
+		go func() { errc <- s.ListenAndServe(listen.DNS) }()
+		logger.Info("doh: proxy: listening", slog.String("addr", listen.DNS))
+	}
+
+	if vs := sockets["tls"]; len(vs) > 0 || listen.TLS != "" {
+		if listen.TLSCert == "" || listen.TLSKey == "" {
+			logger.Error("doh: proxy: both tls cert and key are required")
+			s.Close()
+			return 1
+		}
+		cert, err := tls.LoadX509KeyPair(listen.TLSCert, listen.TLSKey)
+		if err != nil {
+			logger.Error("doh: proxy: load certificate failed", slog.String("error", err.Error()))
+			s.Close()
+			return 1
+		}
+		config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		for _, v := range vs {
+			go func() { errc <- s.ServeTCP(tls.NewListener(v.Listener, config)) }()
+			logger.Info("doh: proxy: listening tls", slog.String("addr", socketAddr(v)), slog.String("activation", "systemd"))
+		}
+		if len(vs) == 0 {
+			go func() { errc <- s.ListenAndServeTLS(listen.TLS, config) }()
+			logger.Info("doh: proxy: listening tls", slog.String("addr", listen.TLS))
+		}
+	}
+
+	// serveHTTP serves the http server on the activated sockets, or on its address if there is none
+	serveHTTP := func(hs *http.Server, vs []proxy.Socket, certFile, keyFile, msg string) {
+		servers = append(servers, hs)
+		serve := func(l net.Listener) error {
+			if l == nil {
+				if certFile != "" {
+					return hs.ListenAndServeTLS(certFile, keyFile)
+				}
+				return hs.ListenAndServe()
+			}
+			if certFile != "" {
+				return hs.ServeTLS(l, certFile, keyFile)
+			}
+			return hs.Serve(l)
+		}
+		for _, v := range vs {
+			go func() { errc <- serve(v.Listener) }()
+			logger.Info(msg, slog.String("addr", socketAddr(v)), slog.String("activation", "systemd"))
+		}
+		if len(vs) == 0 {
+			go func() { errc <- serve(nil) }()
+			logger.Info(msg, slog.String("addr", hs.Addr))
+		}
+	}
+
+	var ds *server.Server
+	if vs := sockets["doh"]; len(vs) > 0 || listen.DoH != "" {
+		ds = server.New(s).SetTimeout(o.timeout).SetLogger(logger)
+		mux := http.NewServeMux()
+		mux.Handle("/dns-query", ds)
+		mux.Handle("/resolve", ds)
+		hs := &http.Server{Addr: listen.DoH, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		serveHTTP(hs, vs, listen.TLSCert, listen.TLSKey, "doh: proxy: listening doh")
+	}
+
+	var mu sync.Mutex
+	doReload := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return reload(args, stderr, o, c, s, ds, policies)
+	}
+
+	if vs := sockets["admin"]; len(vs) > 0 || listen.Admin != "" {
+		h := admin.New(c).SetToken(listen.AdminToken).SetReload(doReload).AddFlush(func(names ...dns.Domain) {
+			s.FlushCache(names...)
+		})
+		for _, v := range policies {
+			h.AddClient(v.client)
+		}
+		hs := &http.Server{Addr: listen.Admin, Handler: h, ReadHeaderTimeout: 10 * time.Second}
+		serveHTTP(hs, vs, "", "", "doh: proxy: listening admin")
+	}
+
+	if vs := sockets["metrics"]; len(vs) > 0 || listen.Metrics != "" {
+		collector := metrics.New("doh")
+		for _, v := range clients {
+			v.AddHook(collector.Hook)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/healthz", admin.Healthz(c))
+		mux.Handle("/metrics", collector.Handler())
+		hs := &http.Server{Addr: listen.Metrics, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		serveHTTP(hs, vs, "", "", "doh: proxy: listening metrics")
+	}
+
+wait:
+	for {
+		select {
+		case err = <-errc:
+			break wait
+		case v := <-sigc:
+			if v == syscall.SIGHUP {
+				if e := doReload(); e != nil {
+					logger.Error("doh: proxy: reload failed", slog.String("error", e.Error()))
+				} else {
+					logger.Info("doh: proxy: reloaded")
+				}
+				continue
+			}
+			logger.Info("doh: proxy: shutting down", slog.String("signal", v.String()),
+				slog.Duration("drain_timeout", o.drain))
+			break wait
+		}
+	}
+
+	shutdown(logger, o.drain, s, servers)
+	if err != nil && !errors.Is(err, proxy.ErrServerClosed) && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("doh: proxy: serve failed", slog.String("error", err.Error()))
+		return 1
+	}
+
+	return 0
+}
+
+// shutdown stops the servers, and waits for the queries in process until the drain timeout
+func shutdown(logger *slog.Logger, timeout time.Duration, s *proxy.Server, servers []*http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, v := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := v.Shutdown(ctx); err != nil {
+				v.Close()
+			}
+		}()
+	}
+
+	if err := s.Shutdown(ctx); err != nil {
+		logger.Warn("doh: proxy: drain timeout, queries in process are dropped", slog.String("error", err.Error()))
+	}
+
+	wg.Wait()
+}
+
+// activatedSockets returns the sockets of systemd socket activation by the FileDescriptorName,
+// which is dns, tls, doh, admin or metrics, the unnamed sockets are dns
+func activatedSockets() (map[string][]proxy.Socket, error) {
+	ss, err := proxy.SystemdSockets()
+	if err != nil {
+		return nil, err
+	}
+
+	sockets := map[string][]proxy.Socket{}
+	for _, v := range ss {
+		name := v.Name
+		if name == "" {
+			name = "dns"
+		}
+		switch {
+		case name != "dns" && name != "tls" && name != "doh" && name != "admin" && name != "metrics":
+			err = fmt.Errorf("doh: proxy: unknown socket name: %s", v.Name)
+		case name != "dns" && v.Listener == nil:
+			err = fmt.Errorf("doh: proxy: stream socket is required: %s", v.Name)
+		}
+		if err != nil {
+			for _, v := range ss {
+				v.Close()
+			}
+			return nil, err
+		}
+		sockets[name] = append(sockets[name], v)
+	}
+
+	return sockets, nil
+}
+
+// checkAdminSockets returns an error if token is not set and any activated admin socket is neither a loopback
+// nor a unix one, the same as the admin_token rule of the listen address
+func checkAdminSockets(vs []proxy.Socket, token string) error {
+	if token != "" {
+		return nil
+	}
+
+	for _, v := range vs {
+		switch a := v.Listener.Addr().(type) {
+		case *net.UnixAddr:
+		case *net.TCPAddr:
+			if !a.IP.IsLoopback() {
+				return fmt.Errorf("doh: proxy: admin token is required by the non-loopback admin socket: %s",
+					socketAddr(v))
+			}
+		default:
+			return fmt.Errorf("doh: proxy: admin token is required by the admin socket: %s", socketAddr(v))
+		}
+	}
+
+	return nil
+}
+
+// socketAddr returns the local address of socket
+func socketAddr(s proxy.Socket) string {
+	if s.Listener != nil {
+		return s.Listener.Addr().String()
+	}
+
+	return s.PacketConn.LocalAddr().String()
+}
+
+// reload parses the args and config file again, and applies them to the client and proxy,
+// the queries in process and the cache are kept, the listen addresses are not changed until restart,
+// and the policies are not added or removed until restart
+func reload(args []string, stderr io.Writer, o *options, c *doh.DoH, s *proxy.Server, ds *server.Server,
+	policies []*policyClient) error {
+	n, err := parseOptions(args, stderr)
+	if err != nil {
+		return err
+	}
+
+	if err = c.Reload(n.config); err != nil {
+		return err
+	}
+
+	if samePolicies(n.config.Policies, policies) {
+		for k, v := range n.config.Policies {
+			if err = policies[k].client.Reload(v.Apply(n.config)); err != nil {
+				return fmt.Errorf("doh: proxy: policy %s: %w", v.Name, err)
+			}
+			networks, _ := doh.ParseNetworks(v.Subnets)
+			s.SetPolicy(nil, policies[k].networks...).SetPolicy(policies[k].client, networks...)
+			policies[k].networks = networks
+		}
+	} else {
+		fmt.Fprintln(stderr, "doh: proxy: policy changes take effect after restart")
+	}
+
+	acl, _ := doh.ParseNetworks(n.config.ACL)
+	s.SetACL(acl...).SetForwards(newForwards(n.config)).SetRateLimit(n.config.RateLimit.Rate, n.config.RateLimit.Burst)
+
+	s.SetTimeout(n.timeout)
+	if ds != nil {
+		ds.SetTimeout(n.timeout)
+	}
+
+	if n.config.Listen != o.config.Listen || n.config.QueryLog != o.config.QueryLog {
+		fmt.Fprintln(stderr, "doh: proxy: listen and query log changes take effect after restart")
+	}
+
+	if n.config.Cache != o.config.Cache {
+		fmt.Fprintln(stderr, "doh: proxy: cache changes of forwards take effect after restart")
+	}
+
+	return nil
+}
+
+// newForwards returns the forwarders of config forwards
+func newForwards(cfg *doh.Config) map[string]proxy.Resolver {
+	forwards := map[string]proxy.Resolver{}
+	for _, v := range cfg.Forwards {
+		if f, err := proxy.NewForwarder(v.Servers...); err == nil {
+			forwards[v.Zone] = f
+		}
+	}
+
+	return forwards
+}
+
+// policyClient is the client of a policy and its networks
+type policyClient struct {
+	name     string
+	client   *doh.DoH
+	networks []netip.Prefix
+}
+
+// newPolicies returns the clients of config policies
+func newPolicies(cfg *doh.Config) ([]*policyClient, error) {
+	policies := []*policyClient{}
+	for _, v := range cfg.Policies {
+		c, err := v.Apply(cfg).Client()
+		if err != nil {
+			for _, p := range policies {
+				p.client.Close()
+			}
+			return nil, fmt.Errorf("doh: proxy: policy %s: %w", v.Name, err)
+		}
+		networks, _ := doh.ParseNetworks(v.Subnets)
+		policies = append(policies, &policyClient{name: v.Name, client: c, networks: networks})
+	}
+
+	return policies, nil
+}
+
+// samePolicies returns whether the policies of config are the running ones in order
+func samePolicies(cfg []doh.PolicyConfig, policies []*policyClient) bool {
+	if len(cfg) != len(policies) {
+		return false
+	}
+
+	for k, v := range cfg {
+		if v.Name != policies[k].name {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseOptions returns the options of command line args, the flags set override the config file
+func parseOptions(args []string, stderr io.Writer) (*options, error) {
+	fs := flag.NewFlagSet("doh-proxy", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: doh-proxy [options]")
+		fs.PrintDefaults()
+	}
+
+	o := &options{}
+	fs.StringVar(&o.path, "config", "", "yaml or toml config file")
+	listen := fs.String("listen", ":53", "udp and tcp address of plain dns, empty to disable")
+	tlsListen := fs.String("tls-listen", "", "tcp address of dns over tls, for example :853, default disabled")
+	tlsCert := fs.String("tls-cert", "", "certificate file of dns over tls and DoH")
+	tlsKey := fs.String("tls-key", "", "private key file of dns over tls and DoH")
+	dohListen := fs.String("doh-listen", "", "tcp address of DoH at /dns-query and /resolve, "+
+		"https if -tls-cert is set, default disabled")
+	adminListen := fs.String("admin-listen", "", "tcp address of admin api, for example 127.0.0.1:8054, "+
+		"default disabled")
+	adminToken := fs.String("admin-token", "", "bearer token required by the admin api changes, "+
+		"required if -admin-listen is not a loopback address")
+	metricsListen := fs.String("metrics-listen", "", "tcp address of /healthz and /metrics, for example :9153, "+
+		"default disabled")
+	queryLog := fs.String("query-log", "", "file path of query log, - for stderr, default disabled")
+	queryLogFormat := fs.String("query-log-format", "json", "line format of query log: json or text")
+	queryLogMaxSize := fs.Int("query-log-max-size", 0, "max megabytes of query log before it is rotated, "+
+		"default no limit")
+	queryLogRotate := fs.Duration("query-log-rotate", 0, "max time of query log before it is rotated, "+
+		"for example 24h, default no limit")
+	queryLogBackups := fs.Int("query-log-backups", 0, "max number of rotated query logs kept, default all")
+	providers := fs.String("providers", "", "comma separated providers, default all")
+	hosts := fs.String("hosts", "", "comma separated hosts files answering names without querying, "+
+		"for example /etc/hosts, default disabled")
+	rateLimit := fs.Float64("rate-limit", 0, "max queries per second of each client ip, default no limit")
+	rateLimitBurst := fs.Int("rate-limit-burst", 0, "max queries in a burst of each client ip, default the rate")
+	forwards := forwardFlags{}
+	fs.Var(&forwards, "forward", "forward the zone to plain dns servers, for example corp.example=10.0.0.53,10.0.0.54, "+
+		"it can be repeated")
+	dns64 := fs.String("dns64", "", "NAT64 prefix synthesizing AAAA answers from A records for IPv6-only networks, "+
+		"for example 64:ff9b::/96, default disabled")
+	cache := fs.Bool("cache", true, "enable the response cache")
+	cacheShards := fs.Int("cache-shards", 0, "number of shards of the response cache for high concurrency, "+
+		"default a single map")
+	maxConcurrency := fs.Int("max-concurrency", 0, "max concurrent queries to providers, "+
+		"the queued ones are admitted by priority, default no limit")
+	fs.DurationVar(&o.timeout, "timeout", proxy.DefaultTimeout, "timeout of resolving a query")
+	fs.DurationVar(&o.drain, "drain-timeout", 10*time.Second, "max time of replying the queries in process on shutdown")
+	fs.BoolVar(&o.verbose, "v", false, "log every query at debug level")
+
+	fail := func(err error) (*options, error) {
+		fmt.Fprintln(stderr, err)
+		return nil, err
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if fs.NArg() > 0 {
+		return fail(fmt.Errorf("doh: unexpected argument: %s", fs.Arg(0)))
+	}
+
+	o.config = &doh.Config{Cache: doh.CacheConfig{Enabled: true}, Listen: doh.ListenConfig{DNS: ":53"}}
+	if o.path != "" {
+		c, err := config.Load(o.path)
+		if err != nil {
+			return fail(err)
+		}
+		o.config = c
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "listen":
+			o.config.Listen.DNS = *listen
+		case "tls-listen":
+			o.config.Listen.TLS = *tlsListen
+		case "tls-cert":
+			o.config.Listen.TLSCert = *tlsCert
+		case "tls-key":
+			o.config.Listen.TLSKey = *tlsKey
+		case "doh-listen":
+			o.config.Listen.DoH = *dohListen
+		case "admin-listen":
+			o.config.Listen.Admin = *adminListen
+		case "admin-token":
+			o.config.Listen.AdminToken = *adminToken
+		case "metrics-listen":
+			o.config.Listen.Metrics = *metricsListen
+		case "query-log":
+			o.config.QueryLog.Path = *queryLog
+		case "query-log-format":
+			o.config.QueryLog.Format = *queryLogFormat
+		case "query-log-max-size":
+			o.config.QueryLog.MaxSize = *queryLogMaxSize
+		case "query-log-rotate":
+			o.config.QueryLog.Rotate = *queryLogRotate
+		case "query-log-backups":
+			o.config.QueryLog.Backups = *queryLogBackups
+		case "providers":
+			o.config.Providers = splitList(*providers)
+		case "hosts":
+			o.config.Hosts.Files = splitList(*hosts)
+		case "rate-limit":
+			o.config.RateLimit.Rate = *rateLimit
+		case "rate-limit-burst":
+			o.config.RateLimit.Burst = *rateLimitBurst
+		case "forward":
+			o.config.Forwards = forwards
+		case "dns64":
+			o.config.DNS64 = *dns64
+		case "cache":
+			o.config.Cache.Enabled = *cache
+		case "cache-shards":
+			o.config.Cache.Shards = *cacheShards
+		case "max-concurrency":
+			o.config.MaxConcurrency = *maxConcurrency
+		}
+	})
+
+	if err := o.config.Validate(); err != nil {
+		return fail(err)
+	}
+
+	// the listeners may be passed by systemd socket activation
+	l := o.config.Listen
+	if l.DNS == "" && l.TLS == "" && l.DoH == "" && os.Getenv("LISTEN_FDS") == "" {
+		return fail(fmt.Errorf("doh: no listen address"))
+	}
+
+	return o, nil
+}
+
+// forwardFlags is the repeated -forward flags
+type forwardFlags []doh.ForwardConfig
+
+// String returns the flags as set
+func (f *forwardFlags) String() string {
+	ss := []string{}
+	for _, v := range *f {
+		ss = append(ss, v.Zone+"="+strings.Join(v.Servers, ","))
+	}
+
+	return strings.Join(ss, " ")
+}
+
+// Set add a zone=servers flag
+func (f *forwardFlags) Set(s string) error {
+	zone, servers, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(zone) == "" {
+		return fmt.Errorf("doh: invalid forward: %s", s)
+	}
+
+	*f = append(*f, doh.ForwardConfig{Zone: strings.TrimSpace(zone), Servers: splitList(servers)})
+
+	return nil
+}
+
+// splitList returns the non-empty items of comma separated list
+func splitList(s string) []string {
+	ss := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if strings.TrimSpace(v) != "" {
+			ss = append(ss, strings.TrimSpace(v))
+		}
+	}
+
+	return ss
+}
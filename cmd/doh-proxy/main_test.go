@@ -0,0 +1,286 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/ideatocode/doh-go/proxy"
+	"github.com/ideatocode/doh-go/server"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestParseOptions(t *testing.T) {
+	stderr := &bytes.Buffer{}
+
+	o, err := parseOptions(nil, stderr)
+	assert.Nil(t, err)
+	assert.Equal(t, o.config.Listen.DNS, ":53")
+	assert.Equal(t, o.config.Listen.TLS, "")
+	assert.True(t, o.config.Cache.Enabled)
+	assert.Equal(t, o.timeout, 5*time.Second)
+	assert.Equal(t, o.drain, 10*time.Second)
+	assert.Equal(t, len(o.config.Providers), 0)
+
+	o, err = parseOptions([]string{"-listen", "127.0.0.1:5353", "-providers", "google, quad9", "-cache=false",
+		"-timeout", "1s", "-tls-listen", ":853", "-tls-cert", "cert.pem", "-tls-key", "key.pem",
+		"-doh-listen", ":8053", "-admin-listen", "127.0.0.1:8054", "-drain-timeout", "3s",
+		"-metrics-listen", ":9153", "-query-log", "query.log", "-query-log-format", "text", "-query-log-max-size", "10",
+		"-query-log-rotate", "24h", "-query-log-backups", "7", "-dns64", "64:ff9b::/96",
+		"-hosts", "/etc/hosts, ", "-forward", "corp.example=10.0.0.53, 10.0.0.54:5353",
+		"-forward", "10.in-addr.arpa=10.0.0.53", "-rate-limit", "20", "-rate-limit-burst", "50", "-cache-shards", "32",
+		"-max-concurrency", "64"}, stderr)
+	assert.Nil(t, err)
+	assert.Equal(t, o.config.Cache, doh.CacheConfig{Shards: 32})
+	assert.Equal(t, o.config.MaxConcurrency, 64)
+	assert.Equal(t, o.config.Listen.DNS, "127.0.0.1:5353")
+	assert.Equal(t, o.config.Providers, []string{"google", "quad9"})
+	assert.False(t, o.config.Cache.Enabled)
+	assert.Equal(t, o.timeout, time.Second)
+	assert.Equal(t, o.config.Listen.TLS, ":853")
+	assert.Equal(t, o.config.Listen.DoH, ":8053")
+	assert.Equal(t, o.config.Listen.Admin, "127.0.0.1:8054")
+	assert.Equal(t, o.drain, 3*time.Second)
+	assert.Equal(t, o.config.Listen.Metrics, ":9153")
+	assert.Equal(t, o.config.QueryLog, doh.QueryLogConfig{Path: "query.log", Format: "text", MaxSize: 10,
+		Rotate: 24 * time.Hour, Backups: 7})
+	assert.Equal(t, o.config.DNS64, "64:ff9b::/96")
+	assert.Equal(t, o.config.Hosts.Files, []string{"/etc/hosts"})
+	assert.Equal(t, o.config.Forwards, []doh.ForwardConfig{
+		{Zone: "corp.example", Servers: []string{"10.0.0.53", "10.0.0.54:5353"}},
+		{Zone: "10.in-addr.arpa", Servers: []string{"10.0.0.53"}},
+	})
+	assert.Equal(t, len(newForwards(o.config)), 2)
+	assert.Equal(t, o.config.RateLimit, doh.RateLimitConfig{Rate: 20, Burst: 50})
+
+	path := filepath.Join(t.TempDir(), "doh.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte("providers: [cloudflare]\nlisten:\n  doh: :8053\n"), 0644))
+
+	o, err = parseOptions([]string{"-config", path}, stderr)
+	assert.Nil(t, err)
+	assert.Equal(t, o.config.Providers, []string{"cloudflare"})
+	assert.Equal(t, o.config.Listen.DNS, "")
+	assert.Equal(t, o.config.Listen.DoH, ":8053")
+	assert.False(t, o.config.Cache.Enabled)
+
+	o, err = parseOptions([]string{"-config", path, "-providers", "google", "-listen", ":5353"}, stderr)
+	assert.Nil(t, err)
+	assert.Equal(t, o.config.Providers, []string{"google"})
+	assert.Equal(t, o.config.Listen.DNS, ":5353")
+
+	tests := [][]string{
+		{"xx"},
+		{"-providers", "xx"},
+		{"-tls-listen", ":853"},
+		{"-xx"},
+		{"-listen", ""},
+		{"-query-log", "query.log", "-query-log-format", "xx"},
+		{"-query-log-backups", "-1"},
+		{"-dns64", "64:ff9b::/80"},
+		{"-forward", "corp.example"},
+		{"-forward", "corp.example=xx"},
+		{"-forward", "corp.example="},
+		{"-rate-limit", "-1"},
+		{"-config", path + ".xx"},
+	}
+
+	for _, v := range tests {
+		_, err = parseOptions(v, stderr)
+		assert.NotNil(t, err)
+	}
+
+	t.Setenv("LISTEN_FDS", "1")
+	o, err = parseOptions([]string{"-listen", ""}, stderr)
+	assert.Nil(t, err)
+	assert.Equal(t, o.config.Listen.DNS, "")
+}
+
+func TestActivatedSockets(t *testing.T) {
+	t.Setenv("LISTEN_PID", "")
+	sockets, err := activatedSockets()
+	assert.Nil(t, err)
+	assert.Equal(t, len(sockets), 0)
+}
+
+func TestCheckAdminSockets(t *testing.T) {
+	listen := func(network, addr string) proxy.Socket {
+		l, err := net.Listen(network, addr)
+		assert.Nil(t, err)
+		t.Cleanup(func() { l.Close() })
+		return proxy.Socket{Name: "admin", Listener: l}
+	}
+
+	loopback := listen("tcp", "127.0.0.1:0")
+	unix := listen("unix", filepath.Join(t.TempDir(), "admin.sock"))
+	all := listen("tcp", ":0")
+
+	assert.Nil(t, checkAdminSockets(nil, ""))
+	assert.Nil(t, checkAdminSockets([]proxy.Socket{loopback, unix}, ""))
+	assert.NotNil(t, checkAdminSockets([]proxy.Socket{loopback, all}, ""))
+	assert.Nil(t, checkAdminSockets([]proxy.Socket{loopback, all}, "x"))
+}
+
+func TestShutdown(t *testing.T) {
+	c := doh.Use(doh.GoogleProvider)
+	defer c.Close()
+
+	s := proxy.New(c)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	hs := &http.Server{Handler: http.NotFoundHandler()}
+	errc := make(chan error, 3)
+	go func() { errc <- s.ServeUDP(pc) }()
+	go func() { errc <- hs.Serve(l) }()
+	time.Sleep(50 * time.Millisecond)
+
+	shutdown(slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)), time.Second, s, []*http.Server{hs})
+	errs := []error{<-errc, <-errc}
+	assert.Contains(t, errs, proxy.ErrServerClosed)
+	assert.Contains(t, errs, http.ErrServerClosed)
+
+	_, err = net.Dial("tcp", l.Addr().String())
+	assert.NotNil(t, err)
+}
+
+func TestRun(t *testing.T) {
+	stderr := &bytes.Buffer{}
+	assert.Equal(t, run([]string{"-h"}, stderr), 0)
+	assert.Contains(t, stderr.String(), "usage: doh-proxy")
+
+	assert.Equal(t, run([]string{"-xx"}, stderr), 2)
+
+	stderr.Reset()
+	assert.Equal(t, run([]string{"-listen", "127.0.0.1:xx"}, stderr), 1)
+	assert.Contains(t, stderr.String(), "serve failed")
+
+	stderr.Reset()
+	assert.Equal(t, run([]string{"-listen", "127.0.0.1:0", "-tls-listen", "127.0.0.1:0",
+		"-tls-cert", "xx", "-tls-key", "xx"}, stderr), 1)
+	assert.Contains(t, stderr.String(), "load certificate failed")
+
+	stderr.Reset()
+	assert.Equal(t, run([]string{"-listen", "127.0.0.1:0", "-admin-listen", "127.0.0.1:xx"}, stderr), 1)
+	assert.Contains(t, stderr.String(), "listening admin")
+
+	stderr.Reset()
+	assert.Equal(t, run([]string{"-listen", "127.0.0.1:0", "-metrics-listen", "127.0.0.1:xx"}, stderr), 1)
+	assert.Contains(t, stderr.String(), "listening metrics")
+
+	stderr.Reset()
+	assert.Equal(t, run([]string{"-listen", "127.0.0.1:0", "-query-log", t.TempDir()}, stderr), 1)
+	assert.Contains(t, stderr.String(), "open query log failed")
+
+	stderr.Reset()
+	assert.Equal(t, run([]string{"-listen", "", "-doh-listen", "127.0.0.1:xx"}, stderr), 1)
+	assert.Contains(t, stderr.String(), "serve failed")
+}
+
+func TestReload(t *testing.T) {
+	stderr := &bytes.Buffer{}
+	path := filepath.Join(t.TempDir(), "doh.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte("providers: [cloudflare]\nlisten:\n  dns: 127.0.0.1:5353\n"), 0644))
+
+	args := []string{"-config", path}
+	o, err := parseOptions(args, stderr)
+	assert.Nil(t, err)
+
+	c, err := o.config.Client()
+	assert.Nil(t, err)
+	defer c.Close()
+	s := proxy.New(c)
+	ds := server.New(c)
+
+	assert.Nil(t, os.WriteFile(path, []byte("providers: [google, quad9]\nlisten:\n  dns: 127.0.0.1:5353\n"), 0644))
+	assert.Nil(t, reload(args, stderr, o, c, s, ds, nil))
+	assert.Equal(t, len(c.Stats()), 2)
+	assert.Equal(t, c.Stats()[0].Provider, "google")
+	assert.NotContains(t, stderr.String(), "restart")
+
+	assert.Nil(t, os.WriteFile(path, []byte("providers: [google]\nlisten:\n  dns: 127.0.0.1:5354\n"), 0644))
+	assert.Nil(t, reload(args, stderr, o, c, s, nil, nil))
+	assert.Equal(t, len(c.Stats()), 1)
+	assert.Contains(t, stderr.String(), "take effect after restart")
+
+	assert.Nil(t, os.WriteFile(path, []byte("providers: [xx]\n"), 0644))
+	assert.NotNil(t, reload(args, stderr, o, c, s, ds, nil))
+	assert.Equal(t, len(c.Stats()), 1)
+}
+
+func TestPolicies(t *testing.T) {
+	stderr := &bytes.Buffer{}
+	path := filepath.Join(t.TempDir(), "doh.yaml")
+	config := `
+providers: [google]
+listen:
+  dns: 127.0.0.1:5353
+acl: [10.0.0.0/8]
+policies:
+  - name: kids
+    subnets: [10.0.2.0/24]
+    providers: [cloudflare]
+`
+	assert.Nil(t, os.WriteFile(path, []byte(config), 0644))
+
+	args := []string{"-config", path}
+	o, err := parseOptions(args, stderr)
+	assert.Nil(t, err)
+
+	c, err := o.config.Client()
+	assert.Nil(t, err)
+	defer c.Close()
+
+	policies, err := newPolicies(o.config)
+	assert.Nil(t, err)
+	assert.Equal(t, len(policies), 1)
+	defer policies[0].client.Close()
+	assert.Equal(t, policies[0].name, "kids")
+	assert.Equal(t, policies[0].client.Stats()[0].Provider, "cloudflare")
+	assert.Equal(t, policies[0].networks, []netip.Prefix{netip.MustParsePrefix("10.0.2.0/24")})
+
+	s := proxy.New(c).SetPolicy(policies[0].client, policies[0].networks...)
+	config = strings.Replace(config, "10.0.2.0/24", "10.0.3.0/24", 1)
+	config = strings.Replace(config, "[cloudflare]", "[quad9]", 1)
+	assert.Nil(t, os.WriteFile(path, []byte(config), 0644))
+	assert.Nil(t, reload(args, stderr, o, c, s, nil, policies))
+	assert.Equal(t, policies[0].client.Stats()[0].Provider, "quad9")
+	assert.Equal(t, policies[0].networks, []netip.Prefix{netip.MustParsePrefix("10.0.3.0/24")})
+	assert.NotContains(t, stderr.String(), "restart")
+
+	config = strings.Replace(config, "name: kids", "name: guest", 1)
+	assert.Nil(t, os.WriteFile(path, []byte(config), 0644))
+	assert.Nil(t, reload(args, stderr, o, c, s, nil, policies))
+	assert.Contains(t, stderr.String(), "policy changes take effect after restart")
+
+	_, err = newPolicies(&doh.Config{Policies: []doh.PolicyConfig{{Name: "x", Providers: []string{"xx"}}}})
+	assert.NotNil(t, err)
+}
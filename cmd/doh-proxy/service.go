@@ -0,0 +1,217 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// DefaultServiceName is the default name of proxy service, it is the label of launchd
+const DefaultServiceName = "doh-proxy"
+
+// serviceManager installs and runs the proxy as a service of the system service manager
+type serviceManager interface {
+	install(name, exe string, args []string) error
+	uninstall(name string) error
+	run(name string, args []string, stderr io.Writer) int
+}
+
+// windowsService is the service manager of windows, it is set by the windows build
+var windowsService serviceManager
+
+// launchdDir is the directory of installed launchd daemons
+var launchdDir = "/Library/LaunchDaemons"
+
+// serviceCommand runs the service subcommand of args, returns the exit code
+func serviceCommand(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("doh-proxy service", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: doh-proxy service install|uninstall|run|plist [-name name] [-- proxy options]")
+		fmt.Fprintln(stderr, "the paths in proxy options must be absolute as the service is not run in the current directory")
+		fs.PrintDefaults()
+	}
+	name := fs.String("name", DefaultServiceName, "name of service")
+
+	if len(args) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	action := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	if *name == "" || strings.ContainsAny(*name, `/\`) {
+		fmt.Fprintf(stderr, "doh: proxy: invalid service name: %q\n", *name)
+		return 2
+	}
+
+	m := managerOf(runtime.GOOS, stdout)
+	switch action {
+	case "install", "plist":
+		if _, err := parseOptions(fs.Args(), stderr); err != nil {
+			return 2
+		}
+		exe, err := executable()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		if action == "plist" {
+			fmt.Fprint(stdout, launchdPlist(*name, exe, fs.Args()))
+			return 0
+		}
+		if m == nil {
+			break
+		}
+		if err = m.install(*name, exe, fs.Args()); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	case "uninstall":
+		if m == nil {
+			break
+		}
+		if err := m.uninstall(*name); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	case "run":
+		if m == nil {
+			return runForeground(fs.Args(), stderr)
+		}
+		return m.run(*name, fs.Args(), stderr)
+	default:
+		fmt.Fprintf(stderr, "doh: proxy: unknown service command: %s\n", action)
+		fs.Usage()
+		return 2
+	}
+
+	fmt.Fprintf(stderr, "doh: proxy: service is not supported on %s, use the systemd units instead\n", runtime.GOOS)
+
+	return 1
+}
+
+// managerOf returns the service manager of os, nil if it is not supported
+func managerOf(goos string, stdout io.Writer) serviceManager {
+	switch goos {
+	case "windows":
+		return windowsService
+	case "darwin":
+		return &launchd{dir: launchdDir, stdout: stdout}
+	default:
+		return nil
+	}
+}
+
+// executable returns the absolute path of proxy binary
+func executable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("doh: proxy: get executable failed: %w", err)
+	}
+
+	return filepath.Abs(exe)
+}
+
+// launchd is the service manager of macOS
+type launchd struct {
+	dir    string
+	stdout io.Writer
+}
+
+// install writes the launchd plist of service, it is started by launchctl
+func (l *launchd) install(name, exe string, args []string) error {
+	path := filepath.Join(l.dir, name+".plist")
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("doh: proxy: service %s is installed: %s", name, path)
+	}
+
+	if err := os.WriteFile(path, []byte(launchdPlist(name, exe, args)), 0644); err != nil {
+		return fmt.Errorf("doh: proxy: install service failed: %w", err)
+	}
+
+	fmt.Fprintf(l.stdout, "doh: proxy: installed %s, start it by: launchctl bootstrap system %s\n", path, path)
+
+	return nil
+}
+
+// uninstall removes the launchd plist of service, it must be stopped by launchctl before
+func (l *launchd) uninstall(name string) error {
+	path := filepath.Join(l.dir, name+".plist")
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("doh: proxy: service %s is not installed", name)
+		}
+		return fmt.Errorf("doh: proxy: uninstall service failed: %w", err)
+	}
+
+	fmt.Fprintf(l.stdout, "doh: proxy: removed %s, stop it by: launchctl bootout system/%s\n", path, name)
+
+	return nil
+}
+
+// run runs the proxy in foreground, launchd stops it by SIGTERM
+func (l *launchd) run(name string, args []string, stderr io.Writer) int {
+	return runForeground(args, stderr)
+}
+
+// launchdPlist returns the launchd plist running the proxy with args, it is restarted if exits
+func launchdPlist(name, exe string, args []string) string {
+	b := &strings.Builder{}
+	str := func(indent, s string) {
+		b.WriteString(indent + "<string>")
+		_ = xml.EscapeText(b, []byte(s))
+		b.WriteString("</string>\n")
+	}
+
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString("<plist version=\"1.0\">\n<dict>\n")
+	b.WriteString("\t<key>Label</key>\n")
+	str("\t", name)
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, v := range append([]string{exe}, args...) {
+		str("\t\t", v)
+	}
+	b.WriteString("\t</array>\n")
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	b.WriteString("\t<key>KeepAlive</key>\n\t<true/>\n")
+	b.WriteString("\t<key>StandardErrorPath</key>\n")
+	str("\t", "/var/log/"+name+".log")
+	b.WriteString("</dict>\n</plist>\n")
+
+	return b.String()
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestLaunchdPlist(t *testing.T) {
+	s := launchdPlist("doh-proxy", "/usr/local/bin/doh-proxy", []string{"-listen", "127.0.0.1:53", "-forward", "a&b=1.1.1.1"})
+	assert.Contains(t, s, "<key>Label</key>\n\t<string>doh-proxy</string>\n")
+	assert.Contains(t, s, "<array>\n\t\t<string>/usr/local/bin/doh-proxy</string>\n\t\t<string>-listen</string>\n"+
+		"\t\t<string>127.0.0.1:53</string>\n\t\t<string>-forward</string>\n\t\t<string>a&amp;b=1.1.1.1</string>\n\t</array>\n")
+	assert.Contains(t, s, "<key>KeepAlive</key>\n\t<true/>\n")
+	assert.Contains(t, s, "<string>/var/log/doh-proxy.log</string>")
+	assert.True(t, strings.HasSuffix(s, "</dict>\n</plist>\n"))
+}
+
+func TestLaunchd(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	l := &launchd{dir: t.TempDir(), stdout: stdout}
+	path := filepath.Join(l.dir, "doh-proxy.plist")
+
+	assert.Nil(t, l.install("doh-proxy", "/usr/local/bin/doh-proxy", []string{"-listen", "127.0.0.1:53"}))
+	assert.Contains(t, stdout.String(), "launchctl bootstrap system "+path)
+	b, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), "<string>127.0.0.1:53</string>")
+
+	assert.NotNil(t, l.install("doh-proxy", "/usr/local/bin/doh-proxy", nil))
+
+	assert.Nil(t, l.uninstall("doh-proxy"))
+	assert.Contains(t, stdout.String(), "launchctl bootout system/doh-proxy")
+	_, err = os.Stat(path)
+	assert.NotNil(t, err)
+
+	assert.NotNil(t, l.uninstall("doh-proxy"))
+}
+
+func TestServiceCommand(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+
+	assert.Equal(t, serviceCommand(nil, stdout, stderr), 2)
+	assert.Contains(t, stderr.String(), "usage: doh-proxy service")
+
+	assert.Equal(t, serviceCommand([]string{"xx"}, stdout, stderr), 2)
+	assert.Contains(t, stderr.String(), "unknown service command: xx")
+
+	assert.Equal(t, serviceCommand([]string{"install", "-name", "a/b"}, stdout, stderr), 2)
+	assert.Contains(t, stderr.String(), "invalid service name")
+
+	assert.Equal(t, serviceCommand([]string{"plist", "--", "-timeout", "xx"}, stdout, stderr), 2)
+	assert.Equal(t, serviceCommand([]string{"install", "-xx"}, stdout, stderr), 2)
+
+	assert.Equal(t, serviceCommand([]string{"plist", "-name", "doh", "--", "-listen", "127.0.0.1:53"}, stdout, stderr), 0)
+	assert.Contains(t, stdout.String(), "<string>doh</string>")
+	assert.Contains(t, stdout.String(), "<string>127.0.0.1:53</string>")
+
+	assert.Equal(t, run([]string{"service"}, stderr), 2)
+
+	if runtime.GOOS != "windows" && runtime.GOOS != "darwin" {
+		stderr.Reset()
+		assert.Equal(t, serviceCommand([]string{"install"}, stdout, stderr), 1)
+		assert.Equal(t, serviceCommand([]string{"uninstall"}, stdout, stderr), 1)
+		assert.Contains(t, stderr.String(), "service is not supported on")
+	}
+}
+
+func TestManagerOf(t *testing.T) {
+	assert.True(t, managerOf("linux", os.Stdout) == nil)
+	assert.Equal(t, managerOf("darwin", os.Stdout).(*launchd).dir, launchdDir)
+	assert.True(t, managerOf("windows", os.Stdout) == windowsService)
+}
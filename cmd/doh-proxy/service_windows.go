@@ -0,0 +1,153 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+func init() {
+	windowsService = &scm{}
+}
+
+// scm is the service manager of windows
+type scm struct{}
+
+// install creates an automatic start service running the proxy with args
+func (s *scm) install(name, exe string, args []string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("doh: proxy: connect service manager failed: %w", err)
+	}
+	defer m.Disconnect()
+
+	if v, err := m.OpenService(name); err == nil {
+		v.Close()
+		return fmt.Errorf("doh: proxy: service %s is installed", name)
+	}
+
+	config := mgr.Config{
+		DisplayName: name,
+		Description: "DNS over HTTPS proxy",
+		StartType:   mgr.StartAutomatic,
+	}
+
+	v, err := m.CreateService(name, exe, config, append([]string{"service", "run", "-name", name, "--"}, args...)...)
+	if err != nil {
+		return fmt.Errorf("doh: proxy: install service failed: %w", err)
+	}
+	defer v.Close()
+
+	fmt.Fprintf(os.Stdout, "doh: proxy: installed %s, start it by: sc start %s\n", name, name)
+
+	return nil
+}
+
+// uninstall removes the service, it is removed after stopped if running
+func (s *scm) uninstall(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("doh: proxy: connect service manager failed: %w", err)
+	}
+	defer m.Disconnect()
+
+	v, err := m.OpenService(name)
+	if err != nil {
+		if errors.Is(err, windows.ERROR_SERVICE_DOES_NOT_EXIST) {
+			return fmt.Errorf("doh: proxy: service %s is not installed", name)
+		}
+		return fmt.Errorf("doh: proxy: open service failed: %w", err)
+	}
+	defer v.Close()
+
+	if err = v.Delete(); err != nil {
+		return fmt.Errorf("doh: proxy: uninstall service failed: %w", err)
+	}
+
+	return nil
+}
+
+// run runs the proxy as the service if started by the service manager, else in foreground
+func (s *scm) run(name string, args []string, stderr io.Writer) int {
+	ok, err := svc.IsWindowsService()
+	if err != nil || !ok {
+		return runForeground(args, stderr)
+	}
+
+	h := &serviceHandler{args: args, stderr: stderr}
+	if err = svc.Run(name, h); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	return h.code
+}
+
+// serviceHandler runs the proxy until the service is stopped, the param change reloads the config
+type serviceHandler struct {
+	args   []string
+	stderr io.Writer
+	code   int
+}
+
+// Execute implements svc.Handler
+func (h *serviceHandler) Execute(_ []string, r <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	sigc := make(chan os.Signal, 1)
+	done := make(chan int, 1)
+	go func() { done <- serve(h.args, h.stderr, sigc) }()
+
+	notify := func(v os.Signal) {
+		select {
+		case sigc <- v:
+		default:
+		}
+	}
+
+	accepts := svc.AcceptStop | svc.AcceptShutdown | svc.AcceptParamChange
+	status <- svc.Status{State: svc.Running, Accepts: accepts}
+
+	for {
+		select {
+		case h.code = <-done:
+			status <- svc.Status{State: svc.StopPending}
+			return false, uint32(h.code)
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				status <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				notify(syscall.SIGTERM)
+			case svc.ParamChange:
+				notify(syscall.SIGHUP)
+			}
+		}
+	}
+}
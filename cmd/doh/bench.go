@@ -0,0 +1,124 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// benchDomains is the default workload of benchmark
+var benchDomains = []dns.Domain{
+	"google.com",
+	"youtube.com",
+	"facebook.com",
+	"wikipedia.org",
+	"amazon.com",
+	"github.com",
+	"cloudflare.com",
+	"apple.com",
+	"microsoft.com",
+	"likexian.com",
+}
+
+// bench runs the benchmark command
+func bench(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: doh bench [options] [domain ...]")
+		fs.PrintDefaults()
+	}
+
+	providers := fs.String("providers", "", "comma separated providers, default all")
+	types := fs.String("type", "A", "comma separated query types")
+	rounds := fs.Int("rounds", 3, "times to query the workload")
+	concurrency := fs.Int("c", 1, "concurrent queries per provider")
+	timeout := fs.Duration("timeout", 5*time.Second, "timeout of each query")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ps, err := parseProviders(*providers)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	domains := benchDomains
+	if fs.NArg() > 0 {
+		domains = []dns.Domain{}
+		for _, v := range fs.Args() {
+			domains = append(domains, dns.Domain(v))
+		}
+	}
+
+	opts := doh.BenchmarkOptions{
+		Rounds:      *rounds,
+		Concurrency: *concurrency,
+		Timeout:     *timeout,
+	}
+
+	for _, v := range strings.Split(*types, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			opts.Types = append(opts.Types, dns.Type(strings.ToUpper(v)))
+		}
+	}
+
+	c := newClient(ps...)
+	defer c.Close()
+
+	results := c.Benchmark(context.Background(), domains, opts)
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Successes == 0 || results[j].Successes == 0 {
+			return results[i].Successes > results[j].Successes
+		}
+		return results[i].P50 < results[j].P50
+	})
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROVIDER\tQUERIES\tSUCCESS\tMIN\tP50\tP90\tP99\tMAX\tMEAN")
+	for _, v := range results {
+		fmt.Fprintf(w, "%s\t%d\t%.1f%%\t%s\t%s\t%s\t%s\t%s\t%s\n", v.Provider, v.Queries, v.SuccessRate*100,
+			round(v.Min), round(v.P50), round(v.P90), round(v.P99), round(v.Max), round(v.Mean))
+	}
+	w.Flush()
+
+	return 0
+}
+
+// round returns the duration rounded for display
+func round(d time.Duration) time.Duration {
+	if d > time.Millisecond {
+		return d.Round(100 * time.Microsecond)
+	}
+
+	return d.Round(time.Microsecond)
+}
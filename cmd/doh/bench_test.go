@@ -0,0 +1,56 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestBench(t *testing.T) {
+	mockClient(t, func(name string) string {
+		return `{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`
+	})
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run([]string{"bench", "-providers", "google,quad9", "-rounds", "2", "-type", "a,aaaa", "likexian.com"},
+		stdout, stderr)
+	assert.Equal(t, code, 0)
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	assert.Equal(t, len(lines), 3)
+	assert.True(t, strings.HasPrefix(lines[0], "PROVIDER"))
+	for _, v := range lines[1:] {
+		assert.Contains(t, v, "  4  ")
+		assert.Contains(t, v, "100.0%")
+	}
+
+	assert.Equal(t, run([]string{"bench", "-providers", "xx"}, stdout, stderr), 2)
+	assert.Equal(t, run([]string{"bench", "-xx"}, stdout, stderr), 2)
+}
+
+func TestRound(t *testing.T) {
+	assert.Equal(t, round(1234567*time.Nanosecond), 1200*time.Microsecond)
+	assert.Equal(t, round(123456*time.Nanosecond), 123*time.Microsecond)
+}
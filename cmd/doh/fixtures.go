@@ -0,0 +1,103 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/ideatocode/doh-go/dohtest"
+)
+
+// fixtures runs the fixtures command, which saves the golden fixtures of providers or checks the drift from them
+func fixtures(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("fixtures", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: doh fixtures [options]")
+		fs.PrintDefaults()
+	}
+
+	providers := fs.String("providers", "", "comma separated providers, default all")
+	dir := fs.String("dir", "testdata/golden", "directory of the golden fixtures")
+	check := fs.Bool("check", false, "check the drift from the golden fixtures instead of saving them")
+	timeout := fs.Duration("timeout", 0, "timeout of all queries, default none")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ps, err := parseProviders(*providers)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if len(ps) == 0 {
+		ps = doh.Providers
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	if !*check {
+		if err := os.MkdirAll(*dir, 0o755); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	code := 0
+	for _, v := range ps {
+		p := newProvider(v)
+		path := filepath.Join(*dir, p.String()+".json")
+		gs := dohtest.Generate(ctx, p)
+
+		if !*check {
+			if err := dohtest.SaveGolden(path, gs); err != nil {
+				fmt.Fprintln(stderr, err)
+				return 1
+			}
+			fmt.Fprintf(stdout, "saved %d fixtures to %s\n", len(gs), path)
+			continue
+		}
+
+		want, err := dohtest.LoadGolden(path)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+
+		for _, d := range dohtest.Drift(want, gs) {
+			fmt.Fprintln(stdout, d)
+			code = 1
+		}
+	}
+
+	return code
+}
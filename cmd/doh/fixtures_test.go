@@ -0,0 +1,62 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestFixtures(t *testing.T) {
+	status := "0"
+	mockClient(t, func(name string) string {
+		return `{"Status":` + status + `,"Answer":[{"name":"` + name + `.","type":1,"TTL":300,"data":"1.1.1.1"}]}`
+	})
+
+	dir := filepath.Join(t.TempDir(), "golden")
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run([]string{"fixtures", "-providers", "google,cloudflare", "-dir", dir}, stdout, stderr)
+	assert.Equal(t, code, 0)
+	assert.Contains(t, stdout.String(), "google.json")
+	assert.Contains(t, stdout.String(), "cloudflare.json")
+	_, err := os.Stat(filepath.Join(dir, "google.json"))
+	assert.Nil(t, err)
+
+	stdout.Reset()
+	code = run([]string{"fixtures", "-providers", "google,cloudflare", "-dir", dir, "-check", "-timeout", "1m"},
+		stdout, stderr)
+	assert.Equal(t, code, 0)
+	assert.Equal(t, stdout.String(), "")
+
+	status = "3"
+	code = run([]string{"fixtures", "-providers", "google", "-dir", dir, "-check"}, stdout, stderr)
+	assert.Equal(t, code, 1)
+	assert.Contains(t, stdout.String(), "google likexian.com. A: status 3, want 0")
+	assert.Equal(t, len(strings.Split(strings.TrimSpace(stdout.String()), "\n")), 10)
+
+	assert.Equal(t, run([]string{"fixtures", "-providers", "quad9", "-dir", dir, "-check"}, stdout, stderr), 1)
+	assert.Equal(t, run([]string{"fixtures", "-providers", "xx"}, stdout, stderr), 2)
+	assert.Equal(t, run([]string{"fixtures", "-xx"}, stdout, stderr), 2)
+}
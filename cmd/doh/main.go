@@ -0,0 +1,110 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ideatocode/doh-go"
+	_ "github.com/ideatocode/doh-go/transport/brotli"
+)
+
+// newClient returns the DoH client of providers, it is replaced in tests
+var newClient = func(providers ...int) *doh.DoH {
+	return doh.Use(providers...)
+}
+
+// newProvider returns the provider client, it is replaced in tests
+var newProvider = func(provider int) doh.Provider {
+	return doh.New(provider)
+}
+
+// loadResolvConf returns the ndots and search domains of system, it is replaced in tests
+var loadResolvConf = func() (int, []string, error) {
+	return doh.LoadResolvConf(doh.DefaultResolvConf)
+}
+
+// usage is the command usage
+const usage = `usage: doh <command> [options]
+       doh [@provider ...] [type] domain [+option ...]
+
+commands:
+    bench    benchmark the latency and success rate of providers
+    fixtures save the golden fixtures of providers, or check the upstream api drift from them
+    query    query a domain like dig, it is the default command
+    verify   verify the expected records of a zone against providers, for the post-deployment checks
+
+run "doh <command> -h" for the command options
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command with args, returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "bench":
+		return bench(args[1:], stdout, stderr)
+	case "fixtures":
+		return fixtures(args[1:], stdout, stderr)
+	case "query":
+		if len(args) == 1 || args[1] == "-h" {
+			fmt.Fprint(stdout, queryUsage)
+			return 0
+		}
+		return query(args[1:], stdout, stderr)
+	case "verify":
+		return verify(args[1:], stdout, stderr)
+	case "version", "-version", "--version":
+		fmt.Fprintf(stdout, "doh-go %s\n", doh.Version())
+		return 0
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		return query(args, stdout, stderr)
+	}
+}
+
+// parseProviders returns the providers of comma separated names, empty for all providers
+func parseProviders(names string) ([]int, error) {
+	providers := []int{}
+	for _, v := range strings.Split(names, ",") {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		p, err := doh.ParseProvider(v)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+
+	return providers, nil
+}
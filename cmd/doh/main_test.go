@@ -0,0 +1,98 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/transport"
+	"github.com/likexian/gokit/assert"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// mockClient replaces the client with one answering body of name from fn
+func mockClient(t *testing.T, fn func(name string) string) {
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(fn(r.URL.Query().Get("name")))),
+			Request:    r,
+		}, nil
+	})
+
+	c, p := newClient, newProvider
+	newClient = func(providers ...int) *doh.DoH {
+		return doh.Use(providers...).SetRoundTripper(rt).SetFormat(dns.FormatJSON)
+	}
+	newProvider = func(provider int) doh.Provider {
+		v := doh.New(provider)
+		v.(interface{ Transport() *transport.Transport }).Transport().SetRoundTripper(rt)
+		if f, ok := v.(interface{ SetFormat(dns.Format) error }); ok {
+			_ = f.SetFormat(dns.FormatJSON)
+		}
+		return v
+	}
+
+	t.Cleanup(func() {
+		newClient, newProvider = c, p
+	})
+}
+
+func TestRun(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	assert.Equal(t, run(nil, stdout, stderr), 2)
+	assert.Contains(t, stderr.String(), "usage: doh")
+
+	stdout.Reset()
+	assert.Equal(t, run([]string{"version"}, stdout, stderr), 0)
+	assert.Equal(t, stdout.String(), "doh-go "+doh.Version()+"\n")
+
+	stdout.Reset()
+	assert.Equal(t, run([]string{"-h"}, stdout, stderr), 0)
+	assert.Contains(t, stdout.String(), "bench")
+
+	stderr.Reset()
+	assert.Equal(t, run([]string{"-x"}, stdout, stderr), 2)
+	assert.Contains(t, stderr.String(), "unknown option: -x")
+}
+
+func TestParseProviders(t *testing.T) {
+	ps, err := parseProviders("")
+	assert.Nil(t, err)
+	assert.Equal(t, ps, []int{})
+
+	ps, err = parseProviders("google, quad9")
+	assert.Nil(t, err)
+	assert.Equal(t, ps, []int{doh.GoogleProvider, doh.Quad9Provider})
+
+	_, err = parseProviders("google,xx")
+	assert.NotNil(t, err)
+}
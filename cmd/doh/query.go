@@ -0,0 +1,298 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// queryUsage is the usage of query command
+const queryUsage = `usage: doh [@provider ...] [type] domain [+option ...]
+
+    @provider       query each provider: cloudflare, dnspod, google, quad9,
+                    or all for all providers, default the fastest provider
+    type            query type, default A
+    +subnet=addr    send the edns0-client-subnet option, for example: 1.2.3.0/24
+    +cd             set checking disabled, the resolver does not validate dnssec
+    +dnssec         set dnssec ok, the resolver returns the dnssec records
+    +norecurse      clear recursion desired, for example querying an authoritative endpoint
+    +timeout=10s    timeout of query, default 5s
+    +search         try the search domains of /etc/resolv.conf, the default provider only
+    +short, --short print the answer data only, one per line
+    +json, --json   print the full response as json, one per line
+
+exit status:
+    0               the query succeeded with NOERROR
+    1               the query failed without response
+    2               the usage is invalid
+    10 + rcode      the response code is not NOERROR, for example: 13 for NXDOMAIN
+`
+
+// Output modes of query command
+const (
+	outputDig = iota
+	outputShort
+	outputJSON
+)
+
+// queryArgs is the args of query command
+type queryArgs struct {
+	providers []int
+	all       bool
+	domain    dns.Domain
+	qtype     dns.Type
+	ecs       dns.ECS
+	flags     dns.Flags
+	timeout   time.Duration
+	search    bool
+	output    int
+}
+
+// parseQueryArgs returns the query args of dig like args, they can be in any order
+func parseQueryArgs(args []string) (*queryArgs, error) {
+	q := &queryArgs{
+		qtype:   dns.TypeA,
+		timeout: 5 * time.Second,
+	}
+
+	for _, v := range args {
+		switch {
+		case strings.HasPrefix(v, "@"):
+			if strings.EqualFold(v[1:], "all") {
+				q.all = true
+				continue
+			}
+			p, err := doh.ParseProvider(v[1:])
+			if err != nil {
+				return nil, err
+			}
+			q.providers = append(q.providers, p)
+		case strings.HasPrefix(v, "--"):
+			if err := q.setOutput(v[2:]); err != nil {
+				return nil, fmt.Errorf("doh: unknown option: %s", v)
+			}
+		case strings.HasPrefix(v, "-"):
+			return nil, fmt.Errorf("doh: unknown option: %s", v)
+		case strings.HasPrefix(v, "+"):
+			if err := q.setOption(v[1:]); err != nil {
+				return nil, err
+			}
+		case q.domain == "" && isType(v) && len(args) > 1:
+			q.qtype = dns.Type(v).Normalize()
+		case q.domain == "":
+			q.domain = dns.Domain(v)
+		default:
+			if !isType(v) {
+				return nil, fmt.Errorf("doh: unexpected argument: %s", v)
+			}
+			q.qtype = dns.Type(v).Normalize()
+		}
+	}
+
+	if q.domain == "" {
+		return nil, fmt.Errorf("doh: missing domain")
+	}
+
+	if q.search && (q.all || len(q.providers) > 0) {
+		return nil, fmt.Errorf("doh: +search is not supported with @provider")
+	}
+
+	return q, nil
+}
+
+// setOption sets the +option of query
+func (q *queryArgs) setOption(opt string) error {
+	name, value := opt, ""
+	if i := strings.Index(opt, "="); i >= 0 {
+		name, value = opt[:i], opt[i+1:]
+	}
+
+	switch strings.ToLower(name) {
+	case "subnet":
+		q.ecs = dns.ECS(value)
+	case "cd":
+		q.flags.CD = true
+	case "dnssec":
+		q.flags.DO = true
+	case "norecurse":
+		q.flags.NoRD = true
+	case "search":
+		q.search = true
+	case "timeout":
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("doh: invalid timeout: %s", value)
+		}
+		q.timeout = d
+	default:
+		if q.setOutput(name) != nil {
+			return fmt.Errorf("doh: unknown option: +%s", opt)
+		}
+	}
+
+	return nil
+}
+
+// setOutput sets the output mode of query, short or json
+func (q *queryArgs) setOutput(mode string) error {
+	switch strings.ToLower(mode) {
+	case "short":
+		q.output = outputShort
+	case "json":
+		q.output = outputJSON
+	default:
+		return fmt.Errorf("doh: unknown output: %s", mode)
+	}
+
+	return nil
+}
+
+// isType returns whether s is a supported query type
+func isType(s string) bool {
+	_, err := dns.Type(s).Code()
+	return err == nil
+}
+
+// query runs the query command
+func query(args []string, stdout, stderr io.Writer) int {
+	q, err := parseQueryArgs(args)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n%s", err, queryUsage)
+		return 2
+	}
+
+	if len(q.providers) == 0 && !q.all {
+		c := newClient()
+		defer c.Close()
+		if !q.search {
+			return printQuery(stdout, stderr, q, c.ECSQuery)
+		}
+		ndots, domains, err := loadResolvConf()
+		if err != nil {
+			fmt.Fprintf(stderr, ";; %s\n", err)
+			return 1
+		}
+		return printQuery(stdout, stderr, q, c.SetSearch(ndots, domains...).ECSLookup)
+	}
+
+	providers := q.providers
+	if q.all && len(providers) == 0 {
+		providers = doh.Providers
+	}
+
+	code := 0
+	for k, v := range providers {
+		if k > 0 && q.output == outputDig {
+			fmt.Fprintln(stdout)
+		}
+		if n := printQuery(stdout, stderr, q, newProvider(v).ECSQuery); n != 0 {
+			code = n
+		}
+	}
+
+	return code
+}
+
+// printQuery does the query by fn and prints the response in the output mode, returns the exit code
+func printQuery(stdout, stderr io.Writer, q *queryArgs, fn doh.QueryFunc) int {
+	ctx, cancel := context.WithTimeout(context.Background(), q.timeout)
+	defer cancel()
+
+	start := time.Now()
+	rsp, err := fn(dns.WithFlags(ctx, q.flags), q.domain, q.qtype, q.ecs)
+	if rsp == nil {
+		fmt.Fprintf(stderr, ";; query failed: %s\n", err)
+		return 1
+	}
+
+	switch q.output {
+	case outputShort:
+		for _, v := range rsp.Answer {
+			fmt.Fprintln(stdout, v.Data)
+		}
+	case outputJSON:
+		b, err := json.Marshal(rsp)
+		if err != nil {
+			fmt.Fprintf(stderr, ";; encode failed: %s\n", err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "%s\n", b)
+	default:
+		printDig(stdout, q, rsp, time.Since(start))
+	}
+
+	return exitCode(rsp, err)
+}
+
+// printDig prints the response in dig like format
+func printDig(w io.Writer, q *queryArgs, rsp *dns.Response, elapsed time.Duration) {
+	flags := []string{}
+	for _, v := range []struct {
+		name string
+		set  bool
+	}{{"tc", rsp.TC}, {"rd", rsp.RD}, {"ra", rsp.RA}, {"ad", rsp.AD}, {"cd", rsp.CD}} {
+		if v.set {
+			flags = append(flags, v.name)
+		}
+	}
+
+	fmt.Fprintf(w, ";; provider: %s, status: %s, flags: %s, time: %s\n", rsp.Provider,
+		dns.RcodeName(rsp.Status), strings.Join(flags, " "), elapsed.Round(time.Millisecond))
+
+	fmt.Fprintln(w, "\n;; QUESTION SECTION:")
+	fmt.Fprintf(w, ";%s\tIN\t%s\n", fqdn(string(q.domain)), q.qtype)
+
+	if len(rsp.Answer) > 0 {
+		fmt.Fprintln(w, "\n;; ANSWER SECTION:")
+		for _, v := range rsp.Answer {
+			fmt.Fprintf(w, "%s\t%d\tIN\t%s\t%s\n", fqdn(v.Name), v.TTL, dns.TypeOf(uint16(v.Type)), v.Data)
+		}
+	}
+}
+
+// exitCode returns the exit code of response, 10 + rcode if it is not NOERROR
+func exitCode(rsp *dns.Response, err error) int {
+	if rsp.Status != 0 {
+		return 10 + rsp.Status
+	}
+
+	if err != nil {
+		return 1
+	}
+
+	return 0
+}
+
+// fqdn returns the name with the trailing dot
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+
+	return name + "."
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestParseQueryArgs(t *testing.T) {
+	q, err := parseQueryArgs([]string{"likexian.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, q.domain, dns.Domain("likexian.com"))
+	assert.Equal(t, q.qtype, dns.TypeA)
+	assert.Equal(t, q.timeout, 5*time.Second)
+
+	q, err = parseQueryArgs([]string{"mx", "likexian.com", "@google", "@quad9", "+subnet=1.2.3.0/24", "+cd", "+dnssec", "+norecurse", "+timeout=1s"})
+	assert.Nil(t, err)
+	assert.Equal(t, q.domain, dns.Domain("likexian.com"))
+	assert.Equal(t, q.qtype, dns.TypeMX)
+	assert.Equal(t, q.providers, []int{doh.GoogleProvider, doh.Quad9Provider})
+	assert.Equal(t, q.ecs, dns.ECS("1.2.3.0/24"))
+	assert.Equal(t, q.flags, dns.Flags{CD: true, DO: true, NoRD: true})
+	assert.Equal(t, q.timeout, time.Second)
+
+	q, err = parseQueryArgs([]string{"likexian.com", "aaaa", "@all"})
+	assert.Nil(t, err)
+	assert.Equal(t, q.qtype, dns.TypeAAAA)
+	assert.True(t, q.all)
+
+	q, err = parseQueryArgs([]string{"likexian.com", "type65"})
+	assert.Nil(t, err)
+	assert.Equal(t, q.qtype, dns.Type("TYPE65"))
+
+	q, err = parseQueryArgs([]string{"likexian.com", "+short"})
+	assert.Nil(t, err)
+	assert.Equal(t, q.output, outputShort)
+
+	q, err = parseQueryArgs([]string{"--json", "likexian.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, q.output, outputJSON)
+
+	q, err = parseQueryArgs([]string{"mx"})
+	assert.Nil(t, err)
+	assert.Equal(t, q.domain, dns.Domain("mx"))
+
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{}, "missing domain"},
+		{[]string{"likexian.com", "xx"}, "unexpected argument"},
+		{[]string{"likexian.com", "@xx"}, "not supported provider"},
+		{[]string{"likexian.com", "+xx"}, "unknown option"},
+		{[]string{"likexian.com", "+timeout=xx"}, "invalid timeout"},
+		{[]string{"likexian.com", "-x"}, "unknown option"},
+		{[]string{"likexian.com", "--xx"}, "unknown option"},
+	}
+
+	for _, v := range tests {
+		_, err := parseQueryArgs(v.args)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), v.err)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	mockClient(t, func(name string) string {
+		if name == "" {
+			return "1.1.1.1,300"
+		}
+		if name == "fail.likexian.com" {
+			return `{"Status":3,"RD":true,"RA":true}`
+		}
+		return `{"Status":0,"RD":true,"RA":true,"AD":true,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`
+	})
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	assert.Equal(t, run([]string{"@google", "likexian.com"}, stdout, stderr), 0)
+	assert.Contains(t, stdout.String(), ";; provider: google, status: NOERROR, flags: rd ra ad, time:")
+	assert.Contains(t, stdout.String(), ";; QUESTION SECTION:\n;likexian.com.\tIN\tA\n")
+	assert.Contains(t, stdout.String(), ";; ANSWER SECTION:\nlikexian.com.\t300\tIN\tA\t1.1.1.1\n")
+
+	stdout.Reset()
+	assert.Equal(t, run([]string{"query", "@google", "fail.likexian.com", "+cd"}, stdout, stderr), 13)
+	assert.Contains(t, stdout.String(), "status: NXDOMAIN")
+	assert.NotContains(t, stdout.String(), "ANSWER SECTION")
+
+	stdout.Reset()
+	assert.Equal(t, run([]string{"likexian.com", "@all"}, stdout, stderr), 0)
+	for _, v := range []string{"cloudflare", "dnspod", "google", "quad9"} {
+		assert.Contains(t, stdout.String(), ";; provider: "+v+",")
+	}
+
+	stdout.Reset()
+	assert.Equal(t, run([]string{"likexian.com", "@google", "@quad9", "--short"}, stdout, stderr), 0)
+	assert.Equal(t, stdout.String(), "1.1.1.1\n1.1.1.1\n")
+
+	stdout.Reset()
+	assert.Equal(t, run([]string{"likexian.com", "@google", "+json"}, stdout, stderr), 0)
+	rsp := &dns.Response{}
+	assert.Nil(t, json.Unmarshal(stdout.Bytes(), rsp))
+	assert.Equal(t, rsp.Provider, "google")
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+
+	stdout.Reset()
+	assert.Equal(t, run([]string{"fail.likexian.com", "@google", "--json"}, stdout, stderr), 13)
+	assert.Contains(t, stdout.String(), `"Status":3`)
+
+	stdout.Reset()
+	assert.Equal(t, run([]string{"query"}, stdout, stderr), 0)
+	assert.Contains(t, stdout.String(), "+subnet")
+
+	stderr.Reset()
+	assert.Equal(t, run([]string{"likexian.com", "+xx"}, stdout, stderr), 2)
+	assert.Contains(t, stderr.String(), "unknown option: +xx")
+}
+
+func TestQuerySearch(t *testing.T) {
+	mockClient(t, func(name string) string {
+		if name == "nas.corp.example." {
+			return `{"Status":0,"Answer":[{"name":"nas.corp.example.","type":1,"TTL":300,"data":"10.0.0.1"}]}`
+		}
+		return `{"Status":3}`
+	})
+
+	// the mock of dnspod answers any name
+	c, l := newClient, loadResolvConf
+	newClient = func(...int) *doh.DoH {
+		return c(doh.GoogleProvider)
+	}
+	defer func() { newClient, loadResolvConf = c, l }()
+	loadResolvConf = func() (int, []string, error) {
+		return 1, []string{"lab.example", "corp.example"}, nil
+	}
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	assert.Equal(t, run([]string{"nas", "+search", "+short"}, stdout, stderr), 0)
+	assert.Equal(t, stdout.String(), "10.0.0.1\n")
+
+	stdout.Reset()
+	assert.Equal(t, run([]string{"nas", "+short"}, stdout, stderr), 13)
+	assert.Equal(t, stdout.String(), "")
+
+	stderr.Reset()
+	assert.Equal(t, run([]string{"nas", "+search", "@google"}, stdout, stderr), 2)
+	assert.Contains(t, stderr.String(), "not supported with @provider")
+
+	loadResolvConf = func() (int, []string, error) {
+		return 0, nil, fmt.Errorf("doh: resolv.conf: not found")
+	}
+	stderr.Reset()
+	assert.Equal(t, run([]string{"nas", "+search"}, stdout, stderr), 1)
+	assert.Contains(t, stderr.String(), "not found")
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, exitCode(&dns.Response{}, nil), 0)
+	assert.Equal(t, exitCode(&dns.Response{Status: 2}, fmt.Errorf("xx")), 12)
+	assert.Equal(t, exitCode(&dns.Response{}, fmt.Errorf("xx")), 1)
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ideatocode/doh-go/config"
+)
+
+// verify runs the verify command, which checks the expected records of a zone against providers
+func verify(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: doh verify [options] file")
+		fs.PrintDefaults()
+	}
+
+	providers := fs.String("providers", "", "comma separated providers, default all")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout of all queries")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	ps, err := parseProviders(*providers)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	e, err := config.LoadExpectations(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	c := newClient(ps...)
+	defer c.Close()
+
+	ms := c.Verify(ctx, e)
+	for _, v := range ms {
+		fmt.Fprintln(stdout, v)
+	}
+
+	if len(ms) > 0 {
+		fmt.Fprintf(stderr, "%d mismatches of %d records\n", len(ms), len(e.Records))
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "verified %d records\n", len(e.Records))
+
+	return 0
+}
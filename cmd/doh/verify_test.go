@@ -0,0 +1,58 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestVerify(t *testing.T) {
+	mockClient(t, func(name string) string {
+		return `{"Status":0,"Answer":[{"name":"` + name + `.","type":1,"TTL":300,"data":"1.1.1.1"}]}`
+	})
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "expect.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte("zone: likexian.com\nrecords:\n  - name: www\n    type: A\n"+
+		"    data: [1.1.1.1]\n"), 0o644))
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run([]string{"verify", "-providers", "google,cloudflare", path}, stdout, stderr)
+	assert.Equal(t, code, 0)
+	assert.Equal(t, stdout.String(), "verified 1 records\n")
+
+	assert.Nil(t, os.WriteFile(path, []byte("zone: likexian.com\nrecords:\n  - name: www\n    type: A\n"+
+		"    data: [2.2.2.2]\n"), 0o644))
+	stdout.Reset()
+	code = run([]string{"verify", "-providers", "google", "-timeout", "1m", path}, stdout, stderr)
+	assert.Equal(t, code, 1)
+	assert.Equal(t, stdout.String(), "google www.likexian.com A: got [1.1.1.1], want [2.2.2.2]\n")
+	assert.Contains(t, stderr.String(), "1 mismatches of 1 records")
+
+	assert.Equal(t, run([]string{"verify", filepath.Join(dir, "none.yaml")}, stdout, stderr), 1)
+	assert.Equal(t, run([]string{"verify"}, stdout, stderr), 2)
+	assert.Equal(t, run([]string{"verify", "-providers", "xx", path}, stdout, stderr), 2)
+	assert.Equal(t, run([]string{"verify", "-xx"}, stdout, stderr), 2)
+}
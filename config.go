@@ -0,0 +1,774 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ideatocode/doh-go/cache"
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/proxy"
+	"github.com/ideatocode/doh-go/transport"
+)
+
+// Config is the client and proxy config, it is loaded from a yaml or toml file by the config package
+type Config struct {
+	// Providers is the provider names, default all
+	Providers []string `yaml:"providers" toml:"providers"`
+	// Strategy is the provider selecting strategy, only fastest is supported
+	Strategy string `yaml:"strategy" toml:"strategy"`
+	// Format is the message format: auto, json or message, default auto
+	Format string `yaml:"format" toml:"format"`
+	// Parsing is the strictness of parsing the json responses: default, strict or lenient, default default
+	Parsing string `yaml:"parsing" toml:"parsing"`
+	// IDNA is the profile converting the unicode domains to punycode: lookup, strict or registration, default lookup
+	IDNA string `yaml:"idna" toml:"idna"`
+	// Timeout is the max time of a request attempt to provider, default no limit
+	Timeout time.Duration `yaml:"timeout" toml:"timeout"`
+	// MaxConcurrency is the max concurrent queries to providers, the higher priority ones are admitted first,
+	// default no limit
+	MaxConcurrency int `yaml:"max_concurrency" toml:"max_concurrency"`
+	// Proxy is the http or socks5 proxy of providers requests
+	Proxy string `yaml:"proxy" toml:"proxy"`
+	// UserAgent is the User-Agent header of providers requests
+	UserAgent string `yaml:"user_agent" toml:"user_agent"`
+	// Cache is the response cache config
+	Cache CacheConfig `yaml:"cache" toml:"cache"`
+	// Routes is the routing rules querying zones with specific providers
+	Routes []RouteConfig `yaml:"routes" toml:"routes"`
+	// Blocklist is the names and their subdomains answered with NXDOMAIN
+	Blocklist []string `yaml:"blocklist" toml:"blocklist"`
+	// Blocklists is the blocklists of hosts files and adblock lists
+	Blocklists BlocklistsConfig `yaml:"blocklists" toml:"blocklists"`
+	// Allowlist is the names and their subdomains never blocked
+	Allowlist []string `yaml:"allowlist" toml:"allowlist"`
+	// Rewrites is the rewrite rules answering names locally
+	Rewrites []RewriteConfig `yaml:"rewrites" toml:"rewrites"`
+	// Hosts is the hosts table answering names before the rewrite rules
+	Hosts HostsConfig `yaml:"hosts" toml:"hosts"`
+	// DNS64 is the NAT64 prefix synthesizing AAAA answers from A records, for example: 64:ff9b::/96
+	DNS64 string `yaml:"dns64" toml:"dns64"`
+	// ACL is the client networks allowed to query the proxy, default all
+	ACL []string `yaml:"acl" toml:"acl"`
+	// RateLimit is the rate limit of proxy clients
+	RateLimit RateLimitConfig `yaml:"rate_limit" toml:"rate_limit"`
+	// Forwards is the zones of proxy forwarded to plain dns servers instead of providers
+	Forwards []ForwardConfig `yaml:"forwards" toml:"forwards"`
+	// Policies is the client networks of proxy queried with their own providers, routes and filters
+	Policies []PolicyConfig `yaml:"policies" toml:"policies"`
+	// QueryLog is the query log of proxy
+	QueryLog QueryLogConfig `yaml:"query_log" toml:"query_log"`
+	// Listen is the listen addresses of proxy
+	Listen ListenConfig `yaml:"listen" toml:"listen"`
+	// Chaos is the faults injected into the queries for staging, default none
+	Chaos Faults `yaml:"chaos" toml:"chaos"`
+}
+
+// PolicyConfig is the config of client networks, the fields set override the config
+type PolicyConfig struct {
+	// Name is the policy name
+	Name string `yaml:"name" toml:"name"`
+	// Subnets is the client networks, for example: 192.168.2.0/24
+	Subnets []string `yaml:"subnets" toml:"subnets"`
+	// Providers is the provider names
+	Providers []string `yaml:"providers" toml:"providers"`
+	// Routes is the routing rules
+	Routes []RouteConfig `yaml:"routes" toml:"routes"`
+	// Blocklist is the names and their subdomains answered with NXDOMAIN
+	Blocklist []string `yaml:"blocklist" toml:"blocklist"`
+	// Blocklists is the blocklists of hosts files and adblock lists
+	Blocklists BlocklistsConfig `yaml:"blocklists" toml:"blocklists"`
+	// Allowlist is the names and their subdomains never blocked
+	Allowlist []string `yaml:"allowlist" toml:"allowlist"`
+	// Rewrites is the rewrite rules
+	Rewrites []RewriteConfig `yaml:"rewrites" toml:"rewrites"`
+	// DNS64 is the NAT64 prefix
+	DNS64 string `yaml:"dns64" toml:"dns64"`
+}
+
+// QueryLogConfig is the query log config
+type QueryLogConfig struct {
+	// Path is the file path of query log, - for stderr, default disabled
+	Path string `yaml:"path" toml:"path"`
+	// Format is the line format: json or text, default json
+	Format string `yaml:"format" toml:"format"`
+	// MaxSize is the max size in megabytes before the file is rotated, default no limit
+	MaxSize int `yaml:"max_size" toml:"max_size"`
+	// Rotate is the max time before the file is rotated, default no limit
+	Rotate time.Duration `yaml:"rotate" toml:"rotate"`
+	// Backups is the max number of rotated files kept, default all
+	Backups int `yaml:"backups" toml:"backups"`
+}
+
+// HostsConfig is the hosts table config
+type HostsConfig struct {
+	// Files is the hosts files, for example: /etc/hosts
+	Files []string `yaml:"files" toml:"files"`
+	// Entries is the addresses of names overriding the files
+	Entries map[string][]string `yaml:"entries" toml:"entries"`
+	// TTL is the ttl of answers, default 1m
+	TTL time.Duration `yaml:"ttl" toml:"ttl"`
+}
+
+// RateLimitConfig is the rate limit config of each client ip
+type RateLimitConfig struct {
+	// Rate is the max queries per second, default no limit
+	Rate float64 `yaml:"rate" toml:"rate"`
+	// Burst is the max queries in a burst, default the rate
+	Burst int `yaml:"burst" toml:"burst"`
+}
+
+// ForwardConfig is the forwarding rule config
+type ForwardConfig struct {
+	// Zone is the zone forwarded, including its subdomains
+	Zone string `yaml:"zone" toml:"zone"`
+	// Servers is the plain dns servers queried in order, for example: 10.0.0.53 or 10.0.0.53:5353
+	Servers []string `yaml:"servers" toml:"servers"`
+}
+
+// RewriteConfig is the rewrite rule config
+type RewriteConfig struct {
+	// Name is the name, *.zone matches the subdomains of zone
+	Name string `yaml:"name" toml:"name"`
+	// Answers is the IPv4 and IPv6 addresses, or a CNAME target
+	Answers []string `yaml:"answers" toml:"answers"`
+	// TTL is the ttl of answers, it overrides the ttl of queried answers if there is no answers
+	TTL time.Duration `yaml:"ttl" toml:"ttl"`
+}
+
+// BlocklistsConfig is the blocklists config
+type BlocklistsConfig struct {
+	// Sources is the file paths or http(s) urls of hosts files and adblock lists
+	Sources []string `yaml:"sources" toml:"sources"`
+	// Mode is the answer of blocked names: nxdomain or null, default nxdomain
+	Mode string `yaml:"mode" toml:"mode"`
+	// Refresh is the interval of loading the sources again, default no refresh
+	Refresh time.Duration `yaml:"refresh" toml:"refresh"`
+}
+
+// CacheConfig is the response cache config
+type CacheConfig struct {
+	// Enabled is whether to cache the responses
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+	// Shards is the number of shards of the sharded cache for high concurrency, default 0 for a single map
+	Shards int `yaml:"shards" toml:"shards"`
+}
+
+// New returns the cache of config, nil if it is disabled
+func (c CacheConfig) New() cache.Cache {
+	switch {
+	case !c.Enabled:
+		return nil
+	case c.Shards > 0:
+		return cache.NewSharded(c.Shards)
+	default:
+		return cache.NewMemory()
+	}
+}
+
+// matches returns whether the cache is of config, a custom cache set by SetCache matches if enabled
+func (c CacheConfig) matches(r cache.Cache) bool {
+	switch v := r.(type) {
+	case nil:
+		return !c.Enabled
+	case *cache.Memory:
+		return c.Enabled && c.Shards <= 0
+	case *cache.Sharded:
+		return c.Enabled && c.Shards > 0 && v.Shards() == cache.RoundShards(c.Shards)
+	default:
+		return c.Enabled
+	}
+}
+
+// RouteConfig is a routing rule
+type RouteConfig struct {
+	// Zone is the zone of names, for example: example.com
+	Zone string `yaml:"zone" toml:"zone"`
+	// Providers is the provider names querying the zone
+	Providers []string `yaml:"providers" toml:"providers"`
+}
+
+// ListenConfig is the listen addresses of proxy, empty to disable
+type ListenConfig struct {
+	// DNS is the udp and tcp address of plain dns, for example: :53
+	DNS string `yaml:"dns" toml:"dns"`
+	// TLS is the tcp address of dns over tls, for example: :853
+	TLS string `yaml:"tls" toml:"tls"`
+	// DoH is the tcp address of DoH, https if the certificate is set
+	DoH string `yaml:"doh" toml:"doh"`
+	// Admin is the tcp address of admin api, it must be a trusted address, for example: 127.0.0.1:8054
+	Admin string `yaml:"admin" toml:"admin"`
+	// AdminToken is the bearer token required by the admin api changes, required unless admin is a loopback address
+	AdminToken string `yaml:"admin_token" toml:"admin_token"`
+	// Metrics is the tcp address of /healthz and /metrics, for example: :9153
+	Metrics string `yaml:"metrics" toml:"metrics"`
+	// TLSCert is the certificate file of dns over tls and DoH
+	TLSCert string `yaml:"tls_cert" toml:"tls_cert"`
+	// TLSKey is the private key file of dns over tls and DoH
+	TLSKey string `yaml:"tls_key" toml:"tls_key"`
+}
+
+// Validate returns an error if the config is invalid
+func (c *Config) Validate() error {
+	if _, err := parseProviderNames(c.Providers); err != nil {
+		return fmt.Errorf("doh: config: %s", err)
+	}
+
+	switch strings.ToLower(c.Strategy) {
+	case "", "fastest":
+	default:
+		return fmt.Errorf("doh: config: not supported strategy: %s", c.Strategy)
+	}
+
+	if _, err := parseFormat(c.Format); err != nil {
+		return err
+	}
+
+	if _, err := parseParsing(c.Parsing); err != nil {
+		return err
+	}
+
+	if _, err := parseIDNA(c.IDNA); err != nil {
+		return err
+	}
+
+	if c.MaxConcurrency < 0 {
+		return fmt.Errorf("doh: config: invalid max concurrency: %d", c.MaxConcurrency)
+	}
+
+	if c.Cache.Shards < 0 {
+		return fmt.Errorf("doh: config: invalid cache shards: %d", c.Cache.Shards)
+	}
+
+	if c.Proxy != "" {
+		if _, err := transport.ParseProxy(c.Proxy); err != nil {
+			return fmt.Errorf("doh: config: %s", err)
+		}
+	}
+
+	for _, v := range c.Routes {
+		if strings.TrimSpace(v.Zone) == "" {
+			return fmt.Errorf("doh: config: missing zone of route")
+		}
+		ps, err := parseProviderNames(v.Providers)
+		if err != nil {
+			return fmt.Errorf("doh: config: %s", err)
+		}
+		if len(ps) == 0 {
+			return fmt.Errorf("doh: config: missing providers of route: %s", v.Zone)
+		}
+	}
+
+	if _, err := parseBlockMode(c.Blocklists.Mode); err != nil {
+		return err
+	}
+
+	for _, v := range c.Rewrites {
+		if n := normalizeZone(v.Name); n == "" || n == "*" {
+			return fmt.Errorf("doh: config: missing name of rewrite")
+		}
+		r, err := newRewrite(v.TTL, v.Answers)
+		if err != nil {
+			return fmt.Errorf("doh: config: %s", err)
+		}
+		if r == nil {
+			return fmt.Errorf("doh: config: missing answers or ttl of rewrite: %s", v.Name)
+		}
+	}
+
+	if err := c.Hosts.set(NewHosts()); err != nil {
+		return err
+	}
+
+	if c.Hosts.TTL < 0 {
+		return fmt.Errorf("doh: config: negative hosts ttl")
+	}
+
+	if _, err := parseDNS64(c.DNS64); err != nil {
+		return err
+	}
+
+	if _, err := ParseNetworks(c.ACL); err != nil {
+		return err
+	}
+
+	if err := c.Chaos.Validate(); err != nil {
+		return fmt.Errorf("doh: config: %s", err)
+	}
+
+	if c.RateLimit.Rate < 0 || c.RateLimit.Burst < 0 {
+		return fmt.Errorf("doh: config: negative rate limit")
+	}
+
+	for _, v := range c.Forwards {
+		if strings.TrimSpace(v.Zone) == "" {
+			return fmt.Errorf("doh: config: missing zone of forward")
+		}
+		if _, err := proxy.NewForwarder(v.Servers...); err != nil {
+			return fmt.Errorf("doh: config: forward %s: %w", v.Zone, err)
+		}
+	}
+
+	names := map[string]bool{}
+	for _, v := range c.Policies {
+		if strings.TrimSpace(v.Name) == "" {
+			return fmt.Errorf("doh: config: missing name of policy")
+		}
+		if names[v.Name] {
+			return fmt.Errorf("doh: config: duplicate policy: %s", v.Name)
+		}
+		names[v.Name] = true
+		ns, err := ParseNetworks(v.Subnets)
+		if err != nil {
+			return err
+		}
+		if len(ns) == 0 {
+			return fmt.Errorf("doh: config: missing subnets of policy: %s", v.Name)
+		}
+		if err := v.Apply(c).Validate(); err != nil {
+			return fmt.Errorf("doh: config: policy %s: %w", v.Name, err)
+		}
+	}
+
+	switch strings.ToLower(c.QueryLog.Format) {
+	case "", "json", "text":
+	default:
+		return fmt.Errorf("doh: config: not supported query log format: %s", c.QueryLog.Format)
+	}
+
+	if c.QueryLog.MaxSize < 0 || c.QueryLog.Rotate < 0 || c.QueryLog.Backups < 0 {
+		return fmt.Errorf("doh: config: negative query log rotation")
+	}
+
+	if (c.Listen.TLS != "" || c.Listen.TLSCert != "" || c.Listen.TLSKey != "") &&
+		(c.Listen.TLSCert == "" || c.Listen.TLSKey == "") {
+		return fmt.Errorf("doh: config: both tls_cert and tls_key are required")
+	}
+
+	if c.Listen.Admin != "" && c.Listen.AdminToken == "" && !isLoopback(c.Listen.Admin) {
+		return fmt.Errorf("doh: config: admin_token is required by the non-loopback admin address")
+	}
+
+	return nil
+}
+
+// isLoopback returns whether the host of tcp address is a loopback one, an empty host listens on all addresses
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.IsLoopback()
+}
+
+// Apply returns a copy of config overridden by the fields set of policy, without the proxy only acl, rate limit,
+// forwards and policies
+func (p PolicyConfig) Apply(c *Config) *Config {
+	r := *c
+	r.ACL, r.RateLimit, r.Forwards, r.Policies = nil, RateLimitConfig{}, nil, nil
+
+	if len(p.Providers) > 0 {
+		r.Providers = p.Providers
+	}
+
+	if len(p.Routes) > 0 {
+		r.Routes = p.Routes
+	}
+
+	if len(p.Blocklist) > 0 {
+		r.Blocklist = p.Blocklist
+	}
+
+	if len(p.Blocklists.Sources) > 0 {
+		r.Blocklists = p.Blocklists
+	}
+
+	if len(p.Allowlist) > 0 {
+		r.Allowlist = p.Allowlist
+	}
+
+	if len(p.Rewrites) > 0 {
+		r.Rewrites = p.Rewrites
+	}
+
+	if p.DNS64 != "" {
+		r.DNS64 = p.DNS64
+	}
+
+	return &r
+}
+
+// Load returns the hosts table of files and entries, nil if there is no files and entries
+func (h HostsConfig) Load() (*Hosts, error) {
+	if len(h.Files) == 0 && len(h.Entries) == 0 {
+		return nil, nil
+	}
+
+	r := NewHosts().SetTTL(h.TTL)
+	for _, v := range h.Files {
+		f, err := LoadHosts(v)
+		if err != nil {
+			return nil, err
+		}
+		r.Merge(f)
+	}
+
+	if err := h.set(r); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// set set the entries to hosts table
+func (h HostsConfig) set(r *Hosts) error {
+	for k, v := range h.Entries {
+		if len(v) == 0 {
+			return fmt.Errorf("doh: config: missing addresses of hosts entry: %s", k)
+		}
+		if err := r.Set(k, v...); err != nil {
+			return fmt.Errorf("doh: config: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// ParseNetworks returns the networks of cidr or ip addresses, for example: 192.168.1.0/24
+func ParseNetworks(ss []string) ([]netip.Prefix, error) {
+	ns := []netip.Prefix{}
+	for _, v := range ss {
+		v = strings.TrimSpace(v)
+		if addr, err := netip.ParseAddr(v); err == nil {
+			addr = addr.Unmap()
+			ns = append(ns, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		n, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("doh: config: invalid network: %s", v)
+		}
+		ns = append(ns, n.Masked())
+	}
+
+	return ns, nil
+}
+
+// Open returns the query logger of config and the closer of its file, nil if the path is empty,
+// and the closer is nil for stderr
+func (q QueryLogConfig) Open() (QueryLogger, io.Closer, error) {
+	if q.Path == "" {
+		return nil, nil, nil
+	}
+
+	var w io.Writer = os.Stderr
+	var closer io.Closer
+	if q.Path != "-" {
+		f, err := OpenRotatingFile(q.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		f.SetMaxSize(int64(q.MaxSize) << 20).SetInterval(q.Rotate).SetBackups(q.Backups)
+		w, closer = f, f
+	}
+
+	if strings.ToLower(q.Format) == "text" {
+		return NewTextQueryLogger(w), closer, nil
+	}
+
+	return NewJSONQueryLogger(w), closer, nil
+}
+
+// Client returns a new DoH client of config
+func (c *Config) Client() (*DoH, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	ps, _ := parseProviderNames(c.Providers)
+	client := Use(ps...)
+	if err := client.Reload(c); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Reload applies the config to client without dropping the queries in process, the providers kept reuse
+// their connections, the cache entries are kept unless the cache is disabled or its shards change,
+// and the listen config is ignored
+func (c *DoH) Reload(cfg *Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	kinds, _ := parseProviderNames(cfg.Providers)
+	if len(kinds) == 0 {
+		kinds = Providers
+	}
+
+	current, currentKinds := c.list()
+	used := make([]bool, len(current))
+
+	ps := []Provider{}
+	for _, v := range kinds {
+		var p Provider
+		for k, o := range current {
+			if !used[k] && currentKinds[k] == v {
+				p, used[k] = o, true
+				break
+			}
+		}
+		if p == nil {
+			p = New(v)
+		}
+		ps = append(ps, p)
+	}
+
+	hosts, err := cfg.Hosts.Load()
+	if err != nil {
+		return err
+	}
+
+	blocklists, err := c.reloadBlocklists(cfg.Blocklists)
+	if err != nil {
+		return err
+	}
+	mode, _ := parseBlockMode(cfg.Blocklists.Mode)
+
+	rewrites := map[string]*rewrite{}
+	for _, v := range cfg.Rewrites {
+		rewrites[normalizeZone(v.Name)], _ = newRewrite(v.TTL, v.Answers)
+	}
+
+	dns64, _ := parseDNS64(cfg.DNS64)
+	profile, _ := parseIDNA(cfg.IDNA)
+
+	routes := map[string][]int{}
+	for _, v := range cfg.Routes {
+		rs, _ := parseProviderNames(v.Providers)
+		idx := []int{}
+		for k, kind := range kinds {
+			for _, r := range rs {
+				if kind == r {
+					idx = append(idx, k)
+					break
+				}
+			}
+		}
+		if len(idx) > 0 {
+			routes[normalizeZone(v.Zone)] = idx
+		}
+	}
+
+	// nothing is changed until here, so that a failed reload keeps the current settings
+	c.Lock()
+	for _, v := range ps {
+		applyConfig(v, cfg)
+	}
+	if len(blocklists) > 0 {
+		blocklists[0].SetMode(mode)
+		if blocklists[0].refresh != cfg.Blocklists.Refresh {
+			blocklists[0].SetRefresh(cfg.Blocklists.Refresh)
+		}
+	}
+	olds := c.blocklists
+	c.providers = ps
+	c.kinds = kinds
+	c.stats.Store(newRates(ps))
+	c.routes = routes
+	c.blocklist = newZones(cfg.Blocklist)
+	c.blocklists = blocklists
+	c.allowlist = newZones(cfg.Allowlist)
+	c.rewrites = rewrites
+	c.hosts = hosts
+	c.dns64 = dns64
+	c.idna = profile
+	c.Unlock()
+
+	for _, v := range olds {
+		if len(blocklists) == 0 || v != blocklists[0] {
+			v.Close()
+		}
+	}
+
+	c.RLock()
+	rc := c.cache
+	c.RUnlock()
+	if !cfg.Cache.matches(rc) {
+		c.replaceCache(cfg.Cache.New())
+	}
+
+	c.SetMaxConcurrency(cfg.MaxConcurrency)
+	c.SetFaults(cfg.Chaos)
+
+	return nil
+}
+
+// reloadBlocklists returns the blocklists of config, the current one is reused if the sources are not changed,
+// the mode and refresh are set by the caller
+func (c *DoH) reloadBlocklists(cfg BlocklistsConfig) ([]*Blocklist, error) {
+	if len(cfg.Sources) == 0 {
+		return nil, nil
+	}
+
+	c.RLock()
+	current := c.blocklists
+	c.RUnlock()
+
+	if len(current) == 1 && strings.Join(current[0].sources, "\n") == strings.Join(cfg.Sources, "\n") {
+		return current, nil
+	}
+
+	b := NewBlocklist(cfg.Sources...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultBlocklistTimeout)
+	defer cancel()
+
+	if err := b.Load(ctx); err != nil {
+		return nil, err
+	}
+
+	return []*Blocklist{b}, nil
+}
+
+// applyConfig applies the provider settings of config to provider, the config is validated already
+func applyConfig(p Provider, cfg *Config) {
+	if v, ok := p.(formatter); ok {
+		f, _ := parseFormat(cfg.Format)
+		if err := v.SetFormat(f); err != nil {
+			_ = v.SetFormat(dns.FormatAuto)
+		}
+	}
+
+	if v, ok := p.(parser); ok {
+		m, _ := parseParsing(cfg.Parsing)
+		_ = v.SetParsing(m)
+	}
+
+	v, ok := p.(transporter)
+	if !ok {
+		return
+	}
+
+	v.Transport().SetRequestTimeout(cfg.Timeout).SetUserAgent(cfg.UserAgent)
+	_ = v.Transport().SetProxy(cfg.Proxy)
+}
+
+// parseProviderNames returns the providers of names
+func parseProviderNames(names []string) ([]int, error) {
+	ps := []int{}
+	for _, v := range names {
+		p, err := ParseProvider(v)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+
+	return ps, nil
+}
+
+// parseBlockMode returns the block mode of name, nxdomain if empty
+func parseBlockMode(name string) (BlockMode, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "nxdomain":
+		return BlockNXDOMAIN, nil
+	case "null":
+		return BlockNullIP, nil
+	default:
+		return BlockNXDOMAIN, fmt.Errorf("doh: config: not supported block mode: %s", name)
+	}
+}
+
+// parseDNS64 returns the NAT64 prefix of name, the zero prefix if empty
+func parseDNS64(name string) (netip.Prefix, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return netip.Prefix{}, nil
+	}
+
+	prefix, err := netip.ParsePrefix(name)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("doh: config: invalid dns64 prefix: %s", name)
+	}
+
+	if err := checkDNS64(prefix); err != nil {
+		return netip.Prefix{}, fmt.Errorf("doh: config: %s", err)
+	}
+
+	return prefix.Masked(), nil
+}
+
+// parseFormat returns the message format of name, auto if empty
+func parseFormat(name string) (dns.Format, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "auto":
+		return dns.FormatAuto, nil
+	case "json":
+		return dns.FormatJSON, nil
+	case "message":
+		return dns.FormatMessage, nil
+	default:
+		return dns.FormatAuto, fmt.Errorf("doh: config: not supported format: %s", name)
+	}
+}
+
+// parseParsing returns the json parsing mode of name, default if empty
+func parseParsing(name string) (dns.Parsing, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "default":
+		return dns.ParsingDefault, nil
+	case "strict":
+		return dns.ParsingStrict, nil
+	case "lenient":
+		return dns.ParsingLenient, nil
+	default:
+		return dns.ParsingDefault, fmt.Errorf("doh: config: not supported parsing: %s", name)
+	}
+}
+
+// parseIDNA returns the idna profile of name, lookup if empty
+func parseIDNA(name string) (dns.IDNA, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "lookup":
+		return dns.IDNALookup, nil
+	case "strict":
+		return dns.IDNAStrict, nil
+	case "registration":
+		return dns.IDNARegistration, nil
+	default:
+		return dns.IDNALookup, fmt.Errorf("doh: config: not supported idna: %s", name)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ideatocode/doh-go"
+	"gopkg.in/yaml.v3"
+)
+
+// Supported config file formats
+const (
+	YAML = "yaml"
+	TOML = "toml"
+)
+
+// Load returns the config of file, the format is detected by the extension, yaml if unknown
+func Load(path string) (*doh.Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(b, formatOf(path))
+}
+
+// Parse returns the config of data in format, yaml or toml, unknown fields are rejected
+func Parse(b []byte, format string) (*doh.Config, error) {
+	c := &doh.Config{}
+	if err := decode(b, format, c); err != nil {
+		return nil, fmt.Errorf("doh: config: %s", err)
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// LoadExpectations returns the expectations of file, the format is detected by the extension, yaml if not .toml
+func LoadExpectations(path string) (*doh.Expectations, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseExpectations(b, formatOf(path))
+}
+
+// ParseExpectations returns the expectations of data in format, yaml or toml, unknown fields are rejected
+func ParseExpectations(b []byte, format string) (*doh.Expectations, error) {
+	e := &doh.Expectations{}
+	if err := decode(b, format, e); err != nil {
+		return nil, fmt.Errorf("doh: expectations: %s", err)
+	}
+
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// formatOf returns the format of file by the extension, yaml if not .toml
+func formatOf(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		return TOML
+	}
+
+	return YAML
+}
+
+// decode decodes data in format to v, an empty data is decoded as is
+func decode(b []byte, format string, v any) error {
+	switch format {
+	case YAML:
+		d := yaml.NewDecoder(bytes.NewReader(b))
+		d.KnownFields(true)
+		if err := d.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+	case TOML:
+		md, err := toml.NewDecoder(bytes.NewReader(b)).Decode(v)
+		if err != nil {
+			return err
+		}
+		if keys := md.Undecoded(); len(keys) > 0 {
+			return fmt.Errorf("unknown field: %s", keys[0])
+		}
+	default:
+		return fmt.Errorf("not supported format: %s", format)
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/likexian/gokit/assert"
+)
+
+const testYAMLConfig = `
+providers: [google, cloudflare]
+strategy: fastest
+timeout: 2s
+cache:
+  enabled: true
+routes:
+  - zone: corp.example
+    providers: [cloudflare]
+chaos:
+  latency: 1ms
+listen:
+  dns: 127.0.0.1:53
+  tls: :853
+  tls_cert: cert.pem
+  tls_key: key.pem
+`
+
+const testTOMLConfig = `
+providers = ["google", "cloudflare"]
+strategy = "fastest"
+timeout = "2s"
+
+[cache]
+enabled = true
+
+[[routes]]
+zone = "corp.example"
+providers = ["cloudflare"]
+
+[chaos]
+latency = "1ms"
+
+[listen]
+dns = "127.0.0.1:53"
+tls = ":853"
+tls_cert = "cert.pem"
+tls_key = "key.pem"
+`
+
+// testExpectations is the expectations in yaml for testing
+const testExpectations = `
+zone: likexian.com
+records:
+  - name: "@"
+    type: A
+    data: [1.2.3.4]
+  - name: www
+    type: CNAME
+    data: [likexian.com.]
+`
+
+// testExpectationsTOML is the expectations in toml for testing
+const testExpectationsTOML = `
+zone = "likexian.com"
+
+[[records]]
+name = "www"
+type = "CNAME"
+data = ["likexian.com"]
+`
+
+func TestParse(t *testing.T) {
+	expected := &doh.Config{
+		Providers: []string{"google", "cloudflare"},
+		Strategy:  "fastest",
+		Timeout:   2 * time.Second,
+		Cache:     doh.CacheConfig{Enabled: true},
+		Routes:    []doh.RouteConfig{{Zone: "corp.example", Providers: []string{"cloudflare"}}},
+		Chaos:     doh.Faults{Latency: time.Millisecond},
+		Listen:    doh.ListenConfig{DNS: "127.0.0.1:53", TLS: ":853", TLSCert: "cert.pem", TLSKey: "key.pem"},
+	}
+
+	c, err := Parse([]byte(testYAMLConfig), YAML)
+	assert.Nil(t, err)
+	assert.Equal(t, c, expected)
+
+	c, err = Parse([]byte(testTOMLConfig), TOML)
+	assert.Nil(t, err)
+	assert.Equal(t, c, expected)
+
+	c, err = Parse(nil, YAML)
+	assert.Nil(t, err)
+	assert.Equal(t, c, &doh.Config{})
+
+	tests := []struct {
+		data   string
+		format string
+	}{
+		{"providers: [xx]", YAML},
+		{"listen: {tls: ':853'}", YAML},
+		{"listen: {admin: ':8054'}", YAML},
+		{"xx: 1", YAML},
+		{"timeout: xx", YAML},
+		{"xx = 1", TOML},
+		{"providers = 1", TOML},
+		{"providers: [google]", "json"},
+	}
+
+	for _, v := range tests {
+		_, err := Parse([]byte(v.data), v.format)
+		assert.NotNil(t, err, v.data)
+		assert.True(t, strings.HasPrefix(err.Error(), "doh: config:"), v.data)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	for name, data := range map[string]string{"doh.yaml": testYAMLConfig, "doh.TOML": testTOMLConfig} {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.WriteFile(path, []byte(data), 0644))
+		c, err := Load(path)
+		assert.Nil(t, err)
+		assert.Equal(t, c.Providers, []string{"google", "cloudflare"})
+	}
+
+	_, err := Load(filepath.Join(dir, "xx.yaml"))
+	assert.NotNil(t, err)
+}
+
+func TestParseExpectations(t *testing.T) {
+	e, err := ParseExpectations([]byte(testExpectations), YAML)
+	assert.Nil(t, err)
+	assert.Equal(t, e.Zone, "likexian.com")
+	assert.Equal(t, len(e.Records), 2)
+
+	e, err = ParseExpectations([]byte(testExpectationsTOML), TOML)
+	assert.Nil(t, err)
+	assert.Equal(t, e.Records[0].Data, []string{"likexian.com"})
+
+	e, err = ParseExpectations(nil, YAML)
+	assert.Nil(t, err)
+	assert.Equal(t, len(e.Records), 0)
+
+	tests := []struct {
+		in     string
+		format string
+		err    string
+	}{
+		{"zone: likexian.com\nxx: 1\n", YAML, "field xx not found"},
+		{"xx = 1\n", TOML, "unknown field: xx"},
+		{"zone = [\n", TOML, "doh: expectations:"},
+		{"records:\n  - type: A\n", YAML, "name is required without zone"},
+		{"", "json", "not supported format"},
+	}
+
+	for _, v := range tests {
+		_, err := ParseExpectations([]byte(v.in), v.format)
+		assert.Contains(t, err.Error(), v.err, v.in)
+	}
+}
+
+func TestLoadExpectations(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "expect.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(testExpectations), 0o644))
+	e, err := LoadExpectations(path)
+	assert.Nil(t, err)
+	assert.Equal(t, len(e.Records), 2)
+
+	path = filepath.Join(dir, "expect.toml")
+	assert.Nil(t, os.WriteFile(path, []byte(testExpectationsTOML), 0o644))
+	e, err = LoadExpectations(path)
+	assert.Nil(t, err)
+	assert.Equal(t, len(e.Records), 1)
+
+	_, err = LoadExpectations(filepath.Join(dir, "none.yaml"))
+	assert.NotNil(t, err)
+}
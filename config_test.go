@@ -0,0 +1,497 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go/cache"
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+	"gopkg.in/yaml.v3"
+)
+
+const testYAMLConfig = `
+providers: [google, cloudflare]
+strategy: fastest
+format: json
+parsing: strict
+idna: strict
+timeout: 2s
+user_agent: doh-go-test
+cache:
+  enabled: true
+routes:
+  - zone: corp.example
+    providers: [cloudflare]
+blocklist:
+  - ads.example
+chaos:
+  latency: 1ms
+  latency_rate: 0.5
+  seed: 42
+listen:
+  dns: 127.0.0.1:53
+  tls: :853
+  doh: :443
+  admin: 127.0.0.1:8054
+  metrics: :9153
+  tls_cert: cert.pem
+  tls_key: key.pem
+`
+
+// decodeYAML decodes the yaml data to v as the config package does, unknown fields are rejected
+func decodeYAML(s string, v any) error {
+	d := yaml.NewDecoder(strings.NewReader(s))
+	d.KnownFields(true)
+	if err := d.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return nil
+}
+
+// parseConfig returns the validated config of yaml data
+func parseConfig(s string) (*Config, error) {
+	c := &Config{}
+	if err := decodeYAML(s, c); err != nil {
+		return nil, err
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func TestConfigClient(t *testing.T) {
+	_, err := (&Config{Providers: []string{"xx"}}).Client()
+	assert.NotNil(t, err)
+
+	c, err := parseConfig(testYAMLConfig)
+	assert.Nil(t, err)
+
+	client, err := c.Client()
+	assert.Nil(t, err)
+	defer client.Close()
+	assert.Equal(t, client.kinds, []int{GoogleProvider, CloudflareProvider})
+	assert.NotNil(t, client.cache)
+
+	rt, hosts := hostRecorder()
+	client.SetRoundTripper(rt)
+
+	ctx := context.Background()
+	_, err = client.Query(ctx, "www.corp.example", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, hosts(), []string{"cloudflare-dns.com"})
+
+	rsp, err := client.Query(ctx, "ads.example", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Equal(t, rsp.Status, 3)
+	assert.Equal(t, len(hosts()), 0)
+
+	c.Proxy = "socks5://127.0.0.1:1080"
+	client, err = c.Client()
+	assert.Nil(t, err)
+	client.Close()
+}
+
+func TestReload(t *testing.T) {
+	rt, hosts := hostRecorder()
+	c := Use(GoogleProvider, CloudflareProvider).SetRoundTripper(rt).SetFormat(dns.FormatJSON).EnableCache(true)
+	defer c.Close()
+
+	ctx := context.Background()
+	_, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, len(hosts()), 2)
+
+	err = c.Reload(&Config{Providers: []string{"xx"}})
+	assert.NotNil(t, err)
+	assert.Equal(t, c.kinds, []int{GoogleProvider, CloudflareProvider})
+
+	google := c.providers[0]
+	err = c.Reload(&Config{
+		Providers: []string{"google"},
+		Format:    "json",
+		IDNA:      "registration",
+		Cache:     CacheConfig{Enabled: true},
+		Blocklist: []string{"ads.example"},
+		Allowlist: []string{"good.ads.example"},
+		Rewrites:  []RewriteConfig{{Name: "nas.home", Answers: []string{"192.168.1.2"}}},
+		Routes:    []RouteConfig{{Zone: "corp.example", Providers: []string{"google", "cloudflare"}}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, c.kinds, []int{GoogleProvider})
+	assert.True(t, c.providers[0] == google)
+	assert.Equal(t, c.routes, map[string][]int{"corp.example": {0}})
+	assert.Equal(t, c.idna, dns.IDNARegistration)
+
+	rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+	assert.Equal(t, len(hosts()), 0)
+
+	_, err = c.Query(ctx, "www.corp.example", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, hosts(), []string{"dns.google.com"})
+
+	rsp, err = c.Query(ctx, "ads.example", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Equal(t, rsp.Status, 3)
+
+	_, err = c.Query(ctx, "good.ads.example", dns.TypeA)
+	assert.Nil(t, err)
+
+	rsp, err = c.Query(ctx, "nas.home", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "192.168.1.2")
+
+	err = c.Reload(&Config{Providers: []string{"google"}, Chaos: Faults{ErrorRate: 1}})
+	assert.Nil(t, err)
+	_, err = c.Query(ctx, "nas.local", dns.TypeA)
+	assert.True(t, errors.Is(err, ErrInjected))
+
+	err = c.Reload(&Config{Providers: []string{"google", "quad9"}})
+	assert.Nil(t, err)
+	assert.Equal(t, c.kinds, []int{GoogleProvider, Quad9Provider})
+	assert.True(t, c.providers[0] == google)
+	assert.True(t, c.cache == nil)
+	assert.Equal(t, len(c.blocklist), 0)
+	assert.Equal(t, len(c.allowlist), 0)
+	assert.Equal(t, len(c.rewrites), 0)
+
+	path := filepath.Join(t.TempDir(), "hosts.txt")
+	assert.Nil(t, os.WriteFile(path, []byte("0.0.0.0 ads.example\n"), 0644))
+
+	err = c.Reload(&Config{Providers: []string{"google"}, Blocklists: BlocklistsConfig{Sources: []string{path + ".xx"}}})
+	assert.NotNil(t, err)
+	assert.Equal(t, len(c.blocklists), 0)
+
+	err = c.Reload(&Config{Providers: []string{"google"}, Blocklists: BlocklistsConfig{Sources: []string{path}}})
+	assert.Nil(t, err)
+	list := c.blocklists[0]
+
+	rsp, err = c.Query(ctx, "ads.example", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Equal(t, rsp.Status, 3)
+
+	err = c.Reload(&Config{Providers: []string{"google"}, Blocklists: BlocklistsConfig{Sources: []string{path}, Mode: "null"}})
+	assert.Nil(t, err)
+	assert.True(t, c.blocklists[0] == list)
+
+	rsp, err = c.Query(ctx, "ads.example", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "0.0.0.0")
+
+	err = c.Reload(&Config{Providers: []string{"google"}})
+	assert.Nil(t, err)
+	assert.Equal(t, len(c.blocklists), 0)
+}
+
+func TestReloadFailed(t *testing.T) {
+	var mu sync.Mutex
+	agent := ""
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		mu.Lock()
+		agent = r.Header.Get("User-Agent")
+		mu.Unlock()
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body: io.NopCloser(strings.NewReader(
+				`{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`)),
+			Request: r,
+		}, nil
+	})
+
+	c := Use(GoogleProvider).SetRoundTripper(rt)
+	defer c.Close()
+
+	err := c.Reload(&Config{Providers: []string{"google"}, Format: "json", UserAgent: "doh-go-old",
+		Blocklist: []string{"ads.example"}})
+	assert.Nil(t, err)
+
+	path := filepath.Join(t.TempDir(), "hosts.xx")
+	for _, v := range []*Config{
+		{Providers: []string{"google", "quad9"}, UserAgent: "doh-go-new", Hosts: HostsConfig{Files: []string{path}}},
+		{Providers: []string{"google", "quad9"}, UserAgent: "doh-go-new", Blocklists: BlocklistsConfig{
+			Sources: []string{path}}},
+	} {
+		err = c.Reload(v)
+		assert.NotNil(t, err)
+		assert.Equal(t, c.kinds, []int{GoogleProvider})
+
+		_, err = c.Query(context.Background(), "likexian.com", dns.TypeA)
+		assert.Nil(t, err)
+		mu.Lock()
+		assert.Equal(t, agent, "doh-go-old")
+		mu.Unlock()
+
+		rsp, err := c.Query(context.Background(), "ads.example", dns.TypeA)
+		assert.NotNil(t, err)
+		assert.Equal(t, rsp.Status, 3)
+	}
+}
+
+func TestAdminConfig(t *testing.T) {
+	for _, v := range []string{"127.0.0.1:8054", "[::1]:8054", "localhost:8054"} {
+		_, err := parseConfig("listen: {admin: '" + v + "'}")
+		assert.Nil(t, err, v)
+	}
+
+	for _, v := range []string{":8054", "0.0.0.0:8054", "192.168.1.2:8054", "8054"} {
+		_, err := parseConfig("listen: {admin: '" + v + "'}")
+		assert.NotNil(t, err, v)
+		_, err = parseConfig("listen: {admin: '" + v + "', admin_token: secret}")
+		assert.Nil(t, err, v)
+	}
+}
+
+func TestQueryLogConfig(t *testing.T) {
+	l, closer, err := QueryLogConfig{}.Open()
+	assert.Nil(t, err)
+	assert.True(t, l == nil)
+	assert.True(t, closer == nil)
+
+	l, closer, err = QueryLogConfig{Path: "-", Format: "text"}.Open()
+	assert.Nil(t, err)
+	assert.NotNil(t, l.(*TextQueryLogger))
+	assert.True(t, closer == nil)
+
+	path := filepath.Join(t.TempDir(), "query.log")
+	l, closer, err = QueryLogConfig{Path: path, MaxSize: 1, Backups: 2}.Open()
+	assert.Nil(t, err)
+	assert.Equal(t, closer.(*RotatingFile).maxSize, int64(1<<20))
+	l.LogQuery(context.Background(), &QueryLog{Name: "likexian.com", Type: "A"})
+	assert.Nil(t, closer.Close())
+
+	b, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), `"name":"likexian.com"`)
+
+	_, _, err = QueryLogConfig{Path: filepath.Join(path, "x")}.Open()
+	assert.NotNil(t, err)
+}
+
+func TestPolicyConfig(t *testing.T) {
+	c, err := parseConfig(`
+providers: [google]
+blocklist: [ads.example]
+acl: [192.168.0.0/16, 10.0.0.1]
+policies:
+  - name: kids
+    subnets: [192.168.2.0/24]
+    providers: [cloudflare]
+    blocklist: [games.example]
+`)
+	assert.Nil(t, err)
+
+	p := c.Policies[0].Apply(c)
+	assert.Equal(t, p.Providers, []string{"cloudflare"})
+	assert.Equal(t, p.Blocklist, []string{"games.example"})
+	assert.Equal(t, len(p.Policies), 0)
+	assert.Equal(t, len(p.ACL), 0)
+	assert.Equal(t, c.Providers, []string{"google"})
+
+	p = PolicyConfig{Name: "x"}.Apply(c)
+	assert.Equal(t, p.Providers, []string{"google"})
+	assert.Equal(t, p.Blocklist, []string{"ads.example"})
+
+	ns, err := ParseNetworks([]string{"192.168.1.1/24", " 10.0.0.1 ", "::ffff:10.0.0.2", "2001:db8::/32"})
+	assert.Nil(t, err)
+	assert.Equal(t, ns, []netip.Prefix{
+		netip.MustParsePrefix("192.168.1.0/24"),
+		netip.MustParsePrefix("10.0.0.1/32"),
+		netip.MustParsePrefix("10.0.0.2/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	})
+
+	_, err = ParseNetworks([]string{"xx"})
+	assert.NotNil(t, err)
+
+	tests := []string{
+		"acl: [xx]",
+		"policies: [{subnets: [10.0.0.0/8]}]",
+		"policies: [{name: x}]",
+		"policies: [{name: x, subnets: [xx]}]",
+		"policies: [{name: x, subnets: [10.0.0.0/8], providers: [xx]}]",
+		"policies: [{name: x, subnets: [10.0.0.0/8]}, {name: x, subnets: [10.0.0.0/8]}]",
+	}
+
+	for _, v := range tests {
+		_, err := parseConfig(v)
+		assert.NotNil(t, err, v)
+	}
+}
+
+func TestDNS64Config(t *testing.T) {
+	c, err := parseConfig("dns64: 64:ff9b::/96\n" +
+		"policies: [{name: v6, subnets: [fd00::/8], dns64: 2001:db8::/32}]")
+	assert.Nil(t, err)
+	assert.Equal(t, c.Policies[0].Apply(c).DNS64, "2001:db8::/32")
+
+	client, err := c.Client()
+	assert.Nil(t, err)
+	defer client.Close()
+	assert.Equal(t, client.dns64, DefaultDNS64Prefix)
+
+	assert.Nil(t, client.Reload(&Config{}))
+	assert.False(t, client.dns64.IsValid())
+
+	for _, v := range []string{"dns64: xx", "dns64: 64:ff9b::/80", "dns64: 10.0.0.0/8"} {
+		_, err := parseConfig(v)
+		assert.NotNil(t, err, v)
+	}
+}
+
+func TestHostsConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	assert.Nil(t, os.WriteFile(path, []byte("192.168.1.2 nas.home\n192.168.1.3 pc.home\n"), 0644))
+
+	c, err := parseConfig(`
+hosts:
+  files: [` + path + `]
+  entries:
+    nas.home: [10.0.0.2]
+  ttl: 1h
+`)
+	assert.Nil(t, err)
+
+	h, err := c.Hosts.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, h.Lookup("nas.home"), []netip.Addr{netip.MustParseAddr("10.0.0.2")})
+	assert.Equal(t, h.Lookup("pc.home"), []netip.Addr{netip.MustParseAddr("192.168.1.3")})
+	assert.Equal(t, h.ttl, time.Hour)
+
+	client, err := c.Client()
+	assert.Nil(t, err)
+	defer client.Close()
+	assert.NotNil(t, client.hosts)
+
+	assert.Nil(t, client.Reload(&Config{}))
+	assert.True(t, client.hosts == nil)
+
+	c.Hosts.Files = []string{path + ".xx"}
+	assert.NotNil(t, client.Reload(c))
+
+	h, err = HostsConfig{}.Load()
+	assert.Nil(t, err)
+	assert.True(t, h == nil)
+
+	tests := []string{
+		"hosts: {entries: {nas.home: []}}",
+		"hosts: {entries: {nas.home: [xx]}}",
+		"hosts: {entries: {'x y': [10.0.0.1]}}",
+		"hosts: {ttl: -1s}",
+	}
+
+	for _, v := range tests {
+		_, err := parseConfig(v)
+		assert.NotNil(t, err, v)
+	}
+}
+
+func TestForwardConfig(t *testing.T) {
+	c, err := parseConfig(`
+forwards:
+  - zone: corp.example
+    servers: [10.0.0.53, "[fd00::53]:5353"]
+policies:
+  - name: kids
+    subnets: [192.168.2.0/24]
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, c.Forwards[0].Servers, []string{"10.0.0.53", "[fd00::53]:5353"})
+	assert.Equal(t, len(c.Policies[0].Apply(c).Forwards), 0)
+
+	tests := []string{
+		"forwards: [{servers: [10.0.0.53]}]",
+		"forwards: [{zone: corp.example}]",
+		"forwards: [{zone: corp.example, servers: [ns.corp.example]}]",
+	}
+
+	for _, v := range tests {
+		_, err := parseConfig(v)
+		assert.NotNil(t, err, v)
+	}
+}
+
+func TestRateLimitConfig(t *testing.T) {
+	c, err := parseConfig("rate_limit: {rate: 20, burst: 50}\npolicies: [{name: x, subnets: [10.0.0.0/8]}]")
+	assert.Nil(t, err)
+	assert.Equal(t, c.RateLimit, RateLimitConfig{Rate: 20, Burst: 50})
+	assert.Equal(t, c.Policies[0].Apply(c).RateLimit, RateLimitConfig{})
+
+	for _, v := range []string{"rate_limit: {rate: -1}", "rate_limit: {burst: -1}"} {
+		_, err := parseConfig(v)
+		assert.NotNil(t, err, v)
+	}
+}
+
+func TestCacheConfig(t *testing.T) {
+	assert.True(t, CacheConfig{}.New() == nil)
+
+	m := CacheConfig{Enabled: true}.New()
+	defer m.Close()
+	_, ok := m.(*cache.Memory)
+	assert.True(t, ok)
+
+	s := CacheConfig{Enabled: true, Shards: 3}.New()
+	defer s.Close()
+	assert.Equal(t, s.(*cache.Sharded).Shards(), 4)
+
+	assert.True(t, CacheConfig{}.matches(nil))
+	assert.False(t, CacheConfig{Enabled: true}.matches(nil))
+	assert.True(t, CacheConfig{Enabled: true}.matches(m))
+	assert.False(t, CacheConfig{Enabled: true, Shards: 4}.matches(m))
+	assert.True(t, CacheConfig{Enabled: true, Shards: 4}.matches(s))
+	assert.False(t, CacheConfig{Enabled: true, Shards: 8}.matches(s))
+	assert.False(t, CacheConfig{Enabled: true}.matches(s))
+
+	err := (&Config{Cache: CacheConfig{Enabled: true, Shards: -1}}).Validate()
+	assert.NotNil(t, err)
+
+	rt, _ := hostRecorder()
+	c := Use(GoogleProvider).SetRoundTripper(rt).EnableCache(true)
+	defer c.Close()
+
+	current := c.cache
+	assert.Nil(t, c.Reload(&Config{Providers: []string{"google"}, Cache: CacheConfig{Enabled: true}}))
+	assert.True(t, c.cache == current)
+
+	assert.Nil(t, c.Reload(&Config{Providers: []string{"google"}, Cache: CacheConfig{Enabled: true, Shards: 16}}))
+	assert.Equal(t, c.cache.(*cache.Sharded).Shards(), 16)
+
+	custom := struct{ cache.Cache }{cache.NewMemory()}
+	c.SetCache(custom)
+	assert.Nil(t, c.Reload(&Config{Providers: []string{"google"}, Cache: CacheConfig{Enabled: true, Shards: 16}}))
+	assert.True(t, c.cache == cache.Cache(custom))
+}
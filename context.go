@@ -0,0 +1,47 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// WithCorrelationID returns a context with the correlation id, it is propagated into logs, traces and metadata
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return dns.WithCorrelationID(ctx, id)
+}
+
+// CorrelationID returns the correlation id of context, empty if not set
+func CorrelationID(ctx context.Context) string {
+	return dns.CorrelationID(ctx)
+}
+
+// WithFlags returns a context with the query flags, for example to disable dnssec checking
+func WithFlags(ctx context.Context, f dns.Flags) context.Context {
+	return dns.WithFlags(ctx, f)
+}
+
+// WithClientAddr returns a context with the address of client sending the query, it is written to query logs
+func WithClientAddr(ctx context.Context, addr netip.Addr) context.Context {
+	return dns.WithClientAddr(ctx, addr)
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestCorrelationID(t *testing.T) {
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body: ioutil.NopCloser(strings.NewReader(
+				`{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`)),
+			Request: r,
+		}, nil
+	})
+
+	buf := &bytes.Buffer{}
+	logs := []*QueryLog{}
+	c := Use(GoogleProvider).SetRoundTripper(rt).EnableCache(true).
+		SetLogger(slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))).
+		SetQueryLogger(QueryLoggerFunc(func(ctx context.Context, l *QueryLog) {
+			logs = append(logs, l)
+		}))
+	defer c.Close()
+
+	ctx := WithCorrelationID(context.Background(), "req-1")
+	assert.Equal(t, CorrelationID(ctx), "req-1")
+
+	rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Metadata.CorrelationID, "req-1")
+
+	cached, err := c.Query(WithCorrelationID(context.Background(), "req-2"), "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, cached.Metadata.CorrelationID, "req-2")
+	assert.Equal(t, rsp.Metadata.CorrelationID, "req-1")
+	assert.Equal(t, cached.Answer, rsp.Answer)
+
+	assert.Equal(t, logs[0].CorrelationID, "req-1")
+	assert.Equal(t, logs[1].CorrelationID, "req-2")
+	assert.Contains(t, buf.String(), `msg="doh: query" provider=google name=likexian.com type=A rcode=0`)
+	assert.Contains(t, buf.String(), "correlation_id=req-1")
+	assert.Contains(t, buf.String(), "correlation_id=req-2")
+}
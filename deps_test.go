@@ -0,0 +1,50 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestDependencies(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command is not found")
+	}
+
+	b, err := exec.Command("go", "list", "-deps", "-f", "{{if not .Standard}}{{.ImportPath}}{{end}}", ".").Output()
+	assert.Nil(t, err)
+
+	// golang.org/x/text is required by golang.org/x/net/idna
+	allowed := []string{"github.com/ideatocode/doh-go", "golang.org/x/net", "golang.org/x/text"}
+	for _, v := range strings.Fields(string(b)) {
+		ok := false
+		for _, p := range allowed {
+			if v == p || strings.HasPrefix(v, p+"/") {
+				ok = true
+				break
+			}
+		}
+		assert.True(t, ok, "unexpected dependency: "+v)
+	}
+}
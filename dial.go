@@ -0,0 +1,168 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// DefaultFallbackDelay is the delay of Happy Eyeballs before dialing the next address if the current has not
+// connected, as the connection attempt delay of RFC 8305
+const DefaultFallbackDelay = 250 * time.Millisecond
+
+// DialFunc is the func dialing a connection, for example net.Dialer.DialContext
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// WrapDialContext returns a dial func resolving the host of address with the client before dialing with dial,
+// nil dial to use a net.Dialer, the addresses are dialed with Happy Eyeballs, so that an http client bypasses
+// the system resolver with &http.Transport{DialContext: c.WrapDialContext(nil)}
+func (c *DoH) WrapDialContext(dial DialFunc) DialFunc {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if ip := net.ParseIP(host); ip != nil {
+			return dial(ctx, network, addr)
+		}
+
+		ips, err := c.LookupIP(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		ips = filterIPs(network, ips)
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("doh: no %s address found for %s", network, host)
+		}
+
+		return happyEyeballs(ctx, dial, network, interleaveIPs(ips), port, DefaultFallbackDelay)
+	}
+}
+
+// filterIPs returns the ips of the network family, all ips if the network is of both families
+func filterIPs(network string, ips []net.IP) []net.IP {
+	v4, v6 := strings.HasSuffix(network, "4"), strings.HasSuffix(network, "6")
+	if !v4 && !v6 {
+		return ips
+	}
+
+	rs := []net.IP{}
+	for _, v := range ips {
+		if (v.To4() != nil) == v4 {
+			rs = append(rs, v)
+		}
+	}
+
+	return rs
+}
+
+// interleaveIPs returns the ips interleaving the families starting from ipv6, the order of a family is kept
+func interleaveIPs(ips []net.IP) []net.IP {
+	v4, v6 := []net.IP{}, []net.IP{}
+	for _, v := range ips {
+		if v.To4() != nil {
+			v4 = append(v4, v)
+		} else {
+			v6 = append(v6, v)
+		}
+	}
+
+	rs := []net.IP{}
+	for i := 0; i < max(len(v4), len(v6)); i++ {
+		if i < len(v6) {
+			rs = append(rs, v6[i])
+		}
+		if i < len(v4) {
+			rs = append(rs, v4[i])
+		}
+	}
+
+	return rs
+}
+
+// happyEyeballs dials the ips in order, the next is dialed if the current has not connected after delay or
+// failed, returns the first connection, and the later connections are closed
+func happyEyeballs(ctx context.Context, dial DialFunc, network string, ips []net.IP, port string,
+	delay time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+
+	results := make(chan result, len(ips))
+	started, failed := 0, 0
+	start := func() {
+		addr := net.JoinHostPort(ips[started].String(), port)
+		started++
+		go func() {
+			conn, err := dial(ctx, network, addr)
+			results <- result{conn, err}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var err error
+	for {
+		select {
+		case r := <-results:
+			if r.err == nil {
+				go func(n int) {
+					for i := 0; i < n; i++ {
+						if v := <-results; v.conn != nil {
+							v.conn.Close()
+						}
+					}
+				}(started - failed - 1)
+				return r.conn, nil
+			}
+			failed++
+			if err == nil {
+				err = r.err
+			}
+			if started < len(ips) {
+				start()
+				timer.Reset(delay)
+			} else if failed == started {
+				return nil, err
+			}
+		case <-timer.C:
+			if started < len(ips) {
+				start()
+				timer.Reset(delay)
+			}
+		}
+	}
+}
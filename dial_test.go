@@ -0,0 +1,128 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestWrapDialContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	c := Use(GoogleProvider).SetBlocklist("ads.example")
+	defer c.Close()
+	assert.Nil(t, c.AddRewrite("svc.home", 0, "127.0.0.1"))
+
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{DialContext: c.WrapDialContext(nil)}}
+	rsp, err := client.Get("http://svc.home:" + port)
+	assert.Nil(t, err)
+	rsp.Body.Close()
+	assert.Equal(t, rsp.StatusCode, http.StatusOK)
+
+	ctx := context.Background()
+	dial := c.WrapDialContext(nil)
+	conn, err := dial(ctx, "tcp", ts.Listener.Addr().String())
+	assert.Nil(t, err)
+	conn.Close()
+
+	_, err = dial(ctx, "tcp", "svc.home")
+	assert.NotNil(t, err)
+	_, err = dial(ctx, "tcp", "ads.example:80")
+	assert.NotNil(t, err)
+	_, err = dial(ctx, "tcp6", "svc.home:"+port)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no tcp6 address found")
+}
+
+func TestHappyEyeballs(t *testing.T) {
+	ctx := context.Background()
+	ips := []net.IP{net.ParseIP("2001::1"), net.ParseIP("1.1.1.1"), net.ParseIP("1.0.0.1")}
+
+	var closed atomic.Int32
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		switch {
+		case strings.HasPrefix(addr, "[2001::1]"):
+			<-ctx.Done()
+			return nil, ctx.Err()
+		case strings.HasPrefix(addr, "1.0.0.1"):
+			return nil, errors.New("refused")
+		default:
+			a, b := net.Pipe()
+			go func() {
+				_, _ = b.Read(make([]byte, 1))
+				closed.Add(1)
+			}()
+			return a, nil
+		}
+	}
+
+	conn, err := happyEyeballs(ctx, dial, "tcp", ips, "80", 10*time.Millisecond)
+	assert.Nil(t, err)
+	conn.Close()
+
+	_, err = happyEyeballs(ctx, dial, "tcp", ips[2:], "80", 10*time.Millisecond)
+	assert.Equal(t, err.Error(), "refused")
+
+	cctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = happyEyeballs(cctx, dial, "tcp", ips[:1], "80", time.Millisecond)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// the slower connections are closed once the first is returned
+	slow := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if strings.HasPrefix(addr, "1.0.0.1") {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return dial(ctx, network, "1.1.1.1:80")
+	}
+	conn, err = happyEyeballs(ctx, slow, "tcp", []net.IP{net.ParseIP("1.0.0.1"), net.ParseIP("1.1.1.1")}, "80",
+		time.Millisecond)
+	assert.Nil(t, err)
+	conn.Close()
+	for closed.Load() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestInterleaveIPs(t *testing.T) {
+	ips := []net.IP{net.ParseIP("1.1.1.1"), net.ParseIP("1.0.0.1"), net.ParseIP("8.8.8.8"),
+		net.ParseIP("2001::1"), net.ParseIP("2001::2")}
+
+	assert.Equal(t, interleaveIPs(ips), []net.IP{net.ParseIP("2001::1"), net.ParseIP("1.1.1.1"),
+		net.ParseIP("2001::2"), net.ParseIP("1.0.0.1"), net.ParseIP("8.8.8.8")})
+
+	assert.Equal(t, filterIPs("tcp", ips), ips)
+	assert.Equal(t, filterIPs("tcp4", ips), ips[:3])
+	assert.Equal(t, filterIPs("udp6", ips), ips[3:])
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// DiscoverService returns the ready to dial host:port addresses of the service, in the order to try, it looks up
+// the SRV records of _service._proto.domain, or domain if both service and proto are empty, like net.LookupSRV,
+// the records are ordered by priority and weighted randomly as RFC 2782, and the targets are resolved with
+// the ipv6 and ipv4 addresses interleaved, the ones failed to resolve are skipped
+func (c *DoH) DiscoverService(ctx context.Context, service, proto string, d dns.Domain) ([]string, error) {
+	name := d
+	if service != "" || proto != "" {
+		name = dns.Domain("_" + service + "._" + proto + "." + string(d))
+	}
+
+	srvs, err := Lookup[dns.SRV](ctx, c, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(srvs) == 1 && strings.TrimSuffix(srvs[0].Target, ".") == "" {
+		return nil, fmt.Errorf("doh: service is not available at %s", name)
+	}
+
+	srvs = sortSRV(srvs)
+
+	addrs := make([][]string, len(srvs))
+	errs := make([]error, len(srvs))
+	wg := sync.WaitGroup{}
+	for k, v := range srvs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			port := strconv.Itoa(int(v.Port))
+			if ip := net.ParseIP(strings.TrimSuffix(v.Target, ".")); ip != nil {
+				addrs[k] = []string{net.JoinHostPort(ip.String(), port)}
+				return
+			}
+			ips, err := c.LookupIP(ctx, dns.Canonical(v.Target))
+			if err != nil {
+				errs[k] = err
+				return
+			}
+			for _, ip := range interleaveIPs(ips) {
+				addrs[k] = append(addrs[k], net.JoinHostPort(ip.String(), port))
+			}
+		}()
+	}
+	wg.Wait()
+
+	rs := slices.Concat(addrs...)
+	if len(rs) == 0 {
+		for _, v := range errs {
+			if v != nil {
+				return nil, v
+			}
+		}
+		return nil, fmt.Errorf("doh: no address found for %s", name)
+	}
+
+	return rs, nil
+}
+
+// sortSRV returns the srv records ordered by priority, and weighted randomly in a priority as RFC 2782,
+// the records of weight 0 are placed first, so that they have a small chance to be selected before the others
+func sortSRV(srvs []dns.SRV) []dns.SRV {
+	rs := slices.Clone(srvs)
+	slices.SortStableFunc(rs, func(a, b dns.SRV) int {
+		if a.Priority != b.Priority {
+			return int(a.Priority) - int(b.Priority)
+		}
+		return min(int(a.Weight), 1) - min(int(b.Weight), 1)
+	})
+
+	for i := 0; i < len(rs); {
+		j := i + 1
+		for j < len(rs) && rs[j].Priority == rs[i].Priority {
+			j++
+		}
+		shuffleSRV(rs[i:j])
+		i = j
+	}
+
+	return rs
+}
+
+// shuffleSRV orders the srv records of a priority weighted randomly, each is selected by the running sum of weights
+func shuffleSRV(srvs []dns.SRV) {
+	sum := 0
+	for _, v := range srvs {
+		sum += int(v.Weight)
+	}
+
+	for i := range srvs {
+		if sum == 0 {
+			rand.Shuffle(len(srvs)-i, func(a, b int) {
+				srvs[i+a], srvs[i+b] = srvs[i+b], srvs[i+a]
+			})
+			return
+		}
+		n := rand.IntN(sum + 1)
+		for j := i; j < len(srvs); j++ {
+			n -= int(srvs[j].Weight)
+			if n <= 0 || j == len(srvs)-1 {
+				srvs[i], srvs[j] = srvs[j], srvs[i]
+				sum -= int(srvs[i].Weight)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/dohtest"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestDiscoverService(t *testing.T) {
+	p := dohtest.New("fake")
+	p.Answer("_sip._tcp.likexian.com", dns.TypeSRV, "20 0 5060 backup.likexian.com.", "10 0 5061 sip.likexian.com.")
+	p.Answer("sip.likexian.com", dns.TypeA, "1.1.1.1", "1.1.1.2")
+	p.Answer("sip.likexian.com", dns.TypeAAAA, "2001:db8::1")
+	p.Answer("backup.likexian.com", dns.TypeA, "2.2.2.2")
+	p.On("backup.likexian.com", dns.TypeAAAA)
+	p.Answer("_ldap._udp.likexian.com", dns.TypeSRV, "0 0 389 gone.likexian.com.", "0 0 389 10.0.0.1.")
+	p.On("gone.likexian.com", "").Error(errors.New("injected"))
+	p.Answer("_none._tcp.likexian.com", dns.TypeSRV, "0 0 0 .")
+	p.Answer("_down._tcp.likexian.com", dns.TypeSRV, "0 0 80 gone.likexian.com.")
+	p.Answer("likexian.org", dns.TypeSRV, "0 0 443 10.0.0.2")
+
+	c := UseProviders(p)
+	defer c.Close()
+
+	ctx := context.Background()
+	addrs, err := c.DiscoverService(ctx, "sip", "tcp", "likexian.com")
+	assert.Nil(t, err)
+	assert.Equal(t, addrs, []string{"[2001:db8::1]:5061", "1.1.1.1:5061", "1.1.1.2:5061", "2.2.2.2:5060"})
+
+	addrs, err = c.DiscoverService(ctx, "ldap", "udp", "likexian.com")
+	assert.Nil(t, err)
+	assert.Equal(t, addrs, []string{"10.0.0.1:389"})
+
+	addrs, err = c.DiscoverService(ctx, "", "", "likexian.org")
+	assert.Nil(t, err)
+	assert.Equal(t, addrs, []string{"10.0.0.2:443"})
+
+	_, err = c.DiscoverService(ctx, "none", "tcp", "likexian.com")
+	assert.Contains(t, err.Error(), "service is not available")
+
+	_, err = c.DiscoverService(ctx, "down", "tcp", "likexian.com")
+	assert.NotNil(t, err)
+
+	_, err = c.DiscoverService(ctx, "xmpp", "tcp", "likexian.com")
+	assert.NotNil(t, err)
+}
+
+func TestSortSRV(t *testing.T) {
+	srvs := []dns.SRV{
+		{Priority: 20, Weight: 1, Target: "c."},
+		{Priority: 10, Weight: 0, Target: "zero."},
+		{Priority: 10, Weight: 100, Target: "heavy."},
+		{Priority: 5, Weight: 0, Target: "a."},
+	}
+
+	heavy := 0
+	for range 1000 {
+		rs := sortSRV(srvs)
+		assert.Equal(t, len(rs), 4)
+		assert.Equal(t, rs[0].Target, "a.")
+		assert.Equal(t, rs[3].Target, "c.")
+		if rs[1].Target == "heavy." {
+			heavy++
+		}
+	}
+	assert.True(t, heavy > 950, heavy)
+	assert.Equal(t, srvs[0].Target, "c.")
+
+	seen := map[string]int{}
+	for range 1000 {
+		rs := sortSRV([]dns.SRV{{Target: "a."}, {Target: "b."}})
+		seen[rs[0].Target]++
+	}
+	assert.True(t, seen["a."] > 0 && seen["b."] > 0)
+
+	assert.Equal(t, sortSRV([]dns.SRV{}), []dns.SRV{})
+}
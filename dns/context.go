@@ -0,0 +1,161 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"context"
+	"net/netip"
+)
+
+// correlationKey is the context key of correlation id
+type correlationKey struct{}
+
+// flagsKey is the context key of query flags
+type flagsKey struct{}
+
+// clientKey is the context key of client address
+type clientKey struct{}
+
+// priorityKey is the context key of query priority
+type priorityKey struct{}
+
+// providerKey is the context key of provider override
+type providerKey struct{}
+
+// Priority is the priority class of query, the lower ones yield to the higher under contention
+type Priority int
+
+// Supported priority classes
+const (
+	// PriorityLow is for background work, for example prefetch and batch scans
+	PriorityLow Priority = iota - 1
+	// PriorityNormal is the default priority
+	PriorityNormal
+	// PriorityHigh is for interactive lookups
+	PriorityHigh
+)
+
+// Flags is the dns header flags and edns0 options of query, they are ignored by the providers not supporting them
+type Flags struct {
+	// CD is checking disabled, the resolver does not validate dnssec
+	CD bool
+	// DO is dnssec ok, the resolver returns the dnssec records
+	DO bool
+	// NoRD clears recursion desired, the server answers from its own data, for example an authoritative server,
+	// it is sent in the wire format, the providers without the NoRD capability fail the query
+	NoRD bool
+	// Chaos queries the CHAOS class instead of the internet one, for example id.server TXT of the server identity,
+	// it is honored in the wire format only
+	Chaos bool
+}
+
+// WithCorrelationID returns a context with the correlation id, it is propagated into logs, traces and metadata
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the correlation id of context, empty if not set
+func CorrelationID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	id, _ := ctx.Value(correlationKey{}).(string)
+
+	return id
+}
+
+// WithFlags returns a context with the query flags
+func WithFlags(ctx context.Context, f Flags) context.Context {
+	return context.WithValue(ctx, flagsKey{}, f)
+}
+
+// FlagsOf returns the query flags of context, zero value if not set
+func FlagsOf(ctx context.Context) Flags {
+	if ctx == nil {
+		return Flags{}
+	}
+
+	f, _ := ctx.Value(flagsKey{}).(Flags)
+
+	return f
+}
+
+// WithClientAddr returns a context with the address of client sending the query, for example by a proxy
+func WithClientAddr(ctx context.Context, addr netip.Addr) context.Context {
+	return context.WithValue(ctx, clientKey{}, addr.Unmap())
+}
+
+// ClientAddr returns the client address of context, the invalid zero value if not set
+func ClientAddr(ctx context.Context) netip.Addr {
+	if ctx == nil {
+		return netip.Addr{}
+	}
+
+	addr, _ := ctx.Value(clientKey{}).(netip.Addr)
+
+	return addr
+}
+
+// String returns string of priority
+func (p Priority) String() string {
+	switch {
+	case p < PriorityNormal:
+		return "low"
+	case p > PriorityNormal:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+// WithPriority returns a context with the query priority
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityOf returns the query priority of context, PriorityNormal if not set,
+// the values out of range are clamped to PriorityLow and PriorityHigh
+func PriorityOf(ctx context.Context) Priority {
+	if ctx == nil {
+		return PriorityNormal
+	}
+
+	p, _ := ctx.Value(priorityKey{}).(Priority)
+
+	return min(max(p, PriorityLow), PriorityHigh)
+}
+
+// WithProvider returns a context querying the providers of names only, for example: cloudflare,
+// it overrides the routing and fastest provider selection of client for the call, no names to clear it
+func WithProvider(ctx context.Context, names ...string) context.Context {
+	return context.WithValue(ctx, providerKey{}, append([]string(nil), names...))
+}
+
+// ProvidersOf returns the provider names of context, nil if not set
+func ProvidersOf(ctx context.Context) []string {
+	if ctx == nil {
+		return nil
+	}
+
+	names, _ := ctx.Value(providerKey{}).([]string)
+
+	return names
+}
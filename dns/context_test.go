@@ -0,0 +1,82 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestCorrelationID(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, CorrelationID(ctx), "")
+	assert.Equal(t, CorrelationID(nil), "")
+
+	ctx = WithCorrelationID(ctx, "req-1")
+	assert.Equal(t, CorrelationID(ctx), "req-1")
+	assert.Equal(t, CorrelationID(WithCorrelationID(ctx, "req-2")), "req-2")
+}
+
+func TestFlags(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, FlagsOf(ctx), Flags{})
+	assert.Equal(t, FlagsOf(nil), Flags{})
+
+	ctx = WithFlags(ctx, Flags{CD: true, DO: true})
+	assert.Equal(t, FlagsOf(ctx), Flags{CD: true, DO: true})
+}
+
+func TestClientAddr(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, ClientAddr(ctx).IsValid())
+	assert.False(t, ClientAddr(nil).IsValid())
+
+	ctx = WithClientAddr(ctx, netip.MustParseAddr("::ffff:192.168.1.2"))
+	assert.Equal(t, ClientAddr(ctx), netip.MustParseAddr("192.168.1.2"))
+}
+
+func TestPriority(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, PriorityOf(ctx), PriorityNormal)
+	assert.Equal(t, PriorityOf(nil), PriorityNormal)
+
+	assert.Equal(t, PriorityOf(WithPriority(ctx, PriorityLow)), PriorityLow)
+	assert.Equal(t, PriorityOf(WithPriority(ctx, PriorityHigh)), PriorityHigh)
+	assert.Equal(t, PriorityOf(WithPriority(ctx, 9)), PriorityHigh)
+	assert.Equal(t, PriorityOf(WithPriority(ctx, -9)), PriorityLow)
+
+	assert.Equal(t, PriorityLow.String(), "low")
+	assert.Equal(t, PriorityNormal.String(), "normal")
+	assert.Equal(t, PriorityHigh.String(), "high")
+}
+
+func TestWithProvider(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, len(ProvidersOf(ctx)), 0)
+	assert.Equal(t, len(ProvidersOf(nil)), 0)
+
+	names := []string{"cloudflare", "quad9"}
+	ctx = WithProvider(ctx, names...)
+	names[0] = "google"
+	assert.Equal(t, ProvidersOf(ctx), []string{"cloudflare", "quad9"})
+}
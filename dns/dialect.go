@@ -0,0 +1,143 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FieldFunc decodes the value of a provider specific json field into response
+type FieldFunc func(rr *Response, value json.RawMessage) error
+
+// Dialect is the json api dialect of a provider, it maps the fields in provider specific formats onto Response
+// by name, the others are decoded in the canonical format
+type Dialect map[string]FieldFunc
+
+// DecodeReader returns the response decoded from r in the dialect and parsing mode, the field names are case
+// insensitive, and the errors of fields decoded in the canonical format are reported as Parsing.DecodeReader
+func (d Dialect) DecodeReader(contentType string, r io.Reader, p Parsing) (*Response, error) {
+	if FormatOf(contentType) == FormatMessage || len(d) == 0 {
+		return p.DecodeReader(contentType, r)
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	body := b
+	if p == ParsingLenient {
+		if i := bytes.IndexByte(b, '{'); i > 0 {
+			body = b[i:]
+		}
+	}
+
+	m := map[string]json.RawMessage{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if err := dec.Decode(&m); err != nil {
+		return p.DecodeReader(contentType, bytes.NewReader(b))
+	}
+
+	if _, err := dec.Token(); p == ParsingStrict && err != io.EOF {
+		return p.DecodeReader(contentType, bytes.NewReader(b))
+	}
+
+	fields := map[string]json.RawMessage{}
+	for k, v := range m {
+		for name := range d {
+			if strings.EqualFold(k, name) {
+				fields[name] = v
+				delete(m, k)
+				break
+			}
+		}
+	}
+
+	if len(fields) == 0 {
+		return p.DecodeReader(contentType, bytes.NewReader(b))
+	}
+
+	canonical, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	rr, err := p.DecodeReader(contentType, bytes.NewReader(canonical))
+	if err != nil {
+		return nil, err
+	}
+
+	for name, v := range fields {
+		if err := d[name](rr, v); err != nil && p != ParsingLenient {
+			return nil, fmt.Errorf("doh: dns: invalid %s: %w", name, err)
+		}
+	}
+
+	return rr, nil
+}
+
+// CommentField decodes the comment in a string or an array of strings, for example the extended dns errors
+func CommentField(rr *Response, value json.RawMessage) error {
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		rr.Comment = s
+		return nil
+	}
+
+	var ss []string
+	if err := json.Unmarshal(value, &ss); err != nil {
+		return err
+	}
+
+	rr.Comment = strings.Join(ss, "; ")
+
+	return nil
+}
+
+// ECSField decodes the echoed edns0-client-subnet in the address/source or address/source/scope format,
+// the scope prefix length is dropped
+func ECSField(rr *Response, value json.RawMessage) error {
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return err
+	}
+
+	if s = strings.TrimSpace(s); s == "" {
+		return nil
+	}
+
+	parts := strings.Split(s, "/")
+	if len(parts) > 3 {
+		return fmt.Errorf("doh: dns: invalid ecs: %s", clip(s))
+	}
+
+	ecs, err := ECS(strings.Join(parts[:min(len(parts), 2)], "/")).Subnet()
+	if err != nil {
+		return err
+	}
+
+	rr.ECS = ECS(ecs)
+
+	return nil
+}
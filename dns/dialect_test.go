@@ -0,0 +1,115 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestDialect(t *testing.T) {
+	d := Dialect{
+		"Comment":            CommentField,
+		"edns_client_subnet": ECSField,
+	}
+
+	decode := func(s string, p Parsing) (*Response, error) {
+		return d.DecodeReader(ContentTypeJSON, strings.NewReader(s), p)
+	}
+
+	body := `{"Status":0,"comment":["EDE(10): RRSIGs Missing","x"],"edns_client_subnet":"1.2.3.0/24/0",
+		"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`
+	for _, p := range []Parsing{ParsingDefault, ParsingStrict, ParsingLenient} {
+		rsp, err := decode(body, p)
+		assert.Nil(t, err, p)
+		assert.Equal(t, rsp.Comment, "EDE(10): RRSIGs Missing; x")
+		assert.Equal(t, rsp.ECS, ECS("1.2.3.0/24"))
+		assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+	}
+
+	rsp, err := decode(`{"Status":2,"Comment":"Response from 1.1.1.1."}`, ParsingStrict)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Status, 2)
+	assert.Equal(t, rsp.Comment, "Response from 1.1.1.1.")
+
+	rsp, err = decode(`{"Status":0}`, ParsingStrict)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Comment, "")
+
+	rsp, err = decode(`garbage{"Status":"0","Comment":1}garbage`, ParsingLenient)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Comment, "")
+
+	_, err = decode(`{"Status":0,"Comment":1}`, ParsingDefault)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid Comment")
+
+	_, err = decode(`{"Status":0,"Comment":"x"}garbage`, ParsingStrict)
+	assert.Contains(t, err.Error(), "trailing data")
+
+	_, err = decode(`{"Status":0,"Comment":"x","Garbage":1}`, ParsingStrict)
+	assert.Contains(t, err.Error(), `unknown field "Garbage"`)
+
+	_, err = decode(`xx`, ParsingDefault)
+	assert.NotNil(t, err)
+
+	b, err := NewQuery("likexian.com", TypeA, "", Flags{})
+	assert.Nil(t, err)
+	rsp, err = d.DecodeReader(ContentTypeMessage, strings.NewReader(string(b)), ParsingStrict)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Question[0].Name, "likexian.com.")
+
+	rsp, err = Dialect(nil).DecodeReader(ContentTypeJSON, strings.NewReader(`{"Status":0,"Comment":"x"}`), ParsingStrict)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Comment, "x")
+}
+
+func TestECSField(t *testing.T) {
+	tests := []struct {
+		in  string
+		out ECS
+	}{
+		{`""`, ""},
+		{`"1.2.3.4"`, "1.2.3.4/24"},
+		{`"1.2.3.0/24"`, "1.2.3.0/24"},
+		{`"1.2.3.0/24/0"`, "1.2.3.0/24"},
+		{`"2001:db8::/56/48"`, "2001:db8::/56"},
+	}
+
+	for _, v := range tests {
+		rr := &Response{}
+		assert.Nil(t, ECSField(rr, json.RawMessage(v.in)), v.in)
+		assert.Equal(t, rr.ECS, v.out)
+	}
+
+	for _, v := range []string{`1`, `"x"`, `"1.2.3.0/33"`, `"1.2.3.0/24/0/0"`} {
+		assert.NotNil(t, ECSField(&Response{}, json.RawMessage(v)), v)
+	}
+
+	rr := &Response{}
+	assert.Nil(t, CommentField(rr, json.RawMessage(`null`)))
+	assert.Nil(t, CommentField(rr, json.RawMessage(`["a"]`)))
+	assert.Equal(t, rr.Comment, "a")
+	assert.NotNil(t, CommentField(rr, json.RawMessage(fmt.Sprint(1))))
+}
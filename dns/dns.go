@@ -20,7 +20,14 @@
 package dns
 
 import (
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/netip"
+	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/net/idna"
 )
@@ -34,18 +41,23 @@ type Type string
 // ECS is the edns0-client-subnet option, for example: 1.2.3.4/24
 type ECS string
 
-// Question is dns query question
+// IDNA is the profile converting the unicode domains to punycode
+type IDNA int
+
+// Question is dns query question, the unicode is the name converted from punycode if it is an idn
 type Question struct {
-	Name string `json:"name"`
-	Type int    `json:"type"`
+	Name    string `json:"name"`
+	Type    int    `json:"type"`
+	Unicode string `json:"unicode,omitempty"`
 }
 
-// Answer is dns query answer
+// Answer is dns query answer, the unicode is the name converted from punycode if it is an idn
 type Answer struct {
-	Name string `json:"name"`
-	Type int    `json:"type"`
-	TTL  int    `json:"TTL"`
-	Data string `json:"data"`
+	Name    string `json:"name"`
+	Type    int    `json:"type"`
+	TTL     int    `json:"TTL"`
+	Data    string `json:"data"`
+	Unicode string `json:"unicode,omitempty"`
 }
 
 // Response is dns query response
@@ -58,7 +70,32 @@ type Response struct {
 	CD       bool       `json:"CD"`
 	Question []Question `json:"Question"`
 	Answer   []Answer   `json:"Answer"`
+	Comment  string     `json:"Comment,omitempty"`
+	ECS      ECS        `json:"edns_client_subnet,omitempty"`
 	Provider string     `json:"provider"`
+	Metadata *Metadata  `json:"metadata,omitempty"`
+}
+
+// Metadata is the upstream http metadata of response
+type Metadata struct {
+	StatusCode    int         `json:"status_code"`
+	Protocol      string      `json:"protocol"`
+	Header        http.Header `json:"header,omitempty"`
+	Upstream      string      `json:"upstream"`
+	RemoteAddr    string      `json:"remote_addr,omitempty"`
+	Timing        *Timing     `json:"timing,omitempty"`
+	CorrelationID string      `json:"correlation_id,omitempty"`
+	Truncated     bool        `json:"truncated,omitempty"`
+}
+
+// Timing is the timing breakdown of upstream request
+type Timing struct {
+	DNS     time.Duration `json:"dns"`
+	Connect time.Duration `json:"connect"`
+	TLS     time.Duration `json:"tls"`
+	TTFB    time.Duration `json:"ttfb"`
+	Total   time.Duration `json:"total"`
+	Reused  bool          `json:"reused"`
 }
 
 // Supported dns query type
@@ -72,9 +109,31 @@ var (
 	TypeNS    = Type("NS")
 	TypeSOA   = Type("SOA")
 	TypePTR   = Type("PTR")
+	TypeSRV   = Type("SRV")
 	TypeANY   = Type("ANY")
 )
 
+// Supported idna profile
+const (
+	// IDNALookup maps the domains for lookup with the transitional processing, it is default and allows underscores
+	IDNALookup IDNA = iota
+	// IDNAStrict is IDNALookup with the STD3 rules, which allow only letters, digits and hyphens
+	IDNAStrict
+	// IDNARegistration does not map the domains and rejects the ones not valid for registration, for example:
+	// the upper case letters, it is non-transitional, so that faß.de is not fass.de
+	IDNARegistration
+)
+
+// maxErrorValue is the max length of the input values quoted in the errors, so that the errors are bounded
+const maxErrorValue = 128
+
+// idnaProfiles is the idna profiles of IDNA
+var idnaProfiles = map[IDNA]*idna.Profile{
+	IDNALookup:       idna.New(idna.MapForLookup(), idna.Transitional(true), idna.StrictDomainName(false)),
+	IDNAStrict:       idna.New(idna.MapForLookup(), idna.Transitional(true)),
+	IDNARegistration: idna.Registration,
+}
+
 // Version returns package version
 func Version() string {
 	return "0.3.2"
@@ -90,13 +149,212 @@ func License() string {
 	return "Licensed under the Apache License 2.0"
 }
 
-// Punycode returns punycode of domain
+// Answers returns an iterator of the answers of types, for example: TypeA, all answers if no type
+func (r *Response) Answers(types ...Type) iter.Seq[Answer] {
+	codes := map[Type]bool{}
+	for _, v := range types {
+		codes[Type(strings.ToUpper(strings.TrimSpace(string(v))))] = true
+	}
+
+	return func(yield func(Answer) bool) {
+		if r == nil {
+			return
+		}
+		for _, v := range r.Answer {
+			if len(codes) > 0 && !codes[TypeOf(uint16(v.Type))] {
+				continue
+			}
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// Punycode returns punycode of domain by the lookup profile, which is validated as Validate
 func (d Domain) Punycode() (string, error) {
-	name := strings.TrimSpace(string(d))
+	return IDNALookup.Punycode(d)
+}
+
+// String returns string of idna profile
+func (p IDNA) String() string {
+	switch p {
+	case IDNALookup:
+		return "lookup"
+	case IDNAStrict:
+		return "strict"
+	case IDNARegistration:
+		return "registration"
+	default:
+		return fmt.Sprintf("IDNA(%d)", int(p))
+	}
+}
+
+// Punycode returns punycode of domain by the profile, which is validated as Validate
+func (p IDNA) Punycode(d Domain) (string, error) {
+	profile, ok := idnaProfiles[p]
+	if !ok {
+		return "", fmt.Errorf("doh: dns: not supported idna: %d", p)
+	}
+
+	name, err := profile.ToASCII(strings.TrimSpace(string(d)))
+	if err != nil {
+		return "", fmt.Errorf("doh: dns: invalid domain %s: %w", clip(string(d)), clipError(err))
+	}
+
+	return name, validName(name)
+}
+
+// Unicode returns the unicode form of punycode name, for example: 中文.com. for xn--fiq228c.com., the name is
+// returned as it is if it is not an idn
+func Unicode(name string) string {
+	if !strings.Contains(strings.ToLower(name), "xn--") {
+		return name
+	}
+
+	v, err := idna.Lookup.ToUnicode(name)
+	if err != nil {
+		return name
+	}
+
+	return v
+}
+
+// Canonical returns the canonical form of name, which is in lower case with a single trailing dot, for example:
+// likexian.com. for Likexian.COM, the root name is .
+func Canonical(name string) string {
+	return strings.TrimRight(strings.ToLower(strings.TrimSpace(name)), ".") + "."
+}
+
+// Equal returns whether the names are the same in the canonical form, for example: Likexian.COM. and likexian.com
+func Equal(a, b string) bool {
+	return Canonical(a) == Canonical(b)
+}
+
+// Canonicalize sets the names of questions and answers of response to the canonical form
+func (r *Response) Canonicalize() {
+	for k := range r.Question {
+		r.Question[k].Name = Canonical(r.Question[k].Name)
+	}
+
+	for k := range r.Answer {
+		r.Answer[k].Name = Canonical(r.Answer[k].Name)
+	}
+}
+
+// SetUnicode sets the unicode form of punycode names of questions and answers, the ones set are kept
+func (r *Response) SetUnicode() {
+	for k, v := range r.Question {
+		if u := Unicode(v.Name); v.Unicode == "" && u != v.Name {
+			r.Question[k].Unicode = u
+		}
+	}
+
+	for k, v := range r.Answer {
+		if u := Unicode(v.Name); v.Unicode == "" && u != v.Name {
+			r.Answer[k].Unicode = u
+		}
+	}
+}
+
+// Validate returns error if the domain can not be queried, the limits are checked against its punycode
+func (d Domain) Validate() error {
+	_, err := d.Punycode()
+	return err
+}
+
+// validName returns error if the punycode name is too long or has an invalid label, the labels can have letters,
+// digits and hyphens, which are not at the ends as checked by idna, the underscore can only start a label of
+// the service records, for example: _sip._tcp.likexian.com, and the wildcard can only be the first label
+func validName(name string) error {
+	if name == "." {
+		return nil
+	}
+
+	s := strings.TrimSuffix(name, ".")
+	if s == "" {
+		return fmt.Errorf("doh: dns: invalid domain: empty name")
+	}
+
+	if len(s) > 253 {
+		return fmt.Errorf("doh: dns: invalid domain %s: longer than 253", clip(name))
+	}
+
+	labels := strings.Split(s, ".")
+	for i, v := range labels {
+		if v == "" {
+			return fmt.Errorf("doh: dns: invalid domain %s: empty label", clip(name))
+		}
+		if len(v) > 63 {
+			return fmt.Errorf("doh: dns: invalid domain %s: label %s longer than 63", clip(name), clip(v))
+		}
+		if v == "*" && i == 0 && len(labels) > 1 {
+			continue
+		}
+		for j, c := range []byte(v) {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-':
+			case c == '_' && j == 0 && i < len(labels)-1:
+			case c == '_':
+				return fmt.Errorf("doh: dns: invalid domain %s: underscore can only start a service label",
+					clip(name))
+			default:
+				return fmt.Errorf("doh: dns: invalid domain %s: invalid character %q", clip(name), c)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Subnet returns the subnet of ecs with the prefix length, which is 24 for ipv4 and 56 for ipv6 if missing,
+// the ipv4-mapped ipv6 address is unmapped with its prefix length rescaled to ipv4, for example: ::ffff:1.2.3.4/120
+// is 1.2.3.4/24
+func (s ECS) Subnet() (string, error) {
+	ip, prefix, ok := strings.Cut(strings.TrimSpace(string(s)), "/")
+	ip = strings.TrimSpace(ip)
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Zone() != "" {
+		return "", fmt.Errorf("doh: dns: invalid ecs ip: %s", clip(ip))
+	}
+
+	mapped := addr.Is4In6()
+	addr = addr.Unmap()
+
+	bits := 24
+	if addr.Is6() {
+		bits = 56
+	}
+
+	if prefix = strings.TrimSpace(prefix); ok && prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if mapped {
+			n -= 96
+		}
+		if err != nil || n < 0 || n > addr.BitLen() {
+			return "", fmt.Errorf("doh: dns: invalid ecs mask: %s", clip(prefix))
+		}
+		bits = n
+	}
+
+	return fmt.Sprintf("%s/%d", addr, bits), nil
+}
+
+// clip returns s cut to maxErrorValue bytes as valid utf-8, for the input values quoted in the errors
+func clip(s string) string {
+	if len(s) <= maxErrorValue {
+		return s
+	}
+
+	return strings.ToValidUTF8(s[:maxErrorValue], "") + "..."
+}
+
+// clipError returns err if its message is bounded, or else an error of the clipped message
+func clipError(err error) error {
+	if len(err.Error()) <= 2*maxErrorValue {
+		return err
+	}
 
-	return idna.New(
-		idna.MapForLookup(),
-		idna.Transitional(true),
-		idna.StrictDomainName(false),
-	).ToASCII(name)
+	return errors.New(clip(err.Error()))
 }
@@ -20,6 +20,7 @@
 package dns
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/likexian/gokit/assert"
@@ -42,3 +43,161 @@ func TestToPunycode(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, n, "likexian.com")
 }
+
+func TestCanonical(t *testing.T) {
+	tests := map[string]string{
+		"likexian.com":    "likexian.com.",
+		" Likexian.COM. ": "likexian.com.",
+		"likexian.com..":  "likexian.com.",
+		".":               ".",
+		"":                ".",
+	}
+	for k, v := range tests {
+		assert.Equal(t, Canonical(k), v)
+	}
+
+	assert.True(t, Equal("Likexian.COM.", "likexian.com"))
+	assert.False(t, Equal("likexian.com", "www.likexian.com"))
+
+	rsp := &Response{Question: []Question{{Name: "Likexian.COM", Type: 1}},
+		Answer: []Answer{{Name: "LIKEXIAN.com.", Type: 5, Data: "WWW.likexian.com."}}}
+	rsp.Canonicalize()
+	assert.Equal(t, rsp.Question[0].Name, "likexian.com.")
+	assert.Equal(t, rsp.Answer[0].Name, "likexian.com.")
+	assert.Equal(t, rsp.Answer[0].Data, "WWW.likexian.com.")
+}
+
+func TestIDNA(t *testing.T) {
+	assert.Equal(t, IDNALookup.String(), "lookup")
+	assert.Equal(t, IDNAStrict.String(), "strict")
+	assert.Equal(t, IDNARegistration.String(), "registration")
+	assert.Equal(t, IDNA(9).String(), "IDNA(9)")
+
+	tests := []struct {
+		profile IDNA
+		domain  Domain
+		name    string
+		ok      bool
+	}{
+		{IDNALookup, "中文.COM", "xn--fiq228c.com", true},
+		{IDNALookup, "faß.de", "fass.de", true},
+		{IDNALookup, "_sip._tcp.likexian.com", "_sip._tcp.likexian.com", true},
+		{IDNAStrict, "中文.com", "xn--fiq228c.com", true},
+		{IDNAStrict, "_sip._tcp.likexian.com", "", false},
+		{IDNARegistration, "faß.de", "xn--fa-hia.de", true},
+		{IDNARegistration, "Likexian.com", "", false},
+		{IDNA(9), "likexian.com", "", false},
+	}
+	for _, v := range tests {
+		name, err := v.profile.Punycode(v.domain)
+		assert.Equal(t, err == nil, v.ok, v.domain)
+		assert.Equal(t, name, v.name)
+	}
+
+	assert.Equal(t, Unicode("xn--fiq228c.com."), "中文.com.")
+	assert.Equal(t, Unicode("XN--FIQ228C.com."), "中文.com.")
+	assert.Equal(t, Unicode("likexian.com."), "likexian.com.")
+	assert.Equal(t, Unicode("xn--zz.com."), "xn--zz.com.")
+
+	rsp := &Response{Question: []Question{{Name: "xn--fiq228c.com.", Type: 1}},
+		Answer: []Answer{{Name: "xn--fiq228c.com.", Type: 1}, {Name: "likexian.com.", Type: 1}}}
+	rsp.SetUnicode()
+	assert.Equal(t, rsp.Question[0].Unicode, "中文.com.")
+	assert.Equal(t, rsp.Answer[0].Unicode, "中文.com.")
+	assert.Equal(t, rsp.Answer[1].Unicode, "")
+}
+
+func TestDomainValidate(t *testing.T) {
+	label := strings.Repeat("a", 63)
+	valid := []Domain{
+		"likexian.com",
+		"likexian.com.",
+		".",
+		"中文.com",
+		"_sip._tcp.likexian.com",
+		"*.likexian.com",
+		"xn--fiq228c.com",
+		Domain(label + ".com"),
+		Domain(strings.Repeat(label+".", 3) + strings.Repeat("a", 61)),
+	}
+	for _, v := range valid {
+		assert.Nil(t, v.Validate(), v)
+	}
+
+	invalid := map[Domain]string{
+		"":                                   "empty name",
+		"likexian..com":                      "empty label",
+		".likexian.com":                      "empty label",
+		Domain(label + "a.com"):              "longer than 63",
+		Domain(strings.Repeat(label+".", 4)): "longer than 253",
+		"-likexian.com":                      "invalid domain -likexian.com",
+		"likexian-.com":                      "invalid domain likexian-.com",
+		"like_xian.com":                      "underscore",
+		"likexian._com":                      "underscore",
+		"likexian.com/":                      "invalid character",
+		"a.*.likexian.com":                   "invalid character",
+		"*":                                  "invalid character",
+	}
+	for k, v := range invalid {
+		err := k.Validate()
+		assert.NotNil(t, err, k)
+		assert.Contains(t, err.Error(), v)
+	}
+}
+
+func TestECSSubnet(t *testing.T) {
+	tests := map[ECS]string{
+		"1.2.3.4":            "1.2.3.4/24",
+		" 1.2.3.4/ ":         "1.2.3.4/24",
+		"1.2.3.4/32":         "1.2.3.4/32",
+		"1.2.3.4/0":          "1.2.3.4/0",
+		"2001:db8::1":        "2001:db8::1/56",
+		"2001:db8::1/128":    "2001:db8::1/128",
+		"2001:db8::1 / 48":   "2001:db8::1/48",
+		"::ffff:1.2.3.4":     "1.2.3.4/24",
+		"::ffff:1.2.3.4/120": "1.2.3.4/24",
+		"::ffff:1.2.3.4/96":  "1.2.3.4/0",
+	}
+
+	for k, v := range tests {
+		s, err := k.Subnet()
+		assert.Nil(t, err)
+		assert.Equal(t, s, v)
+	}
+
+	for _, v := range []ECS{"", "xx", "1.2.3.4/33", "1.2.3.4/x", "1.2.3.4/-1", "2001:db8::1/129", "fe80::1%eth0",
+		"::ffff:1.2.3.4/95", "::ffff:1.2.3.4/129"} {
+		_, err := v.Subnet()
+		assert.NotNil(t, err)
+	}
+}
+
+func TestAnswers(t *testing.T) {
+	rsp := &Response{Answer: []Answer{
+		{Name: "likexian.com.", Type: 5, Data: "cdn.likexian.com."},
+		{Name: "cdn.likexian.com.", Type: 1, Data: "1.1.1.1"},
+		{Name: "cdn.likexian.com.", Type: 1, Data: "1.0.0.1"},
+		{Name: "cdn.likexian.com.", Type: 65, Data: "x"},
+	}}
+
+	data := func(types ...Type) []string {
+		ss := []string{}
+		for v := range rsp.Answers(types...) {
+			ss = append(ss, v.Data)
+		}
+		return ss
+	}
+
+	assert.Equal(t, data(), []string{"cdn.likexian.com.", "1.1.1.1", "1.0.0.1", "x"})
+	assert.Equal(t, data(TypeA), []string{"1.1.1.1", "1.0.0.1"})
+	assert.Equal(t, data(" cname ", "type65"), []string{"cdn.likexian.com.", "x"})
+	assert.Equal(t, data(TypeMX), []string{})
+
+	for v := range rsp.Answers(TypeA) {
+		assert.Equal(t, v.Data, "1.1.1.1")
+		break
+	}
+
+	rsp = nil
+	assert.Equal(t, data(), []string{})
+}
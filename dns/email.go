@@ -0,0 +1,414 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// DMARC is the dmarc policy record of _dmarc.<domain> as RFC 7489, the optional tags are set to the defaults
+type DMARC struct {
+	// Policy is the policy of domain: none, quarantine or reject
+	Policy string
+	// SubdomainPolicy is the policy of subdomains, default the policy
+	SubdomainPolicy string
+	// Percent is the percentage of messages applied the policy, default 100
+	Percent int
+	// ADKIM is the dkim alignment mode: r for relaxed or s for strict, default r
+	ADKIM string
+	// ASPF is the spf alignment mode: r for relaxed or s for strict, default r
+	ASPF string
+	// RUA is the uris of aggregate reports
+	RUA []string
+	// RUF is the uris of failure reports
+	RUF []string
+	// FailureOptions is the failure reporting options, default 0
+	FailureOptions string
+	// ReportInterval is the seconds between aggregate reports, default 86400
+	ReportInterval uint32
+	// Tags is all the tags of record, including the unknown ones
+	Tags map[string]string
+}
+
+// SPF is the sender policy framework record as RFC 7208
+type SPF struct {
+	// Mechanisms is the mechanisms in order
+	Mechanisms []SPFMechanism
+	// Redirect is the domain of redirect modifier
+	Redirect string
+	// Exp is the domain of explanation modifier
+	Exp string
+	// Modifiers is all the modifiers of record, including the unknown ones
+	Modifiers map[string]string
+}
+
+// SPFMechanism is a mechanism of spf record, for example: -all or include:_spf.example.com
+type SPFMechanism struct {
+	// Qualifier is the result of match: + for pass, - for fail, ~ for softfail or ? for neutral
+	Qualifier string
+	// Name is the mechanism name: all, include, a, mx, ptr, ip4, ip6 or exists
+	Name string
+	// Value is the domain or network of mechanism, for example: 192.0.2.0/24, empty if none
+	Value string
+}
+
+// DKIM is the dkim public key record of <selector>._domainkey.<domain> as RFC 6376
+type DKIM struct {
+	// KeyType is the key type, default rsa
+	KeyType string
+	// PublicKey is the base64 public key, empty if it is revoked
+	PublicKey string
+	// HashAlgorithms is the acceptable hash algorithms, empty for all
+	HashAlgorithms []string
+	// ServiceTypes is the service types, default *
+	ServiceTypes []string
+	// Flags is the flags, for example: y for testing
+	Flags []string
+	// Notes is the notes for humans
+	Notes string
+	// Tags is all the tags of record, including the unknown ones
+	Tags map[string]string
+}
+
+// MTASTS is the mta-sts record of _mta-sts.<domain> as RFC 8461, which tells the policy id, the policy itself
+// is served over https
+type MTASTS struct {
+	// ID is the id of policy, which changes if the policy is updated
+	ID string
+	// Tags is all the tags of record, including the unknown ones
+	Tags map[string]string
+}
+
+// TLSRPT is the smtp tls reporting record of _smtp._tls.<domain> as RFC 8460
+type TLSRPT struct {
+	// RUA is the uris of aggregate reports
+	RUA []string
+	// Tags is all the tags of record, including the unknown ones
+	Tags map[string]string
+}
+
+// spfMechanisms is the mechanisms of spf, and whether their value is required
+var spfMechanisms = map[string]bool{
+	"all":     false,
+	"include": true,
+	"a":       false,
+	"mx":      false,
+	"ptr":     false,
+	"ip4":     true,
+	"ip6":     true,
+	"exists":  true,
+}
+
+// IsDMARC returns whether the txt is a dmarc record
+func IsDMARC(txt string) bool {
+	return hasVersion(txt, "DMARC1")
+}
+
+// ParseDMARC returns the dmarc policy of txt record, for example: v=DMARC1; p=reject; rua=mailto:d@example.com
+func ParseDMARC(txt string) (*DMARC, error) {
+	if !IsDMARC(txt) {
+		return nil, fmt.Errorf("doh: dns: not a dmarc record: %s", clip(txt))
+	}
+
+	tags, err := parseTags(txt)
+	if err != nil {
+		return nil, fmt.Errorf("doh: dns: invalid dmarc: %w", err)
+	}
+
+	d := &DMARC{
+		Policy:         strings.ToLower(tags["p"]),
+		Percent:        100,
+		ADKIM:          "r",
+		ASPF:           "r",
+		FailureOptions: "0",
+		ReportInterval: 86400,
+		Tags:           tags,
+	}
+
+	if !validDMARCPolicy(d.Policy) {
+		return nil, fmt.Errorf("doh: dns: invalid dmarc policy: %s", clip(tags["p"]))
+	}
+
+	d.SubdomainPolicy = d.Policy
+	if v, ok := tags["sp"]; ok {
+		if d.SubdomainPolicy = strings.ToLower(v); !validDMARCPolicy(d.SubdomainPolicy) {
+			return nil, fmt.Errorf("doh: dns: invalid dmarc subdomain policy: %s", clip(v))
+		}
+	}
+
+	if v, ok := tags["pct"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 100 {
+			return nil, fmt.Errorf("doh: dns: invalid dmarc pct: %s", clip(v))
+		}
+		d.Percent = n
+	}
+
+	for _, v := range []struct {
+		tag   string
+		value *string
+	}{{"adkim", &d.ADKIM}, {"aspf", &d.ASPF}} {
+		if s, ok := tags[v.tag]; ok {
+			if s = strings.ToLower(s); s != "r" && s != "s" {
+				return nil, fmt.Errorf("doh: dns: invalid dmarc %s: %s", v.tag, clip(s))
+			}
+			*v.value = s
+		}
+	}
+
+	if v, ok := tags["ri"]; ok {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("doh: dns: invalid dmarc ri: %s", clip(v))
+		}
+		d.ReportInterval = uint32(n)
+	}
+
+	if v, ok := tags["fo"]; ok {
+		d.FailureOptions = v
+	}
+
+	d.RUA, d.RUF = splitList(tags["rua"], ","), splitList(tags["ruf"], ",")
+
+	return d, nil
+}
+
+// validDMARCPolicy returns whether p is a dmarc policy
+func validDMARCPolicy(p string) bool {
+	return p == "none" || p == "quarantine" || p == "reject"
+}
+
+// IsSPF returns whether the txt is a spf record
+func IsSPF(txt string) bool {
+	fields := strings.Fields(txt)
+	return len(fields) > 0 && strings.EqualFold(fields[0], "v=spf1")
+}
+
+// ParseSPF returns the spf policy of txt record, for example: v=spf1 ip4:192.0.2.0/24 include:_spf.example.com -all
+func ParseSPF(txt string) (*SPF, error) {
+	if !IsSPF(txt) {
+		return nil, fmt.Errorf("doh: dns: not a spf record: %s", clip(txt))
+	}
+
+	s := &SPF{Mechanisms: []SPFMechanism{}, Modifiers: map[string]string{}}
+	for _, term := range strings.Fields(txt)[1:] {
+		if name, value, ok := strings.Cut(term, "="); ok && !strings.ContainsAny(name, ":/") {
+			name = strings.ToLower(name)
+			if _, ok := s.Modifiers[name]; ok {
+				return nil, fmt.Errorf("doh: dns: duplicate spf modifier: %s", clip(name))
+			}
+			s.Modifiers[name] = value
+			continue
+		}
+
+		m, err := parseSPFMechanism(term)
+		if err != nil {
+			return nil, err
+		}
+		s.Mechanisms = append(s.Mechanisms, m)
+	}
+
+	s.Redirect, s.Exp = s.Modifiers["redirect"], s.Modifiers["exp"]
+
+	return s, nil
+}
+
+// parseSPFMechanism returns the mechanism of spf term
+func parseSPFMechanism(term string) (SPFMechanism, error) {
+	m := SPFMechanism{Qualifier: "+"}
+	if strings.ContainsAny(term[:1], "+-~?") {
+		m.Qualifier, term = term[:1], term[1:]
+	}
+
+	name, value, _ := strings.Cut(term, ":")
+	if i := strings.IndexByte(name, '/'); i >= 0 && value == "" {
+		name, value = name[:i], name[i:]
+	}
+
+	m.Name, m.Value = strings.ToLower(name), value
+	required, ok := spfMechanisms[m.Name]
+	if !ok {
+		return m, fmt.Errorf("doh: dns: unknown spf mechanism: %s", clip(term))
+	}
+
+	if required && m.Value == "" || m.Name == "all" && m.Value != "" {
+		return m, fmt.Errorf("doh: dns: invalid spf mechanism: %s", clip(term))
+	}
+
+	if m.Name == "ip4" || m.Name == "ip6" {
+		addr, bits, _ := strings.Cut(m.Value, "/")
+		ip, err := netip.ParseAddr(addr)
+		if err != nil || ip.Is4() != (m.Name == "ip4") {
+			return m, fmt.Errorf("doh: dns: invalid spf mechanism: %s", clip(term))
+		}
+		if bits != "" {
+			if n, err := strconv.Atoi(bits); err != nil || n < 0 || n > ip.BitLen() {
+				return m, fmt.Errorf("doh: dns: invalid spf mechanism: %s", clip(term))
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// ParseDKIM returns the dkim key of txt record, for example: v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEB...
+func ParseDKIM(txt string) (*DKIM, error) {
+	tags, err := parseTags(txt)
+	if err != nil {
+		return nil, fmt.Errorf("doh: dns: invalid dkim: %w", err)
+	}
+
+	if v, ok := tags["v"]; ok && v != "DKIM1" {
+		return nil, fmt.Errorf("doh: dns: invalid dkim version: %s", clip(v))
+	}
+
+	p, ok := tags["p"]
+	if !ok {
+		return nil, fmt.Errorf("doh: dns: missing dkim public key")
+	}
+
+	d := &DKIM{
+		KeyType:        "rsa",
+		PublicKey:      strings.Join(strings.Fields(p), ""),
+		HashAlgorithms: splitList(tags["h"], ":"),
+		ServiceTypes:   []string{"*"},
+		Flags:          splitList(tags["t"], ":"),
+		Notes:          tags["n"],
+		Tags:           tags,
+	}
+
+	if v, ok := tags["k"]; ok {
+		d.KeyType = strings.ToLower(v)
+	}
+
+	if v, ok := tags["s"]; ok {
+		d.ServiceTypes = splitList(v, ":")
+	}
+
+	return d, nil
+}
+
+// Revoked returns whether the dkim key is revoked, which has an empty public key
+func (d *DKIM) Revoked() bool {
+	return d.PublicKey == ""
+}
+
+// Testing returns whether the dkim key is in the testing mode, which has the y flag
+func (d *DKIM) Testing() bool {
+	for _, v := range d.Flags {
+		if strings.EqualFold(v, "y") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsMTASTS returns whether the txt is a mta-sts record
+func IsMTASTS(txt string) bool {
+	return hasVersion(txt, "STSv1")
+}
+
+// ParseMTASTS returns the mta-sts record of txt, for example: v=STSv1; id=20160831085700Z
+func ParseMTASTS(txt string) (*MTASTS, error) {
+	if !IsMTASTS(txt) {
+		return nil, fmt.Errorf("doh: dns: not a mta-sts record: %s", clip(txt))
+	}
+
+	tags, err := parseTags(txt)
+	if err != nil {
+		return nil, fmt.Errorf("doh: dns: invalid mta-sts: %w", err)
+	}
+
+	id := tags["id"]
+	if id == "" || len(id) > 32 || strings.IndexFunc(id, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	}) >= 0 {
+		return nil, fmt.Errorf("doh: dns: invalid mta-sts id: %s", clip(id))
+	}
+
+	return &MTASTS{ID: id, Tags: tags}, nil
+}
+
+// IsTLSRPT returns whether the txt is a smtp tls reporting record
+func IsTLSRPT(txt string) bool {
+	return hasVersion(txt, "TLSRPTv1")
+}
+
+// ParseTLSRPT returns the smtp tls reporting record of txt, for example: v=TLSRPTv1; rua=mailto:r@example.com
+func ParseTLSRPT(txt string) (*TLSRPT, error) {
+	if !IsTLSRPT(txt) {
+		return nil, fmt.Errorf("doh: dns: not a tls-rpt record: %s", clip(txt))
+	}
+
+	tags, err := parseTags(txt)
+	if err != nil {
+		return nil, fmt.Errorf("doh: dns: invalid tls-rpt: %w", err)
+	}
+
+	rua := splitList(tags["rua"], ",")
+	if len(rua) == 0 {
+		return nil, fmt.Errorf("doh: dns: missing tls-rpt rua")
+	}
+
+	return &TLSRPT{RUA: rua, Tags: tags}, nil
+}
+
+// hasVersion returns whether the tag list txt starts with the version tag v
+func hasVersion(txt, v string) bool {
+	tag, _, _ := strings.Cut(strings.TrimSpace(txt), ";")
+	return strings.EqualFold(strings.ReplaceAll(tag, " ", ""), "v="+v)
+}
+
+// parseTags returns the tags of tag list as RFC 6376, for example: v=DKIM1; k=rsa, the names are lower case
+func parseTags(txt string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, v := range strings.Split(txt, ";") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(v, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid tag: %s", clip(v))
+		}
+		if _, ok := tags[name]; ok {
+			return nil, fmt.Errorf("duplicate tag: %s", clip(name))
+		}
+		tags[name] = strings.TrimSpace(value)
+	}
+
+	return tags, nil
+}
+
+// splitList returns the trimmed non-empty items of list separated by sep
+func splitList(list, sep string) []string {
+	vs := []string{}
+	for _, v := range strings.Split(list, sep) {
+		if v = strings.TrimSpace(v); v != "" {
+			vs = append(vs, v)
+		}
+	}
+
+	return vs
+}
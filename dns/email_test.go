@@ -0,0 +1,174 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestParseDMARC(t *testing.T) {
+	assert.True(t, IsDMARC("v=DMARC1; p=none"))
+	assert.True(t, IsDMARC(" v = DMARC1 ;p=none"))
+	assert.False(t, IsDMARC("v=spf1 -all"))
+
+	d, err := ParseDMARC("v=DMARC1; p=reject")
+	assert.Nil(t, err)
+	assert.Equal(t, d.Policy, "reject")
+	assert.Equal(t, d.SubdomainPolicy, "reject")
+	assert.Equal(t, d.Percent, 100)
+	assert.Equal(t, d.ADKIM, "r")
+	assert.Equal(t, d.ASPF, "r")
+	assert.Equal(t, d.FailureOptions, "0")
+	assert.Equal(t, d.ReportInterval, uint32(86400))
+	assert.Equal(t, len(d.RUA), 0)
+
+	d, err = ParseDMARC("v=DMARC1; p=Quarantine; sp=none; pct=20; adkim=s; aspf=S; fo=1:d; ri=3600; " +
+		"rua=mailto:a@example.com, mailto:b@example.com; ruf=mailto:f@example.com; x=y;")
+	assert.Nil(t, err)
+	assert.Equal(t, d.Policy, "quarantine")
+	assert.Equal(t, d.SubdomainPolicy, "none")
+	assert.Equal(t, d.Percent, 20)
+	assert.Equal(t, d.ADKIM, "s")
+	assert.Equal(t, d.ASPF, "s")
+	assert.Equal(t, d.FailureOptions, "1:d")
+	assert.Equal(t, d.ReportInterval, uint32(3600))
+	assert.Equal(t, d.RUA, []string{"mailto:a@example.com", "mailto:b@example.com"})
+	assert.Equal(t, d.RUF, []string{"mailto:f@example.com"})
+	assert.Equal(t, d.Tags["x"], "y")
+
+	for _, v := range []string{
+		"v=spf1 -all",
+		"v=DMARC1",
+		"v=DMARC1; p=xx",
+		"v=DMARC1; p=none; sp=xx",
+		"v=DMARC1; p=none; pct=101",
+		"v=DMARC1; p=none; pct=x",
+		"v=DMARC1; p=none; adkim=x",
+		"v=DMARC1; p=none; aspf=x",
+		"v=DMARC1; p=none; ri=-1",
+		"v=DMARC1; p=none; p=reject",
+		"v=DMARC1; p=none; xx",
+		"v=DMARC1; p=" + strings.Repeat("x", 1000),
+	} {
+		_, err := ParseDMARC(v)
+		assert.NotNil(t, err, v)
+		assert.True(t, len(err.Error()) < 256)
+	}
+}
+
+func TestParseSPF(t *testing.T) {
+	assert.True(t, IsSPF("v=spf1 -all"))
+	assert.True(t, IsSPF("V=SPF1"))
+	assert.False(t, IsSPF("v=spf10 -all"))
+	assert.False(t, IsSPF(""))
+
+	s, err := ParseSPF("v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::/32 a mx/24 +a:mail.example.com/28 " +
+		"include:_spf.example.com ?exists:%{i}.example.com ~ptr -all redirect=_spf.example.net exp=exp.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, s.Mechanisms, []SPFMechanism{
+		{"+", "ip4", "192.0.2.0/24"},
+		{"+", "ip6", "2001:db8::/32"},
+		{"+", "a", ""},
+		{"+", "mx", "/24"},
+		{"+", "a", "mail.example.com/28"},
+		{"+", "include", "_spf.example.com"},
+		{"?", "exists", "%{i}.example.com"},
+		{"~", "ptr", ""},
+		{"-", "all", ""},
+	})
+	assert.Equal(t, s.Redirect, "_spf.example.net")
+	assert.Equal(t, s.Exp, "exp.example.com")
+
+	s, err = ParseSPF("v=spf1")
+	assert.Nil(t, err)
+	assert.Equal(t, len(s.Mechanisms), 0)
+
+	for _, v := range []string{
+		"v=DMARC1; p=none",
+		"v=spf1 xx",
+		"v=spf1 include",
+		"v=spf1 all:x",
+		"v=spf1 ip4:2001:db8::",
+		"v=spf1 ip6:192.0.2.1",
+		"v=spf1 ip4:192.0.2.0/33",
+		"v=spf1 ip4:x",
+		"v=spf1 redirect=a redirect=b",
+	} {
+		_, err := ParseSPF(v)
+		assert.NotNil(t, err, v)
+	}
+}
+
+func TestParseDKIM(t *testing.T) {
+	d, err := ParseDKIM("v=DKIM1; k=RSA; h=sha256; t=y:s; n=note; p=MIGfMA0G CSqGSIb3")
+	assert.Nil(t, err)
+	assert.Equal(t, d.KeyType, "rsa")
+	assert.Equal(t, d.PublicKey, "MIGfMA0GCSqGSIb3")
+	assert.Equal(t, d.HashAlgorithms, []string{"sha256"})
+	assert.Equal(t, d.ServiceTypes, []string{"*"})
+	assert.Equal(t, d.Flags, []string{"y", "s"})
+	assert.Equal(t, d.Notes, "note")
+	assert.False(t, d.Revoked())
+	assert.True(t, d.Testing())
+
+	d, err = ParseDKIM("p=; s=email")
+	assert.Nil(t, err)
+	assert.Equal(t, d.KeyType, "rsa")
+	assert.Equal(t, d.ServiceTypes, []string{"email"})
+	assert.True(t, d.Revoked())
+	assert.False(t, d.Testing())
+
+	for _, v := range []string{"v=DKIM2; p=x", "k=rsa", "p=x; p=y", "="} {
+		_, err := ParseDKIM(v)
+		assert.NotNil(t, err, v)
+	}
+}
+
+func TestParseMTASTS(t *testing.T) {
+	assert.True(t, IsMTASTS("v=STSv1; id=1"))
+	assert.False(t, IsMTASTS("v=TLSRPTv1; rua=mailto:r@example.com"))
+
+	m, err := ParseMTASTS("v=STSv1; id=20160831085700Z;")
+	assert.Nil(t, err)
+	assert.Equal(t, m.ID, "20160831085700Z")
+
+	for _, v := range []string{"v=spf1", "v=STSv1", "v=STSv1; id=a-b", "v=STSv1; id=" + strings.Repeat("x", 33),
+		"v=STSv1; id"} {
+		_, err := ParseMTASTS(v)
+		assert.NotNil(t, err, v)
+	}
+}
+
+func TestParseTLSRPT(t *testing.T) {
+	assert.True(t, IsTLSRPT("v=TLSRPTv1; rua=mailto:r@example.com"))
+	assert.False(t, IsTLSRPT("v=STSv1; id=1"))
+
+	r, err := ParseTLSRPT("v=TLSRPTv1; rua=mailto:r@example.com,https://report.example.com/v1")
+	assert.Nil(t, err)
+	assert.Equal(t, r.RUA, []string{"mailto:r@example.com", "https://report.example.com/v1"})
+
+	for _, v := range []string{"v=STSv1; id=1", "v=TLSRPTv1", "v=TLSRPTv1; rua=", "v=TLSRPTv1; rua"} {
+		_, err := ParseTLSRPT(v)
+		assert.NotNil(t, err, v)
+	}
+}
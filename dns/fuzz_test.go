@@ -0,0 +1,133 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// maxErrorSize is the max size of parsing errors, which must not echo the adversarial input unbounded
+const maxErrorSize = 512
+
+// checkError fails the test if the error is too large
+func checkError(t *testing.T, err error) {
+	if err != nil && len(err.Error()) > maxErrorSize {
+		t.Fatalf("error of %d bytes: %.100s", len(err.Error()), err)
+	}
+}
+
+// addMessages adds the wire format messages of the seeds corpus
+func addMessages(f *testing.F) {
+	q, err := NewQuery("likexian.com", TypeA, "1.2.3.4/24", Flags{DO: true})
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(q)
+
+	rsp := &Response{Question: []Question{{Name: "likexian.com.", Type: 1}},
+		Answer: []Answer{{Name: "likexian.com.", Type: 1, TTL: 300, Data: "1.1.1.1"},
+			{Name: "likexian.com.", Type: 15, TTL: 300, Data: "10 mx.likexian.com."},
+			{Name: "likexian.com.", Type: 16, TTL: 300, Data: `"v=spf1 -all"`},
+			{Name: "likexian.com.", Type: 65, TTL: 300, Data: `\# 3 010203`}}}
+	b, err := rsp.Pack(1)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(b)
+	f.Add(b[:len(b)/2])
+	f.Add([]byte{})
+}
+
+func FuzzParseMessage(f *testing.F) {
+	addMessages(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		rsp, err := ParseMessage(b)
+		checkError(t, err)
+		if err == nil {
+			_, err = rsp.Pack(0)
+			checkError(t, err)
+		}
+	})
+}
+
+func FuzzParseQuery(f *testing.F) {
+	addMessages(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		q, err := ParseQuery(b)
+		checkError(t, err)
+		if err == nil {
+			_, err = q.Reply(q.Response(0), 0)
+			checkError(t, err)
+		}
+	})
+}
+
+func FuzzNewQuery(f *testing.F) {
+	for _, v := range []string{"", "1.2.3.4", "1.2.3.4/24", " 1.2.3.4/ ", "2001:db8::1/48", "::ffff:1.2.3.4",
+		"::ffff:1.2.3.4/120", "::ffff:1.2.3.4/64", "fe80::1%eth0", "1.2.3.4/33", "/", "x"} {
+		f.Add(v)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		b, err := NewQuery("likexian.com", TypeA, ECS(s), Flags{})
+		checkError(t, err)
+		_, serr := ECS(s).Subnet()
+		if (err == nil) != (serr == nil || strings.TrimSpace(s) == "") {
+			t.Fatalf("query error %v but subnet error %v", err, serr)
+		}
+		if err == nil {
+			_, err = ParseQuery(b)
+			checkError(t, err)
+		}
+	})
+}
+
+func FuzzDecodeReader(f *testing.F) {
+	f.Add(`{"Status":0,"TC":false,"Question":[{"name":"likexian.com.","type":1}],` +
+		`"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`)
+	f.Add(`{"status":"0","answer":{"name":"likexian.com.","type":"A","ttl":"300","data":["1.1.1.1"]}}`)
+	f.Add(`)]}'` + "\n" + `{"Status":0,"Comment":["a","b"],"edns_client_subnet":"1.2.3.0/24/0"}`)
+	f.Add(`{"Status":0,"Answer":[{"name":"likexian.com.","type":65536,"TTL":-1}]}` + strings.Repeat("x", 10))
+	f.Add(`[[[[[[[[[[`)
+	long := strings.Repeat("x", 1000)
+	f.Add(`{"Status":0,"edns_client_subnet":"` + long + `"}`)
+	f.Add(`{"Status":0,"Answer":[{"name":"` + long + `","type":1,"TTL":300,"data":"` + long + `"}]}`)
+	f.Add(`{"Status":0,"Answer":[{"name":"likexian.com.","type":15,"TTL":300,"data":"` + long + `"}]}`)
+	f.Add(`{"Status":0,"Answer":[{"name":"likexian.com.","type":65,"TTL":300,"data":"\\# 2 ` + long + `"}]}`)
+	f.Add(`{"status":"` + long + `","answer":[{"type":"` + long + `"}]}`)
+	f.Add(`{"Status":"` + long + `"}`)
+	f.Add(`{"` + long + `":0}`)
+
+	d := Dialect{"Comment": CommentField, "edns_client_subnet": ECSField}
+	f.Fuzz(func(t *testing.T, s string) {
+		for _, p := range []Parsing{ParsingDefault, ParsingStrict, ParsingLenient} {
+			rsp, err := p.DecodeReader(ContentTypeJSON, strings.NewReader(s))
+			checkError(t, err)
+			if err == nil {
+				_, err = rsp.Pack(0)
+				checkError(t, err)
+			}
+
+			_, err = d.DecodeReader(ContentTypeJSON, bytes.NewReader([]byte(s)), p)
+			checkError(t, err)
+		}
+	})
+}
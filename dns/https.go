@@ -0,0 +1,266 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// TypeHTTPS is the HTTPS query type of RFC 9460, it is in the RFC 3597 form, so that the json apis are sent the code
+var TypeHTTPS = Type("TYPE65")
+
+// HTTPS is the https service binding record of RFC 9460, the alias mode ones are of priority 0 with the target only
+type HTTPS struct {
+	Priority uint16
+	// Target is the name of the service endpoint, . for the owner name in the service mode
+	Target string
+	// Mandatory is the keys of the parameters the clients must support to use the record
+	Mandatory []uint16
+	// ALPN is the application protocol ids supported in preference, for example: h3 and h2
+	ALPN []string
+	// NoDefaultALPN is whether the default http/1.1 is not supported
+	NoDefaultALPN bool
+	// Port is the alternative port, 0 for the default
+	Port uint16
+	// IPv4Hint and IPv6Hint are the addresses of target, which can be dialed before they are resolved
+	IPv4Hint []net.IP
+	IPv6Hint []net.IP
+	// ECH is the encrypted client hello config list, for tls.Config.EncryptedClientHelloConfigList
+	ECH []byte
+}
+
+// Keys of the https service parameters
+const (
+	HTTPSMandatory     = 0
+	HTTPSALPN          = 1
+	HTTPSNoDefaultALPN = 2
+	HTTPSPort          = 3
+	HTTPSIPv4Hint      = 4
+	HTTPSECH           = 5
+	HTTPSIPv6Hint      = 6
+)
+
+// httpsKeys is the presentation names of the https service parameters
+var httpsKeys = map[string]uint16{
+	"mandatory":       HTTPSMandatory,
+	"alpn":            HTTPSALPN,
+	"no-default-alpn": HTTPSNoDefaultALPN,
+	"port":            HTTPSPort,
+	"ipv4hint":        HTTPSIPv4Hint,
+	"ech":             HTTPSECH,
+	"ipv6hint":        HTTPSIPv6Hint,
+}
+
+// Alias returns whether the record is of the alias mode
+func (h HTTPS) Alias() bool {
+	return h.Priority == 0
+}
+
+// Supported returns whether the mandatory keys of record are supported
+func (h HTTPS) Supported() bool {
+	for _, v := range h.Mandatory {
+		if v > HTTPSIPv6Hint {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseHTTPS returns the https record of data, in the RFC 3597 generic encoding answered in the wire format,
+// or in the presentation format, for example: 1 . alpn=h3,h2 ipv4hint=1.2.3.4
+func parseHTTPS(data string) (HTTPS, bool) {
+	if b, ok := parseGeneric(data); ok {
+		return unpackHTTPS(b)
+	}
+
+	fields := strings.Fields(data)
+	if len(fields) < 2 {
+		return HTTPS{}, false
+	}
+
+	priority, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return HTTPS{}, false
+	}
+
+	h := HTTPS{Priority: uint16(priority), Target: fields[1]}
+	for _, v := range fields[2:] {
+		k, value, _ := strings.Cut(v, "=")
+		key, ok := httpsKey(k)
+		if !ok || !h.set(key, strings.Trim(value, `"`), nil) {
+			return HTTPS{}, false
+		}
+	}
+
+	return h, true
+}
+
+// unpackHTTPS returns the https record of the wire format resource data
+func unpackHTTPS(b []byte) (HTTPS, bool) {
+	if len(b) < 3 {
+		return HTTPS{}, false
+	}
+
+	h := HTTPS{Priority: binary.BigEndian.Uint16(b)}
+	b = b[2:]
+
+	labels := []string{}
+	for {
+		if len(b) == 0 || len(b) < int(b[0])+1 {
+			return HTTPS{}, false
+		}
+		n := int(b[0])
+		if n == 0 {
+			b = b[1:]
+			break
+		}
+		labels = append(labels, string(b[1:n+1]))
+		b = b[n+1:]
+	}
+	h.Target = strings.Join(labels, ".") + "."
+
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return HTTPS{}, false
+		}
+		key, n := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+		if len(b) < n+4 || !h.set(key, "", b[4:n+4]) {
+			return HTTPS{}, false
+		}
+		b = b[n+4:]
+	}
+
+	return h, true
+}
+
+// httpsKey returns the key of the presentation name, for example: alpn or key1
+func httpsKey(name string) (uint16, bool) {
+	if key, ok := httpsKeys[name]; ok {
+		return key, true
+	}
+
+	if !strings.HasPrefix(name, "key") {
+		return 0, false
+	}
+
+	key, err := strconv.ParseUint(strings.TrimPrefix(name, "key"), 10, 16)
+
+	return uint16(key), err == nil
+}
+
+// set sets the parameter of key by the presentation value, or the wire format one if not nil,
+// the parameters not modeled are skipped
+func (h *HTTPS) set(key uint16, value string, wire []byte) bool {
+	switch key {
+	case HTTPSMandatory:
+		if wire == nil {
+			for _, v := range strings.Split(value, ",") {
+				k, ok := httpsKey(v)
+				if !ok {
+					return false
+				}
+				h.Mandatory = append(h.Mandatory, k)
+			}
+			return true
+		}
+		if len(wire)%2 != 0 {
+			return false
+		}
+		for i := 0; i < len(wire); i += 2 {
+			h.Mandatory = append(h.Mandatory, binary.BigEndian.Uint16(wire[i:]))
+		}
+	case HTTPSALPN:
+		if wire == nil {
+			h.ALPN = slices.DeleteFunc(strings.Split(value, ","), func(v string) bool { return v == "" })
+			return true
+		}
+		ss, ok := characterStrings(wire)
+		if !ok {
+			return false
+		}
+		h.ALPN = ss
+	case HTTPSNoDefaultALPN:
+		h.NoDefaultALPN = true
+	case HTTPSPort:
+		if wire == nil {
+			port, err := strconv.ParseUint(value, 10, 16)
+			h.Port = uint16(port)
+			return err == nil
+		}
+		if len(wire) != 2 {
+			return false
+		}
+		h.Port = binary.BigEndian.Uint16(wire)
+	case HTTPSIPv4Hint, HTTPSIPv6Hint:
+		ips, ok := hintIPs(key, value, wire)
+		if !ok {
+			return false
+		}
+		if key == HTTPSIPv4Hint {
+			h.IPv4Hint = ips
+		} else {
+			h.IPv6Hint = ips
+		}
+	case HTTPSECH:
+		if wire == nil {
+			b, err := base64.StdEncoding.DecodeString(value)
+			h.ECH = b
+			return err == nil
+		}
+		h.ECH = slices.Clone(wire)
+	}
+
+	return true
+}
+
+// hintIPs returns the addresses of the ip hint parameter of key, by the presentation value or the wire format one
+func hintIPs(key uint16, value string, wire []byte) ([]net.IP, bool) {
+	size := net.IPv4len
+	if key == HTTPSIPv6Hint {
+		size = net.IPv6len
+	}
+
+	ips := []net.IP{}
+	if wire == nil {
+		for _, v := range strings.Split(value, ",") {
+			ip := net.ParseIP(v)
+			if ip == nil || (ip.To4() != nil) != (size == net.IPv4len) {
+				return nil, false
+			}
+			ips = append(ips, ip)
+		}
+		return ips, true
+	}
+
+	if len(wire) == 0 || len(wire)%size != 0 {
+		return nil, false
+	}
+	for i := 0; i < len(wire); i += size {
+		ips = append(ips, net.IP(slices.Clone(wire[i:i+size])))
+	}
+
+	return ips, true
+}
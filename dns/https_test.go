@@ -0,0 +1,116 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestParseHTTPS(t *testing.T) {
+	h, ok := parseHTTPS("1 . alpn=h3,h2 ipv4hint=104.16.132.229,104.16.133.229 ech=AAEC " +
+		"ipv6hint=2606:4700::6810:84e5 port=8443 mandatory=alpn,ipv4hint")
+	assert.True(t, ok)
+	assert.Equal(t, h, HTTPS{Priority: 1, Target: ".", Mandatory: []uint16{HTTPSALPN, HTTPSIPv4Hint},
+		ALPN: []string{"h3", "h2"}, Port: 8443, IPv4Hint: []net.IP{net.ParseIP("104.16.132.229"),
+			net.ParseIP("104.16.133.229")}, IPv6Hint: []net.IP{net.ParseIP("2606:4700::6810:84e5")},
+		ECH: []byte{0, 1, 2}})
+	assert.False(t, h.Alias())
+	assert.True(t, h.Supported())
+
+	h, ok = parseHTTPS(`0 cdn.likexian.com.`)
+	assert.True(t, ok)
+	assert.True(t, h.Alias())
+	assert.Equal(t, h.Target, "cdn.likexian.com.")
+
+	h, ok = parseHTTPS(`2 . alpn="h2" no-default-alpn key65000=x mandatory=key65000`)
+	assert.True(t, ok)
+	assert.Equal(t, h.ALPN, []string{"h2"})
+	assert.True(t, h.NoDefaultALPN)
+	assert.False(t, h.Supported())
+
+	tests := []string{
+		"",
+		"1",
+		"x .",
+		"1 . xx=1",
+		"1 . port=x",
+		"1 . ipv4hint=2001::1",
+		"1 . ipv6hint=1.2.3.4",
+		"1 . ech=*",
+		"1 . mandatory=xx",
+	}
+
+	for _, v := range tests {
+		_, ok := parseHTTPS(v)
+		assert.False(t, ok, v)
+	}
+}
+
+func TestUnpackHTTPS(t *testing.T) {
+	wire := []byte{0, 1, 3, 'c', 'd', 'n', 0,
+		0, 0, 0, 2, 0, 1,
+		0, 1, 0, 6, 2, 'h', '3', 2, 'h', '2',
+		0, 2, 0, 0,
+		0, 3, 0, 2, 0x20, 0xfb,
+		0, 4, 0, 4, 1, 2, 3, 4,
+		0, 5, 0, 2, 0xab, 0xcd,
+		0, 6, 0, 16, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1,
+		0, 9, 0, 1, 'x',
+	}
+
+	h, ok := parseHTTPS(fmt.Sprintf(`\# %d %x`, len(wire), wire))
+	assert.True(t, ok)
+	assert.Equal(t, h, HTTPS{Priority: 1, Target: "cdn.", Mandatory: []uint16{HTTPSALPN}, ALPN: []string{"h3", "h2"},
+		NoDefaultALPN: true, Port: 8443, IPv4Hint: []net.IP{{1, 2, 3, 4}},
+		IPv6Hint: []net.IP{net.ParseIP("2001:db8::1")}, ECH: []byte{0xab, 0xcd}})
+
+	h, ok = unpackHTTPS([]byte{0, 0, 0})
+	assert.True(t, ok)
+	assert.Equal(t, h, HTTPS{Target: "."})
+
+	tests := [][]byte{
+		{0, 1},
+		{0, 1, 3, 'c'},
+		{0, 1, 0, 0, 1},
+		{0, 1, 0, 0, 1, 0, 4, 1},
+		{0, 1, 0, 0, 0, 0, 1, 0},
+		{0, 1, 0, 0, 1, 0, 2, 5, 'h'},
+		{0, 1, 0, 0, 3, 0, 1, 0},
+		{0, 1, 0, 0, 4, 0, 3, 1, 2, 3},
+		{0, 1, 0, 0, 6, 0, 0},
+	}
+
+	for _, v := range tests {
+		_, ok := unpackHTTPS(v)
+		assert.False(t, ok, v)
+	}
+
+	rsp := &Response{Answer: []Answer{
+		{Type: 65, Data: "1 . alpn=h2"},
+		{Type: 65, Data: "x"},
+		{Type: 64, Data: "1 . alpn=h2"},
+	}}
+	assert.Equal(t, Records[HTTPS](rsp), []HTTPS{{Priority: 1, Target: ".", ALPN: []string{"h2"}}})
+	assert.Equal(t, RecordTypes[HTTPS](), []Type{TypeHTTPS})
+}
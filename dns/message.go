@@ -0,0 +1,521 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Format is the DoH message format
+type Format int
+
+// Supported DoH message format
+const (
+	// FormatAuto chooses the wire format if supported by provider, else json
+	FormatAuto Format = iota
+	// FormatJSON is the application/dns-json format
+	FormatJSON
+	// FormatMessage is the RFC 8484 application/dns-message wire format
+	FormatMessage
+)
+
+// DoH message content types
+const (
+	ContentTypeJSON    = "application/dns-json"
+	ContentTypeMessage = "application/dns-message"
+)
+
+// MaxMessageSize is the max size of the wire format messages, the larger ones are rejected before parsing
+const MaxMessageSize = 65535
+
+// typeCodes is the code of supported dns query type
+var typeCodes = map[Type]uint16{
+	TypeA:     1,
+	TypeNS:    2,
+	TypeCNAME: 5,
+	TypeSOA:   6,
+	TypePTR:   12,
+	TypeMX:    15,
+	TypeTXT:   16,
+	TypeAAAA:  28,
+	TypeSRV:   33,
+	TypeSPF:   99,
+	TypeANY:   255,
+}
+
+// rcodeNames is the name of dns response code
+var rcodeNames = map[int]string{
+	0:  "NOERROR",
+	1:  "FORMERR",
+	2:  "SERVFAIL",
+	3:  "NXDOMAIN",
+	4:  "NOTIMP",
+	5:  "REFUSED",
+	6:  "YXDOMAIN",
+	7:  "YXRRSET",
+	8:  "NXRRSET",
+	9:  "NOTAUTH",
+	10: "NOTZONE",
+}
+
+// String returns string of format
+func (f Format) String() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatMessage:
+		return "message"
+	default:
+		return "auto"
+	}
+}
+
+// ContentType returns content type of format, empty for FormatAuto
+func (f Format) ContentType() string {
+	switch f {
+	case FormatJSON:
+		return ContentTypeJSON
+	case FormatMessage:
+		return ContentTypeMessage
+	default:
+		return ""
+	}
+}
+
+// FormatOf returns the format of response content type, the JSON API of providers use various content types
+func FormatOf(contentType string) Format {
+	if strings.HasPrefix(strings.ToLower(strings.TrimSpace(contentType)), ContentTypeMessage) {
+		return FormatMessage
+	}
+
+	return FormatJSON
+}
+
+// Code returns the numeric code of dns query type, the unknown types are in the RFC 3597 format or plain numbers,
+// for example: TYPE65 or 65
+func (t Type) Code() (uint16, error) {
+	name := strings.ToUpper(strings.TrimSpace(string(t)))
+	if code, ok := typeCodes[Type(name)]; ok {
+		return code, nil
+	}
+
+	if code, err := strconv.ParseUint(strings.TrimPrefix(name, "TYPE"), 10, 16); err == nil {
+		return uint16(code), nil
+	}
+
+	return 0, fmt.Errorf("doh: dns: not supported type: %s", clip(string(t)))
+}
+
+// Normalize returns the canonical name of dns query type, for example: A for a, 1 or TYPE1, and TYPE65 for 65,
+// the invalid type is returned as it is
+func (t Type) Normalize() Type {
+	code, err := t.Code()
+	if err != nil {
+		return t
+	}
+
+	return TypeOf(code)
+}
+
+// Param returns the dns query type for the json api param, which is the code of the unknown types
+func (t Type) Param() string {
+	code, err := t.Code()
+	if err != nil {
+		return strings.TrimSpace(string(t))
+	}
+
+	name := TypeOf(code)
+	if strings.HasPrefix(string(name), "TYPE") {
+		return strconv.Itoa(int(code))
+	}
+
+	return string(name)
+}
+
+// RcodeName returns the name of dns response code, for example: NXDOMAIN
+func RcodeName(rcode int) string {
+	if v, ok := rcodeNames[rcode]; ok {
+		return v
+	}
+
+	return fmt.Sprintf("RCODE%d", rcode)
+}
+
+// TypeOf returns the dns query type of numeric code
+func TypeOf(code uint16) Type {
+	for k, v := range typeCodes {
+		if v == code {
+			return k
+		}
+	}
+
+	return Type(fmt.Sprintf("TYPE%d", code))
+}
+
+// NewQuery returns a RFC 8484 wire format query message with flags, the name must be punycode,
+// the id is 0 as recommended for http caching
+func NewQuery(name string, t Type, s ECS, f Flags) ([]byte, error) {
+	code, err := t.Code()
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+
+	n, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, fmt.Errorf("doh: dns: invalid name: %s", err)
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{RecursionDesired: !f.NoRD, CheckingDisabled: f.CD})
+	b.EnableCompression()
+
+	if err = b.StartQuestions(); err != nil {
+		return nil, err
+	}
+
+	class := dnsmessage.ClassINET
+	if f.Chaos {
+		class = dnsmessage.ClassCHAOS
+	}
+
+	err = b.Question(dnsmessage.Question{
+		Name:  n,
+		Type:  dnsmessage.Type(code),
+		Class: class,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = b.StartAdditionals(); err != nil {
+		return nil, err
+	}
+
+	opt := dnsmessage.OPTResource{}
+	if strings.TrimSpace(string(s)) != "" {
+		o, err := ecsOption(string(s))
+		if err != nil {
+			return nil, err
+		}
+		opt.Options = append(opt.Options, o)
+	}
+
+	h := dnsmessage.ResourceHeader{}
+	if err = h.SetEDNS0(4096, dnsmessage.RCodeSuccess, f.DO); err != nil {
+		return nil, err
+	}
+
+	if err = b.OPTResource(h, opt); err != nil {
+		return nil, err
+	}
+
+	return b.Finish()
+}
+
+// ParseMessage returns the response of a RFC 8484 wire format message
+func ParseMessage(b []byte) (*Response, error) {
+	if len(b) > MaxMessageSize {
+		return nil, fmt.Errorf("doh: dns: message too large: %d bytes", len(b))
+	}
+
+	var p dnsmessage.Parser
+
+	h, err := p.Start(b)
+	if err != nil {
+		return nil, fmt.Errorf("doh: dns: invalid message: %s", err)
+	}
+
+	rr := &Response{
+		Status:   int(h.RCode),
+		TC:       h.Truncated,
+		RD:       h.RecursionDesired,
+		RA:       h.RecursionAvailable,
+		AD:       h.AuthenticData,
+		CD:       h.CheckingDisabled,
+		Question: []Question{},
+		Answer:   []Answer{},
+	}
+
+	qs, err := p.AllQuestions()
+	if err != nil {
+		return nil, fmt.Errorf("doh: dns: invalid message: %s", err)
+	}
+
+	for _, v := range qs {
+		rr.Question = append(rr.Question, Question{Name: v.Name.String(), Type: int(v.Type)})
+	}
+
+	for {
+		h, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("doh: dns: invalid message: %s", err)
+		}
+		data, err := answerData(&p, h)
+		if err != nil {
+			return nil, fmt.Errorf("doh: dns: invalid message: %s", err)
+		}
+		rr.Answer = append(rr.Answer, Answer{
+			Name: h.Name.String(),
+			Type: int(h.Type),
+			TTL:  int(h.TTL),
+			Data: data,
+		})
+	}
+
+	return rr, nil
+}
+
+// answerData returns the presentation format data of the answer of header,
+// the types not modeled are in the RFC 3597 generic encoding, for example: \# 2 abcd
+func answerData(p *dnsmessage.Parser, h dnsmessage.ResourceHeader) (string, error) {
+	var body dnsmessage.ResourceBody
+	var err error
+
+	switch h.Type {
+	case dnsmessage.TypeA:
+		var r dnsmessage.AResource
+		r, err = p.AResource()
+		body = &r
+	case dnsmessage.TypeAAAA:
+		var r dnsmessage.AAAAResource
+		r, err = p.AAAAResource()
+		body = &r
+	case dnsmessage.TypeCNAME:
+		var r dnsmessage.CNAMEResource
+		r, err = p.CNAMEResource()
+		body = &r
+	case dnsmessage.TypeNS:
+		var r dnsmessage.NSResource
+		r, err = p.NSResource()
+		body = &r
+	case dnsmessage.TypePTR:
+		var r dnsmessage.PTRResource
+		r, err = p.PTRResource()
+		body = &r
+	case dnsmessage.TypeMX:
+		var r dnsmessage.MXResource
+		r, err = p.MXResource()
+		body = &r
+	case dnsmessage.TypeSRV:
+		var r dnsmessage.SRVResource
+		r, err = p.SRVResource()
+		body = &r
+	case dnsmessage.TypeSOA:
+		var r dnsmessage.SOAResource
+		r, err = p.SOAResource()
+		body = &r
+	case dnsmessage.TypeTXT:
+		var r dnsmessage.TXTResource
+		r, err = p.TXTResource()
+		body = &r
+	default:
+		r, err := p.UnknownResource()
+		if err != nil {
+			return "", err
+		}
+		// SPF has the same data as TXT
+		if ss, ok := characterStrings(r.Data); ok && h.Type == dnsmessage.Type(99) {
+			body = &dnsmessage.TXTResource{TXT: ss}
+			break
+		}
+		return genericData(r.Data), nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	data, _ := resourceData(body)
+
+	return data, nil
+}
+
+// genericData returns the RFC 3597 generic encoding of resource data
+func genericData(b []byte) string {
+	if len(b) == 0 {
+		return `\# 0`
+	}
+
+	return fmt.Sprintf(`\# %d %x`, len(b), b)
+}
+
+// parseGeneric returns the resource data of RFC 3597 generic encoding, the hex may be split by spaces
+func parseGeneric(s string) ([]byte, bool) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 || fields[0] != `\#` {
+		return nil, false
+	}
+
+	n, err := strconv.Atoi(fields[1])
+	if err != nil || n < 0 || n > 0xffff {
+		return nil, false
+	}
+
+	b, err := hex.DecodeString(strings.Join(fields[2:], ""))
+	if err != nil || len(b) != n {
+		return nil, false
+	}
+
+	return b, true
+}
+
+// characterStrings returns the strings of length prefixed character strings
+func characterStrings(b []byte) ([]string, bool) {
+	ss := []string{}
+	for len(b) > 0 {
+		n := int(b[0])
+		if len(b) < n+1 {
+			return nil, false
+		}
+		ss = append(ss, string(b[1:n+1]))
+		b = b[n+1:]
+	}
+
+	return ss, len(ss) > 0
+}
+
+// Decode returns the response of body, the parser is chosen by the response content type
+func Decode(contentType string, b []byte) (*Response, error) {
+	if FormatOf(contentType) == FormatMessage {
+		return ParseMessage(b)
+	}
+
+	rr := &Response{}
+	if err := json.Unmarshal(b, rr); err != nil {
+		return nil, err
+	}
+
+	return rr, nil
+}
+
+// maxPooledSize is the max capacity of buffers put back to pool, the larger ones are freed
+const maxPooledSize = 64 << 10
+
+// bufferPool is the pool of buffers reading the wire format messages, which are copied out by parsing
+var bufferPool = sync.Pool{
+	New: func() any {
+		return &bytes.Buffer{}
+	},
+}
+
+// putBuffer puts the buffer back to pool if it is not too large
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledSize {
+		bufferPool.Put(buf)
+	}
+}
+
+// DecodeReader returns the response decoded from r in stream, the json body is not buffered as a whole
+func DecodeReader(contentType string, r io.Reader) (*Response, error) {
+	if FormatOf(contentType) == FormatMessage {
+		buf := bufferPool.Get().(*bytes.Buffer)
+		defer putBuffer(buf)
+		buf.Reset()
+		if _, err := buf.ReadFrom(io.LimitReader(r, MaxMessageSize+1)); err != nil {
+			return nil, err
+		}
+		if buf.Len() > MaxMessageSize {
+			return nil, fmt.Errorf("doh: dns: message too large: more than %d bytes", MaxMessageSize)
+		}
+		return ParseMessage(buf.Bytes())
+	}
+
+	rr := &Response{}
+	if err := json.NewDecoder(r).Decode(rr); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return nil, err
+	}
+
+	return rr, nil
+}
+
+// resourceData returns the presentation format data of resource as the json api
+func resourceData(body dnsmessage.ResourceBody) (string, bool) {
+	switch r := body.(type) {
+	case *dnsmessage.AResource:
+		return net.IP(r.A[:]).String(), true
+	case *dnsmessage.AAAAResource:
+		return net.IP(r.AAAA[:]).String(), true
+	case *dnsmessage.CNAMEResource:
+		return r.CNAME.String(), true
+	case *dnsmessage.NSResource:
+		return r.NS.String(), true
+	case *dnsmessage.PTRResource:
+		return r.PTR.String(), true
+	case *dnsmessage.MXResource:
+		return fmt.Sprintf("%d %s", r.Pref, r.MX.String()), true
+	case *dnsmessage.SRVResource:
+		return fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, r.Target.String()), true
+	case *dnsmessage.SOAResource:
+		return fmt.Sprintf("%s %s %d %d %d %d %d", r.NS.String(), r.MBox.String(),
+			r.Serial, r.Refresh, r.Retry, r.Expire, r.MinTTL), true
+	case *dnsmessage.TXTResource:
+		ss := []string{}
+		for _, v := range r.TXT {
+			ss = append(ss, strconv.Quote(v))
+		}
+		return strings.Join(ss, " "), true
+	default:
+		return "", false
+	}
+}
+
+// ecsOption returns the edns0-client-subnet option of subnet, for example: 1.2.3.4/24
+func ecsOption(s string) (dnsmessage.Option, error) {
+	ss, err := ECS(s).Subnet()
+	if err != nil {
+		return dnsmessage.Option{}, err
+	}
+
+	p, err := netip.ParsePrefix(ss)
+	if err != nil {
+		return dnsmessage.Option{}, fmt.Errorf("doh: dns: invalid ecs: %s", err)
+	}
+
+	family := 1
+	if p.Addr().Is6() {
+		family = 2
+	}
+
+	data := []byte{0, byte(family), byte(p.Bits()), 0}
+	data = append(data, p.Masked().Addr().AsSlice()[:(p.Bits()+7)/8]...)
+
+	return dnsmessage.Option{Code: 8, Data: data}, nil
+}
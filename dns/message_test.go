@@ -0,0 +1,307 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/likexian/gokit/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, FormatAuto.String(), "auto")
+	assert.Equal(t, FormatJSON.String(), "json")
+	assert.Equal(t, FormatMessage.String(), "message")
+
+	assert.Equal(t, FormatAuto.ContentType(), "")
+	assert.Equal(t, FormatJSON.ContentType(), ContentTypeJSON)
+	assert.Equal(t, FormatMessage.ContentType(), ContentTypeMessage)
+
+	assert.Equal(t, FormatOf("application/dns-message"), FormatMessage)
+	assert.Equal(t, FormatOf("application/dns-json"), FormatJSON)
+	assert.Equal(t, FormatOf("application/x-javascript; charset=UTF-8"), FormatJSON)
+}
+
+func TestTypeCode(t *testing.T) {
+	code, err := TypeA.Code()
+	assert.Nil(t, err)
+	assert.Equal(t, code, uint16(1))
+
+	code, err = Type("aaaa").Code()
+	assert.Nil(t, err)
+	assert.Equal(t, code, uint16(28))
+
+	_, err = Type("XX").Code()
+	assert.NotNil(t, err)
+
+	assert.Equal(t, TypeOf(15), TypeMX)
+	assert.Equal(t, TypeOf(65), Type("TYPE65"))
+
+	code, err = Type("type65").Code()
+	assert.Nil(t, err)
+	assert.Equal(t, code, uint16(65))
+
+	_, err = Type("TYPE65536").Code()
+	assert.NotNil(t, err)
+
+	code, err = Type(" 65 ").Code()
+	assert.Nil(t, err)
+	assert.Equal(t, code, uint16(65))
+
+	_, err = Type("-1").Code()
+	assert.NotNil(t, err)
+
+	assert.Equal(t, Type("a").Normalize(), TypeA)
+	assert.Equal(t, Type("1").Normalize(), TypeA)
+	assert.Equal(t, Type("type1").Normalize(), TypeA)
+	assert.Equal(t, Type("65").Normalize(), Type("TYPE65"))
+	assert.Equal(t, Type("XX").Normalize(), Type("XX"))
+
+	assert.Equal(t, Type("mx").Param(), "MX")
+	assert.Equal(t, Type("TYPE65").Param(), "65")
+	assert.Equal(t, Type("XX").Param(), "XX")
+
+	assert.Equal(t, RcodeName(0), "NOERROR")
+	assert.Equal(t, RcodeName(3), "NXDOMAIN")
+	assert.Equal(t, RcodeName(23), "RCODE23")
+}
+
+func TestNewQuery(t *testing.T) {
+	_, err := NewQuery("likexian.com", Type("XX"), "", Flags{})
+	assert.NotNil(t, err)
+
+	_, err = NewQuery("likexian.com", TypeA, "xx", Flags{})
+	assert.NotNil(t, err)
+
+	b, err := NewQuery("likexian.com", TypeA, "1.2.3.4/24", Flags{CD: true, DO: true})
+	assert.Nil(t, err)
+
+	var p dnsmessage.Parser
+	h, err := p.Start(b)
+	assert.Nil(t, err)
+	assert.Equal(t, h.ID, uint16(0))
+	assert.True(t, h.RecursionDesired)
+	assert.True(t, h.CheckingDisabled)
+
+	q, err := p.Question()
+	assert.Nil(t, err)
+	assert.Equal(t, q.Name.String(), "likexian.com.")
+	assert.Equal(t, q.Type, dnsmessage.TypeA)
+	assert.Equal(t, q.Class, dnsmessage.ClassINET)
+
+	assert.Nil(t, p.SkipAllQuestions())
+	assert.Nil(t, p.SkipAllAnswers())
+	assert.Nil(t, p.SkipAllAuthorities())
+	r, err := p.Additional()
+	assert.Nil(t, err)
+	assert.True(t, r.Header.DNSSECAllowed())
+	opt := r.Body.(*dnsmessage.OPTResource)
+	assert.Equal(t, opt.Options[0].Code, uint16(8))
+	assert.Equal(t, opt.Options[0].Data, []byte{0, 1, 24, 0, 1, 2, 3})
+
+	b, err = NewQuery("likexian.com", TypeA, "", Flags{NoRD: true})
+	assert.Nil(t, err)
+	h, err = p.Start(b)
+	assert.Nil(t, err)
+	assert.False(t, h.RecursionDesired)
+
+	b, err = NewQuery("id.server", TypeTXT, "", Flags{Chaos: true})
+	assert.Nil(t, err)
+	_, err = p.Start(b)
+	assert.Nil(t, err)
+	q, err = p.Question()
+	assert.Nil(t, err)
+	assert.Equal(t, q.Class, dnsmessage.ClassCHAOS)
+
+	o, err := ecsOption("2001:db8::1")
+	assert.Nil(t, err)
+	assert.Equal(t, o.Data, []byte{0, 2, 56, 0, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0})
+}
+
+func TestECSOptionMapped(t *testing.T) {
+	for _, v := range []string{"::ffff:1.2.3.4", "::ffff:1.2.3.4/120"} {
+		o, err := ecsOption(v)
+		assert.Nil(t, err)
+		assert.Equal(t, o.Data, []byte{0, 1, 24, 0, 1, 2, 3})
+
+		_, err = NewQuery("likexian.com", TypeA, ECS(v), Flags{})
+		assert.Nil(t, err)
+	}
+
+	o, err := ecsOption("::ffff:1.2.3.4/128")
+	assert.Nil(t, err)
+	assert.Equal(t, o.Data, []byte{0, 1, 32, 0, 1, 2, 3, 4})
+
+	for _, v := range []string{"::ffff:1.2.3.4/64", "1.2.3.4/33", "2001:db8::1/129", "1.2.3.4/x", "fe80::1%eth0", "x"} {
+		_, err = NewQuery("likexian.com", TypeA, ECS(v), Flags{})
+		assert.NotNil(t, err)
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	_, err := ParseMessage([]byte("xx"))
+	assert.NotNil(t, err)
+
+	name := dnsmessage.MustNewName("likexian.com.")
+	target := dnsmessage.MustNewName("mx.likexian.com.")
+	rh := func(t dnsmessage.Type) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: name, Type: t, Class: dnsmessage.ClassINET, TTL: 300}
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true, RecursionDesired: true,
+		RecursionAvailable: true, AuthenticData: true, RCode: dnsmessage.RCodeSuccess})
+	assert.Nil(t, b.StartQuestions())
+	assert.Nil(t, b.Question(dnsmessage.Question{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}))
+	assert.Nil(t, b.StartAnswers())
+	assert.Nil(t, b.AResource(rh(dnsmessage.TypeA), dnsmessage.AResource{A: [4]byte{1, 1, 1, 1}}))
+	assert.Nil(t, b.AAAAResource(rh(dnsmessage.TypeAAAA), dnsmessage.AAAAResource{AAAA: [16]byte{0x20, 0x01, 15: 1}}))
+	assert.Nil(t, b.CNAMEResource(rh(dnsmessage.TypeCNAME), dnsmessage.CNAMEResource{CNAME: target}))
+	assert.Nil(t, b.MXResource(rh(dnsmessage.TypeMX), dnsmessage.MXResource{Pref: 10, MX: target}))
+	assert.Nil(t, b.TXTResource(rh(dnsmessage.TypeTXT), dnsmessage.TXTResource{TXT: []string{"v=spf1 -all", "x"}}))
+	assert.Nil(t, b.SRVResource(rh(dnsmessage.TypeSRV), dnsmessage.SRVResource{Priority: 1, Weight: 2, Port: 443, Target: target}))
+	assert.Nil(t, b.SOAResource(rh(dnsmessage.TypeSOA), dnsmessage.SOAResource{NS: target, MBox: name,
+		Serial: 1, Refresh: 2, Retry: 3, Expire: 4, MinTTL: 5}))
+	assert.Nil(t, b.NSResource(rh(dnsmessage.TypeNS), dnsmessage.NSResource{NS: target}))
+	assert.Nil(t, b.PTRResource(rh(dnsmessage.TypePTR), dnsmessage.PTRResource{PTR: target}))
+	msg, err := b.Finish()
+	assert.Nil(t, err)
+
+	rsp, err := ParseMessage(msg)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Status, 0)
+	assert.True(t, rsp.RD)
+	assert.True(t, rsp.RA)
+	assert.True(t, rsp.AD)
+	assert.Equal(t, rsp.Question, []Question{{Name: "likexian.com.", Type: 1}})
+
+	data := []string{}
+	for _, v := range rsp.Answer {
+		assert.Equal(t, v.Name, "likexian.com.")
+		assert.Equal(t, v.TTL, 300)
+		data = append(data, v.Data)
+	}
+
+	assert.Equal(t, data, []string{
+		"1.1.1.1",
+		"2001::1",
+		"mx.likexian.com.",
+		"10 mx.likexian.com.",
+		`"v=spf1 -all" "x"`,
+		"1 2 443 mx.likexian.com.",
+		"mx.likexian.com. likexian.com. 1 2 3 4 5",
+		"mx.likexian.com.",
+		"mx.likexian.com.",
+	})
+}
+
+func TestDecode(t *testing.T) {
+	_, err := Decode(ContentTypeJSON, []byte("xx"))
+	assert.NotNil(t, err)
+
+	_, err = Decode(ContentTypeMessage, []byte("xx"))
+	assert.NotNil(t, err)
+
+	rsp, err := Decode(ContentTypeJSON, []byte(`{"Status":0,"Answer":[{"name":"likexian.com","type":1,"TTL":300,"data":"1.1.1.1"}]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+
+	b, err := NewQuery("likexian.com", TypeA, "", Flags{})
+	assert.Nil(t, err)
+	rsp, err = Decode(ContentTypeMessage, b)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Question[0].Name, "likexian.com.")
+	assert.Equal(t, len(rsp.Answer), 0)
+}
+
+func TestDecodeReader(t *testing.T) {
+	_, err := DecodeReader(ContentTypeJSON, strings.NewReader("xx"))
+	assert.NotNil(t, err)
+
+	_, err = DecodeReader(ContentTypeMessage, strings.NewReader("xx"))
+	assert.NotNil(t, err)
+
+	_, err = DecodeReader(ContentTypeJSON, iotest.TimeoutReader(strings.NewReader(`{"Status":0}`)))
+	assert.NotNil(t, err)
+
+	rsp, err := DecodeReader(ContentTypeJSON, iotest.OneByteReader(strings.NewReader(
+		`{"Status":0,"Answer":[{"name":"likexian.com","type":1,"TTL":300,"data":"1.1.1.1"}]}`+"\n")))
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+
+	b, err := NewQuery("likexian.com", TypeA, "", Flags{})
+	assert.Nil(t, err)
+	rsp, err = DecodeReader(ContentTypeMessage, bytes.NewReader(b))
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Question[0].Name, "likexian.com.")
+
+	large := append(b, make([]byte, MaxMessageSize)...)
+	_, err = DecodeReader(ContentTypeMessage, bytes.NewReader(large))
+	assert.Contains(t, err.Error(), "too large")
+	_, err = ParseMessage(large)
+	assert.Contains(t, err.Error(), "too large")
+	_, err = ParseQuery(large)
+	assert.Contains(t, err.Error(), "too large")
+}
+
+func TestDecodeReaderPool(t *testing.T) {
+	a, err := NewQuery("likexian.com", TypeA, "", Flags{})
+	assert.Nil(t, err)
+	b, err := NewQuery("example.org", TypeAAAA, "", Flags{})
+	assert.Nil(t, err)
+
+	ra, err := DecodeReader(ContentTypeMessage, bytes.NewReader(a))
+	assert.Nil(t, err)
+	rb, err := DecodeReader(ContentTypeMessage, bytes.NewReader(b))
+	assert.Nil(t, err)
+	assert.Equal(t, ra.Question[0].Name, "likexian.com.")
+	assert.Equal(t, rb.Question[0].Name, "example.org.")
+
+	buf := &bytes.Buffer{}
+	buf.Grow(maxPooledSize + 1)
+	putBuffer(buf)
+}
+
+func BenchmarkParseMessage(b *testing.B) {
+	rsp := &Response{Question: []Question{{Name: "likexian.com.", Type: 1}},
+		Answer: []Answer{{Name: "likexian.com.", Type: 1, TTL: 300, Data: "1.1.1.1"},
+			{Name: "likexian.com.", Type: 1, TTL: 300, Data: "1.0.0.1"}}}
+	msg, err := rsp.Pack(1)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = ParseMessage(msg)
+	}
+}
+
+func BenchmarkDecodeReader(b *testing.B) {
+	body := `{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = DecodeReader(ContentTypeJSON, strings.NewReader(body))
+	}
+}
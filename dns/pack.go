@@ -0,0 +1,224 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Pack returns the RFC 8484 wire format message of response with id,
+// answers of types not supported by the wire format are skipped
+func (r *Response) Pack(id uint16) ([]byte, error) {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:                 id,
+		Response:           true,
+		Truncated:          r.TC,
+		RecursionDesired:   r.RD,
+		RecursionAvailable: r.RA,
+		AuthenticData:      r.AD,
+		CheckingDisabled:   r.CD,
+		RCode:              dnsmessage.RCode(r.Status),
+	})
+	b.EnableCompression()
+
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+
+	for _, v := range r.Question {
+		n, err := newName(v.Name)
+		if err != nil {
+			return nil, err
+		}
+		err = b.Question(dnsmessage.Question{Name: n, Type: dnsmessage.Type(v.Type), Class: dnsmessage.ClassINET})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+
+	for _, v := range r.Answer {
+		if err := packAnswer(&b, v); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.Finish()
+}
+
+// packAnswer adds the answer to builder, the types not supported are skipped unless in the RFC 3597 generic encoding
+func packAnswer(b *dnsmessage.Builder, a Answer) error {
+	n, err := newName(a.Name)
+	if err != nil {
+		return err
+	}
+
+	h := dnsmessage.ResourceHeader{Name: n, Type: dnsmessage.Type(a.Type), Class: dnsmessage.ClassINET, TTL: uint32(a.TTL)}
+	fields := strings.Fields(a.Data)
+
+	switch h.Type {
+	case dnsmessage.TypeA:
+		ip := net.ParseIP(a.Data).To4()
+		if ip == nil {
+			return fmt.Errorf("doh: dns: invalid A data: %s", clip(a.Data))
+		}
+		r := dnsmessage.AResource{}
+		copy(r.A[:], ip)
+		return b.AResource(h, r)
+	case dnsmessage.TypeAAAA:
+		ip := net.ParseIP(a.Data)
+		if ip == nil || ip.To4() != nil {
+			return fmt.Errorf("doh: dns: invalid AAAA data: %s", clip(a.Data))
+		}
+		r := dnsmessage.AAAAResource{}
+		copy(r.AAAA[:], ip)
+		return b.AAAAResource(h, r)
+	case dnsmessage.TypeCNAME, dnsmessage.TypeNS, dnsmessage.TypePTR:
+		t, err := newName(a.Data)
+		if err != nil {
+			return err
+		}
+		switch h.Type {
+		case dnsmessage.TypeCNAME:
+			return b.CNAMEResource(h, dnsmessage.CNAMEResource{CNAME: t})
+		case dnsmessage.TypeNS:
+			return b.NSResource(h, dnsmessage.NSResource{NS: t})
+		default:
+			return b.PTRResource(h, dnsmessage.PTRResource{PTR: t})
+		}
+	case dnsmessage.TypeMX:
+		v, err := parseUints(fields, 1, 2)
+		if err != nil {
+			return fmt.Errorf("doh: dns: invalid MX data: %s", clip(a.Data))
+		}
+		t, err := newName(fields[1])
+		if err != nil {
+			return err
+		}
+		return b.MXResource(h, dnsmessage.MXResource{Pref: uint16(v[0]), MX: t})
+	case dnsmessage.TypeSRV:
+		v, err := parseUints(fields, 3, 4)
+		if err != nil {
+			return fmt.Errorf("doh: dns: invalid SRV data: %s", clip(a.Data))
+		}
+		t, err := newName(fields[3])
+		if err != nil {
+			return err
+		}
+		return b.SRVResource(h, dnsmessage.SRVResource{Priority: uint16(v[0]), Weight: uint16(v[1]),
+			Port: uint16(v[2]), Target: t})
+	case dnsmessage.TypeSOA:
+		if len(fields) != 7 {
+			return fmt.Errorf("doh: dns: invalid SOA data: %s", clip(a.Data))
+		}
+		v, err := parseUints(fields[2:], 5, 5)
+		if err != nil {
+			return fmt.Errorf("doh: dns: invalid SOA data: %s", clip(a.Data))
+		}
+		ns, err := newName(fields[0])
+		if err != nil {
+			return err
+		}
+		mbox, err := newName(fields[1])
+		if err != nil {
+			return err
+		}
+		return b.SOAResource(h, dnsmessage.SOAResource{NS: ns, MBox: mbox, Serial: uint32(v[0]),
+			Refresh: uint32(v[1]), Retry: uint32(v[2]), Expire: uint32(v[3]), MinTTL: uint32(v[4])})
+	case dnsmessage.TypeTXT:
+		return b.TXTResource(h, dnsmessage.TXTResource{TXT: parseTXT(a.Data)})
+	case dnsmessage.Type(99):
+		// the builder packs the TXT resources as TXT type, so SPF is packed as an unknown resource
+		data := []byte{}
+		for _, v := range parseTXT(a.Data) {
+			if len(v) > 255 {
+				return fmt.Errorf("doh: dns: invalid SPF data: %s", clip(a.Data))
+			}
+			data = append(append(data, byte(len(v))), v...)
+		}
+		return b.UnknownResource(h, dnsmessage.UnknownResource{Type: h.Type, Data: data})
+	default:
+		if data, ok := parseGeneric(a.Data); ok {
+			return b.UnknownResource(h, dnsmessage.UnknownResource{Type: h.Type, Data: data})
+		}
+		return nil
+	}
+}
+
+// newName returns the dns name of s, the trailing dot is added if missing
+func newName(s string) (dnsmessage.Name, error) {
+	if !strings.HasSuffix(s, ".") {
+		s += "."
+	}
+
+	n, err := dnsmessage.NewName(s)
+	if err != nil {
+		return n, fmt.Errorf("doh: dns: invalid name: %s", err)
+	}
+
+	return n, nil
+}
+
+// parseUints returns the first n unsigned integers of fields, fields must have size items
+func parseUints(fields []string, n, size int) ([]uint64, error) {
+	if len(fields) != size {
+		return nil, fmt.Errorf("doh: dns: invalid fields size: %d", len(fields))
+	}
+
+	result := []uint64{}
+	for _, v := range fields[:n] {
+		u, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, u)
+	}
+
+	return result, nil
+}
+
+// parseTXT returns the strings of txt data, quoted strings are unquoted
+func parseTXT(s string) []string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, `"`) {
+		return []string{s}
+	}
+
+	result := []string{}
+	for s != "" {
+		q, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return append(result, s)
+		}
+		v, _ := strconv.Unquote(q)
+		result = append(result, v)
+		s = strings.TrimSpace(s[len(q):])
+	}
+
+	return result
+}
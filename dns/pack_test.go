@@ -0,0 +1,135 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestPack(t *testing.T) {
+	r := &Response{
+		Status:   0,
+		RD:       true,
+		RA:       true,
+		AD:       true,
+		Question: []Question{{Name: "likexian.com", Type: 1}},
+		Answer: []Answer{
+			{Name: "likexian.com.", Type: 1, TTL: 300, Data: "1.1.1.1"},
+			{Name: "likexian.com.", Type: 28, TTL: 300, Data: "2001::1"},
+			{Name: "likexian.com.", Type: 5, TTL: 300, Data: "mx.likexian.com."},
+			{Name: "likexian.com.", Type: 15, TTL: 300, Data: "10 mx.likexian.com."},
+			{Name: "likexian.com.", Type: 16, TTL: 300, Data: `"v=spf1 -all" "x"`},
+			{Name: "likexian.com.", Type: 33, TTL: 300, Data: "1 2 443 mx.likexian.com."},
+			{Name: "likexian.com.", Type: 6, TTL: 300, Data: "mx.likexian.com. likexian.com. 1 2 3 4 5"},
+			{Name: "likexian.com.", Type: 2, TTL: 300, Data: "mx.likexian.com."},
+			{Name: "likexian.com.", Type: 12, TTL: 300, Data: "mx.likexian.com."},
+			{Name: "likexian.com.", Type: 99, TTL: 300, Data: `"v=spf1 -all"`},
+			{Name: "likexian.com.", Type: 65, TTL: 300, Data: `\# 3 010203`},
+			{Name: "likexian.com.", Type: 13, TTL: 300, Data: `\# 0`},
+			{Name: "likexian.com.", Type: 257, TTL: 300, Data: "0 issue \"letsencrypt.org\""},
+		},
+	}
+
+	b, err := r.Pack(1)
+	assert.Nil(t, err)
+	assert.Equal(t, b[:2], []byte{0, 1})
+
+	rr, err := ParseMessage(b)
+	assert.Nil(t, err)
+	assert.True(t, rr.RD)
+	assert.True(t, rr.RA)
+	assert.True(t, rr.AD)
+	assert.Equal(t, rr.Question, []Question{{Name: "likexian.com.", Type: 1}})
+	assert.Equal(t, rr.Answer, r.Answer[:12])
+
+	tests := []Answer{
+		{Name: "likexian.com", Type: 1, Data: "2001::1"},
+		{Name: "likexian.com", Type: 28, Data: "1.1.1.1"},
+		{Name: "likexian.com", Type: 15, Data: "10"},
+		{Name: "likexian.com", Type: 15, Data: "x mx.likexian.com"},
+		{Name: "likexian.com", Type: 33, Data: "1 2 mx.likexian.com"},
+		{Name: "likexian.com", Type: 6, Data: "mx.likexian.com. likexian.com. 1 2 3 4"},
+		{Name: "likexian.com", Type: 6, Data: "mx.likexian.com. likexian.com. 1 2 3 4 x"},
+		{Name: "likexian..com", Type: 1, Data: "1.1.1.1"},
+		{Name: "likexian.com", Type: 5, Data: "likexian..com"},
+		{Name: "likexian.com", Type: 99, Data: strings.Repeat("x", 256)},
+	}
+
+	for _, v := range tests {
+		_, err := (&Response{Answer: []Answer{v}}).Pack(0)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestGenericData(t *testing.T) {
+	assert.Equal(t, genericData(nil), `\# 0`)
+	assert.Equal(t, genericData([]byte{0xab, 0xcd}), `\# 2 abcd`)
+
+	tests := []struct {
+		in  string
+		out []byte
+		ok  bool
+	}{
+		{`\# 0`, []byte{}, true},
+		{`\# 2 abcd`, []byte{0xab, 0xcd}, true},
+		{`\# 3 ab cd EF`, []byte{0xab, 0xcd, 0xef}, true},
+		{`\# 3 abcd`, nil, false},
+		{`\# x abcd`, nil, false},
+		{`\# 1 xx`, nil, false},
+		{`\#`, nil, false},
+		{`1 2 abcd`, nil, false},
+	}
+
+	for _, v := range tests {
+		b, ok := parseGeneric(v.in)
+		assert.Equal(t, ok, v.ok, v.in)
+		if v.ok {
+			assert.Equal(t, b, v.out)
+		}
+	}
+
+	ss, ok := characterStrings([]byte{1, 'a', 2, 'b', 'c'})
+	assert.True(t, ok)
+	assert.Equal(t, ss, []string{"a", "bc"})
+	_, ok = characterStrings([]byte{3, 'a'})
+	assert.False(t, ok)
+	_, ok = characterStrings(nil)
+	assert.False(t, ok)
+}
+
+func TestParseTXT(t *testing.T) {
+	assert.Equal(t, parseTXT("v=spf1 -all"), []string{"v=spf1 -all"})
+	assert.Equal(t, parseTXT(`"v=spf1 -all"`), []string{"v=spf1 -all"})
+	assert.Equal(t, parseTXT(`"a\"b" "c"`), []string{`a"b`, "c"})
+	assert.Equal(t, parseTXT(`"a" "b`), []string{"a", `"b`})
+}
+
+func BenchmarkPack(b *testing.B) {
+	rsp := &Response{Question: []Question{{Name: "likexian.com.", Type: 1}},
+		Answer: []Answer{{Name: "likexian.com.", Type: 1, TTL: 300, Data: "1.1.1.1"}}}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = rsp.Pack(1)
+	}
+}
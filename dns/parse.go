@@ -0,0 +1,324 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Parsing is the strictness of parsing the json responses, the wire format is always parsed strictly
+type Parsing int
+
+// Supported parsing modes
+const (
+	// ParsingDefault decodes the json responses ignoring the unknown fields
+	ParsingDefault Parsing = iota
+	// ParsingStrict rejects the unknown fields, missing status, invalid records and trailing data
+	ParsingStrict
+	// ParsingLenient tolerates the provider quirks, for example the numbers and booleans in strings
+	ParsingLenient
+)
+
+// strictResponse is the json response with all the known fields of the DoH json api
+type strictResponse struct {
+	Status     *int       `json:"Status"`
+	TC         bool       `json:"TC"`
+	RD         bool       `json:"RD"`
+	RA         bool       `json:"RA"`
+	AD         bool       `json:"AD"`
+	CD         bool       `json:"CD"`
+	Question   []Question `json:"Question"`
+	Answer     []Answer   `json:"Answer"`
+	Authority  []Answer   `json:"Authority"`
+	Additional []Answer   `json:"Additional"`
+	Comment    string     `json:"Comment"`
+	ECS        ECS        `json:"edns_client_subnet"`
+}
+
+// String returns string of parsing mode
+func (p Parsing) String() string {
+	switch p {
+	case ParsingStrict:
+		return "strict"
+	case ParsingLenient:
+		return "lenient"
+	default:
+		return "default"
+	}
+}
+
+// DecodeReader returns the response decoded from r in the parsing mode, it is the same as DecodeReader
+// for the wire format and the default mode
+func (p Parsing) DecodeReader(contentType string, r io.Reader) (*Response, error) {
+	if FormatOf(contentType) == FormatMessage {
+		return DecodeReader(contentType, r)
+	}
+
+	switch p {
+	case ParsingStrict:
+		return decodeStrict(r)
+	case ParsingLenient:
+		return decodeLenient(r)
+	default:
+		return DecodeReader(contentType, r)
+	}
+}
+
+// decodeStrict returns the response of json in r, the errors tell the field and offset failed
+func decodeStrict(r io.Reader) (*Response, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	v := strictResponse{}
+	if err := dec.Decode(&v); err != nil {
+		var te *json.UnmarshalTypeError
+		var se *json.SyntaxError
+		switch {
+		case errors.As(err, &te):
+			return nil, fmt.Errorf("doh: dns: strict: invalid %s at offset %d: got %s, want %s",
+				te.Field, te.Offset, te.Value, te.Type)
+		case errors.As(err, &se):
+			return nil, fmt.Errorf("doh: dns: strict: invalid json at offset %d: %w", se.Offset, err)
+		default:
+			return nil, fmt.Errorf("doh: dns: strict: %w", clipError(err))
+		}
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("doh: dns: strict: trailing data at offset %d", dec.InputOffset())
+	}
+
+	if v.Status == nil {
+		return nil, fmt.Errorf("doh: dns: strict: missing Status")
+	}
+
+	for k, q := range v.Question {
+		if q.Name == "" || q.Type <= 0 || q.Type > 0xffff {
+			return nil, fmt.Errorf("doh: dns: strict: invalid Question[%d]: %s", k, clip(fmt.Sprintf("%+v", q)))
+		}
+	}
+
+	for k, a := range v.Answer {
+		if a.Name == "" || a.Type <= 0 || a.Type > 0xffff || a.TTL < 0 {
+			return nil, fmt.Errorf("doh: dns: strict: invalid Answer[%d]: %s", k, clip(fmt.Sprintf("%+v", a)))
+		}
+	}
+
+	rr := &Response{
+		Status:   *v.Status,
+		TC:       v.TC,
+		RD:       v.RD,
+		RA:       v.RA,
+		AD:       v.AD,
+		CD:       v.CD,
+		Question: v.Question,
+		Answer:   v.Answer,
+		Comment:  v.Comment,
+		ECS:      v.ECS,
+	}
+
+	return rr, nil
+}
+
+// decodeLenient returns the response of json in r, the garbage around the json object and the fields
+// in unexpected types are tolerated, the records unable to parse are skipped
+func decodeLenient(r io.Reader) (*Response, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	i := bytes.IndexByte(b, '{')
+	if i < 0 {
+		return nil, fmt.Errorf("doh: dns: lenient: no json object found")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b[i:]))
+	dec.UseNumber()
+
+	m := map[string]any{}
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("doh: dns: lenient: %w", clipError(err))
+	}
+
+	rr := &Response{Question: []Question{}, Answer: []Answer{}}
+	status := false
+	for k, v := range m {
+		switch strings.ToLower(k) {
+		case "status":
+			if rr.Status, status = lenientInt(v); !status {
+				return nil, fmt.Errorf("doh: dns: lenient: invalid Status: %s", clip(fmt.Sprint(v)))
+			}
+		case "tc":
+			rr.TC = lenientBool(v)
+		case "rd":
+			rr.RD = lenientBool(v)
+		case "ra":
+			rr.RA = lenientBool(v)
+		case "ad":
+			rr.AD = lenientBool(v)
+		case "cd":
+			rr.CD = lenientBool(v)
+		case "comment":
+			rr.Comment = lenientString(v)
+		case "edns_client_subnet":
+			rr.ECS = ECS(lenientString(v))
+		case "question":
+			for _, q := range lenientList(v) {
+				name, _ := lenientField(q, "name").(string)
+				t, ok := lenientType(lenientField(q, "type"))
+				if ok && name != "" {
+					rr.Question = append(rr.Question, Question{Name: name, Type: t})
+				}
+			}
+		case "answer":
+			for _, a := range lenientList(v) {
+				name, _ := lenientField(a, "name").(string)
+				t, ok := lenientType(lenientField(a, "type"))
+				if !ok || name == "" {
+					continue
+				}
+				ttl, _ := lenientInt(lenientField(a, "TTL"))
+				rr.Answer = append(rr.Answer, Answer{Name: name, Type: t, TTL: max(ttl, 0),
+					Data: lenientString(lenientField(a, "data"))})
+			}
+		}
+	}
+
+	if !status {
+		return nil, fmt.Errorf("doh: dns: lenient: missing Status")
+	}
+
+	return rr, nil
+}
+
+// lenientField returns the value of key in json object, the key is case insensitive
+func lenientField(m map[string]any, key string) any {
+	if v, ok := m[key]; ok {
+		return v
+	}
+
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// lenientInt returns the int of json number, numeric string or boolean
+func lenientInt(v any) (int, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return int(n), true
+		}
+		if f, err := v.Float64(); err == nil {
+			return int(f), true
+		}
+	case string:
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			return n, true
+		}
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// lenientBool returns the boolean of json boolean, number or string, false if unable to parse
+func lenientBool(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(strings.TrimSpace(v))
+		return b
+	default:
+		n, _ := lenientInt(v)
+		return n != 0
+	}
+}
+
+// lenientType returns the type code of json number, numeric string or type name, for example: AAAA
+func lenientType(v any) (int, bool) {
+	if n, ok := lenientInt(v); ok {
+		return n, n > 0 && n <= 0xffff
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return 0, false
+	}
+
+	code, err := Type(s).Code()
+	if err != nil {
+		return 0, false
+	}
+
+	return int(code), true
+}
+
+// lenientString returns the string of json value, the non-string ones are formatted and the arrays are joined
+func lenientString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []any:
+		ss := []string{}
+		for _, x := range v {
+			ss = append(ss, lenientString(x))
+		}
+		return strings.Join(ss, "; ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// lenientList returns the objects of json array, or the object itself if it is not an array
+func lenientList(v any) []map[string]any {
+	switch v := v.(type) {
+	case map[string]any:
+		return []map[string]any{v}
+	case []any:
+		ms := []map[string]any{}
+		for _, x := range v {
+			if m, ok := x.(map[string]any); ok {
+				ms = append(ms, m)
+			}
+		}
+		return ms
+	default:
+		return nil
+	}
+}
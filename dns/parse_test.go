@@ -0,0 +1,115 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestParsing(t *testing.T) {
+	assert.Equal(t, ParsingDefault.String(), "default")
+	assert.Equal(t, ParsingStrict.String(), "strict")
+	assert.Equal(t, ParsingLenient.String(), "lenient")
+
+	b, err := NewQuery("likexian.com", TypeA, "", Flags{})
+	assert.Nil(t, err)
+	for _, p := range []Parsing{ParsingDefault, ParsingStrict, ParsingLenient} {
+		rsp, err := p.DecodeReader(ContentTypeMessage, strings.NewReader(string(b)))
+		assert.Nil(t, err)
+		assert.Equal(t, rsp.Question[0].Name, "likexian.com.")
+	}
+
+	rsp, err := ParsingDefault.DecodeReader(ContentTypeJSON, strings.NewReader(`{"Status":0,"X":1}`))
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Status, 0)
+}
+
+func TestDecodeStrict(t *testing.T) {
+	decode := func(s string) (*Response, error) {
+		return ParsingStrict.DecodeReader(ContentTypeJSON, strings.NewReader(s))
+	}
+
+	rsp, err := decode(`{"Status":0,"TC":false,"RD":true,"RA":true,"AD":false,"CD":false,
+		"Question":[{"name":"likexian.com.","type":1}],
+		"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}],
+		"Authority":[],"Comment":"Response from 1.1.1.1.","edns_client_subnet":"1.2.3.0/24"}` + "\n")
+	assert.Nil(t, err)
+	assert.True(t, rsp.RD)
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{`xx`, "invalid json at offset"},
+		{`{"Status":0,"Garbage":1}`, `unknown field "Garbage"`},
+		{`{"Status":"0"}`, "invalid Status at offset"},
+		{`{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":"300","data":"1.1.1.1"}]}`,
+			"invalid Answer.0.TTL at offset"},
+		{`{"Status":0}<html>`, "trailing data"},
+		{`{"RD":true}`, "missing Status"},
+		{`{"Status":0,"Question":[{"name":"","type":1}]}`, "invalid Question[0]"},
+		{`{"Status":0,"Answer":[{"name":"likexian.com.","type":0,"TTL":300,"data":""}]}`, "invalid Answer[0]"},
+		{`{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":-1,"data":""}]}`, "invalid Answer[0]"},
+	}
+
+	for _, v := range tests {
+		_, err := decode(v.in)
+		assert.NotNil(t, err, v.in)
+		assert.Contains(t, err.Error(), v.err)
+	}
+}
+
+func TestDecodeLenient(t *testing.T) {
+	decode := func(s string) (*Response, error) {
+		return ParsingLenient.DecodeReader(ContentTypeJSON, strings.NewReader(s))
+	}
+
+	rsp, err := decode(")]}'\n" + `{"status":"0","RD":1,"RA":"true","AD":"x","Garbage":{},
+		"Question":{"name":"likexian.com.","type":"A"},
+		"Answer":[{"name":"likexian.com.","type":"1","ttl":"300","data":"1.1.1.1"},
+			{"name":"likexian.com.","type":"XX","TTL":300,"data":"x"},
+			{"name":"likexian.com.","type":16,"TTL":-1,"data":42},
+			"garbage"]} trailing`)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Status, 0)
+	assert.True(t, rsp.RD)
+	assert.True(t, rsp.RA)
+	assert.False(t, rsp.AD)
+	assert.Equal(t, rsp.Question, []Question{{Name: "likexian.com.", Type: 1}})
+	assert.Equal(t, rsp.Answer, []Answer{
+		{Name: "likexian.com.", Type: 1, TTL: 300, Data: "1.1.1.1"},
+		{Name: "likexian.com.", Type: 16, TTL: 0, Data: "42"},
+	})
+
+	rsp, err = decode(`{"Status":3.0,"TC":true}`)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Status, 3)
+	assert.True(t, rsp.TC)
+	assert.Equal(t, len(rsp.Answer), 0)
+
+	for _, v := range []string{`<html>`, `{"Status":`, `{"RD":true}`, `{"Status":"x"}`} {
+		_, err := decode(v)
+		assert.NotNil(t, err, v)
+	}
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// Provider is the DoH provider interface, the client accepts any implementation, it must be safe for
+// concurrent use
+type Provider interface {
+	// String returns the provider name, for example: google
+	String() string
+	// Query do DoH query
+	Query(context.Context, Domain, Type) (*Response, error)
+	// ECSQuery do DoH query with the edns0-client-subnet option
+	ECSQuery(context.Context, Domain, Type, ECS) (*Response, error)
+	// SetProvides set upstream provides type, the providers with a single upstream ignore it
+	SetProvides(int) error
+	// Capabilities returns the features supported by provider
+	Capabilities() Capabilities
+}
+
+// Capabilities is the features supported by a provider
+type Capabilities struct {
+	// ECS is whether the edns0-client-subnet option is sent to upstream
+	ECS bool
+	// Flags is whether the CD and DO flags are sent to upstream
+	Flags bool
+	// NoRD is whether the cleared recursion desired flag is sent to upstream, the query fails if it is not
+	NoRD bool
+	// Formats is the supported message formats besides FormatAuto
+	Formats []Format
+	// Types is the supported query types, empty for all
+	Types []Type
+}
+
+// SupportsType returns whether the query type is supported
+func (c Capabilities) SupportsType(t Type) bool {
+	if len(c.Types) == 0 {
+		return true
+	}
+
+	return slices.Contains(c.Types, Type(strings.ToUpper(strings.TrimSpace(string(t.Normalize())))))
+}
+
+// SupportsFormat returns whether the message format is supported, FormatAuto is always supported
+func (c Capabilities) SupportsFormat(f Format) bool {
+	return f == FormatAuto || slices.Contains(c.Formats, f)
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestCapabilities(t *testing.T) {
+	c := Capabilities{}
+	assert.True(t, c.SupportsType(TypeMX))
+	assert.True(t, c.SupportsFormat(FormatAuto))
+	assert.False(t, c.SupportsFormat(FormatMessage))
+
+	c = Capabilities{Formats: []Format{FormatJSON}, Types: []Type{TypeA}}
+	assert.True(t, c.SupportsType(" a "))
+	assert.True(t, c.SupportsType("1"))
+	assert.False(t, c.SupportsType(TypeAAAA))
+	assert.True(t, c.SupportsFormat(FormatJSON))
+	assert.False(t, c.SupportsFormat(FormatMessage))
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Query is a parsed RFC 1035 wire format query, as received by a dns server
+type Query struct {
+	// ID is the message id, the reply must have the same id
+	ID uint16
+	// Name is the query name without the trailing dot
+	Name Domain
+	// Type is the query type, TYPE### if it is not supported
+	Type Type
+	// Code is the numeric query type
+	Code uint16
+	// ECS is the edns0-client-subnet option of query
+	ECS ECS
+	// Flags is the flags of query
+	Flags Flags
+	// Size is the max udp payload size of client, 512 if the edns0 is not used
+	Size int
+}
+
+// DefaultUDPSize is the max udp payload size of a client without edns0
+const DefaultUDPSize = 512
+
+// ParseQuery returns the query of a RFC 1035 wire format message, only a standard query of one question is supported
+func ParseQuery(b []byte) (*Query, error) {
+	if len(b) > MaxMessageSize {
+		return nil, fmt.Errorf("doh: dns: message too large: %d bytes", len(b))
+	}
+
+	var p dnsmessage.Parser
+
+	h, err := p.Start(b)
+	if err != nil {
+		return nil, fmt.Errorf("doh: dns: invalid message: %s", err)
+	}
+
+	if h.Response {
+		return nil, fmt.Errorf("doh: dns: message is not a query")
+	}
+
+	if h.OpCode != 0 {
+		return nil, fmt.Errorf("doh: dns: not supported opcode: %d", h.OpCode)
+	}
+
+	qs, err := p.AllQuestions()
+	if err != nil {
+		return nil, fmt.Errorf("doh: dns: invalid message: %s", err)
+	}
+
+	if len(qs) != 1 {
+		return nil, fmt.Errorf("doh: dns: not supported question count: %d", len(qs))
+	}
+
+	name := strings.TrimSuffix(qs[0].Name.String(), ".")
+	if name == "" {
+		name = "."
+	}
+
+	q := &Query{
+		ID:    h.ID,
+		Name:  Domain(name),
+		Type:  TypeOf(uint16(qs[0].Type)),
+		Code:  uint16(qs[0].Type),
+		Flags: Flags{CD: h.CheckingDisabled, NoRD: !h.RecursionDesired},
+		Size:  DefaultUDPSize,
+	}
+
+	if err = p.SkipAllAnswers(); err != nil {
+		return nil, fmt.Errorf("doh: dns: invalid message: %s", err)
+	}
+
+	if err = p.SkipAllAuthorities(); err != nil {
+		return nil, fmt.Errorf("doh: dns: invalid message: %s", err)
+	}
+
+	for {
+		r, err := p.Additional()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("doh: dns: invalid message: %s", err)
+		}
+		opt, ok := r.Body.(*dnsmessage.OPTResource)
+		if !ok {
+			continue
+		}
+		q.Flags.DO = r.Header.DNSSECAllowed()
+		if size := int(r.Header.Class); size > DefaultUDPSize {
+			q.Size = size
+		}
+		for _, o := range opt.Options {
+			if o.Code == 8 {
+				q.ECS = parseECS(o.Data)
+			}
+		}
+	}
+
+	return q, nil
+}
+
+// Response returns an empty response of query with the status, for example 2 for SERVFAIL
+func (q *Query) Response(status int) *Response {
+	return &Response{
+		Status:   status,
+		RD:       !q.Flags.NoRD,
+		RA:       true,
+		Question: []Question{{Name: q.fqdn(), Type: int(q.Code)}},
+		Answer:   []Answer{},
+	}
+}
+
+// Reply returns the wire format reply of response to query, the answers are dropped
+// and the TC flag is set if the reply is larger than size, 0 for no limit
+func (q *Query) Reply(rsp *Response, size int) ([]byte, error) {
+	r := *rsp
+	r.RD = !q.Flags.NoRD
+	r.Question = []Question{{Name: q.fqdn(), Type: int(q.Code)}}
+	r.CD = q.Flags.CD
+
+	b, err := r.Pack(q.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if size <= 0 || len(b) <= size {
+		return b, nil
+	}
+
+	r.TC, r.Answer = true, []Answer{}
+
+	return r.Pack(q.ID)
+}
+
+// fqdn returns the query name with the trailing dot
+func (q *Query) fqdn() string {
+	if strings.HasSuffix(string(q.Name), ".") {
+		return string(q.Name)
+	}
+
+	return string(q.Name) + "."
+}
+
+// parseECS returns the ecs of edns0-client-subnet option data, empty if it is invalid
+func parseECS(b []byte) ECS {
+	if len(b) < 4 {
+		return ""
+	}
+
+	family, prefix := int(b[1]), int(b[2])
+
+	var ip net.IP
+	switch family {
+	case 1:
+		ip = make(net.IP, net.IPv4len)
+	case 2:
+		ip = make(net.IP, net.IPv6len)
+	default:
+		return ""
+	}
+
+	if prefix > len(ip)*8 || len(b)-4 > len(ip) {
+		return ""
+	}
+
+	copy(ip, b[4:])
+
+	return ECS(fmt.Sprintf("%s/%d", ip, prefix))
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParseQuery(t *testing.T) {
+	_, err := ParseQuery([]byte("xx"))
+	assert.NotNil(t, err)
+
+	b, err := NewQuery("likexian.com", TypeMX, "1.2.3.4/24", Flags{CD: true, DO: true})
+	assert.Nil(t, err)
+
+	q, err := ParseQuery(b)
+	assert.Nil(t, err)
+	assert.Equal(t, q.ID, uint16(0))
+	assert.Equal(t, q.Name, Domain("likexian.com"))
+	assert.Equal(t, q.Type, TypeMX)
+	assert.Equal(t, q.Code, uint16(15))
+	assert.Equal(t, q.ECS, ECS("1.2.3.0/24"))
+	assert.Equal(t, q.Flags, Flags{CD: true, DO: true})
+	assert.Equal(t, q.Size, 4096)
+
+	msg := func(h dnsmessage.Header, qs ...dnsmessage.Question) []byte {
+		bb := dnsmessage.NewBuilder(nil, h)
+		assert.Nil(t, bb.StartQuestions())
+		for _, v := range qs {
+			assert.Nil(t, bb.Question(v))
+		}
+		b, err := bb.Finish()
+		assert.Nil(t, err)
+		return b
+	}
+
+	question := dnsmessage.Question{Name: dnsmessage.MustNewName("likexian.com."), Type: 65, Class: dnsmessage.ClassINET}
+	q, err = ParseQuery(msg(dnsmessage.Header{ID: 1}, question))
+	assert.Nil(t, err)
+	assert.Equal(t, q.ID, uint16(1))
+	assert.Equal(t, q.Type, Type("TYPE65"))
+	assert.Equal(t, q.ECS, ECS(""))
+	assert.Equal(t, q.Flags, Flags{NoRD: true})
+	assert.Equal(t, q.Size, DefaultUDPSize)
+	assert.False(t, q.Response(0).RD)
+
+	_, err = ParseQuery(msg(dnsmessage.Header{Response: true}, question))
+	assert.NotNil(t, err)
+
+	_, err = ParseQuery(msg(dnsmessage.Header{OpCode: 5}, question))
+	assert.NotNil(t, err)
+
+	_, err = ParseQuery(msg(dnsmessage.Header{}))
+	assert.NotNil(t, err)
+
+	assert.Equal(t, parseECS([]byte{0, 2, 48, 0, 0x20, 0x01, 0x0d, 0xb8, 0, 1}), ECS("2001:db8:1::/48"))
+	assert.Equal(t, parseECS([]byte{0, 3, 24, 0}), ECS(""))
+	assert.Equal(t, parseECS([]byte{0, 1, 33, 0}), ECS(""))
+	assert.Equal(t, parseECS([]byte{0}), ECS(""))
+}
+
+func TestQueryReply(t *testing.T) {
+	b, err := NewQuery("likexian.com", TypeTXT, "", Flags{})
+	assert.Nil(t, err)
+	q, err := ParseQuery(b)
+	assert.Nil(t, err)
+	q.ID = 7
+
+	rsp := q.Response(3)
+	assert.Equal(t, rsp.Question, []Question{{Name: "likexian.com.", Type: 16}})
+
+	b, err = q.Reply(rsp, 0)
+	assert.Nil(t, err)
+	rr, err := ParseMessage(b)
+	assert.Nil(t, err)
+	assert.Equal(t, rr.Status, 3)
+
+	rsp = &Response{Question: []Question{{Name: "likexian.com", Type: 16}}}
+	for i := 0; i < 10; i++ {
+		rsp.Answer = append(rsp.Answer, Answer{Name: "likexian.com.", Type: 16, TTL: 60,
+			Data: `"v=spf1 include:_spf.likexian.com include:_spf.example.com -all"`})
+	}
+
+	b, err = q.Reply(rsp, 0)
+	assert.Nil(t, err)
+	assert.Gt(t, len(b), DefaultUDPSize)
+
+	b, err = q.Reply(rsp, DefaultUDPSize)
+	assert.Nil(t, err)
+	assert.Le(t, len(b), DefaultUDPSize)
+	rr, err = ParseMessage(b)
+	assert.Nil(t, err)
+	assert.True(t, rr.TC)
+	assert.Equal(t, len(rr.Answer), 0)
+	assert.Equal(t, len(rsp.Answer), 10)
+
+	var p dnsmessage.Parser
+	h, err := p.Start(b)
+	assert.Nil(t, err)
+	assert.Equal(t, h.ID, uint16(7))
+}
+
+func BenchmarkParseQuery(b *testing.B) {
+	msg, err := NewQuery("likexian.com", TypeA, "1.2.3.4/24", Flags{DO: true})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = ParseQuery(msg)
+	}
+}
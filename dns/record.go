@@ -0,0 +1,227 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Record is the typed records of answers, net.IP is of the A and AAAA answers
+type Record interface {
+	net.IP | MX | TXT | CNAME | NS | PTR | SOA | SRV | HTTPS
+}
+
+// MX is the mail exchange record
+type MX struct {
+	Pref uint16
+	Host string
+}
+
+// TXT is the text record, the character strings are concatenated
+type TXT string
+
+// CNAME is the canonical name record
+type CNAME string
+
+// NS is the name server record
+type NS string
+
+// PTR is the pointer record
+type PTR string
+
+// SOA is the start of authority record
+type SOA struct {
+	NS      string
+	MBox    string
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	MinTTL  uint32
+}
+
+// SRV is the service record
+type SRV struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   string
+}
+
+// RecordTypes returns the query types of record type T, for example: TypeA and TypeAAAA of net.IP
+func RecordTypes[T Record]() []Type {
+	var v T
+	switch any(v).(type) {
+	case net.IP:
+		return []Type{TypeA, TypeAAAA}
+	case MX:
+		return []Type{TypeMX}
+	case TXT:
+		return []Type{TypeTXT}
+	case CNAME:
+		return []Type{TypeCNAME}
+	case NS:
+		return []Type{TypeNS}
+	case PTR:
+		return []Type{TypePTR}
+	case SRV:
+		return []Type{TypeSRV}
+	case HTTPS:
+		return []Type{TypeHTTPS}
+	default:
+		return []Type{TypeSOA}
+	}
+}
+
+// Records returns the answers of response as the records of type T, the answers of other types or
+// malformed data are skipped
+func Records[T Record](r *Response) []T {
+	rs := []T{}
+	if r == nil {
+		return rs
+	}
+
+	for _, a := range r.Answer {
+		if v, ok := parseRecord[T](a); ok {
+			rs = append(rs, v)
+		}
+	}
+
+	return rs
+}
+
+// parseRecord returns the answer as record of type T, false if it is not of the type or malformed
+func parseRecord[T Record](a Answer) (T, bool) {
+	var r any
+	var ok bool
+
+	var v T
+	switch any(v).(type) {
+	case net.IP:
+		if a.Type == int(typeCodes[TypeA]) || a.Type == int(typeCodes[TypeAAAA]) {
+			ip := net.ParseIP(strings.TrimSpace(a.Data))
+			r, ok = ip, ip != nil
+		}
+	case MX:
+		if a.Type == int(typeCodes[TypeMX]) {
+			fields := strings.Fields(a.Data)
+			if len(fields) == 2 {
+				pref, err := strconv.ParseUint(fields[0], 10, 16)
+				r, ok = MX{Pref: uint16(pref), Host: fields[1]}, err == nil
+			}
+		}
+	case TXT:
+		if a.Type == int(typeCodes[TypeTXT]) {
+			r, ok = TXT(unquoteTXT(a.Data)), true
+		}
+	case CNAME:
+		if a.Type == int(typeCodes[TypeCNAME]) {
+			r, ok = CNAME(strings.TrimSpace(a.Data)), true
+		}
+	case NS:
+		if a.Type == int(typeCodes[TypeNS]) {
+			r, ok = NS(strings.TrimSpace(a.Data)), true
+		}
+	case PTR:
+		if a.Type == int(typeCodes[TypePTR]) {
+			r, ok = PTR(strings.TrimSpace(a.Data)), true
+		}
+	case SOA:
+		if a.Type == int(typeCodes[TypeSOA]) {
+			r, ok = parseSOA(a.Data)
+		}
+	case SRV:
+		if a.Type == int(typeCodes[TypeSRV]) {
+			r, ok = parseSRV(a.Data)
+		}
+	case HTTPS:
+		if a.Type == 65 {
+			r, ok = parseHTTPS(a.Data)
+		}
+	}
+
+	if !ok {
+		return v, false
+	}
+
+	return r.(T), true
+}
+
+// unquoteTXT returns the concatenated character strings of txt data, the unquoted data is returned as is
+func unquoteTXT(data string) string {
+	s := strings.TrimSpace(data)
+	if !strings.HasPrefix(s, `"`) {
+		return data
+	}
+
+	var b strings.Builder
+	for s != "" {
+		q, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return data
+		}
+		v, _ := strconv.Unquote(q)
+		b.WriteString(v)
+		s = strings.TrimSpace(s[len(q):])
+	}
+
+	return b.String()
+}
+
+// parseSOA returns the soa record of data, for example: ns.example.com. mbox.example.com. 1 2 3 4 5
+func parseSOA(data string) (SOA, bool) {
+	fields := strings.Fields(data)
+	if len(fields) != 7 {
+		return SOA{}, false
+	}
+
+	nums := [5]uint32{}
+	for k := range nums {
+		n, err := strconv.ParseUint(fields[k+2], 10, 32)
+		if err != nil {
+			return SOA{}, false
+		}
+		nums[k] = uint32(n)
+	}
+
+	return SOA{NS: fields[0], MBox: fields[1], Serial: nums[0], Refresh: nums[1], Retry: nums[2],
+		Expire: nums[3], MinTTL: nums[4]}, true
+}
+
+// parseSRV returns the srv record of data, for example: 10 5 443 sip.example.com.
+func parseSRV(data string) (SRV, bool) {
+	fields := strings.Fields(data)
+	if len(fields) != 4 {
+		return SRV{}, false
+	}
+
+	nums := [3]uint16{}
+	for k := range nums {
+		n, err := strconv.ParseUint(fields[k], 10, 16)
+		if err != nil {
+			return SRV{}, false
+		}
+		nums[k] = uint16(n)
+	}
+
+	return SRV{Priority: nums[0], Weight: nums[1], Port: nums[2], Target: fields[3]}, true
+}
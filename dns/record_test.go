@@ -0,0 +1,69 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestRecords(t *testing.T) {
+	rsp := &Response{Answer: []Answer{
+		{Type: 5, Data: "cdn.likexian.com."},
+		{Type: 1, Data: "1.1.1.1"},
+		{Type: 28, Data: "2001::1"},
+		{Type: 1, Data: "x"},
+		{Type: 15, Data: "10 mx.likexian.com."},
+		{Type: 15, Data: "xx mx.likexian.com."},
+		{Type: 16, Data: `"v=spf1 -all" "x"`},
+		{Type: 16, Data: "plain text"},
+		{Type: 16, Data: `"broken`},
+		{Type: 2, Data: "ns.likexian.com."},
+		{Type: 12, Data: "host.likexian.com."},
+		{Type: 6, Data: "ns.likexian.com. mbox.likexian.com. 1 2 3 4 5"},
+		{Type: 6, Data: "ns.likexian.com. mbox.likexian.com. 1 2 3 4 x"},
+		{Type: 6, Data: "ns.likexian.com."},
+		{Type: 33, Data: "10 5 443 sip.likexian.com."},
+		{Type: 33, Data: "10 5 x sip.likexian.com."},
+		{Type: 33, Data: "10 5 sip.likexian.com."},
+	}}
+
+	assert.Equal(t, Records[net.IP](rsp), []net.IP{net.ParseIP("1.1.1.1"), net.ParseIP("2001::1")})
+	assert.Equal(t, Records[MX](rsp), []MX{{Pref: 10, Host: "mx.likexian.com."}})
+	assert.Equal(t, Records[TXT](rsp), []TXT{"v=spf1 -allx", "plain text", `"broken`})
+	assert.Equal(t, Records[CNAME](rsp), []CNAME{"cdn.likexian.com."})
+	assert.Equal(t, Records[NS](rsp), []NS{"ns.likexian.com."})
+	assert.Equal(t, Records[PTR](rsp), []PTR{"host.likexian.com."})
+	assert.Equal(t, Records[SOA](rsp), []SOA{{NS: "ns.likexian.com.", MBox: "mbox.likexian.com.",
+		Serial: 1, Refresh: 2, Retry: 3, Expire: 4, MinTTL: 5}})
+	assert.Equal(t, Records[SRV](rsp), []SRV{{Priority: 10, Weight: 5, Port: 443, Target: "sip.likexian.com."}})
+	assert.Equal(t, Records[MX](nil), []MX{})
+
+	assert.Equal(t, RecordTypes[net.IP](), []Type{TypeA, TypeAAAA})
+	assert.Equal(t, RecordTypes[MX](), []Type{TypeMX})
+	assert.Equal(t, RecordTypes[TXT](), []Type{TypeTXT})
+	assert.Equal(t, RecordTypes[CNAME](), []Type{TypeCNAME})
+	assert.Equal(t, RecordTypes[NS](), []Type{TypeNS})
+	assert.Equal(t, RecordTypes[PTR](), []Type{TypePTR})
+	assert.Equal(t, RecordTypes[SOA](), []Type{TypeSOA})
+	assert.Equal(t, RecordTypes[SRV](), []Type{TypeSRV})
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// DefaultDNS64Prefix is the well-known NAT64 prefix of RFC 6052
+var DefaultDNS64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+
+// SetDNS64 set the NAT64 prefix to synthesize AAAA answers from A records if the name has no native AAAA,
+// as RFC 6147 for IPv6-only networks. The prefix length must be 32, 40, 48, 56, 64 or 96,
+// and the zero prefix to disable it
+func (c *DoH) SetDNS64(prefix netip.Prefix) error {
+	if prefix.IsValid() {
+		if err := checkDNS64(prefix); err != nil {
+			return err
+		}
+		prefix = prefix.Masked()
+	} else {
+		prefix = netip.Prefix{}
+	}
+
+	c.Lock()
+	c.dns64 = prefix
+	c.Unlock()
+
+	return nil
+}
+
+// dns64Prefix returns the NAT64 prefix if the query type is AAAA and DNS64 is enabled
+func (c *DoH) dns64Prefix(t dns.Type) (netip.Prefix, bool) {
+	if !strings.EqualFold(strings.TrimSpace(string(t)), string(dns.TypeAAAA)) {
+		return netip.Prefix{}, false
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.dns64, c.dns64.IsValid()
+}
+
+// dns64Query do AAAA query, and synthesizes the answers from A records if there is no native AAAA
+func (c *DoH) dns64Query(ctx context.Context, prefix netip.Prefix, d dns.Domain,
+	s dns.ECS) (*dns.Response, bool, error) {
+	rsp, cached, err := c.query(ctx, d, dns.TypeAAAA, s)
+	if err != nil || rsp == nil || rsp.Status != 0 {
+		return rsp, cached, err
+	}
+
+	for _, v := range rsp.Answer {
+		if v.Type == 28 {
+			return rsp, cached, err
+		}
+	}
+
+	ra, acached, err := c.query(ctx, d, dns.TypeA, s)
+	if err != nil || ra == nil || ra.Status != 0 {
+		return rsp, cached, nil
+	}
+
+	rr := *rsp
+	rr.Answer = []dns.Answer{}
+	rr.Provider = ra.Provider
+	for _, v := range ra.Answer {
+		if v.Type == 1 {
+			ip, err := netip.ParseAddr(v.Data)
+			if err != nil || !ip.Is4() {
+				continue
+			}
+			v.Type, v.Data = 28, synthesize(prefix, ip).String()
+		}
+		rr.Answer = append(rr.Answer, v)
+	}
+
+	return &rr, cached && acached, nil
+}
+
+// checkDNS64 returns an error if the prefix is not a NAT64 prefix
+func checkDNS64(prefix netip.Prefix) error {
+	if !prefix.Addr().Is6() || prefix.Addr().Is4In6() {
+		return fmt.Errorf("doh: dns64: not an IPv6 prefix: %s", prefix)
+	}
+
+	switch prefix.Bits() {
+	case 32, 40, 48, 56, 64, 96:
+		return nil
+	default:
+		return fmt.Errorf("doh: dns64: invalid prefix length: %s", prefix)
+	}
+}
+
+// synthesize returns the IPv6 address embedding the IPv4 address in the prefix as RFC 6052,
+// the bits 64 to 71 are skipped
+func synthesize(prefix netip.Prefix, ip netip.Addr) netip.Addr {
+	b := prefix.Addr().As16()
+	v4 := ip.As4()
+
+	i := prefix.Bits() / 8
+	for _, v := range v4 {
+		if i == 8 {
+			i++
+		}
+		b[i] = v
+		i++
+	}
+
+	return netip.AddrFrom16(b)
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestSetDNS64(t *testing.T) {
+	rt, hosts := hostRecorder()
+	c := Use(GoogleProvider).SetRoundTripper(rt)
+	defer c.Close()
+
+	assert.Nil(t, c.AddRewrite("nas.home", 0, "192.168.1.2", "fd00::2"))
+	assert.Nil(t, c.AddRewrite("v4.home", 0, "192.0.2.33"))
+
+	ctx := context.Background()
+	rsp, err := c.Query(ctx, "v4.home", dns.TypeAAAA)
+	assert.Nil(t, err)
+	assert.Equal(t, len(rsp.Answer), 0)
+
+	assert.Nil(t, c.SetDNS64(DefaultDNS64Prefix))
+	rsp, err = c.Query(ctx, "v4.home", dns.TypeAAAA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Question[0].Type, 28)
+	assert.Equal(t, rsp.Answer, []dns.Answer{{Name: "v4.home.", Type: 28, TTL: 300, Data: "64:ff9b::c000:221"}})
+
+	rsp, err = c.Query(ctx, "nas.home", dns.TypeAAAA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer, []dns.Answer{{Name: "nas.home.", Type: 28, TTL: 300, Data: "fd00::2"}})
+
+	rsp, err = c.Query(ctx, "v4.home", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "192.0.2.33")
+	assert.Equal(t, len(hosts()), 0)
+
+	rsp, err = c.Query(ctx, "likexian.com", dns.TypeAAAA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Type, 28)
+	assert.Equal(t, rsp.Answer[0].Data, "64:ff9b::101:101")
+	assert.Equal(t, len(hosts()), 2)
+
+	assert.Nil(t, c.SetDNS64(netip.Prefix{}))
+	rsp, err = c.Query(ctx, "v4.home", dns.TypeAAAA)
+	assert.Nil(t, err)
+	assert.Equal(t, len(rsp.Answer), 0)
+
+	assert.NotNil(t, c.SetDNS64(netip.MustParsePrefix("64:ff9b::/80")))
+	assert.NotNil(t, c.SetDNS64(netip.MustParsePrefix("10.0.0.0/8")))
+}
+
+func TestSynthesize(t *testing.T) {
+	tests := []struct {
+		prefix string
+		addr   string
+	}{
+		{"2001:db8::/32", "2001:db8:c000:221::"},
+		{"2001:db8:100::/40", "2001:db8:1c0:2:21::"},
+		{"2001:db8:122::/48", "2001:db8:122:c000:2:2100::"},
+		{"2001:db8:122:300::/56", "2001:db8:122:3c0:0:221::"},
+		{"2001:db8:122:344::/64", "2001:db8:122:344:c0:2:2100:0"},
+		{"2001:db8:122:344::/96", "2001:db8:122:344::c000:221"},
+	}
+
+	ip := netip.MustParseAddr("192.0.2.33")
+	for _, v := range tests {
+		assert.Equal(t, synthesize(netip.MustParsePrefix(v.prefix), ip), netip.MustParseAddr(v.addr), v.prefix)
+	}
+}
@@ -0,0 +1,343 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dnstap
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// Logger writes the provider query events in dnstap format
+type Logger struct {
+	w        *frameWriter
+	c        io.Closer
+	identity string
+	version  string
+	frames   chan []byte
+	done     chan struct{}
+	dropped  uint64
+	closed   bool
+	err      error
+	sync.Mutex
+}
+
+// dnstap message types of a stub resolver
+const (
+	typeMessage      = 1
+	typeStubQuery    = 9
+	typeStubResponse = 10
+	familyINET       = 1
+	familyINET6      = 2
+	protocolDOH      = 4
+)
+
+// DefaultQueueSize is the default number of frames queued for writing, frames are dropped if it is full
+const DefaultQueueSize = 1024
+
+// Version returns package version
+func Version() string {
+	return "0.1.0"
+}
+
+// Author returns package author
+func Author() string {
+	return "[Li Kexian](https://www.likexian.com/)"
+}
+
+// License returns package license
+func License() string {
+	return "Licensed under the Apache License 2.0"
+}
+
+// New returns a new logger writing an unidirectional frame stream to w, for example a file
+func New(w io.Writer) (*Logger, error) {
+	f, err := newFrameWriter(w, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var c io.Closer
+	if v, ok := w.(io.Closer); ok {
+		c = v
+	}
+
+	return newLogger(f, c), nil
+}
+
+// NewFile returns a new logger writing to file, the file is truncated
+func NewFile(path string) (*Logger, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := New(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// NewSocket returns a new logger writing a bidirectional frame stream to socket, network is unix or tcp
+func NewSocket(network, address string) (*Logger, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := newFrameWriter(conn, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return newLogger(f, conn), nil
+}
+
+// newLogger returns a new logger and starts writing
+func newLogger(f *frameWriter, c io.Closer) *Logger {
+	l := &Logger{
+		w:        f,
+		c:        c,
+		identity: "",
+		version:  "doh-go " + doh.Version(),
+		frames:   make(chan []byte, DefaultQueueSize),
+		done:     make(chan struct{}),
+	}
+
+	if host, err := os.Hostname(); err == nil {
+		l.identity = host
+	}
+
+	go l.run()
+
+	return l
+}
+
+// SetIdentity set the identity of dnstap messages, default is the hostname
+func (l *Logger) SetIdentity(identity string) *Logger {
+	l.Lock()
+	l.identity = identity
+	l.Unlock()
+
+	return l
+}
+
+// SetVersion set the version of dnstap messages, default is doh-go version
+func (l *Logger) SetVersion(version string) *Logger {
+	l.Lock()
+	l.version = version
+	l.Unlock()
+
+	return l
+}
+
+// Register add the logger hook to client
+func (l *Logger) Register(c *doh.DoH) *doh.DoH {
+	return c.AddHook(l.Hook)
+}
+
+// Hook queues a stub query message and a stub response message of the provider query event,
+// cache hits are not logged as there is no upstream query
+func (l *Logger) Hook(ctx context.Context, e *doh.Event) {
+	if e.Cached {
+		return
+	}
+
+	name, err := e.Domain.Punycode()
+	if err != nil {
+		return
+	}
+
+	var query, response []byte
+	query, _ = dns.NewQuery(name, e.Type, e.ECS, dns.FlagsOf(ctx))
+	if e.Response != nil {
+		response, _ = e.Response.Pack(0)
+	}
+
+	var addr string
+	if e.Response != nil && e.Response.Metadata != nil {
+		addr = e.Response.Metadata.RemoteAddr
+	}
+
+	id := doh.CorrelationID(ctx)
+	l.queue(l.frame(typeStubQuery, e.Start, time.Time{}, query, nil, addr, id))
+	if e.Response != nil {
+		l.queue(l.frame(typeStubResponse, e.Start, e.Start.Add(e.Duration), query, response, addr, id))
+	}
+}
+
+// Dropped returns the number of frames dropped as the queue is full
+func (l *Logger) Dropped() uint64 {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.dropped
+}
+
+// Close flushes the queued frames and closes the stream
+func (l *Logger) Close() error {
+	l.Lock()
+	if l.closed {
+		err := l.err
+		l.Unlock()
+		return err
+	}
+	l.closed = true
+	close(l.frames)
+	l.Unlock()
+
+	<-l.done
+
+	l.Lock()
+	defer l.Unlock()
+
+	if err := l.w.Close(); err != nil && l.err == nil {
+		l.err = err
+	}
+
+	if l.c != nil {
+		if err := l.c.Close(); err != nil && l.err == nil {
+			l.err = err
+		}
+	}
+
+	return l.err
+}
+
+// queue adds frame to the writing queue, drops it if the queue is full or closed
+func (l *Logger) queue(b []byte) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.closed {
+		l.dropped++
+		return
+	}
+
+	select {
+	case l.frames <- b:
+	default:
+		l.dropped++
+	}
+}
+
+// run writes the queued frames until closed
+func (l *Logger) run() {
+	defer close(l.done)
+
+	for b := range l.frames {
+		err := l.w.writeFrame(b)
+		if err == nil && len(l.frames) == 0 {
+			err = l.w.Flush()
+		}
+		if err != nil {
+			l.Lock()
+			if l.err == nil {
+				l.err = err
+			}
+			l.Unlock()
+		}
+	}
+}
+
+// frame returns the encoded dnstap protobuf message, the correlation id is set as the extra field
+func (l *Logger) frame(t uint64, qt, rt time.Time, query, response []byte, addr, id string) []byte {
+	m := []byte{}
+	m = appendVarint(m, 1, t)
+	m = appendVarint(m, 3, protocolDOH)
+
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			if v := ip.To4(); v != nil {
+				m = appendVarint(m, 2, familyINET)
+				m = appendBytes(m, 5, v)
+			} else {
+				m = appendVarint(m, 2, familyINET6)
+				m = appendBytes(m, 5, ip.To16())
+			}
+		}
+		if p, err := net.LookupPort("tcp", port); err == nil {
+			m = appendVarint(m, 7, uint64(p))
+		}
+	}
+
+	m = appendVarint(m, 8, uint64(qt.Unix()))
+	m = appendFixed32(m, 9, uint32(qt.Nanosecond()))
+	if query != nil {
+		m = appendBytes(m, 10, query)
+	}
+
+	if t == typeStubResponse {
+		m = appendVarint(m, 12, uint64(rt.Unix()))
+		m = appendFixed32(m, 13, uint32(rt.Nanosecond()))
+		if response != nil {
+			m = appendBytes(m, 14, response)
+		}
+	}
+
+	l.Lock()
+	identity, version := l.identity, l.version
+	l.Unlock()
+
+	b := []byte{}
+	if identity != "" {
+		b = appendBytes(b, 1, []byte(identity))
+	}
+	if version != "" {
+		b = appendBytes(b, 2, []byte(version))
+	}
+	if id != "" {
+		b = appendBytes(b, 3, []byte(id))
+	}
+	b = appendBytes(b, 14, m)
+	b = appendVarint(b, 15, typeMessage)
+
+	return b
+}
+
+// appendVarint appends a protobuf varint field
+func appendVarint(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+// appendFixed32 appends a protobuf fixed32 field
+func appendFixed32(b []byte, field int, v uint32) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|5)
+	return binary.LittleEndian.AppendUint32(b, v)
+}
+
+// appendBytes appends a protobuf length delimited field
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
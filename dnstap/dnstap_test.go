@@ -0,0 +1,229 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dnstap
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func TestVersion(t *testing.T) {
+	assert.Contains(t, Version(), ".")
+	assert.Contains(t, Author(), "likexian")
+	assert.Contains(t, License(), "Apache License")
+}
+
+// readFrames returns the control frame types and data frames of stream
+func readFrames(t *testing.T, r io.Reader) ([]uint32, [][]byte) {
+	controls, frames := []uint32{}, [][]byte{}
+	for {
+		var n uint32
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return controls, frames
+		}
+		if n == 0 {
+			assert.Nil(t, binary.Read(r, binary.BigEndian, &n))
+			b := make([]byte, n)
+			_, err := io.ReadFull(r, b)
+			assert.Nil(t, err)
+			controls = append(controls, binary.BigEndian.Uint32(b))
+			if n > 4 {
+				assert.Equal(t, string(b[12:]), ContentType)
+			}
+			continue
+		}
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		assert.Nil(t, err)
+		frames = append(frames, b)
+	}
+}
+
+// decode returns the fields of protobuf message, varint and fixed32 are decoded as uint64
+func decode(t *testing.T, b []byte) map[int]interface{} {
+	m := map[int]interface{}{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		b = b[n:]
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			m[int(key>>3)] = v
+			b = b[n:]
+		case 2:
+			size, n := binary.Uvarint(b)
+			m[int(key>>3)] = b[n : n+int(size)]
+			b = b[n+int(size):]
+		case 5:
+			m[int(key>>3)] = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		default:
+			t.Fatalf("unexpected wire type: %d", key&7)
+		}
+	}
+	return m
+}
+
+func TestLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l, err := New(nopCloser{buf})
+	assert.Nil(t, err)
+	l.SetIdentity("likexian").SetVersion("test")
+
+	start := time.Unix(1546300800, 100)
+	ctx := doh.WithCorrelationID(context.Background(), "req-1")
+	l.Hook(ctx, &doh.Event{
+		Provider: "google",
+		Domain:   "likexian.com",
+		Type:     dns.TypeA,
+		Response: &dns.Response{
+			Question: []dns.Question{{Name: "likexian.com.", Type: 1}},
+			Answer:   []dns.Answer{{Name: "likexian.com.", Type: 1, TTL: 300, Data: "1.1.1.1"}},
+			Metadata: &dns.Metadata{RemoteAddr: "8.8.8.8:443"},
+		},
+		Start:    start,
+		Duration: time.Second,
+	})
+	l.Hook(ctx, &doh.Event{Provider: "google", Domain: "likexian.com", Type: dns.TypeA, Cached: true})
+	l.Hook(ctx, &doh.Event{Provider: "quad9", Domain: "likexian.com", Type: dns.TypeAAAA, Start: start,
+		Err: context.Canceled})
+	assert.Nil(t, l.Close())
+	assert.Nil(t, l.Close())
+
+	l.Hook(ctx, &doh.Event{Provider: "quad9", Domain: "likexian.com", Type: dns.TypeA})
+	assert.Equal(t, l.Dropped(), uint64(1))
+
+	controls, frames := readFrames(t, buf)
+	assert.Equal(t, controls, []uint32{controlStart, controlStop})
+	assert.Equal(t, len(frames), 3)
+
+	d := decode(t, frames[0])
+	assert.Equal(t, string(d[1].([]byte)), "likexian")
+	assert.Equal(t, string(d[2].([]byte)), "test")
+	assert.Equal(t, string(d[3].([]byte)), "req-1")
+	assert.Equal(t, d[15], uint64(typeMessage))
+	m := decode(t, d[14].([]byte))
+	assert.Equal(t, m[1], uint64(typeStubQuery))
+	assert.Equal(t, m[2], uint64(familyINET))
+	assert.Equal(t, m[3], uint64(protocolDOH))
+	assert.Equal(t, m[5], []byte{8, 8, 8, 8})
+	assert.Equal(t, m[7], uint64(443))
+	assert.Equal(t, m[8], uint64(1546300800))
+	assert.Equal(t, m[9], uint64(100))
+	q, err := dns.ParseMessage(m[10].([]byte))
+	assert.Nil(t, err)
+	assert.Equal(t, q.Question[0].Name, "likexian.com.")
+
+	m = decode(t, decode(t, frames[1])[14].([]byte))
+	assert.Equal(t, m[1], uint64(typeStubResponse))
+	assert.Equal(t, m[12], uint64(1546300801))
+	r, err := dns.ParseMessage(m[14].([]byte))
+	assert.Nil(t, err)
+	assert.Equal(t, r.Answer[0].Data, "1.1.1.1")
+
+	m = decode(t, decode(t, frames[2])[14].([]byte))
+	assert.Equal(t, m[1], uint64(typeStubQuery))
+	assert.Nil(t, m[5])
+}
+
+func TestNewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dnstap.fstrm")
+	l, err := NewFile(path)
+	assert.Nil(t, err)
+	l.Hook(context.Background(), &doh.Event{Provider: "google", Domain: "likexian.com", Type: dns.TypeA})
+	assert.Nil(t, l.Close())
+
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+	controls, frames := readFrames(t, f)
+	assert.Equal(t, controls, []uint32{controlStart, controlStop})
+	assert.Equal(t, len(frames), 1)
+
+	_, err = NewFile(filepath.Join(path, "x"))
+	assert.NotNil(t, err)
+}
+
+func TestNewSocket(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+
+	result := make(chan []uint32, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		w := &frameWriter{r: conn}
+		if w.readControl(controlReady) != nil {
+			return
+		}
+		f, _ := newFrameWriter(io.Discard, nil)
+		f.w.Reset(conn)
+		_ = f.writeControl(controlAccept)
+		controls := []uint32{controlReady}
+		var n [2]uint32
+		for binary.Read(conn, binary.BigEndian, n[:1]) == nil {
+			if n[0] != 0 {
+				_, _ = io.CopyN(io.Discard, conn, int64(n[0]))
+				continue
+			}
+			_ = binary.Read(conn, binary.BigEndian, n[1:])
+			b := make([]byte, n[1])
+			_, _ = io.ReadFull(conn, b)
+			controls = append(controls, binary.BigEndian.Uint32(b))
+			if binary.BigEndian.Uint32(b) == controlStop {
+				_ = f.writeControl(controlFinish)
+				break
+			}
+		}
+		result <- controls
+	}()
+
+	l, err := NewSocket("tcp", ln.Addr().String())
+	assert.Nil(t, err)
+	l.Hook(context.Background(), &doh.Event{Provider: "google", Domain: "likexian.com", Type: dns.TypeA})
+	assert.Nil(t, l.Close())
+	assert.Equal(t, <-result, []uint32{controlReady, controlStart, controlStop})
+
+	_, err = NewSocket("tcp", "127.0.0.1:1")
+	assert.NotNil(t, err)
+}
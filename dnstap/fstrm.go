@@ -0,0 +1,158 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dnstap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Frame streams control frame types
+const (
+	controlAccept = 1
+	controlStart  = 2
+	controlStop   = 3
+	controlReady  = 4
+	controlFinish = 5
+)
+
+const (
+	// controlFieldContentType is the content type field of control frame
+	controlFieldContentType = 1
+	// ContentType is the frame streams content type of dnstap
+	ContentType = "protobuf:dnstap.Dnstap"
+	// maxControlSize is the max size of control frame accepted
+	maxControlSize = 512
+)
+
+// frameWriter writes the frame streams of dnstap
+type frameWriter struct {
+	w             *bufio.Writer
+	r             io.Reader
+	bidirectional bool
+}
+
+// newFrameWriter returns a frame writer, it does the handshake if r is not nil
+func newFrameWriter(w io.Writer, r io.Reader) (*frameWriter, error) {
+	f := &frameWriter{
+		w:             bufio.NewWriter(w),
+		r:             r,
+		bidirectional: r != nil,
+	}
+
+	if f.bidirectional {
+		if err := f.writeControl(controlReady); err != nil {
+			return nil, err
+		}
+		if err := f.readControl(controlAccept); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := f.writeControl(controlStart); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// writeFrame writes a data frame, the buffer is flushed by Flush
+func (f *frameWriter) writeFrame(b []byte) error {
+	if err := binary.Write(f.w, binary.BigEndian, uint32(len(b))); err != nil {
+		return err
+	}
+
+	_, err := f.w.Write(b)
+
+	return err
+}
+
+// Flush flushes the buffered frames
+func (f *frameWriter) Flush() error {
+	return f.w.Flush()
+}
+
+// Close writes the stop frame, and waits for the finish frame if bidirectional
+func (f *frameWriter) Close() error {
+	if err := f.writeControl(controlStop); err != nil {
+		return err
+	}
+
+	if f.bidirectional {
+		return f.readControl(controlFinish)
+	}
+
+	return nil
+}
+
+// writeControl writes a control frame and flushes it, the content type is included except stop frame
+func (f *frameWriter) writeControl(t uint32) error {
+	fields := []uint32{t}
+	if t != controlStop {
+		fields = append(fields, controlFieldContentType, uint32(len(ContentType)))
+	}
+
+	frame := []uint32{0, uint32(len(fields) * 4)}
+	if t != controlStop {
+		frame[1] += uint32(len(ContentType))
+	}
+
+	for _, v := range append(frame, fields...) {
+		if err := binary.Write(f.w, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+
+	if t != controlStop {
+		if _, err := f.w.WriteString(ContentType); err != nil {
+			return err
+		}
+	}
+
+	return f.w.Flush()
+}
+
+// readControl reads a control frame, fails if it is not of type t
+func (f *frameWriter) readControl(t uint32) error {
+	var head [3]uint32
+	if err := binary.Read(f.r, binary.BigEndian, head[:2]); err != nil {
+		return err
+	}
+
+	if head[0] != 0 || head[1] < 4 || head[1] > maxControlSize {
+		return fmt.Errorf("doh: dnstap: invalid control frame")
+	}
+
+	if err := binary.Read(f.r, binary.BigEndian, head[2:]); err != nil {
+		return err
+	}
+
+	if _, err := io.CopyN(io.Discard, f.r, int64(head[1]-4)); err != nil {
+		return err
+	}
+
+	if head[2] != t {
+		return fmt.Errorf("doh: dnstap: unexpected control frame: %d", head[2])
+	}
+
+	return nil
+}
@@ -21,11 +21,17 @@ package doh
 
 import (
 	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
-	"github.com/likexian/doh-go/dns"
+	"github.com/ideatocode/doh-go/cache"
+	"github.com/ideatocode/doh-go/clock"
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/transport"
 	"github.com/likexian/gokit/assert"
 )
 
@@ -132,3 +138,375 @@ func TestConcurrentQuery(t *testing.T) {
 
 	wg.Wait()
 }
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// staticProvider is a third-party provider answering every query with an A record
+type staticProvider struct {
+	name string
+	data string
+}
+
+func (p *staticProvider) String() string {
+	return p.name
+}
+
+func (p *staticProvider) Query(ctx context.Context, d dns.Domain, t dns.Type) (*dns.Response, error) {
+	return p.ECSQuery(ctx, d, t, "")
+}
+
+func (p *staticProvider) ECSQuery(ctx context.Context, d dns.Domain, t dns.Type, s dns.ECS) (*dns.Response, error) {
+	return &dns.Response{Provider: p.name, Answer: []dns.Answer{{Name: string(d), Type: 1, TTL: 300, Data: p.data}}}, nil
+}
+
+func (p *staticProvider) SetProvides(int) error {
+	return nil
+}
+
+func (p *staticProvider) Capabilities() dns.Capabilities {
+	return dns.Capabilities{Types: []dns.Type{dns.TypeA}}
+}
+
+func TestUseProviders(t *testing.T) {
+	ctx := context.Background()
+	c := UseProviders(&staticProvider{name: "static", data: "1.2.3.4"}, &staticProvider{name: "other", data: "1.2.3.4"})
+	defer c.Close()
+
+	rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "1.2.3.4")
+	assert.Equal(t, len(c.Stats()), 2)
+
+	c.SetProviderEnabled(CustomProvider, false)
+	rsp, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Provider, "other")
+	assert.True(t, c.Healthy(CustomProvider+1))
+}
+
+type panicProvider struct {
+	staticProvider
+}
+
+func (p *panicProvider) ECSQuery(ctx context.Context, d dns.Domain, t dns.Type, s dns.ECS) (*dns.Response, error) {
+	panic("boom")
+}
+
+func TestProviderPanic(t *testing.T) {
+	ctx := context.Background()
+	c := UseProviders(&panicProvider{staticProvider{name: "panic"}})
+	defer c.Close()
+
+	_, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Equal(t, c.Stats()[0].Queries, int64(1))
+	assert.Equal(t, c.Stats()[0].Successes, int64(0))
+
+	c = UseProviders(&panicProvider{staticProvider{name: "panic"}}, &staticProvider{name: "static", data: "1.2.3.4"})
+	defer c.Close()
+
+	rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Provider, "static")
+}
+
+func TestCanonicalName(t *testing.T) {
+	rt, hosts := hostRecorder()
+	c := UseProviders(&staticProvider{name: "static", data: "1.2.3.4"}).EnableCache(true)
+	defer c.Close()
+
+	ctx := context.Background()
+	rsp, err := c.Query(ctx, "Likexian.COM.", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Name, "likexian.com.")
+
+	_, cached, err := c.ecsQuery(ctx, "likexian.com", "a", "")
+	assert.Nil(t, err)
+	assert.True(t, cached)
+
+	g := Use(GoogleProvider).SetRoundTripper(rt).EnableCache(true)
+	defer g.Close()
+	for _, v := range []dns.Domain{"likexian.com", "LIKEXIAN.com.", "likexian.COM"} {
+		_, err = g.Query(ctx, v, dns.TypeA)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, len(hosts()), 1)
+}
+
+func TestSetClock(t *testing.T) {
+	rt, hosts := hostRecorder()
+	clk := clock.NewFake(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := Use(GoogleProvider).SetRoundTripper(rt).SetClock(clk).EnableCache(true)
+	defer c.Close()
+
+	ctx := context.Background()
+	query := func() {
+		_, err := c.Query(ctx, "likexian.com", dns.TypeA)
+		assert.Nil(t, err)
+	}
+
+	query()
+	clk.Advance(299 * time.Second)
+	query()
+	assert.Equal(t, len(hosts()), 1)
+
+	clk.Advance(time.Second)
+	query()
+	assert.Equal(t, len(hosts()), 1)
+
+	c.SetCache(cache.NewSharded(2)).SetClock(nil)
+	query()
+	clk.Advance(time.Hour)
+	query()
+	assert.Equal(t, len(hosts()), 1)
+}
+
+func TestSetIDNA(t *testing.T) {
+	names := []string{}
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		names = append(names, r.URL.Query().Get("name"))
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body: ioutil.NopCloser(strings.NewReader(
+				`{"Status":0,"Answer":[{"name":"xn--fiq228c.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`)),
+			Request: r,
+		}, nil
+	})
+	c := Use(GoogleProvider).SetRoundTripper(rt).SetFormat(dns.FormatJSON)
+	defer c.Close()
+
+	ctx := context.Background()
+	rsp, err := c.Query(ctx, "中文.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, names, []string{"xn--fiq228c.com"})
+	assert.Equal(t, rsp.Answer[0].Name, "xn--fiq228c.com.")
+	assert.Equal(t, rsp.Answer[0].Unicode, "中文.com.")
+
+	c.SetIDNA(dns.IDNAStrict)
+	_, err = c.Query(ctx, "_sip._tcp.likexian.com", dns.TypeTXT)
+	assert.NotNil(t, err)
+	assert.Equal(t, len(names), 1)
+}
+
+func TestSetHTTPClient(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		body := `{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})
+
+	c := Use(CloudflareProvider, GoogleProvider)
+	defer c.Close()
+
+	c.SetHTTPClient(&http.Client{Transport: rt})
+	rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+
+	c.SetHTTPClient(nil).SetRoundTripper(rt)
+	rsp, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+}
+
+func TestSetTransportOptions(t *testing.T) {
+	c := Use()
+	defer c.Close()
+
+	c.SetUserAgent("doh-go").SetHeader("X-Token", "likexian")
+	for _, p := range c.providers {
+		assert.Equal(t, p.(transporter).Transport().Header().Get("X-Token"), "likexian")
+	}
+
+	assert.NotNil(t, c.SetProxy("ftp://127.0.0.1"))
+	assert.Nil(t, c.SetProxy("socks5://127.0.0.1:1080"))
+	assert.Nil(t, c.SetProxy(""))
+
+	assert.NotNil(t, c.SetLocalAddr("xx"))
+	assert.Nil(t, c.SetLocalAddr("127.0.0.1"))
+	assert.Nil(t, c.SetLocalAddr(""))
+
+	assert.NotNil(t, c.SetInterface("not-exists-interface"))
+	assert.Nil(t, c.SetInterface(""))
+
+	c.SetProviderTimeout(Quad9Provider, 500*time.Millisecond)
+	c.SetProviderTimeout(GoogleProvider, 2*time.Second)
+	c.SetPool(transport.Pool{MaxConnsPerHost: 4})
+	for _, p := range c.providers {
+		assert.Equal(t, p.(transporter).Transport().Client().Transport.(*http.Transport).MaxConnsPerHost, 4)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		<-r.Context().Done()
+		return nil, r.Context().Err()
+	})
+
+	c = Use(Quad9Provider, GoogleProvider).SetRoundTripper(rt).SetProviderTimeout(Quad9Provider, 50*time.Millisecond)
+	defer c.Close()
+	start := time.Now()
+	_, err := c.providers[0].Query(ctx, "likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Lt(t, int64(time.Since(start)), int64(time.Second))
+
+	sctx, scancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer scancel()
+	_, err = c.providers[1].Query(sctx, "likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Gt(t, int64(time.Since(start)), int64(200*time.Millisecond))
+}
+
+func TestSetParsing(t *testing.T) {
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		body := `{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":"300","data":"1.1.1.1"}]}`
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {dns.ContentTypeJSON}},
+			Body: ioutil.NopCloser(strings.NewReader(body)), Request: r}, nil
+	})
+
+	c := Use(GoogleProvider, CloudflareProvider, DNSPodProvider).SetRoundTripper(rt).SetFormat(dns.FormatJSON).
+		SetParsing(dns.ParsingStrict).SetProviderParsing(CloudflareProvider, dns.ParsingLenient)
+	defer c.Close()
+
+	ctx := context.Background()
+	_, err := c.providers[0].Query(ctx, "likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+
+	rsp, err := c.providers[1].Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].TTL, 300)
+}
+
+func TestTruncated(t *testing.T) {
+	var mu sync.Mutex
+	queried := 0
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		mu.Lock()
+		queried++
+		mu.Unlock()
+		body := `{"Status":0,"TC":true,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`
+		if r.Method == http.MethodPost {
+			return &http.Response{StatusCode: http.StatusBadGateway, Body: ioutil.NopCloser(strings.NewReader("")),
+				Request: r}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {dns.ContentTypeJSON}},
+			Body: ioutil.NopCloser(strings.NewReader(body)), Request: r}, nil
+	})
+
+	c := Use(CloudflareProvider).SetRoundTripper(rt).SetFormat(dns.FormatJSON).EnableCache(true)
+	defer c.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+		assert.Nil(t, err)
+		assert.True(t, rsp.TC)
+		assert.True(t, rsp.Metadata.Truncated)
+	}
+
+	// not cached, and the truncated response of fastest provider fails over to all providers
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, queried, 6)
+}
+
+func TestWarm(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	warmed := 0
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		mu.Lock()
+		if r.Method == http.MethodHead {
+			warmed++
+		}
+		mu.Unlock()
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+			Request:    r,
+		}, nil
+	})
+
+	c := Use(CloudflareProvider, GoogleProvider).SetRoundTripper(rt)
+	defer c.Close()
+
+	err := c.Warm(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, warmed, 2)
+
+	c.SetKeepWarm(time.Second)
+	time.Sleep(3500 * time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, warmed, 4)
+	mu.Unlock()
+
+	c.SetKeepWarm(0).SetIdleTimeout(time.Minute).SetKeepAlive(time.Minute)
+}
+
+func TestCachedQueryAllocs(t *testing.T) {
+	rt, _ := hostRecorder()
+	c := Use(GoogleProvider).SetRoundTripper(rt).EnableCache(true)
+	defer c.Close()
+
+	ctx := context.Background()
+	_, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = c.Query(ctx, "likexian.com", dns.TypeA)
+	})
+	assert.True(t, allocs < 10, allocs)
+}
+
+// benchmarkClient returns a client of google provider answering every query without network
+func benchmarkClient() *DoH {
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/dns-json"}},
+			Body: ioutil.NopCloser(strings.NewReader(
+				`{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`)),
+			Request: r,
+		}, nil
+	})
+
+	return Use(GoogleProvider).SetRoundTripper(rt).SetFormat(dns.FormatJSON)
+}
+
+func BenchmarkQuery(b *testing.B) {
+	c := benchmarkClient()
+	defer c.Close()
+
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = c.Query(ctx, "likexian.com", dns.TypeA)
+	}
+}
+
+func BenchmarkQueryCached(b *testing.B) {
+	c := benchmarkClient().EnableCache(true)
+	defer c.Close()
+
+	ctx := context.Background()
+	_, _ = c.Query(ctx, "likexian.com", dns.TypeA)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = c.Query(ctx, "likexian.com", dns.TypeA)
+		}
+	})
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dohtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// Check is a conformance check of provider, the declared is whether the provider capabilities claim it
+type Check struct {
+	Name     string        `json:"name"`
+	Declared bool          `json:"declared"`
+	Passed   bool          `json:"passed"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Report is the conformance checks of provider
+type Report struct {
+	Provider string  `json:"provider"`
+	Checks   []Check `json:"checks"`
+}
+
+// conformance is a conformance check, it returns nil if the provider conforms
+type conformance struct {
+	name     string
+	declared func(dns.Capabilities) bool
+	check    func(context.Context, dns.Provider) error
+}
+
+// conformances is the conformance checks against the live providers
+var conformances = []conformance{
+	typeConformance("google.com", dns.TypeA),
+	typeConformance("google.com", dns.TypeAAAA),
+	typeConformance("google.com", dns.TypeMX),
+	typeConformance("google.com", dns.TypeTXT),
+	typeConformance("google.com", dns.TypeNS),
+	typeConformance("google.com", dns.TypeSOA),
+	typeConformance("www.github.com", dns.TypeCNAME),
+	typeConformance("8.8.8.8.in-addr.arpa", dns.TypePTR),
+	{"ECS", func(c dns.Capabilities) bool { return c.ECS }, checkECS},
+	{"IDN", func(dns.Capabilities) bool { return true }, checkIDN},
+	{"NXDOMAIN", func(dns.Capabilities) bool { return true }, checkNXDomain},
+	{"invalid", func(dns.Capabilities) bool { return true }, checkInvalid},
+}
+
+// Conformance returns the report of provider checked against its live endpoint for the basic types, ECS, IDN
+// and errors, the checks failed are undeclared capabilities or upstream api changes
+func Conformance(ctx context.Context, p dns.Provider) Report {
+	caps := p.Capabilities()
+	r := Report{Provider: p.String(), Checks: []Check{}}
+	for _, v := range conformances {
+		start := time.Now()
+		err := v.check(ctx, p)
+		c := Check{Name: v.name, Declared: v.declared(caps), Passed: err == nil, Duration: time.Since(start)}
+		if err != nil {
+			c.Error = err.Error()
+		}
+		r.Checks = append(r.Checks, c)
+	}
+
+	return r
+}
+
+// Failed returns the checks declared by provider but failed
+func (r Report) Failed() []Check {
+	cs := []Check{}
+	for _, v := range r.Checks {
+		if v.Declared && !v.Passed {
+			cs = append(cs, v)
+		}
+	}
+
+	return cs
+}
+
+// WriteMatrix writes the capability matrix of reports, ok is passed, FAIL is declared but failed, - is neither
+// declared nor passed, and ok* is passed but not declared
+func WriteMatrix(w io.Writer, rs []Report) error {
+	if len(rs) == 0 {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	names := []string{"CHECK"}
+	for _, v := range rs {
+		names = append(names, strings.ToUpper(v.Provider))
+	}
+	fmt.Fprintln(tw, strings.Join(names, "\t"))
+
+	for k, c := range rs[0].Checks {
+		row := []string{c.Name}
+		for _, v := range rs {
+			row = append(row, cell(v.Checks[k]))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// cell returns the matrix cell of check
+func cell(c Check) string {
+	switch {
+	case c.Passed && c.Declared:
+		return "ok"
+	case c.Passed:
+		return "ok*"
+	case c.Declared:
+		return "FAIL"
+	default:
+		return "-"
+	}
+}
+
+// typeConformance returns the check of query type answered with the records of type
+func typeConformance(d dns.Domain, t dns.Type) conformance {
+	return conformance{
+		name: string(t),
+		declared: func(c dns.Capabilities) bool {
+			return c.SupportsType(t)
+		},
+		check: func(ctx context.Context, p dns.Provider) error {
+			rsp, err := p.Query(ctx, d, t)
+			if err != nil {
+				return err
+			}
+			return hasAnswer(rsp, t)
+		},
+	}
+}
+
+// checkECS checks the query with the edns0-client-subnet option
+func checkECS(ctx context.Context, p dns.Provider) error {
+	rsp, err := p.ECSQuery(ctx, "google.com", dns.TypeA, "1.2.3.0/24")
+	if err != nil {
+		return err
+	}
+
+	return hasAnswer(rsp, dns.TypeA)
+}
+
+// checkIDN checks the query of unicode domain, which is asked in punycode
+func checkIDN(ctx context.Context, p dns.Provider) error {
+	rsp, err := p.Query(ctx, "münchen.de", dns.TypeA)
+	if err != nil {
+		return err
+	}
+
+	if len(rsp.Question) == 0 || !strings.HasPrefix(dns.Canonical(rsp.Question[0].Name), "xn--") {
+		return fmt.Errorf("doh: dohtest: question is not punycode: %v", rsp.Question)
+	}
+
+	return hasAnswer(rsp, dns.TypeA)
+}
+
+// checkNXDomain checks the response of name not existing, which is NXDOMAIN with an error
+func checkNXDomain(ctx context.Context, p dns.Provider) error {
+	rsp, err := p.Query(ctx, "doh-go.invalid", dns.TypeA)
+	if err == nil {
+		return fmt.Errorf("doh: dohtest: missing error of nxdomain")
+	}
+
+	if rsp == nil || rsp.Status != 3 {
+		return fmt.Errorf("doh: dohtest: not nxdomain: %w", err)
+	}
+
+	return nil
+}
+
+// checkInvalid checks the query of invalid name, which fails without response
+func checkInvalid(ctx context.Context, p dns.Provider) error {
+	rsp, err := p.Query(ctx, "likexian..com", dns.TypeA)
+	if err == nil || rsp != nil {
+		return fmt.Errorf("doh: dohtest: invalid name is queried")
+	}
+
+	return nil
+}
+
+// hasAnswer returns an error if rsp has no answer of type t
+func hasAnswer(rsp *dns.Response, t dns.Type) error {
+	for range rsp.Answers(t) {
+		return nil
+	}
+
+	return fmt.Errorf("doh: dohtest: missing %s answer, status %d", t, rsp.Status)
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dohtest
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestConformanceReport(t *testing.T) {
+	p := New("fake")
+	p.SetCapabilities(dns.Capabilities{Types: []dns.Type{dns.TypeA, dns.TypeMX}})
+	p.Answer("google.com", dns.TypeA, "1.2.3.4")
+	p.Answer("google.com", dns.TypeTXT, `"v=spf1 -all"`)
+	p.Answer("münchen.de", dns.TypeA, "1.2.3.4")
+	p.On("google.com", dns.TypeMX)
+
+	ctx := context.Background()
+	r := Conformance(ctx, p)
+	assert.Equal(t, r.Provider, "fake")
+	assert.Equal(t, len(r.Checks), len(conformances))
+
+	checks := map[string]Check{}
+	for _, v := range r.Checks {
+		checks[v.Name] = v
+	}
+	assert.True(t, checks["A"].Passed && checks["A"].Declared)
+	assert.True(t, checks["TXT"].Passed && !checks["TXT"].Declared)
+	assert.True(t, !checks["MX"].Passed && checks["MX"].Declared)
+	assert.Contains(t, checks["MX"].Error, "missing MX answer")
+	assert.True(t, !checks["AAAA"].Passed && !checks["AAAA"].Declared)
+	assert.True(t, checks["ECS"].Passed && !checks["ECS"].Declared)
+	assert.True(t, checks["IDN"].Passed)
+	assert.True(t, checks["NXDOMAIN"].Passed)
+	assert.True(t, checks["invalid"].Passed)
+
+	failed := r.Failed()
+	assert.Equal(t, len(failed), 1)
+	assert.Equal(t, failed[0].Name, "MX")
+
+	w := &bytes.Buffer{}
+	assert.Nil(t, WriteMatrix(w, nil))
+	assert.Equal(t, w.String(), "")
+
+	other := Conformance(ctx, New("other"))
+	assert.Nil(t, WriteMatrix(w, []Report{r, other}))
+	lines := strings.Split(strings.TrimSpace(w.String()), "\n")
+	assert.Equal(t, len(lines), len(conformances)+1)
+	assert.Equal(t, strings.Fields(lines[0]), []string{"CHECK", "FAKE", "OTHER"})
+	assert.Equal(t, strings.Fields(lines[1]), []string{"A", "ok", "FAIL"})
+	assert.Equal(t, strings.Fields(lines[2]), []string{"AAAA", "-", "FAIL"})
+	assert.Equal(t, strings.Fields(lines[4]), []string{"TXT", "ok*", "FAIL"})
+}
+
+// TestConformance checks the built-in providers against their live endpoints, it is opt-in by DOH_CONFORMANCE
+func TestConformance(t *testing.T) {
+	if os.Getenv("DOH_CONFORMANCE") == "" {
+		t.Skip("set DOH_CONFORMANCE=1 to check the live providers")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rs := []Report{}
+	for _, v := range doh.Providers {
+		p := doh.New(v)
+		r := Conformance(ctx, p)
+		for _, c := range r.Failed() {
+			t.Errorf("%s %s: %s", r.Provider, c.Name, c.Error)
+		}
+		rs = append(rs, r)
+	}
+
+	w := &strings.Builder{}
+	assert.Nil(t, WriteMatrix(w, rs))
+	t.Logf("capability matrix:\n%s", w)
+}
@@ -0,0 +1,297 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dohtest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// Provider is a scriptable fake DoH provider answering by the rules without network access, for unit testing
+// the dns dependent logic, it is safe for concurrent use and can be scripted while querying
+type Provider struct {
+	name    string
+	caps    dns.Capabilities
+	rules   []*Rule
+	queries []Query
+	sync.RWMutex
+}
+
+// Rule is the scripted result of the matched queries, the first added rule matched is used
+type Rule struct {
+	provider *Provider
+	domain   dns.Domain
+	qtype    dns.Type
+	answers  []string
+	ttl      time.Duration
+	status   int
+	err      error
+	delay    time.Duration
+	times    int
+	used     int
+}
+
+// Query is the query received by provider
+type Query struct {
+	Domain dns.Domain
+	Type   dns.Type
+	ECS    dns.ECS
+	Flags  dns.Flags
+}
+
+// DefaultTTL is the default ttl of answers
+const DefaultTTL = 300 * time.Second
+
+var _ dns.Provider = (*Provider)(nil)
+
+// Version returns package version
+func Version() string {
+	return "0.1.0"
+}
+
+// Author returns package author
+func Author() string {
+	return "[Li Kexian](https://www.likexian.com/)"
+}
+
+// License returns package license
+func License() string {
+	return "Licensed under the Apache License 2.0"
+}
+
+// New returns a new fake provider named name, dohtest if empty, the queries not matched are answered NXDOMAIN
+func New(name string) *Provider {
+	if name == "" {
+		name = "dohtest"
+	}
+
+	return &Provider{
+		name: name,
+	}
+}
+
+// String returns string of provider
+func (p *Provider) String() string {
+	return p.name
+}
+
+// Capabilities returns the features supported by provider, all are supported if not set
+func (p *Provider) Capabilities() dns.Capabilities {
+	p.RLock()
+	defer p.RUnlock()
+
+	return p.caps
+}
+
+// SetCapabilities set the features supported by provider, for example the types to test the routing
+func (p *Provider) SetCapabilities(caps dns.Capabilities) *Provider {
+	p.Lock()
+	p.caps = caps
+	p.Unlock()
+
+	return p
+}
+
+// SetProvides set upstream provides type, dohtest does NOT supported
+func (p *Provider) SetProvides(int) error {
+	return nil
+}
+
+// On adds a rule of the domain and type, empty to match any, it answers NOERROR without records until scripted
+func (p *Provider) On(d dns.Domain, t dns.Type) *Rule {
+	r := &Rule{
+		provider: p,
+		domain:   d,
+		qtype:    t.Normalize(),
+		ttl:      DefaultTTL,
+	}
+
+	p.Lock()
+	p.rules = append(p.rules, r)
+	p.Unlock()
+
+	return r
+}
+
+// Answer adds a rule answering the domain and type with the records data, for example: 1.2.3.4
+func (p *Provider) Answer(d dns.Domain, t dns.Type, data ...string) *Rule {
+	return p.On(d, t).Answer(data...)
+}
+
+// Queries returns the queries received in order
+func (p *Provider) Queries() []Query {
+	p.RLock()
+	defer p.RUnlock()
+
+	return append([]Query(nil), p.queries...)
+}
+
+// Reset removes the rules and the queries received
+func (p *Provider) Reset() *Provider {
+	p.Lock()
+	p.rules = nil
+	p.queries = nil
+	p.Unlock()
+
+	return p
+}
+
+// Query do DoH query
+func (p *Provider) Query(ctx context.Context, d dns.Domain, t dns.Type) (*dns.Response, error) {
+	return p.ECSQuery(ctx, d, t, "")
+}
+
+// ECSQuery do DoH query with the edns0-client-subnet option, it is answered by the first rule matched, and the
+// invalid domains fail before matching like the built-in providers
+func (p *Provider) ECSQuery(ctx context.Context, d dns.Domain, t dns.Type, s dns.ECS) (*dns.Response, error) {
+	code, err := t.Code()
+	if err != nil {
+		return nil, err
+	}
+
+	punycode, err := d.Punycode()
+	if err != nil {
+		return nil, err
+	}
+
+	p.Lock()
+	p.queries = append(p.queries, Query{Domain: d, Type: t, ECS: s, Flags: dns.FlagsOf(ctx)})
+	r := p.match(d, t)
+	var rule Rule
+	if r != nil {
+		r.used++
+		rule = *r
+	} else {
+		rule = Rule{status: 3}
+	}
+	p.Unlock()
+
+	if rule.delay > 0 {
+		timer := time.NewTimer(rule.delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if rule.err != nil {
+		return nil, rule.err
+	}
+
+	name := dns.Canonical(punycode)
+	rsp := &dns.Response{
+		Status:   rule.status,
+		RD:       true,
+		RA:       true,
+		Question: []dns.Question{{Name: name, Type: int(code)}},
+		Answer:   []dns.Answer{},
+		Provider: p.name,
+	}
+
+	for _, v := range rule.answers {
+		rsp.Answer = append(rsp.Answer, dns.Answer{Name: name, Type: int(code), TTL: int(rule.ttl / time.Second),
+			Data: v})
+	}
+
+	if rsp.Status != 0 {
+		return rsp, fmt.Errorf("doh: dohtest: failed response code %d", rsp.Status)
+	}
+
+	return rsp, nil
+}
+
+// match returns the first rule matching the query with remaining times, it must be called with the lock held
+func (p *Provider) match(d dns.Domain, t dns.Type) *Rule {
+	t = t.Normalize()
+	for _, v := range p.rules {
+		if v.times > 0 && v.used >= v.times {
+			continue
+		}
+		if v.domain != "" && !dns.Equal(string(v.domain), string(d)) {
+			continue
+		}
+		if v.qtype != "" && v.qtype != t {
+			continue
+		}
+		return v
+	}
+
+	return nil
+}
+
+// Answer set the records data of answers, which are added to the ones set
+func (r *Rule) Answer(data ...string) *Rule {
+	r.provider.Lock()
+	r.answers = append(r.answers, data...)
+	r.provider.Unlock()
+
+	return r
+}
+
+// TTL set the ttl of answers, default DefaultTTL
+func (r *Rule) TTL(ttl time.Duration) *Rule {
+	r.provider.Lock()
+	r.ttl = ttl
+	r.provider.Unlock()
+
+	return r
+}
+
+// Status set the response code, the non-zero ones are returned with an error as the real providers
+func (r *Rule) Status(rcode int) *Rule {
+	r.provider.Lock()
+	r.status = rcode
+	r.provider.Unlock()
+
+	return r
+}
+
+// Error set the error returned without response, for example to test the failover
+func (r *Rule) Error(err error) *Rule {
+	r.provider.Lock()
+	r.err = err
+	r.provider.Unlock()
+
+	return r
+}
+
+// Delay set the latency before answering, the query fails if its context is done first
+func (r *Rule) Delay(delay time.Duration) *Rule {
+	r.provider.Lock()
+	r.delay = delay
+	r.provider.Unlock()
+
+	return r
+}
+
+// Times set the max times the rule is matched, the later rules are matched after, 0 for no limit
+func (r *Rule) Times(n int) *Rule {
+	r.provider.Lock()
+	r.times = n
+	r.provider.Unlock()
+
+	return r
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dohtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestVersion(t *testing.T) {
+	assert.Contains(t, Version(), ".")
+	assert.Contains(t, Author(), "likexian")
+	assert.Contains(t, License(), "Apache License")
+}
+
+func TestProvider(t *testing.T) {
+	p := New("")
+	assert.Equal(t, p.String(), "dohtest")
+	assert.Nil(t, p.SetProvides(1))
+	assert.True(t, p.Capabilities().SupportsType(dns.TypeMX))
+
+	p.SetCapabilities(dns.Capabilities{Types: []dns.Type{dns.TypeA}})
+	assert.False(t, p.Capabilities().SupportsType(dns.TypeMX))
+
+	ctx := context.Background()
+	p.Answer("likexian.com", dns.TypeA, "1.2.3.4", "1.2.3.5").TTL(time.Minute)
+	p.On("", dns.TypeMX).Answer("10 mx.likexian.com.")
+
+	rsp, err := p.Query(ctx, "Likexian.COM.", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Provider, "dohtest")
+	assert.Equal(t, rsp.Question, []dns.Question{{Name: "likexian.com.", Type: 1}})
+	assert.Equal(t, rsp.Answer, []dns.Answer{{Name: "likexian.com.", Type: 1, TTL: 60, Data: "1.2.3.4"},
+		{Name: "likexian.com.", Type: 1, TTL: 60, Data: "1.2.3.5"}})
+
+	rsp, err = p.Query(ctx, "example.org", dns.TypeMX)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "10 mx.likexian.com.")
+
+	rsp, err = p.Query(ctx, "example.org", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Equal(t, rsp.Status, 3)
+
+	_, err = p.Query(ctx, "example.org", "XX")
+	assert.NotNil(t, err)
+
+	_, err = p.ECSQuery(dns.WithFlags(ctx, dns.Flags{DO: true}), "example.org", dns.TypeMX, "1.2.3.4/24")
+	assert.Nil(t, err)
+
+	qs := p.Queries()
+	assert.Equal(t, len(qs), 4)
+	assert.Equal(t, qs[0], Query{Domain: "Likexian.COM.", Type: "a"})
+	assert.Equal(t, qs[3], Query{Domain: "example.org", Type: dns.TypeMX, ECS: "1.2.3.4/24", Flags: dns.Flags{DO: true}})
+
+	p.Reset()
+	assert.Equal(t, len(p.Queries()), 0)
+	_, err = p.Query(ctx, "likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+}
+
+func TestRule(t *testing.T) {
+	p := New("fake")
+	ctx := context.Background()
+
+	failed := errors.New("injected")
+	p.On("likexian.com", "").Error(failed).Times(1)
+	p.On("likexian.com", "").Status(2).Times(1)
+	p.Answer("likexian.com", "", "1.1.1.1")
+
+	_, err := p.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Equal(t, err, failed)
+
+	rsp, err := p.Query(ctx, "likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Equal(t, rsp.Status, 2)
+
+	rsp, err = p.Query(ctx, "likexian.com", dns.TypeAAAA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Type, 28)
+
+	p.Reset().On("", "").Delay(time.Second)
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = p.Query(cctx, "likexian.com", dns.TypeA)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	p.Reset().On("", "").Delay(10 * time.Millisecond)
+	start := time.Now()
+	rsp, err = p.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, len(rsp.Answer), 0)
+	assert.True(t, time.Since(start) >= 10*time.Millisecond)
+}
+
+func TestClient(t *testing.T) {
+	slow, fast := New("slow"), New("fast")
+	slow.Answer("", "", "1.1.1.1").Delay(time.Second)
+	fast.Answer("", "", "2.2.2.2")
+
+	c := doh.UseProviders(slow, fast).EnableCache(true)
+	defer c.Close()
+
+	ctx := context.Background()
+	rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "2.2.2.2")
+
+	_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, len(fast.Queries()), 1)
+}
@@ -0,0 +1,215 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dohtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// Case is a query of the golden matrix
+type Case struct {
+	Domain dns.Domain `json:"domain"`
+	Type   dns.Type   `json:"type"`
+}
+
+// Golden is the normalized response of a provider to a case, the error is set if failed without response
+type Golden struct {
+	Provider string        `json:"provider"`
+	Case     Case          `json:"case"`
+	Response *dns.Response `json:"response,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Matrix is the standard names and types queried for the golden fixtures
+var Matrix = []Case{
+	{"likexian.com", dns.TypeA},
+	{"likexian.com", dns.TypeAAAA},
+	{"likexian.com", dns.TypeMX},
+	{"likexian.com", dns.TypeTXT},
+	{"likexian.com", dns.TypeNS},
+	{"likexian.com", dns.TypeSOA},
+	{"www.likexian.com", dns.TypeCNAME},
+	{"1.1.1.1.in-addr.arpa", dns.TypePTR},
+	{"cloudflare.com", "HTTPS"},
+	{"nxdomain.likexian.com", dns.TypeA},
+}
+
+// Normalize returns a copy of rsp without the volatile fields, the names are canonical, the ttls are zero and
+// the answers are sorted, so that the responses of different times are comparable
+func Normalize(rsp *dns.Response) *dns.Response {
+	if rsp == nil {
+		return nil
+	}
+
+	r := *rsp
+	r.Question = append([]dns.Question(nil), rsp.Question...)
+	r.Answer = append([]dns.Answer(nil), rsp.Answer...)
+	r.Canonicalize()
+
+	for k := range r.Answer {
+		r.Answer[k].TTL = 0
+	}
+	slices.SortFunc(r.Answer, func(a, b dns.Answer) int {
+		if a.Type != b.Type {
+			return a.Type - b.Type
+		}
+		if a.Name != b.Name {
+			return strings.Compare(a.Name, b.Name)
+		}
+		return strings.Compare(a.Data, b.Data)
+	})
+
+	r.Comment = ""
+	r.Provider = ""
+	r.Metadata = nil
+
+	return &r
+}
+
+// Generate returns the golden fixtures of provider to the cases queried in order, Matrix if no cases
+func Generate(ctx context.Context, p dns.Provider, cases ...Case) []Golden {
+	if len(cases) == 0 {
+		cases = Matrix
+	}
+
+	gs := []Golden{}
+	for _, v := range cases {
+		rsp, err := p.Query(ctx, v.Domain, v.Type)
+		g := Golden{Provider: p.String(), Case: v, Response: Normalize(rsp)}
+		if err != nil && rsp == nil {
+			g.Error = err.Error()
+		}
+		gs = append(gs, g)
+	}
+
+	return gs
+}
+
+// SaveGolden writes the golden fixtures to the file
+func SaveGolden(path string, gs []Golden) error {
+	b, err := json.MarshalIndent(gs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// LoadGolden returns the golden fixtures of the file
+func LoadGolden(path string) ([]Golden, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	gs := []Golden{}
+	if err := json.Unmarshal(b, &gs); err != nil {
+		return nil, fmt.Errorf("doh: dohtest: invalid golden %s: %w", path, err)
+	}
+
+	return gs, nil
+}
+
+// Drift returns the differences of got from the golden fixtures want, the answer data is not compared as it
+// changes over time, but the status, flags, question and answer types are, which tell the upstream api drift
+func Drift(want, got []Golden) []string {
+	key := func(g Golden) string {
+		return fmt.Sprintf("%s %s %s", g.Provider, dns.Canonical(string(g.Case.Domain)), g.Case.Type.Normalize())
+	}
+
+	gots := map[string]Golden{}
+	for _, v := range got {
+		gots[key(v)] = v
+	}
+
+	diffs := []string{}
+	for _, w := range want {
+		k := key(w)
+		g, ok := gots[k]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s: missing", k))
+			continue
+		}
+		delete(gots, k)
+		diffs = append(diffs, diff(k, w, g)...)
+	}
+
+	for _, v := range got {
+		if _, ok := gots[key(v)]; ok {
+			diffs = append(diffs, fmt.Sprintf("%s: unexpected", key(v)))
+		}
+	}
+
+	return diffs
+}
+
+// diff returns the differences of the golden fixtures of the same case
+func diff(k string, want, got Golden) []string {
+	if (want.Error == "") != (got.Error == "") {
+		return []string{fmt.Sprintf("%s: error %q, want %q", k, got.Error, want.Error)}
+	}
+
+	w, g := want.Response, got.Response
+	if w == nil || g == nil {
+		if (w == nil) != (g == nil) {
+			return []string{fmt.Sprintf("%s: response %t, want %t", k, g != nil, w != nil)}
+		}
+		return nil
+	}
+
+	diffs := []string{}
+	if w.Status != g.Status {
+		diffs = append(diffs, fmt.Sprintf("%s: status %d, want %d", k, g.Status, w.Status))
+	}
+
+	wf := fmt.Sprintf("TC=%t RD=%t RA=%t AD=%t CD=%t", w.TC, w.RD, w.RA, w.AD, w.CD)
+	gf := fmt.Sprintf("TC=%t RD=%t RA=%t AD=%t CD=%t", g.TC, g.RD, g.RA, g.AD, g.CD)
+	if wf != gf {
+		diffs = append(diffs, fmt.Sprintf("%s: flags %s, want %s", k, gf, wf))
+	}
+
+	if !slices.Equal(w.Question, g.Question) {
+		diffs = append(diffs, fmt.Sprintf("%s: question %v, want %v", k, g.Question, w.Question))
+	}
+
+	if wt, gt := answerTypes(w), answerTypes(g); !slices.Equal(wt, gt) {
+		diffs = append(diffs, fmt.Sprintf("%s: answer types %v, want %v", k, gt, wt))
+	}
+
+	return diffs
+}
+
+// answerTypes returns the sorted distinct types of answers
+func answerTypes(rsp *dns.Response) []int {
+	ts := []int{}
+	for _, v := range rsp.Answer {
+		ts = append(ts, v.Type)
+	}
+	slices.Sort(ts)
+
+	return slices.Compact(ts)
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dohtest
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	assert.True(t, Normalize(nil) == nil)
+
+	rsp := &dns.Response{
+		Question: []dns.Question{{Name: "Likexian.COM", Type: 1}},
+		Answer: []dns.Answer{{Name: "likexian.com.", Type: 1, TTL: 60, Data: "1.2.3.5"},
+			{Name: "LIKEXIAN.com.", Type: 1, TTL: 30, Data: "1.2.3.4"},
+			{Name: "likexian.com.", Type: 5, TTL: 30, Data: "cname.likexian.com."}},
+		Comment:  "cached",
+		Provider: "google",
+		Metadata: &dns.Metadata{StatusCode: 200},
+	}
+
+	n := Normalize(rsp)
+	assert.Equal(t, n.Question, []dns.Question{{Name: "likexian.com.", Type: 1}})
+	assert.Equal(t, n.Answer, []dns.Answer{{Name: "likexian.com.", Type: 1, Data: "1.2.3.4"},
+		{Name: "likexian.com.", Type: 1, Data: "1.2.3.5"}, {Name: "likexian.com.", Type: 5, Data: "cname.likexian.com."}})
+	assert.Equal(t, n.Comment, "")
+	assert.Equal(t, n.Provider, "")
+	assert.True(t, n.Metadata == nil)
+
+	assert.Equal(t, rsp.Question[0].Name, "Likexian.COM")
+	assert.Equal(t, rsp.Answer[0].TTL, 60)
+}
+
+func TestGolden(t *testing.T) {
+	p := New("fake")
+	p.Answer("likexian.com", dns.TypeA, "1.2.3.4").TTL(30)
+	p.On("down.example", "").Error(errors.New("injected"))
+
+	ctx := context.Background()
+	cases := []Case{{"likexian.com", dns.TypeA}, {"nx.likexian.com", dns.TypeA}, {"down.example", dns.TypeA}}
+	gs := Generate(ctx, p, cases...)
+	assert.Equal(t, len(gs), 3)
+	assert.Equal(t, gs[0].Provider, "fake")
+	assert.Equal(t, gs[0].Response.Answer, []dns.Answer{{Name: "likexian.com.", Type: 1, Data: "1.2.3.4"}})
+	assert.Equal(t, gs[1].Response.Status, 3)
+	assert.Equal(t, gs[1].Error, "")
+	assert.True(t, gs[2].Response == nil)
+	assert.Equal(t, gs[2].Error, "injected")
+
+	assert.Equal(t, len(Generate(ctx, p)), len(Matrix))
+
+	path := filepath.Join(t.TempDir(), "fake.json")
+	assert.Nil(t, SaveGolden(path, gs))
+	want, err := LoadGolden(path)
+	assert.Nil(t, err)
+	assert.Equal(t, want, gs)
+	assert.Equal(t, len(Drift(want, gs)), 0)
+
+	_, err = LoadGolden(filepath.Join(t.TempDir(), "none.json"))
+	assert.NotNil(t, err)
+	assert.Nil(t, SaveGolden(path, nil))
+	_, err = LoadGolden(path)
+	assert.Nil(t, err)
+}
+
+func TestDrift(t *testing.T) {
+	p := New("fake")
+	p.Answer("likexian.com", dns.TypeA, "1.2.3.4")
+	p.On("down.example", "").Error(errors.New("injected"))
+
+	ctx := context.Background()
+	cases := []Case{{"likexian.com", dns.TypeA}, {"nx.likexian.com", dns.TypeA}, {"down.example", dns.TypeA}}
+	want := Generate(ctx, p, cases...)
+
+	p.Reset()
+	p.Answer("likexian.com", dns.TypeA, "5.6.7.8")
+	p.Answer("nx.likexian.com", dns.TypeA, "5.6.7.8")
+	p.On("extra.example", "").Answer("1.1.1.1")
+	got := Generate(ctx, p, cases[0], cases[1], cases[2], Case{"extra.example", dns.TypeA})
+	got[0].Response.AD = true
+
+	diffs := Drift(want, got)
+	assert.Equal(t, diffs, []string{
+		"fake likexian.com. A: flags TC=false RD=true RA=true AD=true CD=false, " +
+			"want TC=false RD=true RA=true AD=false CD=false",
+		"fake nx.likexian.com. A: status 0, want 3",
+		"fake nx.likexian.com. A: answer types [1], want []",
+		`fake down.example. A: error "", want "injected"`,
+		"fake extra.example. A: unexpected",
+	})
+
+	diffs = Drift(want, got[:1])
+	assert.Equal(t, diffs[1:], []string{"fake nx.likexian.com. A: missing", "fake down.example. A: missing"})
+}
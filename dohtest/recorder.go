@@ -0,0 +1,198 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dohtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Mode is the mode of recorder
+type Mode int
+
+// Recorder mode
+const (
+	// ModeReplay answers the requests by the fixtures loaded, without network access
+	ModeReplay Mode = iota
+	// ModeRecord sends the requests by the round tripper and records the exchanges
+	ModeRecord
+)
+
+// Fixture is a recorded http exchange with provider
+type Fixture struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Body       []byte      `json:"body,omitempty"`
+	StatusCode int         `json:"status_code"`
+	Proto      string      `json:"proto,omitempty"`
+	Header     http.Header `json:"header,omitempty"`
+	Response   []byte      `json:"response"`
+}
+
+// Recorder is a http round tripper recording the provider responses to a fixtures file and replaying them later,
+// for the hermetic tests of the full query stack, it is safe for concurrent use
+type Recorder struct {
+	path     string
+	mode     Mode
+	next     http.RoundTripper
+	fixtures []Fixture
+	replayed map[string]int
+	sync.Mutex
+}
+
+var _ http.RoundTripper = (*Recorder)(nil)
+
+// NewRecorder returns a new recorder of the fixtures file, its fixtures are loaded in the replay mode, and
+// the requests are sent by next in the record mode, http.DefaultTransport if nil
+func NewRecorder(path string, mode Mode, next http.RoundTripper) (*Recorder, error) {
+	if mode < ModeReplay || mode > ModeRecord {
+		return nil, fmt.Errorf("doh: dohtest: not supported mode: %d", mode)
+	}
+
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	r := &Recorder{
+		path:     path,
+		mode:     mode,
+		next:     next,
+		replayed: map[string]int{},
+	}
+
+	if mode == ModeReplay {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &r.fixtures); err != nil {
+			return nil, fmt.Errorf("doh: dohtest: invalid fixtures %s: %w", path, err)
+		}
+	}
+
+	return r, nil
+}
+
+// Fixtures returns the fixtures recorded or loaded in order
+func (r *Recorder) Fixtures() []Fixture {
+	r.Lock()
+	defer r.Unlock()
+
+	return append([]Fixture(nil), r.fixtures...)
+}
+
+// Save writes the fixtures recorded to the file
+func (r *Recorder) Save() error {
+	r.Lock()
+	b, err := json.MarshalIndent(r.fixtures, "", "  ")
+	r.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(r.path, append(b, '\n'), 0o644)
+}
+
+// RoundTrip sends the request in the record mode, or answers it by the fixture of the same method, url and body,
+// the fixtures of the same request are replayed in order and the last one is repeated
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+		req.Body = io.NopCloser(bytes.NewReader(b))
+	}
+
+	if r.mode == ModeRecord {
+		return r.record(req, body)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	key := fmt.Sprintf("%s %s %x", req.Method, req.URL, body)
+	matched := []int{}
+	for k, v := range r.fixtures {
+		if fmt.Sprintf("%s %s %x", v.Method, v.URL, v.Body) == key {
+			matched = append(matched, k)
+		}
+	}
+
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("doh: dohtest: no fixture of %s %s", req.Method, req.URL)
+	}
+
+	n := r.replayed[key]
+	r.replayed[key]++
+
+	return response(req, r.fixtures[matched[min(n, len(matched)-1)]]), nil
+}
+
+// record returns the response of request sent by the round tripper, and records the exchange
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	rsp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	f := Fixture{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		Body:       body,
+		StatusCode: rsp.StatusCode,
+		Proto:      rsp.Proto,
+		Header:     rsp.Header.Clone(),
+		Response:   b,
+	}
+
+	r.Lock()
+	r.fixtures = append(r.fixtures, f)
+	r.Unlock()
+
+	return response(req, f), nil
+}
+
+// response returns the http response of fixture to request
+func response(req *http.Request, f Fixture) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.StatusCode, http.StatusText(f.StatusCode)),
+		StatusCode:    f.StatusCode,
+		Proto:         f.Proto,
+		Header:        f.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(f.Response)),
+		ContentLength: int64(len(f.Response)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dohtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+
+	called := 0
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		called++
+		body := fmt.Sprintf(`{"Status":0,"Answer":[{"name":"%s.","type":1,"TTL":300,"data":"1.1.1.%d"}]}`,
+			r.URL.Query().Get("name"), called)
+		if r.Method == http.MethodPost {
+			b, _ := io.ReadAll(r.Body)
+			body = string(b)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Proto:      "HTTP/2.0",
+			Header:     http.Header{"Content-Type": {"application/dns-json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})
+
+	rec, err := NewRecorder(path, ModeRecord, rt)
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	c := doh.Use(doh.GoogleProvider).SetRoundTripper(rec).SetFormat(dns.FormatJSON)
+	defer c.Close()
+	for i := 0; i < 2; i++ {
+		_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+		assert.Nil(t, err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "https://dns.example/dns-query", strings.NewReader("msg"))
+	assert.Nil(t, err)
+	rsp, err := rec.RoundTrip(req)
+	assert.Nil(t, err)
+	b, err := io.ReadAll(rsp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), "msg")
+
+	assert.Equal(t, called, 3)
+	assert.Equal(t, len(rec.Fixtures()), 3)
+	assert.Nil(t, rec.Save())
+
+	replay, err := NewRecorder(path, ModeReplay, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, replay.Fixtures(), rec.Fixtures())
+
+	r := doh.Use(doh.GoogleProvider).SetRoundTripper(replay).SetFormat(dns.FormatJSON)
+	defer r.Close()
+	for _, v := range []string{"1.1.1.1", "1.1.1.2", "1.1.1.2"} {
+		rsp, err := r.Query(ctx, "likexian.com", dns.TypeA)
+		assert.Nil(t, err)
+		assert.Equal(t, rsp.Answer[0].Data, v)
+		assert.Equal(t, rsp.Metadata.Protocol, "HTTP/2.0")
+	}
+
+	_, err = r.Query(ctx, "example.org", dns.TypeA)
+	assert.NotNil(t, err)
+
+	req, err = http.NewRequest(http.MethodPost, "https://dns.example/dns-query", strings.NewReader("msg"))
+	assert.Nil(t, err)
+	rsp, err = replay.RoundTrip(req)
+	assert.Nil(t, err)
+	b, err = io.ReadAll(rsp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), "msg")
+
+	req, err = http.NewRequest(http.MethodPost, "https://dns.example/dns-query", strings.NewReader("xx"))
+	assert.Nil(t, err)
+	_, err = replay.RoundTrip(req)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no fixture")
+	assert.Equal(t, called, 3)
+}
+
+func TestNewRecorder(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := NewRecorder(filepath.Join(dir, "xx.json"), ModeReplay, nil)
+	assert.NotNil(t, err)
+
+	path := filepath.Join(dir, "invalid.json")
+	assert.Nil(t, os.WriteFile(path, []byte("xx"), 0o644))
+	_, err = NewRecorder(path, ModeReplay, nil)
+	assert.NotNil(t, err)
+
+	_, err = NewRecorder(path, Mode(9), nil)
+	assert.NotNil(t, err)
+
+	r, err := NewRecorder(filepath.Join(dir, "new.json"), ModeRecord, nil)
+	assert.Nil(t, err)
+	assert.True(t, r.next == http.DefaultTransport)
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dohtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/ideatocode/doh-go/server"
+)
+
+// Server is a local DoH server answering by a fake provider, it serves the wire format and the json api on
+// any path, so that the provider implementations and the user code can be tested end to end without network
+type Server struct {
+	*httptest.Server
+	// Provider is the fake provider scripting the answers
+	Provider *Provider
+}
+
+// rerouter is a http round tripper sending the requests to the server whatever the upstream is
+type rerouter struct {
+	target *url.URL
+	next   http.RoundTripper
+}
+
+// NewServer returns a new started local DoH server of provider, a new provider if nil, it must be closed after use
+func NewServer(p *Provider) *Server {
+	if p == nil {
+		p = New("")
+	}
+
+	return &Server{
+		Server:   httptest.NewServer(server.New(p)),
+		Provider: p,
+	}
+}
+
+// NewTLSServer returns a new started local DoH server over tls of provider, a new provider if nil,
+// its certificate is trusted by the Client and RoundTripper of server
+func NewTLSServer(p *Provider) *Server {
+	if p == nil {
+		p = New("")
+	}
+
+	return &Server{
+		Server:   httptest.NewTLSServer(server.New(p)),
+		Provider: p,
+	}
+}
+
+// RoundTripper returns a http round tripper sending all the requests to the server, for example to query it by
+// the built-in providers: doh.Use(doh.GoogleProvider).SetRoundTripper(s.RoundTripper())
+func (s *Server) RoundTripper() http.RoundTripper {
+	target, _ := url.Parse(s.URL)
+
+	return &rerouter{
+		target: target,
+		next:   s.Client().Transport,
+	}
+}
+
+// RoundTrip sends the request to the server, the path and query are kept
+func (r *rerouter) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host, req.Host = r.target.Scheme, r.target.Host, r.target.Host
+
+	return r.next.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections to the server, so that the closed clients do not leak them
+func (r *rerouter) CloseIdleConnections() {
+	if c, ok := r.next.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
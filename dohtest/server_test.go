@@ -0,0 +1,81 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dohtest
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestServer(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	s.Provider.Answer("likexian.com", dns.TypeA, "1.2.3.4")
+	s.Provider.Answer("likexian.com", dns.TypeMX, "10 mx.likexian.com.")
+
+	rsp, err := s.Client().Get(s.URL + "/resolve?name=likexian.com&type=A")
+	assert.Nil(t, err)
+	defer rsp.Body.Close()
+	assert.Equal(t, rsp.Header.Get("Content-Type"), dns.ContentTypeJSON)
+	rr := &dns.Response{}
+	assert.Nil(t, json.NewDecoder(rsp.Body).Decode(rr))
+	assert.Equal(t, rr.Answer[0].Data, "1.2.3.4")
+
+	ctx := context.Background()
+	for _, kind := range []int{doh.GoogleProvider, doh.CloudflareProvider, doh.Quad9Provider} {
+		for _, f := range []dns.Format{dns.FormatJSON, dns.FormatMessage} {
+			c := doh.Use(kind).SetRoundTripper(s.RoundTripper()).SetFormat(f)
+			rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+			assert.Nil(t, err, kind, f)
+			assert.Equal(t, rsp.Answer[0].Data, "1.2.3.4")
+
+			rsp, err = c.Query(ctx, "likexian.com", dns.TypeMX)
+			assert.Nil(t, err, kind, f)
+			assert.Equal(t, rsp.Answer[0].Data, "10 mx.likexian.com.")
+
+			rsp, err = c.Query(ctx, "nx.likexian.com", dns.TypeA)
+			assert.NotNil(t, err)
+			assert.Equal(t, rsp.Status, 3)
+			c.Close()
+		}
+	}
+}
+
+func TestTLSServer(t *testing.T) {
+	p := New("fake")
+	p.Answer("", dns.TypeAAAA, "2001:db8::1")
+
+	s := NewTLSServer(p)
+	defer s.Close()
+	assert.True(t, s.Provider == p)
+
+	c := doh.Use(doh.CloudflareProvider).SetRoundTripper(s.RoundTripper())
+	defer c.Close()
+
+	rsp, err := c.Query(context.Background(), "likexian.com", dns.TypeAAAA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "2001:db8::1")
+	assert.Equal(t, len(p.Queries()), 1)
+}
@@ -0,0 +1,182 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dohtest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// Querier is a client doing DoH query, for example: *doh.DoH or a provider
+type Querier interface {
+	Query(context.Context, dns.Domain, dns.Type) (*dns.Response, error)
+}
+
+// StressOptions is the options of stress
+type StressOptions struct {
+	// Concurrency is the concurrent queries, default 8
+	Concurrency int
+	// Queries is the total queries, default 1000
+	Queries int
+	// Domains is the domains queried in turn, default likexian.com
+	Domains []dns.Domain
+	// Types is the types queried in turn of each domain, default A
+	Types []dns.Type
+	// Timeout is the timeout of each query, default no limit
+	Timeout time.Duration
+}
+
+// StressResult is the result of stress
+type StressResult struct {
+	Queries  int
+	Errors   int
+	Duration time.Duration
+}
+
+// Snapshot is the goroutines and open files of process, for checking the leaks
+type Snapshot struct {
+	Goroutines int
+	// FDs is the open files, -1 if not supported by the system
+	FDs int
+}
+
+// DefaultLeakTimeout is the time waiting for the goroutines and files to be released before reporting leaks
+const DefaultLeakTimeout = 5 * time.Second
+
+// Stress drives q by the concurrent queries until all done or ctx is done, the errors are counted but not
+// returned, since the queries of a fault injected or rate limited client may fail by design
+func Stress(ctx context.Context, q Querier, opts StressOptions) StressResult {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 8
+	}
+	if opts.Queries <= 0 {
+		opts.Queries = 1000
+	}
+	if len(opts.Domains) == 0 {
+		opts.Domains = []dns.Domain{"likexian.com"}
+	}
+	if len(opts.Types) == 0 {
+		opts.Types = []dns.Type{dns.TypeA}
+	}
+
+	var next, done, errs atomic.Int64
+	start := time.Now()
+
+	wg := sync.WaitGroup{}
+	for range opts.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				n := int(next.Add(1)) - 1
+				if n >= opts.Queries {
+					return
+				}
+				d := opts.Domains[n%len(opts.Domains)]
+				t := opts.Types[n/len(opts.Domains)%len(opts.Types)]
+				if err := stressQuery(ctx, q, d, t, opts.Timeout); err != nil {
+					errs.Add(1)
+				}
+				done.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return StressResult{Queries: int(done.Load()), Errors: int(errs.Load()), Duration: time.Since(start)}
+}
+
+// stressQuery do a query of stress with the timeout
+func stressQuery(ctx context.Context, q Querier, d dns.Domain, t dns.Type, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	_, err := q.Query(ctx, d, t)
+
+	return err
+}
+
+// TakeSnapshot returns the snapshot of the goroutines and open files now
+func TakeSnapshot() Snapshot {
+	return Snapshot{Goroutines: runtime.NumGoroutine(), FDs: openFDs()}
+}
+
+// Leaks waits up to timeout for the goroutines and open files to be back to the snapshot, returns an error
+// of the leaks and the goroutine stacks if not
+func (s Snapshot) Leaks(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		now := TakeSnapshot()
+		leaked := now.Goroutines > s.Goroutines || s.FDs >= 0 && now.FDs > s.FDs
+		if !leaked {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("doh: dohtest: leaked %d goroutines and %d files:\n%s",
+				now.Goroutines-s.Goroutines, max(0, now.FDs-s.FDs), stacks())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// NoLeaks fails t if the goroutines or open files are leaked after the test and its cleanups registered after,
+// so that it must be called before creating the client, whose Close is deferred or registered later
+func NoLeaks(t testing.TB) {
+	t.Helper()
+
+	s := TakeSnapshot()
+	t.Cleanup(func() {
+		if err := s.Leaks(DefaultLeakTimeout); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// openFDs returns the open files of process, -1 if not supported by the system
+func openFDs() int {
+	for _, v := range []string{"/proc/self/fd", "/dev/fd"} {
+		if es, err := os.ReadDir(v); err == nil {
+			// the directory read is open while reading
+			return len(es) - 1
+		}
+	}
+
+	return -1
+}
+
+// stacks returns the stacks of goroutines, which are cut at 64KB
+func stacks() string {
+	b := make([]byte, 64<<10)
+	b = b[:runtime.Stack(b, true)]
+
+	return strings.TrimSpace(string(b))
+}
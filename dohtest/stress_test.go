@@ -0,0 +1,97 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package dohtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestStress(t *testing.T) {
+	p := New("")
+	p.Answer("likexian.com", "", "1.2.3.4")
+
+	ctx := context.Background()
+	r := Stress(ctx, p, StressOptions{})
+	assert.Equal(t, r, StressResult{Queries: 1000, Duration: r.Duration})
+	assert.Equal(t, len(p.Queries()), 1000)
+
+	p.Reset()
+	p.Answer("likexian.com", "", "1.2.3.4")
+	r = Stress(ctx, p, StressOptions{Concurrency: 3, Queries: 10, Domains: []dns.Domain{"likexian.com", "nx.example"},
+		Types: []dns.Type{dns.TypeA, dns.TypeAAAA}})
+	assert.Equal(t, r.Queries, 10)
+	assert.Equal(t, r.Errors, 5)
+	assert.Equal(t, len(p.Queries()), 10)
+
+	p.Reset()
+	p.On("", "").Delay(time.Minute)
+	r = Stress(ctx, p, StressOptions{Queries: 4, Timeout: 10 * time.Millisecond})
+	assert.Equal(t, r.Errors, 4)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	r = Stress(cctx, p, StressOptions{})
+	assert.Equal(t, r.Queries, 0)
+}
+
+func TestLeaks(t *testing.T) {
+	s := TakeSnapshot()
+	assert.True(t, s.Goroutines > 0)
+	assert.Nil(t, s.Leaks(0))
+
+	stop := make(chan struct{})
+	go func() {
+		<-stop
+	}()
+	err := s.Leaks(50 * time.Millisecond)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "leaked 1 goroutines")
+	assert.Contains(t, err.Error(), "TestLeaks")
+
+	close(stop)
+	assert.Nil(t, s.Leaks(DefaultLeakTimeout))
+}
+
+func TestNoLeaks(t *testing.T) {
+	NoLeaks(t)
+
+	p := New("fake")
+	p.Answer("likexian.com", "", "1.2.3.4")
+	p.On("slow.example", "").Delay(5 * time.Millisecond)
+
+	srv := NewServer(p)
+	defer srv.Close()
+
+	s := TakeSnapshot()
+	c := doh.Use(doh.CloudflareProvider, doh.GoogleProvider).SetRoundTripper(srv.RoundTripper()).EnableCache(true)
+	r := Stress(context.Background(), c, StressOptions{Concurrency: 16, Queries: 500,
+		Domains: []dns.Domain{"likexian.com", "slow.example", "nx.example"}, Types: []dns.Type{dns.TypeA, dns.TypeMX}})
+	assert.Equal(t, r.Queries, 500)
+	assert.True(t, r.Errors > 0)
+
+	c.Close()
+	assert.Nil(t, s.Leaks(DefaultLeakTimeout))
+}
@@ -0,0 +1,204 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// EmailOptions is the options of CheckEmail
+type EmailOptions struct {
+	// MTASTS is whether to look up the mta-sts record of _mta-sts.<domain>
+	MTASTS bool
+	// TLSRPT is whether to look up the smtp tls reporting record of _smtp._tls.<domain>
+	TLSRPT bool
+}
+
+// EmailReport is the email deliverability records of domain, the records failed are nil with their errors
+type EmailReport struct {
+	Domain dns.Domain
+	// MX is the mail exchangers sorted by preference, a null mx of host . tells the domain accepts no mail
+	MX     []dns.MX
+	SPF    *dns.SPF
+	DMARC  *dns.DMARC
+	MTASTS *dns.MTASTS
+	TLSRPT *dns.TLSRPT
+	// Errs is the errors of records failed to look up or parse, keyed by mx, spf, dmarc, mta-sts and tls-rpt
+	Errs map[string]error
+}
+
+// OK returns whether all the records checked are found and valid
+func (r *EmailReport) OK() bool {
+	return len(r.Errs) == 0
+}
+
+// CheckEmail returns the report of the MX, SPF, DMARC and optionally the MTA-STS and TLS-RPT records of domain,
+// which are looked up in parallel
+func (c *DoH) CheckEmail(ctx context.Context, d dns.Domain, opts EmailOptions) *EmailReport {
+	r := &EmailReport{Domain: d, Errs: map[string]error{}}
+
+	checks := map[string]func() error{
+		"mx": func() (err error) {
+			r.MX, err = c.lookupMX(ctx, d)
+			return
+		},
+		"spf": func() (err error) {
+			r.SPF, err = c.LookupSPF(ctx, d)
+			return
+		},
+		"dmarc": func() (err error) {
+			r.DMARC, err = c.LookupDMARC(ctx, d)
+			return
+		},
+	}
+
+	if opts.MTASTS {
+		checks["mta-sts"] = func() error {
+			txt, err := c.lookupPolicy(ctx, dns.Domain("_mta-sts."+trimDomain(d)), "mta-sts", dns.IsMTASTS)
+			if err == nil {
+				r.MTASTS, err = dns.ParseMTASTS(txt)
+			}
+			return err
+		}
+	}
+
+	if opts.TLSRPT {
+		checks["tls-rpt"] = func() error {
+			txt, err := c.lookupPolicy(ctx, dns.Domain("_smtp._tls."+trimDomain(d)), "tls-rpt", dns.IsTLSRPT)
+			if err == nil {
+				r.TLSRPT, err = dns.ParseTLSRPT(txt)
+			}
+			return err
+		}
+	}
+
+	var mu sync.Mutex
+	wg := sync.WaitGroup{}
+	for k, v := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := v(); err != nil {
+				mu.Lock()
+				r.Errs[k] = err
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return r
+}
+
+// lookupMX returns the mx records of domain sorted by preference
+func (c *DoH) lookupMX(ctx context.Context, d dns.Domain) ([]dns.MX, error) {
+	rsp, err := c.Query(ctx, d, dns.TypeMX)
+	if err != nil {
+		return nil, err
+	}
+
+	mxs := dns.Records[dns.MX](rsp)
+	if len(mxs) == 0 {
+		return nil, fmt.Errorf("doh: no MX record found for %s", d)
+	}
+
+	slices.SortStableFunc(mxs, func(a, b dns.MX) int {
+		return int(a.Pref) - int(b.Pref)
+	})
+
+	return mxs, nil
+}
+
+// LookupDMARC returns the dmarc policy of _dmarc.<domain>, an error is returned if there is none or more than
+// one dmarc record, the fallback to the organizational domain is left to the caller
+func (c *DoH) LookupDMARC(ctx context.Context, d dns.Domain) (*dns.DMARC, error) {
+	txt, err := c.lookupPolicy(ctx, dns.Domain("_dmarc."+trimDomain(d)), "dmarc", dns.IsDMARC)
+	if err != nil {
+		return nil, err
+	}
+
+	return dns.ParseDMARC(txt)
+}
+
+// LookupSPF returns the spf policy of domain, an error is returned if there is none or more than one spf record
+func (c *DoH) LookupSPF(ctx context.Context, d dns.Domain) (*dns.SPF, error) {
+	txt, err := c.lookupPolicy(ctx, dns.Domain(trimDomain(d)), "spf", dns.IsSPF)
+	if err != nil {
+		return nil, err
+	}
+
+	return dns.ParseSPF(txt)
+}
+
+// LookupDKIM returns the dkim key of <selector>._domainkey.<domain>, the first valid record is returned
+// if there are many
+func (c *DoH) LookupDKIM(ctx context.Context, selector string, d dns.Domain) (*dns.DKIM, error) {
+	name := dns.Domain(strings.Trim(selector, ".") + "._domainkey." + trimDomain(d))
+	rsp, err := c.Query(ctx, name, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fmt.Errorf("doh: no dkim record found for %s", name)
+	for _, v := range dns.Records[dns.TXT](rsp) {
+		k, e := dns.ParseDKIM(string(v))
+		if e == nil {
+			return k, nil
+		}
+		err = e
+	}
+
+	return nil, err
+}
+
+// lookupPolicy returns the only txt record of name matched by is
+func (c *DoH) lookupPolicy(ctx context.Context, name dns.Domain, kind string, is func(string) bool) (string, error) {
+	rsp, err := c.Query(ctx, name, dns.TypeTXT)
+	if err != nil {
+		return "", err
+	}
+
+	txts := []string{}
+	for _, v := range dns.Records[dns.TXT](rsp) {
+		if is(string(v)) {
+			txts = append(txts, string(v))
+		}
+	}
+
+	switch len(txts) {
+	case 0:
+		return "", fmt.Errorf("doh: no %s record found for %s", kind, name)
+	case 1:
+		return txts[0], nil
+	default:
+		return "", fmt.Errorf("doh: multiple %s records found for %s", kind, name)
+	}
+}
+
+// trimDomain returns the domain without the surrounding spaces and trailing dot
+func trimDomain(d dns.Domain) string {
+	return strings.TrimSuffix(strings.TrimSpace(string(d)), ".")
+}
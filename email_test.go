@@ -0,0 +1,146 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/dohtest"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestLookupDMARC(t *testing.T) {
+	p := dohtest.New("fake")
+	p.Answer("_dmarc.likexian.com", dns.TypeTXT, `"v=DMARC1; p=reject; " "rua=mailto:d@likexian.com"`, `"other"`)
+	p.Answer("_dmarc.multi.example", dns.TypeTXT, `"v=DMARC1; p=none"`, `"v=DMARC1; p=reject"`)
+	p.Answer("_dmarc.none.example", dns.TypeTXT, `"v=spf1 -all"`)
+
+	c := UseProviders(p)
+	defer c.Close()
+
+	ctx := context.Background()
+	d, err := c.LookupDMARC(ctx, "likexian.com.")
+	assert.Nil(t, err)
+	assert.Equal(t, d.Policy, "reject")
+	assert.Equal(t, d.RUA, []string{"mailto:d@likexian.com"})
+
+	_, err = c.LookupDMARC(ctx, "multi.example")
+	assert.Contains(t, err.Error(), "multiple dmarc records")
+
+	_, err = c.LookupDMARC(ctx, "none.example")
+	assert.Contains(t, err.Error(), "no dmarc record")
+
+	_, err = c.LookupDMARC(ctx, "nx.example")
+	assert.NotNil(t, err)
+}
+
+func TestLookupSPF(t *testing.T) {
+	p := dohtest.New("fake")
+	p.Answer("likexian.com", dns.TypeTXT, `"google-site-verification=x"`, `"v=spf1 include:_spf.example.com -all"`)
+	p.Answer("multi.example", dns.TypeTXT, `"v=spf1 -all"`, `"v=spf1 ~all"`)
+	p.Answer("bad.example", dns.TypeTXT, `"v=spf1 xx"`)
+
+	c := UseProviders(p)
+	defer c.Close()
+
+	ctx := context.Background()
+	s, err := c.LookupSPF(ctx, "likexian.com")
+	assert.Nil(t, err)
+	assert.Equal(t, s.Mechanisms, []dns.SPFMechanism{
+		{Qualifier: "+", Name: "include", Value: "_spf.example.com"}, {Qualifier: "-", Name: "all"}})
+
+	_, err = c.LookupSPF(ctx, "multi.example")
+	assert.Contains(t, err.Error(), "multiple spf records")
+
+	_, err = c.LookupSPF(ctx, "bad.example")
+	assert.Contains(t, err.Error(), "unknown spf mechanism")
+
+	_, err = c.LookupSPF(ctx, "nx.example")
+	assert.NotNil(t, err)
+}
+
+func TestLookupDKIM(t *testing.T) {
+	p := dohtest.New("fake")
+	p.Answer("s1._domainkey.likexian.com", dns.TypeTXT, `"v=DKIM2"`, `"v=DKIM1; k=rsa; p=MIGf" "MA0G"`)
+	p.Answer("bad._domainkey.likexian.com", dns.TypeTXT, `"v=DKIM2; p=x"`)
+	p.On("empty._domainkey.likexian.com", dns.TypeTXT)
+
+	c := UseProviders(p)
+	defer c.Close()
+
+	ctx := context.Background()
+	k, err := c.LookupDKIM(ctx, "s1", "likexian.com")
+	assert.Nil(t, err)
+	assert.Equal(t, k.PublicKey, "MIGfMA0G")
+
+	_, err = c.LookupDKIM(ctx, "bad", "likexian.com")
+	assert.Contains(t, err.Error(), "invalid dkim version")
+
+	_, err = c.LookupDKIM(ctx, "empty", "likexian.com")
+	assert.Contains(t, err.Error(), "no dkim record")
+
+	_, err = c.LookupDKIM(ctx, "nx", "likexian.com")
+	assert.NotNil(t, err)
+}
+
+func TestCheckEmail(t *testing.T) {
+	p := dohtest.New("fake")
+	p.Answer("likexian.com", dns.TypeMX, "20 mx2.likexian.com.", "10 mx1.likexian.com.")
+	p.Answer("likexian.com", dns.TypeTXT, `"v=spf1 mx -all"`)
+	p.Answer("_dmarc.likexian.com", dns.TypeTXT, `"v=DMARC1; p=quarantine"`)
+	p.Answer("_mta-sts.likexian.com", dns.TypeTXT, `"v=STSv1; id=20240101"`)
+	p.Answer("_smtp._tls.likexian.com", dns.TypeTXT, `"v=TLSRPTv1; rua=mailto:tls@likexian.com"`)
+	p.Answer("nomail.example", dns.TypeMX, "0 .")
+	p.Answer("nomail.example", dns.TypeTXT, `"v=spf1 -all"`)
+
+	c := UseProviders(p)
+	defer c.Close()
+
+	ctx := context.Background()
+	r := c.CheckEmail(ctx, "likexian.com", EmailOptions{})
+	assert.True(t, r.OK())
+	assert.Equal(t, r.MX, []dns.MX{{Pref: 10, Host: "mx1.likexian.com."}, {Pref: 20, Host: "mx2.likexian.com."}})
+	assert.Equal(t, r.SPF.Mechanisms[0].Name, "mx")
+	assert.Equal(t, r.DMARC.Policy, "quarantine")
+	assert.True(t, r.MTASTS == nil)
+	assert.True(t, r.TLSRPT == nil)
+
+	r = c.CheckEmail(ctx, "likexian.com", EmailOptions{MTASTS: true, TLSRPT: true})
+	assert.True(t, r.OK())
+	assert.Equal(t, r.MTASTS.ID, "20240101")
+	assert.Equal(t, r.TLSRPT.RUA, []string{"mailto:tls@likexian.com"})
+
+	r = c.CheckEmail(ctx, "nomail.example", EmailOptions{MTASTS: true, TLSRPT: true})
+	assert.False(t, r.OK())
+	assert.Equal(t, r.MX, []dns.MX{{Pref: 0, Host: "."}})
+	assert.Equal(t, r.SPF.Mechanisms, []dns.SPFMechanism{{Qualifier: "-", Name: "all"}})
+	assert.True(t, r.DMARC == nil)
+	assert.Equal(t, len(r.Errs), 3)
+	assert.NotNil(t, r.Errs["dmarc"])
+	assert.NotNil(t, r.Errs["mta-sts"])
+	assert.NotNil(t, r.Errs["tls-rpt"])
+
+	p.On("empty.example", dns.TypeMX)
+	r = c.CheckEmail(ctx, "empty.example", EmailOptions{})
+	assert.Contains(t, r.Errs["mx"].Error(), "no MX record")
+	assert.Equal(t, len(r.Errs), 3)
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"expvar"
+	"sync"
+)
+
+// expvarMu guards creating the expvar maps shared by clients
+var expvarMu sync.Mutex
+
+// PublishExpvar publishes the query counters as an expvar map of name, for example: doh,
+// there are total queries, errors and cache_hits, and the counters of each provider in providers
+func (c *DoH) PublishExpvar(name string) *DoH {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+
+	m, ok := expvar.Get(name).(*expvar.Map)
+	if !ok {
+		m = expvar.NewMap(name)
+	}
+
+	providers, ok := m.Get("providers").(*expvar.Map)
+	if !ok {
+		providers = new(expvar.Map).Init()
+		m.Set("providers", providers)
+	}
+
+	provider := func(name string) *expvar.Map {
+		expvarMu.Lock()
+		defer expvarMu.Unlock()
+		p, ok := providers.Get(name).(*expvar.Map)
+		if !ok {
+			p = new(expvar.Map).Init()
+			providers.Set(name, p)
+		}
+		return p
+	}
+
+	return c.AddHook(func(ctx context.Context, e *Event) {
+		p := provider(e.Provider)
+		if e.Cached {
+			m.Add("cache_hits", 1)
+			p.Add("cache_hits", 1)
+			return
+		}
+
+		m.Add("queries", 1)
+		p.Add("queries", 1)
+		if class := e.ErrorClass(); class != "" {
+			m.Add("errors", 1)
+			p.Add("errors", 1)
+			p.Add("errors_"+class, 1)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	c := Use(GoogleProvider).PublishExpvar("doh_test")
+	defer c.Close()
+
+	ctx := context.Background()
+	c.emit(ctx, &Event{Provider: "google", Response: &dns.Response{}})
+	c.emit(ctx, &Event{Provider: "google", Err: errors.New("x"), Response: &dns.Response{Status: 2}})
+	c.emit(ctx, &Event{Provider: "quad9", Err: context.Canceled})
+	c.emit(ctx, &Event{Provider: "google", Cached: true})
+
+	m := expvar.Get("doh_test").(*expvar.Map)
+	assert.Equal(t, m.Get("queries").String(), "3")
+	assert.Equal(t, m.Get("errors").String(), "2")
+	assert.Equal(t, m.Get("cache_hits").String(), "1")
+
+	p := m.Get("providers").(*expvar.Map)
+	assert.Equal(t, p.Get("google").(*expvar.Map).Get("queries").String(), "2")
+	assert.Equal(t, p.Get("google").(*expvar.Map).Get("errors_rcode").String(), "1")
+	assert.Equal(t, p.Get("quad9").(*expvar.Map).Get("errors_canceled").String(), "1")
+
+	c2 := Use(GoogleProvider).PublishExpvar("doh_test")
+	defer c2.Close()
+	c2.emit(ctx, &Event{Provider: "google", Response: &dns.Response{}})
+	assert.Equal(t, m.Get("queries").String(), "4")
+}
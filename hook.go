@@ -0,0 +1,142 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/transport"
+)
+
+// Event is a query event of a provider or the cache
+type Event struct {
+	Provider string
+	Domain   dns.Domain
+	Type     dns.Type
+	ECS      dns.ECS
+	Response *dns.Response
+	Err      error
+	Cached   bool
+	Start    time.Time
+	Duration time.Duration
+}
+
+// Hook is called with the event after each provider query and cache hit, it must be fast and concurrency safe
+type Hook func(context.Context, *Event)
+
+// StartHook is called with the event before each provider query, the returned context is used for the query
+// and passed to the hooks, it must be fast and concurrency safe
+type StartHook func(context.Context, *Event) context.Context
+
+// Query error classes
+const (
+	ErrorClassCanceled = "canceled"
+	ErrorClassTimeout  = "timeout"
+	ErrorClassNetwork  = "network"
+	ErrorClassStatus   = "status"
+	ErrorClassRcode    = "rcode"
+	ErrorClassOther    = "other"
+)
+
+// AddHook add a hook called with the query events
+func (c *DoH) AddHook(h Hook) *DoH {
+	c.Lock()
+	c.hooks = append(c.hooks, h)
+	c.Unlock()
+
+	return c
+}
+
+// AddStartHook add a hook called before each provider query, for example to start a tracing span
+func (c *DoH) AddStartHook(h StartHook) *DoH {
+	c.Lock()
+	c.starts = append(c.starts, h)
+	c.Unlock()
+
+	return c
+}
+
+// start calls the start hooks with event, returns the context for the query
+func (c *DoH) start(ctx context.Context, e *Event) context.Context {
+	c.RLock()
+	starts := c.starts
+	c.RUnlock()
+
+	for _, h := range starts {
+		ctx = h(ctx, e)
+	}
+
+	return ctx
+}
+
+// emit calls the hooks with event
+func (c *DoH) emit(ctx context.Context, e *Event) {
+	c.RLock()
+	hooks := c.hooks
+	c.RUnlock()
+
+	for _, h := range hooks {
+		h(ctx, e)
+	}
+}
+
+// Rcode returns the dns response code of event, -1 if no response
+func (e *Event) Rcode() int {
+	if e.Response == nil {
+		return -1
+	}
+
+	return e.Response.Status
+}
+
+// ErrorClass returns the class of event error, empty if no error
+func (e *Event) ErrorClass() string {
+	if e.Err == nil {
+		return ""
+	}
+
+	if e.Response != nil && e.Response.Status != 0 {
+		return ErrorClassRcode
+	}
+
+	var se *transport.StatusError
+	if errors.As(e.Err, &se) {
+		return ErrorClassStatus
+	}
+
+	if errors.Is(e.Err, context.Canceled) {
+		return ErrorClassCanceled
+	}
+
+	var ne net.Error
+	if errors.Is(e.Err, context.DeadlineExceeded) || errors.As(e.Err, &ne) && ne.Timeout() {
+		return ErrorClassTimeout
+	}
+
+	if ne != nil {
+		return ErrorClassNetwork
+	}
+
+	return ErrorClassOther
+}
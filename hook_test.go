@@ -0,0 +1,139 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/transport"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestAddHook(t *testing.T) {
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		body := `{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`
+		if r.URL.Query().Get("name") == "nx.likexian.com" {
+			body = `{"Status":3}`
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})
+
+	var mu sync.Mutex
+	events := []*Event{}
+	c := Use(GoogleProvider).SetRoundTripper(rt).EnableCache(true).AddHook(func(ctx context.Context, e *Event) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	})
+	defer c.Close()
+
+	ctx := context.Background()
+	_, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	_, err = c.Query(ctx, "nx.likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	// the failed query is retried with all providers after the fastest one
+	assert.Equal(t, len(events), 4)
+
+	assert.Equal(t, events[0].Provider, "google")
+	assert.Equal(t, events[0].Domain, dns.Domain("likexian.com"))
+	assert.Equal(t, events[0].Type, dns.TypeA)
+	assert.False(t, events[0].Cached)
+	assert.Equal(t, events[0].Rcode(), 0)
+	assert.Equal(t, events[0].ErrorClass(), "")
+
+	assert.Equal(t, events[1].Provider, "google")
+	assert.True(t, events[1].Cached)
+
+	assert.Equal(t, events[2].Rcode(), 3)
+	assert.Equal(t, events[2].ErrorClass(), ErrorClassRcode)
+	assert.Equal(t, events[3].ErrorClass(), ErrorClassRcode)
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		in  *Event
+		out string
+	}{
+		{&Event{}, ""},
+		{&Event{Err: context.Canceled}, ErrorClassCanceled},
+		{&Event{Err: fmt.Errorf("x: %w", context.DeadlineExceeded)}, ErrorClassTimeout},
+		{&Event{Err: &net.DNSError{IsTimeout: true}}, ErrorClassTimeout},
+		{&Event{Err: &net.OpError{Op: "dial", Err: errors.New("refused")}}, ErrorClassNetwork},
+		{&Event{Err: fmt.Errorf("doh: google: %w", &transport.StatusError{StatusCode: 500})}, ErrorClassStatus},
+		{&Event{Err: errors.New("x"), Response: &dns.Response{Status: 2}}, ErrorClassRcode},
+		{&Event{Err: errors.New("x")}, ErrorClassOther},
+	}
+
+	for _, v := range tests {
+		assert.Equal(t, v.in.ErrorClass(), v.out)
+	}
+
+	assert.Equal(t, (&Event{}).Rcode(), -1)
+}
+
+func TestAddStartHook(t *testing.T) {
+	type key struct{}
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		assert.Equal(t, r.Context().Value(key{}), "likexian")
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"Status":0}`)),
+			Request:    r,
+		}, nil
+	})
+
+	started, done := 0, 0
+	c := Use(GoogleProvider).SetRoundTripper(rt).AddStartHook(func(ctx context.Context, e *Event) context.Context {
+		started++
+		assert.Equal(t, e.Provider, "google")
+		assert.True(t, e.Response == nil)
+		return context.WithValue(ctx, key{}, "likexian")
+	}).AddHook(func(ctx context.Context, e *Event) {
+		done++
+		assert.Equal(t, ctx.Value(key{}), "likexian")
+		assert.Equal(t, e.Rcode(), 0)
+	})
+	defer c.Close()
+
+	_, err := c.Query(context.Background(), "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, started, 1)
+	assert.Equal(t, done, 1)
+}
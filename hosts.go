@@ -0,0 +1,308 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// DefaultHostsFile is the hosts file of system
+const DefaultHostsFile = "/etc/hosts"
+
+// DefaultHostsTTL is the default ttl of hosts answers
+const DefaultHostsTTL = time.Minute
+
+// Hosts is a static table of names and addresses answered without querying as the hosts file,
+// the A and AAAA queries of names and the PTR queries of addresses are answered, and the others are queried
+type Hosts struct {
+	ttl   time.Duration
+	names map[string][]netip.Addr
+	addrs map[netip.Addr][]string
+	sync.RWMutex
+}
+
+// NewHosts returns a new empty hosts table
+func NewHosts() *Hosts {
+	return &Hosts{
+		ttl:   DefaultHostsTTL,
+		names: map[string][]netip.Addr{},
+		addrs: map[netip.Addr][]string{},
+	}
+}
+
+// LoadHosts returns the hosts table of hosts file, for example: DefaultHostsFile
+func LoadHosts(path string) (*Hosts, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("doh: hosts: %w", err)
+	}
+
+	defer fd.Close()
+
+	return ReadHosts(fd)
+}
+
+// ReadHosts returns the hosts table of hosts file lines, a line is an address followed by its names
+func ReadHosts(r io.Reader) (*Hosts, error) {
+	h := NewHosts()
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		addr, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			continue
+		}
+
+		for _, v := range fields[1:] {
+			if isBlockName(v) {
+				h.add(normalizeZone(v), addr.WithZone("").Unmap())
+			}
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("doh: hosts: %w", err)
+	}
+
+	return h, nil
+}
+
+// SetHosts set the hosts table answering names before the rewrite rules and providers, nil to remove it
+func (c *DoH) SetHosts(h *Hosts) *DoH {
+	c.Lock()
+	c.hosts = h
+	c.Unlock()
+
+	return c
+}
+
+// SetTTL set the ttl of answers, DefaultHostsTTL if 0
+func (h *Hosts) SetTTL(ttl time.Duration) *Hosts {
+	if ttl <= 0 {
+		ttl = DefaultHostsTTL
+	}
+
+	h.Lock()
+	h.ttl = ttl
+	h.Unlock()
+
+	return h
+}
+
+// Set set the addresses of name replacing the existing ones, no addresses to remove the name
+func (h *Hosts) Set(name string, addrs ...string) error {
+	if !isBlockName(name) {
+		return fmt.Errorf("doh: hosts: invalid name: %s", name)
+	}
+
+	ips := []netip.Addr{}
+	for _, v := range addrs {
+		addr, err := netip.ParseAddr(strings.TrimSpace(v))
+		if err != nil {
+			return fmt.Errorf("doh: hosts: invalid address: %s", v)
+		}
+		ips = append(ips, addr.WithZone("").Unmap())
+	}
+
+	name = normalizeZone(name)
+	h.remove(name)
+	for _, v := range ips {
+		h.add(name, v)
+	}
+
+	return nil
+}
+
+// Merge add the entries of other hosts tables
+func (h *Hosts) Merge(others ...*Hosts) *Hosts {
+	for _, o := range others {
+		if o == nil || o == h {
+			continue
+		}
+		o.RLock()
+		for name, addrs := range o.names {
+			for _, v := range addrs {
+				h.add(name, v)
+			}
+		}
+		o.RUnlock()
+	}
+
+	return h
+}
+
+// Len returns the number of names
+func (h *Hosts) Len() int {
+	h.RLock()
+	defer h.RUnlock()
+
+	return len(h.names)
+}
+
+// Lookup returns the addresses of name, nil if it is not in the table
+func (h *Hosts) Lookup(name string) []netip.Addr {
+	h.RLock()
+	defer h.RUnlock()
+
+	return h.names[normalizeZone(name)]
+}
+
+// add add the address of name if not exists
+func (h *Hosts) add(name string, addr netip.Addr) {
+	h.Lock()
+	defer h.Unlock()
+
+	for _, v := range h.names[name] {
+		if v == addr {
+			return
+		}
+	}
+
+	h.names[name] = append(h.names[name], addr)
+	h.addrs[addr] = append(h.addrs[addr], name)
+}
+
+// remove remove the name and its addresses
+func (h *Hosts) remove(name string) {
+	h.Lock()
+	defer h.Unlock()
+
+	for _, v := range h.names[name] {
+		names := []string{}
+		for _, n := range h.addrs[v] {
+			if n != name {
+				names = append(names, n)
+			}
+		}
+		if len(names) == 0 {
+			delete(h.addrs, v)
+		} else {
+			h.addrs[v] = names
+		}
+	}
+
+	delete(h.names, name)
+}
+
+// response returns the answers of query, nil if the query is not answered by the table
+func (h *Hosts) response(d dns.Domain, t dns.Type) *dns.Response {
+	h.RLock()
+	defer h.RUnlock()
+
+	tt := strings.ToUpper(strings.TrimSpace(string(t)))
+	var rsp *dns.Response
+	var answers []dns.Answer
+	ttl := int(h.ttl / time.Second)
+
+	switch tt {
+	case string(dns.TypeA), string(dns.TypeAAAA):
+		addrs, ok := h.names[normalizeZone(string(d))]
+		if !ok {
+			return nil
+		}
+		rsp = blocked(d, t)
+		for _, v := range addrs {
+			if v.Is4() == (tt == string(dns.TypeA)) {
+				code := 1
+				if v.Is6() {
+					code = 28
+				}
+				answers = append(answers, dns.Answer{Name: rsp.Question[0].Name, Type: code, TTL: ttl, Data: v.String()})
+			}
+		}
+	case string(dns.TypePTR):
+		addr, ok := reverseAddr(string(d))
+		if !ok {
+			return nil
+		}
+		names, ok := h.addrs[addr]
+		if !ok {
+			return nil
+		}
+		rsp = blocked(d, t)
+		for _, v := range names {
+			answers = append(answers, dns.Answer{Name: rsp.Question[0].Name, Type: 12, TTL: ttl, Data: v + "."})
+		}
+	default:
+		return nil
+	}
+
+	rsp.Status = 0
+	rsp.Provider = "hosts"
+	if answers != nil {
+		rsp.Answer = answers
+	}
+
+	return rsp
+}
+
+// reverseAddr returns the address of reverse name, for example: 4.3.2.1.in-addr.arpa
+func reverseAddr(name string) (netip.Addr, bool) {
+	name = normalizeZone(name)
+
+	if s, ok := strings.CutSuffix(name, ".in-addr.arpa"); ok {
+		ss := strings.Split(s, ".")
+		if len(ss) != 4 {
+			return netip.Addr{}, false
+		}
+		addr, err := netip.ParseAddr(ss[3] + "." + ss[2] + "." + ss[1] + "." + ss[0])
+		return addr, err == nil
+	}
+
+	if s, ok := strings.CutSuffix(name, ".ip6.arpa"); ok {
+		ss := strings.Split(s, ".")
+		if len(ss) != 32 {
+			return netip.Addr{}, false
+		}
+		b := strings.Builder{}
+		for i := 31; i >= 0; i-- {
+			if len(ss[i]) != 1 {
+				return netip.Addr{}, false
+			}
+			b.WriteString(ss[i])
+			if i%4 == 0 && i > 0 {
+				b.WriteString(":")
+			}
+		}
+		addr, err := netip.ParseAddr(b.String())
+		return addr, err == nil && addr.Is6()
+	}
+
+	return netip.Addr{}, false
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+const testHosts = `# hosts file
+127.0.0.1	localhost
+::1		localhost ip6-localhost
+192.168.1.2	NAS.home nas # the nas
+192.168.1.2	nas.home
+fe80::1%lo0	link.home
+xx		bad.home
+10.0.0.1
+10.0.0.2	in%valid
+`
+
+func TestReadHosts(t *testing.T) {
+	h, err := ReadHosts(strings.NewReader(testHosts))
+	assert.Nil(t, err)
+	assert.Equal(t, h.Len(), 5)
+	assert.Equal(t, h.Lookup("localhost"), []netip.Addr{netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("::1")})
+	assert.Equal(t, h.Lookup("nas.home."), []netip.Addr{netip.MustParseAddr("192.168.1.2")})
+	assert.Equal(t, h.Lookup("link.home"), []netip.Addr{netip.MustParseAddr("fe80::1")})
+	assert.True(t, h.Lookup("bad.home") == nil)
+
+	path := filepath.Join(t.TempDir(), "hosts")
+	assert.Nil(t, os.WriteFile(path, []byte(testHosts), 0644))
+	h, err = LoadHosts(path)
+	assert.Nil(t, err)
+	assert.Equal(t, h.Len(), 5)
+
+	_, err = LoadHosts(path + ".xx")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, h.Set("nas.home", "10.0.0.2", "::ffff:10.0.0.3"))
+	assert.Equal(t, h.Lookup("nas.home"), []netip.Addr{netip.MustParseAddr("10.0.0.2"), netip.MustParseAddr("10.0.0.3")})
+	assert.Equal(t, h.addrs[netip.MustParseAddr("192.168.1.2")], []string{"nas"})
+
+	assert.Nil(t, h.Set("nas.home"))
+	assert.True(t, h.Lookup("nas.home") == nil)
+	assert.NotNil(t, h.Set("x y", "10.0.0.1"))
+	assert.NotNil(t, h.Set("x.home", "xx"))
+
+	o := NewHosts()
+	assert.Nil(t, o.Set("pin.home", "10.0.0.9"))
+	h.Merge(o, nil, h)
+	assert.Equal(t, h.Lookup("pin.home"), []netip.Addr{netip.MustParseAddr("10.0.0.9")})
+}
+
+func TestSetHosts(t *testing.T) {
+	rt, hosts := hostRecorder()
+	c := Use(GoogleProvider).SetRoundTripper(rt)
+	defer c.Close()
+	assert.Nil(t, c.AddRewrite("nas.home", 0, "192.168.1.9"))
+
+	h, err := ReadHosts(strings.NewReader(testHosts))
+	assert.Nil(t, err)
+	c.SetHosts(h.SetTTL(time.Hour))
+
+	ctx := context.Background()
+	rsp, err := c.Query(ctx, "NAS.home.", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Provider, "hosts")
+	assert.Equal(t, rsp.Answer, []dns.Answer{{Name: "nas.home.", Type: 1, TTL: 3600, Data: "192.168.1.2"}})
+
+	rsp, err = c.Query(ctx, "localhost", dns.TypeAAAA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer, []dns.Answer{{Name: "localhost.", Type: 28, TTL: 3600, Data: "::1"}})
+
+	rsp, err = c.Query(ctx, "nas.home", dns.TypeAAAA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Status, 0)
+	assert.Equal(t, len(rsp.Answer), 0)
+
+	rsp, err = c.Query(ctx, "2.1.168.192.in-addr.arpa", dns.TypePTR)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer, []dns.Answer{
+		{Name: "2.1.168.192.in-addr.arpa.", Type: 12, TTL: 3600, Data: "nas.home."},
+		{Name: "2.1.168.192.in-addr.arpa.", Type: 12, TTL: 3600, Data: "nas."},
+	})
+
+	rsp, err = c.Query(ctx, "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa", dns.TypePTR)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "localhost.")
+	assert.Equal(t, len(hosts()), 0)
+
+	_, err = c.Query(ctx, "localhost", dns.TypeMX)
+	assert.Nil(t, err)
+	_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	_, err = c.Query(ctx, "3.1.168.192.in-addr.arpa", dns.TypePTR)
+	assert.Nil(t, err)
+	assert.Equal(t, len(hosts()), 3)
+
+	c.SetHosts(nil)
+	rsp, err = c.Query(ctx, "nas.home", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Provider, "rewrite")
+}
+
+func TestReverseAddr(t *testing.T) {
+	tests := map[string]string{
+		"4.3.2.1.in-addr.arpa.": "1.2.3.4",
+		"b.a.9.8.7.6.5.0.4.0.0.0.3.0.0.0.2.0.0.0.1.0.0.0.0.0.0.0.1.2.3.4.IP6.ARPA": "4321:0:1:2:3:4:567:89ab",
+		"3.2.1.in-addr.arpa":           "",
+		"x.3.2.1.in-addr.arpa":         "",
+		"1.0.ip6.arpa":                 "",
+		"likexian.com":                 "",
+		"256.3.2.1.in-addr.arpa":       "",
+		"4.3.2.1.in-addr.arpa.example": "",
+	}
+
+	for k, v := range tests {
+		addr, ok := reverseAddr(k)
+		if v == "" {
+			assert.False(t, ok, k)
+		} else {
+			assert.True(t, ok, k)
+			assert.Equal(t, addr, netip.MustParseAddr(v), k)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// MaxHTTPSAlias is the max alias mode records followed by LookupHTTPS
+const MaxHTTPSAlias = 8
+
+// HTTPSEndpoint is a connection endpoint of the HTTPS records of a host, in the form a dialer consumes
+type HTTPSEndpoint struct {
+	// Host is the origin host, which is the tls server name
+	Host string
+	// Target is the name of the endpoint
+	Target string
+	// Addrs is the host:port addresses to dial, of the ip hints or the target resolved if there is no hint
+	Addrs []string
+	// ALPN is the protocols in preference for tls.Config.NextProtos, nil if not hinted
+	ALPN []string
+	// ECH is the encrypted client hello config list, nil if not supported
+	ECH []byte
+}
+
+// TLSConfig returns a clone of config with the server name, the alpn and the ech of endpoint, nil for a new one
+func (e HTTPSEndpoint) TLSConfig(config *tls.Config) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	}
+
+	config = config.Clone()
+	config.ServerName = e.Host
+	if len(e.ALPN) > 0 {
+		config.NextProtos = slices.Clone(e.ALPN)
+	}
+	if len(e.ECH) > 0 {
+		config.EncryptedClientHelloConfigList = slices.Clone(e.ECH)
+	}
+
+	return config
+}
+
+// LookupHTTPS returns the connection endpoints of the HTTPS records of addr, which is a host or host:port of
+// default 443, the records of other ports are at _port._https.host as RFC 9460, the alias mode records are followed,
+// and the service mode ones are in priority order, the ones of unsupported mandatory parameters are skipped
+func (c *DoH) LookupHTTPS(ctx context.Context, addr string) ([]HTTPSEndpoint, error) {
+	host, port := addr, "443"
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		host, port = h, p
+	}
+	host = strings.TrimSuffix(host, ".")
+
+	name := host
+	if port != "443" {
+		name = "_" + port + "._https." + host
+	}
+
+	aliased := false
+	for range MaxHTTPSAlias + 1 {
+		rs, err := Lookup[dns.HTTPS](ctx, c, dns.Domain(name))
+		if err != nil {
+			if !aliased {
+				return nil, err
+			}
+			// the alias target without records is dialed by its addresses
+			e := HTTPSEndpoint{Host: host, Target: dns.Canonical(name)}
+			e.Addrs, err = c.httpsAddrs(ctx, e.Target, nil, port)
+			if err != nil {
+				return nil, err
+			}
+			return []HTTPSEndpoint{e}, nil
+		}
+
+		alias := slices.IndexFunc(rs, dns.HTTPS.Alias)
+		if alias < 0 {
+			return c.httpsEndpoints(ctx, host, name, port, rs)
+		}
+
+		target := strings.TrimSuffix(rs[alias].Target, ".")
+		if target == "" {
+			return nil, fmt.Errorf("doh: service is not available at %s", name)
+		}
+		name, aliased = target, true
+	}
+
+	return nil, fmt.Errorf("doh: too many https aliases of %s", addr)
+}
+
+// httpsEndpoints returns the endpoints of the service mode records of name in priority order
+func (c *DoH) httpsEndpoints(ctx context.Context, host, name, port string, rs []dns.HTTPS) ([]HTTPSEndpoint, error) {
+	rs = slices.DeleteFunc(slices.Clone(rs), func(v dns.HTTPS) bool {
+		return !v.Supported()
+	})
+	slices.SortStableFunc(rs, func(a, b dns.HTTPS) int {
+		return int(a.Priority) - int(b.Priority)
+	})
+
+	es := []HTTPSEndpoint{}
+	var err error
+	for _, v := range rs {
+		target := v.Target
+		if strings.TrimSuffix(target, ".") == "" {
+			target = name
+		}
+		e := HTTPSEndpoint{Host: host, Target: dns.Canonical(target), ALPN: httpsALPN(v)}
+		if len(v.ECH) > 0 {
+			e.ECH = v.ECH
+		}
+
+		p := port
+		if v.Port > 0 {
+			p = strconv.Itoa(int(v.Port))
+		}
+
+		var ee error
+		e.Addrs, ee = c.httpsAddrs(ctx, e.Target, append(slices.Clone(v.IPv6Hint), v.IPv4Hint...), p)
+		if ee != nil {
+			err = ee
+			continue
+		}
+		es = append(es, e)
+	}
+
+	if len(es) == 0 {
+		if err == nil {
+			err = fmt.Errorf("doh: no supported https record found for %s", name)
+		}
+		return nil, err
+	}
+
+	return es, nil
+}
+
+// httpsAddrs returns the host:port addresses of the ip hints, or of the target resolved if there is no hint,
+// the ipv6 and ipv4 addresses are interleaved
+func (c *DoH) httpsAddrs(ctx context.Context, target string, hints []net.IP, port string) ([]string, error) {
+	ips := hints
+	if len(ips) == 0 {
+		var err error
+		if ips, err = c.LookupIP(ctx, target); err != nil {
+			return nil, err
+		}
+	}
+
+	addrs := []string{}
+	for _, v := range interleaveIPs(ips) {
+		addrs = append(addrs, net.JoinHostPort(v.String(), port))
+	}
+
+	return addrs, nil
+}
+
+// httpsALPN returns the alpn of record in preference, the default http/1.1 is appended unless no-default-alpn
+func httpsALPN(h dns.HTTPS) []string {
+	alpn := slices.Clone(h.ALPN)
+	if !h.NoDefaultALPN && !slices.Contains(alpn, "http/1.1") {
+		alpn = append(alpn, "http/1.1")
+	}
+
+	return alpn
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/dohtest"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestLookupHTTPS(t *testing.T) {
+	p := dohtest.New("fake")
+	p.Answer("likexian.com", dns.TypeHTTPS, "2 . alpn=h2 port=8443",
+		"1 . alpn=h3,h2 ipv4hint=1.1.1.1 ipv6hint=2001:db8::1 ech=AAEC",
+		"3 . mandatory=key65000 key65000=x")
+	p.Answer("likexian.com", dns.TypeA, "1.1.1.2")
+	p.On("likexian.com", dns.TypeAAAA)
+	p.Answer("www.likexian.com", dns.TypeHTTPS, "0 cdn.likexian.com.")
+	p.Answer("cdn.likexian.com", dns.TypeHTTPS, `\# 31 0001037376630363646e086c696b657869616e03636f6d0000010003026833`)
+	p.Answer("svc.cdn.likexian.com", dns.TypeA, "2.2.2.2")
+	p.On("svc.cdn.likexian.com", dns.TypeAAAA)
+	p.Answer("_8443._https.likexian.com", dns.TypeHTTPS, "1 svc.cdn.likexian.com. no-default-alpn alpn=h2")
+	p.Answer("old.likexian.com", dns.TypeHTTPS, "0 plain.likexian.com.")
+	p.Answer("plain.likexian.com", dns.TypeA, "3.3.3.3")
+	p.On("plain.likexian.com", dns.TypeAAAA)
+	p.Answer("none.likexian.com", dns.TypeHTTPS, "0 .")
+	p.Answer("loop.likexian.com", dns.TypeHTTPS, "0 loop.likexian.com.")
+
+	c := UseProviders(p)
+	defer c.Close()
+
+	ctx := context.Background()
+	es, err := c.LookupHTTPS(ctx, "likexian.com")
+	assert.Nil(t, err)
+	assert.Equal(t, es, []HTTPSEndpoint{
+		{Host: "likexian.com", Target: "likexian.com.", Addrs: []string{"[2001:db8::1]:443", "1.1.1.1:443"},
+			ALPN: []string{"h3", "h2", "http/1.1"}, ECH: []byte{0, 1, 2}},
+		{Host: "likexian.com", Target: "likexian.com.", Addrs: []string{"1.1.1.2:8443"},
+			ALPN: []string{"h2", "http/1.1"}},
+	})
+
+	es, err = c.LookupHTTPS(ctx, "www.likexian.com:443")
+	assert.Nil(t, err)
+	assert.Equal(t, es, []HTTPSEndpoint{{Host: "www.likexian.com", Target: "svc.cdn.likexian.com.",
+		Addrs: []string{"2.2.2.2:443"}, ALPN: []string{"h3", "http/1.1"}}})
+
+	es, err = c.LookupHTTPS(ctx, "likexian.com:8443")
+	assert.Nil(t, err)
+	assert.Equal(t, es[0].Addrs, []string{"2.2.2.2:8443"})
+	assert.Equal(t, es[0].ALPN, []string{"h2"})
+
+	es, err = c.LookupHTTPS(ctx, "old.likexian.com")
+	assert.Nil(t, err)
+	assert.Equal(t, es, []HTTPSEndpoint{{Host: "old.likexian.com", Target: "plain.likexian.com.",
+		Addrs: []string{"3.3.3.3:443"}}})
+
+	_, err = c.LookupHTTPS(ctx, "none.likexian.com")
+	assert.Contains(t, err.Error(), "service is not available")
+
+	_, err = c.LookupHTTPS(ctx, "loop.likexian.com")
+	assert.Contains(t, err.Error(), "too many https aliases")
+
+	_, err = c.LookupHTTPS(ctx, "nx.likexian.com")
+	assert.NotNil(t, err)
+}
+
+func TestHTTPSEndpointTLSConfig(t *testing.T) {
+	e := HTTPSEndpoint{Host: "likexian.com", ALPN: []string{"h2", "http/1.1"}, ECH: []byte{0, 1, 2}}
+
+	base := &tls.Config{MinVersion: tls.VersionTLS13, NextProtos: []string{"http/1.1"}}
+	config := e.TLSConfig(base)
+	assert.Equal(t, config.ServerName, "likexian.com")
+	assert.Equal(t, config.NextProtos, []string{"h2", "http/1.1"})
+	assert.Equal(t, config.EncryptedClientHelloConfigList, []byte{0, 1, 2})
+	assert.Equal(t, config.MinVersion, uint16(tls.VersionTLS13))
+	assert.Equal(t, base.NextProtos, []string{"http/1.1"})
+	assert.Equal(t, base.ServerName, "")
+
+	config = HTTPSEndpoint{Host: "likexian.com"}.TLSConfig(nil)
+	assert.Equal(t, config.ServerName, "likexian.com")
+	assert.Equal(t, len(config.NextProtos), 0)
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// Identity is the resolver instance answering the queries of a provider, the fields not probed are empty
+type Identity struct {
+	Provider string
+	// ID is the server identity of id.server or hostname.bind in the CHAOS class, for example the anycast site
+	ID string
+	// Site is the anycast site of the provider trace, for example the IATA code of the cloudflare colo
+	Site string
+	// Resolver is the egress address of resolver, as seen by the authoritative servers of the test names
+	Resolver string
+	// Trace is the key value pairs of the provider trace endpoint, nil if not supported
+	Trace map[string]string
+	// Errs is the errors of the failed probes by name
+	Errs map[string]error
+}
+
+// tracer is the provider with a trace endpoint reporting the site answering, for example cloudflare
+type tracer interface {
+	Trace(ctx context.Context) (map[string]string, error)
+}
+
+// identityNames is the CHAOS class TXT names of the server identity, in the order of preference
+var identityNames = []dns.Domain{"id.server", "hostname.bind"}
+
+// resolverNames is the test names answering the egress address of resolver, in the order of preference,
+// google answers the TXT of the address and the edns0-client-subnet, akamai answers the A of the address
+var resolverNames = []struct {
+	name  dns.Domain
+	qtype dns.Type
+}{
+	{"o-o.myaddr.l.google.com", dns.TypeTXT},
+	{"whoami.akamai.net", dns.TypeA},
+}
+
+// Identify probes every provider directly with the debug queries, bypassing the cache and middlewares, and returns
+// the anycast site and resolver instance answering, in the order of providers
+func (c *DoH) Identify(ctx context.Context) []Identity {
+	ps, _ := c.list()
+
+	ids := make([]Identity, len(ps))
+	wg := sync.WaitGroup{}
+	for k, p := range ps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids[k] = identify(ctx, p)
+		}()
+	}
+	wg.Wait()
+
+	return ids
+}
+
+// identify returns the identity of provider, the probes of each kind stop at the first succeeded
+func identify(ctx context.Context, p Provider) Identity {
+	id := Identity{Provider: p.String(), Errs: map[string]error{}}
+
+	if p.Capabilities().SupportsFormat(dns.FormatMessage) {
+		f := dns.FlagsOf(ctx)
+		f.Chaos = true
+		for _, v := range identityNames {
+			txt, err := probeTXT(dns.WithFlags(ctx, f), p, v)
+			if err == nil {
+				id.ID = txt
+				break
+			}
+			id.Errs[string(v)] = err
+		}
+	} else {
+		id.Errs[string(identityNames[0])] = fmt.Errorf("doh: %s: chaos class is not supported", p)
+	}
+
+	for _, v := range resolverNames {
+		addr, err := probeAddr(ctx, p, v.name, v.qtype)
+		if err == nil {
+			id.Resolver = addr
+			break
+		}
+		id.Errs[string(v.name)] = err
+	}
+
+	if t, ok := p.(tracer); ok {
+		trace, err := t.Trace(ctx)
+		if err != nil {
+			id.Errs["trace"] = err
+		} else {
+			id.Trace, id.Site = trace, trace["colo"]
+		}
+	}
+
+	return id
+}
+
+// probeTXT returns the first nonempty TXT of name
+func probeTXT(ctx context.Context, p Provider, name dns.Domain) (string, error) {
+	rsp, err := p.Query(ctx, name, dns.TypeTXT)
+	if err != nil {
+		return "", err
+	}
+
+	for _, v := range dns.Records[dns.TXT](rsp) {
+		if txt := strings.TrimSpace(string(v)); txt != "" {
+			return txt, nil
+		}
+	}
+
+	return "", fmt.Errorf("doh: no identity found for %s", name)
+}
+
+// probeAddr returns the first address answered of name, in the TXT or A records
+func probeAddr(ctx context.Context, p Provider, name dns.Domain, t dns.Type) (string, error) {
+	rsp, err := p.Query(ctx, name, t)
+	if err != nil {
+		return "", err
+	}
+
+	for v := range rsp.Answers(t) {
+		data := strings.Trim(strings.TrimSpace(v.Data), `"`)
+		if addr, err := netip.ParseAddr(data); err == nil {
+			return addr.String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("doh: no resolver address found for %s", name)
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/dohtest"
+	"github.com/likexian/gokit/assert"
+)
+
+// traceProvider is a fake provider with a trace endpoint
+type traceProvider struct {
+	*dohtest.Provider
+	trace map[string]string
+	err   error
+}
+
+func (p *traceProvider) Trace(ctx context.Context) (map[string]string, error) {
+	return p.trace, p.err
+}
+
+func TestIdentify(t *testing.T) {
+	wire := dns.Capabilities{Formats: []dns.Format{dns.FormatMessage}}
+
+	p1 := dohtest.New("one").SetCapabilities(wire)
+	p1.On("id.server", dns.TypeTXT).Error(errors.New("refused"))
+	p1.Answer("hostname.bind", dns.TypeTXT, `"res100.sjc.rrdns.pch.net"`)
+	p1.Answer("o-o.myaddr.l.google.com", dns.TypeTXT, `"edns0-client-subnet 1.2.3.0/24"`, `"172.217.34.1"`)
+
+	p2 := &traceProvider{Provider: dohtest.New("two").SetCapabilities(wire), trace: map[string]string{"colo": "SJC"}}
+	p2.Answer("id.server", dns.TypeTXT, `"SJC"`)
+	p2.Answer("whoami.akamai.net", dns.TypeA, "162.158.1.1")
+
+	p3 := &traceProvider{Provider: dohtest.New("three"), err: errors.New("down")}
+
+	c := UseProviders(p1, p2, p3)
+	defer c.Close()
+
+	ids := c.Identify(context.Background())
+	assert.Equal(t, len(ids), 3)
+
+	assert.Equal(t, ids[0].Provider, "one")
+	assert.Equal(t, ids[0].ID, "res100.sjc.rrdns.pch.net")
+	assert.Equal(t, ids[0].Resolver, "172.217.34.1")
+	assert.Equal(t, ids[0].Site, "")
+	assert.True(t, ids[0].Trace == nil)
+	assert.NotNil(t, ids[0].Errs["id.server"])
+	assert.Nil(t, ids[0].Errs["o-o.myaddr.l.google.com"])
+
+	assert.Equal(t, ids[1].ID, "SJC")
+	assert.Equal(t, ids[1].Site, "SJC")
+	assert.Equal(t, ids[1].Resolver, "162.158.1.1")
+	assert.NotNil(t, ids[1].Errs["o-o.myaddr.l.google.com"])
+	assert.Nil(t, ids[1].Errs["whoami.akamai.net"])
+
+	assert.Equal(t, ids[2].ID, "")
+	assert.Equal(t, ids[2].Resolver, "")
+	assert.Contains(t, ids[2].Errs["id.server"].Error(), "chaos class is not supported")
+	assert.NotNil(t, ids[2].Errs["whoami.akamai.net"])
+	assert.Equal(t, ids[2].Errs["trace"].Error(), "down")
+
+	for _, v := range p2.Queries() {
+		assert.Equal(t, v.Flags.Chaos, v.Type == dns.TypeTXT && v.Domain == "id.server")
+	}
+	for _, v := range p3.Queries() {
+		assert.False(t, v.Flags.Chaos)
+	}
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// ErrOverloaded is returned if the queries to providers are queued over the limit, and the query would not be
+// answered before its context deadline
+var ErrOverloaded = errors.New("doh: overloaded")
+
+// limiter limits the concurrent upstream queries, the waiting queries are admitted by priority
+type limiter struct {
+	max     int
+	running int
+	waiters [3]list.List
+	hold    time.Duration
+	sync.Mutex
+}
+
+// SetMaxConcurrency set the max concurrent upstream queries, 0 for no limit, cache hits and local answers
+// are not limited, the waiting queries are admitted by the priority of dns.WithPriority and then in order,
+// so that the low priority work yields to the interactive lookups under contention, and the queries that
+// would miss their context deadline in the queue fail fast with ErrOverloaded
+func (c *DoH) SetMaxConcurrency(n int) *DoH {
+	c.limiter.setMax(n)
+	return c
+}
+
+// setMax set the max concurrent queries, and admits the waiting queries if it is raised
+func (l *limiter) setMax(n int) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.max = max(0, n)
+	for l.max == 0 || l.running < l.max {
+		if !l.wake() {
+			return
+		}
+		l.running++
+	}
+}
+
+// acquire waits for a slot of query until ctx is done, it must be released by release after query,
+// ErrOverloaded is returned without waiting if the slot is unlikely to be given in time
+func (l *limiter) acquire(ctx context.Context, p dns.Priority) error {
+	l.Lock()
+	if (l.max == 0 || l.running < l.max) && l.waiting() == 0 {
+		l.running++
+		l.Unlock()
+		return nil
+	}
+
+	if l.shed(ctx, p) {
+		l.Unlock()
+		return ErrOverloaded
+	}
+
+	ready := make(chan struct{})
+	q := &l.waiters[dns.PriorityHigh-p]
+	e := q.PushBack(ready)
+	l.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		l.Lock()
+		select {
+		case <-ready:
+			// the slot is given while canceling, pass it on
+			l.Unlock()
+			l.release()
+		default:
+			q.Remove(e)
+			l.Unlock()
+		}
+		return ctx.Err()
+	}
+}
+
+// shed returns whether a query of priority p could not be answered before the ctx deadline if it waits,
+// the wait is estimated by the queries ahead and the average time of the queries, the lock must be held
+func (l *limiter) shed(ctx context.Context, p dns.Priority) bool {
+	deadline, ok := ctx.Deadline()
+	if !ok || l.hold == 0 || l.max == 0 {
+		return false
+	}
+
+	ahead := 0
+	for k := 0; k <= int(dns.PriorityHigh-p); k++ {
+		ahead += l.waiters[k].Len()
+	}
+
+	wait := time.Duration(ahead+1) * l.hold / time.Duration(l.max)
+
+	return time.Until(deadline) < wait+l.hold
+}
+
+// observe updates the average time of the queries holding a slot with d
+func (l *limiter) observe(d time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.hold == 0 {
+		l.hold = d
+	} else {
+		l.hold += (d - l.hold) / 8
+	}
+}
+
+// release gives the slot to the next waiting query of the highest priority
+func (l *limiter) release() {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.max > 0 && l.running > l.max {
+		l.running--
+		return
+	}
+
+	if !l.wake() {
+		l.running--
+	}
+}
+
+// wake admits the first waiting query of the highest priority, returns false if there is none,
+// the lock must be held
+func (l *limiter) wake() bool {
+	for k := range l.waiters {
+		if e := l.waiters[k].Front(); e != nil {
+			close(l.waiters[k].Remove(e).(chan struct{}))
+			return true
+		}
+	}
+
+	return false
+}
+
+// waiting returns the number of waiting queries, the lock must be held
+func (l *limiter) waiting() int {
+	n := 0
+	for k := range l.waiters {
+		n += l.waiters[k].Len()
+	}
+
+	return n
+}
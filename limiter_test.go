@@ -0,0 +1,186 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+// waitQueued waits for n queries waiting for the limiter
+func waitQueued(l *limiter, n int) {
+	for {
+		l.Lock()
+		m := l.waiting()
+		l.Unlock()
+		if m >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := &limiter{}
+
+	assert.Nil(t, l.acquire(ctx, dns.PriorityLow))
+	assert.Nil(t, l.acquire(ctx, dns.PriorityLow))
+	l.release()
+	l.release()
+	assert.Equal(t, l.running, 0)
+
+	l.setMax(1)
+	assert.Nil(t, l.acquire(ctx, dns.PriorityNormal))
+
+	var mu sync.Mutex
+	order := []dns.Priority{}
+	wg := sync.WaitGroup{}
+	for k, p := range []dns.Priority{dns.PriorityLow, dns.PriorityNormal, dns.PriorityHigh, dns.PriorityLow} {
+		wg.Add(1)
+		go func(p dns.Priority) {
+			defer wg.Done()
+			assert.Nil(t, l.acquire(ctx, p))
+			mu.Lock()
+			order = append(order, p)
+			mu.Unlock()
+			l.release()
+		}(p)
+		waitQueued(l, k+1)
+	}
+
+	l.release()
+	wg.Wait()
+	assert.Equal(t, order, []dns.Priority{dns.PriorityHigh, dns.PriorityNormal, dns.PriorityLow, dns.PriorityLow})
+	assert.Equal(t, l.running, 0)
+
+	assert.Nil(t, l.acquire(ctx, dns.PriorityNormal))
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, l.acquire(cctx, dns.PriorityHigh), context.DeadlineExceeded)
+	assert.Equal(t, l.waiting(), 0)
+
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			done <- l.acquire(ctx, dns.PriorityLow)
+		}()
+	}
+	waitQueued(l, 2)
+	l.setMax(3)
+	assert.Nil(t, <-done)
+	assert.Nil(t, <-done)
+	assert.Equal(t, l.running, 3)
+
+	l.setMax(1)
+	for i := 0; i < 3; i++ {
+		l.release()
+	}
+	assert.Equal(t, l.running, 0)
+
+	l.setMax(-1)
+	assert.Equal(t, l.max, 0)
+}
+
+func TestSetMaxConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+	rt, _ := hostRecorder()
+	c := Use(GoogleProvider).SetRoundTripper(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+		return rt.RoundTrip(r)
+	})).SetMaxConcurrency(2)
+	defer c.Close()
+
+	questions := []Question{}
+	for i := 0; i < 10; i++ {
+		questions = append(questions, Question{Name: dns.Domain(fmt.Sprintf("%d.likexian.com", i)), Type: dns.TypeA})
+	}
+
+	ctx := dns.WithPriority(context.Background(), dns.PriorityLow)
+	for _, v := range c.QueryAll(ctx, questions, 5) {
+		assert.Nil(t, v.Err)
+	}
+	assert.Equal(t, peak, 2)
+
+	assert.NotNil(t, (&Config{MaxConcurrency: -1}).Validate())
+	assert.Nil(t, c.Reload(&Config{Providers: []string{"google"}, MaxConcurrency: 4}))
+	assert.Equal(t, c.limiter.max, 4)
+}
+
+func TestLimiterShed(t *testing.T) {
+	ctx := context.Background()
+	l := &limiter{}
+	l.setMax(1)
+	assert.Nil(t, l.acquire(ctx, dns.PriorityNormal))
+
+	l.observe(100 * time.Millisecond)
+	l.observe(200 * time.Millisecond)
+	assert.Equal(t, l.hold, 112500*time.Microsecond)
+
+	cctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, l.acquire(cctx, dns.PriorityHigh), ErrOverloaded)
+	assert.Equal(t, l.waiting(), 0)
+
+	done := make(chan error)
+	go func() {
+		cctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		done <- l.acquire(cctx, dns.PriorityNormal)
+	}()
+	waitQueued(l, 1)
+	l.release()
+	assert.Nil(t, <-done)
+
+	go func() {
+		done <- l.acquire(ctx, dns.PriorityLow)
+	}()
+	waitQueued(l, 1)
+
+	// the high priority query is admitted before the queued low one, so only the low one misses the deadline
+	cctx, cancel = context.WithTimeout(ctx, 300*time.Millisecond)
+	defer cancel()
+	l.Lock()
+	assert.False(t, l.shed(cctx, dns.PriorityHigh))
+	assert.True(t, l.shed(cctx, dns.PriorityLow))
+	l.Unlock()
+
+	l.release()
+	assert.Nil(t, <-done)
+	l.release()
+	assert.Equal(t, l.running, 0)
+}
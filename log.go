@@ -0,0 +1,80 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// SetLogger set the structured logger of query, failover and cache events, nil to disable,
+// successful queries and cache activity are logged at debug level, failures at warn level
+func (c *DoH) SetLogger(l *slog.Logger) *DoH {
+	c.Lock()
+	c.logger = l
+	c.Unlock()
+
+	return c
+}
+
+// log writes a record with attrs if the logger is set and enabled at level
+func (c *DoH) log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	c.RLock()
+	l := c.logger
+	c.RUnlock()
+
+	if l == nil || !l.Enabled(ctx, level) {
+		return
+	}
+
+	if id := dns.CorrelationID(ctx); id != "" {
+		attrs = append(attrs, slog.String("correlation_id", id))
+	}
+
+	l.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// logEvent writes a record of provider query event
+func (c *DoH) logEvent(ctx context.Context, e *Event) {
+	attrs := []slog.Attr{
+		slog.String("provider", e.Provider),
+		slog.String("name", string(e.Domain)),
+		slog.String("type", string(e.Type)),
+		slog.Int("rcode", e.Rcode()),
+		slog.Duration("duration", e.Duration),
+	}
+
+	if e.Err == nil {
+		c.log(ctx, slog.LevelDebug, "doh: query", attrs...)
+		return
+	}
+
+	attrs = append(attrs, slog.String("class", e.ErrorClass()), slog.String("error", e.Err.Error()))
+
+	// the slower providers are canceled once the fastest one answers
+	if e.ErrorClass() == ErrorClassCanceled {
+		c.log(ctx, slog.LevelDebug, "doh: query canceled", attrs...)
+		return
+	}
+
+	c.log(ctx, slog.LevelWarn, "doh: query failed", attrs...)
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestSetLogger(t *testing.T) {
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		body := `{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`
+		if r.URL.Query().Get("name") == "nx.likexian.com" {
+			body = `{"Status":3}`
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})
+
+	buf := &bytes.Buffer{}
+	l := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	c := Use(GoogleProvider).SetRoundTripper(rt).EnableCache(true).SetLogger(l)
+	defer c.Close()
+
+	ctx := context.Background()
+	_, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	_, err = c.Query(ctx, "nx.likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+
+	s := buf.String()
+	assert.Contains(t, s, `level=DEBUG msg="doh: cache miss" name=likexian.com type=A`)
+	assert.Contains(t, s, `level=DEBUG msg="doh: query" provider=google name=likexian.com type=A rcode=0`)
+	assert.Contains(t, s, `level=DEBUG msg="doh: cache set" name=likexian.com type=A ttl=300`)
+	assert.Contains(t, s, `level=DEBUG msg="doh: cache hit" provider=google name=likexian.com type=A`)
+	assert.Contains(t, s, `level=WARN msg="doh: query failed" provider=google name=nx.likexian.com type=A rcode=3`)
+	assert.Contains(t, s, `class=rcode`)
+	assert.Contains(t, s, `level=INFO msg="doh: fastest provider failed, failover to all providers" provider=google`)
+	assert.Contains(t, s, `level=ERROR msg="doh: all query failed" name=nx.likexian.com type=A providers=1`)
+
+	buf.Reset()
+	c.SetLogger(slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, buf.String(), "")
+
+	c.SetLogger(nil)
+	_, err = c.Query(ctx, "nx.likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// DefaultResolvConf is the resolv.conf file of system
+const DefaultResolvConf = "/etc/resolv.conf"
+
+// DefaultNdots is the default ndots of resolv.conf
+const DefaultNdots = 1
+
+// maxNdots is the max ndots of resolv.conf
+const maxNdots = 15
+
+// search is the search list of lookup
+type search struct {
+	ndots   int
+	domains []string
+}
+
+// SetSearch set the search domains and ndots of Lookup as resolv.conf, the name with fewer dots than ndots
+// is tried with the search domains first, the others are tried as is first, and the name with trailing dot
+// is never searched, no domains to disable it
+func (c *DoH) SetSearch(ndots int, domains ...string) *DoH {
+	if ndots < 0 {
+		ndots = 0
+	} else if ndots > maxNdots {
+		ndots = maxNdots
+	}
+
+	ds := []string{}
+	for _, v := range domains {
+		if v = normalizeZone(v); v != "" {
+			ds = append(ds, v)
+		}
+	}
+
+	c.Lock()
+	c.search = search{ndots: ndots, domains: ds}
+	c.Unlock()
+
+	return c
+}
+
+// LoadResolvConf returns the ndots and search domains of resolv.conf file, for example: DefaultResolvConf
+func LoadResolvConf(path string) (int, []string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return 0, nil, fmt.Errorf("doh: resolv.conf: %w", err)
+	}
+
+	defer fd.Close()
+
+	return ReadResolvConf(fd)
+}
+
+// ReadResolvConf returns the ndots and search domains of resolv.conf lines, the last domain or search line wins
+func ReadResolvConf(r io.Reader) (int, []string, error) {
+	ndots, domains := DefaultNdots, []string{}
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "domain":
+			domains = []string{fields[1]}
+		case "search":
+			domains = fields[1:]
+		case "options":
+			for _, v := range fields[1:] {
+				if n, ok := strings.CutPrefix(v, "ndots:"); ok {
+					if i, err := strconv.Atoi(n); err == nil && i >= 0 {
+						ndots = min(i, maxNdots)
+					}
+				}
+			}
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return 0, nil, fmt.Errorf("doh: resolv.conf: %w", err)
+	}
+
+	return ndots, domains, nil
+}
+
+// Lookup do query with the search domains, the first name with answers wins
+func (c *DoH) Lookup(ctx context.Context, d dns.Domain, t dns.Type) (*dns.Response, error) {
+	return c.ECSLookup(ctx, d, t, "")
+}
+
+// ECSLookup do query with the search domains and the edns0-client-subnet option, the names are tried in order
+// until one has answers, and the response of the last name is returned if none has
+func (c *DoH) ECSLookup(ctx context.Context, d dns.Domain, t dns.Type, s dns.ECS) (*dns.Response, error) {
+	var rsp *dns.Response
+	var err error
+
+	for _, v := range c.searchNames(string(d)) {
+		rsp, err = c.ECSQuery(ctx, dns.Domain(v), t, s)
+		if rsp == nil || ctx.Err() != nil {
+			return rsp, err
+		}
+		if rsp.Status == 0 && len(rsp.Answer) > 0 {
+			return rsp, err
+		}
+		if rsp.Status != 0 && rsp.Status != 3 {
+			return rsp, err
+		}
+	}
+
+	return rsp, err
+}
+
+// LookupIP returns the IPv4 and IPv6 addresses of host with the search domains, it implements transport.Resolver
+func (c *DoH) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	return lookupIP(ctx, host, c.Lookup)
+}
+
+// Lookup returns the records of type T of name with the search domains, for example: []dns.MX of MX records,
+// and []net.IP of both the A and AAAA records, an error is returned if there is none
+func Lookup[T dns.Record](ctx context.Context, c *DoH, d dns.Domain) ([]T, error) {
+	rs := []T{}
+
+	var err error
+	for _, t := range dns.RecordTypes[T]() {
+		rsp, e := c.Lookup(ctx, d, t)
+		if e != nil {
+			err = e
+			continue
+		}
+		rs = append(rs, dns.Records[T](rsp)...)
+	}
+
+	if len(rs) == 0 {
+		if err == nil {
+			err = fmt.Errorf("doh: no %s record found for %s", dns.RecordTypes[T]()[0], d)
+		}
+		return nil, err
+	}
+
+	return rs, nil
+}
+
+// searchNames returns the names of lookup in order
+func (c *DoH) searchNames(name string) []string {
+	name = strings.TrimSpace(name)
+	if strings.HasSuffix(name, ".") || name == "" {
+		return []string{name}
+	}
+
+	c.RLock()
+	ss := c.search
+	c.RUnlock()
+
+	if len(ss.domains) == 0 {
+		return []string{name}
+	}
+
+	names := []string{}
+	for _, v := range ss.domains {
+		names = append(names, name+"."+v+".")
+	}
+
+	if strings.Count(name, ".") >= ss.ndots {
+		return append([]string{name + "."}, names...)
+	}
+
+	return append(names, name+".")
+}
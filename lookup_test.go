@@ -0,0 +1,169 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestReadResolvConf(t *testing.T) {
+	ndots, domains, err := ReadResolvConf(strings.NewReader(`# resolv.conf
+nameserver 10.96.0.10
+domain example.com
+search default.svc.cluster.local svc.cluster.local cluster.local ; comment
+options ndots:5 timeout:2
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, ndots, 5)
+	assert.Equal(t, domains, []string{"default.svc.cluster.local", "svc.cluster.local", "cluster.local"})
+
+	ndots, domains, err = ReadResolvConf(strings.NewReader("search a.example\ndomain b.example\noptions ndots:99\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, ndots, 15)
+	assert.Equal(t, domains, []string{"b.example"})
+
+	ndots, domains, err = ReadResolvConf(strings.NewReader("options ndots:x\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, ndots, DefaultNdots)
+	assert.Equal(t, len(domains), 0)
+
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	assert.Nil(t, os.WriteFile(path, []byte("search corp.example\n"), 0644))
+	ndots, domains, err = LoadResolvConf(path)
+	assert.Nil(t, err)
+	assert.Equal(t, ndots, 1)
+	assert.Equal(t, domains, []string{"corp.example"})
+
+	_, _, err = LoadResolvConf(path + ".xx")
+	assert.NotNil(t, err)
+}
+
+func TestSearchNames(t *testing.T) {
+	c := Use(GoogleProvider)
+	defer c.Close()
+	assert.Equal(t, c.searchNames("nas"), []string{"nas"})
+
+	c.SetSearch(2, "Corp.Example.", "", "example.com")
+	assert.Equal(t, c.searchNames("nas"), []string{"nas.corp.example.", "nas.example.com.", "nas."})
+	assert.Equal(t, c.searchNames("nas.lab"), []string{"nas.lab.corp.example.", "nas.lab.example.com.", "nas.lab."})
+	assert.Equal(t, c.searchNames("www.likexian.com"),
+		[]string{"www.likexian.com.", "www.likexian.com.corp.example.", "www.likexian.com.example.com."})
+	assert.Equal(t, c.searchNames("nas."), []string{"nas."})
+
+	c.SetSearch(-1, "corp.example")
+	assert.Equal(t, c.searchNames("nas"), []string{"nas.", "nas.corp.example."})
+
+	c.SetSearch(99)
+	assert.Equal(t, c.search.ndots, 15)
+	assert.Equal(t, c.searchNames("nas"), []string{"nas"})
+}
+
+func TestLookup(t *testing.T) {
+	rt, hosts := hostRecorder()
+	c := Use(GoogleProvider).SetRoundTripper(rt).SetBlocklist("x.corp.example").SetSearch(1, "corp.example", "example.com")
+	defer c.Close()
+
+	assert.Nil(t, c.AddRewrite("nas.corp.example", 0, "10.0.0.1"))
+	assert.Nil(t, c.AddRewrite("v6.corp.example", 0, "fd00::1"))
+
+	ctx := context.Background()
+	rsp, err := c.Lookup(ctx, "nas", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer, []dns.Answer{{Name: "nas.corp.example.", Type: 1, TTL: 300, Data: "10.0.0.1"}})
+	assert.Equal(t, len(hosts()), 0)
+
+	rsp, err = c.Lookup(ctx, "x", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+	assert.Equal(t, hosts(), []string{"dns.google.com"})
+
+	rsp, err = c.Lookup(ctx, "x.corp.example.", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Equal(t, rsp.Status, 3)
+	assert.Equal(t, len(hosts()), 0)
+
+	ips, err := c.LookupIP(ctx, "v6")
+	assert.Nil(t, err)
+	assert.Equal(t, len(ips), 2)
+	assert.Equal(t, ips[1], net.ParseIP("fd00::1"))
+
+	c.SetSearch(1)
+	_, err = c.LookupIP(ctx, "x.corp.example")
+	assert.NotNil(t, err)
+}
+
+// recordProvider is a provider answering the queries with the answers of type
+type recordProvider map[dns.Type][]dns.Answer
+
+func (p recordProvider) String() string {
+	return "record"
+}
+
+func (p recordProvider) Query(ctx context.Context, d dns.Domain, t dns.Type) (*dns.Response, error) {
+	return p.ECSQuery(ctx, d, t, "")
+}
+
+func (p recordProvider) ECSQuery(ctx context.Context, d dns.Domain, t dns.Type, s dns.ECS) (*dns.Response, error) {
+	return &dns.Response{Provider: p.String(), Answer: p[t]}, nil
+}
+
+func (p recordProvider) SetProvides(int) error {
+	return nil
+}
+
+func (p recordProvider) Capabilities() dns.Capabilities {
+	return dns.Capabilities{}
+}
+
+func TestLookupRecords(t *testing.T) {
+	c := UseProviders(recordProvider{
+		dns.TypeA:    {{Type: 5, Data: "cdn.example."}, {Type: 1, Data: "1.1.1.1"}},
+		dns.TypeAAAA: {{Type: 28, Data: "2001::1"}},
+		dns.TypeMX:   {{Type: 15, Data: "10 mx.example."}, {Type: 15, Data: "x"}},
+		dns.TypeTXT:  {{Type: 16, Data: `"v=spf1" " -all"`}},
+	})
+	defer c.Close()
+
+	ctx := context.Background()
+	ips, err := Lookup[net.IP](ctx, c, "likexian.com")
+	assert.Nil(t, err)
+	assert.Equal(t, ips, []net.IP{net.ParseIP("1.1.1.1"), net.ParseIP("2001::1")})
+
+	mxs, err := Lookup[dns.MX](ctx, c, "likexian.com")
+	assert.Nil(t, err)
+	assert.Equal(t, mxs, []dns.MX{{Pref: 10, Host: "mx.example."}})
+
+	txts, err := Lookup[dns.TXT](ctx, c, "likexian.com")
+	assert.Nil(t, err)
+	assert.Equal(t, txts, []dns.TXT{"v=spf1 -all"})
+
+	cnames, err := Lookup[dns.CNAME](ctx, c, "likexian.com")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no CNAME record found")
+	assert.Equal(t, len(cnames), 0)
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+
+	"github.com/ideatocode/doh-go/cache"
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// SetProviderEnabled set whether the provider is queried, the disabled providers are skipped
+// until enabled again, it is kept across Reload
+func (c *DoH) SetProviderEnabled(provider int, enabled bool) *DoH {
+	c.Lock()
+	if enabled {
+		delete(c.disabled, provider)
+	} else {
+		c.disabled[provider] = true
+	}
+	c.Unlock()
+
+	return c
+}
+
+// ProviderEnabled returns whether the provider is queried
+func (c *DoH) ProviderEnabled(provider int) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return !c.disabled[provider]
+}
+
+// FlushCache removes the cached responses of names without the ecs and flags, no names to remove all
+func (c *DoH) FlushCache(names ...dns.Domain) *DoH {
+	c.RLock()
+	rc := c.cache
+	c.RUnlock()
+
+	if rc == nil {
+		return c
+	}
+
+	if len(names) == 0 {
+		_ = rc.Flush(context.Background())
+		return c
+	}
+
+	for _, d := range names {
+		for _, t := range cache.FlushTypes {
+			_ = rc.Delete(context.Background(), cache.Key(d, t, "", dns.Flags{}))
+		}
+	}
+
+	return c
+}
+
+// enabled returns the enabled providers of providers
+func (c *DoH) enabled(providers []Provider, kinds []int) []Provider {
+	c.RLock()
+	defer c.RUnlock()
+
+	if len(c.disabled) == 0 {
+		return providers
+	}
+
+	ps := []Provider{}
+	for k, p := range providers {
+		if !c.disabled[kinds[k]] {
+			ps = append(ps, p)
+		}
+	}
+
+	return ps
+}
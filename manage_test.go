@@ -0,0 +1,117 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ideatocode/doh-go/cache"
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestSetProviderEnabled(t *testing.T) {
+	rt, hosts := hostRecorder()
+	c := Use(GoogleProvider, CloudflareProvider).SetRoundTripper(rt).SetFormat(dns.FormatJSON).
+		AddRoute("corp.example", CloudflareProvider)
+	defer c.Close()
+
+	assert.True(t, c.ProviderEnabled(GoogleProvider))
+	c.SetProviderEnabled(CloudflareProvider, false)
+	assert.False(t, c.ProviderEnabled(CloudflareProvider))
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, err := c.Query(ctx, "likexian.com", dns.TypeA)
+		assert.Nil(t, err)
+		assert.Equal(t, hosts(), []string{"dns.google.com"})
+	}
+
+	_, err := c.Query(ctx, "www.corp.example", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, hosts(), []string{"dns.google.com"})
+
+	c.SetProviderEnabled(GoogleProvider, false)
+	_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Equal(t, len(hosts()), 0)
+
+	c.SetProviderEnabled(CloudflareProvider, true)
+	_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, hosts(), []string{"cloudflare-dns.com"})
+}
+
+func TestFlushCache(t *testing.T) {
+	rt, hosts := hostRecorder()
+	c := Use(GoogleProvider).SetRoundTripper(rt)
+	defer c.Close()
+
+	c.FlushCache()
+	c.EnableCache(true)
+
+	ctx := context.Background()
+	query := func(d dns.Domain) {
+		_, err := c.Query(ctx, d, dns.TypeA)
+		assert.Nil(t, err)
+	}
+
+	query("likexian.com")
+	query("example.com")
+	query("likexian.com")
+	assert.Equal(t, len(hosts()), 2)
+
+	c.FlushCache("likexian.com")
+	query("likexian.com")
+	query("example.com")
+	assert.Equal(t, len(hosts()), 1)
+
+	c.FlushCache()
+	query("likexian.com")
+	query("example.com")
+	assert.Equal(t, len(hosts()), 2)
+}
+
+func TestSetCache(t *testing.T) {
+	rt, hosts := hostRecorder()
+	m := cache.NewMemory()
+	c := Use(GoogleProvider).SetRoundTripper(rt).SetCache(m)
+	defer c.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, err := c.Query(ctx, "likexian.com", dns.TypeA)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, len(hosts()), 1)
+	assert.Equal(t, m.Len(), 1)
+
+	c.FlushCache("likexian.com")
+	assert.Equal(t, m.Len(), 0)
+
+	c.SetCache(nil)
+	for i := 0; i < 2; i++ {
+		_, err := c.Query(ctx, "likexian.com", dns.TypeA)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, len(hosts()), 2)
+	assert.Equal(t, m.Len(), 0)
+}
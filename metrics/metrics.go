@@ -0,0 +1,136 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Collector is a prometheus collector of DoH query events
+type Collector struct {
+	queries   *prometheus.CounterVec
+	errors    *prometheus.CounterVec
+	rcodes    *prometheus.CounterVec
+	latency   *prometheus.HistogramVec
+	cacheHits *prometheus.CounterVec
+}
+
+// DefaultBuckets is the default latency histogram buckets in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+// Version returns package version
+func Version() string {
+	return "0.1.0"
+}
+
+// Author returns package author
+func Author() string {
+	return "[Li Kexian](https://www.likexian.com/)"
+}
+
+// License returns package license
+func License() string {
+	return "Licensed under the Apache License 2.0"
+}
+
+// New returns a new collector with metrics namespace, for example: doh
+func New(namespace string) *Collector {
+	return &Collector{
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "queries_total",
+			Help:      "Total number of queries sent to provider.",
+		}, []string{"provider"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "Total number of failed queries by provider and error class.",
+		}, []string{"provider", "class"}),
+		rcodes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "responses_total",
+			Help:      "Total number of responses by provider and dns response code.",
+		}, []string{"provider", "rcode"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "query_duration_seconds",
+			Help:      "Query latency of provider in seconds.",
+			Buckets:   DefaultBuckets,
+		}, []string{"provider"}),
+		cacheHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_hits_total",
+			Help:      "Total number of queries answered from cache.",
+		}, []string{"provider"}),
+	}
+}
+
+// Hook records the query event, add it to client by doh.AddHook
+func (c *Collector) Hook(ctx context.Context, e *doh.Event) {
+	if e.Cached {
+		c.cacheHits.WithLabelValues(e.Provider).Inc()
+		return
+	}
+
+	c.queries.WithLabelValues(e.Provider).Inc()
+	c.latency.WithLabelValues(e.Provider).Observe(e.Duration.Seconds())
+
+	if e.Response != nil {
+		c.rcodes.WithLabelValues(e.Provider, strconv.Itoa(e.Response.Status)).Inc()
+	}
+
+	if class := e.ErrorClass(); class != "" {
+		c.errors.WithLabelValues(e.Provider, class).Inc()
+	}
+}
+
+// Describe sends the metrics descriptors to channel
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.queries.Describe(ch)
+	c.errors.Describe(ch)
+	c.rcodes.Describe(ch)
+	c.latency.Describe(ch)
+	c.cacheHits.Describe(ch)
+}
+
+// Collect sends the metrics to channel
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.queries.Collect(ch)
+	c.errors.Collect(ch)
+	c.rcodes.Collect(ch)
+	c.latency.Collect(ch)
+	c.cacheHits.Collect(ch)
+}
+
+// Handler returns the http handler of prometheus metrics, the collector is exposed with the go runtime and process
+// metrics in a new registry
+func (c *Collector) Handler() http.Handler {
+	r := prometheus.NewRegistry()
+	r.MustRegister(c, collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+	return promhttp.HandlerFor(r, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestVersion(t *testing.T) {
+	assert.Contains(t, Version(), ".")
+	assert.Contains(t, Author(), "likexian")
+	assert.Contains(t, License(), "Apache License")
+}
+
+func TestHook(t *testing.T) {
+	c := New("doh")
+	r := prometheus.NewRegistry()
+	assert.Nil(t, r.Register(c))
+
+	ctx := context.Background()
+	c.Hook(ctx, &doh.Event{Provider: "google", Response: &dns.Response{Status: 0}, Duration: 20 * time.Millisecond})
+	c.Hook(ctx, &doh.Event{Provider: "google", Response: &dns.Response{Status: 3}, Err: errors.New("x")})
+	c.Hook(ctx, &doh.Event{Provider: "quad9", Err: context.Canceled})
+	c.Hook(ctx, &doh.Event{Provider: "google", Cached: true})
+
+	assert.Equal(t, testutil.ToFloat64(c.queries.WithLabelValues("google")), float64(2))
+	assert.Equal(t, testutil.ToFloat64(c.queries.WithLabelValues("quad9")), float64(1))
+	assert.Equal(t, testutil.ToFloat64(c.rcodes.WithLabelValues("google", "0")), float64(1))
+	assert.Equal(t, testutil.ToFloat64(c.rcodes.WithLabelValues("google", "3")), float64(1))
+	assert.Equal(t, testutil.ToFloat64(c.errors.WithLabelValues("google", doh.ErrorClassRcode)), float64(1))
+	assert.Equal(t, testutil.ToFloat64(c.errors.WithLabelValues("quad9", doh.ErrorClassCanceled)), float64(1))
+	assert.Equal(t, testutil.ToFloat64(c.cacheHits.WithLabelValues("google")), float64(1))
+	assert.Equal(t, testutil.CollectAndCount(c, "doh_query_duration_seconds"), 2)
+
+	mfs, err := r.Gather()
+	assert.Nil(t, err)
+	assert.Equal(t, len(mfs), 5)
+}
+
+func TestHandler(t *testing.T) {
+	c := New("doh")
+	c.Hook(context.Background(), &doh.Event{Provider: "google", Response: &dns.Response{Status: 0}})
+
+	w := httptest.NewRecorder()
+	c.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Contains(t, w.Body.String(), `doh_queries_total{provider="google"} 1`)
+	assert.Contains(t, w.Body.String(), "go_goroutines")
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// QueryFunc is a function doing DoH query with the edns0-client-subnet option
+type QueryFunc func(ctx context.Context, d dns.Domain, t dns.Type, s dns.ECS) (*dns.Response, error)
+
+// Middleware wraps a query func, it may change the query, the response, or answer without calling next
+type Middleware func(next QueryFunc) QueryFunc
+
+// AddMiddleware add middlewares around the client queries including the cache,
+// the first added is the outermost
+func (c *DoH) AddMiddleware(m ...Middleware) *DoH {
+	c.Lock()
+	c.middlewares = append(c.middlewares, m...)
+	c.Unlock()
+
+	return c
+}
+
+// chain returns the query func wrapped by the middlewares
+func (c *DoH) chain(q QueryFunc) QueryFunc {
+	c.RLock()
+	middlewares, faults := c.middlewares, c.faults
+	c.RUnlock()
+
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		q = middlewares[i](q)
+	}
+
+	if faults != nil {
+		q = faults(q)
+	}
+
+	return q
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestAddMiddleware(t *testing.T) {
+	queried := 0
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		queried++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body: ioutil.NopCloser(strings.NewReader(
+				`{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`)),
+			Request: r,
+		}, nil
+	})
+
+	order := []string{}
+	trace := func(name string) Middleware {
+		return func(next QueryFunc) QueryFunc {
+			return func(ctx context.Context, d dns.Domain, t dns.Type, s dns.ECS) (*dns.Response, error) {
+				order = append(order, name)
+				return next(ctx, d, t, s)
+			}
+		}
+	}
+
+	block := func(next QueryFunc) QueryFunc {
+		return func(ctx context.Context, d dns.Domain, t dns.Type, s dns.ECS) (*dns.Response, error) {
+			if strings.HasSuffix(string(d), ".blocked") {
+				return nil, fmt.Errorf("doh: blocked domain: %s", d)
+			}
+			return next(ctx, d, t, s)
+		}
+	}
+
+	logs := []*QueryLog{}
+	c := Use(GoogleProvider).SetRoundTripper(rt).AddMiddleware(trace("a"), trace("b")).AddMiddleware(block).
+		SetQueryLogger(QueryLoggerFunc(func(ctx context.Context, l *QueryLog) {
+			logs = append(logs, l)
+		}))
+	defer c.Close()
+
+	ctx := context.Background()
+	rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+	assert.Equal(t, order, []string{"a", "b"})
+	assert.Equal(t, queried, 1)
+
+	_, err = c.Query(ctx, "likexian.blocked", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Equal(t, queried, 1)
+	assert.Equal(t, len(logs), 2)
+	assert.Equal(t, logs[1].Error, "doh: blocked domain: likexian.blocked")
+}
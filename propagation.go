@@ -0,0 +1,170 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// PropagationOptions is the options of CheckPropagation
+type PropagationOptions struct {
+	// Want is the answer data expected, for example the new address of a migration, empty for any agreed data
+	Want []string
+	// Interval is the time between rounds, 0 to check a single round
+	Interval time.Duration
+	// Rounds is the max rounds, 0 for no limit until converged or the context is done
+	Rounds int
+	// Timeout is the timeout of each query, default no limit
+	Timeout time.Duration
+	// OnRound is called with each round checked, for reporting the progress
+	OnRound func(PropagationRound)
+}
+
+// PropagationAnswer is the answer of a provider, the error is set if it failed without response
+type PropagationAnswer struct {
+	Provider string
+	Status   int
+	// Data is the sorted answer data of the type queried
+	Data []string
+	Err  error
+}
+
+// PropagationRound is the answers of providers at a time, in the order of providers
+type PropagationRound struct {
+	Time      time.Time
+	Answers   []PropagationAnswer
+	Converged bool
+}
+
+// PropagationReport is the rounds of propagation check, the convergence time is zero if not converged
+type PropagationReport struct {
+	Name        dns.Domain
+	Type        dns.Type
+	Rounds      []PropagationRound
+	Converged   bool
+	ConvergedAt time.Time
+}
+
+// CheckPropagation queries the record of every provider directly, bypassing the cache and middlewares, and
+// repeats by the interval until they converge on the same data, which is the wanted one if set, it returns
+// once converged, out of rounds, or ctx is done
+func (c *DoH) CheckPropagation(ctx context.Context, d dns.Domain, t dns.Type,
+	opts PropagationOptions) *PropagationReport {
+	t = t.Normalize()
+	r := &PropagationReport{Name: d, Type: t, Rounds: []PropagationRound{}}
+
+	want := normalizeData(opts.Want)
+	for {
+		round := c.propagationRound(ctx, d, t, opts.Timeout)
+		round.Converged = converged(round.Answers, want)
+		r.Rounds = append(r.Rounds, round)
+		if opts.OnRound != nil {
+			opts.OnRound(round)
+		}
+
+		if round.Converged {
+			r.Converged, r.ConvergedAt = true, round.Time
+			return r
+		}
+
+		if opts.Interval <= 0 || opts.Rounds > 0 && len(r.Rounds) >= opts.Rounds {
+			return r
+		}
+
+		timer := time.NewTimer(opts.Interval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return r
+		}
+	}
+}
+
+// propagationRound returns the answers of every provider queried in parallel
+func (c *DoH) propagationRound(ctx context.Context, d dns.Domain, t dns.Type, timeout time.Duration) PropagationRound {
+	ps, _ := c.list()
+	c.RLock()
+	now := c.clock.Now()
+	c.RUnlock()
+
+	round := PropagationRound{Time: now, Answers: make([]PropagationAnswer, len(ps))}
+	wg := sync.WaitGroup{}
+	for k, p := range ps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			qctx := ctx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				qctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			a := PropagationAnswer{Provider: p.String(), Data: []string{}}
+			rsp, err := p.Query(qctx, d, t)
+			if rsp == nil {
+				a.Err = err
+			} else {
+				a.Status = rsp.Status
+				for v := range rsp.Answers(t) {
+					a.Data = append(a.Data, v.Data)
+				}
+				a.Data = normalizeData(a.Data)
+			}
+			round.Answers[k] = a
+		}()
+	}
+	wg.Wait()
+
+	return round
+}
+
+// converged returns whether the answers are the same, and of the wanted data if any
+func converged(answers []PropagationAnswer, want []string) bool {
+	if len(answers) == 0 {
+		return false
+	}
+
+	first := answers[0]
+	for _, v := range answers {
+		if v.Err != nil || v.Status != first.Status || !slices.Equal(v.Data, first.Data) {
+			return false
+		}
+	}
+
+	return len(want) == 0 || first.Status == 0 && slices.Equal(first.Data, want)
+}
+
+// normalizeData returns the sorted distinct answer data without the surrounding spaces and trailing dots
+func normalizeData(data []string) []string {
+	vs := []string{}
+	for _, v := range data {
+		vs = append(vs, strings.TrimSuffix(strings.TrimSpace(v), "."))
+	}
+	slices.Sort(vs)
+
+	return slices.Compact(vs)
+}
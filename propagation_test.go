@@ -0,0 +1,131 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/dohtest"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestCheckPropagation(t *testing.T) {
+	p1 := dohtest.New("one")
+	p1.Answer("likexian.com", dns.TypeA, "1.2.3.4", "5.6.7.8")
+	p1.Answer("www.likexian.com", dns.TypeCNAME, "likexian.com.")
+	p2 := dohtest.New("two")
+	p2.Answer("likexian.com", dns.TypeA, "5.6.7.8", "1.2.3.4")
+	p2.Answer("www.likexian.com", dns.TypeCNAME, "likexian.com")
+	p2.On("nx.likexian.com", dns.TypeA).Status(3)
+	p2.On("down.likexian.com", dns.TypeA).Error(errors.New("injected"))
+
+	c := UseProviders(p1, p2)
+	defer c.Close()
+
+	ctx := context.Background()
+	r := c.CheckPropagation(ctx, "likexian.com", "a", PropagationOptions{})
+	assert.Equal(t, r.Type, dns.TypeA)
+	assert.True(t, r.Converged)
+	assert.Equal(t, len(r.Rounds), 1)
+	assert.Equal(t, r.ConvergedAt, r.Rounds[0].Time)
+	assert.Equal(t, r.Rounds[0].Answers[0].Provider, "one")
+	assert.Equal(t, r.Rounds[0].Answers[1].Data, []string{"1.2.3.4", "5.6.7.8"})
+
+	r = c.CheckPropagation(ctx, "www.likexian.com", dns.TypeCNAME, PropagationOptions{Want: []string{"likexian.com."}})
+	assert.True(t, r.Converged)
+
+	r = c.CheckPropagation(ctx, "likexian.com", dns.TypeA, PropagationOptions{Want: []string{"1.2.3.4"}})
+	assert.False(t, r.Converged)
+	assert.True(t, r.ConvergedAt.IsZero())
+
+	r = c.CheckPropagation(ctx, "nx.likexian.com", dns.TypeA, PropagationOptions{})
+	assert.True(t, r.Converged)
+	assert.Equal(t, r.Rounds[0].Answers[0].Status, 3)
+	assert.Equal(t, r.Rounds[0].Answers[1].Status, 3)
+	assert.Nil(t, r.Rounds[0].Answers[0].Err)
+
+	r = c.CheckPropagation(ctx, "nx.likexian.com", dns.TypeA, PropagationOptions{Want: []string{"1.2.3.4"}})
+	assert.False(t, r.Converged)
+
+	r = c.CheckPropagation(ctx, "down.likexian.com", dns.TypeA, PropagationOptions{})
+	assert.False(t, r.Converged)
+	assert.NotNil(t, r.Rounds[0].Answers[1].Err)
+
+	r = UseProviders().CheckPropagation(ctx, "likexian.com", dns.TypeA, PropagationOptions{})
+	assert.False(t, r.Converged)
+}
+
+func TestCheckPropagationRounds(t *testing.T) {
+	p1 := dohtest.New("one")
+	p1.Answer("likexian.com", dns.TypeA, "5.6.7.8")
+	p2 := dohtest.New("two")
+	p2.Answer("likexian.com", dns.TypeA, "1.2.3.4").Times(2)
+	p2.Answer("likexian.com", dns.TypeA, "5.6.7.8")
+
+	c := UseProviders(p1, p2)
+	defer c.Close()
+
+	rounds := 0
+	opts := PropagationOptions{
+		Want:     []string{"5.6.7.8"},
+		Interval: time.Millisecond,
+		OnRound: func(PropagationRound) {
+			rounds++
+		},
+	}
+
+	r := c.CheckPropagation(context.Background(), "likexian.com", dns.TypeA, opts)
+	assert.True(t, r.Converged)
+	assert.Equal(t, len(r.Rounds), 3)
+	assert.Equal(t, rounds, 3)
+	assert.False(t, r.Rounds[1].Converged)
+	assert.True(t, r.Rounds[2].Converged)
+
+	opts = PropagationOptions{Want: []string{"9.9.9.9"}, Interval: time.Millisecond, Rounds: 2}
+	r = c.CheckPropagation(context.Background(), "likexian.com", dns.TypeA, opts)
+	assert.False(t, r.Converged)
+	assert.Equal(t, len(r.Rounds), 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	opts = PropagationOptions{Want: []string{"9.9.9.9"}, Interval: 10 * time.Millisecond}
+	r = c.CheckPropagation(ctx, "likexian.com", dns.TypeA, opts)
+	assert.False(t, r.Converged)
+	assert.True(t, len(r.Rounds) > 0)
+}
+
+func TestCheckPropagationTimeout(t *testing.T) {
+	p1 := dohtest.New("one")
+	p1.Answer("likexian.com", dns.TypeA, "1.2.3.4")
+	p2 := dohtest.New("two")
+	p2.Answer("likexian.com", dns.TypeA, "1.2.3.4").Delay(time.Second)
+
+	c := UseProviders(p1, p2)
+	defer c.Close()
+
+	opts := PropagationOptions{Timeout: 10 * time.Millisecond}
+	r := c.CheckPropagation(context.Background(), "likexian.com", dns.TypeA, opts)
+	assert.False(t, r.Converged)
+	assert.True(t, errors.Is(r.Rounds[0].Answers[1].Err, context.DeadlineExceeded))
+}
@@ -20,20 +20,25 @@
 package cloudflare
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"encoding/base64"
 	"fmt"
+	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 
 	"github.com/ideatocode/doh-go/dns"
-	"github.com/likexian/gokit/xhttp"
-	"github.com/likexian/gokit/xip"
+	"github.com/ideatocode/doh-go/transport"
 )
 
 // Provider is a DoH provider client
 type Provider struct {
-	provides int
+	upstream  string
+	format    dns.Format
+	parsing   dns.Parsing
+	transport *transport.Transport
+	sync.RWMutex
 }
 
 const (
@@ -42,12 +47,21 @@ const (
 )
 
 var (
-	// Upstream is DoH query upstream
+	// Upstream is DoH query upstream, it is read by New and SetProvides, so the changes apply to the providers
+	// created or set after, it must not be changed concurrently with them
 	Upstream = map[int]string{
 		DefaultProvides: "https://cloudflare-dns.com/dns-query",
 	}
 )
 
+// dialect is the json api dialect of cloudflare, which returns the extended dns errors in an array of comments
+var dialect = dns.Dialect{
+	"Comment":            dns.CommentField,
+	"edns_client_subnet": dns.ECSField,
+}
+
+var _ dns.Provider = (*Provider)(nil)
+
 // Version returns package version
 func Version() string {
 	return "0.5.3"
@@ -63,10 +77,11 @@ func License() string {
 	return "Licensed under the Apache License 2.0"
 }
 
-// New returns a new cloudflare provider client
+// New returns a new cloudflare provider client, it is safe for concurrent use and can be configured while querying
 func New() *Provider {
 	return &Provider{
-		provides: DefaultProvides,
+		upstream:  Upstream[DefaultProvides],
+		transport: transport.New(),
 	}
 }
 
@@ -75,12 +90,102 @@ func (c *Provider) String() string {
 	return "cloudflare"
 }
 
+// Capabilities returns the features supported by provider
+func (c *Provider) Capabilities() dns.Capabilities {
+	return dns.Capabilities{
+		ECS:     true,
+		Flags:   true,
+		NoRD:    true,
+		Formats: []dns.Format{dns.FormatJSON, dns.FormatMessage},
+	}
+}
+
+// Transport returns the http transport of provider
+func (c *Provider) Transport() *transport.Transport {
+	return c.transport
+}
+
 // SetProvides set upstream provides type, cloudflare does NOT supported
 func (c *Provider) SetProvides(p int) error {
-	c.provides = DefaultProvides
+	c.Lock()
+	c.upstream = Upstream[DefaultProvides]
+	c.Unlock()
+
+	return nil
+}
+
+// SetFormat set the message format, FormatAuto prefers the wire format if the query type is supported by it
+func (c *Provider) SetFormat(f dns.Format) error {
+	if f < dns.FormatAuto || f > dns.FormatMessage {
+		return fmt.Errorf("doh: cloudflare: not supported format: %d", f)
+	}
+
+	c.Lock()
+	c.format = f
+	c.Unlock()
+
 	return nil
 }
 
+// SetParsing set the strictness of parsing the json responses
+func (c *Provider) SetParsing(p dns.Parsing) error {
+	if p < dns.ParsingDefault || p > dns.ParsingLenient {
+		return fmt.Errorf("doh: cloudflare: not supported parsing: %d", p)
+	}
+
+	c.Lock()
+	c.parsing = p
+	c.Unlock()
+
+	return nil
+}
+
+// Warm establishes a connection to upstream, so that the next query skips the handshake
+func (c *Provider) Warm(ctx context.Context) error {
+	c.RLock()
+	upstream := c.upstream
+	c.RUnlock()
+
+	return c.transport.Warm(ctx, upstream)
+}
+
+// Trace returns the key value pairs of the cdn-cgi/trace of upstream host, for example colo=SJC of the site answering
+func (c *Provider) Trace(ctx context.Context) (map[string]string, error) {
+	c.RLock()
+	upstream := c.upstream
+	c.RUnlock()
+
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("doh: cloudflare: invalid upstream: %s", err)
+	}
+
+	u.Path, u.RawQuery = "/cdn-cgi/trace", ""
+	rsp, err := c.transport.Get(ctx, u.String(), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rsp.Close()
+	if err := rsp.CheckStatus(); err != nil {
+		return nil, fmt.Errorf("doh: cloudflare: %w", err)
+	}
+
+	text, err := rsp.String()
+	if err != nil {
+		return nil, err
+	}
+
+	trace := map[string]string{}
+	for line := range strings.Lines(text) {
+		if k, v, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			trace[k] = v
+		}
+	}
+
+	return trace, nil
+}
+
 // Query do DoH query
 func (c *Provider) Query(ctx context.Context, d dns.Domain, t dns.Type) (*dns.Response, error) {
 	return c.ECSQuery(ctx, d, t, "")
@@ -93,47 +198,132 @@ func (c *Provider) ECSQuery(ctx context.Context, d dns.Domain, t dns.Type, s dns
 		return nil, err
 	}
 
-	param := xhttp.QueryParam{
-		"name": name,
-		"type": strings.TrimSpace(string(t)),
-	}
+	c.RLock()
+	upstream, format, parsing := c.upstream, c.format, c.parsing
+	c.RUnlock()
 
-	ss := strings.TrimSpace(string(s))
-	if ss != "" {
-		ss, err := xip.FixSubnet(ss)
-		if err != nil {
-			return nil, err
-		}
-		param["edns_client_subnet"] = ss
+	f := dns.FlagsOf(ctx)
+	param, header, err := request(name, t, s, f, format)
+	if err != nil {
+		return nil, err
 	}
 
-	req := xhttp.New()
-	if v := ctx.Value("proxyURL"); v != nil {
-		req.SetProxyUrl(v.(string))
+	rsp, err := c.transport.Get(ctx, upstream, param, header)
+	if err != nil {
+		return nil, err
 	}
 
-	rsp, err := req.Get(ctx, Upstream[c.provides], param, xhttp.Header{"accept": "application/dns-json"})
+	rr, err := c.decode(rsp, parsing)
 	if err != nil {
 		return nil, err
 	}
 
+	if rr.TC {
+		rr = c.retry(ctx, upstream, rr, name, t, s, f, parsing)
+	}
+
+	if rr.Status != 0 {
+		return rr, fmt.Errorf("doh: cloudflare: failed response code %d", rr.Status)
+	}
+
+	return rr, nil
+}
+
+// decode returns the response decoded from the upstream one, which is closed
+func (c *Provider) decode(rsp *transport.Response, parsing dns.Parsing) (*dns.Response, error) {
 	defer rsp.Close()
-	buf, err := rsp.Bytes()
+	if err := rsp.CheckStatus(); err != nil {
+		return nil, fmt.Errorf("doh: cloudflare: %w", err)
+	}
+	body, err := rsp.Reader()
 	if err != nil {
 		return nil, err
 	}
 
-	rr := &dns.Response{
-		Provider: c.String(),
-	}
-	err = json.NewDecoder(bytes.NewBuffer(buf)).Decode(rr)
+	rr, err := dialect.DecodeReader(rsp.Header.Get("Content-Type"), body, parsing)
 	if err != nil {
 		return nil, err
 	}
 
-	if rr.Status != 0 {
-		return rr, fmt.Errorf("doh: cloudflare: failed response code %d", rr.Status)
-	}
+	rr.Provider = c.String()
+	rr.Metadata = rsp.Metadata()
 
 	return rr, nil
 }
+
+// retry returns the response of the truncated one retried in the wire format over POST, which is not limited by
+// the udp message size, the truncated one is returned if failed
+func (c *Provider) retry(ctx context.Context, upstream string, rr *dns.Response, name string, t dns.Type, s dns.ECS,
+	f dns.Flags, parsing dns.Parsing) *dns.Response {
+	rr.Metadata.Truncated = true
+
+	msg, err := dns.NewQuery(name, t, s, f)
+	if err != nil {
+		return rr
+	}
+
+	rsp, err := c.transport.Post(ctx, upstream, msg, http.Header{"Accept": {dns.ContentTypeMessage}})
+	if err != nil {
+		return rr
+	}
+
+	retried, err := c.decode(rsp, parsing)
+	if err != nil {
+		return rr
+	}
+
+	retried.Metadata.Truncated = true
+
+	return retried
+}
+
+// request returns the query param and header of the negotiated format
+func request(name string, t dns.Type, s dns.ECS, f dns.Flags, format dns.Format) (url.Values, http.Header, error) {
+	if wire(t, f, format) {
+		msg, err := dns.NewQuery(name, t, s, f)
+		if err != nil {
+			return nil, nil, err
+		}
+		return url.Values{"dns": {base64.RawURLEncoding.EncodeToString(msg)}},
+			http.Header{"Accept": {dns.ContentTypeMessage}}, nil
+	}
+
+	param := url.Values{
+		"name": {name},
+		"type": {t.Param()},
+	}
+
+	ss := strings.TrimSpace(string(s))
+	if ss != "" {
+		ss, err := dns.ECS(ss).Subnet()
+		if err != nil {
+			return nil, nil, err
+		}
+		param.Set("edns_client_subnet", ss)
+	}
+
+	if f.CD {
+		param.Set("cd", "1")
+	}
+
+	if f.DO {
+		param.Set("do", "1")
+	}
+
+	return param, http.Header{"Accept": {dns.ContentTypeJSON}}, nil
+}
+
+// wire returns whether to query in the wire format, the json api does not accept the cleared recursion desired
+func wire(t dns.Type, f dns.Flags, format dns.Format) bool {
+	switch {
+	case f.NoRD:
+		return true
+	case format == dns.FormatJSON:
+		return false
+	case format == dns.FormatMessage:
+		return true
+	default:
+		_, err := t.Code()
+		return err == nil
+	}
+}
@@ -21,11 +21,17 @@ package cloudflare
 
 import (
 	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/ideatocode/doh-go/dns"
 	"github.com/likexian/gokit/assert"
+	"golang.org/x/net/dns/dnsmessage"
 )
 
 func TestVersion(t *testing.T) {
@@ -39,6 +45,15 @@ func TestString(t *testing.T) {
 	assert.Equal(t, c.String(), "cloudflare")
 }
 
+func TestCapabilities(t *testing.T) {
+	c := New().Capabilities()
+	assert.True(t, c.SupportsType(dns.TypeAAAA))
+	assert.True(t, c.SupportsFormat(dns.FormatMessage))
+	assert.True(t, c.ECS)
+	assert.True(t, c.Flags)
+	assert.True(t, c.NoRD)
+}
+
 func TestQuery(t *testing.T) {
 	c := New()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -76,10 +91,351 @@ func TestECSQuery(t *testing.T) {
 	assert.Gt(t, len(rsp.Answer), 0)
 
 	Upstream[DefaultProvides] = "test"
+	c = New()
 	_, err = c.ECSQuery(ctx, "likexian.com", dns.TypeA, "")
 	assert.NotNil(t, err)
 
 	Upstream[DefaultProvides] = "https://dns.cloudflare.com/dns"
+	c = New()
 	_, err = c.ECSQuery(ctx, "likexian.com", dns.TypeA, "")
 	assert.NotNil(t, err)
 }
+
+func TestMetadata(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=300")
+		fmt.Fprint(w, `{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`)
+	}))
+	defer ts.Close()
+
+	upstream := Upstream[DefaultProvides]
+	Upstream[DefaultProvides] = ts.URL
+	defer func() {
+		Upstream[DefaultProvides] = upstream
+	}()
+
+	rsp, err := New().Query(context.Background(), "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Metadata.StatusCode, http.StatusOK)
+	assert.Equal(t, rsp.Metadata.Upstream, ts.URL)
+	assert.Equal(t, rsp.Metadata.RemoteAddr, ts.Listener.Addr().String())
+	assert.Equal(t, rsp.Metadata.Header.Get("Cache-Control"), "max-age=300")
+}
+
+func TestSetFormat(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("dns") == "" {
+			assert.Equal(t, r.Header.Get("Accept"), dns.ContentTypeJSON)
+			fmt.Fprint(w, `{"Status":0,"Answer":[{"name":"likexian.com","type":1,"TTL":300,"data":"1.1.1.1"}]}`)
+			return
+		}
+
+		assert.Equal(t, r.Header.Get("Accept"), dns.ContentTypeMessage)
+		b, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		assert.Nil(t, err)
+
+		var p dnsmessage.Parser
+		h, err := p.Start(b)
+		assert.Nil(t, err)
+		q, err := p.Question()
+		assert.Nil(t, err)
+
+		h.Response = true
+		m := dnsmessage.NewBuilder(nil, h)
+		_ = m.StartQuestions()
+		_ = m.Question(q)
+		_ = m.StartAnswers()
+		_ = m.AResource(dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: 300},
+			dnsmessage.AResource{A: [4]byte{1, 1, 1, 2}})
+		msg, err := m.Finish()
+		assert.Nil(t, err)
+
+		w.Header().Set("Content-Type", dns.ContentTypeMessage)
+		_, _ = w.Write(msg)
+	}))
+	defer ts.Close()
+
+	upstream := Upstream[DefaultProvides]
+	Upstream[DefaultProvides] = ts.URL
+	defer func() {
+		Upstream[DefaultProvides] = upstream
+	}()
+
+	ctx := context.Background()
+	c := New()
+
+	rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Provider, "cloudflare")
+	assert.Equal(t, rsp.Answer[0].Name, "likexian.com.")
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.2")
+
+	rsp, err = c.Query(ctx, "likexian.com", dns.Type("CAA"))
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+
+	assert.Nil(t, c.SetFormat(dns.FormatJSON))
+	rsp, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+
+	assert.Nil(t, c.SetFormat(dns.FormatMessage))
+	_, err = c.Query(ctx, "likexian.com", dns.Type("CAA"))
+	assert.NotNil(t, err)
+
+	assert.NotNil(t, c.SetFormat(dns.Format(9)))
+}
+
+func TestConcurrent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/dns-json")
+		fmt.Fprint(w, `{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`)
+	}))
+	defer ts.Close()
+
+	upstream := Upstream[DefaultProvides]
+	Upstream[DefaultProvides] = ts.URL
+	defer func() {
+		Upstream[DefaultProvides] = upstream
+	}()
+
+	c := New()
+
+	ctx := context.Background()
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for j := 0; j < 10; j++ {
+				_ = c.SetFormat(dns.FormatJSON)
+				_ = c.SetProvides(DefaultProvides)
+			}
+		}()
+	}
+
+	for i := 0; i < 4; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for j := 0; j < 10; j++ {
+				rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+				assert.Nil(t, err)
+				assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+			}
+		}()
+	}
+
+	for i := 0; i < 8; i++ {
+		<-done
+	}
+}
+
+func TestSetParsing(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"Status":0,"Comment":"x","Answer":[{"name":"likexian.com.","type":1,"TTL":"300","data":"1.1.1.1"}]}`)
+	}))
+	defer ts.Close()
+
+	upstream := Upstream[DefaultProvides]
+	Upstream[DefaultProvides] = ts.URL
+	defer func() {
+		Upstream[DefaultProvides] = upstream
+	}()
+
+	ctx := context.Background()
+	c := New()
+	assert.Nil(t, c.SetFormat(dns.FormatJSON))
+
+	_, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, c.SetParsing(dns.ParsingStrict))
+	_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Answer.0.TTL")
+
+	assert.Nil(t, c.SetParsing(dns.ParsingLenient))
+	rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].TTL, 300)
+
+	assert.NotNil(t, c.SetParsing(dns.Parsing(-1)))
+	assert.NotNil(t, c.SetParsing(dns.Parsing(3)))
+	assert.Equal(t, c.parsing, dns.ParsingLenient)
+}
+
+func TestDialect(t *testing.T) {
+	body := `{"Status":2,"TC":false,"RD":true,"RA":true,"AD":false,"CD":false,
+		"Question":[{"name":"dnssec-failed.org","type":1}],
+		"Comment":["EDE(9): DNSKEY Missing (no SEP matching the DS found for dnssec-failed.org.)"]}`
+
+	for _, p := range []dns.Parsing{dns.ParsingDefault, dns.ParsingStrict, dns.ParsingLenient} {
+		rsp, err := dialect.DecodeReader(dns.ContentTypeJSON, strings.NewReader(body), p)
+		assert.Nil(t, err)
+		assert.Equal(t, rsp.Status, 2)
+		assert.Equal(t, rsp.Comment, "EDE(9): DNSKEY Missing (no SEP matching the DS found for dnssec-failed.org.)")
+	}
+
+	rsp, err := dialect.DecodeReader(dns.ContentTypeJSON,
+		strings.NewReader(`{"Status":0,"Comment":"x","edns_client_subnet":"1.2.3.4/24"}`), dns.ParsingStrict)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Comment, "x")
+	assert.Equal(t, rsp.ECS, dns.ECS("1.2.3.4/24"))
+}
+
+func TestTruncated(t *testing.T) {
+	full := &dns.Response{RD: true, RA: true, Question: []dns.Question{{Name: "likexian.com.", Type: 16}},
+		Answer: []dns.Answer{{Name: "likexian.com.", Type: 16, TTL: 300, Data: `"a"`},
+			{Name: "likexian.com.", Type: 16, TTL: 300, Data: `"b"`}}}
+	msg, err := full.Pack(0)
+	assert.Nil(t, err)
+
+	posted := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			posted++
+			if r.URL.Query().Get("fail") != "" || r.Header.Get("Content-Type") != dns.ContentTypeMessage {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", dns.ContentTypeMessage)
+			_, _ = w.Write(msg)
+			return
+		}
+		fmt.Fprint(w, `{"Status":0,"TC":true,"Answer":[{"name":"likexian.com.","type":16,"TTL":300,"data":"\"a\""}]}`)
+	}))
+	defer ts.Close()
+
+	upstream := Upstream[DefaultProvides]
+	Upstream[DefaultProvides] = ts.URL
+	defer func() {
+		Upstream[DefaultProvides] = upstream
+	}()
+
+	ctx := context.Background()
+	c := New()
+	assert.Nil(t, c.SetFormat(dns.FormatJSON))
+
+	rsp, err := c.Query(ctx, "likexian.com", dns.TypeTXT)
+	assert.Nil(t, err)
+	assert.False(t, rsp.TC)
+	assert.True(t, rsp.Metadata.Truncated)
+	assert.Equal(t, len(rsp.Answer), 2)
+	assert.Equal(t, posted, 1)
+
+	Upstream[DefaultProvides] = ts.URL + "?fail=1"
+	c = New()
+	assert.Nil(t, c.SetFormat(dns.FormatJSON))
+
+	rsp, err = c.Query(ctx, "likexian.com", dns.TypeTXT)
+	assert.Nil(t, err)
+	assert.True(t, rsp.TC)
+	assert.True(t, rsp.Metadata.Truncated)
+	assert.Equal(t, len(rsp.Answer), 1)
+	assert.Equal(t, posted, 2)
+}
+
+func TestFlags(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("dns") == "" {
+			fmt.Fprintf(w, `{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"json|%s"}]}`,
+				r.URL.Query().Get("cd"))
+			return
+		}
+		b, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		assert.Nil(t, err)
+		q, err := dns.ParseQuery(b)
+		assert.Nil(t, err)
+		fmt.Fprintf(w, `{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"%v|%v"}]}`,
+			q.Flags.CD, q.Flags.NoRD)
+	}))
+	defer ts.Close()
+
+	upstream := Upstream[DefaultProvides]
+	Upstream[DefaultProvides] = ts.URL
+	defer func() {
+		Upstream[DefaultProvides] = upstream
+	}()
+
+	ctx := context.Background()
+	rsp, err := New().Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "false|false")
+
+	rsp, err = New().Query(dns.WithFlags(ctx, dns.Flags{CD: true, NoRD: true}), "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "true|true")
+
+	c := New()
+	assert.Nil(t, c.SetFormat(dns.FormatJSON))
+
+	rsp, err = c.Query(dns.WithFlags(ctx, dns.Flags{CD: true}), "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "json|1")
+
+	rsp, err = c.Query(dns.WithFlags(ctx, dns.Flags{NoRD: true}), "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "false|true")
+}
+
+func TestNumericType(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		qtype := r.URL.Query().Get("type")
+		if v := r.URL.Query().Get("dns"); v != "" {
+			b, err := base64.RawURLEncoding.DecodeString(v)
+			assert.Nil(t, err)
+			q, err := dns.ParseQuery(b)
+			assert.Nil(t, err)
+			qtype = string(q.Type)
+		}
+		fmt.Fprintf(w, `{"Status":0,"Answer":[{"name":"likexian.com.","type":65,"TTL":300,"data":"%s"}]}`, qtype)
+	}))
+	defer ts.Close()
+
+	upstream := Upstream[DefaultProvides]
+	Upstream[DefaultProvides] = ts.URL
+	defer func() {
+		Upstream[DefaultProvides] = upstream
+	}()
+
+	ctx := context.Background()
+	c := New()
+	rsp, err := c.Query(ctx, "likexian.com", "65")
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "TYPE65")
+
+	assert.Nil(t, c.SetFormat(dns.FormatJSON))
+	rsp, err = c.Query(ctx, "likexian.com", "TYPE65")
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "65")
+}
+
+func TestTrace(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/cdn-cgi/trace" || r.URL.RawQuery != "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, "fl=123f45\nh=cloudflare-dns.com\ncolo=SJC\nhttp=http/2\n")
+	}))
+	defer ts.Close()
+
+	upstream := Upstream[DefaultProvides]
+	Upstream[DefaultProvides] = ts.URL + "/dns-query?ct=1"
+	defer func() {
+		Upstream[DefaultProvides] = upstream
+	}()
+
+	trace, err := New().Trace(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, trace["colo"], "SJC")
+	assert.Equal(t, trace["http"], "http/2")
+
+	Upstream[DefaultProvides] = ts.URL + "/"
+	trace, err = New().Trace(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, trace["h"], "cloudflare-dns.com")
+
+	ts.Close()
+	_, err = New().Trace(context.Background())
+	assert.NotNil(t, err)
+}
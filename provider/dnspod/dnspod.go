@@ -22,17 +22,21 @@ package dnspod
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/ideatocode/doh-go/dns"
-	"github.com/likexian/gokit/xhttp"
-	"github.com/likexian/gokit/xip"
+	"github.com/ideatocode/doh-go/transport"
 )
 
 // Provider is a DoH provider client
 type Provider struct {
-	provides int
+	upstream  string
+	transport *transport.Transport
+	sync.RWMutex
 }
 
 const (
@@ -41,12 +45,15 @@ const (
 )
 
 var (
-	// Upstream is DoH query upstream
+	// Upstream is DoH query upstream, it is read by New and SetProvides, so the changes apply to the providers
+	// created or set after, it must not be changed concurrently with them
 	Upstream = map[int]string{
 		DefaultProvides: "http://119.29.29.29/d",
 	}
 )
 
+var _ dns.Provider = (*Provider)(nil)
+
 // Version returns package version
 func Version() string {
 	return "0.2.4"
@@ -62,10 +69,11 @@ func License() string {
 	return "Licensed under the Apache License 2.0"
 }
 
-// New returns a new dnspod provider client
+// New returns a new dnspod provider client, it is safe for concurrent use and can be configured while querying
 func New() *Provider {
 	return &Provider{
-		provides: DefaultProvides,
+		upstream:  Upstream[DefaultProvides],
+		transport: transport.New(),
 	}
 }
 
@@ -74,12 +82,46 @@ func (c *Provider) String() string {
 	return "dnspod"
 }
 
+// Capabilities returns the features supported by provider
+func (c *Provider) Capabilities() dns.Capabilities {
+	return dns.Capabilities{
+		ECS:   true,
+		Types: []dns.Type{dns.TypeA},
+	}
+}
+
+// Transport returns the http transport of provider
+func (c *Provider) Transport() *transport.Transport {
+	return c.transport
+}
+
 // SetProvides set upstream provides type, dnspod does NOT supported
 func (c *Provider) SetProvides(p int) error {
-	c.provides = DefaultProvides
+	c.Lock()
+	c.upstream = Upstream[DefaultProvides]
+	c.Unlock()
+
+	return nil
+}
+
+// SetFormat set the message format, dnspod only supports its own plain text format
+func (c *Provider) SetFormat(f dns.Format) error {
+	if f != dns.FormatAuto {
+		return fmt.Errorf("doh: dnspod: not supported format: %s", f)
+	}
+
 	return nil
 }
 
+// Warm establishes a connection to upstream, so that the next query skips the handshake
+func (c *Provider) Warm(ctx context.Context) error {
+	c.RLock()
+	upstream := c.upstream
+	c.RUnlock()
+
+	return c.transport.Warm(ctx, upstream)
+}
+
 // Query do DoH query
 func (c *Provider) Query(ctx context.Context, d dns.Domain, t dns.Type) (*dns.Response, error) {
 	return c.ECSQuery(ctx, d, t, "")
@@ -87,43 +129,46 @@ func (c *Provider) Query(ctx context.Context, d dns.Domain, t dns.Type) (*dns.Re
 
 // ECSQuery do DoH query with the edns0-client-subnet option
 func (c *Provider) ECSQuery(ctx context.Context, d dns.Domain, t dns.Type, s dns.ECS) (*dns.Response, error) {
-	if t != dns.TypeA {
+	if t.Normalize() != dns.TypeA {
 		return nil, fmt.Errorf("doh: dnspod: only A record type is supported")
 	}
 
+	if dns.FlagsOf(ctx).NoRD {
+		return nil, fmt.Errorf("doh: dnspod: cleared recursion desired is not supported")
+	}
+
 	name, err := d.Punycode()
 	if err != nil {
 		return nil, err
 	}
 
-	param := xhttp.QueryParam{
-		"dn":  name,
-		"ttl": "1",
+	param := url.Values{
+		"dn":  {name},
+		"ttl": {"1"},
 	}
 
 	ss := strings.TrimSpace(string(s))
 	if ss != "" {
-		ss, err := xip.FixSubnet(ss)
+		ss, err := dns.ECS(ss).Subnet()
 		if err != nil {
 			return nil, err
 		}
 		ips := strings.Split(ss, "/")
-		param["ip"] = ips[0]
+		param.Set("ip", ips[0])
 	}
 
-	req := xhttp.New()
-	if v := ctx.Value("proxyURL"); v != nil {
-		req.SetProxyUrl(v.(string))
-	}
+	c.RLock()
+	upstream := c.upstream
+	c.RUnlock()
 
-	rsp, err := req.Get(ctx, Upstream[c.provides], param)
+	rsp, err := c.transport.Get(ctx, upstream, param, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	defer rsp.Close()
-	if rsp.StatusCode != 200 {
-		return nil, fmt.Errorf("doh: dnspod: bad status code: %d", rsp.StatusCode)
+	if err := rsp.CheckStatus(); err != nil {
+		return nil, fmt.Errorf("doh: dnspod: %w", err)
 	}
 
 	txt, err := rsp.String()
@@ -141,6 +186,7 @@ func (c *Provider) ECSQuery(ctx context.Context, d dns.Domain, t dns.Type, s dns
 		Question: []dns.Question{},
 		Answer:   []dns.Answer{},
 		Provider: c.String(),
+		Metadata: rsp.Metadata(),
 	}
 	rr.Question = append(rr.Question, dns.Question{Name: name, Type: 1})
 
@@ -161,7 +207,7 @@ func (c *Provider) ECSQuery(ctx context.Context, d dns.Domain, t dns.Type, s dns
 
 	ts = strings.Split(ts[0], ";")
 	for _, v := range ts {
-		if xip.IsIP(v) {
+		if net.ParseIP(v) != nil {
 			rr.Answer = append(rr.Answer, dns.Answer{Name: name, Type: 1, TTL: ttl, Data: v})
 		}
 	}
@@ -39,6 +39,21 @@ func TestString(t *testing.T) {
 	assert.Equal(t, c.String(), "dnspod")
 }
 
+func TestCapabilities(t *testing.T) {
+	c := New().Capabilities()
+	assert.True(t, c.SupportsType(dns.TypeA))
+	assert.False(t, c.SupportsType(dns.TypeAAAA))
+	assert.False(t, c.SupportsFormat(dns.FormatMessage))
+	assert.False(t, c.Flags)
+	assert.False(t, c.NoRD)
+}
+
+func TestFlags(t *testing.T) {
+	ctx := dns.WithFlags(context.Background(), dns.Flags{NoRD: true})
+	_, err := New().Query(ctx, "likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+}
+
 func TestQuery(t *testing.T) {
 	c := New()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -79,10 +94,19 @@ func TestECSQuery(t *testing.T) {
 	assert.Gt(t, len(rsp.Answer), 0)
 
 	Upstream[DefaultProvides] = "test"
+	c = New()
 	_, err = c.ECSQuery(ctx, "likexian.com", dns.TypeA, "")
 	assert.NotNil(t, err)
 
 	Upstream[DefaultProvides] = "http://119.29.29.29/dns"
+	c = New()
 	_, err = c.ECSQuery(ctx, "likexian.com", dns.TypeA, "")
 	assert.NotNil(t, err)
 }
+
+func TestSetFormat(t *testing.T) {
+	c := New()
+	assert.Nil(t, c.SetFormat(dns.FormatAuto))
+	assert.NotNil(t, c.SetFormat(dns.FormatJSON))
+	assert.NotNil(t, c.SetFormat(dns.FormatMessage))
+}
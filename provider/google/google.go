@@ -20,20 +20,24 @@
 package google
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 
 	"github.com/ideatocode/doh-go/dns"
-	"github.com/likexian/gokit/xhttp"
-	"github.com/likexian/gokit/xip"
+	"github.com/ideatocode/doh-go/transport"
 )
 
 // Provider is a DoH provider client
 type Provider struct {
-	provides int
+	upstream  string
+	format    dns.Format
+	parsing   dns.Parsing
+	transport *transport.Transport
+	sync.RWMutex
 }
 
 const (
@@ -42,12 +46,20 @@ const (
 )
 
 var (
-	// Upstream is DoH query upstream
+	// Upstream is DoH query upstream, it is read by New and SetProvides, so the changes apply to the providers
+	// created or set after, it must not be changed concurrently with them
 	Upstream = map[int]string{
 		DefaultProvides: "https://dns.google.com/resolve",
 	}
 )
 
+// dialect is the json api dialect of google, which echoes the edns0-client-subnet with the scope prefix length
+var dialect = dns.Dialect{
+	"edns_client_subnet": dns.ECSField,
+}
+
+var _ dns.Provider = (*Provider)(nil)
+
 // Version returns package version
 func Version() string {
 	return "0.5.3"
@@ -63,10 +75,11 @@ func License() string {
 	return "Licensed under the Apache License 2.0"
 }
 
-// New returns a new google provider client
+// New returns a new google provider client, it is safe for concurrent use and can be configured while querying
 func New() *Provider {
 	return &Provider{
-		provides: DefaultProvides,
+		upstream:  Upstream[DefaultProvides],
+		transport: transport.New(),
 	}
 }
 
@@ -75,12 +88,64 @@ func (c *Provider) String() string {
 	return "google"
 }
 
+// Capabilities returns the features supported by provider
+func (c *Provider) Capabilities() dns.Capabilities {
+	return dns.Capabilities{
+		ECS:     true,
+		Flags:   true,
+		Formats: []dns.Format{dns.FormatJSON, dns.FormatMessage},
+	}
+}
+
+// Transport returns the http transport of provider
+func (c *Provider) Transport() *transport.Transport {
+	return c.transport
+}
+
 // SetProvides set upstream provides type, google does NOT supported
 func (c *Provider) SetProvides(p int) error {
-	c.provides = DefaultProvides
+	c.Lock()
+	c.upstream = Upstream[DefaultProvides]
+	c.Unlock()
+
+	return nil
+}
+
+// SetFormat set the message format, FormatAuto prefers the wire format if the query type is supported by it
+func (c *Provider) SetFormat(f dns.Format) error {
+	if f < dns.FormatAuto || f > dns.FormatMessage {
+		return fmt.Errorf("doh: google: not supported format: %d", f)
+	}
+
+	c.Lock()
+	c.format = f
+	c.Unlock()
+
+	return nil
+}
+
+// SetParsing set the strictness of parsing the json responses
+func (c *Provider) SetParsing(p dns.Parsing) error {
+	if p < dns.ParsingDefault || p > dns.ParsingLenient {
+		return fmt.Errorf("doh: google: not supported parsing: %d", p)
+	}
+
+	c.Lock()
+	c.parsing = p
+	c.Unlock()
+
 	return nil
 }
 
+// Warm establishes a connection to upstream, so that the next query skips the handshake
+func (c *Provider) Warm(ctx context.Context) error {
+	c.RLock()
+	upstream := c.upstream
+	c.RUnlock()
+
+	return c.transport.Warm(ctx, upstream)
+}
+
 // Query do DoH query
 func (c *Provider) Query(ctx context.Context, d dns.Domain, t dns.Type) (*dns.Response, error) {
 	return c.ECSQuery(ctx, d, t, "")
@@ -93,47 +158,136 @@ func (c *Provider) ECSQuery(ctx context.Context, d dns.Domain, t dns.Type, s dns
 		return nil, err
 	}
 
-	param := xhttp.QueryParam{
-		"name": name,
-		"type": strings.TrimSpace(string(t)),
-	}
+	c.RLock()
+	upstream, format, parsing := c.upstream, c.format, c.parsing
+	c.RUnlock()
 
-	ss := strings.TrimSpace(string(s))
-	if ss != "" {
-		ss, err := xip.FixSubnet(ss)
-		if err != nil {
-			return nil, err
-		}
-		param["edns_client_subnet"] = ss
+	f := dns.FlagsOf(ctx)
+	param, header, err := request(name, t, s, f, format)
+	if err != nil {
+		return nil, err
 	}
 
-	req := xhttp.New()
-	if v := ctx.Value("proxyURL"); v != nil {
-		req.SetProxyUrl(v.(string))
+	rsp, err := c.transport.Get(ctx, upstream, param, header)
+	if err != nil {
+		return nil, err
 	}
 
-	rsp, err := req.Get(ctx, Upstream[c.provides], param, xhttp.Header{"accept": "application/dns-json"})
+	rr, err := c.decode(rsp, parsing)
 	if err != nil {
 		return nil, err
 	}
 
+	if rr.TC {
+		rr = c.retry(ctx, upstream, rr, name, t, s, f, format, parsing)
+	}
+
+	if rr.Status != 0 {
+		return rr, fmt.Errorf("doh: google: failed response code %d", rr.Status)
+	}
+
+	return rr, nil
+}
+
+// decode returns the response decoded from the upstream one, which is closed
+func (c *Provider) decode(rsp *transport.Response, parsing dns.Parsing) (*dns.Response, error) {
 	defer rsp.Close()
-	buf, err := rsp.Bytes()
+	if err := rsp.CheckStatus(); err != nil {
+		return nil, fmt.Errorf("doh: google: %w", err)
+	}
+	body, err := rsp.Reader()
 	if err != nil {
 		return nil, err
 	}
 
-	rr := &dns.Response{
-		Provider: c.String(),
-	}
-	err = json.NewDecoder(bytes.NewBuffer(buf)).Decode(rr)
+	rr, err := dialect.DecodeReader(rsp.Header.Get("Content-Type"), body, parsing)
 	if err != nil {
 		return nil, err
 	}
 
-	if rr.Status != 0 {
-		return rr, fmt.Errorf("doh: google: failed response code %d", rr.Status)
-	}
+	rr.Provider = c.String()
+	rr.Metadata = rsp.Metadata()
 
 	return rr, nil
 }
+
+// retry returns the response of the truncated json one retried in the wire format, which is not limited by
+// the udp message size, the json api of google does not accept POST, the truncated one is returned if failed
+func (c *Provider) retry(ctx context.Context, upstream string, rr *dns.Response, name string, t dns.Type, s dns.ECS,
+	f dns.Flags, format dns.Format, parsing dns.Parsing) *dns.Response {
+	rr.Metadata.Truncated = true
+	if wire(t, format) {
+		return rr
+	}
+
+	param, header, err := request(name, t, s, f, dns.FormatMessage)
+	if err != nil {
+		return rr
+	}
+
+	rsp, err := c.transport.Get(ctx, upstream, param, header)
+	if err != nil {
+		return rr
+	}
+
+	retried, err := c.decode(rsp, parsing)
+	if err != nil {
+		return rr
+	}
+
+	retried.Metadata.Truncated = true
+
+	return retried
+}
+
+// request returns the query param and header of the negotiated format,
+// google returns the wire format if the ct param is application/dns-message, but the query is always json
+// params, which do not accept the cleared recursion desired
+func request(name string, t dns.Type, s dns.ECS, f dns.Flags, format dns.Format) (url.Values, http.Header, error) {
+	if f.NoRD {
+		return nil, nil, fmt.Errorf("doh: google: cleared recursion desired is not supported")
+	}
+
+	param := url.Values{
+		"name": {name},
+		"type": {t.Param()},
+	}
+
+	ss := strings.TrimSpace(string(s))
+	if ss != "" {
+		ss, err := dns.ECS(ss).Subnet()
+		if err != nil {
+			return nil, nil, err
+		}
+		param.Set("edns_client_subnet", ss)
+	}
+
+	if f.CD {
+		param.Set("cd", "1")
+	}
+
+	if f.DO {
+		param.Set("do", "1")
+	}
+
+	if !wire(t, format) {
+		return param, http.Header{"Accept": {dns.ContentTypeJSON}}, nil
+	}
+
+	param.Set("ct", dns.ContentTypeMessage)
+
+	return param, http.Header{"Accept": {dns.ContentTypeMessage}}, nil
+}
+
+// wire returns whether to query in the wire format
+func wire(t dns.Type, format dns.Format) bool {
+	switch format {
+	case dns.FormatJSON:
+		return false
+	case dns.FormatMessage:
+		return true
+	default:
+		_, err := t.Code()
+		return err == nil
+	}
+}
@@ -21,10 +21,16 @@ package google
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/transport"
 	"github.com/likexian/gokit/assert"
 )
 
@@ -39,6 +45,15 @@ func TestString(t *testing.T) {
 	assert.Equal(t, c.String(), "google")
 }
 
+func TestCapabilities(t *testing.T) {
+	c := New().Capabilities()
+	assert.True(t, c.SupportsType(dns.TypeAAAA))
+	assert.True(t, c.SupportsFormat(dns.FormatMessage))
+	assert.True(t, c.ECS)
+	assert.True(t, c.Flags)
+	assert.False(t, c.NoRD)
+}
+
 func TestQuery(t *testing.T) {
 	c := New()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -76,10 +91,238 @@ func TestECSQuery(t *testing.T) {
 	assert.Gt(t, len(rsp.Answer), 0)
 
 	Upstream[DefaultProvides] = "test"
+	c = New()
 	_, err = c.ECSQuery(ctx, "likexian.com", dns.TypeA, "")
 	assert.NotNil(t, err)
 
 	Upstream[DefaultProvides] = "https://dns.google.com/dns"
+	c = New()
 	_, err = c.ECSQuery(ctx, "likexian.com", dns.TypeA, "")
 	assert.NotNil(t, err)
 }
+
+func TestErrorBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-javascript; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"Status":1,"Comment":"Invalid name: Name contains empty label."}`)
+	}))
+	defer ts.Close()
+
+	upstream := Upstream[DefaultProvides]
+	Upstream[DefaultProvides] = ts.URL
+	defer func() {
+		Upstream[DefaultProvides] = upstream
+	}()
+
+	_, err := New().Query(context.Background(), "likexian..com", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "doh: dns: invalid domain likexian..com: empty label")
+
+	_, err = New().Query(context.Background(), "likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "doh: google: bad status code: 400")
+	assert.Contains(t, err.Error(), "Invalid name: Name contains empty label.")
+
+	var e *transport.StatusError
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, e.StatusCode, http.StatusBadRequest)
+}
+
+func TestSetFormat(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"%s|%s"}]}`,
+			r.URL.Query().Get("ct"), r.Header.Get("Accept"))
+	}))
+	defer ts.Close()
+
+	upstream := Upstream[DefaultProvides]
+	Upstream[DefaultProvides] = ts.URL
+	defer func() {
+		Upstream[DefaultProvides] = upstream
+	}()
+
+	ctx := context.Background()
+	c := New()
+
+	rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "application/dns-message|application/dns-message")
+
+	assert.Nil(t, c.SetFormat(dns.FormatJSON))
+	rsp, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "|application/dns-json")
+
+	assert.NotNil(t, c.SetFormat(dns.Format(-1)))
+}
+
+func TestFlags(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"%s|%s"}]}`,
+			r.URL.Query().Get("cd"), r.URL.Query().Get("do"))
+	}))
+	defer ts.Close()
+
+	upstream := Upstream[DefaultProvides]
+	Upstream[DefaultProvides] = ts.URL
+	defer func() {
+		Upstream[DefaultProvides] = upstream
+	}()
+
+	ctx := context.Background()
+	rsp, err := New().Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "|")
+
+	rsp, err = New().Query(dns.WithFlags(ctx, dns.Flags{CD: true, DO: true}), "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "1|1")
+
+	_, err = New().Query(dns.WithFlags(ctx, dns.Flags{NoRD: true}), "likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+}
+
+func TestConcurrent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/dns-json")
+		fmt.Fprint(w, `{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`)
+	}))
+	defer ts.Close()
+
+	upstream := Upstream[DefaultProvides]
+	Upstream[DefaultProvides] = ts.URL
+	defer func() {
+		Upstream[DefaultProvides] = upstream
+	}()
+
+	c := New()
+
+	ctx := context.Background()
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for j := 0; j < 10; j++ {
+				_ = c.SetFormat(dns.FormatJSON)
+				_ = c.SetProvides(DefaultProvides)
+			}
+		}()
+	}
+
+	for i := 0; i < 4; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for j := 0; j < 10; j++ {
+				rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+				assert.Nil(t, err)
+				assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+			}
+		}()
+	}
+
+	for i := 0; i < 8; i++ {
+		<-done
+	}
+}
+
+func TestSetParsing(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"Status":0,"Comment":"x","Answer":[{"name":"likexian.com.","type":1,"TTL":"300","data":"1.1.1.1"}]}`)
+	}))
+	defer ts.Close()
+
+	upstream := Upstream[DefaultProvides]
+	Upstream[DefaultProvides] = ts.URL
+	defer func() {
+		Upstream[DefaultProvides] = upstream
+	}()
+
+	ctx := context.Background()
+	c := New()
+	assert.Nil(t, c.SetFormat(dns.FormatJSON))
+
+	_, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, c.SetParsing(dns.ParsingStrict))
+	_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Answer.0.TTL")
+
+	assert.Nil(t, c.SetParsing(dns.ParsingLenient))
+	rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].TTL, 300)
+
+	assert.NotNil(t, c.SetParsing(dns.Parsing(-1)))
+	assert.NotNil(t, c.SetParsing(dns.Parsing(3)))
+	assert.Equal(t, c.parsing, dns.ParsingLenient)
+}
+
+func TestDialect(t *testing.T) {
+	body := `{"Status":0,"TC":false,"RD":true,"RA":true,"AD":false,"CD":false,
+		"Question":[{"name":"likexian.com.","type":1}],
+		"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}],
+		"Additional":[],"edns_client_subnet":"1.2.3.0/24/0","Comment":"Response from 1.1.1.1."}`
+
+	for _, p := range []dns.Parsing{dns.ParsingDefault, dns.ParsingStrict, dns.ParsingLenient} {
+		rsp, err := dialect.DecodeReader(dns.ContentTypeJSON, strings.NewReader(body), p)
+		assert.Nil(t, err)
+		assert.Equal(t, rsp.ECS, dns.ECS("1.2.3.0/24"))
+		assert.Equal(t, rsp.Comment, "Response from 1.1.1.1.")
+		assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+	}
+
+	_, err := dialect.DecodeReader(dns.ContentTypeJSON, strings.NewReader(`{"Status":0,"edns_client_subnet":"x"}`),
+		dns.ParsingDefault)
+	assert.NotNil(t, err)
+}
+
+func TestTruncated(t *testing.T) {
+	full := &dns.Response{RD: true, RA: true, Question: []dns.Question{{Name: "likexian.com.", Type: 16}},
+		Answer: []dns.Answer{{Name: "likexian.com.", Type: 16, TTL: 300, Data: `"a"`},
+			{Name: "likexian.com.", Type: 16, TTL: 300, Data: `"b"`}}}
+	msg, err := full.Pack(0)
+	assert.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ct") == dns.ContentTypeMessage {
+			if r.URL.Query().Get("fail") != "" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", dns.ContentTypeMessage)
+			_, _ = w.Write(msg)
+			return
+		}
+		fmt.Fprint(w, `{"Status":0,"TC":true,"Answer":[{"name":"likexian.com.","type":16,"TTL":300,"data":"\"a\""}]}`)
+	}))
+	defer ts.Close()
+
+	upstream := Upstream[DefaultProvides]
+	Upstream[DefaultProvides] = ts.URL
+	defer func() {
+		Upstream[DefaultProvides] = upstream
+	}()
+
+	ctx := context.Background()
+	c := New()
+	assert.Nil(t, c.SetFormat(dns.FormatJSON))
+
+	rsp, err := c.Query(ctx, "likexian.com", dns.TypeTXT)
+	assert.Nil(t, err)
+	assert.False(t, rsp.TC)
+	assert.True(t, rsp.Metadata.Truncated)
+	assert.Equal(t, len(rsp.Answer), 2)
+
+	Upstream[DefaultProvides] = ts.URL + "?fail=1"
+	c = New()
+	assert.Nil(t, c.SetFormat(dns.FormatJSON))
+
+	rsp, err = c.Query(ctx, "likexian.com", dns.TypeTXT)
+	assert.Nil(t, err)
+	assert.True(t, rsp.TC)
+	assert.True(t, rsp.Metadata.Truncated)
+	assert.Equal(t, len(rsp.Answer), 1)
+}
@@ -21,6 +21,11 @@ package quad9
 
 import (
 	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -39,6 +44,15 @@ func TestString(t *testing.T) {
 	assert.Equal(t, c.String(), "quad9")
 }
 
+func TestCapabilities(t *testing.T) {
+	c := New().Capabilities()
+	assert.True(t, c.SupportsType(dns.TypeAAAA))
+	assert.True(t, c.SupportsFormat(dns.FormatMessage))
+	assert.True(t, c.ECS)
+	assert.True(t, c.Flags)
+	assert.True(t, c.NoRD)
+}
+
 func TestQuery(t *testing.T) {
 	c := New()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -80,10 +94,12 @@ func TestECSQuery(t *testing.T) {
 	assert.Gt(t, len(rsp.Answer), 0)
 
 	Upstream[DefaultProvides] = "test"
+	c = New()
 	_, err = c.ECSQuery(ctx, "likexian.com", dns.TypeA, "")
 	assert.NotNil(t, err)
 
 	Upstream[DefaultProvides] = "https://dns.quad9.net/dns"
+	c = New()
 	_, err = c.ECSQuery(ctx, "likexian.com", dns.TypeA, "")
 	assert.NotNil(t, err)
 
@@ -94,3 +110,137 @@ func TestECSQuery(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Gt(t, len(rsp.Answer), 0)
 }
+
+func TestUpstream(t *testing.T) {
+	c := New()
+	assert.Equal(t, c.upstream, Upstream[DefaultProvides])
+
+	upstream := Upstream[SecuredProvides]
+	Upstream[SecuredProvides] = "https://dns.example/dns-query"
+	defer func() {
+		Upstream[SecuredProvides] = upstream
+	}()
+
+	assert.Nil(t, c.SetProvides(SecuredProvides))
+	assert.Equal(t, c.upstream, "https://dns.example/dns-query")
+
+	Upstream[SecuredProvides] = upstream
+	assert.Equal(t, c.upstream, "https://dns.example/dns-query")
+}
+
+func TestSetParsing(t *testing.T) {
+	c := New()
+	assert.Equal(t, c.parsing, dns.ParsingDefault)
+
+	assert.Nil(t, c.SetParsing(dns.ParsingStrict))
+	assert.Equal(t, c.parsing, dns.ParsingStrict)
+
+	assert.NotNil(t, c.SetParsing(dns.Parsing(-1)))
+	assert.NotNil(t, c.SetParsing(dns.Parsing(3)))
+	assert.Equal(t, c.parsing, dns.ParsingStrict)
+}
+
+func TestDialect(t *testing.T) {
+	body := `{"Status":0,"TC":false,"RD":true,"RA":true,"AD":true,"CD":false,
+		"Question":[{"name":"likexian.com.","type":28}],
+		"Answer":[{"name":"likexian.com.","type":28,"TTL":300,"data":"2001::1"}],
+		"Comment":["a","b"],"edns_client_subnet":"2001:db8::/56/0"}`
+
+	for _, p := range []dns.Parsing{dns.ParsingDefault, dns.ParsingStrict, dns.ParsingLenient} {
+		rsp, err := dialect.DecodeReader(dns.ContentTypeJSON, strings.NewReader(body), p)
+		assert.Nil(t, err)
+		assert.True(t, rsp.AD)
+		assert.Equal(t, rsp.Comment, "a; b")
+		assert.Equal(t, rsp.ECS, dns.ECS("2001:db8::/56"))
+	}
+}
+
+func TestFlags(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("dns") == "" {
+			fmt.Fprint(w, `{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"json"}]}`)
+			return
+		}
+		b, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		assert.Nil(t, err)
+		q, err := dns.ParseQuery(b)
+		assert.Nil(t, err)
+		fmt.Fprintf(w, `{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"%v|%v"}]}`,
+			q.Flags.CD, q.Flags.NoRD)
+	}))
+	defer ts.Close()
+
+	upstream := Upstream[DefaultProvides]
+	Upstream[DefaultProvides] = ts.URL
+	defer func() {
+		Upstream[DefaultProvides] = upstream
+	}()
+
+	ctx := context.Background()
+	c := New()
+	assert.Nil(t, c.SetFormat(dns.FormatJSON))
+
+	rsp, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "json")
+
+	rsp, err = c.Query(dns.WithFlags(ctx, dns.Flags{CD: true}), "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "true|false")
+
+	rsp, err = c.Query(dns.WithFlags(ctx, dns.Flags{NoRD: true}), "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "false|true")
+}
+
+func TestTruncated(t *testing.T) {
+	full := &dns.Response{RD: true, RA: true, Question: []dns.Question{{Name: "likexian.com.", Type: 16}},
+		Answer: []dns.Answer{{Name: "likexian.com.", Type: 16, TTL: 300, Data: `"a"`},
+			{Name: "likexian.com.", Type: 16, TTL: 300, Data: `"b"`}}}
+	msg, err := full.Pack(0)
+	assert.Nil(t, err)
+
+	posted := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			posted++
+			if r.URL.Query().Get("fail") != "" || r.Header.Get("Content-Type") != dns.ContentTypeMessage {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", dns.ContentTypeMessage)
+			_, _ = w.Write(msg)
+			return
+		}
+		fmt.Fprint(w, `{"Status":0,"TC":true,"Answer":[{"name":"likexian.com.","type":16,"TTL":300,"data":"\"a\""}]}`)
+	}))
+	defer ts.Close()
+
+	upstream := Upstream[DefaultProvides]
+	Upstream[DefaultProvides] = ts.URL
+	defer func() {
+		Upstream[DefaultProvides] = upstream
+	}()
+
+	ctx := context.Background()
+	c := New()
+	assert.Nil(t, c.SetFormat(dns.FormatJSON))
+
+	rsp, err := c.Query(ctx, "likexian.com", dns.TypeTXT)
+	assert.Nil(t, err)
+	assert.False(t, rsp.TC)
+	assert.True(t, rsp.Metadata.Truncated)
+	assert.Equal(t, len(rsp.Answer), 2)
+	assert.Equal(t, posted, 1)
+
+	Upstream[DefaultProvides] = ts.URL + "?fail=1"
+	c = New()
+	assert.Nil(t, c.SetFormat(dns.FormatJSON))
+
+	rsp, err = c.Query(ctx, "likexian.com", dns.TypeTXT)
+	assert.Nil(t, err)
+	assert.True(t, rsp.TC)
+	assert.True(t, rsp.Metadata.Truncated)
+	assert.Equal(t, len(rsp.Answer), 1)
+	assert.Equal(t, posted, 2)
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package proxy
+
+import (
+	"net/netip"
+	"sort"
+)
+
+// policy is the resolver of client networks
+type policy struct {
+	network  netip.Prefix
+	resolver Resolver
+}
+
+// SetACL set the client networks allowed to query, the others are answered REFUSED, no networks to allow all
+func (s *Server) SetACL(networks ...netip.Prefix) *Server {
+	acl := []netip.Prefix{}
+	for _, v := range networks {
+		acl = append(acl, v.Masked())
+	}
+
+	s.Lock()
+	s.acl = acl
+	s.Unlock()
+
+	return s
+}
+
+// SetPolicy set the resolver of client networks instead of the default one, the longest matching network wins,
+// and nil resolver to remove the networks
+func (s *Server) SetPolicy(r Resolver, networks ...netip.Prefix) *Server {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, n := range networks {
+		n = n.Masked()
+		ps := []policy{}
+		for _, v := range s.policies {
+			if v.network != n {
+				ps = append(ps, v)
+			}
+		}
+		if r != nil {
+			ps = append(ps, policy{network: n, resolver: r})
+		}
+		s.policies = ps
+	}
+
+	sort.SliceStable(s.policies, func(i, j int) bool {
+		return s.policies[i].network.Bits() > s.policies[j].network.Bits()
+	})
+
+	return s
+}
+
+// allowed returns whether the client address is allowed by acl, the unknown address is not allowed if acl is set
+func (s *Server) allowed(addr netip.Addr) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	if len(s.acl) == 0 {
+		return true
+	}
+
+	for _, v := range s.acl {
+		if v.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolverOf returns the resolver of client address
+func (s *Server) resolverOf(addr netip.Addr) Resolver {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, v := range s.policies {
+		if v.network.Contains(addr) {
+			return v.resolver
+		}
+	}
+
+	return s.resolver
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package proxy
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/server"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestSetACL(t *testing.T) {
+	s := New(testResolver).SetACL(netip.MustParsePrefix("192.168.1.1/24"), netip.MustParsePrefix("2001:db8::/32"))
+
+	q, err := dns.NewQuery("likexian.com", dns.TypeA, "", dns.Flags{})
+	assert.Nil(t, err)
+
+	status := func(addr string) int {
+		ctx := context.Background()
+		if addr != "" {
+			ctx = dns.WithClientAddr(ctx, netip.MustParseAddr(addr))
+		}
+		b, err := s.Handle(ctx, q)
+		assert.Nil(t, err)
+		rsp, err := dns.ParseMessage(b)
+		assert.Nil(t, err)
+		return rsp.Status
+	}
+
+	assert.Equal(t, status("192.168.1.2"), 0)
+	assert.Equal(t, status("::ffff:192.168.1.2"), 0)
+	assert.Equal(t, status("2001:db8::1"), 0)
+	assert.Equal(t, status("192.168.2.2"), 5)
+	assert.Equal(t, status(""), 5)
+
+	s.SetACL()
+	assert.Equal(t, status("192.168.2.2"), 0)
+	assert.Equal(t, status(""), 0)
+}
+
+func TestSetPolicy(t *testing.T) {
+	resolver := func(name string) Resolver {
+		return resolverFunc(func(ctx context.Context, d dns.Domain, t dns.Type, e dns.ECS) (*dns.Response, error) {
+			return &dns.Response{Answer: []dns.Answer{{Name: string(d) + ".", Type: 16, TTL: 60, Data: name}}}, nil
+		})
+	}
+
+	s := New(resolver("default")).
+		SetPolicy(resolver("lan"), netip.MustParsePrefix("192.168.0.0/16")).
+		SetPolicy(resolver("kids"), netip.MustParsePrefix("192.168.2.0/24"), netip.MustParsePrefix("10.0.0.1/32"))
+
+	assert.Equal(t, len(s.policies), 3)
+	assert.Equal(t, s.policies[0].network.Bits(), 32)
+	assert.Equal(t, s.policies[2].network.Bits(), 16)
+
+	query := func(addr string) Resolver {
+		return s.resolverOf(netip.MustParseAddr(addr))
+	}
+
+	name := func(r Resolver) string {
+		rsp, err := r.ECSQuery(context.Background(), "likexian.com", dns.TypeTXT, "")
+		assert.Nil(t, err)
+		return rsp.Answer[0].Data
+	}
+
+	assert.Equal(t, name(query("192.168.1.2")), "lan")
+	assert.Equal(t, name(query("192.168.2.2")), "kids")
+	assert.Equal(t, name(query("10.0.0.1")), "kids")
+	assert.Equal(t, name(query("10.0.0.2")), "default")
+	assert.Equal(t, name(s.resolverOf(netip.Addr{})), "default")
+
+	s.SetPolicy(resolver("guest"), netip.MustParsePrefix("192.168.2.0/24"))
+	assert.Equal(t, len(s.policies), 3)
+	assert.Equal(t, name(query("192.168.2.2")), "guest")
+
+	s.SetPolicy(nil, netip.MustParsePrefix("192.168.2.0/24"))
+	assert.Equal(t, name(query("192.168.2.2")), "lan")
+}
+
+func TestACLOverDoH(t *testing.T) {
+	s := New(testResolver).SetACL(netip.MustParsePrefix("192.168.1.1/24"))
+
+	q, err := dns.NewQuery("likexian.com", dns.TypeA, "", dns.Flags{})
+	assert.Nil(t, err)
+
+	serve := func(addr, target string) *http.Response {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		server.New(s).ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	status := func(addr string) int {
+		rsp := serve(addr, "/dns-query?dns="+base64.RawURLEncoding.EncodeToString(q))
+		assert.Equal(t, rsp.StatusCode, http.StatusOK)
+		b, err := io.ReadAll(rsp.Body)
+		assert.Nil(t, err)
+		m, err := dns.ParseMessage(b)
+		assert.Nil(t, err)
+		return m.Status
+	}
+
+	assert.Equal(t, status("192.168.1.2:53000"), 0)
+	assert.Equal(t, status("192.168.2.2:53000"), 5)
+
+	rsp := serve("192.168.2.2:53000", "/resolve?name=likexian.com&type=A")
+	b, err := io.ReadAll(rsp.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), `"Status":5`)
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/ideatocode/doh-go/cache"
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// DefaultCacheTTL is the cache ttl of forwarded responses without answers
+const DefaultCacheTTL = 30 * time.Second
+
+// SetCache set the cache of responses resolved by the forwarding rules, nil to disable,
+// the client resolvers are expected to have their own cache, the cache is not closed by the server
+func (s *Server) SetCache(c cache.Cache) *Server {
+	s.Lock()
+	s.cache = c
+	s.Unlock()
+
+	return s
+}
+
+// FlushCache flushes the cache of forwarded responses of names, all if no names
+func (s *Server) FlushCache(names ...dns.Domain) *Server {
+	s.RLock()
+	rc := s.cache
+	s.RUnlock()
+
+	if rc == nil {
+		return s
+	}
+
+	if len(names) == 0 {
+		_ = rc.Flush(context.Background())
+		return s
+	}
+
+	for _, d := range names {
+		zone, r := s.forwardOf(d)
+		if r == nil {
+			continue
+		}
+		for _, t := range cache.FlushTypes {
+			_ = rc.Delete(context.Background(), "forward:"+zone+":"+cache.Key(d, t, "", dns.Flags{}))
+		}
+	}
+
+	return s
+}
+
+// forward do query with the resolver of forwarding zone, the successful responses are cached
+func (s *Server) forward(ctx context.Context, zone string, r Resolver, q *dns.Query) (*dns.Response, error) {
+	s.RLock()
+	rc := s.cache
+	s.RUnlock()
+
+	if rc == nil {
+		return r.ECSQuery(ctx, q.Name, q.Type, q.ECS)
+	}
+
+	key := "forward:" + zone + ":" + cache.Key(q.Name, q.Type, q.ECS, q.Flags)
+	if rsp, _, ok := rc.Get(ctx, key); ok {
+		return rsp, nil
+	}
+
+	rsp, err := r.ECSQuery(ctx, q.Name, q.Type, q.ECS)
+	if err != nil {
+		return rsp, err
+	}
+
+	ttl := DefaultCacheTTL
+	if len(rsp.Answer) > 0 {
+		ttl = time.Duration(rsp.Answer[0].TTL) * time.Second
+	}
+	_ = rc.Set(ctx, key, rsp, ttl)
+
+	return rsp, nil
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/ideatocode/doh-go/cache"
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestSetCache(t *testing.T) {
+	forwarded, resolved := 0, 0
+	s := New(resolverFunc(func(ctx context.Context, d dns.Domain, t dns.Type, e dns.ECS) (*dns.Response, error) {
+		resolved++
+		return &dns.Response{Answer: []dns.Answer{{Name: string(d) + ".", Type: 1, TTL: 60, Data: "1.1.1.1"}}}, nil
+	})).AddForward("corp.example", resolverFunc(func(ctx context.Context, d dns.Domain, t dns.Type,
+		e dns.ECS) (*dns.Response, error) {
+		forwarded++
+		if d == "nx.corp.example" {
+			return &dns.Response{Status: 3}, errors.New("doh: proxy: failed response code 3")
+		}
+		return &dns.Response{Answer: []dns.Answer{{Name: string(d) + ".", Type: 1, TTL: 60, Data: "10.0.0.1"}}}, nil
+	}))
+
+	c := cache.NewMemory()
+	defer c.Close()
+	s.SetCache(c)
+
+	query := func(name string) *dns.Response {
+		q, err := dns.NewQuery(name, dns.TypeA, "", dns.Flags{})
+		assert.Nil(t, err)
+		binary.BigEndian.PutUint16(q, 1)
+		b, err := s.Handle(context.Background(), q)
+		assert.Nil(t, err)
+		rsp, err := dns.ParseMessage(b)
+		assert.Nil(t, err)
+		return rsp
+	}
+
+	for i := 0; i < 3; i++ {
+		rsp := query("nas.corp.example")
+		assert.Equal(t, rsp.Answer[0].Data, "10.0.0.1")
+		query("likexian.com")
+	}
+	assert.Equal(t, forwarded, 1)
+	assert.Equal(t, resolved, 3)
+	assert.Equal(t, c.Len(), 1)
+
+	query("nx.corp.example")
+	query("nx.corp.example")
+	assert.Equal(t, forwarded, 3)
+
+	s.FlushCache("likexian.com", "nas.corp.example")
+	assert.Equal(t, c.Len(), 0)
+	query("nas.corp.example")
+	assert.Equal(t, forwarded, 4)
+	assert.Equal(t, c.Len(), 1)
+
+	s.FlushCache()
+	assert.Equal(t, c.Len(), 0)
+
+	s.SetCache(nil).FlushCache()
+	query("nas.corp.example")
+	assert.Equal(t, forwarded, 5)
+}
@@ -0,0 +1,292 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// DefaultForwardTimeout is the default timeout of querying a plain dns server
+const DefaultForwardTimeout = 2 * time.Second
+
+// Forwarder is a resolver querying plain dns servers in order, for example the internal dns server of a zone,
+// the query is retried over tcp if the udp reply is truncated
+type Forwarder struct {
+	servers []string
+	timeout time.Duration
+	rand    *rand.Rand
+	sync.RWMutex
+}
+
+// NewForwarder returns a new forwarder of plain dns servers, a server is an ip address with optional port,
+// for example: 10.0.0.53 or [fd00::53]:5353
+func NewForwarder(servers ...string) (*Forwarder, error) {
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("doh: proxy: no forward server specified")
+	}
+
+	ss := []string{}
+	for _, v := range servers {
+		addr, err := ParseServer(v)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, addr)
+	}
+
+	return &Forwarder{
+		servers: ss,
+		timeout: DefaultForwardTimeout,
+	}, nil
+}
+
+// ParseServer returns the ip:port address of plain dns server, the port is 53 if not specified
+func ParseServer(server string) (string, error) {
+	server = strings.TrimSpace(server)
+	if addr, err := netip.ParseAddr(strings.Trim(server, "[]")); err == nil {
+		return netip.AddrPortFrom(addr.Unmap(), 53).String(), nil
+	}
+
+	addr, err := netip.ParseAddrPort(server)
+	if err != nil {
+		return "", fmt.Errorf("doh: proxy: invalid forward server: %s", server)
+	}
+
+	return netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port()).String(), nil
+}
+
+// SetTimeout set the timeout of querying a server, the next server is queried if it is exceeded
+func (f *Forwarder) SetTimeout(timeout time.Duration) *Forwarder {
+	if timeout <= 0 {
+		timeout = DefaultForwardTimeout
+	}
+
+	f.Lock()
+	f.timeout = timeout
+	f.Unlock()
+
+	return f
+}
+
+// SetRand set the source of the query message ids, for example a seeded one to reproduce the queries,
+// nil to use the global source
+func (f *Forwarder) SetRand(r *rand.Rand) *Forwarder {
+	f.Lock()
+	f.rand = r
+	f.Unlock()
+
+	return f
+}
+
+// id returns a random query message id
+func (f *Forwarder) id() uint16 {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.rand == nil {
+		return uint16(rand.Uint32())
+	}
+
+	return uint16(f.rand.Uint32())
+}
+
+// String returns the servers of forwarder
+func (f *Forwarder) String() string {
+	return strings.Join(f.servers, ",")
+}
+
+// ECSQuery do plain dns query with the edns0-client-subnet option, the next server is queried if one fails
+// without a response, and the response of failed rcode is returned with an error
+func (f *Forwarder) ECSQuery(ctx context.Context, d dns.Domain, t dns.Type, s dns.ECS) (*dns.Response, error) {
+	name, err := d.Punycode()
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := dns.NewQuery(name, t, s, dns.FlagsOf(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	f.RLock()
+	timeout := f.timeout
+	f.RUnlock()
+
+	for _, v := range f.servers {
+		binary.BigEndian.PutUint16(msg, f.id())
+
+		var rsp *dns.Response
+		rsp, err = f.exchange(ctx, "udp", v, msg, timeout)
+		if err == nil && rsp.TC {
+			rsp, err = f.exchange(ctx, "tcp", v, msg, timeout)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		rsp.Provider = v
+		if rsp.Status != 0 {
+			return rsp, fmt.Errorf("doh: proxy: failed response code %d", rsp.Status)
+		}
+
+		return rsp, nil
+	}
+
+	return nil, err
+}
+
+// exchange sends the query to server, and returns the response of the same id
+func (f *Forwarder) exchange(ctx context.Context, network, server string, msg []byte,
+	timeout time.Duration) (*dns.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	// close the connection once the ctx is canceled
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	id := binary.BigEndian.Uint16(msg)
+	if network == "tcp" {
+		b := make([]byte, 2+len(msg))
+		binary.BigEndian.PutUint16(b, uint16(len(msg)))
+		copy(b[2:], msg)
+		if _, err = conn.Write(b); err != nil {
+			return nil, err
+		}
+		if _, err = io.ReadFull(conn, b[:2]); err != nil {
+			return nil, err
+		}
+		b = make([]byte, binary.BigEndian.Uint16(b[:2]))
+		if _, err = io.ReadFull(conn, b); err != nil {
+			return nil, err
+		}
+		if len(b) < 2 || binary.BigEndian.Uint16(b) != id {
+			return nil, fmt.Errorf("doh: proxy: mismatched reply id from %s", server)
+		}
+		return dns.ParseMessage(b)
+	}
+
+	if _, err = conn.Write(msg); err != nil {
+		return nil, err
+	}
+
+	// the replies of other ids are ignored
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	b := *buf
+	for {
+		n, err := conn.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		if n >= 2 && binary.BigEndian.Uint16(b) == id {
+			return dns.ParseMessage(b[:n])
+		}
+	}
+}
+
+// AddForward add a forwarding rule resolving the names in zone with the resolver instead of the client and policy
+// ones, the longest matching zone wins, and nil resolver to remove the rule
+func (s *Server) AddForward(zone string, r Resolver) *Server {
+	zone = normalizeZone(zone)
+
+	s.Lock()
+	defer s.Unlock()
+
+	if r == nil {
+		delete(s.forwards, zone)
+	} else {
+		s.forwards[zone] = r
+	}
+
+	return s
+}
+
+// SetForwards set the forwarding rules of zones, it replaces the previous ones
+func (s *Server) SetForwards(forwards map[string]Resolver) *Server {
+	fs := map[string]Resolver{}
+	for k, v := range forwards {
+		if v != nil {
+			fs[normalizeZone(k)] = v
+		}
+	}
+
+	s.Lock()
+	s.forwards = fs
+	s.Unlock()
+
+	return s
+}
+
+// forwardOf returns the longest zone matching name and its resolver, nil if there is no rule
+func (s *Server) forwardOf(name dns.Domain) (string, Resolver) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if len(s.forwards) == 0 {
+		return "", nil
+	}
+
+	zone := normalizeZone(string(name))
+	for {
+		if r, ok := s.forwards[zone]; ok {
+			return zone, r
+		}
+		if zone == "" {
+			return "", nil
+		}
+		if i := strings.Index(zone, "."); i >= 0 {
+			zone = zone[i+1:]
+		} else {
+			zone = ""
+		}
+	}
+}
+
+// normalizeZone returns the lower case zone without the leading and trailing dots, empty for the root zone
+func normalizeZone(zone string) string {
+	return strings.Trim(strings.ToLower(strings.TrimSpace(zone)), ".")
+}
@@ -0,0 +1,236 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+// listenUpstream returns the address of a plain dns server of resolver, the udp replies are truncated if tc is true
+func listenUpstream(t *testing.T, r Resolver, tc bool) string {
+	s := New(r)
+	t.Cleanup(func() { s.Close() })
+
+	var pc net.PacketConn
+	var l net.Listener
+	for i := 0; i < 10 && l == nil; i++ {
+		var err error
+		pc, err = net.ListenPacket("udp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		l, err = net.Listen("tcp", pc.LocalAddr().String())
+		if err != nil {
+			pc.Close()
+		}
+	}
+
+	go func() { _ = s.ServeTCP(l) }()
+	if !tc {
+		go func() { _ = s.ServeUDP(pc) }()
+		return pc.LocalAddr().String()
+	}
+
+	go func() {
+		defer pc.Close()
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			q, err := dns.ParseQuery(buf[:n])
+			if err != nil {
+				continue
+			}
+			// a reply of other id is ignored by forwarder
+			b, _ := q.Response(0).Pack(q.ID + 1)
+			_, _ = pc.WriteTo(b, addr)
+			rsp := q.Response(0)
+			rsp.TC = true
+			b, _ = q.Reply(rsp, 0)
+			_, _ = pc.WriteTo(b, addr)
+		}
+	}()
+	t.Cleanup(func() { pc.Close() })
+
+	return pc.LocalAddr().String()
+}
+
+func TestParseServer(t *testing.T) {
+	tests := map[string]string{
+		"10.0.0.53":          "10.0.0.53:53",
+		" 10.0.0.53:5353 ":   "10.0.0.53:5353",
+		"fd00::53":           "[fd00::53]:53",
+		"[fd00::53]":         "[fd00::53]:53",
+		"[fd00::53]:5353":    "[fd00::53]:5353",
+		"[::ffff:10.0.0.1]":  "10.0.0.1:53",
+		"ns.corp.example":    "",
+		"10.0.0.53:xx":       "",
+		"ns.corp.example:53": "",
+	}
+
+	for k, v := range tests {
+		addr, err := ParseServer(k)
+		if v == "" {
+			assert.NotNil(t, err, k)
+		} else {
+			assert.Nil(t, err, k)
+			assert.Equal(t, addr, v, k)
+		}
+	}
+
+	_, err := NewForwarder()
+	assert.NotNil(t, err)
+	_, err = NewForwarder("10.0.0.53", "xx")
+	assert.NotNil(t, err)
+}
+
+func TestForwarder(t *testing.T) {
+	var mu sync.Mutex
+	var ecs dns.ECS
+	var flags dns.Flags
+	upstream := listenUpstream(t, resolverFunc(func(ctx context.Context, d dns.Domain, t dns.Type,
+		s dns.ECS) (*dns.Response, error) {
+		mu.Lock()
+		ecs, flags = s, dns.FlagsOf(ctx)
+		mu.Unlock()
+		return testResolver(ctx, d, t, s)
+	}), false)
+
+	// the closed port fails over to the next server
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	closed := pc.LocalAddr().String()
+	pc.Close()
+
+	f, err := NewForwarder(closed, upstream)
+	assert.Nil(t, err)
+	f.SetTimeout(time.Second).SetTimeout(0)
+	assert.Equal(t, f.String(), closed+","+upstream)
+
+	ctx := dns.WithFlags(context.Background(), dns.Flags{CD: true})
+	rsp, err := f.ECSQuery(ctx, "likexian.com", dns.TypeA, "1.2.3.4/24")
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Provider, upstream)
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+	mu.Lock()
+	assert.Equal(t, ecs, dns.ECS("1.2.3.0/24"))
+	assert.True(t, flags.CD)
+	mu.Unlock()
+
+	rsp, err = f.ECSQuery(ctx, "nx.likexian.com", dns.TypeA, "")
+	assert.NotNil(t, err)
+	assert.Equal(t, rsp.Status, 3)
+
+	rsp, err = f.ECSQuery(ctx, "likexian.com", dns.TypeMX, "")
+	assert.NotNil(t, err)
+	assert.Equal(t, rsp.Status, 2)
+
+	_, err = f.ECSQuery(ctx, "likexian.com", dns.Type("XX"), "")
+	assert.NotNil(t, err)
+
+	f, err = NewForwarder(closed)
+	assert.Nil(t, err)
+	_, err = f.ECSQuery(ctx, "likexian.com", dns.TypeA, "")
+	assert.NotNil(t, err)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = f.ECSQuery(cctx, "likexian.com", dns.TypeA, "")
+	assert.NotNil(t, err)
+}
+
+func TestForwarderRand(t *testing.T) {
+	a, err := NewForwarder("10.0.0.53")
+	assert.Nil(t, err)
+	b, err := NewForwarder("10.0.0.53")
+	assert.Nil(t, err)
+
+	a.SetRand(rand.New(rand.NewPCG(1, 2)))
+	b.SetRand(rand.New(rand.NewPCG(1, 2)))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, a.id(), b.id())
+	}
+
+	a.SetRand(nil)
+	_ = a.id()
+}
+
+func TestForwarderTCP(t *testing.T) {
+	f, err := NewForwarder(listenUpstream(t, testResolver, true))
+	assert.Nil(t, err)
+
+	rsp, err := f.ECSQuery(context.Background(), "likexian.com", dns.TypeA, "")
+	assert.Nil(t, err)
+	assert.False(t, rsp.TC)
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+}
+
+func TestAddForward(t *testing.T) {
+	resolver := func(name string) Resolver {
+		return resolverFunc(func(ctx context.Context, d dns.Domain, t dns.Type, e dns.ECS) (*dns.Response, error) {
+			return &dns.Response{Answer: []dns.Answer{{Name: string(d) + ".", Type: 16, TTL: 60, Data: name}}}, nil
+		})
+	}
+
+	s := New(resolver("default")).
+		AddForward("Corp.Example.", resolver("corp")).
+		AddForward("lab.corp.example", resolver("lab")).
+		AddForward("10.in-addr.arpa", resolver("reverse"))
+
+	query := func(name string) string {
+		q, err := dns.NewQuery(name, dns.TypeTXT, "", dns.Flags{})
+		assert.Nil(t, err)
+		binary.BigEndian.PutUint16(q, 1)
+		b, err := s.Handle(context.Background(), q)
+		assert.Nil(t, err)
+		rsp, err := dns.ParseMessage(b)
+		assert.Nil(t, err)
+		return rsp.Answer[0].Data
+	}
+
+	assert.Equal(t, query("nas.corp.example"), `"corp"`)
+	assert.Equal(t, query("corp.example"), `"corp"`)
+	assert.Equal(t, query("x.lab.corp.example"), `"lab"`)
+	assert.Equal(t, query("1.0.0.10.in-addr.arpa"), `"reverse"`)
+	assert.Equal(t, query("likexian.com"), `"default"`)
+	assert.Equal(t, query("xcorp.example"), `"default"`)
+
+	s.AddForward("corp.example", nil)
+	assert.Equal(t, query("nas.corp.example"), `"default"`)
+	assert.Equal(t, query("x.lab.corp.example"), `"lab"`)
+
+	s.AddForward(".", resolver("root"))
+	assert.Equal(t, query("likexian.com"), `"root"`)
+	assert.Equal(t, len(s.forwards), 3)
+
+	s.SetForwards(map[string]Resolver{"Corp.Example.": resolver("corp"), "lab.corp.example": nil})
+	assert.Equal(t, query("x.lab.corp.example"), `"corp"`)
+	assert.Equal(t, query("likexian.com"), `"default"`)
+	assert.Equal(t, len(s.forwards), 1)
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package proxy
+
+import (
+	"sync"
+)
+
+// messageSize is the max size of dns message
+const messageSize = 65535
+
+// bufferPool is the pool of message buffers, reusing them in the query path for less gc pressure
+var bufferPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, messageSize)
+		return &b
+	},
+}
+
+// getBuffer returns a message buffer of max size from pool, it must be put back by putBuffer after use
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+// putBuffer puts the message buffer back to pool, it must not be used after
+func putBuffer(b *[]byte) {
+	bufferPool.Put(b)
+}
@@ -0,0 +1,37 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package proxy
+
+import (
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestBufferPool(t *testing.T) {
+	b := getBuffer()
+	assert.Equal(t, len(*b), messageSize)
+	(*b)[0] = 1
+	putBuffer(b)
+
+	b = getBuffer()
+	assert.Equal(t, len(*b), messageSize)
+	putBuffer(b)
+}
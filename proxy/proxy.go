@@ -0,0 +1,560 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/ideatocode/doh-go/cache"
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// Resolver resolves the queries of proxy, for example a DoH client
+type Resolver interface {
+	ECSQuery(context.Context, dns.Domain, dns.Type, dns.ECS) (*dns.Response, error)
+}
+
+// Server is a dns server forwarding the plain dns queries to resolver
+type Server struct {
+	resolver    Resolver
+	acl         []netip.Prefix
+	policies    []policy
+	forwards    map[string]Resolver
+	limiter     *limiter
+	cache       cache.Cache
+	timeout     time.Duration
+	idleTimeout time.Duration
+	maxQueries  int
+	logger      *slog.Logger
+	closers     map[io.Closer]struct{}
+	closed      bool
+	wg          sync.WaitGroup
+	sync.RWMutex
+}
+
+// Default timeouts of server
+const (
+	// DefaultTimeout is the default timeout of resolving a query
+	DefaultTimeout = 5 * time.Second
+	// DefaultIdleTimeout is the default timeout of an idle tcp connection
+	DefaultIdleTimeout = 10 * time.Second
+)
+
+// DefaultMaxQueries is the default max udp queries in process of each connection
+const DefaultMaxQueries = 1024
+
+// ErrServerClosed is returned by the serve methods after the server is closed
+var ErrServerClosed = errors.New("doh: proxy: server closed")
+
+// Version returns package version
+func Version() string {
+	return "0.1.0"
+}
+
+// Author returns package author
+func Author() string {
+	return "[Li Kexian](https://www.likexian.com/)"
+}
+
+// License returns package license
+func License() string {
+	return "Licensed under the Apache License 2.0"
+}
+
+// New returns a new dns server forwarding queries to resolver
+func New(r Resolver) *Server {
+	return &Server{
+		resolver:    r,
+		timeout:     DefaultTimeout,
+		idleTimeout: DefaultIdleTimeout,
+		maxQueries:  DefaultMaxQueries,
+		forwards:    map[string]Resolver{},
+		closers:     map[io.Closer]struct{}{},
+	}
+}
+
+// SetTimeout set the timeout of resolving a query, SERVFAIL is answered if it is exceeded
+func (s *Server) SetTimeout(timeout time.Duration) *Server {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	s.Lock()
+	s.timeout = timeout
+	s.Unlock()
+
+	return s
+}
+
+// SetIdleTimeout set the timeout of an idle tcp connection
+func (s *Server) SetIdleTimeout(timeout time.Duration) *Server {
+	if timeout <= 0 {
+		timeout = DefaultIdleTimeout
+	}
+
+	s.Lock()
+	s.idleTimeout = timeout
+	s.Unlock()
+
+	return s
+}
+
+// SetMaxQueries set the max udp queries in process of each connection, the more are dropped without reply,
+// it is applied to the connections served after
+func (s *Server) SetMaxQueries(n int) *Server {
+	if n <= 0 {
+		n = DefaultMaxQueries
+	}
+
+	s.Lock()
+	s.maxQueries = n
+	s.Unlock()
+
+	return s
+}
+
+// SetLogger set the structured logger of server errors, nil to disable
+func (s *Server) SetLogger(l *slog.Logger) *Server {
+	s.Lock()
+	s.logger = l
+	s.Unlock()
+
+	return s
+}
+
+// ListenAndServe listens on the udp and tcp address, and serves queries until one of them fails
+func (s *Server) ListenAndServe(addr string) error {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		pc.Close()
+		return err
+	}
+
+	errc := make(chan error, 2)
+	go func() { errc <- s.ServeUDP(pc) }()
+	go func() { errc <- s.ServeTCP(l) }()
+
+	err = <-errc
+	pc.Close()
+	l.Close()
+	<-errc
+
+	return err
+}
+
+// ListenAndServeTLS listens on the tcp address, and serves dns over tls queries
+func (s *Server) ListenAndServeTLS(addr string, config *tls.Config) error {
+	if config == nil || (len(config.Certificates) == 0 && config.GetCertificate == nil) {
+		return fmt.Errorf("doh: proxy: tls certificate is required")
+	}
+
+	l, err := tls.Listen("tcp", addr, config)
+	if err != nil {
+		return err
+	}
+
+	return s.ServeTCP(l)
+}
+
+// ServeUDP serves queries from the udp connection, it is closed on return after the queries in process are replied,
+// the queries exceeding the max queries in process, see SetMaxQueries, are dropped without reply
+func (s *Server) ServeUDP(conn net.PacketConn) error {
+	if !s.track(conn) {
+		conn.Close()
+		return ErrServerClosed
+	}
+	defer s.untrack(conn)
+
+	s.RLock()
+	queries := make(chan struct{}, s.maxQueries)
+	s.RUnlock()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		buf := getBuffer()
+		n, addr, err := conn.ReadFrom(*buf)
+		if err != nil {
+			putBuffer(buf)
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		// the rate limit and acl are checked before a goroutine is started, so a flood costs no goroutine
+		ctx := withClient(context.Background(), addr)
+		client := dns.ClientAddr(ctx)
+		if s.limited(client) {
+			putBuffer(buf)
+			s.log(slog.LevelDebug, "doh: proxy: query dropped by rate limit", nil, nil,
+				slog.String("client", client.String()))
+			continue
+		}
+
+		if !s.allowed(client) {
+			s.reply(ctx, conn, addr, (*buf)[:n])
+			putBuffer(buf)
+			continue
+		}
+
+		select {
+		case queries <- struct{}{}:
+		default:
+			putBuffer(buf)
+			s.log(slog.LevelDebug, "doh: proxy: query dropped by max queries", nil, nil,
+				slog.String("client", client.String()))
+			continue
+		}
+
+		s.wg.Add(1)
+		wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer wg.Done()
+			defer func() { <-queries }()
+			defer putBuffer(buf)
+			s.reply(ctx, conn, addr, (*buf)[:n])
+		}()
+	}
+}
+
+// reply writes the reply of udp query to addr, the rate limit is checked already
+func (s *Server) reply(ctx context.Context, conn net.PacketConn, addr net.Addr, b []byte) {
+	r, err := s.answer(ctx, b, true, false)
+	if err != nil {
+		s.log(slog.LevelDebug, "doh: proxy: invalid query", addr, err)
+	}
+	if r == nil {
+		return
+	}
+	if _, err := conn.WriteTo(r, addr); err != nil {
+		s.log(slog.LevelDebug, "doh: proxy: write failed", addr, err)
+	}
+}
+
+// ServeTCP serves queries from the tcp listener, it is closed on return
+func (s *Server) ServeTCP(l net.Listener) error {
+	if !s.track(l) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer s.untrack(l)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(conn)
+			s.serveConn(conn)
+		}()
+	}
+}
+
+// serveConn serves the length prefixed queries of tcp connection until it is idle or closed
+func (s *Server) serveConn(conn net.Conn) {
+	s.RLock()
+	idle := s.idleTimeout
+	s.RUnlock()
+
+	pbuf := getBuffer()
+	defer putBuffer(pbuf)
+
+	for !s.isClosed() {
+		_ = conn.SetReadDeadline(time.Now().Add(idle))
+
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+
+		buf := (*pbuf)[:binary.BigEndian.Uint16(size[:])]
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+
+		b, err := s.handle(withClient(context.Background(), conn.RemoteAddr()), buf, false)
+		if err != nil {
+			s.log(slog.LevelDebug, "doh: proxy: invalid query", conn.RemoteAddr(), err)
+		}
+		if b == nil {
+			return
+		}
+
+		binary.BigEndian.PutUint16(size[:], uint16(len(b)))
+		bs := net.Buffers{size[:], b}
+		if _, err := bs.WriteTo(conn); err != nil {
+			return
+		}
+	}
+}
+
+// Handle returns the wire format reply of wire format query, the reply is a FORMERR if the query is invalid,
+// and nil if it can not be replied at all, the client address is taken from dns.ClientAddr of ctx
+func (s *Server) Handle(ctx context.Context, b []byte) ([]byte, error) {
+	return s.handle(ctx, b, false)
+}
+
+// ECSQuery returns the response of query by the acl, rate limit, policies and forwards of server, as the plain dns
+// queries, the client address is taken from dns.ClientAddr of ctx, it makes server the resolver of a DoH server
+func (s *Server) ECSQuery(ctx context.Context, d dns.Domain, t dns.Type, e dns.ECS) (*dns.Response, error) {
+	code, err := t.Code()
+	if err != nil {
+		return nil, err
+	}
+
+	q := &dns.Query{Name: d, Type: t, Code: code, ECS: e, Flags: dns.FlagsOf(ctx)}
+	addr := dns.ClientAddr(ctx)
+
+	return s.resolve(ctx, q, addr, s.limited(addr))
+}
+
+// handle returns the reply of query, it is truncated to the client udp payload size if udp is true
+func (s *Server) handle(ctx context.Context, b []byte, udp bool) ([]byte, error) {
+	return s.answer(ctx, b, udp, s.limited(dns.ClientAddr(ctx)))
+}
+
+// answer returns the reply of query as handle, of whether the client is rate limited
+func (s *Server) answer(ctx context.Context, b []byte, udp, limited bool) ([]byte, error) {
+	addr := dns.ClientAddr(ctx)
+	if limited && udp {
+		s.log(slog.LevelDebug, "doh: proxy: query dropped by rate limit", nil, nil, slog.String("client", addr.String()))
+		return nil, nil
+	}
+
+	q, err := dns.ParseQuery(b)
+	if err != nil {
+		if len(b) < 12 {
+			return nil, err
+		}
+		r, _ := (&dns.Response{Status: 1}).Pack(binary.BigEndian.Uint16(b))
+		return r, err
+	}
+
+	size := 0
+	if udp {
+		size = q.Size
+	}
+
+	rsp, err := s.resolve(ctx, q, addr, limited)
+	if rsp == nil {
+		s.log(slog.LevelWarn, "doh: proxy: query failed", nil, err, slog.String("name", string(q.Name)),
+			slog.String("type", string(q.Type)))
+		rsp = q.Response(2)
+	}
+
+	r, err := q.Reply(rsp, size)
+	if err != nil {
+		s.log(slog.LevelWarn, "doh: proxy: pack failed", nil, err, slog.String("name", string(q.Name)),
+			slog.String("type", string(q.Type)))
+		return q.Reply(q.Response(2), size)
+	}
+
+	return r, nil
+}
+
+// Close closes the listeners and connections, then waits for the queries in process
+func (s *Server) Close() error {
+	s.Lock()
+	s.closed = true
+	closers := s.closers
+	s.closers = map[io.Closer]struct{}{}
+	s.Unlock()
+
+	for v := range closers {
+		v.Close()
+	}
+
+	s.wg.Wait()
+
+	return nil
+}
+
+// Shutdown stops serving new queries, and waits for the queries in process to be replied until ctx is done,
+// then closes the server, the idle tcp connections are closed immediately
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.Lock()
+	s.closed = true
+	closers := []io.Closer{}
+	for v := range s.closers {
+		closers = append(closers, v)
+	}
+	s.Unlock()
+
+	// the listeners are closed, and the blocked reads are woken up, so that the replies can still be written
+	for _, v := range closers {
+		switch c := v.(type) {
+		case net.Listener:
+			c.Close()
+		case interface{ SetReadDeadline(time.Time) error }:
+			_ = c.SetReadDeadline(time.Now())
+		default:
+			c.Close()
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	s.Close()
+
+	return err
+}
+
+// track adds the closer to be closed by Close, returns false if the server is closed
+func (s *Server) track(c io.Closer) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	s.closers[c] = struct{}{}
+
+	return true
+}
+
+// untrack closes the closer and removes it
+func (s *Server) untrack(c io.Closer) {
+	s.Lock()
+	delete(s.closers, c)
+	s.Unlock()
+
+	c.Close()
+}
+
+// isClosed returns whether the server is closed
+func (s *Server) isClosed() bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.closed
+}
+
+// withClient returns a context with the client address of addr
+func withClient(ctx context.Context, addr net.Addr) context.Context {
+	if addr == nil {
+		return ctx
+	}
+
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return ctx
+	}
+
+	return dns.WithClientAddr(ctx, ap.Addr())
+}
+
+// log writes a record of client address and error if the logger is set
+func (s *Server) log(level slog.Level, msg string, addr net.Addr, err error, attrs ...slog.Attr) {
+	s.RLock()
+	l := s.logger
+	s.RUnlock()
+
+	if l == nil || !l.Enabled(context.Background(), level) {
+		return
+	}
+
+	if addr != nil {
+		attrs = append(attrs, slog.String("client", addr.String()))
+	}
+
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+
+	l.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+// resolve returns the response of query from client address, it is REFUSED if limited or not allowed by acl
+func (s *Server) resolve(ctx context.Context, q *dns.Query, addr netip.Addr, limited bool) (*dns.Response, error) {
+	if limited {
+		s.log(slog.LevelDebug, "doh: proxy: query refused by rate limit", nil, nil, slog.String("client", addr.String()),
+			slog.String("name", string(q.Name)), slog.String("type", string(q.Type)))
+		return q.Response(5), nil
+	}
+
+	if !s.allowed(addr) {
+		s.log(slog.LevelDebug, "doh: proxy: query refused", nil, nil, slog.String("client", addr.String()),
+			slog.String("name", string(q.Name)), slog.String("type", string(q.Type)))
+		return q.Response(5), nil
+	}
+
+	s.RLock()
+	timeout := s.timeout
+	s.RUnlock()
+
+	ctx, cancel := context.WithTimeout(dns.WithFlags(ctx, q.Flags), timeout)
+	defer cancel()
+
+	if zone, resolver := s.forwardOf(q.Name); resolver != nil {
+		return s.forward(ctx, zone, resolver, q)
+	}
+
+	return s.resolverOf(addr).ECSQuery(ctx, q.Name, q.Type, q.ECS)
+}
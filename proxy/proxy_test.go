@@ -0,0 +1,316 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+type resolverFunc func(context.Context, dns.Domain, dns.Type, dns.ECS) (*dns.Response, error)
+
+func (f resolverFunc) ECSQuery(ctx context.Context, d dns.Domain, t dns.Type, s dns.ECS) (*dns.Response, error) {
+	return f(ctx, d, t, s)
+}
+
+// testResolver answers 1.1.1.1 to A queries, NXDOMAIN to nx.likexian.com and fails others
+var testResolver = resolverFunc(func(ctx context.Context, d dns.Domain, t dns.Type, s dns.ECS) (*dns.Response, error) {
+	switch {
+	case d == "nx.likexian.com":
+		return &dns.Response{Status: 3}, fmt.Errorf("failed response code 3")
+	case t == dns.TypeA:
+		return &dns.Response{RD: true, RA: true, Answer: []dns.Answer{
+			{Name: string(d) + ".", Type: 1, TTL: 300, Data: "1.1.1.1"},
+		}}, nil
+	default:
+		return nil, fmt.Errorf("all query failed")
+	}
+})
+
+func TestVersion(t *testing.T) {
+	assert.Contains(t, Version(), ".")
+	assert.Contains(t, Author(), "likexian")
+	assert.Contains(t, License(), "Apache License")
+}
+
+func TestHandle(t *testing.T) {
+	var flags dns.Flags
+	var ecs dns.ECS
+	s := New(resolverFunc(func(ctx context.Context, d dns.Domain, t dns.Type, e dns.ECS) (*dns.Response, error) {
+		flags, ecs = dns.FlagsOf(ctx), e
+		return testResolver(ctx, d, t, e)
+	})).SetTimeout(0).SetIdleTimeout(0).SetLogger(nil)
+
+	ctx := context.Background()
+	query := func(name string, qtype dns.Type) *dns.Response {
+		q, err := dns.NewQuery(name, qtype, "1.2.3.4/24", dns.Flags{DO: true})
+		assert.Nil(t, err)
+		b, err := s.Handle(ctx, q)
+		assert.Nil(t, err)
+		rsp, err := dns.ParseMessage(b)
+		assert.Nil(t, err)
+		return rsp
+	}
+
+	rsp := query("likexian.com", dns.TypeA)
+	assert.Equal(t, rsp.Status, 0)
+	assert.Equal(t, rsp.Question, []dns.Question{{Name: "likexian.com.", Type: 1}})
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+	assert.Equal(t, flags, dns.Flags{DO: true})
+	assert.Equal(t, ecs, dns.ECS("1.2.3.0/24"))
+
+	rsp = query("nx.likexian.com", dns.TypeA)
+	assert.Equal(t, rsp.Status, 3)
+
+	rsp = query("likexian.com", dns.TypeMX)
+	assert.Equal(t, rsp.Status, 2)
+
+	b, err := s.Handle(ctx, []byte{0, 9, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	assert.NotNil(t, err)
+	assert.Equal(t, binary.BigEndian.Uint16(b), uint16(9))
+	rsp, err = dns.ParseMessage(b)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Status, 1)
+
+	b, err = s.Handle(ctx, []byte("xx"))
+	assert.NotNil(t, err)
+	assert.True(t, b == nil)
+}
+
+func TestServe(t *testing.T) {
+	s := New(testResolver)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	errc := make(chan error, 2)
+	go func() { errc <- s.ServeUDP(pc) }()
+	go func() { errc <- s.ServeTCP(l) }()
+
+	q, err := dns.NewQuery("likexian.com", dns.TypeA, "", dns.Flags{})
+	assert.Nil(t, err)
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+	_, err = conn.Write(q)
+	assert.Nil(t, err)
+	buf := make([]byte, 512)
+	n, err := conn.Read(buf)
+	assert.Nil(t, err)
+	rsp, err := dns.ParseMessage(buf[:n])
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+
+	conn, err = net.Dial("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+	for i := 0; i < 2; i++ {
+		_, err = conn.Write(append([]byte{0, byte(len(q))}, q...))
+		assert.Nil(t, err)
+		size := make([]byte, 2)
+		_, err = io.ReadFull(conn, size)
+		assert.Nil(t, err)
+		buf = make([]byte, binary.BigEndian.Uint16(size))
+		_, err = io.ReadFull(conn, buf)
+		assert.Nil(t, err)
+		rsp, err = dns.ParseMessage(buf)
+		assert.Nil(t, err)
+		assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+	}
+
+	assert.Nil(t, s.Close())
+	assert.Equal(t, <-errc, ErrServerClosed)
+	assert.Equal(t, <-errc, ErrServerClosed)
+
+	pc, err = net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	assert.Equal(t, s.ServeUDP(pc), ErrServerClosed)
+	assert.NotNil(t, s.ListenAndServe("127.0.0.1:xx"))
+	assert.NotNil(t, s.ListenAndServeTLS("127.0.0.1:0", nil))
+}
+
+func TestMaxQueries(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	s := New(resolverFunc(func(ctx context.Context, d dns.Domain, t dns.Type, e dns.ECS) (*dns.Response, error) {
+		calls.Add(1)
+		<-release
+		return testResolver(ctx, d, t, e)
+	})).SetMaxQueries(2)
+	defer s.Close()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go func() { _ = s.ServeUDP(pc) }()
+
+	q, err := dns.NewQuery("likexian.com", dns.TypeA, "", dns.Flags{})
+	assert.Nil(t, err)
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	for i := 0; i < 5; i++ {
+		_, err = conn.Write(q)
+		assert.Nil(t, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, calls.Load(), int32(2))
+	close(release)
+
+	buf := make([]byte, 512)
+	for i := 0; i < 2; i++ {
+		_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+		_, err = conn.Read(buf)
+		assert.Nil(t, err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err = conn.Read(buf)
+	assert.NotNil(t, err)
+
+	s.SetACL(netip.MustParsePrefix("10.0.0.0/8"))
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	_, err = conn.Write(q)
+	assert.Nil(t, err)
+	n, err := conn.Read(buf)
+	assert.Nil(t, err)
+	rsp, err := dns.ParseMessage(buf[:n])
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Status, 5)
+	assert.Equal(t, calls.Load(), int32(2))
+}
+
+func TestShutdown(t *testing.T) {
+	release := make(chan struct{})
+	s := New(resolverFunc(func(ctx context.Context, d dns.Domain, t dns.Type, e dns.ECS) (*dns.Response, error) {
+		<-release
+		return testResolver(ctx, d, t, e)
+	}))
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	errc := make(chan error, 2)
+	go func() { errc <- s.ServeUDP(pc) }()
+	go func() { errc <- s.ServeTCP(l) }()
+
+	q, err := dns.NewQuery("likexian.com", dns.TypeA, "", dns.Flags{})
+	assert.Nil(t, err)
+
+	uconn, err := net.Dial("udp", pc.LocalAddr().String())
+	assert.Nil(t, err)
+	defer uconn.Close()
+	_ = uconn.SetDeadline(time.Now().Add(2 * time.Second))
+	_, err = uconn.Write(q)
+	assert.Nil(t, err)
+
+	tconn, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	defer tconn.Close()
+	_ = tconn.SetDeadline(time.Now().Add(2 * time.Second))
+	_, err = tconn.Write(append([]byte{0, byte(len(q))}, q...))
+	assert.Nil(t, err)
+
+	idle, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	defer idle.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	done := make(chan error, 1)
+	go func() { done <- s.Shutdown(context.Background()) }()
+
+	time.Sleep(100 * time.Millisecond)
+	_, err = net.Dial("tcp", l.Addr().String())
+	assert.NotNil(t, err)
+	close(release)
+
+	buf := make([]byte, 512)
+	n, err := uconn.Read(buf)
+	assert.Nil(t, err)
+	rsp, err := dns.ParseMessage(buf[:n])
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+
+	size := make([]byte, 2)
+	_, err = io.ReadFull(tconn, size)
+	assert.Nil(t, err)
+	buf = make([]byte, binary.BigEndian.Uint16(size))
+	_, err = io.ReadFull(tconn, buf)
+	assert.Nil(t, err)
+	rsp, err = dns.ParseMessage(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+
+	assert.Nil(t, <-done)
+	assert.Equal(t, <-errc, ErrServerClosed)
+	assert.Equal(t, <-errc, ErrServerClosed)
+
+	_, err = tconn.Read(buf)
+	assert.NotNil(t, err)
+	_, err = idle.Read(buf)
+	assert.NotNil(t, err)
+
+	s = New(resolverFunc(func(ctx context.Context, d dns.Domain, t dns.Type, e dns.ECS) (*dns.Response, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})).SetTimeout(200 * time.Millisecond)
+	pc, err = net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go func() { errc <- s.ServeUDP(pc) }()
+
+	uconn, err = net.Dial("udp", pc.LocalAddr().String())
+	assert.Nil(t, err)
+	defer uconn.Close()
+	_, err = uconn.Write(q)
+	assert.Nil(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	assert.Equal(t, <-errc, ErrServerClosed)
+}
+
+func TestWithClient(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, dns.ClientAddr(withClient(ctx, &net.UDPAddr{IP: net.ParseIP("192.168.1.2"), Port: 53})).String(),
+		"192.168.1.2")
+	assert.Equal(t, dns.ClientAddr(withClient(ctx, &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 53})).String(),
+		"2001:db8::1")
+	assert.False(t, dns.ClientAddr(withClient(ctx, nil)).IsValid())
+	assert.False(t, dns.ClientAddr(withClient(ctx, &net.UnixAddr{Name: "x"})).IsValid())
+}
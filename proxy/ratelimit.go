@@ -0,0 +1,133 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package proxy
+
+import (
+	"math"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// limiter is the token buckets of clients, the IPv6 clients are limited by /64 networks
+type limiter struct {
+	rate    float64
+	burst   float64
+	buckets map[netip.Prefix]*bucket
+	swept   time.Time
+	sync.Mutex
+}
+
+// bucket is the tokens of a client
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// SetRateLimit set the max queries per second of each client ip with the burst, the udp queries exceeding it
+// are dropped without reply to avoid amplification, the tcp ones are answered REFUSED, and 0 rate to disable it.
+// The burst is the rate if 0
+func (s *Server) SetRateLimit(rate float64, burst int) *Server {
+	var l *limiter
+	if rate > 0 {
+		l = newLimiter(rate, burst)
+	}
+
+	s.Lock()
+	s.limiter = l
+	s.Unlock()
+
+	return s
+}
+
+// limited returns whether the client exceeds the rate limit, the unknown address is not limited
+func (s *Server) limited(addr netip.Addr) bool {
+	s.RLock()
+	l := s.limiter
+	s.RUnlock()
+
+	if l == nil || !addr.IsValid() {
+		return false
+	}
+
+	return !l.allow(addr, time.Now())
+}
+
+// newLimiter returns a new limiter of rate and burst
+func newLimiter(rate float64, burst int) *limiter {
+	b := float64(burst)
+	if burst <= 0 {
+		b = math.Max(1, math.Ceil(rate))
+	}
+
+	return &limiter{
+		rate:    rate,
+		burst:   b,
+		buckets: map[netip.Prefix]*bucket{},
+		swept:   time.Now(),
+	}
+}
+
+// allow takes a token of the client, returns false if there is no token
+func (l *limiter) allow(addr netip.Addr, now time.Time) bool {
+	addr = addr.Unmap()
+	bits := 32
+	if addr.Is6() {
+		bits = 64
+	}
+	key, _ := addr.Prefix(bits)
+
+	l.Lock()
+	defer l.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+
+	return true
+}
+
+// sweep removes the full buckets, at most once per the filling time of a bucket or a minute
+func (l *limiter) sweep(now time.Time) {
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.swept) < max(full, time.Minute) {
+		return
+	}
+
+	for k, v := range l.buckets {
+		if now.Sub(v.last) >= full {
+			delete(l.buckets, k)
+		}
+	}
+
+	l.swept = now
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package proxy
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(2, 3)
+	now := time.Now()
+	v4, v6 := netip.MustParseAddr("192.168.1.2"), netip.MustParseAddr("2001:db8::1")
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, l.allow(v4, now))
+	}
+	assert.False(t, l.allow(v4, now))
+	assert.False(t, l.allow(netip.MustParseAddr("::ffff:192.168.1.2"), now))
+	assert.True(t, l.allow(netip.MustParseAddr("192.168.1.3"), now))
+
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, l.allow(v4, now))
+	assert.False(t, l.allow(v4, now))
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, l.allow(v6, now))
+	}
+	assert.False(t, l.allow(netip.MustParseAddr("2001:db8::2"), now))
+	assert.True(t, l.allow(netip.MustParseAddr("2001:db8:0:1::1"), now))
+	assert.Equal(t, len(l.buckets), 4)
+
+	now = now.Add(time.Minute)
+	assert.True(t, l.allow(v4, now))
+	assert.Equal(t, len(l.buckets), 1)
+
+	l = newLimiter(0.5, 0)
+	assert.Equal(t, l.burst, 1.0)
+	assert.True(t, l.allow(v4, now))
+	assert.False(t, l.allow(v4, now.Add(time.Second)))
+	assert.True(t, l.allow(v4, now.Add(2*time.Second)))
+}
+
+func TestSetRateLimit(t *testing.T) {
+	s := New(testResolver).SetRateLimit(1, 2)
+
+	q, err := dns.NewQuery("likexian.com", dns.TypeA, "", dns.Flags{})
+	assert.Nil(t, err)
+
+	ctx := dns.WithClientAddr(context.Background(), netip.MustParseAddr("192.168.1.2"))
+	status := func(ctx context.Context, udp bool) int {
+		b, err := s.handle(ctx, q, udp)
+		assert.Nil(t, err)
+		if b == nil {
+			return -1
+		}
+		rsp, err := dns.ParseMessage(b)
+		assert.Nil(t, err)
+		return rsp.Status
+	}
+
+	assert.Equal(t, status(ctx, true), 0)
+	assert.Equal(t, status(ctx, false), 0)
+	assert.Equal(t, status(ctx, true), -1)
+	assert.Equal(t, status(ctx, false), 5)
+	assert.Equal(t, status(context.Background(), true), 0)
+
+	s.SetRateLimit(0, 0)
+	assert.Equal(t, status(ctx, true), 0)
+}
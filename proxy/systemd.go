@@ -0,0 +1,101 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation
+const listenFDsStart = 3
+
+// Socket is a socket passed by systemd socket activation
+type Socket struct {
+	// Name is the FileDescriptorName of socket unit, empty if not set
+	Name string
+	// Listener is the stream socket, nil if it is a datagram socket
+	Listener net.Listener
+	// PacketConn is the datagram socket, nil if it is a stream socket
+	PacketConn net.PacketConn
+}
+
+// SystemdSockets returns the sockets passed by systemd socket activation, nil if the process is not activated
+func SystemdSockets() ([]Socket, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+
+	fs := []*os.File{}
+	for i := listenFDsStart; i < listenFDsStart+n; i++ {
+		fs = append(fs, os.NewFile(uintptr(i), "LISTEN_FD_"+strconv.Itoa(i)))
+	}
+
+	return newSockets(fs, strings.Split(os.Getenv("LISTEN_FDNAMES"), ":"))
+}
+
+// newSockets returns the sockets of files and names, the files are closed
+func newSockets(fs []*os.File, names []string) ([]Socket, error) {
+	defer func() {
+		for _, f := range fs {
+			f.Close()
+		}
+	}()
+
+	ss := []Socket{}
+	for k, f := range fs {
+		s := Socket{}
+		if k < len(names) && names[k] != "unknown" {
+			s.Name = names[k]
+		}
+
+		if l, err := net.FileListener(f); err == nil {
+			s.Listener = l
+		} else if c, err := net.FilePacketConn(f); err == nil {
+			s.PacketConn = c
+		} else {
+			for _, v := range ss {
+				v.Close()
+			}
+			return nil, fmt.Errorf("doh: proxy: invalid socket %s: %w", f.Name(), err)
+		}
+
+		ss = append(ss, s)
+	}
+
+	return ss, nil
+}
+
+// Close closes the socket
+func (s Socket) Close() error {
+	if s.Listener != nil {
+		return s.Listener.Close()
+	}
+
+	return s.PacketConn.Close()
+}
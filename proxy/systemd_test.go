@@ -0,0 +1,78 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package proxy
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestSystemdSockets(t *testing.T) {
+	t.Setenv("LISTEN_PID", "")
+	t.Setenv("LISTEN_FDS", "1")
+	ss, err := SystemdSockets()
+	assert.Nil(t, err)
+	assert.Equal(t, len(ss), 0)
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "xx")
+	ss, err = SystemdSockets()
+	assert.Nil(t, err)
+	assert.Equal(t, len(ss), 0)
+}
+
+func TestNewSockets(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+	lf, err := l.(*net.TCPListener).File()
+	assert.Nil(t, err)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer pc.Close()
+	pf, err := pc.(*net.UDPConn).File()
+	assert.Nil(t, err)
+
+	ss, err := newSockets([]*os.File{lf, pf}, []string{"dns", "unknown"})
+	assert.Nil(t, err)
+	assert.Equal(t, len(ss), 2)
+	assert.Equal(t, ss[0].Name, "dns")
+	assert.Equal(t, ss[0].Listener.Addr().String(), l.Addr().String())
+	assert.True(t, ss[0].PacketConn == nil)
+	assert.Equal(t, ss[1].Name, "")
+	assert.Equal(t, ss[1].PacketConn.LocalAddr().String(), pc.LocalAddr().String())
+	assert.True(t, ss[1].Listener == nil)
+
+	for _, v := range ss {
+		assert.Nil(t, v.Close())
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "socket")
+	assert.Nil(t, err)
+	lf, err = l.(*net.TCPListener).File()
+	assert.Nil(t, err)
+	_, err = newSockets([]*os.File{lf, f}, nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// QueryLog is the log entry of a client query
+type QueryLog struct {
+	Time          time.Time     `json:"time"`
+	Client        string        `json:"client,omitempty"`
+	Name          string        `json:"name"`
+	Type          string        `json:"type"`
+	Provider      string        `json:"provider,omitempty"`
+	Rcode         int           `json:"rcode"`
+	Duration      time.Duration `json:"duration"`
+	Cached        bool          `json:"cached"`
+	Error         string        `json:"error,omitempty"`
+	CorrelationID string        `json:"correlation_id,omitempty"`
+}
+
+// QueryLogger is a sink of query logs, it must be concurrency safe
+type QueryLogger interface {
+	LogQuery(context.Context, *QueryLog)
+}
+
+// QueryLoggerFunc is a function as QueryLogger
+type QueryLoggerFunc func(context.Context, *QueryLog)
+
+// JSONQueryLogger writes query logs as JSON lines
+type JSONQueryLogger struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// TextQueryLogger writes query logs as human readable lines
+type TextQueryLogger struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// LogQuery calls f(ctx, l)
+func (f QueryLoggerFunc) LogQuery(ctx context.Context, l *QueryLog) {
+	f(ctx, l)
+}
+
+// SetQueryLogger set the sink of client query logs, nil to disable
+func (c *DoH) SetQueryLogger(l QueryLogger) *DoH {
+	c.Lock()
+	c.queryLogger = l
+	c.Unlock()
+
+	return c
+}
+
+// logQuery writes the query log if the query logger is set
+func (c *DoH) logQuery(ctx context.Context, start time.Time, d dns.Domain, t dns.Type, rsp *dns.Response,
+	cached bool, err error) {
+	c.RLock()
+	l := c.queryLogger
+	c.RUnlock()
+
+	if l == nil {
+		return
+	}
+
+	q := &QueryLog{
+		Time:          start,
+		Name:          string(d),
+		Type:          string(t),
+		Rcode:         -1,
+		Duration:      time.Since(start),
+		Cached:        cached,
+		CorrelationID: dns.CorrelationID(ctx),
+	}
+
+	if addr := dns.ClientAddr(ctx); addr.IsValid() {
+		q.Client = addr.String()
+	}
+
+	if rsp != nil {
+		q.Provider = rsp.Provider
+		q.Rcode = rsp.Status
+	}
+
+	if err != nil {
+		q.Error = err.Error()
+	}
+
+	l.LogQuery(ctx, q)
+}
+
+// NewJSONQueryLogger returns a new query logger writing JSON lines to w
+func NewJSONQueryLogger(w io.Writer) *JSONQueryLogger {
+	return &JSONQueryLogger{w: w}
+}
+
+// OpenJSONQueryLogger returns a new query logger appending JSON lines to file
+func OpenJSONQueryLogger(path string) (*JSONQueryLogger, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewJSONQueryLogger(f), nil
+}
+
+// LogQuery writes the query log as a JSON line
+func (j *JSONQueryLogger) LogQuery(ctx context.Context, l *QueryLog) {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return
+	}
+
+	j.mu.Lock()
+	_, _ = j.w.Write(append(b, '\n'))
+	j.mu.Unlock()
+}
+
+// Close closes the underlying writer if it is a closer
+func (j *JSONQueryLogger) Close() error {
+	if c, ok := j.w.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+// NewTextQueryLogger returns a new query logger writing human readable lines to w
+func NewTextQueryLogger(w io.Writer) *TextQueryLogger {
+	return &TextQueryLogger{w: w}
+}
+
+// Close closes the underlying writer if it is a closer
+func (t *TextQueryLogger) Close() error {
+	if c, ok := t.w.(io.Closer); ok && t.w != os.Stderr && t.w != os.Stdout {
+		return c.Close()
+	}
+
+	return nil
+}
+
+// NewStderrQueryLogger returns a new query logger writing human readable lines to stderr
+func NewStderrQueryLogger() *TextQueryLogger {
+	return NewTextQueryLogger(os.Stderr)
+}
+
+// LogQuery writes the query log as a human readable line
+func (t *TextQueryLogger) LogQuery(ctx context.Context, l *QueryLog) {
+	cache := "miss"
+	if l.Cached {
+		cache = "hit"
+	}
+
+	provider := l.Provider
+	if provider == "" {
+		provider = "-"
+	}
+
+	line := fmt.Sprintf("%s %s %s provider=%s rcode=%d duration=%s cache=%s", l.Time.Format(time.RFC3339),
+		l.Name, l.Type, provider, l.Rcode, l.Duration, cache)
+	if l.Client != "" {
+		line += " client=" + l.Client
+	}
+
+	if l.CorrelationID != "" {
+		line += fmt.Sprintf(" correlation_id=%q", l.CorrelationID)
+	}
+
+	if l.Error != "" {
+		line += fmt.Sprintf(" error=%q", l.Error)
+	}
+
+	t.mu.Lock()
+	fmt.Fprintln(t.w, line)
+	t.mu.Unlock()
+}
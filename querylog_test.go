@@ -0,0 +1,145 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestSetQueryLogger(t *testing.T) {
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		body := `{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`
+		if r.URL.Query().Get("name") == "nx.likexian.com" {
+			body = `{"Status":3}`
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})
+
+	logs := []*QueryLog{}
+	c := Use(GoogleProvider).SetRoundTripper(rt).EnableCache(true).
+		SetQueryLogger(QueryLoggerFunc(func(ctx context.Context, l *QueryLog) {
+			logs = append(logs, l)
+		}))
+	defer c.Close()
+
+	ctx := WithClientAddr(context.Background(), netip.MustParseAddr("192.168.1.2"))
+	_, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	rsp, err := c.Query(ctx, "nx.likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Equal(t, rsp.Status, 3)
+
+	assert.Equal(t, len(logs), 3)
+	assert.Equal(t, logs[0].Name, "likexian.com")
+	assert.Equal(t, logs[0].Type, "A")
+	assert.Equal(t, logs[0].Provider, "google")
+	assert.Equal(t, logs[0].Rcode, 0)
+	assert.Equal(t, logs[0].Client, "192.168.1.2")
+	assert.False(t, logs[0].Cached)
+	assert.True(t, logs[1].Cached)
+	assert.Equal(t, logs[2].Rcode, 3)
+	assert.Equal(t, logs[2].Error, "doh: all query failed")
+
+	c.SetQueryLogger(nil)
+	_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, len(logs), 3)
+}
+
+func TestJSONQueryLogger(t *testing.T) {
+	l := &QueryLog{
+		Time:     time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		Name:     "likexian.com",
+		Type:     "A",
+		Provider: "google",
+		Duration: time.Millisecond,
+	}
+
+	buf := &bytes.Buffer{}
+	j := NewJSONQueryLogger(buf)
+	j.LogQuery(context.Background(), l)
+	j.LogQuery(context.Background(), l)
+	assert.Nil(t, j.Close())
+	assert.Equal(t, strings.Count(buf.String(), "\n"), 2)
+
+	var v QueryLog
+	assert.Nil(t, json.Unmarshal([]byte(strings.Split(buf.String(), "\n")[0]), &v))
+	assert.Equal(t, v, *l)
+
+	path := filepath.Join(t.TempDir(), "query.log")
+	j, err := OpenJSONQueryLogger(path)
+	assert.Nil(t, err)
+	j.LogQuery(context.Background(), l)
+	assert.Nil(t, j.Close())
+
+	b, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), strings.Split(buf.String(), "\n")[0]+"\n")
+
+	_, err = OpenJSONQueryLogger(filepath.Join(path, "x"))
+	assert.NotNil(t, err)
+}
+
+func TestTextQueryLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	NewTextQueryLogger(buf).LogQuery(context.Background(), &QueryLog{
+		Time:     time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		Name:     "likexian.com",
+		Type:     "A",
+		Rcode:    -1,
+		Duration: time.Millisecond,
+		Cached:   false,
+		Client:   "192.168.1.2",
+		Error:    "doh: all query failed",
+	})
+	assert.Equal(t, buf.String(), "2019-01-01T00:00:00Z likexian.com A provider=- rcode=-1 duration=1ms cache=miss "+
+		"client=192.168.1.2 error=\"doh: all query failed\"\n")
+
+	path := filepath.Join(t.TempDir(), "query.log")
+	f, err := OpenRotatingFile(path)
+	assert.Nil(t, err)
+	l := NewTextQueryLogger(f)
+	l.LogQuery(context.Background(), &QueryLog{Name: "likexian.com", Type: "A"})
+	assert.Nil(t, l.Close())
+	b, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), "likexian.com A")
+
+	assert.NotNil(t, NewStderrQueryLogger())
+}
@@ -0,0 +1,281 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// dnsConn is a virtual dns server connection answering the queries written with the client
+type dnsConn struct {
+	c         *DoH
+	network   string
+	address   string
+	stream    bool
+	in        []byte
+	out       [][]byte
+	ready     chan struct{}
+	done      chan struct{}
+	closed    bool
+	rdeadline time.Time
+	wdeadline time.Time
+	sync.Mutex
+}
+
+// dnsPacketConn is the udp dnsConn, the net.Resolver reads and writes whole messages of packet connections
+type dnsPacketConn struct {
+	*dnsConn
+}
+
+// dnsAddr is the address of dnsConn
+type dnsAddr struct {
+	network string
+	address string
+}
+
+// NetResolver returns a net.Resolver resolving over the client, for example as the Resolver of net.Dialer,
+// so that the code using the standard library resolves over DoH transparently
+func (c *DoH) NetResolver() *net.Resolver {
+	return &net.Resolver{PreferGo: true, Dial: c.DialDNS}
+}
+
+// DialDNS returns a virtual dns server connection of network udp or tcp answering the queries with the client,
+// it is the Dial hook of net.Resolver, and the address is ignored
+func (c *DoH) DialDNS(ctx context.Context, network, address string) (net.Conn, error) {
+	conn := &dnsConn{
+		c:       c,
+		network: network,
+		address: address,
+		ready:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	switch {
+	case strings.HasPrefix(network, "udp"):
+		return dnsPacketConn{conn}, nil
+	case strings.HasPrefix(network, "tcp"):
+		conn.stream = true
+		return conn, nil
+	default:
+		return nil, fmt.Errorf("doh: not supported network: %s", network)
+	}
+}
+
+// Read reads the replies of queries, a stream reply has the length prefix and may be split over reads
+func (d *dnsConn) Read(b []byte) (int, error) {
+	for {
+		d.Lock()
+		if len(d.out) > 0 {
+			r := d.out[0]
+			n := copy(b, r)
+			if d.stream && n < len(r) {
+				d.out[0] = r[n:]
+			} else {
+				d.out = d.out[1:]
+			}
+			d.Unlock()
+			return n, nil
+		}
+		if d.closed {
+			d.Unlock()
+			return 0, net.ErrClosed
+		}
+		deadline := d.rdeadline
+		d.Unlock()
+
+		var timeout <-chan time.Time
+		var t *time.Timer
+		if !deadline.IsZero() {
+			t = time.NewTimer(time.Until(deadline))
+			timeout = t.C
+		}
+
+		select {
+		case <-d.ready:
+		case <-d.done:
+		case <-timeout:
+			return 0, os.ErrDeadlineExceeded
+		}
+
+		if t != nil {
+			t.Stop()
+		}
+	}
+}
+
+// Write answers the queries, a stream query must have the length prefix and may be split over writes
+func (d *dnsConn) Write(b []byte) (int, error) {
+	d.Lock()
+	if d.closed {
+		d.Unlock()
+		return 0, net.ErrClosed
+	}
+
+	msgs := [][]byte{}
+	if d.stream {
+		d.in = append(d.in, b...)
+		for len(d.in) >= 2 {
+			n := int(binary.BigEndian.Uint16(d.in))
+			if len(d.in) < 2+n {
+				break
+			}
+			msgs = append(msgs, d.in[2:2+n])
+			d.in = d.in[2+n:]
+		}
+	} else {
+		msgs = append(msgs, append([]byte{}, b...))
+	}
+	deadline := d.wdeadline
+	d.Unlock()
+
+	for _, v := range msgs {
+		r := d.answer(v, deadline)
+		if r == nil {
+			continue
+		}
+		if d.stream {
+			r = append(binary.BigEndian.AppendUint16(nil, uint16(len(r))), r...)
+		}
+		d.Lock()
+		d.out = append(d.out, r)
+		d.Unlock()
+		select {
+		case d.ready <- struct{}{}:
+		default:
+		}
+	}
+
+	return len(b), nil
+}
+
+// answer returns the reply of query message, nil if it is not a message
+func (d *dnsConn) answer(b []byte, deadline time.Time) []byte {
+	q, err := dns.ParseQuery(b)
+	if err != nil {
+		if len(b) < 12 {
+			return nil
+		}
+		r, _ := (&dns.Response{Status: 1}).Pack(binary.BigEndian.Uint16(b))
+		return r
+	}
+
+	size := q.Size
+	if d.stream {
+		size = 0
+	}
+
+	ctx, cancel := dns.WithFlags(context.Background(), q.Flags), context.CancelFunc(func() {})
+	if !deadline.IsZero() {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	}
+	defer cancel()
+
+	rsp, _ := d.c.ECSQuery(ctx, q.Name, q.Type, q.ECS)
+	if rsp == nil {
+		rsp = q.Response(2)
+	}
+
+	r, err := q.Reply(rsp, size)
+	if err != nil {
+		r, _ = q.Reply(q.Response(2), size)
+	}
+
+	return r
+}
+
+// Close closes the connection, the blocked reads are woken up
+func (d *dnsConn) Close() error {
+	d.Lock()
+	defer d.Unlock()
+
+	if !d.closed {
+		d.closed = true
+		close(d.done)
+	}
+
+	return nil
+}
+
+// LocalAddr returns the local address, it is the dialed address as there is no socket
+func (d *dnsConn) LocalAddr() net.Addr {
+	return dnsAddr{d.network, d.address}
+}
+
+// RemoteAddr returns the dialed address
+func (d *dnsConn) RemoteAddr() net.Addr {
+	return dnsAddr{d.network, d.address}
+}
+
+// SetDeadline set the read and write deadlines
+func (d *dnsConn) SetDeadline(t time.Time) error {
+	d.Lock()
+	d.rdeadline, d.wdeadline = t, t
+	d.Unlock()
+
+	return nil
+}
+
+// SetReadDeadline set the read deadline
+func (d *dnsConn) SetReadDeadline(t time.Time) error {
+	d.Lock()
+	d.rdeadline = t
+	d.Unlock()
+
+	return nil
+}
+
+// SetWriteDeadline set the write deadline, it is the deadline of answering the queries written
+func (d *dnsConn) SetWriteDeadline(t time.Time) error {
+	d.Lock()
+	d.wdeadline = t
+	d.Unlock()
+
+	return nil
+}
+
+// ReadFrom reads a reply, the address is the dialed address
+func (d dnsPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := d.Read(b)
+	return n, d.RemoteAddr(), err
+}
+
+// WriteTo writes a query, the address is ignored
+func (d dnsPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return d.Write(b)
+}
+
+// Network returns the network of address
+func (a dnsAddr) Network() string {
+	return a.network
+}
+
+// String returns the address
+func (a dnsAddr) String() string {
+	return a.address
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestNetResolver(t *testing.T) {
+	rt, hosts := hostRecorder()
+	c := Use(GoogleProvider).SetRoundTripper(rt)
+	defer c.Close()
+
+	assert.Nil(t, c.AddRewrite("nas.home", 0, "10.0.0.1", "fd00::1"))
+
+	ctx := context.Background()
+	r := c.NetResolver()
+	addrs, err := r.LookupHost(ctx, "nas.home")
+	assert.Nil(t, err)
+	sort.Strings(addrs)
+	assert.Equal(t, addrs, []string{"10.0.0.1", "fd00::1"})
+	assert.Equal(t, len(hosts()), 0)
+
+	ips, err := r.LookupIP(ctx, "ip4", "likexian.com")
+	assert.Nil(t, err)
+	assert.Equal(t, ips[0].String(), "1.1.1.1")
+	assert.Equal(t, hosts(), []string{"dns.google.com"})
+
+	c.SetBlocklist("ads.example")
+	_, err = r.LookupHost(ctx, "ads.example")
+	assert.NotNil(t, err)
+	var e *net.DNSError
+	assert.True(t, errors.As(err, &e))
+	assert.True(t, e.IsNotFound)
+
+	_, err = c.DialDNS(ctx, "unix", "/tmp/dns.sock")
+	assert.NotNil(t, err)
+}
+
+func TestDialDNS(t *testing.T) {
+	c := Use(GoogleProvider)
+	defer c.Close()
+
+	assert.Nil(t, c.AddRewrite("nas.home", 0, "10.0.0.1"))
+
+	ctx := context.Background()
+	conn, err := c.DialDNS(ctx, "tcp", "127.0.0.1:53")
+	assert.Nil(t, err)
+	assert.Equal(t, conn.RemoteAddr().String(), "127.0.0.1:53")
+	assert.Equal(t, conn.LocalAddr().Network(), "tcp")
+
+	q, err := dns.NewQuery("nas.home", dns.TypeA, "", dns.Flags{})
+	assert.Nil(t, err)
+	msg := append(binary.BigEndian.AppendUint16(nil, uint16(len(q))), q...)
+
+	// the query is split over writes, and the reply is read in parts
+	_, err = conn.Write(msg[:5])
+	assert.Nil(t, err)
+	_, err = conn.Write(msg[5:])
+	assert.Nil(t, err)
+
+	size := make([]byte, 2)
+	n, err := conn.Read(size)
+	assert.Nil(t, err)
+	assert.Equal(t, n, 2)
+	b := make([]byte, binary.BigEndian.Uint16(size))
+	n, err = conn.Read(b)
+	assert.Nil(t, err)
+	assert.Equal(t, n, len(b))
+	rsp, err := dns.ParseMessage(b)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "10.0.0.1")
+
+	assert.Nil(t, conn.SetReadDeadline(time.Now().Add(10*time.Millisecond)))
+	_, err = conn.Read(b)
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+
+	assert.Nil(t, conn.Close())
+	assert.Nil(t, conn.Close())
+	_, err = conn.Read(b)
+	assert.True(t, errors.Is(err, net.ErrClosed))
+	_, err = conn.Write(msg)
+	assert.True(t, errors.Is(err, net.ErrClosed))
+
+	conn, err = c.DialDNS(ctx, "udp", "127.0.0.1:53")
+	assert.Nil(t, err)
+	defer conn.Close()
+	pc := conn.(net.PacketConn)
+	assert.Nil(t, pc.SetDeadline(time.Now().Add(time.Second)))
+	assert.Nil(t, conn.SetWriteDeadline(time.Now().Add(time.Second)))
+
+	_, err = pc.WriteTo([]byte("xx"), nil)
+	assert.Nil(t, err)
+	_, err = pc.WriteTo(append([]byte{0xab, 0xcd}, make([]byte, 10)...), nil)
+	assert.Nil(t, err)
+	n, addr, err := pc.ReadFrom(b)
+	assert.Nil(t, err)
+	assert.Equal(t, addr.Network(), "udp")
+	assert.Equal(t, b[:2], []byte{0xab, 0xcd})
+	_, err = dns.ParseMessage(b[:n])
+	assert.Nil(t, err)
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// DefaultRewriteTTL is the default ttl of rewrite answers
+const DefaultRewriteTTL = 5 * time.Minute
+
+// rewrite is a rewrite rule
+type rewrite struct {
+	ttl   time.Duration
+	a     []string
+	aaaa  []string
+	cname string
+}
+
+// SetAllowlist set the names and their subdomains never blocked by the blocklist and blocklists,
+// it replaces the previous ones
+func (c *DoH) SetAllowlist(names ...string) *DoH {
+	zones := newZones(names)
+
+	c.Lock()
+	c.allowlist = zones
+	c.Unlock()
+
+	return c
+}
+
+// AddRewrite add a rewrite rule answering the name locally, an answer is an IPv4 or IPv6 address, or a CNAME
+// target queried instead of the name, the name *.zone matches the subdomains of zone. The ttl is the ttl of answers,
+// DefaultRewriteTTL if 0, the rule without answers overrides the ttl of queried answers, and no answers and ttl
+// to remove the rule
+func (c *DoH) AddRewrite(name string, ttl time.Duration, answers ...string) error {
+	r, err := newRewrite(ttl, answers)
+	if err != nil {
+		return err
+	}
+
+	name = normalizeZone(name)
+	if name == "" || name == "*" {
+		return fmt.Errorf("doh: rewrite: invalid name: %s", name)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if r == nil {
+		delete(c.rewrites, name)
+	} else {
+		c.rewrites[name] = r
+	}
+
+	return nil
+}
+
+// isAllowed returns whether the domain is in the allowlist
+func (c *DoH) isAllowed(d dns.Domain) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	if len(c.allowlist) == 0 {
+		return false
+	}
+
+	_, ok := matchZone(string(d), c.allowlist)
+
+	return ok
+}
+
+// rewrite returns the rewrite rule of domain, the exact name wins over the wildcards, nil if there is no rule
+func (c *DoH) rewrite(d dns.Domain) *rewrite {
+	c.RLock()
+	defer c.RUnlock()
+
+	if len(c.rewrites) == 0 {
+		return nil
+	}
+
+	name := normalizeZone(string(d))
+	if r, ok := c.rewrites[name]; ok {
+		return r
+	}
+
+	for {
+		i := strings.Index(name, ".")
+		if i < 0 {
+			return nil
+		}
+		name = name[i+1:]
+		if r, ok := c.rewrites["*."+name]; ok {
+			return r
+		}
+	}
+}
+
+// rewriteQuery do query of the rewrite rule
+func (c *DoH) rewriteQuery(ctx context.Context, r *rewrite, d dns.Domain, t dns.Type,
+	s dns.ECS) (*dns.Response, bool, error) {
+	ttl := int(r.ttl / time.Second)
+	if len(r.a) == 0 && len(r.aaaa) == 0 && r.cname == "" {
+		rsp, cached, err := c.resolve(ctx, d, t, s)
+		if rsp == nil || len(rsp.Answer) == 0 {
+			return rsp, cached, err
+		}
+		rr := *rsp
+		rr.Answer = make([]dns.Answer, len(rsp.Answer))
+		for k, v := range rsp.Answer {
+			v.TTL = ttl
+			rr.Answer[k] = v
+		}
+		return &rr, cached, err
+	}
+
+	rsp := blocked(d, t)
+	rsp.Status = 0
+	rsp.Provider = "rewrite"
+	name := rsp.Question[0].Name
+
+	if r.cname != "" {
+		rsp.Answer = []dns.Answer{{Name: name, Type: 5, TTL: ttl, Data: r.cname + "."}}
+		if strings.EqualFold(string(t), string(dns.TypeCNAME)) {
+			return rsp, false, nil
+		}
+		rr, cached, err := c.resolve(ctx, dns.Domain(r.cname), t, s)
+		if rr == nil {
+			return nil, cached, err
+		}
+		rsp.Status = rr.Status
+		rsp.Answer = append(rsp.Answer, rr.Answer...)
+		return rsp, cached, err
+	}
+
+	ips, code := r.a, 1
+	if strings.EqualFold(string(t), string(dns.TypeAAAA)) {
+		ips, code = r.aaaa, 28
+	} else if !strings.EqualFold(string(t), string(dns.TypeA)) {
+		ips = nil
+	}
+
+	for _, v := range ips {
+		rsp.Answer = append(rsp.Answer, dns.Answer{Name: name, Type: code, TTL: ttl, Data: v})
+	}
+
+	return rsp, false, nil
+}
+
+// newRewrite returns the rewrite rule of answers, nil if there is no answers and ttl
+func newRewrite(ttl time.Duration, answers []string) (*rewrite, error) {
+	if ttl < 0 {
+		return nil, fmt.Errorf("doh: rewrite: invalid ttl: %s", ttl)
+	}
+
+	if len(answers) == 0 && ttl == 0 {
+		return nil, nil
+	}
+
+	r := &rewrite{ttl: ttl}
+	if ttl == 0 {
+		r.ttl = DefaultRewriteTTL
+	}
+
+	for _, v := range answers {
+		v = strings.TrimSpace(v)
+		if ip := net.ParseIP(v); ip != nil {
+			if ip.To4() != nil {
+				r.a = append(r.a, ip.String())
+			} else {
+				r.aaaa = append(r.aaaa, ip.String())
+			}
+			continue
+		}
+		if !isBlockName(v) {
+			return nil, fmt.Errorf("doh: rewrite: invalid answer: %s", v)
+		}
+		if r.cname != "" {
+			return nil, fmt.Errorf("doh: rewrite: more than one cname: %s", v)
+		}
+		r.cname = normalizeZone(v)
+	}
+
+	if r.cname != "" && (len(r.a) > 0 || len(r.aaaa) > 0) {
+		return nil, fmt.Errorf("doh: rewrite: cname with addresses: %s", r.cname)
+	}
+
+	return r, nil
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestSetAllowlist(t *testing.T) {
+	rt, hosts := hostRecorder()
+	c := Use(GoogleProvider).SetRoundTripper(rt).SetBlocklist("ads.example").SetAllowlist("Good.Ads.Example.")
+	defer c.Close()
+
+	ctx := context.Background()
+	rsp, err := c.Query(ctx, "x.ads.example", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Equal(t, rsp.Status, 3)
+	assert.Equal(t, len(hosts()), 0)
+
+	_, err = c.Query(ctx, "x.good.ads.example", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, len(hosts()), 1)
+
+	c.SetAllowlist()
+	_, err = c.Query(ctx, "x.good.ads.example", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Equal(t, len(hosts()), 0)
+}
+
+func TestAddRewrite(t *testing.T) {
+	rt, hosts := hostRecorder()
+	c := Use(GoogleProvider).SetRoundTripper(rt).SetBlocklist("ads.example")
+	defer c.Close()
+
+	assert.Nil(t, c.AddRewrite("nas.home", 0, "192.168.1.2", "fd00::2"))
+	assert.Nil(t, c.AddRewrite("*.lab.home", time.Minute, "10.0.0.1"))
+	assert.Nil(t, c.AddRewrite("www.home", 0, "likexian.com"))
+	assert.Nil(t, c.AddRewrite("ads.home", 0, "x.ads.example"))
+	assert.Nil(t, c.AddRewrite("likexian.com", 10*time.Second))
+
+	ctx := context.Background()
+	rsp, err := c.Query(ctx, "NAS.home.", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Provider, "rewrite")
+	assert.Equal(t, rsp.Answer, []dns.Answer{{Name: "nas.home.", Type: 1, TTL: 300, Data: "192.168.1.2"}})
+
+	rsp, err = c.Query(ctx, "nas.home", dns.TypeAAAA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer, []dns.Answer{{Name: "nas.home.", Type: 28, TTL: 300, Data: "fd00::2"}})
+
+	rsp, err = c.Query(ctx, "nas.home", dns.TypeMX)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Status, 0)
+	assert.Equal(t, len(rsp.Answer), 0)
+
+	rsp, err = c.Query(ctx, "x.y.lab.home", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer, []dns.Answer{{Name: "x.y.lab.home.", Type: 1, TTL: 60, Data: "10.0.0.1"}})
+	assert.Equal(t, len(hosts()), 0)
+
+	_, err = c.Query(ctx, "lab.home", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, len(hosts()), 1)
+
+	rsp, err = c.Query(ctx, "www.home", dns.TypeCNAME)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer, []dns.Answer{{Name: "www.home.", Type: 5, TTL: 300, Data: "likexian.com."}})
+	assert.Equal(t, len(hosts()), 0)
+
+	rsp, err = c.Query(ctx, "www.home", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Question[0].Name, "www.home.")
+	assert.Equal(t, len(rsp.Answer), 2)
+	assert.Equal(t, rsp.Answer[0].Data, "likexian.com.")
+	assert.Equal(t, rsp.Answer[1].Data, "1.1.1.1")
+	assert.Equal(t, hosts(), []string{"dns.google.com"})
+
+	rsp, err = c.Query(ctx, "ads.home", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Equal(t, rsp.Status, 3)
+	assert.Equal(t, rsp.Answer[0].Data, "x.ads.example.")
+
+	rsp, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].TTL, 10)
+	assert.Equal(t, len(hosts()), 1)
+
+	assert.Nil(t, c.AddRewrite("nas.home", 0))
+	_, err = c.Query(ctx, "nas.home", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, len(hosts()), 1)
+
+	assert.NotNil(t, c.AddRewrite("", 0, "1.1.1.1"))
+	assert.NotNil(t, c.AddRewrite("*", 0, "1.1.1.1"))
+	assert.NotNil(t, c.AddRewrite("x.home", -time.Second))
+}
+
+func TestNewRewrite(t *testing.T) {
+	r, err := newRewrite(0, nil)
+	assert.Nil(t, err)
+	assert.True(t, r == nil)
+
+	r, err = newRewrite(0, []string{"1.1.1.1", " 2001:db8::1 ", "::ffff:1.2.3.4"})
+	assert.Nil(t, err)
+	assert.Equal(t, r, &rewrite{ttl: DefaultRewriteTTL, a: []string{"1.1.1.1", "1.2.3.4"}, aaaa: []string{"2001:db8::1"}})
+
+	r, err = newRewrite(time.Minute, []string{"Target.Example."})
+	assert.Nil(t, err)
+	assert.Equal(t, r, &rewrite{ttl: time.Minute, cname: "target.example"})
+
+	for _, v := range [][]string{{"xx!"}, {"a.example", "b.example"}, {"a.example", "1.1.1.1"}} {
+		_, err = newRewrite(0, v)
+		assert.NotNil(t, err, v)
+	}
+}
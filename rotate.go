@@ -0,0 +1,192 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// rotateTimeFormat is the time suffix format of rotated files, it sorts by time
+const rotateTimeFormat = "20060102-150405.000"
+
+// RotatingFile is an appending file rotated by size and time, for example the writer of query logger,
+// the rotated files are renamed with the time suffix of rotation
+type RotatingFile struct {
+	path     string
+	maxSize  int64
+	interval time.Duration
+	backups  int
+	file     *os.File
+	size     int64
+	opened   time.Time
+	sync.Mutex
+}
+
+// OpenRotatingFile returns a new rotating file appending to path, it is not rotated until the max size
+// or interval is set
+func OpenRotatingFile(path string) (*RotatingFile, error) {
+	f := &RotatingFile{path: path}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// SetMaxSize set the max size in bytes of file before it is rotated, 0 to disable
+func (f *RotatingFile) SetMaxSize(size int64) *RotatingFile {
+	f.Lock()
+	f.maxSize = size
+	f.Unlock()
+
+	return f
+}
+
+// SetInterval set the max time since the file is opened before it is rotated, 0 to disable
+func (f *RotatingFile) SetInterval(interval time.Duration) *RotatingFile {
+	f.Lock()
+	f.interval = interval
+	f.Unlock()
+
+	return f
+}
+
+// SetBackups set the max number of rotated files kept, the oldest ones are removed, 0 to keep all
+func (f *RotatingFile) SetBackups(n int) *RotatingFile {
+	f.Lock()
+	f.backups = n
+	f.Unlock()
+
+	return f
+}
+
+// Write writes b to file, the file is rotated first if it exceeds the max size or interval
+func (f *RotatingFile) Write(b []byte) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if f.size > 0 && (f.maxSize > 0 && f.size+int64(len(b)) > f.maxSize ||
+		f.interval > 0 && time.Since(f.opened) >= f.interval) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(b)
+	f.size += int64(n)
+
+	return n, err
+}
+
+// Rotate renames the file with the time suffix, and opens a new one
+func (f *RotatingFile) Rotate() error {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.file == nil {
+		return os.ErrClosed
+	}
+
+	return f.rotate()
+}
+
+// Close closes the file
+func (f *RotatingFile) Close() error {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+
+	return err
+}
+
+// open opens the file for appending, must hold the lock
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file, f.size, f.opened = file, fi.Size(), time.Now()
+
+	return nil
+}
+
+// rotate renames the file, opens a new one and removes the oldest backups, must hold the lock
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	name := f.path + "." + time.Now().Format(rotateTimeFormat)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			break
+		}
+		name = fmt.Sprintf("%s.%s.%d", f.path, time.Now().Format(rotateTimeFormat), i)
+	}
+
+	if err := os.Rename(f.path, name); err != nil {
+		_ = f.open()
+		return err
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	if f.backups <= 0 {
+		return nil
+	}
+
+	names, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(names)
+	for len(names) > f.backups {
+		_ = os.Remove(names[0])
+		names = names[1:]
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "query.log")
+	assert.Nil(t, os.WriteFile(path, []byte("old\n"), 0644))
+
+	f, err := OpenRotatingFile(path)
+	assert.Nil(t, err)
+	f.SetMaxSize(10).SetBackups(2)
+
+	backups := func() []string {
+		names, err := filepath.Glob(path + ".*")
+		assert.Nil(t, err)
+		return names
+	}
+
+	_, err = f.Write([]byte("12345\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, len(backups()), 0)
+
+	_, err = f.Write([]byte("67890\n"))
+	assert.Nil(t, err)
+	names := backups()
+	assert.Equal(t, len(names), 1)
+	b, err := os.ReadFile(names[0])
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), "old\n12345\n")
+
+	for i := 0; i < 3; i++ {
+		_, err = f.Write([]byte(strings.Repeat("x", 10)))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, len(backups()), 2)
+	b, err = os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), strings.Repeat("x", 10))
+
+	f.SetMaxSize(0).SetBackups(0).SetInterval(time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	_, err = f.Write([]byte("y\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, len(backups()), 3)
+
+	f.SetInterval(0)
+	assert.Nil(t, f.Rotate())
+	assert.Equal(t, len(backups()), 4)
+	b, err = os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, len(b), 0)
+
+	assert.Nil(t, f.Close())
+	assert.Nil(t, f.Close())
+	_, err = f.Write([]byte("z"))
+	assert.NotNil(t, err)
+	assert.NotNil(t, f.Rotate())
+
+	_, err = OpenRotatingFile(filepath.Join(path, "x"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// AddRoute add a routing rule querying the names in zone with the providers only, the longest matching zone wins,
+// the providers not used by client are ignored, and no providers to remove the rule
+func (c *DoH) AddRoute(zone string, provider ...int) *DoH {
+	zone = normalizeZone(zone)
+
+	c.Lock()
+	defer c.Unlock()
+
+	ps := []int{}
+	for k, v := range c.kinds {
+		for _, p := range provider {
+			if v == p {
+				ps = append(ps, k)
+				break
+			}
+		}
+	}
+
+	if len(ps) == 0 {
+		delete(c.routes, zone)
+	} else {
+		c.routes[zone] = ps
+	}
+
+	return c
+}
+
+// SetBlocklist set the names and their subdomains answered with NXDOMAIN without querying, it replaces the
+// previous ones, and the blocked response is returned with an error as a failed response code
+func (c *DoH) SetBlocklist(names ...string) *DoH {
+	zones := newZones(names)
+
+	c.Lock()
+	c.blocklist = zones
+	c.Unlock()
+
+	return c
+}
+
+// isBlocked returns whether the domain is in the blocklist
+func (c *DoH) isBlocked(d dns.Domain) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	if len(c.blocklist) == 0 {
+		return false
+	}
+
+	_, ok := matchZone(string(d), c.blocklist)
+
+	return ok
+}
+
+// route returns the providers of the longest zone matching domain, nil if there is no route
+func (c *DoH) route(d dns.Domain) []Provider {
+	c.RLock()
+	defer c.RUnlock()
+
+	if len(c.routes) == 0 {
+		return nil
+	}
+
+	zone, ok := matchZone(string(d), c.routes)
+	if !ok {
+		return nil
+	}
+
+	ps := []Provider{}
+	for _, v := range c.routes[zone] {
+		if !c.disabled[c.kinds[v]] {
+			ps = append(ps, c.providers[v])
+		}
+	}
+
+	return ps
+}
+
+// override returns the providers of names set by dns.WithProvider, nil if not set, the disabled ones are ignored
+func (c *DoH) override(ctx context.Context) ([]Provider, error) {
+	names := dns.ProvidersOf(ctx)
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+
+	ps := []Provider{}
+	for k, v := range c.providers {
+		if c.disabled[c.kinds[k]] {
+			continue
+		}
+		for _, n := range names {
+			if strings.EqualFold(strings.TrimSpace(n), v.String()) {
+				ps = append(ps, v)
+				break
+			}
+		}
+	}
+
+	if len(ps) == 0 {
+		return nil, fmt.Errorf("doh: no enabled provider named %s", strings.Join(names, ","))
+	}
+
+	return ps, nil
+}
+
+// matchZone returns the longest zone of zones containing name
+func matchZone[T any](name string, zones map[string]T) (string, bool) {
+	name = normalizeZone(name)
+	for {
+		if _, ok := zones[name]; ok {
+			return name, true
+		}
+		if name == "" {
+			return "", false
+		}
+		i := strings.Index(name, ".")
+		if i < 0 {
+			name = ""
+		} else {
+			name = name[i+1:]
+		}
+	}
+}
+
+// newZones returns the set of normalized zones, the root zone is ignored
+func newZones(names []string) map[string]struct{} {
+	zones := map[string]struct{}{}
+	for _, v := range names {
+		if v = normalizeZone(v); v != "" {
+			zones[v] = struct{}{}
+		}
+	}
+
+	return zones
+}
+
+// normalizeZone returns the lower case zone without the leading and trailing dots, empty for the root zone
+func normalizeZone(zone string) string {
+	return strings.Trim(strings.ToLower(strings.TrimSpace(zone)), ".")
+}
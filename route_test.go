@@ -0,0 +1,141 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+// hostRecorder returns a round tripper answering 1.1.1.1 and the func returning the queried hosts
+func hostRecorder() (http.RoundTripper, func() []string) {
+	var mu sync.Mutex
+	hosts := []string{}
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		mu.Lock()
+		hosts = append(hosts, r.URL.Host)
+		mu.Unlock()
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body: ioutil.NopCloser(strings.NewReader(
+				`{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`)),
+			Request: r,
+		}, nil
+	})
+
+	return rt, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		v := hosts
+		hosts = []string{}
+		return v
+	}
+}
+
+func TestAddRoute(t *testing.T) {
+	rt, hosts := hostRecorder()
+	c := Use(GoogleProvider, CloudflareProvider).SetRoundTripper(rt).SetFormat(dns.FormatJSON).
+		AddRoute("Corp.Example.", CloudflareProvider).
+		AddRoute("dev.corp.example", GoogleProvider).
+		AddRoute("lab.example", Quad9Provider)
+	defer c.Close()
+
+	ctx := context.Background()
+	_, err := c.Query(ctx, "www.corp.example", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, hosts(), []string{"cloudflare-dns.com"})
+
+	_, err = c.Query(ctx, "corp.example.", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, hosts(), []string{"cloudflare-dns.com"})
+
+	_, err = c.Query(ctx, "a.dev.corp.example", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, hosts(), []string{"dns.google.com"})
+
+	_, err = c.Query(ctx, "xcorp.example", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, len(hosts()), 1)
+
+	_, err = c.Query(ctx, "www.lab.example", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, len(hosts()), 1)
+
+	c.AddRoute("corp.example")
+	_, err = c.Query(ctx, "www.corp.example", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, len(hosts()), 1)
+}
+
+func TestWithProvider(t *testing.T) {
+	rt, hosts := hostRecorder()
+	c := Use(GoogleProvider, CloudflareProvider).SetRoundTripper(rt).SetFormat(dns.FormatJSON).
+		AddRoute("corp.example", GoogleProvider)
+	defer c.Close()
+
+	ctx := dns.WithProvider(context.Background(), "Cloudflare")
+	rsp, err := c.Query(ctx, "www.corp.example", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Provider, "cloudflare")
+	assert.Equal(t, hosts(), []string{"cloudflare-dns.com"})
+
+	_, err = c.Query(dns.WithProvider(ctx, "google", "cloudflare"), "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, len(hosts()), 2)
+
+	_, err = c.Query(dns.WithProvider(ctx, "quad9"), "likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Equal(t, len(hosts()), 0)
+
+	c.SetProviderEnabled(CloudflareProvider, false)
+	_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+
+	_, err = c.Query(dns.WithProvider(ctx), "www.corp.example", dns.TypeA)
+	assert.Nil(t, err)
+	assert.Equal(t, hosts(), []string{"dns.google.com"})
+}
+
+func TestMatchZone(t *testing.T) {
+	zones := map[string]bool{"example.com": true, "a.example.com": true}
+
+	z, ok := matchZone("x.a.Example.com.", zones)
+	assert.True(t, ok)
+	assert.Equal(t, z, "a.example.com")
+
+	z, ok = matchZone("example.com", zones)
+	assert.True(t, ok)
+	assert.Equal(t, z, "example.com")
+
+	_, ok = matchZone("example.org", zones)
+	assert.False(t, ok)
+
+	zones[""] = true
+	z, ok = matchZone("example.org", zones)
+	assert.True(t, ok)
+	assert.Equal(t, z, "")
+}
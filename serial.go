@@ -0,0 +1,188 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// SerialChange is the change of the SOA serial of a zone
+type SerialChange struct {
+	Zone     dns.Domain
+	Old      uint32
+	New      uint32
+	SOA      dns.SOA
+	Provider string
+	Time     time.Time
+}
+
+// SerialWatcher polls the SOA serial of a zone in background until stopped, it is safe for concurrent use
+type SerialWatcher struct {
+	client   *DoH
+	zone     dns.Domain
+	interval time.Duration
+	onChange func(SerialChange)
+	onError  func(error)
+	serial   uint32
+	known    bool
+	stopc    chan struct{}
+	sync.RWMutex
+}
+
+// WatchSerial returns a watcher polling the SOA serial of zone at the interval, fn is called with each change,
+// the first serial polled is the baseline and not reported, the providers are queried directly in order
+// bypassing the cache, so that the changes are seen once the upstream ones expire, and the older serials answered
+// by the stale upstreams are ignored in the RFC 1982 serial arithmetic
+func (c *DoH) WatchSerial(zone dns.Domain, interval time.Duration, fn func(SerialChange)) *SerialWatcher {
+	w := &SerialWatcher{
+		client:   c,
+		zone:     zone,
+		interval: interval,
+		onChange: fn,
+		stopc:    make(chan struct{}),
+	}
+
+	if interval > 0 {
+		go w.run()
+	}
+
+	return w
+}
+
+// SetErrorHandler set the function called with the errors of polling, nil to ignore them
+func (w *SerialWatcher) SetErrorHandler(fn func(error)) *SerialWatcher {
+	w.Lock()
+	w.onError = fn
+	w.Unlock()
+
+	return w
+}
+
+// Serial returns the last serial polled, and whether any is polled
+func (w *SerialWatcher) Serial() (uint32, bool) {
+	w.RLock()
+	defer w.RUnlock()
+
+	return w.serial, w.known
+}
+
+// Stop stops polling in background, it is safe to call more than once
+func (w *SerialWatcher) Stop() {
+	w.Lock()
+	defer w.Unlock()
+
+	select {
+	case <-w.stopc:
+	default:
+		close(w.stopc)
+	}
+}
+
+// Poll polls the serial now, and returns the change if it is newer than the last one, the callback is called too
+func (w *SerialWatcher) Poll(ctx context.Context) (*SerialChange, error) {
+	soa, provider, err := w.client.lookupSOA(ctx, w.zone)
+	if err != nil {
+		w.RLock()
+		onError := w.onError
+		w.RUnlock()
+		if onError != nil {
+			onError(err)
+		}
+		return nil, err
+	}
+
+	w.client.RLock()
+	now := w.client.clock.Now()
+	w.client.RUnlock()
+
+	w.Lock()
+	old, known := w.serial, w.known
+	if known && !serialAfter(soa.Serial, old) {
+		w.Unlock()
+		return nil, nil
+	}
+	w.serial, w.known = soa.Serial, true
+	onChange := w.onChange
+	w.Unlock()
+
+	if !known {
+		return nil, nil
+	}
+
+	change := &SerialChange{Zone: w.zone, Old: old, New: soa.Serial, SOA: soa, Provider: provider, Time: now}
+	if onChange != nil {
+		onChange(*change)
+	}
+
+	return change, nil
+}
+
+// run polls the serial at the interval until stopped, each poll is limited to the interval
+func (w *SerialWatcher) run() {
+	poll := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), w.interval)
+		_, _ = w.Poll(ctx)
+		cancel()
+	}
+
+	poll()
+
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.stopc:
+			return
+		case <-t.C:
+			poll()
+		}
+	}
+}
+
+// lookupSOA returns the SOA record of zone and the provider answering, the providers are queried in order
+// until one answers, and the last error is returned if none
+func (c *DoH) lookupSOA(ctx context.Context, zone dns.Domain) (dns.SOA, string, error) {
+	ps, _ := c.list()
+
+	err := fmt.Errorf("doh: no soa record found for %s", zone)
+	for _, p := range ps {
+		rsp, e := p.Query(ctx, zone, dns.TypeSOA)
+		if e != nil {
+			err = e
+			continue
+		}
+		if soas := dns.Records[dns.SOA](rsp); len(soas) > 0 {
+			return soas[0], p.String(), nil
+		}
+		err = fmt.Errorf("doh: no soa record found for %s", zone)
+	}
+
+	return dns.SOA{}, "", err
+}
+
+// serialAfter returns whether serial a is after b in the RFC 1982 serial arithmetic
+func serialAfter(a, b uint32) bool {
+	return a != b && int32(a-b) > 0
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/dohtest"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestWatchSerial(t *testing.T) {
+	p := dohtest.New("fake")
+	p.Answer("likexian.com", dns.TypeSOA, "ns.likexian.com. mbox.likexian.com. 1 7200 3600 1209600 300").Times(2)
+	p.Answer("likexian.com", dns.TypeSOA, "ns.likexian.com. mbox.likexian.com. 3 7200 3600 1209600 300").Times(1)
+	p.Answer("likexian.com", dns.TypeSOA, "ns.likexian.com. mbox.likexian.com. 2 7200 3600 1209600 300").Times(1)
+	p.On("likexian.com", dns.TypeSOA).Error(errors.New("injected")).Times(1)
+	p.Answer("likexian.com", dns.TypeSOA, "ns.likexian.com. mbox.likexian.com. 0 7200 3600 1209600 300")
+
+	c := UseProviders(p)
+	defer c.Close()
+
+	changes := []SerialChange{}
+	errs := []error{}
+	w := c.WatchSerial("likexian.com", 0, func(v SerialChange) {
+		changes = append(changes, v)
+	}).SetErrorHandler(func(err error) {
+		errs = append(errs, err)
+	})
+	defer w.Stop()
+
+	_, ok := w.Serial()
+	assert.False(t, ok)
+
+	ctx := context.Background()
+	change, err := w.Poll(ctx)
+	assert.Nil(t, err)
+	assert.True(t, change == nil)
+	serial, ok := w.Serial()
+	assert.True(t, ok)
+	assert.Equal(t, serial, uint32(1))
+
+	change, err = w.Poll(ctx)
+	assert.Nil(t, err)
+	assert.True(t, change == nil)
+
+	change, err = w.Poll(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, change.Old, uint32(1))
+	assert.Equal(t, change.New, uint32(3))
+	assert.Equal(t, change.SOA.NS, "ns.likexian.com.")
+	assert.Equal(t, change.Provider, "fake")
+	assert.Equal(t, changes, []SerialChange{*change})
+
+	change, err = w.Poll(ctx)
+	assert.Nil(t, err)
+	assert.True(t, change == nil)
+	serial, _ = w.Serial()
+	assert.Equal(t, serial, uint32(3))
+
+	_, err = w.Poll(ctx)
+	assert.NotNil(t, err)
+	assert.Equal(t, len(errs), 1)
+
+	w.Stop()
+	w.Stop()
+}
+
+func TestWatchSerialInterval(t *testing.T) {
+	p := dohtest.New("fake")
+	p.Answer("likexian.com", dns.TypeSOA, "ns.likexian.com. mbox.likexian.com. 1 7200 3600 1209600 300").Times(3)
+	p.Answer("likexian.com", dns.TypeSOA, "ns.likexian.com. mbox.likexian.com. 2 7200 3600 1209600 300")
+
+	c := UseProviders(p)
+	defer c.Close()
+
+	changec := make(chan SerialChange, 1)
+	w := c.WatchSerial("likexian.com", 5*time.Millisecond, func(v SerialChange) {
+		changec <- v
+	})
+	defer w.Stop()
+
+	select {
+	case v := <-changec:
+		assert.Equal(t, v.Zone, dns.Domain("likexian.com"))
+		assert.Equal(t, v.Old, uint32(1))
+		assert.Equal(t, v.New, uint32(2))
+	case <-time.After(time.Second):
+		t.Fatal("serial change not reported")
+	}
+}
+
+func TestLookupSOA(t *testing.T) {
+	p1 := dohtest.New("one")
+	p1.On("likexian.com", dns.TypeSOA).Error(errors.New("injected"))
+	p1.On("nx.likexian.com", dns.TypeSOA)
+	p2 := dohtest.New("two")
+	p2.Answer("likexian.com", dns.TypeSOA, "ns.likexian.com. mbox.likexian.com. 1 7200 3600 1209600 300")
+	p2.On("nx.likexian.com", dns.TypeSOA)
+
+	c := UseProviders(p1, p2)
+	defer c.Close()
+
+	soa, provider, err := c.lookupSOA(context.Background(), "likexian.com")
+	assert.Nil(t, err)
+	assert.Equal(t, soa.Serial, uint32(1))
+	assert.Equal(t, provider, "two")
+
+	_, _, err = c.lookupSOA(context.Background(), "nx.likexian.com")
+	assert.Contains(t, err.Error(), "no soa record found")
+}
+
+func TestSerialAfter(t *testing.T) {
+	assert.True(t, serialAfter(2, 1))
+	assert.False(t, serialAfter(1, 1))
+	assert.False(t, serialAfter(1, 2))
+	assert.True(t, serialAfter(0, 0xffffffff))
+	assert.False(t, serialAfter(0xffffffff, 0))
+}
@@ -0,0 +1,309 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// Resolver resolves the queries of server, for example a DoH client
+type Resolver interface {
+	ECSQuery(context.Context, dns.Domain, dns.Type, dns.ECS) (*dns.Response, error)
+}
+
+// Server is a DoH server, it serves the RFC 8484 wire format and the json api of resolver as a http handler
+type Server struct {
+	resolver Resolver
+	timeout  time.Duration
+	logger   *slog.Logger
+	sync.RWMutex
+}
+
+// DefaultTimeout is the default timeout of resolving a query
+const DefaultTimeout = 5 * time.Second
+
+// maxMessageSize is the max size of a wire format query
+const maxMessageSize = 65535
+
+// Version returns package version
+func Version() string {
+	return "0.1.0"
+}
+
+// Author returns package author
+func Author() string {
+	return "[Li Kexian](https://www.likexian.com/)"
+}
+
+// License returns package license
+func License() string {
+	return "Licensed under the Apache License 2.0"
+}
+
+// New returns a new DoH server resolving queries by resolver
+func New(r Resolver) *Server {
+	return &Server{
+		resolver: r,
+		timeout:  DefaultTimeout,
+	}
+}
+
+// SetTimeout set the timeout of resolving a query, SERVFAIL is answered if it is exceeded
+func (s *Server) SetTimeout(timeout time.Duration) *Server {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	s.Lock()
+	s.timeout = timeout
+	s.Unlock()
+
+	return s
+}
+
+// SetLogger set the structured logger of failed queries, nil to disable
+func (s *Server) SetLogger(l *slog.Logger) *Server {
+	s.Lock()
+	s.logger = l
+	s.Unlock()
+
+	return s
+}
+
+// ServeHTTP serves a DoH request, the wire format is a GET with the dns param or a POST of message,
+// the json api is a GET with the name and type params
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		param := r.URL.Query()
+		if param.Get("dns") != "" {
+			b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(param.Get("dns"), "="))
+			if err != nil {
+				http.Error(w, "invalid dns param", http.StatusBadRequest)
+				return
+			}
+			s.serveMessage(w, r, b)
+			return
+		}
+		if param.Get("name") != "" {
+			s.serveJSON(w, r)
+			return
+		}
+		http.Error(w, "missing dns or name param", http.StatusBadRequest)
+	case http.MethodPost:
+		if dns.FormatOf(r.Header.Get("Content-Type")) != dns.FormatMessage {
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		b, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize+1))
+		if err != nil {
+			http.Error(w, "read body failed", http.StatusBadRequest)
+			return
+		}
+		if len(b) > maxMessageSize {
+			http.Error(w, "message too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		s.serveMessage(w, r, b)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveMessage serves a wire format query
+func (s *Server) serveMessage(w http.ResponseWriter, r *http.Request, b []byte) {
+	q, err := dns.ParseQuery(b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rsp := s.resolve(clientContext(r), q)
+
+	b, err = q.Reply(rsp, 0)
+	if err != nil {
+		s.log(r.Context(), "doh: server: pack failed", q, err)
+		if b, err = q.Reply(q.Response(2), 0); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	s.write(w, dns.ContentTypeMessage, rsp, b)
+}
+
+// serveJSON serves a json api query, the params are the same as the google json api
+func (s *Server) serveJSON(w http.ResponseWriter, r *http.Request) {
+	param := r.URL.Query()
+
+	q := &dns.Query{
+		Name: dns.Domain(strings.TrimSuffix(param.Get("name"), ".")),
+		Type: dns.TypeA,
+		Flags: dns.Flags{
+			CD:   isTrue(param.Get("cd")),
+			DO:   isTrue(param.Get("do")),
+			NoRD: isFalse(param.Get("rd")),
+		},
+	}
+
+	q.Code = 1
+	if v := param.Get("type"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 && n <= math.MaxUint16 {
+			q.Type, q.Code = dns.TypeOf(uint16(n)), uint16(n)
+		} else {
+			q.Type = dns.Type(strings.ToUpper(v))
+			code, err := q.Type.Code()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			q.Code = code
+		}
+	}
+
+	if v := param.Get("edns_client_subnet"); strings.TrimSpace(v) != "" {
+		ss, err := dns.ECS(v).Subnet()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		q.ECS = dns.ECS(ss)
+	}
+
+	rsp := s.resolve(clientContext(r), q)
+
+	if dns.FormatOf(param.Get("ct")) == dns.FormatMessage {
+		b, err := q.Reply(rsp, 0)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.write(w, dns.ContentTypeMessage, rsp, b)
+		return
+	}
+
+	r2 := *rsp
+	r2.Question = q.Response(0).Question
+	r2.Metadata = nil
+	b, err := json.Marshal(r2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.write(w, dns.ContentTypeJSON, rsp, b)
+}
+
+// clientContext returns the context of request with the client address, unless it is set already
+func clientContext(r *http.Request) context.Context {
+	ctx := r.Context()
+	if dns.ClientAddr(ctx).IsValid() {
+		return ctx
+	}
+
+	ap, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return ctx
+	}
+
+	return dns.WithClientAddr(ctx, ap.Addr())
+}
+
+// resolve returns the response of query, a SERVFAIL if it is failed without response
+func (s *Server) resolve(ctx context.Context, q *dns.Query) *dns.Response {
+	s.RLock()
+	timeout := s.timeout
+	s.RUnlock()
+
+	ctx, cancel := context.WithTimeout(dns.WithFlags(ctx, q.Flags), timeout)
+	defer cancel()
+
+	rsp, err := s.resolver.ECSQuery(ctx, q.Name, q.Type, q.ECS)
+	if rsp == nil {
+		s.log(ctx, "doh: server: query failed", q, err)
+		return q.Response(2)
+	}
+
+	return rsp
+}
+
+// write writes the body of response, it is cacheable as long as the min ttl of answers
+func (s *Server) write(w http.ResponseWriter, contentType string, rsp *dns.Response, b []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+
+	if len(rsp.Answer) > 0 {
+		ttl := rsp.Answer[0].TTL
+		for _, v := range rsp.Answer {
+			if v.TTL < ttl {
+				ttl = v.TTL
+			}
+		}
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", ttl))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
+// log writes a warn record of query if the logger is set
+func (s *Server) log(ctx context.Context, msg string, q *dns.Query, err error) {
+	s.RLock()
+	l := s.logger
+	s.RUnlock()
+
+	if l == nil || !l.Enabled(ctx, slog.LevelWarn) {
+		return
+	}
+
+	attrs := []slog.Attr{slog.String("name", string(q.Name)), slog.String("type", string(q.Type))}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+
+	l.LogAttrs(ctx, slog.LevelWarn, msg, attrs...)
+}
+
+// isTrue returns whether the flag param is set, for example: 1 or true
+func isTrue(v string) bool {
+	b, err := strconv.ParseBool(v)
+	return err == nil && b
+}
+
+// isFalse returns whether the flag param is cleared, for example: 0 or false, it is not cleared if missing
+func isFalse(v string) bool {
+	b, err := strconv.ParseBool(v)
+	return err == nil && !b
+}
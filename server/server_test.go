@@ -0,0 +1,220 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/provider/google"
+	"github.com/ideatocode/doh-go/provider/quad9"
+	"github.com/likexian/gokit/assert"
+)
+
+type resolverFunc func(context.Context, dns.Domain, dns.Type, dns.ECS) (*dns.Response, error)
+
+func (f resolverFunc) ECSQuery(ctx context.Context, d dns.Domain, t dns.Type, s dns.ECS) (*dns.Response, error) {
+	return f(ctx, d, t, s)
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// testResolver answers 1.1.1.1 to A queries, NXDOMAIN to nx.likexian.com and fails others
+var testResolver = resolverFunc(func(ctx context.Context, d dns.Domain, t dns.Type, s dns.ECS) (*dns.Response, error) {
+	switch {
+	case d == "nx.likexian.com":
+		return &dns.Response{Status: 3}, fmt.Errorf("failed response code 3")
+	case t == dns.TypeA:
+		return &dns.Response{RD: true, RA: true, Provider: "test", Metadata: &dns.Metadata{Upstream: "x"},
+			Answer: []dns.Answer{
+				{Name: string(d) + ".", Type: 1, TTL: 300, Data: "1.1.1.1"},
+				{Name: string(d) + ".", Type: 1, TTL: 60, Data: "1.0.0.1"},
+			}}, nil
+	default:
+		return nil, fmt.Errorf("all query failed")
+	}
+})
+
+func TestVersion(t *testing.T) {
+	assert.Contains(t, Version(), ".")
+	assert.Contains(t, Author(), "likexian")
+	assert.Contains(t, License(), "Apache License")
+}
+
+func TestServeMessage(t *testing.T) {
+	s := New(testResolver).SetTimeout(0).SetLogger(nil)
+
+	q, err := dns.NewQuery("likexian.com", dns.TypeA, "", dns.Flags{})
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dns-query?dns="+base64.RawURLEncoding.EncodeToString(q), nil))
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Equal(t, w.Header().Get("Content-Type"), dns.ContentTypeMessage)
+	assert.Equal(t, w.Header().Get("Cache-Control"), "max-age=60")
+	rsp, err := dns.ParseMessage(w.Body.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+
+	q, err = dns.NewQuery("likexian.com", dns.TypeMX, "", dns.Flags{})
+	assert.Nil(t, err)
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/dns-query", bytes.NewReader(q))
+	r.Header.Set("Content-Type", dns.ContentTypeMessage)
+	s.ServeHTTP(w, r)
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Equal(t, w.Header().Get("Cache-Control"), "")
+	rsp, err = dns.ParseMessage(w.Body.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Status, 2)
+
+	tests := []struct {
+		method      string
+		target      string
+		contentType string
+		body        string
+		code        int
+	}{
+		{http.MethodGet, "/dns-query", "", "", http.StatusBadRequest},
+		{http.MethodGet, "/dns-query?dns=*", "", "", http.StatusBadRequest},
+		{http.MethodGet, "/dns-query?dns=eHg", "", "", http.StatusBadRequest},
+		{http.MethodPost, "/dns-query", "text/plain", "", http.StatusUnsupportedMediaType},
+		{http.MethodPost, "/dns-query", dns.ContentTypeMessage, strings.Repeat("x", 65536), http.StatusRequestEntityTooLarge},
+		{http.MethodPut, "/dns-query", "", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, v := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(v.method, v.target, strings.NewReader(v.body))
+		r.Header.Set("Content-Type", v.contentType)
+		s.ServeHTTP(w, r)
+		assert.Equal(t, w.Code, v.code, v.method, v.target)
+	}
+}
+
+func TestServeJSON(t *testing.T) {
+	var flags dns.Flags
+	var ecs dns.ECS
+	s := New(resolverFunc(func(ctx context.Context, d dns.Domain, t dns.Type, e dns.ECS) (*dns.Response, error) {
+		flags, ecs = dns.FlagsOf(ctx), e
+		return testResolver(ctx, d, t, e)
+	}))
+
+	get := func(target string) (*httptest.ResponseRecorder, *dns.Response) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		rsp := &dns.Response{}
+		if w.Header().Get("Content-Type") == dns.ContentTypeJSON {
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), rsp))
+		}
+		return w, rsp
+	}
+
+	w, rsp := get("/resolve?name=likexian.com.&cd=1&do=true&edns_client_subnet=1.2.3.0/24")
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Equal(t, rsp.Question, []dns.Question{{Name: "likexian.com.", Type: 1}})
+	assert.Equal(t, rsp.Answer[1].Data, "1.0.0.1")
+	assert.True(t, rsp.Metadata == nil)
+	assert.Equal(t, flags, dns.Flags{CD: true, DO: true})
+	assert.Equal(t, ecs, dns.ECS("1.2.3.0/24"))
+
+	_, rsp = get("/resolve?name=nx.likexian.com&type=a&cd=0")
+	assert.Equal(t, rsp.Status, 3)
+	assert.Equal(t, flags, dns.Flags{})
+
+	_, _ = get("/resolve?name=likexian.com&rd=0")
+	assert.Equal(t, flags, dns.Flags{NoRD: true})
+
+	_, rsp = get("/resolve?name=likexian.com&type=65")
+	assert.Equal(t, rsp.Status, 2)
+	assert.Equal(t, rsp.Question, []dns.Question{{Name: "likexian.com.", Type: 65}})
+
+	w, _ = get("/resolve?name=likexian.com&ct=application/dns-message")
+	assert.Equal(t, w.Header().Get("Content-Type"), dns.ContentTypeMessage)
+	rsp, err := dns.ParseMessage(w.Body.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+
+	w, _ = get("/resolve?name=likexian.com&type=xx")
+	assert.Equal(t, w.Code, http.StatusBadRequest)
+
+	_, _ = get("/resolve?name=likexian.com&edns_client_subnet=::ffff:1.2.3.4/120")
+	assert.Equal(t, ecs, dns.ECS("1.2.3.4/24"))
+
+	for _, v := range []string{"x", "1.2.3.4/33", "::ffff:1.2.3.4/64"} {
+		ecs = ""
+		w, _ = get("/resolve?name=likexian.com&edns_client_subnet=" + v)
+		assert.Equal(t, w.Code, http.StatusBadRequest)
+		assert.Equal(t, ecs, dns.ECS(""))
+	}
+}
+
+func TestServeProviders(t *testing.T) {
+	s := New(testResolver)
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Result(), nil
+	})
+
+	ctx := context.Background()
+
+	g := google.New()
+	g.Transport().SetRoundTripper(rt)
+	for _, v := range []dns.Format{dns.FormatJSON, dns.FormatMessage} {
+		assert.Nil(t, g.SetFormat(v))
+		rsp, err := g.Query(ctx, "likexian.com", dns.TypeA)
+		assert.Nil(t, err)
+		assert.Equal(t, rsp.Answer[0].Data, "1.1.1.1")
+	}
+
+	q := quad9.New()
+	q.Transport().SetRoundTripper(rt)
+	rsp, err := q.Query(ctx, "nx.likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+	assert.Equal(t, rsp.Status, 3)
+}
+
+func TestClientContext(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/dns-query", nil)
+	r.RemoteAddr = "[::ffff:192.168.1.2]:5353"
+	assert.Equal(t, dns.ClientAddr(clientContext(r)).String(), "192.168.1.2")
+
+	r = r.WithContext(dns.WithClientAddr(r.Context(), netip.MustParseAddr("10.0.0.1")))
+	assert.Equal(t, dns.ClientAddr(clientContext(r)).String(), "10.0.0.1")
+
+	r = httptest.NewRequest(http.MethodGet, "/dns-query", nil)
+	r.RemoteAddr = "xx"
+	assert.False(t, dns.ClientAddr(clientContext(r)).IsValid())
+}
@@ -0,0 +1,268 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is the statistics of a provider since the client started, it is keyed by the provider name,
+// so the providers of the same name, for example two custom providers of different upstreams, share one Stats
+type Stats struct {
+	Provider    string
+	Queries     int64
+	Successes   int64
+	Errors      map[string]int64
+	CacheHits   int64
+	SuccessRate float64
+	P50         time.Duration
+	P90         time.Duration
+	P99         time.Duration
+}
+
+// counter is the statistics counter of a provider, it is updated with atomic operations and no lock
+type counter struct {
+	queries   atomic.Int64
+	successes atomic.Int64
+	errors    [len(errorClasses)]atomic.Int64
+	cacheHits atomic.Int64
+	failures  atomic.Int64
+	latency   [len(latencyBounds) + 1]atomic.Int64
+}
+
+// errorClasses is the query error classes counted by counter
+var errorClasses = [...]string{ErrorClassCanceled, ErrorClassTimeout, ErrorClassNetwork, ErrorClassStatus,
+	ErrorClassRcode, ErrorClassOther}
+
+// rate is the failure rate of a provider selecting the fastest, the canceled queries are failures
+type rate struct {
+	queries atomic.Int64
+	errors  atomic.Int64
+}
+
+// rates is the failure rates of providers since the last reset, it is replaced as a whole on reset
+type rates struct {
+	providers []Provider
+	rates     []rate
+}
+
+// UnhealthyFailures is the number of failed queries in a row marking a provider unhealthy,
+// the failed response codes are answers and not counted
+const UnhealthyFailures = 3
+
+// latencyBounds is the upper bounds of latency histogram buckets, percentiles are approximated by them
+var latencyBounds = [...]time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond, 50 * time.Millisecond,
+	75 * time.Millisecond, 100 * time.Millisecond, 150 * time.Millisecond, 200 * time.Millisecond,
+	300 * time.Millisecond, 500 * time.Millisecond, 750 * time.Millisecond, time.Second,
+	2 * time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+}
+
+// newRates returns the empty failure rates of providers
+func newRates(ps []Provider) *rates {
+	return &rates{
+		providers: ps,
+		rates:     make([]rate, len(ps)),
+	}
+}
+
+// add adds a query of provider to the rates, it is dropped if the provider is not in the rates
+func (r *rates) add(p Provider, failed bool) {
+	for k, v := range r.providers {
+		if sameProvider(v, p) {
+			r.rates[k].queries.Add(1)
+			if failed {
+				r.rates[k].errors.Add(1)
+			}
+			return
+		}
+	}
+}
+
+// sameProvider returns whether a and b are the same provider, the providers of uncomparable types never are
+func sameProvider(a, b Provider) bool {
+	t := reflect.TypeOf(a)
+	return t == reflect.TypeOf(b) && t.Comparable() && a == b
+}
+
+// get returns the failure rate of the k-th provider, false if it has not been queried
+func (r *rates) get(k int) (float64, bool) {
+	queries := r.rates[k].queries.Load()
+	if queries == 0 {
+		return 0, false
+	}
+
+	return float64(r.rates[k].errors.Load()) / float64(queries), true
+}
+
+// Stats returns the statistics of each provider since the client started,
+// the success rate excludes the queries canceled because a faster provider answered,
+// the providers of the same name are merged into the entry of the first one
+func (c *DoH) Stats() []Stats {
+	result := []Stats{}
+	seen := map[string]bool{}
+	ps, _ := c.list()
+	for _, p := range ps {
+		if seen[p.String()] {
+			continue
+		}
+		seen[p.String()] = true
+		result = append(result, c.counter(p.String()).stats(p.String()))
+	}
+
+	return result
+}
+
+// Healthy returns whether the provider is used, enabled and has not failed UnhealthyFailures queries in a row
+func (c *DoH) Healthy(provider int) bool {
+	if !c.ProviderEnabled(provider) {
+		return false
+	}
+
+	ps, kinds := c.list()
+	for k, v := range kinds {
+		if v == provider {
+			return c.counter(ps[k].String()).failures.Load() < UnhealthyFailures
+		}
+	}
+
+	return false
+}
+
+// Ready returns whether at least one provider is healthy
+func (c *DoH) Ready() bool {
+	_, kinds := c.list()
+	for _, v := range kinds {
+		if c.Healthy(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// counter returns the statistics counter of provider
+func (c *DoH) counter(provider string) *counter {
+	if v, ok := c.counters.Load(provider); ok {
+		return v.(*counter)
+	}
+
+	v, _ := c.counters.LoadOrStore(provider, &counter{})
+
+	return v.(*counter)
+}
+
+// record adds the event to the statistics
+func (c *DoH) record(e *Event) {
+	n := c.counter(e.Provider)
+	if e.Cached {
+		n.cacheHits.Add(1)
+		return
+	}
+
+	n.queries.Add(1)
+	if class := e.ErrorClass(); class != "" {
+		for k, v := range errorClasses {
+			if v == class {
+				n.errors[k].Add(1)
+			}
+		}
+		switch class {
+		case ErrorClassRcode:
+			n.failures.Store(0)
+		case ErrorClassCanceled:
+		default:
+			n.failures.Add(1)
+		}
+		return
+	}
+
+	n.failures.Store(0)
+	n.latency[sort.Search(len(latencyBounds), func(i int) bool {
+		return latencyBounds[i] >= e.Duration
+	})].Add(1)
+	n.successes.Add(1)
+}
+
+// stats returns the statistics of counter, the counters are loaded one by one and may be slightly inconsistent
+// under concurrent queries
+func (n *counter) stats(provider string) Stats {
+	s := Stats{
+		Provider:  provider,
+		Queries:   n.queries.Load(),
+		Successes: n.successes.Load(),
+		Errors:    map[string]int64{},
+		CacheHits: n.cacheHits.Load(),
+	}
+
+	for k, v := range errorClasses {
+		if m := n.errors[k].Load(); m > 0 {
+			s.Errors[v] = m
+		}
+	}
+
+	if total := s.Queries - s.Errors[ErrorClassCanceled]; total > 0 {
+		s.SuccessRate = min(float64(s.Successes)/float64(total), 1)
+	}
+
+	latency := [len(latencyBounds) + 1]int64{}
+	for k := range n.latency {
+		latency[k] = n.latency[k].Load()
+	}
+
+	s.P50 = percentileOf(latency[:], 0.5)
+	s.P90 = percentileOf(latency[:], 0.9)
+	s.P99 = percentileOf(latency[:], 0.99)
+
+	return s
+}
+
+// percentileOf returns the approximate latency percentile of the histogram buckets of successful queries
+func percentileOf(latency []int64, q float64) time.Duration {
+	count := int64(0)
+	for _, v := range latency {
+		count += v
+	}
+
+	if count == 0 {
+		return 0
+	}
+
+	rank, total := int64(float64(count)*q+0.5), int64(0)
+	if rank < 1 {
+		rank = 1
+	}
+
+	for k, v := range latency {
+		total += v
+		if total >= rank {
+			if k == len(latencyBounds) {
+				return latencyBounds[k-1]
+			}
+			return latencyBounds[k]
+		}
+	}
+
+	return latencyBounds[len(latencyBounds)-1]
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestStats(t *testing.T) {
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"Status":0}`)),
+			Request:    r,
+		}, nil
+	})
+
+	c := Use(GoogleProvider, Quad9Provider).SetRoundTripper(rt)
+	defer c.Close()
+
+	s := c.Stats()
+	assert.Equal(t, len(s), 2)
+	assert.Equal(t, s[0].Provider, "google")
+	assert.Equal(t, s[1].Provider, "quad9")
+	assert.Equal(t, s[0].Queries, int64(0))
+	assert.Equal(t, s[0].SuccessRate, float64(0))
+	assert.Equal(t, s[0].P50, time.Duration(0))
+
+	c = Use(GoogleProvider).SetRoundTripper(rt)
+	defer c.Close()
+
+	_, err := c.Query(context.Background(), "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+
+	for i := 0; i < 90; i++ {
+		c.record(&Event{Provider: "google", Response: &dns.Response{}, Duration: 8 * time.Millisecond})
+	}
+	for i := 0; i < 9; i++ {
+		c.record(&Event{Provider: "google", Response: &dns.Response{}, Duration: 400 * time.Millisecond})
+	}
+	c.record(&Event{Provider: "google", Response: &dns.Response{}, Duration: time.Minute})
+	c.record(&Event{Provider: "google", Err: errors.New("x"), Response: &dns.Response{Status: 2}})
+	c.record(&Event{Provider: "google", Err: context.Canceled})
+	c.record(&Event{Provider: "google", Cached: true})
+
+	s = c.Stats()
+	assert.Equal(t, s[0].Queries, int64(103))
+	assert.Equal(t, s[0].Successes, int64(101))
+	assert.Equal(t, s[0].Errors, map[string]int64{ErrorClassRcode: 1, ErrorClassCanceled: 1})
+	assert.Equal(t, s[0].CacheHits, int64(1))
+	assert.Equal(t, s[0].SuccessRate, float64(101)/float64(102))
+	assert.Equal(t, s[0].P50, 10*time.Millisecond)
+	assert.Equal(t, s[0].P90, 10*time.Millisecond)
+	assert.Equal(t, s[0].P99, 500*time.Millisecond)
+}
+
+func TestHealthy(t *testing.T) {
+	c := Use(GoogleProvider, Quad9Provider)
+	defer c.Close()
+
+	assert.True(t, c.Healthy(GoogleProvider))
+	assert.False(t, c.Healthy(CloudflareProvider))
+	assert.True(t, c.Ready())
+
+	for i := 0; i < UnhealthyFailures; i++ {
+		c.record(&Event{Provider: "google", Err: context.DeadlineExceeded})
+		c.record(&Event{Provider: "google", Err: context.Canceled})
+	}
+	assert.False(t, c.Healthy(GoogleProvider))
+	assert.True(t, c.Ready())
+
+	c.record(&Event{Provider: "google", Err: errors.New("x"), Response: &dns.Response{Status: 3}})
+	assert.True(t, c.Healthy(GoogleProvider))
+
+	c.SetProviderEnabled(Quad9Provider, false)
+	assert.False(t, c.Healthy(Quad9Provider))
+
+	for i := 0; i < UnhealthyFailures; i++ {
+		c.record(&Event{Provider: "google", Err: errors.New("x")})
+	}
+	assert.False(t, c.Ready())
+
+	c.record(&Event{Provider: "google", Response: &dns.Response{}})
+	assert.True(t, c.Ready())
+}
+
+func TestRecordConcurrent(t *testing.T) {
+	c := Use(GoogleProvider)
+	defer c.Close()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.record(&Event{Provider: "google", Response: &dns.Response{}, Duration: time.Millisecond})
+				c.record(&Event{Provider: "google", Err: context.DeadlineExceeded})
+				_ = c.Stats()
+			}
+		}()
+	}
+	wg.Wait()
+
+	s := c.Stats()
+	assert.Equal(t, s[0].Queries, int64(1600))
+	assert.Equal(t, s[0].Successes, int64(800))
+	assert.Equal(t, s[0].Errors, map[string]int64{ErrorClassTimeout: 800})
+	assert.Equal(t, s[0].P99, time.Millisecond)
+}
+
+func TestStatsSameName(t *testing.T) {
+	c := UseProviders(&staticProvider{name: "static", data: "1.2.3.4"}, &staticProvider{name: "static", data: "5.6.7.8"},
+		&staticProvider{name: "other", data: "1.2.3.4"})
+	defer c.Close()
+
+	c.record(&Event{Provider: "static", Response: &dns.Response{}})
+	c.record(&Event{Provider: "static", Err: errors.New("x")})
+
+	s := c.Stats()
+	assert.Equal(t, len(s), 2)
+	assert.Equal(t, s[0].Provider, "static")
+	assert.Equal(t, s[0].Queries, int64(2))
+	assert.Equal(t, s[1].Provider, "other")
+	assert.Equal(t, s[1].Queries, int64(0))
+}
+
+func TestRates(t *testing.T) {
+	c := Use(GoogleProvider, Quad9Provider)
+	defer c.Close()
+
+	ps, _ := c.list()
+	r := newRates(ps)
+	_, ok := r.get(0)
+	assert.False(t, ok)
+
+	r.add(ps[0], false)
+	r.add(ps[0], true)
+	r.add(ps[1], false)
+	o := Use(GoogleProvider)
+	defer o.Close()
+	r.add(o.providers[0], true)
+
+	v, ok := r.get(0)
+	assert.True(t, ok)
+	assert.Equal(t, v, 0.5)
+	v, ok = r.get(1)
+	assert.True(t, ok)
+	assert.Equal(t, v, float64(0))
+}
+
+func BenchmarkRecord(b *testing.B) {
+	c := Use(GoogleProvider)
+	defer c.Close()
+
+	e := &Event{Provider: "google", Response: &dns.Response{}, Duration: 8 * time.Millisecond}
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.record(e)
+		}
+	})
+}
+
+func TestSameProvider(t *testing.T) {
+	p := New(GoogleProvider)
+	assert.True(t, sameProvider(p, p))
+	assert.False(t, sameProvider(p, New(GoogleProvider)))
+	assert.False(t, sameProvider(p, recordProvider{}))
+	assert.False(t, sameProvider(recordProvider{}, recordProvider{}))
+}
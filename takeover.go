@@ -0,0 +1,143 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// MaxCNAMEChain is the max cnames followed by CheckCNAME
+const MaxCNAMEChain = 16
+
+// TakeoverServices is the zones of the services prone to subdomain takeover if the cname target is unclaimed,
+// and their names, it is read by CheckCNAME, so it must not be changed concurrently with it
+var TakeoverServices = map[string]string{
+	"s3.amazonaws.com":         "AWS S3",
+	"s3-website.amazonaws.com": "AWS S3",
+	"elasticbeanstalk.com":     "AWS Elastic Beanstalk",
+	"cloudfront.net":           "AWS CloudFront",
+	"azurewebsites.net":        "Azure App Service",
+	"cloudapp.net":             "Azure Cloud Services",
+	"cloudapp.azure.com":       "Azure Cloud Services",
+	"trafficmanager.net":       "Azure Traffic Manager",
+	"blob.core.windows.net":    "Azure Blob Storage",
+	"azureedge.net":            "Azure CDN",
+	"herokuapp.com":            "Heroku",
+	"herokudns.com":            "Heroku",
+	"github.io":                "GitHub Pages",
+	"bitbucket.io":             "Bitbucket",
+	"netlify.app":              "Netlify",
+	"netlify.com":              "Netlify",
+	"vercel.app":               "Vercel",
+	"surge.sh":                 "Surge",
+	"pantheonsite.io":          "Pantheon",
+	"ghost.io":                 "Ghost",
+	"myshopify.com":            "Shopify",
+	"wordpress.com":            "WordPress",
+	"zendesk.com":              "Zendesk",
+	"readthedocs.io":           "Read the Docs",
+	"helpscoutdocs.com":        "Help Scout",
+	"unbouncepages.com":        "Unbounce",
+	"fly.dev":                  "Fly.io",
+}
+
+// CNAMEReport is the cname chain of a name, for the subdomain takeover detection
+type CNAMEReport struct {
+	Name dns.Domain
+	// Chain is the cname targets followed in order, empty if the name is not a cname
+	Chain []string
+	// Dangling is whether the last target does not exist, which may be claimed by anyone
+	Dangling bool
+	// Service is the takeover prone service of the targets, empty if none
+	Service string
+}
+
+// Target returns the last target of cname chain, empty if the name is not a cname
+func (r *CNAMEReport) Target() string {
+	if len(r.Chain) == 0 {
+		return ""
+	}
+
+	return r.Chain[len(r.Chain)-1]
+}
+
+// Risky returns whether the name may be taken over, it is dangling or points at a takeover prone service,
+// whose claim should be verified by the service
+func (r *CNAMEReport) Risky() bool {
+	return r.Dangling || r.Service != ""
+}
+
+// CheckCNAME returns the cname chain of name followed hop by hop, the targets answering NXDOMAIN are dangling,
+// and the ones of TakeoverServices are flagged, an error is returned if a query fails or the chain loops,
+// with the report of the chain followed
+func (c *DoH) CheckCNAME(ctx context.Context, d dns.Domain) (*CNAMEReport, error) {
+	r := &CNAMEReport{Name: d, Chain: []string{}}
+
+	name := dns.Canonical(string(d))
+	seen := map[string]bool{name: true}
+	for {
+		rsp, err := c.Query(ctx, dns.Domain(name), dns.TypeCNAME)
+		if rsp == nil {
+			return r, err
+		}
+
+		if rsp.Status == 3 && len(r.Chain) > 0 {
+			r.Dangling = true
+			return r, nil
+		}
+
+		if err != nil {
+			return r, err
+		}
+
+		target, ok := cnameOf(rsp, name)
+		if !ok {
+			return r, nil
+		}
+
+		name = target
+		r.Chain = append(r.Chain, name)
+		if zone, ok := matchZone(name, TakeoverServices); ok && r.Service == "" {
+			r.Service = TakeoverServices[zone]
+		}
+
+		if seen[name] {
+			return r, fmt.Errorf("doh: cname loop of %s at %s", d, name)
+		}
+		if len(r.Chain) >= MaxCNAMEChain {
+			return r, fmt.Errorf("doh: cname chain of %s longer than %d", d, MaxCNAMEChain)
+		}
+		seen[name] = true
+	}
+}
+
+// cnameOf returns the canonical cname target of name in the answers of rsp
+func cnameOf(rsp *dns.Response, name string) (string, bool) {
+	for v := range rsp.Answers(dns.TypeCNAME) {
+		if dns.Equal(v.Name, name) {
+			return dns.Canonical(v.Data), true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/dohtest"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestCheckCNAME(t *testing.T) {
+	p := dohtest.New("fake")
+	p.Answer("www.likexian.com", dns.TypeCNAME, "cdn.likexian.com.")
+	p.Answer("cdn.likexian.com", dns.TypeCNAME, "likexian.github.io.")
+	p.On("likexian.github.io", dns.TypeCNAME)
+	p.Answer("old.likexian.com", dns.TypeCNAME, "gone.example.")
+	p.Answer("loop.likexian.com", dns.TypeCNAME, "loop2.likexian.com.")
+	p.Answer("loop2.likexian.com", dns.TypeCNAME, "Loop.likexian.com.")
+	p.On("likexian.com", dns.TypeCNAME)
+	p.Answer("down.likexian.com", dns.TypeCNAME, "fail.example.")
+	p.On("fail.example", "").Error(errors.New("injected"))
+
+	c := UseProviders(p)
+	defer c.Close()
+
+	ctx := context.Background()
+	r, err := c.CheckCNAME(ctx, "www.likexian.com")
+	assert.Nil(t, err)
+	assert.Equal(t, r.Chain, []string{"cdn.likexian.com.", "likexian.github.io."})
+	assert.Equal(t, r.Target(), "likexian.github.io.")
+	assert.False(t, r.Dangling)
+	assert.Equal(t, r.Service, "GitHub Pages")
+	assert.True(t, r.Risky())
+
+	r, err = c.CheckCNAME(ctx, "old.likexian.com")
+	assert.Nil(t, err)
+	assert.Equal(t, r.Target(), "gone.example.")
+	assert.True(t, r.Dangling)
+	assert.Equal(t, r.Service, "")
+	assert.True(t, r.Risky())
+
+	r, err = c.CheckCNAME(ctx, "likexian.com")
+	assert.Nil(t, err)
+	assert.Equal(t, r.Target(), "")
+	assert.False(t, r.Risky())
+
+	_, err = c.CheckCNAME(ctx, "nx.likexian.com")
+	assert.NotNil(t, err)
+
+	r, err = c.CheckCNAME(ctx, "loop.likexian.com")
+	assert.Contains(t, err.Error(), "cname loop")
+	assert.Equal(t, r.Chain, []string{"loop2.likexian.com.", "loop.likexian.com."})
+
+	r, err = c.CheckCNAME(ctx, "down.likexian.com")
+	assert.NotNil(t, err)
+	assert.Equal(t, r.Chain, []string{"fail.example."})
+
+	for i := range MaxCNAMEChain + 1 {
+		p.Answer(dns.Domain(fmt.Sprintf("c%d.likexian.com", i)), dns.TypeCNAME, fmt.Sprintf("c%d.likexian.com.", i+1))
+	}
+	r, err = c.CheckCNAME(ctx, "c0.likexian.com")
+	assert.Contains(t, err.Error(), "longer than")
+	assert.Equal(t, len(r.Chain), MaxCNAMEChain)
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package tracing
+
+import (
+	"context"
+
+	"github.com/ideatocode/doh-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer emits opentelemetry spans of DoH queries
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// spanKey is the context key of query span
+type spanKey struct{}
+
+const (
+	// scopeName is the instrumentation scope name
+	scopeName = "github.com/ideatocode/doh-go/tracing"
+	// spanName is the name of query span
+	spanName = "doh.query"
+)
+
+// Version returns package version
+func Version() string {
+	return "0.1.0"
+}
+
+// Author returns package author
+func Author() string {
+	return "[Li Kexian](https://www.likexian.com/)"
+}
+
+// License returns package license
+func License() string {
+	return "Licensed under the Apache License 2.0"
+}
+
+// New returns a new tracer using the tracer provider, nil to use the global one
+func New(tp trace.TracerProvider) *Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	return &Tracer{
+		tracer: tp.Tracer(scopeName, trace.WithInstrumentationVersion(Version())),
+	}
+}
+
+// Register add the tracer hooks to client
+func (t *Tracer) Register(c *doh.DoH) *doh.DoH {
+	return c.AddStartHook(t.StartHook).AddHook(t.Hook)
+}
+
+// StartHook starts a span of provider query as a child of the context span
+func (t *Tracer) StartHook(ctx context.Context, e *doh.Event) context.Context {
+	ctx, span := t.tracer.Start(ctx, spanName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(e.Start),
+		trace.WithAttributes(attributes(ctx, e)...),
+	)
+
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// Hook ends the span of provider query, or records a span of cache hit
+func (t *Tracer) Hook(ctx context.Context, e *doh.Event) {
+	span, ok := ctx.Value(spanKey{}).(trace.Span)
+	if !ok {
+		_, span = t.tracer.Start(ctx, spanName,
+			trace.WithSpanKind(trace.SpanKindInternal),
+			trace.WithTimestamp(e.Start),
+			trace.WithAttributes(attributes(ctx, e)...),
+		)
+	}
+
+	span.SetAttributes(
+		attribute.Bool("doh.cache_hit", e.Cached),
+		attribute.Int("dns.rcode", e.Rcode()),
+	)
+
+	if e.Err != nil {
+		class := e.ErrorClass()
+		span.SetAttributes(attribute.String("doh.error_class", class))
+		span.RecordError(e.Err)
+		// the slower providers are canceled once the fastest one answers
+		if class != doh.ErrorClassCanceled {
+			span.SetStatus(codes.Error, e.Err.Error())
+		}
+	}
+
+	span.End(trace.WithTimestamp(e.Start.Add(e.Duration)))
+}
+
+// attributes returns the query attributes of event
+func attributes(ctx context.Context, e *doh.Event) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("doh.provider", e.Provider),
+		attribute.String("dns.question.name", string(e.Domain)),
+		attribute.String("dns.question.type", string(e.Type)),
+	}
+
+	if id := doh.CorrelationID(ctx); id != "" {
+		attrs = append(attrs, attribute.String("doh.correlation_id", id))
+	}
+
+	return attrs
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package tracing
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ideatocode/doh-go"
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestVersion(t *testing.T) {
+	assert.Contains(t, Version(), ".")
+	assert.Contains(t, Author(), "likexian")
+	assert.Contains(t, License(), "Apache License")
+}
+
+func TestTracer(t *testing.T) {
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		assert.True(t, trace.SpanContextFromContext(r.Context()).IsValid())
+		body := `{"Status":0,"Answer":[{"name":"likexian.com.","type":1,"TTL":300,"data":"1.1.1.1"}]}`
+		if r.URL.Query().Get("name") == "nx.likexian.com" {
+			body = `{"Status":3}`
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	c := New(tp).Register(doh.Use(doh.GoogleProvider).SetRoundTripper(rt).EnableCache(true))
+	defer c.Close()
+
+	ctx, parent := tp.Tracer("test").Start(doh.WithCorrelationID(context.Background(), "req-1"), "parent")
+	_, err := c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	_, err = c.Query(ctx, "likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	_, err = c.Query(ctx, "nx.likexian.com", dns.TypeA)
+	assert.NotNil(t, err)
+	parent.End()
+
+	spans := sr.Ended()
+	assert.Equal(t, len(spans), 5)
+
+	attrs := func(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+		m := map[attribute.Key]attribute.Value{}
+		for _, v := range s.Attributes() {
+			m[v.Key] = v.Value
+		}
+		return m
+	}
+
+	s := spans[0]
+	assert.Equal(t, s.Name(), "doh.query")
+	assert.Equal(t, s.Parent().SpanID(), parent.SpanContext().SpanID())
+	assert.Equal(t, s.SpanKind(), trace.SpanKindClient)
+	a := attrs(s)
+	assert.Equal(t, a["doh.provider"].AsString(), "google")
+	assert.Equal(t, a["dns.question.name"].AsString(), "likexian.com")
+	assert.Equal(t, a["dns.question.type"].AsString(), "A")
+	assert.Equal(t, a["dns.rcode"].AsInt64(), int64(0))
+	assert.False(t, a["doh.cache_hit"].AsBool())
+	assert.Equal(t, a["doh.correlation_id"].AsString(), "req-1")
+
+	s = spans[1]
+	assert.Equal(t, s.Parent().SpanID(), parent.SpanContext().SpanID())
+	assert.True(t, attrs(s)["doh.cache_hit"].AsBool())
+
+	s = spans[2]
+	a = attrs(s)
+	assert.Equal(t, a["dns.rcode"].AsInt64(), int64(3))
+	assert.Equal(t, a["doh.error_class"].AsString(), doh.ErrorClassRcode)
+	assert.Equal(t, s.Status().Code, codes.Error)
+
+	assert.Equal(t, spans[4].Name(), "parent")
+}
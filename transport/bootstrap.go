@@ -0,0 +1,156 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"strings"
+)
+
+// Resolver resolves hostname of upstream to ip addresses
+type Resolver interface {
+	LookupIP(ctx context.Context, host string) ([]net.IP, error)
+}
+
+// ResolverFunc is a func implementing Resolver
+type ResolverFunc func(ctx context.Context, host string) ([]net.IP, error)
+
+// LookupIP calls f(ctx, host)
+func (f ResolverFunc) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	return f(ctx, host)
+}
+
+// NewStaticResolver returns a resolver which always resolves to the ips
+func NewStaticResolver(ips ...string) (Resolver, error) {
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("doh: transport: no bootstrap ip specified")
+	}
+
+	rs := []net.IP{}
+	for _, v := range ips {
+		ip := net.ParseIP(strings.TrimSpace(v))
+		if ip == nil {
+			return nil, fmt.Errorf("doh: transport: invalid bootstrap ip: %s", v)
+		}
+		rs = append(rs, ip)
+	}
+
+	return ResolverFunc(func(context.Context, string) ([]net.IP, error) {
+		return rs, nil
+	}), nil
+}
+
+// NewDNSResolver returns a resolver querying the plain dns server, for example: 9.9.9.9:53
+func NewDNSResolver(server string) Resolver {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			d := net.Dialer{}
+			return d.DialContext(ctx, network, server)
+		},
+	}
+
+	return ResolverFunc(func(ctx context.Context, host string) ([]net.IP, error) {
+		addrs, err := r.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		ips := []net.IP{}
+		for _, v := range addrs {
+			ips = append(ips, v.IP)
+		}
+		return ips, nil
+	})
+}
+
+// SetBootstrap set the resolver used to resolve hostname of upstream instead of the system resolver, nil to disable
+func (t *Transport) SetBootstrap(r Resolver) *Transport {
+	t.Lock()
+	t.bootstrap = r
+	t.reset()
+	t.Unlock()
+
+	return t
+}
+
+// SetBootstrapIPs set the static ips to connect to instead of resolving hostname of upstream, empty to disable
+func (t *Transport) SetBootstrapIPs(ips ...string) error {
+	if len(ips) == 0 {
+		t.SetBootstrap(nil)
+		return nil
+	}
+
+	r, err := NewStaticResolver(ips...)
+	if err != nil {
+		return err
+	}
+
+	t.SetBootstrap(r)
+
+	return nil
+}
+
+// resolve returns the addresses to dial for addr with the bootstrap resolver
+func resolve(ctx context.Context, r Resolver, addr string) ([]string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if r == nil || net.ParseIP(host) != nil {
+		return []string{addr}, nil
+	}
+
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.DNSStart != nil {
+		trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+	}
+
+	ips, err := r.LookupIP(ctx, host)
+	if trace != nil && trace.DNSDone != nil {
+		addrs := []net.IPAddr{}
+		for _, v := range ips {
+			addrs = append(addrs, net.IPAddr{IP: v})
+		}
+		trace.DNSDone(httptrace.DNSDoneInfo{Addrs: addrs, Err: err})
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("doh: transport: bootstrap %s failed: %s", host, err)
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("doh: transport: bootstrap %s failed: no address found", host)
+	}
+
+	addrs := []string{}
+	for _, v := range ips {
+		addrs = append(addrs, net.JoinHostPort(v.String(), port))
+	}
+
+	return addrs, nil
+}
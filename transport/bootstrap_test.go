@@ -0,0 +1,91 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestSetBootstrapIPs(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Host)
+	}))
+	defer ts.Close()
+
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	surl := "http://dns.bootstrap.invalid:" + port + "/dns-query"
+
+	tr := New()
+	err := tr.SetBootstrapIPs("xx")
+	assert.NotNil(t, err)
+
+	err = tr.SetBootstrapIPs("192.0.2.1", "127.0.0.1")
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	rsp, err := tr.Get(ctx, surl, nil, nil)
+	assert.Nil(t, err)
+	defer rsp.Close()
+	s, err := rsp.String()
+	assert.Nil(t, err)
+	assert.Equal(t, s, "dns.bootstrap.invalid:"+port)
+
+	err = tr.SetBootstrapIPs()
+	assert.Nil(t, err)
+	assert.NotNil(t, tr.Client().Transport)
+}
+
+func TestSetBootstrap(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	surl := "http://dns.bootstrap.invalid:" + port + "/dns-query"
+
+	hosts := []string{}
+	tr := New().SetBootstrap(ResolverFunc(func(ctx context.Context, host string) ([]net.IP, error) {
+		hosts = append(hosts, host)
+		return []net.IP{net.ParseIP("127.0.0.1")}, nil
+	}))
+
+	rsp, err := tr.Get(context.Background(), surl, nil, nil)
+	assert.Nil(t, err)
+	rsp.Close()
+	assert.Equal(t, hosts, []string{"dns.bootstrap.invalid"})
+
+	tr.SetBootstrap(ResolverFunc(func(ctx context.Context, host string) ([]net.IP, error) {
+		return nil, nil
+	}))
+	_, err = tr.Get(context.Background(), surl, nil, nil)
+	assert.NotNil(t, err)
+
+	_, err = NewStaticResolver()
+	assert.NotNil(t, err)
+
+	r := NewDNSResolver("127.0.0.1")
+	assert.NotNil(t, r)
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package brotli
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/ideatocode/doh-go/transport"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestDecoder(t *testing.T) {
+	data := []byte(strings.Repeat("likexian", 1000))
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "br") {
+			_, _ = w.Write(data)
+			return
+		}
+		var buf bytes.Buffer
+		bw := brotli.NewWriter(&buf)
+		_, _ = bw.Write(data)
+		_ = bw.Close()
+		w.Header().Set("Content-Encoding", "br")
+		_, _ = w.Write(buf.Bytes())
+	}))
+	defer ts.Close()
+
+	rsp, err := transport.New().Get(context.Background(), ts.URL, nil, nil)
+	assert.Nil(t, err)
+	defer rsp.Close()
+
+	assert.Equal(t, rsp.Header.Get("Content-Encoding"), "br")
+	b, err := rsp.Bytes()
+	assert.Nil(t, err)
+	assert.Equal(t, b, data)
+}
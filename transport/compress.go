@@ -0,0 +1,95 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Decoder returns the reader decoding a content encoded body
+type Decoder func(io.Reader) (io.Reader, error)
+
+// decoders is the decoders of content encodings, the brotli decoder is registered by the transport/brotli package
+var decoders = map[string]Decoder{
+	"gzip":    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+	"x-gzip":  func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+	"deflate": func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+}
+
+// encodings is the content encodings sent in the Accept-Encoding header
+var encodings = []string{"gzip", "deflate"}
+
+// decodersMu guards decoders and encodings
+var decodersMu sync.RWMutex
+
+// RegisterDecoder registers the decoder of content encoding, it is accepted in the requests when compression
+// is enabled, for example br by importing the transport/brotli package
+func RegisterDecoder(encoding string, d Decoder) {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+
+	if _, ok := decoders[encoding]; !ok {
+		encodings = append(encodings, encoding)
+	}
+	decoders[encoding] = d
+}
+
+// SetCompression set whether to accept gzip, deflate and the registered encoded responses, default is true,
+// the decompressed body is limited by the max body size
+func (t *Transport) SetCompression(enable bool) *Transport {
+	t.Lock()
+	t.compression = enable
+	t.Unlock()
+
+	return t
+}
+
+// acceptEncoding returns the Accept-Encoding header sent when compression is enabled
+func acceptEncoding() string {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+
+	return strings.Join(encodings, ", ")
+}
+
+// decoder returns the reader decoding body by content encoding
+func decoder(encoding string, body io.Reader) (io.Reader, error) {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "" || encoding == "identity" {
+		return body, nil
+	}
+
+	decodersMu.RLock()
+	d, ok := decoders[encoding]
+	decodersMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("doh: transport: not supported content encoding: %s", encoding)
+	}
+
+	return d(body)
+}
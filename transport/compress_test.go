@@ -0,0 +1,119 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func compress(encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "x-base64":
+		w = base64.NewEncoder(base64.StdEncoding, &buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	default:
+		return data
+	}
+
+	_, _ = w.Write(data)
+	_ = w.Close()
+
+	return buf.Bytes()
+}
+
+func TestCompression(t *testing.T) {
+	RegisterDecoder("X-Base64", func(r io.Reader) (io.Reader, error) {
+		return base64.NewDecoder(base64.StdEncoding, r), nil
+	})
+
+	data := []byte(strings.Repeat("likexian", 1000))
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := r.URL.Query().Get("encoding")
+		if encoding == "auto" {
+			for _, v := range []string{"x-base64", "gzip"} {
+				if strings.Contains(r.Header.Get("Accept-Encoding"), v) {
+					encoding = v
+					break
+				}
+			}
+		}
+		if encoding != "" && encoding != "auto" {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+		_, _ = w.Write(compress(encoding, data))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	tr := New()
+
+	get := func(encoding string) ([]byte, string, error) {
+		rsp, err := tr.Get(ctx, ts.URL+"?encoding="+encoding, nil, nil)
+		assert.Nil(t, err)
+		defer rsp.Close()
+		b, err := rsp.Bytes()
+		return b, rsp.Header.Get("Content-Encoding"), err
+	}
+
+	for _, v := range []string{"", "gzip", "x-base64", "deflate", "auto"} {
+		b, _, err := get(v)
+		assert.Nil(t, err)
+		assert.Equal(t, b, data)
+	}
+
+	_, encoding, err := get("auto")
+	assert.Nil(t, err)
+	assert.Equal(t, encoding, "x-base64")
+
+	for _, v := range []string{"br", "compress"} {
+		_, _, err = get(v)
+		assert.NotNil(t, err)
+	}
+
+	tr.SetMaxBodySize(int64(len(data) - 1))
+	for _, v := range []string{"gzip", "x-base64", "deflate"} {
+		_, _, err := get(v)
+		assert.NotNil(t, err)
+	}
+
+	tr.SetMaxBodySize(0).SetCompression(false)
+	b, encoding, err := get("auto")
+	assert.Nil(t, err)
+	assert.Equal(t, encoding, "")
+	assert.Equal(t, b, data)
+}
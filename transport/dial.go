@@ -0,0 +1,156 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// dialFunc is the func to dial upstream connections
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// SetLocalAddr set the local ip address of upstream connections, empty to let the system choose
+func (t *Transport) SetLocalAddr(addr string) error {
+	var ip net.IP
+	if strings.TrimSpace(addr) != "" {
+		ip = net.ParseIP(strings.TrimSpace(addr))
+		if ip == nil {
+			return fmt.Errorf("doh: transport: invalid local address: %s", addr)
+		}
+	}
+
+	t.Lock()
+	t.localAddr = ip
+	t.reset()
+	t.Unlock()
+
+	return nil
+}
+
+// SetInterface set the network interface of upstream connections, empty to let the system choose,
+// connections are bound to an address of the interface of the same family as the upstream
+func (t *Transport) SetInterface(name string) error {
+	name = strings.TrimSpace(name)
+	if name != "" {
+		if _, err := net.InterfaceByName(name); err != nil {
+			return fmt.Errorf("doh: transport: invalid interface: %s", err)
+		}
+	}
+
+	t.Lock()
+	t.iface = name
+	t.reset()
+	t.Unlock()
+
+	return nil
+}
+
+// dialer returns the dial func of the options, must hold the lock
+func (t *Transport) dialer() dialFunc {
+	d := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	if t.keepAlive != 0 {
+		d.KeepAlive = t.keepAlive
+	}
+
+	if t.timeout.Dial > 0 {
+		d.Timeout = t.timeout.Dial
+	}
+
+	local, iface, bootstrap := t.localAddr, t.iface, t.bootstrap
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		addrs, err := resolve(ctx, bootstrap, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range addrs {
+			dd := *d
+
+			ip := local
+			if ip == nil && iface != "" {
+				ip, err = interfaceAddr(iface, v)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			if ip != nil {
+				dd.LocalAddr = &net.TCPAddr{IP: ip}
+			}
+
+			var conn net.Conn
+			conn, err = dd.DialContext(ctx, network, v)
+			if err == nil {
+				return conn, nil
+			}
+		}
+
+		return nil, err
+	}
+}
+
+// interfaceAddr returns the address of interface to dial addr from
+func interfaceAddr(name, addr string) (net.IP, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("doh: transport: invalid interface: %s", err)
+	}
+
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("doh: transport: invalid interface: %s", err)
+	}
+
+	ipv6 := false
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			ipv6 = ip.To4() == nil
+		}
+	}
+
+	var fallback net.IP
+	for _, v := range addrs {
+		n, ok := v.(*net.IPNet)
+		if !ok || n.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if (n.IP.To4() == nil) == ipv6 {
+			return n.IP, nil
+		}
+		if fallback == nil {
+			fallback = n.IP
+		}
+	}
+
+	if fallback == nil {
+		return nil, fmt.Errorf("doh: transport: no usable address on interface %s", name)
+	}
+
+	return fallback, nil
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func loopbackInterface() string {
+	ifs, _ := net.Interfaces()
+	for _, v := range ifs {
+		if v.Flags&net.FlagLoopback != 0 {
+			return v.Name
+		}
+	}
+
+	return ""
+}
+
+func TestSetLocalAddr(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		fmt.Fprint(w, host)
+	}))
+	defer ts.Close()
+
+	tr := New()
+	err := tr.SetLocalAddr("xx")
+	assert.NotNil(t, err)
+
+	err = tr.SetLocalAddr("127.0.0.1")
+	assert.Nil(t, err)
+
+	rsp, err := tr.Get(context.Background(), ts.URL, nil, nil)
+	assert.Nil(t, err)
+	defer rsp.Close()
+	s, err := rsp.String()
+	assert.Nil(t, err)
+	assert.Equal(t, s, "127.0.0.1")
+
+	err = tr.SetLocalAddr("")
+	assert.Nil(t, err)
+	assert.NotNil(t, tr.Client().Transport)
+}
+
+func TestSetInterface(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	tr := New()
+	err := tr.SetInterface("not-exists-interface")
+	assert.NotNil(t, err)
+
+	name := loopbackInterface()
+	if name == "" {
+		t.Skip("no loopback interface")
+	}
+
+	err = tr.SetInterface(name)
+	assert.Nil(t, err)
+
+	rsp, err := tr.Get(context.Background(), ts.URL, nil, nil)
+	assert.Nil(t, err)
+	rsp.Close()
+
+	ip, err := interfaceAddr(name, "127.0.0.1:53")
+	assert.Nil(t, err)
+	assert.True(t, ip.IsLoopback())
+
+	err = tr.SetInterface("")
+	assert.Nil(t, err)
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// MetadataHeaders is the upstream response headers kept in response metadata,
+// a trailing * matches any header with the prefix
+var MetadataHeaders = []string{
+	"Age",
+	"Cache-Control",
+	"Content-Type",
+	"Date",
+	"Retry-After",
+	"Server",
+	"RateLimit*",
+	"X-RateLimit*",
+	"CF-Ray",
+}
+
+// RemoteAddr returns the address of upstream connection, empty if unknown
+func (r *Response) RemoteAddr() string {
+	return r.tracer.address()
+}
+
+// Timing returns the timing breakdown of request, Total is till the body is read
+func (r *Response) Timing() *dns.Timing {
+	return r.tracer.timing()
+}
+
+// Metadata returns the http metadata of response
+func (r *Response) Metadata() *dns.Metadata {
+	m := &dns.Metadata{
+		StatusCode: r.StatusCode,
+		Protocol:   r.Proto,
+		Header:     http.Header{},
+		Upstream:   "",
+		RemoteAddr: r.RemoteAddr(),
+		Timing:     r.Timing(),
+	}
+
+	if r.Request != nil && r.Request.URL != nil {
+		u := *r.Request.URL
+		u.RawQuery = ""
+		m.Upstream = u.String()
+	}
+
+	if r.Request != nil {
+		m.CorrelationID = dns.CorrelationID(r.Request.Context())
+	}
+
+	for k, v := range r.Header {
+		if keepHeader(k) {
+			m.Header[k] = append([]string{}, v...)
+		}
+	}
+
+	return m
+}
+
+// keepHeader returns whether the header is kept in metadata
+func keepHeader(name string) bool {
+	for _, v := range MetadataHeaders {
+		if strings.HasSuffix(v, "*") {
+			if strings.HasPrefix(strings.ToLower(name), strings.ToLower(strings.TrimSuffix(v, "*"))) {
+				return true
+			}
+		} else if strings.EqualFold(name, v) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestMetadata(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=300")
+		w.Header().Set("Age", "10")
+		w.Header().Set("X-Ratelimit-Remaining", "99")
+		w.Header().Set("X-Secret", "likexian")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	ctx := dns.WithCorrelationID(context.Background(), "req-1")
+	rsp, err := New().Get(ctx, ts.URL+"/dns-query", url.Values{"name": {"likexian.com"}}, nil)
+	assert.Nil(t, err)
+	defer rsp.Close()
+
+	assert.Equal(t, rsp.RemoteAddr(), ts.Listener.Addr().String())
+
+	m := rsp.Metadata()
+	assert.Equal(t, m.StatusCode, http.StatusTooManyRequests)
+	assert.Equal(t, m.Protocol, "HTTP/1.1")
+	assert.Equal(t, m.Upstream, ts.URL+"/dns-query")
+	assert.Equal(t, m.RemoteAddr, ts.Listener.Addr().String())
+	assert.Equal(t, m.Header.Get("Cache-Control"), "max-age=300")
+	assert.Equal(t, m.Header.Get("Age"), "10")
+	assert.Equal(t, m.Header.Get("X-Ratelimit-Remaining"), "99")
+	assert.Equal(t, m.Header.Get("X-Secret"), "")
+	assert.Equal(t, m.CorrelationID, "req-1")
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Pin returns the SPKI pin of certificate, it is the base64 of sha256 hash of SubjectPublicKeyInfo
+func Pin(cert *x509.Certificate) string {
+	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// SetPins set the SPKI pins of upstream certificates, empty to disable pinning,
+// a pin is sha256 hash of SubjectPublicKeyInfo in hex (as in DNS stamps) or base64,
+// connections whose verified certificate chains contain none of the pinned keys are rejected, the pins are not
+// applied to a custom client, round tripper or http3 round tripper, so it fails if one is set, and the requests
+// fail if one is set later
+func (t *Transport) SetPins(pins ...string) error {
+	ps := [][]byte{}
+	for _, v := range pins {
+		p, err := parsePin(v)
+		if err != nil {
+			return err
+		}
+		ps = append(ps, p)
+	}
+
+	t.Lock()
+	if len(ps) > 0 && t.custom() {
+		t.Unlock()
+		return errCustomPins
+	}
+	t.pins = ps
+	t.reset()
+	t.Unlock()
+
+	return nil
+}
+
+// parsePin returns the sha256 hash of pin
+func parsePin(pin string) ([]byte, error) {
+	pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+
+	b, err := hex.DecodeString(strings.Replace(pin, ":", "", -1))
+	if err == nil && len(b) == sha256.Size {
+		return b, nil
+	}
+
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		b, err = enc.DecodeString(pin)
+		if err == nil && len(b) == sha256.Size {
+			return b, nil
+		}
+	}
+
+	return nil, fmt.Errorf("doh: transport: invalid spki pin: %s", pin)
+}
+
+// errCustomPins is the error of requests with pins by a custom client or round tripper, which are not pinned
+var errCustomPins = errors.New("doh: transport: spki pins are not applied to a custom client or round tripper")
+
+// verifyPins returns a tls connection verifier checking the verified chains contain a pinned key, the other
+// certificates sent by the peer are not trusted, only the leaf is checked if the verification is skipped
+func verifyPins(pins [][]byte) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		certs := []*x509.Certificate{}
+		for _, chain := range cs.VerifiedChains {
+			certs = append(certs, chain...)
+		}
+		if len(cs.VerifiedChains) == 0 && len(cs.PeerCertificates) > 0 {
+			certs = append(certs, cs.PeerCertificates[0])
+		}
+
+		for _, cert := range certs {
+			h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, p := range pins {
+				if bytes.Equal(h[:], p) {
+					return nil
+				}
+			}
+		}
+
+		return fmt.Errorf("doh: transport: no pinned key found in certificate chain of %s", cs.ServerName)
+	}
+}
+
+// custom returns whether a custom client, round tripper or http3 round tripper is set, must hold the lock
+func (t *Transport) custom() bool {
+	return t.transport != nil || t.client != nil && t.client.Transport != nil || t.http3 != nil
+}
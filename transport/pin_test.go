@@ -0,0 +1,185 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestSetPins(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+
+	ctx := context.Background()
+	tr := New().SetRootCAs(pool)
+
+	err := tr.SetPins("xx")
+	assert.NotNil(t, err)
+
+	err = tr.SetPins("AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=")
+	assert.Nil(t, err)
+	_, err = tr.Get(ctx, ts.URL, nil, nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no pinned key")
+
+	err = tr.SetPins(Pin(ts.Certificate()))
+	assert.Nil(t, err)
+	rsp, err := tr.Get(ctx, ts.URL, nil, nil)
+	assert.Nil(t, err)
+	rsp.Close()
+
+	h := sha256.Sum256(ts.Certificate().RawSubjectPublicKeyInfo)
+	err = tr.SetPins("AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=", hex.EncodeToString(h[:]))
+	assert.Nil(t, err)
+	rsp, err = tr.Get(ctx, ts.URL, nil, nil)
+	assert.Nil(t, err)
+	rsp.Close()
+
+	err = tr.SetPins()
+	assert.Nil(t, err)
+	rsp, err = tr.Get(ctx, ts.URL, nil, nil)
+	assert.Nil(t, err)
+	rsp.Close()
+}
+
+// newCert returns a certificate of key signed by parent, self signed if parent is nil
+func newCert(t *testing.T, name string, key *ecdsa.PrivateKey, parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	return cert
+}
+
+func TestPinsUnverifiedCerts(t *testing.T) {
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.Nil(t, err)
+		return key
+	}
+
+	caKey, leafKey, pinnedKey := newKey(), newKey(), newKey()
+	ca := newCert(t, "ca", caKey, nil, nil)
+	leaf := newCert(t, "leaf", leafKey, ca, caKey)
+	// the extra cert carries the pinned key, but it is not in the verified chain
+	extra := newCert(t, "extra", pinnedKey, nil, nil)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw, extra.Raw},
+		PrivateKey: leafKey}}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	ctx := context.Background()
+	tr := New().SetRootCAs(pool)
+
+	assert.Nil(t, tr.SetPins(Pin(extra)))
+	_, err := tr.Get(ctx, ts.URL, nil, nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no pinned key")
+
+	assert.Nil(t, tr.SetPins(Pin(ca)))
+	rsp, err := tr.Get(ctx, ts.URL, nil, nil)
+	assert.Nil(t, err)
+	rsp.Close()
+
+	tr = New().SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+	assert.Nil(t, tr.SetPins(Pin(extra)))
+	_, err = tr.Get(ctx, ts.URL, nil, nil)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, tr.SetPins(Pin(ca)))
+	_, err = tr.Get(ctx, ts.URL, nil, nil)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, tr.SetPins(Pin(leaf)))
+	rsp, err = tr.Get(ctx, ts.URL, nil, nil)
+	assert.Nil(t, err)
+	rsp.Close()
+}
+
+func TestPinsCustomTransport(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	pin := Pin(ts.Certificate())
+
+	err := New().SetRoundTripper(ts.Client().Transport).SetPins(pin)
+	assert.Equal(t, err, errCustomPins)
+
+	err = New().SetClient(ts.Client()).SetPins(pin)
+	assert.Equal(t, err, errCustomPins)
+
+	tr := New()
+	err = tr.SetPins(pin)
+	assert.Nil(t, err)
+	tr.SetRoundTripper(ts.Client().Transport)
+	_, err = tr.Get(ctx, ts.URL, nil, nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "not applied to a custom")
+
+	assert.Nil(t, tr.SetPins())
+	rsp, err := tr.Get(ctx, ts.URL, nil, nil)
+	assert.Nil(t, err)
+	rsp.Close()
+
+	err = New().SetClient(&http.Client{Timeout: time.Second}).SetPins(pin)
+	assert.Nil(t, err)
+}
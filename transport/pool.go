@@ -0,0 +1,62 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"net/http"
+)
+
+// Pool is the connection pool limits of upstream connections, 0 to use the default
+type Pool struct {
+	// MaxIdleConns is the max idle connections across all hosts, default is 100, negative for no limit
+	MaxIdleConns int
+	// MaxIdleConnsPerHost is the max idle connections per host, default is 2
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost is the max connections per host including active ones, default is no limit
+	MaxConnsPerHost int
+}
+
+// SetPool set the connection pool limits of upstream connections, they are not applied to a custom client or
+// round tripper
+func (t *Transport) SetPool(pool Pool) *Transport {
+	t.Lock()
+	t.pool = pool
+	t.reset()
+	t.Unlock()
+
+	return t
+}
+
+// apply sets the pool limits to http transport
+func (p Pool) apply(tr *http.Transport) {
+	if p.MaxIdleConns > 0 {
+		tr.MaxIdleConns = p.MaxIdleConns
+	} else if p.MaxIdleConns < 0 {
+		tr.MaxIdleConns = 0
+	}
+
+	if p.MaxIdleConnsPerHost > 0 {
+		tr.MaxIdleConnsPerHost = p.MaxIdleConnsPerHost
+	}
+
+	if p.MaxConnsPerHost > 0 {
+		tr.MaxConnsPerHost = p.MaxConnsPerHost
+	}
+}
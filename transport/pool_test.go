@@ -0,0 +1,84 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestSetPool(t *testing.T) {
+	tr := New()
+	h := tr.Client().Transport.(*http.Transport)
+	assert.Equal(t, h.MaxIdleConns, 100)
+	assert.Equal(t, h.MaxIdleConnsPerHost, 0)
+	assert.Equal(t, h.MaxConnsPerHost, 0)
+
+	tr.SetPool(Pool{MaxIdleConns: 10, MaxIdleConnsPerHost: 5, MaxConnsPerHost: 8})
+	h = tr.Client().Transport.(*http.Transport)
+	assert.Equal(t, h.MaxIdleConns, 10)
+	assert.Equal(t, h.MaxIdleConnsPerHost, 5)
+	assert.Equal(t, h.MaxConnsPerHost, 8)
+
+	tr.SetPool(Pool{MaxIdleConns: -1})
+	h = tr.Client().Transport.(*http.Transport)
+	assert.Equal(t, h.MaxIdleConns, 0)
+	assert.Equal(t, h.MaxConnsPerHost, 0)
+}
+
+func TestMaxConnsPerHost(t *testing.T) {
+	var active, peak int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&active, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&active, -1)
+	}))
+	defer ts.Close()
+
+	tr := New().SetPool(Pool{MaxConnsPerHost: 1})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rsp, err := tr.Get(context.Background(), ts.URL, nil, nil)
+			assert.Nil(t, err)
+			_, _ = rsp.Bytes()
+			rsp.Close()
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, atomic.LoadInt32(&peak), int32(1))
+}
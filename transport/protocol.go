@@ -0,0 +1,126 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Protocol is the http protocol version of upstream requests
+type Protocol int
+
+// Supported http protocol versions
+const (
+	// ProtocolAuto uses HTTP/2 if negotiated by upstream, else HTTP/1.1
+	ProtocolAuto Protocol = iota
+	// ProtocolHTTP1 forces HTTP/1.1
+	ProtocolHTTP1
+	// ProtocolHTTP2 forces HTTP/2, h2c is used for plain http upstream
+	ProtocolHTTP2
+	// ProtocolHTTP3 forces HTTP/3, it requires a round tripper set by SetHTTP3RoundTripper
+	ProtocolHTTP3
+)
+
+// errNoHTTP3 is returned when HTTP/3 is forced without a round tripper
+var errNoHTTP3 = fmt.Errorf("doh: transport: no http3 round tripper set")
+
+// errRoundTripper is a round tripper always fails
+type errRoundTripper struct {
+	err error
+}
+
+// RoundTrip returns the error
+func (e errRoundTripper) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, e.err
+}
+
+// String returns string of protocol
+func (p Protocol) String() string {
+	switch p {
+	case ProtocolHTTP1:
+		return "HTTP/1.1"
+	case ProtocolHTTP2:
+		return "HTTP/2"
+	case ProtocolHTTP3:
+		return "HTTP/3"
+	default:
+		return "auto"
+	}
+}
+
+// downgrade returns the protocol to fall back to, or itself if none
+func (p Protocol) downgrade() Protocol {
+	switch p {
+	case ProtocolHTTP3:
+		return ProtocolHTTP2
+	case ProtocolHTTP2:
+		return ProtocolHTTP1
+	default:
+		return p
+	}
+}
+
+// protocols returns the http transport protocols, nil for the default
+func (p Protocol) protocols() *http.Protocols {
+	ps := &http.Protocols{}
+
+	switch p {
+	case ProtocolHTTP1:
+		ps.SetHTTP1(true)
+	case ProtocolHTTP2:
+		ps.SetHTTP2(true)
+		ps.SetUnencryptedHTTP2(true)
+	default:
+		return nil
+	}
+
+	return ps
+}
+
+// SetProtocol set the http protocol version of upstream requests, default is ProtocolAuto,
+// it is not applied to a custom client or round tripper
+func (t *Transport) SetProtocol(p Protocol) *Transport {
+	t.Lock()
+	t.protocol = p
+	t.Unlock()
+
+	return t
+}
+
+// SetProtocolFallback set whether to downgrade the protocol on failure, HTTP/3 to HTTP/2 to HTTP/1.1,
+// default is false
+func (t *Transport) SetProtocolFallback(enable bool) *Transport {
+	t.Lock()
+	t.fallback = enable
+	t.Unlock()
+
+	return t
+}
+
+// SetHTTP3RoundTripper set the round tripper used for HTTP/3, for example http3.Transport of quic-go
+func (t *Transport) SetHTTP3RoundTripper(r http.RoundTripper) *Transport {
+	t.Lock()
+	t.http3 = r
+	t.reset()
+	t.Unlock()
+
+	return t
+}
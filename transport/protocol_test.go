@@ -0,0 +1,113 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestProtocolString(t *testing.T) {
+	assert.Equal(t, ProtocolAuto.String(), "auto")
+	assert.Equal(t, ProtocolHTTP1.String(), "HTTP/1.1")
+	assert.Equal(t, ProtocolHTTP2.String(), "HTTP/2")
+	assert.Equal(t, ProtocolHTTP3.String(), "HTTP/3")
+}
+
+func TestSetProtocol(t *testing.T) {
+	h2 := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	defer h2.Close()
+
+	h1 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer h1.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(h1.Certificate())
+	pool.AddCert(h2.Certificate())
+
+	ctx := context.Background()
+	tr := New().SetRootCAs(pool)
+
+	proto := func(surl string) (int, error) {
+		rsp, err := tr.Get(ctx, surl, nil, nil)
+		if err != nil {
+			return 0, err
+		}
+		rsp.Close()
+		return rsp.ProtoMajor, nil
+	}
+
+	tests := []struct {
+		protocol Protocol
+		surl     string
+		major    int
+	}{
+		{ProtocolAuto, h2.URL, 2},
+		{ProtocolAuto, h1.URL, 1},
+		{ProtocolHTTP1, h2.URL, 1},
+		{ProtocolHTTP2, h2.URL, 2},
+	}
+
+	for _, v := range tests {
+		tr.SetProtocol(v.protocol)
+		major, err := proto(v.surl)
+		assert.Nil(t, err)
+		assert.Equal(t, major, v.major)
+	}
+
+	tr.SetProtocol(ProtocolHTTP2)
+	_, err := proto(h1.URL)
+	assert.NotNil(t, err)
+
+	tr.SetProtocolFallback(true)
+	major, err := proto(h1.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, major, 1)
+
+	tr.SetProtocol(ProtocolHTTP3).SetProtocolFallback(false)
+	_, err = proto(h2.URL)
+	assert.NotNil(t, err)
+
+	tr.SetProtocolFallback(true)
+	major, err = proto(h2.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, major, 2)
+
+	tr.SetHTTP3RoundTripper(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			ProtoMajor: 3,
+			Body:       io.NopCloser(strings.NewReader("")),
+			Request:    r,
+		}, nil
+	}))
+	major, err = proto(h2.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, major, 3)
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// RedirectPolicy is the policy of following upstream redirects
+type RedirectPolicy struct {
+	// Follow is whether to follow redirects, if false the redirect response is returned as a bad status
+	Follow bool
+	// Max is the max number of redirects to follow, default is 10
+	Max int
+	// Schemes is the allowed schemes to redirect to, empty for any
+	Schemes []string
+	// Hosts is the allowed hosts to redirect to, *.example.com matches any subdomain, empty for any
+	Hosts []string
+	// SameHost only allows redirects to the host of the original request
+	SameHost bool
+}
+
+// SetRedirectPolicy set the policy of following upstream redirects, nil to use the default following up to 10,
+// it replaces CheckRedirect of a custom client
+func (t *Transport) SetRedirectPolicy(policy *RedirectPolicy) *Transport {
+	t.Lock()
+	t.redirect = nil
+	if policy != nil {
+		p := *policy
+		p.Schemes = append([]string{}, policy.Schemes...)
+		p.Hosts = append([]string{}, policy.Hosts...)
+		t.redirect = &p
+	}
+	t.Unlock()
+
+	return t
+}
+
+// checkRedirect returns the CheckRedirect func of policy
+func (p *RedirectPolicy) checkRedirect() func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if !p.Follow {
+			return http.ErrUseLastResponse
+		}
+
+		max := p.Max
+		if max <= 0 {
+			max = 10
+		}
+
+		if len(via) >= max {
+			return fmt.Errorf("doh: transport: stopped after %d redirects", max)
+		}
+
+		if len(p.Schemes) > 0 && !containsFold(p.Schemes, req.URL.Scheme) {
+			return fmt.Errorf("doh: transport: redirect to scheme %s is not allowed", req.URL.Scheme)
+		}
+
+		host := req.URL.Hostname()
+		if p.SameHost && len(via) > 0 && !strings.EqualFold(via[0].URL.Hostname(), host) {
+			return fmt.Errorf("doh: transport: redirect to host %s is not allowed", host)
+		}
+
+		if len(p.Hosts) > 0 && !matchHost(p.Hosts, host) {
+			return fmt.Errorf("doh: transport: redirect to host %s is not allowed", host)
+		}
+
+		return nil
+	}
+}
+
+// containsFold returns whether ss contains s case-insensitively
+func containsFold(ss []string, s string) bool {
+	for _, v := range ss {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchHost returns whether host matches any of the patterns
+func matchHost(patterns []string, host string) bool {
+	host = strings.ToLower(host)
+	for _, v := range patterns {
+		v = strings.ToLower(v)
+		if strings.HasPrefix(v, "*.") {
+			if strings.HasSuffix(host, v[1:]) {
+				return true
+			}
+		} else if v == host {
+			return true
+		}
+	}
+
+	return false
+}
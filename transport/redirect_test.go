@@ -0,0 +1,97 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestSetRedirectPolicy(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/local":
+			http.Redirect(w, r, strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)+"/ok", http.StatusFound)
+		case "/redirect":
+			http.Redirect(w, r, "/ok", http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	tr := New()
+
+	status := func(path string) (int, error) {
+		rsp, err := tr.Get(ctx, ts.URL+path, nil, nil)
+		if err != nil {
+			return 0, err
+		}
+		rsp.Close()
+		return rsp.StatusCode, nil
+	}
+
+	code, err := status("/redirect")
+	assert.Nil(t, err)
+	assert.Equal(t, code, http.StatusOK)
+
+	tr.SetRedirectPolicy(&RedirectPolicy{Follow: false})
+	code, err = status("/redirect")
+	assert.Nil(t, err)
+	assert.Equal(t, code, http.StatusFound)
+
+	tr.SetRedirectPolicy(&RedirectPolicy{Follow: true, Max: 3})
+	_, err = status("/loop")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "stopped after 3 redirects")
+
+	tr.SetRedirectPolicy(&RedirectPolicy{Follow: true, Schemes: []string{"https"}})
+	_, err = status("/redirect")
+	assert.NotNil(t, err)
+
+	tr.SetRedirectPolicy(&RedirectPolicy{Follow: true, SameHost: true})
+	code, err = status("/redirect")
+	assert.Nil(t, err)
+	assert.Equal(t, code, http.StatusOK)
+	_, err = status("/local")
+	assert.NotNil(t, err)
+
+	tr.SetRedirectPolicy(&RedirectPolicy{Follow: true, Hosts: []string{"127.0.0.1", "*.example.com"}})
+	_, err = status("/local")
+	assert.NotNil(t, err)
+
+	tr.SetRedirectPolicy(&RedirectPolicy{Follow: true, Hosts: []string{"localhost", "127.0.0.1"}})
+	code, err = status("/local")
+	assert.Nil(t, err)
+	assert.Equal(t, code, http.StatusOK)
+
+	assert.True(t, matchHost([]string{"*.example.com"}, "dns.example.com"))
+	assert.False(t, matchHost([]string{"*.example.com"}, "example.org"))
+
+	tr.SetRedirectPolicy(nil)
+	assert.True(t, tr.Client().CheckRedirect == nil)
+}
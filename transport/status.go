@@ -0,0 +1,82 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// MaxErrorBodySize is the max size of upstream error body kept in StatusError
+var MaxErrorBodySize = 512
+
+// StatusError is the error of upstream response with a non-200 status code
+type StatusError struct {
+	StatusCode  int
+	ContentType string
+	Body        string
+	Truncated   bool
+}
+
+// Error returns string of error
+func (e *StatusError) Error() string {
+	s := fmt.Sprintf("bad status code: %d", e.StatusCode)
+	if e.ContentType != "" {
+		s += fmt.Sprintf(" (%s)", e.ContentType)
+	}
+
+	if e.Body != "" {
+		s += ": " + e.Body
+		if e.Truncated {
+			s += "..."
+		}
+	}
+
+	return s
+}
+
+// CheckStatus returns a StatusError with the truncated body if status code is not 200
+func (r *Response) CheckStatus() error {
+	if r.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	e := &StatusError{
+		StatusCode:  r.StatusCode,
+		ContentType: r.Header.Get("Content-Type"),
+	}
+
+	body, err := decoder(r.Header.Get("Content-Encoding"), r.Body)
+	if err != nil {
+		return e
+	}
+
+	b, _ := io.ReadAll(io.LimitReader(body, int64(MaxErrorBodySize)+1))
+	if len(b) > MaxErrorBodySize {
+		b = b[:MaxErrorBodySize]
+		e.Truncated = true
+	}
+
+	e.Body = strings.TrimSpace(string(b))
+
+	return e
+}
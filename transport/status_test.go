@@ -0,0 +1,76 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestCheckStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"Invalid name"}`)
+		case "/long":
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, strings.Repeat("x", MaxErrorBodySize*2))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	get := func(path string) error {
+		rsp, err := New().Get(context.Background(), ts.URL+path, nil, nil)
+		assert.Nil(t, err)
+		defer rsp.Close()
+		return rsp.CheckStatus()
+	}
+
+	assert.Nil(t, get("/ok"))
+
+	err := get("/json")
+	assert.NotNil(t, err)
+	e := err.(*StatusError)
+	assert.Equal(t, e.StatusCode, http.StatusBadRequest)
+	assert.Equal(t, e.ContentType, "application/json")
+	assert.Equal(t, e.Body, `{"error":"Invalid name"}`)
+	assert.Equal(t, err.Error(), `bad status code: 400 (application/json): {"error":"Invalid name"}`)
+
+	err = get("/long")
+	assert.NotNil(t, err)
+	e = err.(*StatusError)
+	assert.True(t, e.Truncated)
+	assert.Equal(t, len(e.Body), MaxErrorBodySize)
+	assert.True(t, strings.HasSuffix(err.Error(), "..."))
+
+	err = get("/none")
+	assert.Equal(t, err.Error(), "bad status code: 404")
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Timeout is the per-phase timeouts of upstream requests, 0 to use the default, they apply within the context deadline
+type Timeout struct {
+	// Dial is the max time to establish a tcp connection, default is 30s
+	Dial time.Duration
+	// TLSHandshake is the max time of tls handshake, default is 10s
+	TLSHandshake time.Duration
+	// ResponseHeader is the max time waiting for response headers after the request is sent, default is no limit
+	ResponseHeader time.Duration
+	// BodyRead is the max time reading response body after response headers, default is no limit
+	BodyRead time.Duration
+	// Request is the max time of each request attempt including the redirects and reading body, a protocol
+	// fallback or a retry of provider is a new attempt with its own timeout, default is no limit
+	Request time.Duration
+}
+
+// SetTimeout set the per-phase timeouts of upstream requests, they are not applied to a custom client or round tripper
+// except BodyRead and Request
+func (t *Transport) SetTimeout(timeout Timeout) *Transport {
+	t.Lock()
+	t.timeout = timeout
+	t.reset()
+	t.Unlock()
+
+	return t
+}
+
+// SetRequestTimeout set the max time of each request attempt including reading body, 0 for no limit,
+// it applies within the context deadline and to a custom client or round tripper
+func (t *Transport) SetRequestTimeout(timeout time.Duration) *Transport {
+	t.Lock()
+	t.timeout.Request = timeout
+	t.Unlock()
+
+	return t
+}
+
+// timeoutBody is a response body failing if not read within the timeout
+type timeoutBody struct {
+	io.ReadCloser
+	timeout  time.Duration
+	timer    *time.Timer
+	cancel   context.CancelFunc
+	timedOut int32
+}
+
+// newTimeoutBody returns a body canceling its request if not read within the timeout
+func newTimeoutBody(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *timeoutBody {
+	b := &timeoutBody{
+		ReadCloser: body,
+		timeout:    timeout,
+		cancel:     cancel,
+	}
+
+	b.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&b.timedOut, 1)
+		cancel()
+	})
+
+	return b
+}
+
+// Read reads the body, returns timeout error if timed out
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && atomic.LoadInt32(&b.timedOut) == 1 {
+		err = fmt.Errorf("doh: transport: body read timeout after %s", b.timeout)
+	}
+
+	return n, err
+}
+
+// Close stops the timer and closes the body
+func (b *timeoutBody) Close() error {
+	b.timer.Stop()
+	err := b.ReadCloser.Close()
+	b.cancel()
+
+	return err
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestSetTimeout(t *testing.T) {
+	done := make(chan bool)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/header":
+			select {
+			case <-time.After(time.Second):
+			case <-done:
+			}
+		case "/body":
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, "likexian")
+			w.(http.Flusher).Flush()
+			select {
+			case <-time.After(time.Second):
+			case <-done:
+			}
+		}
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	tr := New().SetTimeout(Timeout{
+		Dial:           time.Second,
+		TLSHandshake:   time.Second,
+		ResponseHeader: 100 * time.Millisecond,
+		BodyRead:       100 * time.Millisecond,
+	})
+
+	h := tr.Client().Transport.(*http.Transport)
+	assert.Equal(t, h.TLSHandshakeTimeout, time.Second)
+	assert.Equal(t, h.ResponseHeaderTimeout, 100*time.Millisecond)
+
+	ctx := context.Background()
+	_, err := tr.Get(ctx, ts.URL+"/header", nil, nil)
+	assert.NotNil(t, err)
+
+	start := time.Now()
+	rsp, err := tr.Get(ctx, ts.URL+"/body", nil, nil)
+	assert.Nil(t, err)
+	_, err = rsp.Bytes()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "body read timeout")
+	assert.Lt(t, int64(time.Since(start)), int64(time.Second))
+	rsp.Close()
+
+	rsp, err = tr.Get(ctx, ts.URL+"/ok", nil, nil)
+	assert.Nil(t, err)
+	_, err = rsp.Bytes()
+	assert.Nil(t, err)
+	rsp.Close()
+
+	tr.SetTimeout(Timeout{})
+	h = tr.Client().Transport.(*http.Transport)
+	assert.Equal(t, h.ResponseHeaderTimeout, time.Duration(0))
+}
+
+func TestSetRequestTimeout(t *testing.T) {
+	done := make(chan bool)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-time.After(time.Second):
+			case <-done:
+			}
+		}
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tr := New().SetRequestTimeout(100 * time.Millisecond)
+	start := time.Now()
+	_, err := tr.Get(ctx, ts.URL+"/slow", nil, nil)
+	assert.NotNil(t, err)
+	assert.Lt(t, int64(time.Since(start)), int64(time.Second))
+
+	rsp, err := tr.Get(ctx, ts.URL+"/ok", nil, nil)
+	assert.Nil(t, err)
+	_, err = rsp.Bytes()
+	assert.Nil(t, err)
+	rsp.Close()
+
+	tr.SetRoundTripper(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		<-r.Context().Done()
+		return nil, r.Context().Err()
+	}))
+	_, err = tr.Get(ctx, ts.URL+"/ok", nil, nil)
+	assert.NotNil(t, err)
+
+	tr.SetTimeout(Timeout{})
+	assert.Equal(t, tr.timeout.Request, time.Duration(0))
+}
+
+func TestRequestTimeoutAttempts(t *testing.T) {
+	attempts := 0
+	tr := New().SetRequestTimeout(150 * time.Millisecond).SetProtocol(ProtocolHTTP2).SetProtocolFallback(true)
+	tr.SetRoundTripper(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		attempts++
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+		if attempts == 1 {
+			return nil, errors.New("attempt failed")
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("ok")), Request: r}, nil
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	rsp, err := tr.Get(ctx, "http://likexian.example/resolve", nil, nil)
+	assert.Nil(t, err)
+	assert.Gt(t, int64(time.Since(start)), int64(150*time.Millisecond))
+	assert.Equal(t, attempts, 2)
+	b, err := rsp.Bytes()
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), "ok")
+	rsp.Close()
+
+	attempts = 0
+	ctx, cancel = context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+
+	_, err = tr.Get(ctx, "http://likexian.example/resolve", nil, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, attempts, 2)
+}
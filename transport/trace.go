@@ -0,0 +1,145 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// tracer records the timings of an upstream request
+type tracer struct {
+	start      time.Time
+	dnsStart   time.Time
+	dnsDone    time.Time
+	connStart  time.Time
+	connDone   time.Time
+	tlsStart   time.Time
+	tlsDone    time.Time
+	firstByte  time.Time
+	done       time.Time
+	remoteAddr string
+	reused     bool
+	sync.Mutex
+}
+
+// newTracer returns a new tracer started now
+func newTracer() *tracer {
+	return &tracer{
+		start: time.Now(),
+	}
+}
+
+// clientTrace returns the httptrace hooks recording to tracer
+func (t *tracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.first(&t.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.last(&t.dnsDone)
+		},
+		ConnectStart: func(string, string) {
+			t.first(&t.connStart)
+		},
+		ConnectDone: func(string, string, error) {
+			t.last(&t.connDone)
+		},
+		TLSHandshakeStart: func() {
+			t.first(&t.tlsStart)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.last(&t.tlsDone)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.Lock()
+			if info.Conn != nil {
+				t.remoteAddr = info.Conn.RemoteAddr().String()
+			}
+			t.reused = info.Reused
+			t.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.first(&t.firstByte)
+		},
+	}
+}
+
+// first records now to v if not recorded
+func (t *tracer) first(v *time.Time) {
+	t.Lock()
+	if v.IsZero() {
+		*v = time.Now()
+	}
+	t.Unlock()
+}
+
+// last records now to v
+func (t *tracer) last(v *time.Time) {
+	t.Lock()
+	*v = time.Now()
+	t.Unlock()
+}
+
+// finish records the request is done
+func (t *tracer) finish() {
+	t.first(&t.done)
+}
+
+// address returns the remote address of connection
+func (t *tracer) address() string {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.remoteAddr
+}
+
+// timing returns the timing breakdown of request
+func (t *tracer) timing() *dns.Timing {
+	t.Lock()
+	defer t.Unlock()
+
+	done := t.done
+	if done.IsZero() {
+		done = time.Now()
+	}
+
+	return &dns.Timing{
+		DNS:     between(t.dnsStart, t.dnsDone),
+		Connect: between(t.connStart, t.connDone),
+		TLS:     between(t.tlsStart, t.tlsDone),
+		TTFB:    between(t.start, t.firstByte),
+		Total:   between(t.start, done),
+		Reused:  t.reused,
+	}
+}
+
+// between returns the duration from start to end, 0 if any is not recorded
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+
+	return end.Sub(start)
+}
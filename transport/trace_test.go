@@ -0,0 +1,75 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestTiming(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	surl := "https://example.com:" + port
+
+	tr := New().SetRootCAs(pool)
+	tr.SetBootstrap(ResolverFunc(func(ctx context.Context, host string) ([]net.IP, error) {
+		time.Sleep(time.Millisecond)
+		return []net.IP{net.ParseIP("127.0.0.1")}, nil
+	}))
+
+	ctx := context.Background()
+	rsp, err := tr.Get(ctx, surl, nil, nil)
+	assert.Nil(t, err)
+	_, err = rsp.Bytes()
+	assert.Nil(t, err)
+	rsp.Close()
+
+	m := rsp.Metadata()
+	assert.Gt(t, int64(m.Timing.DNS), int64(0))
+	assert.Gt(t, int64(m.Timing.Connect), int64(0))
+	assert.Gt(t, int64(m.Timing.TLS), int64(0))
+	assert.Gt(t, int64(m.Timing.TTFB), int64(0))
+	assert.True(t, m.Timing.Total >= m.Timing.TTFB)
+	assert.False(t, m.Timing.Reused)
+
+	rsp, err = tr.Get(ctx, surl, nil, nil)
+	assert.Nil(t, err)
+	_, err = rsp.Bytes()
+	assert.Nil(t, err)
+	rsp.Close()
+
+	timing := rsp.Timing()
+	assert.True(t, timing.Reused)
+	assert.Equal(t, timing.TLS, time.Duration(0))
+	assert.Equal(t, timing, rsp.Timing())
+}
@@ -0,0 +1,665 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// Transport is the http transport shared by DoH providers
+type Transport struct {
+	client      *http.Client
+	transport   http.RoundTripper
+	userAgent   string
+	header      http.Header
+	tlsConfig   *tls.Config
+	pins        [][]byte
+	sessions    tls.ClientSessionCache
+	proxy       *url.URL
+	proxyEnv    bool
+	localAddr   net.IP
+	iface       string
+	bootstrap   Resolver
+	keepAlive   time.Duration
+	idleTimeout time.Duration
+	protocol    Protocol
+	fallback    bool
+	http3       http.RoundTripper
+	maxBodySize int64
+	compression bool
+	timeout     Timeout
+	pool        Pool
+	redirect    *RedirectPolicy
+	built       map[Protocol]http.RoundTripper
+	proxied     map[proxyKey]*http.Transport
+	sync.RWMutex
+}
+
+// proxyKey is the key of round tripper requesting via the context proxy url
+type proxyKey struct {
+	base  *http.Transport
+	proxy string
+}
+
+// Response is the upstream http response
+type Response struct {
+	*http.Response
+	maxBodySize int64
+	tracer      *tracer
+}
+
+const (
+	// defaultSessionCacheSize is the capacity of default tls session cache
+	defaultSessionCacheSize = 64
+	// DefaultMaxBodySize is the default max size of upstream response body
+	DefaultMaxBodySize = 1 << 20
+)
+
+// Version returns package version
+func Version() string {
+	return "0.1.0"
+}
+
+// Author returns package author
+func Author() string {
+	return "[Li Kexian](https://www.likexian.com/)"
+}
+
+// License returns package license
+func License() string {
+	return "Licensed under the Apache License 2.0"
+}
+
+// New returns a new transport using the default http client
+func New() *Transport {
+	return &Transport{
+		client:      nil,
+		transport:   nil,
+		userAgent:   "",
+		header:      http.Header{},
+		tlsConfig:   nil,
+		pins:        nil,
+		sessions:    tls.NewLRUClientSessionCache(defaultSessionCacheSize),
+		proxy:       nil,
+		proxyEnv:    true,
+		localAddr:   nil,
+		iface:       "",
+		bootstrap:   nil,
+		keepAlive:   0,
+		idleTimeout: 0,
+		protocol:    ProtocolAuto,
+		fallback:    false,
+		http3:       nil,
+		maxBodySize: DefaultMaxBodySize,
+		compression: true,
+		timeout:     Timeout{},
+		pool:        Pool{},
+		redirect:    nil,
+		built:       map[Protocol]http.RoundTripper{},
+	}
+}
+
+// SetClient set the http client used for upstream requests, nil to use the default
+func (t *Transport) SetClient(c *http.Client) *Transport {
+	t.Lock()
+	t.client = c
+	t.Unlock()
+
+	return t
+}
+
+// SetRoundTripper set the http round tripper used for upstream requests, nil to use the default,
+// if both client and round tripper are set, the round tripper replaces the client's transport
+func (t *Transport) SetRoundTripper(r http.RoundTripper) *Transport {
+	t.Lock()
+	t.transport = r
+	t.Unlock()
+
+	return t
+}
+
+// SetUserAgent set the User-Agent header of upstream requests, empty to use the default
+func (t *Transport) SetUserAgent(ua string) *Transport {
+	t.Lock()
+	t.userAgent = ua
+	t.Unlock()
+
+	return t
+}
+
+// SetHeader set an extra header of upstream requests, empty value to remove it
+func (t *Transport) SetHeader(key, value string) *Transport {
+	t.Lock()
+	if value == "" {
+		t.header.Del(key)
+	} else {
+		t.header.Set(key, value)
+	}
+	t.Unlock()
+
+	return t
+}
+
+// Header returns a copy of the extra headers of upstream requests
+func (t *Transport) Header() http.Header {
+	t.RLock()
+	defer t.RUnlock()
+
+	h := http.Header{}
+	for k, v := range t.header {
+		h[k] = append([]string{}, v...)
+	}
+
+	return h
+}
+
+// SetTLSConfig set the tls config of upstream connections, nil to use the default,
+// it is not applied to a custom client or round tripper
+func (t *Transport) SetTLSConfig(config *tls.Config) *Transport {
+	t.Lock()
+	t.tlsConfig = nil
+	if config != nil {
+		t.tlsConfig = config.Clone()
+	}
+	t.reset()
+	t.Unlock()
+
+	return t
+}
+
+// SetRootCAs set the root certificate authorities used to verify upstream certificates
+func (t *Transport) SetRootCAs(pool *x509.CertPool) *Transport {
+	return t.updateTLSConfig(func(c *tls.Config) {
+		c.RootCAs = pool
+	})
+}
+
+// SetMinTLSVersion set the minimum tls version of upstream connections, for example tls.VersionTLS12
+func (t *Transport) SetMinTLSVersion(version uint16) *Transport {
+	return t.updateTLSConfig(func(c *tls.Config) {
+		c.MinVersion = version
+	})
+}
+
+// SetCipherSuites set the enabled tls cipher suites of upstream connections, it has no effect on TLS 1.3
+func (t *Transport) SetCipherSuites(suites ...uint16) *Transport {
+	return t.updateTLSConfig(func(c *tls.Config) {
+		c.CipherSuites = append([]uint16{}, suites...)
+	})
+}
+
+// SetServerName set the server name used to verify upstream certificates and sent as SNI
+func (t *Transport) SetServerName(name string) *Transport {
+	return t.updateTLSConfig(func(c *tls.Config) {
+		c.ServerName = name
+	})
+}
+
+// SetSessionCache set the tls session cache used to resume upstream connections, nil to disable resumption,
+// a LRU cache of 64 sessions is used by default, it is ignored if the tls config has its own,
+// 0-RTT early data is not supported by crypto/tls, it needs a custom round tripper (such as HTTP/3) supporting it
+func (t *Transport) SetSessionCache(cache tls.ClientSessionCache) *Transport {
+	t.Lock()
+	t.sessions = cache
+	t.reset()
+	t.Unlock()
+
+	return t
+}
+
+// SetMaxBodySize set the max size of upstream response body read into memory,
+// 0 to use DefaultMaxBodySize, negative for no limit
+func (t *Transport) SetMaxBodySize(size int64) *Transport {
+	if size == 0 {
+		size = DefaultMaxBodySize
+	}
+
+	t.Lock()
+	t.maxBodySize = size
+	t.Unlock()
+
+	return t
+}
+
+// TLSConfig returns a copy of the tls config of upstream connections, nil if not set
+func (t *Transport) TLSConfig() *tls.Config {
+	t.RLock()
+	defer t.RUnlock()
+
+	if t.tlsConfig == nil {
+		return nil
+	}
+
+	return t.tlsConfig.Clone()
+}
+
+// Client returns the http client used for upstream requests
+func (t *Transport) Client() *http.Client {
+	t.RLock()
+	p := t.protocol
+	t.RUnlock()
+
+	return t.clientFor(p)
+}
+
+// clientFor returns the http client requesting with protocol
+func (t *Transport) clientFor(p Protocol) *http.Client {
+	t.RLock()
+	client, rt, built, redirect := t.client, t.transport, t.built[p], t.redirect
+	pinned := len(t.pins) > 0 && t.custom()
+	t.RUnlock()
+
+	c := &http.Client{}
+	if client != nil {
+		cc := *client
+		c = &cc
+	}
+
+	if redirect != nil {
+		c.CheckRedirect = redirect.checkRedirect()
+	}
+
+	if pinned {
+		c.Transport = errRoundTripper{errCustomPins}
+	} else if rt != nil {
+		c.Transport = rt
+	} else if c.Transport == nil {
+		if built == nil {
+			t.Lock()
+			if t.built[p] == nil {
+				t.built[p] = t.build(p)
+			}
+			built = t.built[p]
+			t.Unlock()
+		}
+		c.Transport = built
+	}
+
+	return c
+}
+
+// Get do http GET request to upstream
+func (t *Transport) Get(ctx context.Context, surl string, param url.Values, header http.Header) (*Response, error) {
+	if len(param) > 0 {
+		if strings.Contains(surl, "?") {
+			surl += "&" + param.Encode()
+		} else {
+			surl += "?" + param.Encode()
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, surl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.send(ctx, req, header)
+}
+
+// Post do http POST request of the RFC 8484 wire format message to upstream
+func (t *Transport) Post(ctx context.Context, surl string, msg []byte, header http.Header) (*Response, error) {
+	req, err := http.NewRequest(http.MethodPost, surl, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", dns.ContentTypeMessage)
+
+	return t.send(ctx, req, header)
+}
+
+// send set the headers of transport and request, then send the request to upstream
+func (t *Transport) send(ctx context.Context, req *http.Request, header http.Header) (*Response, error) {
+	t.RLock()
+	for k, v := range t.header {
+		req.Header[k] = append([]string{}, v...)
+	}
+	if t.userAgent != "" {
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	if t.compression && req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding())
+	}
+	t.RUnlock()
+
+	for k, v := range header {
+		req.Header.Del(k)
+		for _, vv := range v {
+			req.Header.Add(k, vv)
+		}
+	}
+
+	return t.do(ctx, req)
+}
+
+// do send the request to upstream, downgrades the protocol on failure if fallback is enabled
+func (t *Transport) do(ctx context.Context, req *http.Request) (*Response, error) {
+	t.RLock()
+	p, fallback, maxBodySize, timeout := t.protocol, t.fallback, t.maxBodySize, t.timeout
+	t.RUnlock()
+
+	for {
+		c := t.clientFor(p)
+		if v := ctx.Value("proxyURL"); v != nil {
+			var err error
+			c, err = t.withProxy(c, v.(string))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		tracer := newTracer()
+		var cancel context.CancelFunc
+		rctx := httptrace.WithClientTrace(ctx, tracer.clientTrace())
+		if timeout.Request > 0 {
+			rctx, cancel = context.WithTimeout(rctx, timeout.Request)
+		} else {
+			rctx, cancel = context.WithCancel(rctx)
+		}
+		r := req.WithContext(rctx)
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			r.Body = body
+		}
+
+		rsp, err := c.Do(r)
+		if err == nil {
+			if timeout.BodyRead > 0 {
+				rsp.Body = newTimeoutBody(rsp.Body, timeout.BodyRead, cancel)
+			} else {
+				rsp.Body = &cancelBody{rsp.Body, cancel}
+			}
+			return &Response{
+				Response:    rsp,
+				maxBodySize: maxBodySize,
+				tracer:      tracer,
+			}, nil
+		}
+
+		cancel()
+		if !fallback || ctx.Err() != nil || p.downgrade() == p {
+			return nil, err
+		}
+
+		p = p.downgrade()
+	}
+}
+
+// CloseIdleConnections closes the idle connections kept alive to upstream, including the ones of the http client
+// and round tripper set if they support it
+func (t *Transport) CloseIdleConnections() {
+	t.RLock()
+	closers := []any{}
+	if t.client != nil {
+		closers = append(closers, t.client)
+	}
+	if t.transport != nil {
+		closers = append(closers, t.transport)
+	}
+	for _, v := range t.built {
+		closers = append(closers, v)
+	}
+	for _, v := range t.proxied {
+		closers = append(closers, v)
+	}
+	t.RUnlock()
+
+	for _, v := range closers {
+		if c, ok := v.(interface{ CloseIdleConnections() }); ok {
+			c.CloseIdleConnections()
+		}
+	}
+}
+
+// Close closes the idle connections and drops the round trippers of the context proxy urls,
+// the transport is still usable after closed
+func (t *Transport) Close() error {
+	t.CloseIdleConnections()
+
+	t.Lock()
+	t.proxied = nil
+	t.Unlock()
+
+	return nil
+}
+
+// updateTLSConfig update the tls config by fn
+func (t *Transport) updateTLSConfig(fn func(*tls.Config)) *Transport {
+	t.Lock()
+	if t.tlsConfig == nil {
+		t.tlsConfig = &tls.Config{}
+	}
+	fn(t.tlsConfig)
+	t.reset()
+	t.Unlock()
+
+	return t
+}
+
+// reset drops the built round tripper so that it is rebuilt with the new options, must hold the lock
+func (t *Transport) reset() {
+	for _, v := range t.built {
+		if tr, ok := v.(*http.Transport); ok {
+			tr.CloseIdleConnections()
+		}
+	}
+	for _, v := range t.proxied {
+		v.CloseIdleConnections()
+	}
+	t.built = map[Protocol]http.RoundTripper{}
+	t.proxied = nil
+}
+
+// build returns a new round tripper of protocol with the options, must hold the lock
+func (t *Transport) build(p Protocol) http.RoundTripper {
+	if p == ProtocolHTTP3 {
+		if t.http3 == nil {
+			return errRoundTripper{errNoHTTP3}
+		}
+		return t.http3
+	}
+
+	tr := defaultTransport.Clone()
+	tr.Protocols = p.protocols()
+	tr.Proxy = t.proxyFunc()
+	tr.DialContext = t.dialer()
+
+	if t.idleTimeout > 0 {
+		tr.IdleConnTimeout = t.idleTimeout
+	}
+
+	t.pool.apply(tr)
+
+	if t.timeout.TLSHandshake > 0 {
+		tr.TLSHandshakeTimeout = t.timeout.TLSHandshake
+	}
+
+	if t.timeout.ResponseHeader > 0 {
+		tr.ResponseHeaderTimeout = t.timeout.ResponseHeader
+	}
+
+	if t.tlsConfig != nil {
+		tr.TLSClientConfig = t.tlsConfig.Clone()
+	}
+
+	if tr.TLSClientConfig == nil {
+		tr.TLSClientConfig = &tls.Config{}
+	}
+
+	if tr.TLSClientConfig.ClientSessionCache == nil {
+		tr.TLSClientConfig.ClientSessionCache = t.sessions
+	}
+
+	if len(t.pins) > 0 {
+		tr.TLSClientConfig.VerifyConnection = verifyPins(t.pins)
+	}
+
+	return tr
+}
+
+// Close close response body
+func (r *Response) Close() error {
+	return r.Body.Close()
+}
+
+// Reader returns the decompressed response body for decoding in stream, reading fails if it exceeds
+// the max body size, the timing is finished when it is read to the end
+func (r *Response) Reader() (io.Reader, error) {
+	body, err := decoder(r.Header.Get("Content-Encoding"), r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.maxBodySize >= 0 && r.ContentLength > r.maxBodySize {
+		r.tracer.finish()
+		return nil, fmt.Errorf("doh: transport: response body exceeds %d bytes", r.maxBodySize)
+	}
+
+	return &bodyReader{r: body, max: r.maxBodySize, tracer: r.tracer}, nil
+}
+
+// Bytes returns the decompressed response body as bytes, fails if it exceeds the max body size
+func (r *Response) Bytes() ([]byte, error) {
+	body, err := r.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.tracer.finish()
+
+	return io.ReadAll(body)
+}
+
+// String returns response body as string
+func (r *Response) String() (string, error) {
+	b, err := r.Bytes()
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// bodyReader is a response body failing if it exceeds the max size, negative max for no limit
+type bodyReader struct {
+	r      io.Reader
+	max    int64
+	read   int64
+	tracer *tracer
+}
+
+// Read reads the body, the size over max is an error
+func (b *bodyReader) Read(p []byte) (int, error) {
+	if b.max >= 0 {
+		if b.read > b.max {
+			return 0, fmt.Errorf("doh: transport: response body exceeds %d bytes", b.max)
+		}
+		if int64(len(p)) > b.max+1-b.read {
+			p = p[:b.max+1-b.read]
+		}
+	}
+
+	n, err := b.r.Read(p)
+	b.read += int64(n)
+
+	if b.max >= 0 && b.read > b.max {
+		b.tracer.finish()
+		return n - int(b.read-b.max), fmt.Errorf("doh: transport: response body exceeds %d bytes", b.max)
+	}
+
+	if err != nil {
+		b.tracer.finish()
+	}
+
+	return n, err
+}
+
+// cancelBody is a response body canceling its request on close
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and cancels the request
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+
+	return err
+}
+
+// defaultTransport is the base of round tripper built with the options
+var defaultTransport = http.DefaultTransport.(*http.Transport).Clone()
+
+// withProxy returns a copy of client requesting via the proxy url, the round tripper of each proxy url is
+// cached until the options change, so that its connections are reused
+func (t *Transport) withProxy(c *http.Client, proxy string) (*http.Client, error) {
+	base, ok := c.Transport.(*http.Transport)
+	if !ok {
+		return c, nil
+	}
+
+	u, err := ParseProxy(proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	key := proxyKey{base: base, proxy: u.String()}
+
+	t.RLock()
+	tr := t.proxied[key]
+	t.RUnlock()
+
+	if tr == nil {
+		t.Lock()
+		if tr = t.proxied[key]; tr == nil {
+			tr = base.Clone()
+			tr.Proxy = http.ProxyURL(u)
+			if t.proxied == nil {
+				t.proxied = map[proxyKey]*http.Transport{}
+			}
+			t.proxied[key] = tr
+		}
+		t.Unlock()
+	}
+
+	cc := *c
+	cc.Transport = tr
+
+	return &cc, nil
+}
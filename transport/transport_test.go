@@ -0,0 +1,408 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/likexian/gokit/assert"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestVersion(t *testing.T) {
+	assert.Contains(t, Version(), ".")
+	assert.Contains(t, Author(), "likexian")
+	assert.Contains(t, License(), "Apache License")
+}
+
+func TestGet(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s %s", r.URL.Query().Get("name"), r.URL.Query().Get("x"), r.Header.Get("Accept"))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	tr := New()
+
+	rsp, err := tr.Get(ctx, ts.URL, url.Values{"name": {"likexian.com"}}, http.Header{"Accept": {"application/dns-json"}})
+	assert.Nil(t, err)
+	defer rsp.Close()
+	assert.Equal(t, rsp.StatusCode, http.StatusOK)
+	s, err := rsp.String()
+	assert.Nil(t, err)
+	assert.Equal(t, s, "likexian.com  application/dns-json")
+
+	rsp, err = tr.Get(ctx, ts.URL+"?x=1", url.Values{"name": {"likexian.com"}}, nil)
+	assert.Nil(t, err)
+	defer rsp.Close()
+	s, err = rsp.String()
+	assert.Nil(t, err)
+	assert.Equal(t, s, "likexian.com 1 ")
+
+	_, err = tr.Get(ctx, "::", nil, nil)
+	assert.NotNil(t, err)
+}
+
+func TestSetClient(t *testing.T) {
+	tr := New()
+	assert.NotNil(t, tr.Client().Transport)
+
+	called := 0
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		called++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("ok")),
+			Request:    r,
+		}, nil
+	})
+
+	tr.SetClient(&http.Client{Transport: rt})
+	rsp, err := tr.Get(context.Background(), "https://dns.example/dns-query", nil, nil)
+	assert.Nil(t, err)
+	defer rsp.Close()
+	assert.Equal(t, called, 1)
+
+	tr.SetClient(&http.Client{}).SetRoundTripper(rt)
+	rsp, err = tr.Get(context.Background(), "https://dns.example/dns-query", nil, nil)
+	assert.Nil(t, err)
+	defer rsp.Close()
+	assert.Equal(t, called, 2)
+
+	tr.SetClient(nil).SetRoundTripper(nil)
+	assert.NotNil(t, tr.Client().Transport)
+}
+
+func TestProxyURL(t *testing.T) {
+	tr := New()
+	c, err := tr.withProxy(&http.Client{Transport: defaultTransport}, "127.0.0.1:8080")
+	assert.Nil(t, err)
+	p, err := c.Transport.(*http.Transport).Proxy(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, p.String(), "http://127.0.0.1:8080")
+
+	_, err = tr.withProxy(&http.Client{Transport: defaultTransport}, "ftp://127.0.0.1:8080")
+	assert.NotNil(t, err)
+
+	rt := roundTripFunc(nil)
+	c, err = tr.withProxy(&http.Client{Transport: rt}, "127.0.0.1:8080")
+	assert.Nil(t, err)
+	assert.NotNil(t, c.Transport)
+
+	proxied := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied++
+		_, _ = w.Write([]byte(r.URL.Host))
+	}))
+	defer ts.Close()
+
+	tr = New()
+	ctx := context.WithValue(context.Background(), "proxyURL", ts.URL)
+	for i := 0; i < 3; i++ {
+		rsp, err := tr.Get(ctx, "http://likexian.example/resolve", nil, nil)
+		assert.Nil(t, err)
+		b, err := rsp.Bytes()
+		assert.Nil(t, err)
+		assert.Equal(t, string(b), "likexian.example")
+		rsp.Close()
+	}
+	assert.Equal(t, proxied, 3)
+	assert.Equal(t, len(tr.proxied), 1)
+
+	tr.SetUserAgent("doh-go-test")
+	rsp, err := tr.Get(ctx, "http://likexian.example/resolve", nil, nil)
+	assert.Nil(t, err)
+	rsp.Close()
+	assert.Equal(t, len(tr.proxied), 1)
+
+	assert.Nil(t, tr.SetProxy(""))
+	assert.Equal(t, len(tr.proxied), 0)
+
+	rsp, err = tr.Get(ctx, "http://likexian.example/resolve", nil, nil)
+	assert.Nil(t, err)
+	rsp.Close()
+	assert.Equal(t, len(tr.proxied), 1)
+
+	assert.Nil(t, tr.Close())
+	assert.Equal(t, len(tr.proxied), 0)
+}
+
+func TestSetHeader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s|%s|%s", r.Header.Get("User-Agent"), r.Header.Get("X-Token"), r.Header.Get("Accept"))
+	}))
+	defer ts.Close()
+
+	tr := New().SetUserAgent("doh-go-test").SetHeader("X-Token", "likexian").SetHeader("Accept", "*/*")
+	assert.Equal(t, tr.Header().Get("X-Token"), "likexian")
+
+	rsp, err := tr.Get(context.Background(), ts.URL, nil, http.Header{"Accept": {"application/dns-json"}})
+	assert.Nil(t, err)
+	defer rsp.Close()
+	s, err := rsp.String()
+	assert.Nil(t, err)
+	assert.Equal(t, s, "doh-go-test|likexian|application/dns-json")
+
+	tr.SetUserAgent("").SetHeader("X-Token", "")
+	rsp, err = tr.Get(context.Background(), ts.URL, nil, nil)
+	assert.Nil(t, err)
+	defer rsp.Close()
+	s, err = rsp.String()
+	assert.Nil(t, err)
+	assert.Contains(t, s, "Go-http-client")
+	assert.Contains(t, s, "||*/*")
+}
+
+func TestSetTLSConfig(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS.ServerName)
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	tr := New()
+	assert.True(t, tr.TLSConfig() == nil)
+
+	_, err := tr.Get(ctx, ts.URL, nil, nil)
+	assert.NotNil(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	tr.SetRootCAs(pool).SetMinTLSVersion(tls.VersionTLS12).SetServerName("example.com")
+	assert.Equal(t, tr.TLSConfig().MinVersion, uint16(tls.VersionTLS12))
+	assert.NotNil(t, tr.Client().Transport.(*http.Transport).TLSClientConfig)
+
+	rsp, err := tr.Get(ctx, ts.URL, nil, nil)
+	assert.Nil(t, err)
+	defer rsp.Close()
+	s, err := rsp.String()
+	assert.Nil(t, err)
+	assert.Equal(t, s, "example.com")
+
+	tr.SetServerName("likexian.com")
+	_, err = tr.Get(ctx, ts.URL, nil, nil)
+	assert.NotNil(t, err)
+
+	tr.SetTLSConfig(&tls.Config{RootCAs: pool, MaxVersion: tls.VersionTLS12}).
+		SetCipherSuites(tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)
+	rsp, err = tr.Get(ctx, ts.URL, nil, nil)
+	assert.Nil(t, err)
+	defer rsp.Close()
+	assert.Equal(t, rsp.TLS.CipherSuite, uint16(tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256))
+
+	tr.SetTLSConfig(nil)
+	assert.True(t, tr.TLSConfig() == nil)
+	assert.NotNil(t, tr.Client().Transport)
+}
+
+func TestSetSessionCache(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+
+	ctx := context.Background()
+	tr := New().SetRootCAs(pool)
+
+	resumed := func() bool {
+		rsp, err := tr.Get(ctx, ts.URL, nil, nil)
+		assert.Nil(t, err)
+		_, _ = rsp.Bytes()
+		rsp.Close()
+		tr.Client().Transport.(*http.Transport).CloseIdleConnections()
+		return rsp.TLS.DidResume
+	}
+
+	assert.False(t, resumed())
+	assert.True(t, resumed())
+
+	tr.SetSessionCache(nil)
+	assert.False(t, resumed())
+	assert.False(t, resumed())
+
+	tr.SetSessionCache(tls.NewLRUClientSessionCache(1))
+	assert.False(t, resumed())
+	assert.True(t, resumed())
+}
+
+func TestSetMaxBodySize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("chunked") != "" {
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, strings.Repeat("x", 100))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	tr := New()
+
+	get := func(surl string) ([]byte, error) {
+		rsp, err := tr.Get(ctx, surl, nil, nil)
+		assert.Nil(t, err)
+		defer rsp.Close()
+		return rsp.Bytes()
+	}
+
+	b, err := get(ts.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, len(b), 100)
+
+	tr.SetMaxBodySize(99)
+	_, err = get(ts.URL)
+	assert.NotNil(t, err)
+	_, err = get(ts.URL + "?chunked=1")
+	assert.NotNil(t, err)
+
+	tr.SetMaxBodySize(100)
+	b, err = get(ts.URL + "?chunked=1")
+	assert.Nil(t, err)
+	assert.Equal(t, len(b), 100)
+
+	tr.SetMaxBodySize(-1)
+	b, err = get(ts.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, len(b), 100)
+
+	tr.SetMaxBodySize(0)
+	assert.Equal(t, tr.maxBodySize, int64(DefaultMaxBodySize))
+}
+
+func TestReader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("chunked") != "" {
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, strings.Repeat("x", 100))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	tr := New()
+
+	read := func(surl string) (int64, error) {
+		rsp, err := tr.Get(ctx, surl, nil, nil)
+		assert.Nil(t, err)
+		defer rsp.Close()
+		r, err := rsp.Reader()
+		if err != nil {
+			return 0, err
+		}
+		n, err := io.Copy(io.Discard, r)
+		assert.NotNil(t, rsp.Timing())
+		return n, err
+	}
+
+	n, err := read(ts.URL + "?chunked=1")
+	assert.Nil(t, err)
+	assert.Equal(t, n, int64(100))
+
+	tr.SetMaxBodySize(99)
+	_, err = read(ts.URL)
+	assert.NotNil(t, err)
+	n, err = read(ts.URL + "?chunked=1")
+	assert.NotNil(t, err)
+	assert.Equal(t, n, int64(99))
+
+	tr.SetMaxBodySize(100)
+	n, err = read(ts.URL + "?chunked=1")
+	assert.Nil(t, err)
+	assert.Equal(t, n, int64(100))
+}
+
+func TestPost(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s %s %s", r.Method, r.Header.Get("Content-Type"), r.Header.Get("Accept"),
+			r.Header.Get("X-Token"), b)
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	tr := New().SetHeader("X-Token", "likexian")
+
+	rsp, err := tr.Post(ctx, ts.URL, []byte("msg"), http.Header{"Accept": {"application/dns-message"}})
+	assert.Nil(t, err)
+	defer rsp.Close()
+	s, err := rsp.String()
+	assert.Nil(t, err)
+	assert.Equal(t, s, "POST application/dns-message application/dns-message likexian msg")
+
+	_, err = tr.Post(ctx, "::", nil, nil)
+	assert.NotNil(t, err)
+}
+
+type idleCloser struct {
+	http.RoundTripper
+	closed int
+}
+
+func (c *idleCloser) CloseIdleConnections() {
+	c.closed++
+}
+
+func TestCloseIdleConnections(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Config.ConnState = func(c net.Conn, s http.ConnState) {
+		if s == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	tr := New()
+	tr.CloseIdleConnections()
+
+	rsp, err := tr.Get(context.Background(), ts.URL, nil, nil)
+	assert.Nil(t, err)
+	_, _ = rsp.Bytes()
+	rsp.Close()
+
+	tr.CloseIdleConnections()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle connection not closed")
+	}
+
+	rt := &idleCloser{}
+	tr.SetClient(&http.Client{Transport: rt}).SetRoundTripper(rt)
+	tr.CloseIdleConnections()
+	assert.Equal(t, rt.closed, 2)
+}
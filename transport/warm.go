@@ -0,0 +1,64 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// SetIdleTimeout set how long an idle upstream connection is kept in the pool, 0 to use the default (90s)
+func (t *Transport) SetIdleTimeout(timeout time.Duration) *Transport {
+	t.Lock()
+	t.idleTimeout = timeout
+	t.reset()
+	t.Unlock()
+
+	return t
+}
+
+// SetKeepAlive set the tcp keepalive period of upstream connections, 0 to use the default (30s), negative to disable
+func (t *Transport) SetKeepAlive(period time.Duration) *Transport {
+	t.Lock()
+	t.keepAlive = period
+	t.reset()
+	t.Unlock()
+
+	return t
+}
+
+// Warm establishes a connection to upstream and keeps it in the pool, so that the next query skips the handshake
+func (t *Transport) Warm(ctx context.Context, surl string) error {
+	req, err := http.NewRequest(http.MethodHead, surl, nil)
+	if err != nil {
+		return err
+	}
+
+	rsp, err := t.Client().Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	_, _ = io.Copy(io.Discard, rsp.Body)
+
+	return rsp.Body.Close()
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package transport
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/likexian/gokit/assert"
+)
+
+func TestWarm(t *testing.T) {
+	var mu sync.Mutex
+	conns := 0
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Config.ConnState = func(c net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	tr := New().SetIdleTimeout(time.Minute).SetKeepAlive(10 * time.Second)
+	assert.Equal(t, tr.Client().Transport.(*http.Transport).IdleConnTimeout, time.Minute)
+
+	ctx := context.Background()
+	err := tr.Warm(ctx, ts.URL)
+	assert.Nil(t, err)
+
+	rsp, err := tr.Get(ctx, ts.URL, nil, nil)
+	assert.Nil(t, err)
+	_, _ = rsp.Bytes()
+	rsp.Close()
+
+	mu.Lock()
+	assert.Equal(t, conns, 1)
+	mu.Unlock()
+
+	err = tr.Warm(ctx, "::")
+	assert.NotNil(t, err)
+
+	err = tr.Warm(ctx, "http://127.0.0.1:1")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,187 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// Expectations is a declarative list of the expected records of a zone,
+// it is loaded from a yaml or toml file by the config package
+type Expectations struct {
+	// Zone is the zone of the relative names, for example: likexian.com
+	Zone string `yaml:"zone" toml:"zone"`
+	// Records is the expected record sets
+	Records []Expectation `yaml:"records" toml:"records"`
+}
+
+// Expectation is the expected record set of a name and type
+type Expectation struct {
+	// Name is the record name relative to the zone, @ or empty for the zone apex, ending with a dot for an absolute one
+	Name string `yaml:"name" toml:"name"`
+	// Type is the query type, for example: A
+	Type string `yaml:"type" toml:"type"`
+	// Data is the expected answer data, the TXT ones are the strings concatenated without quotes,
+	// empty for the name having no records of the type
+	Data []string `yaml:"data" toml:"data"`
+	// Contains is whether the answers can have more data than expected, for example the rotating pools
+	Contains bool `yaml:"contains" toml:"contains"`
+}
+
+// Mismatch is the record set answered by a provider not as expected, the error is set if the query failed
+type Mismatch struct {
+	Provider string
+	Name     dns.Domain
+	Type     dns.Type
+	Want     []string
+	Got      []string
+	Err      error
+}
+
+// Validate returns an error if the expectations are invalid
+func (e *Expectations) Validate() error {
+	for k, v := range e.Records {
+		if _, err := dns.Type(v.Type).Code(); err != nil {
+			return fmt.Errorf("doh: expectations: record %d: %s", k, err)
+		}
+		name := e.name(v)
+		if name == "" {
+			return fmt.Errorf("doh: expectations: record %d: name is required without zone", k)
+		}
+		if _, err := name.Punycode(); err != nil {
+			return fmt.Errorf("doh: expectations: record %d: %s", k, err)
+		}
+	}
+
+	return nil
+}
+
+// name returns the absolute name of the expectation without the trailing dot
+func (e *Expectations) name(v Expectation) dns.Domain {
+	name := strings.TrimSpace(v.Name)
+
+	switch {
+	case strings.HasSuffix(name, "."):
+		name = strings.TrimSuffix(name, ".")
+	case name == "" || name == "@":
+		name = strings.Trim(strings.TrimSpace(e.Zone), ".")
+	case strings.Trim(strings.TrimSpace(e.Zone), ".") != "":
+		name += "." + strings.Trim(strings.TrimSpace(e.Zone), ".")
+	}
+
+	return dns.Domain(name)
+}
+
+// String returns string of mismatch
+func (m Mismatch) String() string {
+	if m.Err != nil {
+		return fmt.Sprintf("%s %s %s: %s", m.Provider, m.Name, m.Type, m.Err)
+	}
+
+	return fmt.Sprintf("%s %s %s: got %v, want %v", m.Provider, m.Name, m.Type, m.Got, m.Want)
+}
+
+// Verify queries each expected record set of every provider directly, bypassing the cache and middlewares,
+// and returns the mismatches in the order of providers and records, empty if all are verified
+func (c *DoH) Verify(ctx context.Context, e *Expectations) []Mismatch {
+	ps, _ := c.list()
+
+	mismatches := make([][]Mismatch, len(ps))
+	wg := sync.WaitGroup{}
+	for k, p := range ps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, v := range e.Records {
+				if m, ok := verify(ctx, p, e.name(v), v); !ok {
+					mismatches[k] = append(mismatches[k], m)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	ms := []Mismatch{}
+	for _, v := range mismatches {
+		ms = append(ms, v...)
+	}
+
+	return ms
+}
+
+// verify returns the mismatch of an expected record set answered by the provider, and whether it is verified,
+// the NXDOMAIN is verified as having no records
+func verify(ctx context.Context, p Provider, name dns.Domain, v Expectation) (Mismatch, bool) {
+	t := dns.Type(v.Type).Normalize()
+	m := Mismatch{Provider: p.String(), Name: name, Type: t, Want: expectedData(t, v.Data), Got: []string{}}
+
+	rsp, err := p.Query(ctx, name, t)
+	if err != nil && (rsp == nil || rsp.Status != 3) {
+		m.Err = err
+		return m, false
+	}
+
+	if t == dns.TypeTXT {
+		data := []string{}
+		for _, v := range dns.Records[dns.TXT](rsp) {
+			data = append(data, string(v))
+		}
+		m.Got = expectedData(t, data)
+	} else if rsp.Status == 0 {
+		data := []string{}
+		for v := range rsp.Answers(t) {
+			data = append(data, v.Data)
+		}
+		m.Got = expectedData(t, data)
+	}
+
+	if v.Contains && len(m.Want) > 0 {
+		for _, w := range m.Want {
+			if _, ok := slices.BinarySearch(m.Got, w); !ok {
+				return m, false
+			}
+		}
+		return m, true
+	}
+
+	return m, slices.Equal(m.Got, m.Want)
+}
+
+// expectedData returns the data normalized for comparing, the ones not TXT are case insensitive
+func expectedData(t dns.Type, data []string) []string {
+	if t == dns.TypeTXT {
+		vs := slices.Clone(data)
+		slices.Sort(vs)
+		return slices.Compact(vs)
+	}
+
+	vs := []string{}
+	for _, v := range data {
+		vs = append(vs, strings.ToLower(strings.Join(strings.Fields(v), " ")))
+	}
+
+	return normalizeData(vs)
+}
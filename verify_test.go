@@ -0,0 +1,142 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/dohtest"
+	"github.com/likexian/gokit/assert"
+)
+
+// testExpectations is the expectations in yaml for testing
+const testExpectations = `
+zone: likexian.com
+records:
+  - name: "@"
+    type: a
+    data: [1.2.3.4, 5.6.7.8]
+  - name: www
+    type: CNAME
+    data: [LIKEXIAN.com.]
+  - name: "@"
+    type: MX
+    data: ["10  mx.likexian.com."]
+  - name: "@"
+    type: TXT
+    data: ["v=spf1 -all"]
+  - name: cdn
+    type: A
+    data: [1.1.1.1]
+    contains: true
+  - name: old
+    type: A
+  - name: likexian.org.
+    type: A
+    data: [9.9.9.9]
+`
+
+// parseExpectations returns the validated expectations of yaml data
+func parseExpectations(s string) (*Expectations, error) {
+	e := &Expectations{}
+	if err := decodeYAML(s, e); err != nil {
+		return nil, err
+	}
+
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func TestExpectations(t *testing.T) {
+	e, err := parseExpectations(testExpectations)
+	assert.Nil(t, err)
+	assert.Equal(t, e.Zone, "likexian.com")
+	assert.Equal(t, len(e.Records), 7)
+	assert.Equal(t, e.name(e.Records[0]), dns.Domain("likexian.com"))
+	assert.Equal(t, e.name(e.Records[1]), dns.Domain("www.likexian.com"))
+	assert.Equal(t, e.name(e.Records[6]), dns.Domain("likexian.org"))
+	assert.True(t, e.Records[4].Contains)
+
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{"records:\n  - name: www\n    type: XX\n", "record 0"},
+		{"records:\n  - type: A\n", "name is required without zone"},
+		{"records:\n  - name: likexian..com.\n    type: A\n", "record 0"},
+	}
+
+	for _, v := range tests {
+		_, err := parseExpectations(v.in)
+		assert.Contains(t, err.Error(), v.err, v.in)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	e, err := parseExpectations(testExpectations)
+	assert.Nil(t, err)
+
+	p1 := dohtest.New("one")
+	p1.Answer("likexian.com", dns.TypeA, "5.6.7.8", "1.2.3.4")
+	p1.Answer("www.likexian.com", dns.TypeCNAME, "likexian.com.")
+	p1.Answer("likexian.com", dns.TypeMX, "10 mx.likexian.com.")
+	p1.Answer("likexian.com", dns.TypeTXT, `"v=spf1 " "-all"`)
+	p1.Answer("cdn.likexian.com", dns.TypeA, "1.1.1.1", "1.0.0.1")
+	p1.Answer("likexian.org", dns.TypeA, "9.9.9.9")
+
+	p2 := dohtest.New("two")
+	p2.Answer("likexian.com", dns.TypeA, "1.2.3.4")
+	p2.Answer("www.likexian.com", dns.TypeCNAME, "likexian.com.")
+	p2.Answer("likexian.com", dns.TypeMX, "10 mx.likexian.com.")
+	p2.Answer("likexian.com", dns.TypeTXT, `"v=spf1 ~all"`)
+	p2.Answer("cdn.likexian.com", dns.TypeA, "1.0.0.1")
+	p2.Answer("old.likexian.com", dns.TypeA, "2.2.2.2")
+	p2.On("likexian.org", dns.TypeA).Error(errors.New("injected"))
+
+	c := UseProviders(p1, p2)
+	defer c.Close()
+
+	ms := c.Verify(context.Background(), e)
+	assert.Equal(t, len(ms), 5)
+	for _, v := range ms {
+		assert.Equal(t, v.Provider, "two")
+	}
+
+	assert.Equal(t, ms[0].Name, dns.Domain("likexian.com"))
+	assert.Equal(t, ms[0].Type, dns.TypeA)
+	assert.Equal(t, ms[0].Want, []string{"1.2.3.4", "5.6.7.8"})
+	assert.Equal(t, ms[0].Got, []string{"1.2.3.4"})
+	assert.Equal(t, ms[0].String(), "two likexian.com A: got [1.2.3.4], want [1.2.3.4 5.6.7.8]")
+	assert.Equal(t, ms[1].Got, []string{"v=spf1 ~all"})
+	assert.Equal(t, ms[2].Name, dns.Domain("cdn.likexian.com"))
+	assert.Equal(t, ms[3].Want, []string{})
+	assert.Equal(t, ms[3].Got, []string{"2.2.2.2"})
+	assert.Equal(t, ms[4].Err.Error(), "injected")
+	assert.Equal(t, ms[4].String(), "two likexian.org A: injected")
+
+	ms = UseProviders(p1).Verify(context.Background(), e)
+	assert.Equal(t, ms, []Mismatch{})
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ideatocode/doh-go/dns"
+)
+
+// DefaultWildcardProbes is the default number of random names queried to detect a wildcard
+const DefaultWildcardProbes = 3
+
+// WildcardReport is the wildcard behavior of a zone for a query type
+type WildcardReport struct {
+	Zone dns.Domain
+	Type dns.Type
+	// Probes is the random names queried in the zone
+	Probes []dns.Domain
+	// Wildcard is whether every random name is answered, which is done by a wildcard record
+	Wildcard bool
+	// Consistent is whether the random names are answered the same data, false for the rotating pools
+	Consistent bool
+	// Data is the sorted distinct answer data of the random names
+	Data []string
+}
+
+// CheckWildcard queries random names in the zone and compares the answers, to detect a wildcard of the type,
+// so that the names enumerated can be told from the ones matched by the wildcard, probes <= 0 for the default
+func (c *DoH) CheckWildcard(ctx context.Context, zone dns.Domain, t dns.Type, probes int) (*WildcardReport, error) {
+	if probes <= 0 {
+		probes = DefaultWildcardProbes
+	}
+
+	t = t.Normalize()
+	zone = dns.Domain(strings.Trim(strings.TrimSpace(string(zone)), "."))
+	r := &WildcardReport{Zone: zone, Type: t, Probes: []dns.Domain{}, Data: []string{}}
+
+	consistent := true
+	var first []string
+	for i := range probes {
+		name := dns.Domain(strconv.FormatUint(rand.Uint64(), 36) + "." + string(zone))
+		r.Probes = append(r.Probes, name)
+
+		rsp, err := c.Query(ctx, name, t)
+		if err != nil && (rsp == nil || rsp.Status != 3) {
+			return r, err
+		}
+
+		data := answerData(rsp, t)
+		if len(data) == 0 {
+			r.Data = []string{}
+			return r, nil
+		}
+
+		if i == 0 {
+			first = data
+		} else if !slices.Equal(data, first) {
+			consistent = false
+		}
+		r.Data = normalizeData(append(r.Data, data...))
+	}
+	r.Wildcard, r.Consistent = true, consistent
+
+	return r, nil
+}
+
+// Matches returns whether the response is likely answered by the wildcard, all the data are the wildcard ones
+func (r *WildcardReport) Matches(rsp *dns.Response) bool {
+	if r == nil || !r.Wildcard {
+		return false
+	}
+
+	data := answerData(rsp, r.Type)
+	if len(data) == 0 {
+		return false
+	}
+
+	for _, v := range data {
+		if _, ok := slices.BinarySearch(r.Data, v); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// answerData returns the sorted distinct answer data of the type, empty if not answered
+func answerData(rsp *dns.Response, t dns.Type) []string {
+	data := []string{}
+	if rsp == nil || rsp.Status != 0 {
+		return data
+	}
+
+	for v := range rsp.Answers(t) {
+		data = append(data, v.Data)
+	}
+
+	return normalizeData(data)
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2019 Li Kexian
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * DNS over HTTPS (DoH) Golang implementation
+ * https://www.likexian.com/
+ */
+
+package doh
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ideatocode/doh-go/dns"
+	"github.com/ideatocode/doh-go/dohtest"
+	"github.com/likexian/gokit/assert"
+)
+
+func TestCheckWildcard(t *testing.T) {
+	p := dohtest.New("fake")
+	p.Answer("www.likexian.com", dns.TypeA, "1.2.3.4")
+	p.Answer("", dns.TypeA, "5.6.7.8", "5.6.7.9")
+	p.Answer("", dns.TypeMX, "10 mx.likexian.com.")
+
+	c := UseProviders(p)
+	defer c.Close()
+
+	ctx := context.Background()
+	r, err := c.CheckWildcard(ctx, "likexian.com.", "a", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, r.Zone, dns.Domain("likexian.com"))
+	assert.Equal(t, r.Type, dns.TypeA)
+	assert.Equal(t, len(r.Probes), DefaultWildcardProbes)
+	assert.True(t, strings.HasSuffix(string(r.Probes[0]), ".likexian.com"))
+	assert.NotEqual(t, r.Probes[0], r.Probes[1])
+	assert.True(t, r.Wildcard)
+	assert.True(t, r.Consistent)
+	assert.Equal(t, r.Data, []string{"5.6.7.8", "5.6.7.9"})
+
+	rsp, err := c.Query(ctx, "www.likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.False(t, r.Matches(rsp))
+	rsp, err = c.Query(ctx, "mail.likexian.com", dns.TypeA)
+	assert.Nil(t, err)
+	assert.True(t, r.Matches(rsp))
+	assert.False(t, r.Matches(nil))
+
+	r, err = c.CheckWildcard(ctx, "likexian.com", dns.TypeAAAA, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, len(r.Probes), 1)
+	assert.False(t, r.Wildcard)
+	assert.False(t, r.Matches(rsp))
+
+	r, err = c.CheckWildcard(ctx, "likexian.com", dns.TypeMX, 1)
+	assert.Nil(t, err)
+	assert.True(t, r.Wildcard)
+	assert.Equal(t, r.Data, []string{"10 mx.likexian.com"})
+}
+
+func TestCheckWildcardRotating(t *testing.T) {
+	p := dohtest.New("fake")
+	p.Answer("", dns.TypeA, "1.2.3.4").Times(1)
+	p.Answer("", dns.TypeA, "1.2.3.5")
+
+	c := UseProviders(p)
+	defer c.Close()
+
+	r, err := c.CheckWildcard(context.Background(), "likexian.com", dns.TypeA, 2)
+	assert.Nil(t, err)
+	assert.True(t, r.Wildcard)
+	assert.False(t, r.Consistent)
+	assert.Equal(t, r.Data, []string{"1.2.3.4", "1.2.3.5"})
+}
+
+func TestCheckWildcardError(t *testing.T) {
+	p := dohtest.New("fake")
+	p.On("", dns.TypeA).Status(2)
+	p.On("", dns.TypeAAAA).Error(errors.New("injected"))
+
+	c := UseProviders(p)
+	defer c.Close()
+
+	_, err := c.CheckWildcard(context.Background(), "likexian.com", dns.TypeA, 1)
+	assert.NotNil(t, err)
+
+	r, err := c.CheckWildcard(context.Background(), "likexian.com", dns.TypeAAAA, 1)
+	assert.NotNil(t, err)
+	assert.False(t, r.Wildcard)
+}